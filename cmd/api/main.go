@@ -21,7 +21,20 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
+// logDeprecations warns of the legacy settings read from a file
+func logDeprecations(log logger.Logger, path string, deprecations []string) {
+	for _, deprecation := range deprecations {
+		log.Warn("Deprecated configuration",
+			logger.String("config_file", path),
+			logger.String("setting", deprecation))
+	}
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+
 	// Load configuration
 	configPath := getEnvOrDefault("CONFIG_PATH", "configs/config.yaml")
 	cfg, err := config.LoadConfig(configPath)
@@ -58,6 +71,7 @@ func main() {
 	}
 
 	log := logger.NewLogger(logConfig)
+	logDeprecations(log, configPath, cfg.Deprecations)
 
 	// Load route configuration
 	routesPath := getEnvOrDefault("ROUTES_PATH", "configs/routes.yaml")
@@ -67,6 +81,17 @@ func main() {
 			logger.Error(err),
 			logger.String("config_file", routesPath))
 	}
+	logDeprecations(log, routesPath, routes.Deprecations)
+	if err := routes.ResolveRateLimitRefs(cfg.RateLimits); err != nil {
+		log.Fatal("Failed to resolve route rate limits",
+			logger.Error(err),
+			logger.String("config_file", routesPath))
+	}
+	if err := routes.ResolveFieldEncryptionKeys(&cfg.FieldEncryption); err != nil {
+		log.Fatal("Failed to resolve route field encryption keys",
+			logger.Error(err),
+			logger.String("config_file", routesPath))
+	}
 
 	// Create and start server
 	server := server.NewServer(cfg, routes, log)
@@ -80,10 +105,12 @@ func main() {
 		logger.String("env", logConfig.Fields["environment"]),
 		logger.String("version", logConfig.Fields["version"]))
 
-	// Graceful shutdown
+	// Graceful shutdown, reloading the configuration on SIGHUP until then
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := <-quit; sig == syscall.SIGHUP; sig = <-quit {
+		server.Reload(configPath, routesPath) // Failures are logged and reported on /health
+	}
 
 	log.Info("Shutting down API Gateway...")
 
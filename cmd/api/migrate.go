@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"api-gateway/internal/config"
+)
+
+// runMigrate upgrades config and routes files to the current schema version
+// and returns the exit code. The upgraded file is written to stdout, or in
+// place with -w; the changes made are listed on stderr.
+func runMigrate(args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write the upgraded files in place")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s migrate [-w] FILE...\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Upgrades config and routes files to schema version %d.\n\n", config.CurrentVersion)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 || (!*write && flags.NArg() > 1) {
+		flags.Usage()
+		return 2
+	}
+
+	for _, path := range flags.Args() {
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return 1
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return 1
+		}
+		migrated, changes, err := config.Migrate(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return 1
+		}
+
+		if len(changes) == 0 {
+			fmt.Fprintf(os.Stderr, "%s: already at version %d\n", path, config.CurrentVersion)
+		}
+		for _, change := range changes {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, change)
+		}
+		if !*write {
+			os.Stdout.Write(migrated)
+			continue
+		}
+		if len(changes) > 0 {
+			if err := os.WriteFile(path, migrated, info.Mode().Perm()); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+				return 1
+			}
+		}
+	}
+	return 0
+}
@@ -1,6 +1,9 @@
 package auth
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -20,6 +23,11 @@ var (
 	ErrExpiredToken = errors.New("token has expired")
 	ErrForbidden    = errors.New("forbidden: insufficient permissions")
 	ErrAuthFailed   = errors.New("authentication failed")
+
+	ErrQuotaExceeded = errors.New("API key quota exceeded")
+
+	// errInvalidAPIKey is returned when the validation service rejects a key
+	errInvalidAPIKey = errors.New("invalid API key")
 )
 
 // AuthService provides authentication functionality
@@ -27,8 +35,18 @@ type AuthService struct {
 	config *config.AuthConfig
 	log    logger.Logger
 	client *http.Client
+	// Resolves API keys issued by the gateway (nil if none)
+	keyLookup APIKeyLookup
+	// Caches validation URL results and verified JWTs (nil if off)
+	validationCache *validationCache
+	// Verifies JWTs signed by the identity provider (nil if off)
+	jwks *jwksKeySet
 }
 
+// APIKeyLookup resolves an API key issued by the gateway itself. It returns
+// nil for keys it did not issue, which are checked against the validation URL.
+type APIKeyLookup func(token string) (*Identity, error)
+
 // APIKeyResponse represents the response from the API key validation endpoint
 type APIKeyResponse struct {
 	Valid       bool     `json:"valid"`
@@ -47,18 +65,62 @@ type JWTClaims struct {
 
 // NewAuthService creates a new authentication service
 func NewAuthService(config *config.AuthConfig, log logger.Logger) *AuthService {
-	return &AuthService{
+	a := &AuthService{
 		config: config,
 		log:    log,
 		client: &http.Client{
 			Timeout: 5 * time.Second,
 		},
 	}
+	if config.ValidationCache.Enabled {
+		a.validationCache = newValidationCache(&config.ValidationCache, log)
+	}
+	if config.JWKSURL != "" {
+		a.jwks = newJWKSKeySet(config.JWKSURL, time.Duration(config.JWKSRefreshInterval)*time.Second, a.validationCache, log)
+	}
+	return a
+}
+
+// RedisStatus returns the state of the validation cache's Redis tier, or nil
+// if the cache doesn't use Redis
+func (a *AuthService) RedisStatus() *RedisStatus {
+	if a.validationCache == nil || a.validationCache.redis == nil {
+		return nil
+	}
+	status := a.validationCache.redisStatus()
+	return &status
+}
+
+// Close releases the validation cache's connections
+func (a *AuthService) Close() {
+	if a.validationCache != nil {
+		a.validationCache.close()
+	}
+}
+
+// SetAPIKeyLookup resolves API keys through lookup before the validation URL.
+// It must be set before requests are served.
+func (a *AuthService) SetAPIKeyLookup(lookup APIKeyLookup) {
+	a.keyLookup = lookup
 }
 
 // ValidateToken validates the provided authentication token
 // It first tries to validate as a JWT token, if that fails, it tries as an API token
 func (a *AuthService) ValidateToken(r *http.Request, allowedRoles []string) (bool, error) {
+	return a.ValidateTokenWithConstraints(r, allowedRoles, nil)
+}
+
+// ValidateTokenWithConstraints validates the provided authentication token like
+// ValidateToken and additionally checks JWTs against the route's claim requirements.
+// API tokens carry no claims and are not subject to the constraints.
+func (a *AuthService) ValidateTokenWithConstraints(r *http.Request, allowedRoles []string, constraints *config.JWTValidation) (bool, error) {
+	identity, err := a.Authenticate(r, allowedRoles, constraints)
+	return identity != nil, err
+}
+
+// Authenticate validates the request credentials like ValidateTokenWithConstraints
+// and returns the identity of the caller
+func (a *AuthService) Authenticate(r *http.Request, allowedRoles []string, constraints *config.JWTValidation) (*Identity, error) {
 	var jwtToken, apiToken string
 
 	// First look in headers
@@ -84,38 +146,59 @@ func (a *AuthService) ValidateToken(r *http.Request, allowedRoles []string) (boo
 
 	// Try JWT validation first
 	if jwtToken != "" {
-		valid, _, err := a.validateJWT(jwtToken)
+		valid, role, err := a.checkJWT(r.Context(), jwtToken)
 		if err == nil && valid {
+			// The signature was verified above, so the claims can be trusted
+			claims := jwt.MapClaims{}
+			if _, _, err := jwt.NewParser().ParseUnverified(jwtToken, claims); err != nil {
+				return nil, ErrInvalidToken
+			}
+			if constraints != nil {
+				if err := checkJWTConstraints(claims, constraints); err != nil {
+					a.log.Debug("JWT rejected by route requirements", logger.Error(err))
+					return nil, err
+				}
+			}
+
 			// Skip role checking - any authenticated user is allowed
-			return true, nil
+			return newJWTIdentity(claims, role), nil
 		}
 
 		// If it's a definite error like malformed JWT, return immediately
 		if err != nil && !errors.Is(err, ErrNoToken) {
 			a.log.Debug("JWT validation failed", logger.Error(err))
-			return false, err
+			return nil, err
 		}
 	}
 
 	// Try API token validation next
+	if apiToken != "" && a.keyLookup != nil {
+		identity, err := a.keyLookup(apiToken)
+		if err != nil {
+			return nil, err
+		}
+		if identity != nil {
+			return identity, nil
+		}
+	}
 	if apiToken != "" {
-		valid, _, err := a.validateAPIToken(apiToken)
+		identity, err := a.checkAPIToken(r.Context(), apiToken)
 		if err != nil {
 			a.log.Debug("API token validation failed", logger.Error(err))
-			return false, err
+			return nil, err
 		}
-		if valid {
+		if identity != nil {
 			// Skip role checking - any authenticated user is allowed
-			return true, nil
+			return identity, nil
 		}
 	}
 
 	// Neither token type was valid
 	if jwtToken == "" && apiToken == "" {
-		return false, ErrNoToken
+		return nil, ErrNoToken
 	}
 
-	return false, ErrAuthFailed
+	return nil, ErrAuthFailed
 }
 
 // extractJWTToken extracts JWT token from the Authorization header
@@ -164,39 +247,142 @@ func (a *AuthService) extractAPITokenFromQuery(r *http.Request) string {
 }
 
 // validateJWT validates a JWT token and returns the associated role
-func (a *AuthService) validateJWT(tokenString string) (bool, string, error) {
+func (a *AuthService) validateJWT(ctx context.Context, tokenString string) (bool, string, error) {
+	claims, err := a.verifyJWT(ctx, tokenString)
+	if err != nil {
+		return false, "", err
+	}
+	return true, claims.Role, nil
+}
+
+// verifyJWT checks a JWT's signature and validity and returns its claims.
+// HMAC tokens are verified with the JWT secret, and RSA and ECDSA tokens with
+// the key set's key named by the token.
+func (a *AuthService) verifyJWT(ctx context.Context, tokenString string) (*JWTClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
 		// Validate the algorithm
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodHMAC:
+			// Without a secret, such as with only a key set, anyone could sign
+			if a.config.JWTSecret == "" {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return []byte(a.config.JWTSecret), nil
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+			return a.jwksKey(ctx, token)
+		default:
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(a.config.JWTSecret), nil
 	})
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
-			return false, "", ErrExpiredToken
+			return nil, ErrExpiredToken
+		}
+		if errors.Is(err, errUnknownKey) {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidToken, errUnknownKey)
 		}
-		return false, "", ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
 
 	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
+		return claims, nil
+	}
+
+	return nil, ErrInvalidToken
+}
+
+// jwksKey returns the key set's key verifying token, checking that its type
+// matches the token's algorithm
+func (a *AuthService) jwksKey(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	if a.jwks == nil {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	kid, _ := token.Header["kid"].(string)
+	key, err := a.jwks.key(ctx, kid)
+	if err != nil {
+		return nil, err
+	}
+	switch key.(type) {
+	case *rsa.PublicKey:
+		if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
+			return key, nil
+		}
+	case *ecdsa.PublicKey:
+		if _, ok := token.Method.(*jwt.SigningMethodECDSA); ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("key %q doesn't match signing method %v", kid, token.Header["alg"])
+}
+
+// checkJWT validates a JWT like validateJWT, answering from the validation
+// cache when it holds a result. Valid tokens are cached no longer than they
+// are valid, and tokens that fail verification for the negative TTL. Expired
+// tokens and tokens signed with a key the key set doesn't hold yet aren't
+// cached.
+func (a *AuthService) checkJWT(ctx context.Context, tokenString string) (bool, string, error) {
+	if a.validationCache == nil {
+		return a.validateJWT(ctx, tokenString)
+	}
+	key := jwtCacheKey(tokenString)
+	if result, ok := a.validationCache.lookup(ctx, key); ok {
+		if !result.Valid {
+			return false, "", ErrInvalidToken
+		}
+		return true, result.Role, nil
+	}
+
+	claims, err := a.verifyJWT(ctx, tokenString)
+	switch {
+	case err == nil:
+		ttl := a.validationCache.ttl
+		if claims.ExpiresAt != nil {
+			ttl = min(ttl, time.Until(claims.ExpiresAt.Time))
+		}
+		a.validationCache.put(ctx, key, validationResult{Valid: true, Role: claims.Role}, ttl)
 		return true, claims.Role, nil
+	case errors.Is(err, ErrInvalidToken) && !errors.Is(err, errUnknownKey):
+		a.validationCache.put(ctx, key, validationResult{}, a.validationCache.negativeTTL)
 	}
+	return false, "", err
+}
 
-	return false, "", ErrInvalidToken
+// checkAPIToken validates an API token, answering from the validation cache
+// when it holds a result. Only definite answers are cached; failures to reach
+// the validation service are not.
+func (a *AuthService) checkAPIToken(ctx context.Context, token string) (*Identity, error) {
+	if a.validationCache == nil {
+		return a.validateAPIToken(token)
+	}
+	if result, ok := a.validationCache.get(ctx, token); ok {
+		if !result.Valid {
+			return nil, errInvalidAPIKey
+		}
+		return result.identity(), nil
+	}
+
+	identity, err := a.validateAPIToken(token)
+	switch {
+	case err == nil:
+		a.validationCache.set(ctx, token, identity)
+	case errors.Is(err, errInvalidAPIKey):
+		a.validationCache.set(ctx, token, nil)
+	}
+	return identity, err
 }
 
-// validateAPIToken validates an API token by making a request to the validation endpoint
-func (a *AuthService) validateAPIToken(token string) (bool, string, error) {
+// validateAPIToken validates an API token by making a request to the
+// validation endpoint and returns the identity it describes
+func (a *AuthService) validateAPIToken(token string) (*Identity, error) {
 	if a.config.APIKeyValidationURL == "" {
-		return false, "", errors.New("API key validation URL not configured")
+		return nil, errors.New("API key validation URL not configured")
 	}
 
 	// Create a new HTTP request according to the specified format
 	req, err := http.NewRequest(http.MethodPost, a.config.APIKeyValidationURL, nil)
 	if err != nil {
-		return false, "", err
+		return nil, err
 	}
 
 	// Set the x-api-key header instead of Authorization header
@@ -205,27 +391,37 @@ func (a *AuthService) validateAPIToken(token string) (bool, string, error) {
 
 	resp, err := a.client.Do(req)
 	if err != nil {
-		return false, "", fmt.Errorf("API key validation request failed: %w", err)
+		return nil, fmt.Errorf("API key validation request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
-	// Check if the response status code is successful
+	// Check if the response status code is successful. 401 and 403 reject
+	// the key itself, other statuses are failures of the service.
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("API key validation failed with status: %d: %w", resp.StatusCode, errInvalidAPIKey)
+	}
 	if resp.StatusCode != http.StatusOK {
-		return false, "", fmt.Errorf("API key validation failed with status: %d", resp.StatusCode)
+		return nil, fmt.Errorf("API key validation failed with status: %d", resp.StatusCode)
 	}
 
 	// Parse the response body
 	var apiKeyResp APIKeyResponse
 	if err := json.NewDecoder(resp.Body).Decode(&apiKeyResp); err != nil {
-		return false, "", fmt.Errorf("failed to decode API key validation response: %w", err)
+		return nil, fmt.Errorf("failed to decode API key validation response: %w", err)
 	}
 
 	if !apiKeyResp.Valid {
-		return false, "", errors.New("invalid API key")
+		return nil, errInvalidAPIKey
 	}
 
-	// Return the validation result and role
-	return true, apiKeyResp.Role, nil
+	// The permissions granted to the key are its scopes
+	return &Identity{
+		Type:    IdentityAPIKey,
+		Subject: apiKeyResp.UserID,
+		Tenant:  apiKeyResp.TenantID,
+		Role:    apiKeyResp.Role,
+		Scopes:  apiKeyResp.Permissions,
+	}, nil
 }
 
 // checkRole checks if the provided role is in the list of allowed roles
@@ -3,6 +3,7 @@ package auth
 import (
 	"api-gateway/internal/config"
 	"api-gateway/pkg/logger"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -186,7 +187,7 @@ func TestValidateJWT(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			valid, role, err := svc.validateJWT(tt.token)
+			valid, role, err := svc.validateJWT(context.Background(), tt.token)
 			assert.Equal(t, tt.wantValid, valid)
 			assert.Equal(t, tt.wantRole, role)
 			if tt.wantErr != nil {
@@ -262,9 +263,13 @@ func TestValidateAPIToken(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			valid, role, err := svc.validateAPIToken(tt.token)
-			assert.Equal(t, tt.wantValid, valid)
-			assert.Equal(t, tt.wantRole, role)
+			identity, err := svc.validateAPIToken(tt.token)
+			assert.Equal(t, tt.wantValid, identity != nil)
+			if identity != nil {
+				assert.Equal(t, tt.wantRole, identity.Role)
+				assert.Equal(t, "user123", identity.Subject)
+				assert.Equal(t, "tenant456", identity.Tenant)
+			}
 			if tt.wantErr {
 				assert.Error(t, err)
 			} else {
@@ -430,3 +435,33 @@ func TestCheckRole(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthenticateWithAPIKeyLookup(t *testing.T) {
+	svc := NewAuthService(&config.AuthConfig{APIKeyHeader: "X-API-Key"}, &mockLogger{})
+	svc.SetAPIKeyLookup(func(token string) (*Identity, error) {
+		switch token {
+		case "issued":
+			return &Identity{Type: IdentityAPIKey, Subject: "key_1", Role: "developer"}, nil
+		case "exhausted":
+			return nil, ErrQuotaExceeded
+		}
+		return nil, nil
+	})
+
+	authenticate := func(token string) (*Identity, error) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-API-Key", token)
+		return svc.Authenticate(req, nil, nil)
+	}
+
+	identity, err := authenticate("issued")
+	require.NoError(t, err)
+	assert.Equal(t, "key_1", identity.Subject)
+
+	_, err = authenticate("exhausted")
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+
+	// Keys the lookup doesn't know go to the validation URL, unset here
+	_, err = authenticate("other")
+	assert.ErrorContains(t, err, "validation URL not configured")
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrInvalidAudience = errors.New("token audience not accepted")
+	ErrInvalidIssuer   = errors.New("token issuer not accepted")
+	ErrTokenTooOld     = errors.New("token is too old")
+	ErrClaimMismatch   = errors.New("token claims do not satisfy route requirements")
+)
+
+// checkJWTConstraints verifies the claims of a token whose signature has already
+// been validated against the audience, issuer, age and claim requirements of a route
+func checkJWTConstraints(claims jwt.MapClaims, constraints *config.JWTValidation) error {
+	if len(constraints.Audience) > 0 && !audienceAccepted(claims["aud"], constraints.Audience) {
+		return ErrInvalidAudience
+	}
+
+	if constraints.Issuer != "" {
+		if issuer, _ := claims["iss"].(string); issuer != constraints.Issuer {
+			return ErrInvalidIssuer
+		}
+	}
+
+	if constraints.MaxAge > 0 {
+		issuedAt, ok := claims["iat"].(float64)
+		if !ok {
+			return ErrTokenTooOld
+		}
+		age := time.Since(time.Unix(int64(issuedAt), 0))
+		if age > time.Duration(constraints.MaxAge)*time.Second {
+			return ErrTokenTooOld
+		}
+	}
+
+	for name, expected := range constraints.Claims {
+		if !claimMatches(lookupClaim(claims, name), expected) {
+			return fmt.Errorf("%w: %s", ErrClaimMismatch, name)
+		}
+	}
+
+	return nil
+}
+
+// audienceAccepted reports whether the aud claim contains any accepted audience
+func audienceAccepted(aud interface{}, accepted []string) bool {
+	var audiences []string
+	switch v := aud.(type) {
+	case string:
+		audiences = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+	}
+
+	for _, audience := range audiences {
+		for _, want := range accepted {
+			if audience == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lookupClaim returns the named claim, following dots into nested objects when
+// no top-level claim has the exact name
+func lookupClaim(claims jwt.MapClaims, name string) interface{} {
+	if value, ok := claims[name]; ok {
+		return value
+	}
+
+	var current interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(name, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current, ok = object[part]
+		if !ok {
+			return nil
+		}
+	}
+	return current
+}
+
+// claimMatches reports whether a scalar claim equals expected or an array claim contains it
+func claimMatches(value interface{}, expected string) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case []interface{}:
+		for _, item := range v {
+			if claimMatches(item, expected) {
+				return true
+			}
+		}
+		return false
+	case map[string]interface{}:
+		return false
+	default:
+		return fmt.Sprint(v) == expected
+	}
+}
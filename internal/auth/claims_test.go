@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createTestJWTWithClaims(t *testing.T, secret string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signedToken, err := token.SignedString([]byte(secret))
+	require.NoError(t, err)
+	return signedToken
+}
+
+func TestCheckJWTConstraints(t *testing.T) {
+	now := time.Now()
+
+	baseClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub":    "test-user",
+			"aud":    []string{"orders-api", "billing-api"},
+			"iss":    "https://issuer.example.com",
+			"iat":    now.Add(-time.Minute).Unix(),
+			"exp":    now.Add(time.Hour).Unix(),
+			"tenant": "acme",
+			"groups": []string{"admins", "devs"},
+			"org":    map[string]interface{}{"env": "prod"},
+			"level":  3,
+		}
+	}
+
+	tests := []struct {
+		name        string
+		modify      func(jwt.MapClaims)
+		constraints *config.JWTValidation
+		expectedErr error
+	}{
+		{
+			name:        "all constraints satisfied",
+			constraints: &config.JWTValidation{Audience: []string{"orders-api"}, Issuer: "https://issuer.example.com", MaxAge: 300, Claims: map[string]string{"tenant": "acme", "groups": "devs", "org.env": "prod", "level": "3"}},
+		},
+		{
+			name:        "string audience",
+			modify:      func(c jwt.MapClaims) { c["aud"] = "orders-api" },
+			constraints: &config.JWTValidation{Audience: []string{"orders-api"}},
+		},
+		{
+			name:        "wrong audience",
+			constraints: &config.JWTValidation{Audience: []string{"shipping-api"}},
+			expectedErr: ErrInvalidAudience,
+		},
+		{
+			name:        "missing audience",
+			modify:      func(c jwt.MapClaims) { delete(c, "aud") },
+			constraints: &config.JWTValidation{Audience: []string{"orders-api"}},
+			expectedErr: ErrInvalidAudience,
+		},
+		{
+			name:        "wrong issuer",
+			constraints: &config.JWTValidation{Issuer: "https://other.example.com"},
+			expectedErr: ErrInvalidIssuer,
+		},
+		{
+			name:        "token too old",
+			modify:      func(c jwt.MapClaims) { c["iat"] = now.Add(-time.Hour).Unix() },
+			constraints: &config.JWTValidation{MaxAge: 600},
+			expectedErr: ErrTokenTooOld,
+		},
+		{
+			name:        "max age without issued at",
+			modify:      func(c jwt.MapClaims) { delete(c, "iat") },
+			constraints: &config.JWTValidation{MaxAge: 600},
+			expectedErr: ErrTokenTooOld,
+		},
+		{
+			name:        "claim value differs",
+			constraints: &config.JWTValidation{Claims: map[string]string{"tenant": "globex"}},
+			expectedErr: ErrClaimMismatch,
+		},
+		{
+			name:        "array claim lacks value",
+			constraints: &config.JWTValidation{Claims: map[string]string{"groups": "ops"}},
+			expectedErr: ErrClaimMismatch,
+		},
+		{
+			name:        "claim missing",
+			constraints: &config.JWTValidation{Claims: map[string]string{"region": "eu"}},
+			expectedErr: ErrClaimMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := baseClaims()
+			if tt.modify != nil {
+				tt.modify(claims)
+			}
+			// Round trip through a signed token so claims have their decoded JSON types
+			parsed := jwt.MapClaims{}
+			_, _, err := jwt.NewParser().ParseUnverified(createTestJWTWithClaims(t, "test-secret", claims), parsed)
+			require.NoError(t, err)
+
+			err = checkJWTConstraints(parsed, tt.constraints)
+			if tt.expectedErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestValidateTokenWithConstraints(t *testing.T) {
+	svc := NewAuthService(&config.AuthConfig{JWTSecret: "test-secret", JWTHeader: "Authorization"}, &mockLogger{})
+	constraints := &config.JWTValidation{Audience: []string{"orders-api"}}
+
+	accepted := createTestJWTWithClaims(t, "test-secret", jwt.MapClaims{"aud": "orders-api", "exp": time.Now().Add(time.Hour).Unix()})
+	rejected := createTestJWTWithClaims(t, "test-secret", jwt.MapClaims{"aud": "billing-api", "exp": time.Now().Add(time.Hour).Unix()})
+	forged := createTestJWTWithClaims(t, "wrong-secret", jwt.MapClaims{"aud": "orders-api", "exp": time.Now().Add(time.Hour).Unix()})
+
+	req := httptest.NewRequest("GET", "/orders", nil)
+	req.Header.Set("Authorization", "Bearer "+accepted)
+	valid, err := svc.ValidateTokenWithConstraints(req, nil, constraints)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	req.Header.Set("Authorization", "Bearer "+rejected)
+	valid, err = svc.ValidateTokenWithConstraints(req, nil, constraints)
+	assert.ErrorIs(t, err, ErrInvalidAudience)
+	assert.False(t, valid)
+
+	// The signature is still verified before any claim is trusted
+	req.Header.Set("Authorization", "Bearer "+forged)
+	valid, err = svc.ValidateTokenWithConstraints(req, nil, constraints)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.False(t, valid)
+}
+
+func TestAuthenticateJWTIdentity(t *testing.T) {
+	svc := NewAuthService(&config.AuthConfig{JWTSecret: "test-secret", JWTHeader: "Authorization"}, &mockLogger{})
+
+	token := createTestJWTWithClaims(t, "test-secret", jwt.MapClaims{
+		"sub": "alice", "tid": "acme", "role": "admin", "scope": "orders:read orders:write",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	req := httptest.NewRequest("GET", "/orders", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	identity, err := svc.Authenticate(req, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, IdentityJWT, identity.Type)
+	assert.Equal(t, "alice", identity.Subject)
+	assert.Equal(t, "acme", identity.Tenant)
+	assert.Equal(t, "admin", identity.Role)
+	assert.Equal(t, []string{"orders:read", "orders:write"}, identity.Scopes)
+
+	// Scopes may also be an array
+	identity = newJWTIdentity(map[string]interface{}{"scp": []interface{}{"a", "b"}}, "")
+	assert.Equal(t, []string{"a", "b"}, identity.Scopes)
+}
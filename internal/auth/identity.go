@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"strings"
+)
+
+// Identity types
+const (
+	IdentityJWT    = "jwt"
+	IdentityAPIKey = "api_key"
+)
+
+// Identity describes the authenticated caller of a request. Type is the
+// authentication method.
+type Identity struct {
+	Type    string                 `json:"type"`
+	Subject string                 `json:"subject,omitempty"`
+	Tenant  string                 `json:"tenant,omitempty"`
+	Role    string                 `json:"role,omitempty"`
+	Scopes  []string               `json:"scopes,omitempty"`
+	Claims  map[string]interface{} `json:"claims,omitempty"`
+}
+
+// newJWTIdentity builds the identity of a verified JWT. The tenant is read
+// from the tenant_id, tenant or tid claim, and the scopes from the
+// space-separated scope claim or the scp or scopes arrays.
+func newJWTIdentity(claims map[string]interface{}, role string) *Identity {
+	identity := &Identity{Type: IdentityJWT, Role: role, Claims: claims}
+	identity.Subject, _ = claims["sub"].(string)
+	for _, name := range []string{"tenant_id", "tenant", "tid"} {
+		if tenant, ok := claims[name].(string); ok && tenant != "" {
+			identity.Tenant = tenant
+			break
+		}
+	}
+
+	if scope, ok := claims["scope"].(string); ok {
+		identity.Scopes = strings.Fields(scope)
+	} else {
+		for _, name := range []string{"scp", "scopes"} {
+			if scopes, ok := claims[name].([]interface{}); ok {
+				for _, scope := range scopes {
+					if s, ok := scope.(string); ok {
+						identity.Scopes = append(identity.Scopes, s)
+					}
+				}
+				break
+			}
+		}
+	}
+	return identity
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the authenticated identity
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the identity stored by WithIdentity, or nil
+func IdentityFromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityKey{}).(*Identity)
+	return identity
+}
+
+// Claim returns a JWT claim by name, following dotted paths into nested
+// objects, or nil if the identity has no such claim
+func (i *Identity) Claim(name string) interface{} {
+	if i == nil || i.Claims == nil {
+		return nil
+	}
+	return lookupClaim(i.Claims, name)
+}
@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"api-gateway/pkg/logger"
+)
+
+// minJWKSRefetch limits how often the key set is fetched, so forged key IDs
+// or an unreachable identity provider don't cause a fetch per request
+const minJWKSRefetch = 10 * time.Second
+
+// maxJWKSSize bounds the key set document read from the identity provider
+const maxJWKSSize = 1 << 20
+
+// errUnknownKey is returned for tokens signed with a key not in the key set
+var errUnknownKey = errors.New("unknown signing key")
+
+// jwksKeySet holds the identity provider's public keys. The key set is
+// fetched from the JWKS URL and kept for the refresh interval. With the
+// validation cache's Redis tier the fetched document is shared, so gateway
+// instances don't each fetch it. When the identity provider can't be
+// reached, the keys already held are used.
+type jwksKeySet struct {
+	url     string
+	refresh time.Duration
+	client  *http.Client
+	cache   *validationCache // Shares the key set through Redis, nil if off
+	log     logger.Logger
+
+	mutex     sync.Mutex
+	keys      map[string]crypto.PublicKey // By key ID
+	fetched   time.Time
+	attempted time.Time
+}
+
+// jsonWebKey is a public key of a JWKS document
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// newJWKSKeySet creates a key set fetched from url
+func newJWKSKeySet(url string, refresh time.Duration, cache *validationCache, log logger.Logger) *jwksKeySet {
+	return &jwksKeySet{
+		url:     url,
+		refresh: refresh,
+		client:  &http.Client{Timeout: 5 * time.Second},
+		cache:   cache,
+		log:     log,
+	}
+}
+
+// key returns the public key with the given ID, fetching the key set when
+// it is due for a refresh or doesn't hold the key
+func (k *jwksKeySet) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	key, ok := k.keys[kid]
+	now := time.Now()
+	if (!ok || now.Sub(k.fetched) >= k.refresh) && now.Sub(k.attempted) >= minJWKSRefetch {
+		k.attempted = now
+		if err := k.fetch(ctx, kid); err != nil {
+			k.log.Warn("Failed to fetch JWKS key set",
+				logger.String("url", k.url),
+				logger.Error(err),
+			)
+		}
+		key, ok = k.keys[kid]
+	}
+	if !ok {
+		return nil, errUnknownKey
+	}
+	return key, nil
+}
+
+// fetch replaces the keys with the key set shared in Redis if it holds kid,
+// and otherwise with the identity provider's. The caller must hold the mutex.
+func (k *jwksKeySet) fetch(ctx context.Context, kid string) error {
+	sharedKey := "jwks:" + cacheKey(k.url)
+	if document, ok := k.cache.shared(ctx, sharedKey); ok {
+		if keys, err := parseJWKS([]byte(document)); err == nil && keys[kid] != nil {
+			k.keys, k.fetched = keys, time.Now()
+			return nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), k.client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+	document, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(document)
+	if err != nil {
+		return err
+	}
+
+	k.keys, k.fetched = keys, time.Now()
+	k.cache.share(ctx, sharedKey, string(document), k.refresh)
+	return nil
+}
+
+// parseJWKS returns the signing keys of a JWKS document by key ID, skipping
+// keys of other uses or unsupported types
+func parseJWKS(document []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(document, &set); err != nil {
+		return nil, fmt.Errorf("invalid key set: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", jwk.Kid, err)
+		}
+		if key != nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+// publicKey decodes an RSA or EC key, or returns nil for other key types
+// and curves
+func (j *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := decodeJWKInt(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeJWKInt(j.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch j.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, nil
+		}
+		x, err := decodeJWKInt(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeJWKInt(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// decodeJWKInt decodes a base64url encoded big-endian integer
+func decodeJWKInt(value string) (*big.Int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(decoded) == 0 {
+		return nil, errors.New("invalid integer encoding")
+	}
+	return new(big.Int).SetBytes(decoded), nil
+}
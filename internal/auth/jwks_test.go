@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/redis/redistest"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newJWKSServer serves the public keys as a key set, counting the requests
+// it receives
+func newJWKSServer(t *testing.T, calls *int32, keys map[string]any) *httptest.Server {
+	encode := func(n *big.Int) string { return base64.RawURLEncoding.EncodeToString(n.Bytes()) }
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	for kid, key := range keys {
+		switch key := key.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, jsonWebKey{Kty: "RSA", Kid: kid, Use: "sig", N: encode(key.N), E: encode(big.NewInt(int64(key.E)))})
+		case *ecdsa.PublicKey:
+			set.Keys = append(set.Keys, jsonWebKey{Kty: "EC", Kid: kid, Crv: "P-256", X: encode(key.X), Y: encode(key.Y)})
+		}
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// signTestJWT signs a token for role with the key named kid
+func signTestJWT(t *testing.T, method jwt.SigningMethod, kid string, key any, role string) string {
+	token := jwt.NewWithClaims(method, &JWTClaims{
+		Role: role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			Subject:   "test-user",
+		},
+	})
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestJWKSVerification(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var calls int32
+	ts := newJWKSServer(t, &calls, map[string]any{"rsa-1": &rsaKey.PublicKey, "ec-1": &ecKey.PublicKey})
+	svc := NewAuthService(&config.AuthConfig{JWKSURL: ts.URL, JWKSRefreshInterval: 300}, &mockLogger{})
+	ctx := context.Background()
+
+	valid, role, err := svc.validateJWT(ctx, signTestJWT(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, "admin"))
+	require.NoError(t, err)
+	assert.True(t, valid)
+	assert.Equal(t, "admin", role)
+
+	_, role, err = svc.validateJWT(ctx, signTestJWT(t, jwt.SigningMethodES256, "ec-1", ecKey, "user"))
+	require.NoError(t, err)
+	assert.Equal(t, "user", role)
+
+	// The key set is fetched once for the refresh interval
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	for name, token := range map[string]string{
+		"wrong key":          signTestJWT(t, jwt.SigningMethodRS256, "rsa-1", otherKey, "admin"),
+		"key of another alg": signTestJWT(t, jwt.SigningMethodES256, "rsa-1", ecKey, "admin"),
+		"unsigned hmac":      signTestJWT(t, jwt.SigningMethodHS256, "rsa-1", []byte(""), "admin"),
+	} {
+		_, _, err := svc.validateJWT(ctx, token)
+		assert.ErrorIs(t, err, ErrInvalidToken, name)
+	}
+
+	// Unknown keys refetch the key set, but not on every token
+	svc.jwks.attempted = time.Now().Add(-minJWKSRefetch)
+	for i := 0; i < 3; i++ {
+		_, _, err = svc.validateJWT(ctx, signTestJWT(t, jwt.SigningMethodRS256, "rsa-2", otherKey, "admin"))
+		assert.ErrorIs(t, err, errUnknownKey)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestJWKSSharedThroughRedis(t *testing.T) {
+	server, err := redistest.NewServer()
+	require.NoError(t, err)
+	defer server.Close()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	var calls int32
+	ts := newJWKSServer(t, &calls, map[string]any{"rsa-1": &rsaKey.PublicKey})
+
+	cfg := &config.AuthConfig{
+		JWKSURL:             ts.URL,
+		JWKSRefreshInterval: 300,
+		ValidationCache: config.ValidationCacheConfig{
+			Enabled: true, MaxEntries: 10, TTL: 60,
+			Redis: config.RedisConfig{Enabled: true, Address: server.Addr, KeyPrefix: "test:", Timeout: 1000},
+		},
+	}
+	first := NewAuthService(cfg, &mockLogger{})
+	defer first.Close()
+	second := NewAuthService(cfg, &mockLogger{})
+	defer second.Close()
+
+	ctx := context.Background()
+	_, _, err = first.validateJWT(ctx, signTestJWT(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, "admin"))
+	require.NoError(t, err)
+	_, _, err = second.validateJWT(ctx, signTestJWT(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, "user"))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestJWTValidationCache(t *testing.T) {
+	cfg := &config.AuthConfig{
+		JWTSecret:       "test-secret",
+		ValidationCache: config.ValidationCacheConfig{Enabled: true, MaxEntries: 10, TTL: 60, NegativeTTL: 60},
+	}
+	svc := NewAuthService(cfg, &mockLogger{})
+	ctx := context.Background()
+
+	valid := createTestJWT(t, "test-secret", "admin", time.Now().Add(30*time.Second))
+	forged := createTestJWT(t, "wrong-secret", "admin", time.Now().Add(time.Hour))
+	expired := createTestJWT(t, "test-secret", "admin", time.Now().Add(-time.Hour))
+
+	ok, role, err := svc.checkJWT(ctx, valid)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "admin", role)
+	_, _, err = svc.checkJWT(ctx, forged)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, _, err = svc.checkJWT(ctx, expired)
+	assert.ErrorIs(t, err, ErrExpiredToken)
+
+	// Results are answered from the cache, valid ones no longer than the token lives
+	result, ok := svc.validationCache.lookup(ctx, jwtCacheKey(valid))
+	require.True(t, ok)
+	assert.LessOrEqual(t, result.Expires, time.Now().Add(30*time.Second).UnixMilli())
+	_, ok = svc.validationCache.lookup(ctx, jwtCacheKey(expired))
+	assert.False(t, ok)
+
+	cfg.JWTSecret = "rotated-secret"
+	ok, role, err = svc.checkJWT(ctx, valid)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "admin", role)
+	_, _, err = svc.checkJWT(ctx, forged)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// API keys' results are kept apart
+	_, ok = svc.validationCache.get(ctx, valid)
+	assert.False(t, ok)
+}
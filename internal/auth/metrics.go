@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// ValidationCacheLookups tracks API key and JWT validation cache lookups
+	// by tier and result, giving the hit rate of each tier
+	validationCacheLookups = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_auth_validation_cache_lookups_total",
+			Help: "Total number of API key and JWT validation cache lookups by tier and result",
+		},
+		[]string{"tier", "result"},
+	)
+
+	// ValidationCacheEntries tracks the results held in memory
+	validationCacheEntries = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "gateway_auth_validation_cache_entries",
+			Help: "Number of API key and JWT validation results cached in memory",
+		},
+	)
+)
+
+func init() {
+	// Register metrics with Prometheus
+	prometheus.MustRegister(validationCacheLookups)
+	prometheus.MustRegister(validationCacheEntries)
+}
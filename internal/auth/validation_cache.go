@@ -0,0 +1,270 @@
+package auth
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+	"api-gateway/pkg/redis"
+)
+
+// validationResult is a cached API key validation or JWT verification
+// outcome. JWT results only carry the role, the rest of the identity comes
+// from the token's claims.
+type validationResult struct {
+	Valid   bool     `json:"valid"`
+	Subject string   `json:"subject,omitempty"`
+	Tenant  string   `json:"tenant,omitempty"`
+	Role    string   `json:"role,omitempty"`
+	Scopes  []string `json:"scopes,omitempty"`
+	Expires int64    `json:"expires"` // Unix milliseconds
+}
+
+// identity returns the identity of a valid result
+func (r validationResult) identity() *Identity {
+	return &Identity{Type: IdentityAPIKey, Subject: r.Subject, Tenant: r.Tenant, Role: r.Role, Scopes: r.Scopes}
+}
+
+// validationCache caches API key validation and JWT verification results in
+// an in-memory LRU, backed by Redis when configured. Credentials are stored
+// as SHA-256 digests so the cache never holds the keys or tokens themselves.
+type validationCache struct {
+	maxEntries  int
+	ttl         time.Duration
+	negativeTTL time.Duration
+	redis       *redis.Client
+	keyPrefix   string
+	address     string
+	log         logger.Logger
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // Most recently used first
+
+	// Outcome of the last Redis command, guarded by mutex
+	redisError   string
+	failingSince time.Time
+}
+
+// RedisStatus is the state of the validation cache's Redis tier as reported
+// by the health endpoint
+type RedisStatus struct {
+	Address      string     `json:"address"`
+	Error        string     `json:"error,omitempty"` // Error of the last command
+	FailingSince *time.Time `json:"failing_since,omitempty"`
+}
+
+// validationEntry is an element of the LRU list
+type validationEntry struct {
+	key    string
+	result validationResult
+}
+
+// newValidationCache creates a validation cache
+func newValidationCache(cfg *config.ValidationCacheConfig, log logger.Logger) *validationCache {
+	c := &validationCache{
+		maxEntries:  cfg.MaxEntries,
+		ttl:         time.Duration(cfg.TTL) * time.Second,
+		negativeTTL: time.Duration(cfg.NegativeTTL) * time.Second,
+		keyPrefix:   cfg.Redis.KeyPrefix,
+		address:     cfg.Redis.Address,
+		log:         log,
+		entries:     make(map[string]*list.Element),
+		order:       list.New(),
+	}
+	if cfg.Redis.Enabled {
+		c.redis = redis.New(redis.Options{
+			Address:  cfg.Redis.Address,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+			Timeout:  time.Duration(cfg.Redis.Timeout) * time.Millisecond,
+		})
+	}
+	return c
+}
+
+// get returns the cached result for an API key
+func (c *validationCache) get(ctx context.Context, token string) (validationResult, bool) {
+	return c.lookup(ctx, cacheKey(token))
+}
+
+// lookup returns the result cached under key, looking in memory and then in
+// Redis. Redis errors are logged and treated as misses.
+func (c *validationCache) lookup(ctx context.Context, key string) (validationResult, bool) {
+	now := time.Now().UnixMilli()
+
+	c.mutex.Lock()
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*validationEntry)
+		if entry.result.Expires > now {
+			c.order.MoveToFront(elem)
+			c.mutex.Unlock()
+			validationCacheLookups.WithLabelValues("memory", "hit").Inc()
+			return entry.result, true
+		}
+		c.remove(elem)
+	}
+	c.mutex.Unlock()
+	validationCacheLookups.WithLabelValues("memory", "miss").Inc()
+
+	if c.redis == nil {
+		return validationResult{}, false
+	}
+	value, ok := c.shared(ctx, key)
+	var result validationResult
+	if ok {
+		if err := json.Unmarshal([]byte(value), &result); err != nil {
+			c.log.Warn("Ignoring malformed validation cache entry", logger.Error(err))
+			ok = false
+		}
+	}
+	if !ok || result.Expires <= now {
+		validationCacheLookups.WithLabelValues("redis", "miss").Inc()
+		return validationResult{}, false
+	}
+	validationCacheLookups.WithLabelValues("redis", "hit").Inc()
+
+	// Keep the expiry Redis had so the entry doesn't outlive it
+	c.mutex.Lock()
+	c.store(key, result)
+	c.mutex.Unlock()
+	return result, true
+}
+
+// set caches the identity of a valid key, or a nil identity for an invalid
+// key. Invalid keys are only cached with a negative TTL.
+func (c *validationCache) set(ctx context.Context, token string, identity *Identity) {
+	ttl := c.ttl
+	if identity == nil {
+		ttl = c.negativeTTL
+	}
+	var result validationResult
+	if identity != nil {
+		result.Valid = true
+		result.Subject, result.Tenant, result.Role, result.Scopes = identity.Subject, identity.Tenant, identity.Role, identity.Scopes
+	}
+	c.put(ctx, cacheKey(token), result, ttl)
+}
+
+// put caches a result under key for ttl, in memory and in Redis
+func (c *validationCache) put(ctx context.Context, key string, result validationResult, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	result.Expires = time.Now().Add(ttl).UnixMilli()
+	c.mutex.Lock()
+	c.store(key, result)
+	c.mutex.Unlock()
+
+	if c.redis == nil {
+		return
+	}
+	value, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	c.share(ctx, key, string(value), ttl)
+}
+
+// shared returns a value stored in Redis by any gateway instance. It reports
+// false without Redis.
+func (c *validationCache) shared(ctx context.Context, key string) (string, bool) {
+	if c == nil || c.redis == nil {
+		return "", false
+	}
+	value, ok, err := c.redis.Get(ctx, c.keyPrefix+key)
+	c.recordRedis(err)
+	if err != nil {
+		c.log.Warn("Failed to read validation cache from Redis", logger.Error(err))
+	}
+	return value, ok
+}
+
+// share stores a value in Redis for the other gateway instances
+func (c *validationCache) share(ctx context.Context, key, value string, ttl time.Duration) {
+	if c == nil || c.redis == nil {
+		return
+	}
+	err := c.redis.Set(ctx, c.keyPrefix+key, value, ttl)
+	c.recordRedis(err)
+	if err != nil {
+		c.log.Warn("Failed to write validation cache to Redis", logger.Error(err))
+	}
+}
+
+// recordRedis records the outcome of a Redis command
+func (c *validationCache) recordRedis(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err == nil {
+		c.redisError = ""
+		c.failingSince = time.Time{}
+		return
+	}
+	if c.redisError == "" {
+		c.failingSince = time.Now()
+	}
+	c.redisError = err.Error()
+}
+
+// redisStatus returns the state of the Redis tier
+func (c *validationCache) redisStatus() RedisStatus {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	status := RedisStatus{Address: c.address, Error: c.redisError}
+	if !c.failingSince.IsZero() {
+		since := c.failingSince
+		status.FailingSince = &since
+	}
+	return status
+}
+
+// close closes the Redis connections
+func (c *validationCache) close() {
+	if c.redis != nil {
+		c.redis.Close()
+	}
+}
+
+// store adds or replaces an entry, evicting the least recently used entry
+// when full. The caller must hold the mutex.
+func (c *validationCache) store(key string, result validationResult) {
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*validationEntry).result = result
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&validationEntry{key: key, result: result})
+	if c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+	}
+	validationCacheEntries.Set(float64(c.order.Len()))
+}
+
+// remove deletes an entry. The caller must hold the mutex.
+func (c *validationCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*validationEntry).key)
+	validationCacheEntries.Set(float64(c.order.Len()))
+}
+
+// cacheKey returns the key an API key's result is cached under
+func cacheKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// jwtCacheKey returns the key a JWT's result is cached under, apart from
+// API keys' results
+func jwtCacheKey(token string) string {
+	return "jwt:" + cacheKey(token)
+}
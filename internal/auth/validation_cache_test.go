@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/redis/redistest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newValidationServer returns a validation endpoint accepting "valid-key"
+// and counting the requests it receives
+func newValidationServer(calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		if r.Header.Get("x-api-key") != "valid-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(APIKeyResponse{Valid: true, UserID: "user-1", Role: "admin", Permissions: []string{"orders:read"}})
+	}))
+}
+
+func TestValidationCache(t *testing.T) {
+	var calls int32
+	ts := newValidationServer(&calls)
+	defer ts.Close()
+
+	cfg := &config.AuthConfig{
+		APIKeyValidationURL: ts.URL,
+		ValidationCache:     config.ValidationCacheConfig{Enabled: true, MaxEntries: 10, TTL: 60, NegativeTTL: 60},
+	}
+	svc := NewAuthService(cfg, &mockLogger{})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		identity, err := svc.checkAPIToken(ctx, "valid-key")
+		require.NoError(t, err)
+		assert.Equal(t, &Identity{Type: IdentityAPIKey, Subject: "user-1", Role: "admin", Scopes: []string{"orders:read"}}, identity)
+
+		_, err = svc.checkAPIToken(ctx, "bad-key")
+		assert.ErrorIs(t, err, errInvalidAPIKey)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestValidationCacheSkipsServiceErrors(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	cfg := &config.AuthConfig{
+		APIKeyValidationURL: ts.URL,
+		ValidationCache:     config.ValidationCacheConfig{Enabled: true, MaxEntries: 10, TTL: 60, NegativeTTL: 60},
+	}
+	svc := NewAuthService(cfg, &mockLogger{})
+	for i := 0; i < 2; i++ {
+		_, err := svc.checkAPIToken(context.Background(), "valid-key")
+		assert.ErrorContains(t, err, "status: 502")
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestValidationCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newValidationCache(&config.ValidationCacheConfig{MaxEntries: 2, TTL: 60}, &mockLogger{})
+	ctx := context.Background()
+	cache.set(ctx, "a", &Identity{})
+	cache.set(ctx, "b", &Identity{})
+	cache.get(ctx, "a")
+	cache.set(ctx, "c", &Identity{})
+
+	_, ok := cache.get(ctx, "a")
+	assert.True(t, ok)
+	_, ok = cache.get(ctx, "b")
+	assert.False(t, ok)
+
+	// Invalid keys aren't cached without a negative TTL
+	cache.set(ctx, "d", nil)
+	_, ok = cache.get(ctx, "d")
+	assert.False(t, ok)
+}
+
+func TestValidationCacheSharedThroughRedis(t *testing.T) {
+	server, err := redistest.NewServer()
+	require.NoError(t, err)
+	defer server.Close()
+
+	var calls int32
+	ts := newValidationServer(&calls)
+	defer ts.Close()
+
+	cfg := &config.AuthConfig{
+		APIKeyValidationURL: ts.URL,
+		ValidationCache: config.ValidationCacheConfig{
+			Enabled: true, MaxEntries: 10, TTL: 60,
+			Redis: config.RedisConfig{Enabled: true, Address: server.Addr, KeyPrefix: "test:", Timeout: 1000},
+		},
+	}
+	first := NewAuthService(cfg, &mockLogger{})
+	defer first.Close()
+	second := NewAuthService(cfg, &mockLogger{})
+	defer second.Close()
+
+	_, err = first.checkAPIToken(context.Background(), "valid-key")
+	require.NoError(t, err)
+	identity, err := second.checkAPIToken(context.Background(), "valid-key")
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", identity.Subject)
+	assert.Equal(t, []string{"orders:read"}, identity.Scopes)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// Only the digest of the key is stored
+	_, ok := server.Get("test:" + cacheKey("valid-key"))
+	assert.True(t, ok)
+	_, ok = server.Get("test:valid-key")
+	assert.False(t, ok)
+}
+
+func TestValidationCacheRedisStatus(t *testing.T) {
+	server, err := redistest.NewServer()
+	require.NoError(t, err)
+	defer server.Close()
+
+	var calls int32
+	ts := newValidationServer(&calls)
+	defer ts.Close()
+
+	newService := func(redis config.RedisConfig) *AuthService {
+		return NewAuthService(&config.AuthConfig{
+			APIKeyValidationURL: ts.URL,
+			ValidationCache:     config.ValidationCacheConfig{Enabled: true, MaxEntries: 10, TTL: 60, Redis: redis},
+		}, &mockLogger{})
+	}
+
+	assert.Nil(t, newService(config.RedisConfig{}).RedisStatus())
+
+	healthy := newService(config.RedisConfig{Enabled: true, Address: server.Addr, Timeout: 1000})
+	defer healthy.Close()
+	_, err = healthy.checkAPIToken(context.Background(), "valid-key")
+	require.NoError(t, err)
+	assert.Equal(t, &RedisStatus{Address: server.Addr}, healthy.RedisStatus())
+
+	// Validation goes on when Redis fails, with the failure reported
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+	failing := newService(config.RedisConfig{Enabled: true, Address: address, Timeout: 100})
+	defer failing.Close()
+	_, err = failing.checkAPIToken(context.Background(), "valid-key")
+	require.NoError(t, err)
+	status := failing.RedisStatus()
+	assert.Equal(t, address, status.Address)
+	assert.NotEmpty(t, status.Error)
+	require.NotNil(t, status.FailingSince)
+
+	since := *status.FailingSince
+	_, err = failing.checkAPIToken(context.Background(), "other-key")
+	assert.Error(t, err)
+	assert.Equal(t, since, *failing.RedisStatus().FailingSince)
+}
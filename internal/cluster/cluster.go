@@ -0,0 +1,643 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// Member states
+const (
+	StateAlive   = "alive"
+	StateSuspect = "suspect"
+	StateLeft    = "left"
+)
+
+// Event types shared by gateway features
+const (
+	EventCachePurge   = "cache_purge"
+	EventBreakerState = "breaker_state"
+)
+
+const (
+	gossipPath      = "/cluster/gossip"
+	eventPath       = "/cluster/event"
+	signatureHeader = "X-Cluster-Signature"
+	timestampHeader = "X-Cluster-Timestamp"
+	maxMessageSize  = 1 << 20
+	seenEventTTL    = 5 * time.Minute
+
+	// maxMessageAge bounds how far a message's timestamp may be from our
+	// clock. Events stay in the seen set for as long as they can be replayed.
+	maxMessageAge = seenEventTTL / 2
+)
+
+// Member describes a gateway instance known to the cluster
+type Member struct {
+	Name        string `json:"name"`
+	Address     string `json:"address"`
+	Incarnation int64  `json:"incarnation"`
+	Heartbeat   uint64 `json:"heartbeat"`
+	State       string `json:"state"`
+
+	updated time.Time
+}
+
+// Event is a message broadcast to every gateway in the cluster
+type Event struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Origin  string          `json:"origin"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// gossipMessage carries a member list between gateways
+type gossipMessage struct {
+	Members []Member `json:"members"`
+}
+
+// Cluster lets gateway instances discover each other through HTTP gossip and
+// broadcast events such as cache purges to every member
+type Cluster struct {
+	config   *config.ClusterConfig
+	self     *Member
+	members  map[string]*Member
+	handlers map[string][]func(Event)
+	seen     map[string]time.Time
+	mutex    sync.RWMutex
+	client   *http.Client
+	server   *http.Server
+	listener net.Listener
+	stop     chan struct{}
+	done     chan struct{}
+	log      logger.Logger
+}
+
+// New creates a cluster node from configuration
+func New(cfg *config.ClusterConfig, log logger.Logger) (*Cluster, error) {
+	if cfg.SecretKey == "" {
+		return nil, fmt.Errorf("a secret key is required to sign cluster messages")
+	}
+
+	name := cfg.NodeName
+	if name == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine node name: %w", err)
+		}
+		name = hostname
+	}
+
+	c := &Cluster{
+		config: cfg,
+		self: &Member{
+			Name:        name,
+			Incarnation: time.Now().UnixNano(),
+			State:       StateAlive,
+		},
+		members:  make(map[string]*Member),
+		handlers: make(map[string][]func(Event)),
+		seen:     make(map[string]time.Time),
+		client:   &http.Client{Timeout: 2 * time.Second},
+		log:      log,
+	}
+	c.members[name] = c.self
+
+	return c, nil
+}
+
+// Name returns the name of the local node
+func (c *Cluster) Name() string {
+	return c.self.Name
+}
+
+// Start listens for gossip and joins the configured seeds
+func (c *Cluster) Start() error {
+	listener, err := net.Listen("tcp", c.config.BindAddress)
+	if err != nil {
+		return fmt.Errorf("failed to listen for cluster traffic: %w", err)
+	}
+
+	address, err := advertiseAddress(c.config.AdvertiseAddress, listener.Addr())
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	c.mutex.Lock()
+	c.self.Address = address
+	c.mutex.Unlock()
+
+	c.listener = listener
+	c.server = &http.Server{
+		Handler:      c.Handler(),
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 5 * time.Second,
+	}
+	go func() {
+		if err := c.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			c.log.Error("Cluster listener stopped", logger.Error(err))
+		}
+	}()
+
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+	go c.run()
+
+	c.log.Info("Cluster node started",
+		logger.String("node", c.self.Name),
+		logger.String("address", address),
+		logger.Int("seeds", len(c.config.Seeds)),
+	)
+
+	return nil
+}
+
+// Stop announces that this node is leaving and stops gossiping
+func (c *Cluster) Stop(ctx context.Context) error {
+	if c.stop == nil {
+		return nil
+	}
+	close(c.stop)
+	<-c.done
+	c.stop = nil
+
+	// Tell peers we are leaving so they don't wait for the dead timeout
+	c.mutex.Lock()
+	c.self.State = StateLeft
+	c.self.Heartbeat++
+	c.mutex.Unlock()
+	for _, peer := range c.peers() {
+		c.gossipTo(peer)
+	}
+
+	return c.server.Shutdown(ctx)
+}
+
+// Members returns a snapshot of all known members
+func (c *Cluster) Members() []Member {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	members := make([]Member, 0, len(c.members))
+	for _, m := range c.members {
+		members = append(members, *m)
+	}
+	return members
+}
+
+// Subscribe registers a handler for events of the given type sent by other members
+func (c *Cluster) Subscribe(eventType string, handler func(Event)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.handlers[eventType] = append(c.handlers[eventType], handler)
+}
+
+// Broadcast sends an event to every other live member. Delivery is best effort.
+func (c *Cluster) Broadcast(eventType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode event payload: %w", err)
+	}
+
+	event := Event{
+		ID:      newEventID(),
+		Type:    eventType,
+		Origin:  c.self.Name,
+		Payload: data,
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	c.markSeen(event.ID)
+	clusterEvents.WithLabelValues(eventType, "sent").Inc()
+
+	var wg sync.WaitGroup
+	for _, peer := range c.peers() {
+		wg.Add(1)
+		go func(peer Member) {
+			defer wg.Done()
+			if _, err := c.post(peer.Address, eventPath, body); err != nil {
+				c.log.Warn("Failed to deliver cluster event",
+					logger.String("type", eventType),
+					logger.String("peer", peer.Name),
+					logger.String("reason", err.Error()),
+				)
+			}
+		}(peer)
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// Handler serves the gossip and event endpoints
+func (c *Cluster) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(gossipPath, c.handleGossip)
+	mux.HandleFunc(eventPath, c.handleEvent)
+	return mux
+}
+
+// handleGossip merges a peer's member list and replies with ours
+func (c *Cluster) handleGossip(w http.ResponseWriter, r *http.Request) {
+	body, ok := c.readSigned(w, r)
+	if !ok {
+		return
+	}
+
+	var msg gossipMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		http.Error(w, "Invalid gossip message", http.StatusBadRequest)
+		return
+	}
+	c.merge(msg.Members)
+
+	reply, _ := json.Marshal(gossipMessage{Members: c.Members()})
+	c.sign(w.Header(), reply)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(reply)
+}
+
+// handleEvent dispatches a broadcast event to local subscribers
+func (c *Cluster) handleEvent(w http.ResponseWriter, r *http.Request) {
+	body, ok := c.readSigned(w, r)
+	if !ok {
+		return
+	}
+
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, "Invalid event", http.StatusBadRequest)
+		return
+	}
+
+	// Ignore duplicates and our own events
+	c.sign(w.Header(), nil)
+	if event.Origin == c.self.Name || !c.markSeen(event.ID) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	c.mutex.RLock()
+	handlers := c.handlers[event.Type]
+	c.mutex.RUnlock()
+
+	clusterEvents.WithLabelValues(event.Type, "received").Inc()
+	for _, handler := range handlers {
+		handler(event)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readSigned reads a request body and verifies its signature
+func (c *Cluster) readSigned(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxMessageSize))
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return nil, false
+	}
+
+	if !c.verify(r.Header, body, time.Now()) {
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return body, true
+}
+
+// run gossips with random peers and expires silent members until stopped
+func (c *Cluster) run() {
+	defer close(c.done)
+
+	interval := time.Duration(c.config.GossipInterval) * time.Second
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	c.gossipRound()
+	for {
+		select {
+		case <-ticker.C:
+			c.gossipRound()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// gossipRound bumps our heartbeat and exchanges member lists with a few peers
+func (c *Cluster) gossipRound() {
+	c.mutex.Lock()
+	c.self.Heartbeat++
+	c.mutex.Unlock()
+
+	c.reap(time.Now())
+
+	targets := c.pickPeers(c.config.Fanout)
+	if len(targets) == 0 {
+		// Nobody known yet, (re)join through the seeds
+		for _, address := range c.seedAddresses() {
+			targets = append(targets, Member{Address: address})
+		}
+	}
+
+	for _, peer := range targets {
+		c.gossipTo(peer)
+	}
+}
+
+// gossipTo pushes our member list to a peer and merges its reply
+func (c *Cluster) gossipTo(peer Member) {
+	body, _ := json.Marshal(gossipMessage{Members: c.Members()})
+	reply, err := c.post(peer.Address, gossipPath, body)
+	if err != nil {
+		c.log.Debug("Gossip failed",
+			logger.String("peer", peer.Address),
+			logger.String("reason", err.Error()),
+		)
+		return
+	}
+
+	var msg gossipMessage
+	if err := json.Unmarshal(reply, &msg); err == nil {
+		c.merge(msg.Members)
+	}
+}
+
+// merge applies newer member information received from a peer
+func (c *Cluster) merge(members []Member) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	for _, incoming := range members {
+		if incoming.Name == "" || incoming.Name == c.self.Name {
+			continue
+		}
+
+		current, known := c.members[incoming.Name]
+		if known && !isNewer(incoming, *current) {
+			continue
+		}
+		if !known && incoming.State == StateLeft {
+			continue
+		}
+
+		m := incoming
+		if m.State != StateLeft {
+			m.State = StateAlive
+		}
+		m.updated = now
+		c.members[m.Name] = &m
+
+		if !known {
+			c.log.Info("Cluster member joined",
+				logger.String("node", m.Name),
+				logger.String("address", m.Address),
+			)
+		} else if m.State == StateLeft && current.State != StateLeft {
+			c.log.Info("Cluster member left",
+				logger.String("node", m.Name),
+			)
+		}
+	}
+	c.updateMetricsLocked()
+}
+
+// reap marks silent members as suspect and forgets dead or departed ones
+func (c *Cluster) reap(now time.Time) {
+	suspectAfter := time.Duration(c.config.SuspectTimeout) * time.Second
+	deadAfter := time.Duration(c.config.DeadTimeout) * time.Second
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for name, m := range c.members {
+		if m == c.self {
+			continue
+		}
+		silence := now.Sub(m.updated)
+		switch {
+		case silence > deadAfter:
+			delete(c.members, name)
+			if m.State != StateLeft {
+				c.log.Warn("Cluster member removed after missing heartbeats",
+					logger.String("node", name),
+				)
+			}
+		case silence > suspectAfter && m.State == StateAlive:
+			m.State = StateSuspect
+			c.log.Warn("Cluster member suspected",
+				logger.String("node", name),
+			)
+		}
+	}
+	c.updateMetricsLocked()
+}
+
+// peers returns all other members that may receive messages
+func (c *Cluster) peers() []Member {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var peers []Member
+	for _, m := range c.members {
+		if m != c.self && m.State != StateLeft {
+			peers = append(peers, *m)
+		}
+	}
+	return peers
+}
+
+// pickPeers returns up to n random peers
+func (c *Cluster) pickPeers(n int) []Member {
+	peers := c.peers()
+	if n <= 0 || n >= len(peers) {
+		return peers
+	}
+	for i := len(peers) - 1; i > 0; i-- {
+		j, _ := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		peers[i], peers[j.Int64()] = peers[j.Int64()], peers[i]
+	}
+	return peers[:n]
+}
+
+// seedAddresses resolves the configured seeds, expanding DNS names to every address
+func (c *Cluster) seedAddresses() []string {
+	var addresses []string
+	for _, seed := range c.config.Seeds {
+		host, port, err := net.SplitHostPort(seed)
+		if err != nil {
+			continue
+		}
+		ips, err := net.LookupHost(host)
+		if err != nil {
+			ips = []string{host}
+		}
+		for _, ip := range ips {
+			address := net.JoinHostPort(ip, port)
+			if address != c.self.Address {
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	return addresses
+}
+
+// post sends a signed message to a peer and returns the response body once
+// its signature is verified, so only members can answer gossip
+func (c *Cluster) post(address, path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, "http://"+address+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.sign(req.Header, body)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("peer responded with status %d", resp.StatusCode)
+	}
+	reply, err := io.ReadAll(io.LimitReader(resp.Body, maxMessageSize))
+	if err != nil {
+		return nil, err
+	}
+	if !c.verify(resp.Header, reply, time.Now()) {
+		return nil, fmt.Errorf("peer reply has an invalid signature")
+	}
+	return reply, nil
+}
+
+// sign adds a timestamp and an HMAC signature of it and body
+func (c *Cluster) sign(header http.Header, body []byte) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	header.Set(timestampHeader, timestamp)
+	header.Set(signatureHeader, c.signature(timestamp, body))
+}
+
+// verify checks the signature of body and that it was signed recently
+func (c *Cluster) verify(header http.Header, body []byte, now time.Time) bool {
+	timestamp := header.Get(timestampHeader)
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > maxMessageAge || age < -maxMessageAge {
+		return false
+	}
+	return hmac.Equal([]byte(header.Get(signatureHeader)), []byte(c.signature(timestamp, body)))
+}
+
+// signature computes the hex encoded HMAC-SHA256 of the timestamp and body
+func (c *Cluster) signature(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(c.config.SecretKey))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'\n'})
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// markSeen records an event ID, returning false if it was already seen
+func (c *Cluster) markSeen(id string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	for seenID, at := range c.seen {
+		if now.Sub(at) > seenEventTTL {
+			delete(c.seen, seenID)
+		}
+	}
+
+	if _, seen := c.seen[id]; seen {
+		return false
+	}
+	c.seen[id] = now
+	return true
+}
+
+// updateMetricsLocked publishes member counts by state
+func (c *Cluster) updateMetricsLocked() {
+	counts := map[string]int{StateAlive: 0, StateSuspect: 0, StateLeft: 0}
+	for _, m := range c.members {
+		counts[m.State]++
+	}
+	for state, count := range counts {
+		clusterMembers.WithLabelValues(state).Set(float64(count))
+	}
+}
+
+// isNewer reports whether a carries fresher information than b
+func isNewer(a, b Member) bool {
+	if a.Incarnation != b.Incarnation {
+		return a.Incarnation > b.Incarnation
+	}
+	return a.Heartbeat > b.Heartbeat
+}
+
+// advertiseAddress returns the address peers should use to reach this node
+func advertiseAddress(configured string, bound net.Addr) (string, error) {
+	if configured != "" {
+		return configured, nil
+	}
+
+	tcpAddr, ok := bound.(*net.TCPAddr)
+	if !ok {
+		return "", fmt.Errorf("unexpected listener address %s", bound)
+	}
+	if !tcpAddr.IP.IsUnspecified() {
+		return tcpAddr.String(), nil
+	}
+
+	// Bound to all interfaces, advertise the first non-loopback address
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine advertise address: %w", err)
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+			return net.JoinHostPort(ipNet.IP.String(), fmt.Sprint(tcpAddr.Port)), nil
+		}
+	}
+	return "", fmt.Errorf("no advertise address found, set cluster.advertise_address")
+}
+
+// newEventID returns a random event identifier
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,195 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockLogger implements the logger.Logger interface for testing
+type mockLogger struct{}
+
+func (m *mockLogger) Debug(msg string, fields ...logger.Field)  {}
+func (m *mockLogger) Info(msg string, fields ...logger.Field)   {}
+func (m *mockLogger) Warn(msg string, fields ...logger.Field)   {}
+func (m *mockLogger) Error(msg string, fields ...logger.Field)  {}
+func (m *mockLogger) Fatal(msg string, fields ...logger.Field)  {}
+func (m *mockLogger) With(fields ...logger.Field) logger.Logger { return m }
+
+func newTestNode(t *testing.T, name string, seeds ...string) *Cluster {
+	c, err := New(&config.ClusterConfig{
+		NodeName:       name,
+		BindAddress:    "127.0.0.1:0",
+		Seeds:          seeds,
+		GossipInterval: 1,
+		SuspectTimeout: 5,
+		DeadTimeout:    30,
+		Fanout:         3,
+		SecretKey:      "shared-secret",
+	}, &mockLogger{})
+	require.NoError(t, err)
+	require.NoError(t, c.Start())
+	t.Cleanup(func() { c.Stop(context.Background()) })
+	return c
+}
+
+func memberNames(c *Cluster) []string {
+	var names []string
+	for _, m := range c.Members() {
+		if m.State == StateAlive {
+			names = append(names, m.Name)
+		}
+	}
+	return names
+}
+
+func TestClusterMembershipAndEvents(t *testing.T) {
+	a := newTestNode(t, "node-a")
+	b := newTestNode(t, "node-b", a.self.Address)
+	c := newTestNode(t, "node-c", a.self.Address)
+
+	// Every node learns about every other node through gossip
+	for _, node := range []*Cluster{a, b, c} {
+		node := node
+		assert.Eventually(t, func() bool {
+			return len(memberNames(node)) == 3
+		}, 5*time.Second, 50*time.Millisecond, "node %s did not converge", node.Name())
+	}
+
+	var mutex sync.Mutex
+	received := map[string]string{}
+	for _, node := range []*Cluster{b, c} {
+		node := node
+		node.Subscribe(EventCachePurge, func(e Event) {
+			var payload map[string]string
+			json.Unmarshal(e.Payload, &payload)
+			mutex.Lock()
+			received[node.Name()] = payload["path"]
+			mutex.Unlock()
+		})
+	}
+
+	require.NoError(t, a.Broadcast(EventCachePurge, map[string]string{"path": "/api/users"}))
+	mutex.Lock()
+	assert.Equal(t, map[string]string{"node-b": "/api/users", "node-c": "/api/users"}, received)
+	mutex.Unlock()
+
+	// A leaving node is announced instead of timing out
+	require.NoError(t, c.Stop(context.Background()))
+	assert.Eventually(t, func() bool {
+		for _, m := range a.Members() {
+			if m.Name == "node-c" {
+				return m.State == StateLeft
+			}
+		}
+		return true
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestClusterRejectsUnsignedMessages(t *testing.T) {
+	c, err := New(&config.ClusterConfig{NodeName: "node-a", SecretKey: "shared-secret"}, &mockLogger{})
+	require.NoError(t, err)
+
+	server := httptest.NewServer(c.Handler())
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+eventPath, "application/json", strings.NewReader(`{"id":"1","type":"cache_purge","origin":"evil"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestClusterEventDeduplication(t *testing.T) {
+	c, err := New(&config.ClusterConfig{NodeName: "node-a", SecretKey: "shared-secret"}, &mockLogger{})
+	require.NoError(t, err)
+
+	calls := 0
+	c.Subscribe(EventBreakerState, func(e Event) { calls++ })
+
+	body := `{"id":"abc","type":"breaker_state","origin":"node-b","payload":{}}`
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, eventPath, strings.NewReader(body))
+		c.sign(req.Header, []byte(body))
+		c.handleEvent(rec, req)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	}
+	assert.Equal(t, 1, calls)
+}
+
+func TestClusterRejectsForgedReplies(t *testing.T) {
+	c, err := New(&config.ClusterConfig{NodeName: "node-a", SecretKey: "shared-secret"}, &mockLogger{})
+	require.NoError(t, err)
+	forger, err := New(&config.ClusterConfig{NodeName: "node-x", SecretKey: "other-secret"}, &mockLogger{})
+	require.NoError(t, err)
+
+	reply := []byte(`{"members":[{"name":"evil","address":"203.0.113.1:7946","incarnation":1,"state":"alive"}]}`)
+	for name, sign := range map[string]func(http.Header){
+		"unsigned":     func(http.Header) {},
+		"wrong secret": func(header http.Header) { forger.sign(header, reply) },
+	} {
+		peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sign(w.Header())
+			w.Write(reply)
+		}))
+		c.gossipTo(Member{Address: strings.TrimPrefix(peer.URL, "http://")})
+		peer.Close()
+
+		assert.NotContains(t, c.members, "evil", name)
+	}
+}
+
+func TestClusterRejectsReplayedEvents(t *testing.T) {
+	c, err := New(&config.ClusterConfig{NodeName: "node-a", SecretKey: "shared-secret"}, &mockLogger{})
+	require.NoError(t, err)
+
+	calls := 0
+	c.Subscribe(EventCachePurge, func(e Event) { calls++ })
+
+	// An event captured when it was sent, replayed after its ID left the seen set
+	body := []byte(`{"id":"abc","type":"cache_purge","origin":"node-b","payload":{}}`)
+	timestamp := strconv.FormatInt(time.Now().Add(-seenEventTTL).Unix(), 10)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, eventPath, bytes.NewReader(body))
+	req.Header.Set(timestampHeader, timestamp)
+	req.Header.Set(signatureHeader, c.signature(timestamp, body))
+	c.handleEvent(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, 0, calls)
+}
+
+func TestClusterMergeAndReap(t *testing.T) {
+	c, err := New(&config.ClusterConfig{NodeName: "node-a", SuspectTimeout: 5, DeadTimeout: 30, SecretKey: "shared-secret"}, &mockLogger{})
+	require.NoError(t, err)
+
+	c.merge([]Member{{Name: "node-b", Address: "10.0.0.2:7946", Incarnation: 1, Heartbeat: 5}})
+	// Older information is ignored
+	c.merge([]Member{{Name: "node-b", Address: "10.0.0.9:7946", Incarnation: 1, Heartbeat: 3}})
+	assert.Equal(t, "10.0.0.2:7946", c.members["node-b"].Address)
+
+	// A restarted node with a new incarnation replaces the old entry
+	c.merge([]Member{{Name: "node-b", Address: "10.0.0.3:7946", Incarnation: 2, Heartbeat: 1}})
+	assert.Equal(t, "10.0.0.3:7946", c.members["node-b"].Address)
+
+	now := time.Now()
+	c.reap(now.Add(10 * time.Second))
+	assert.Equal(t, StateSuspect, c.members["node-b"].State)
+
+	c.reap(now.Add(time.Minute))
+	assert.NotContains(t, c.members, "node-b")
+	assert.Contains(t, c.members, "node-a", "the local node is never reaped")
+}
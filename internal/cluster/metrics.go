@@ -0,0 +1,31 @@
+package cluster
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// ClusterMembers tracks known cluster members by state
+	clusterMembers = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_cluster_members",
+			Help: "Number of known gateway cluster members by state",
+		},
+		[]string{"state"},
+	)
+
+	// ClusterEvents tracks cluster events sent and received
+	clusterEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_cluster_events_total",
+			Help: "Total number of cluster events by type and direction",
+		},
+		[]string{"type", "direction"},
+	)
+)
+
+func init() {
+	// Register metrics with Prometheus
+	prometheus.MustRegister(clusterMembers)
+	prometheus.MustRegister(clusterEvents)
+}
@@ -2,8 +2,12 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -11,6 +15,7 @@ import (
 
 // Config contains all configuration for the application
 type Config struct {
+	Version  int            `yaml:"version"` // Schema version, see CurrentVersion
 	Server   ServerConfig   `yaml:"server"`
 	Auth     AuthConfig     `yaml:"auth"`
 	Logging  LoggingConfig  `yaml:"logging"`
@@ -21,7 +26,66 @@ type Config struct {
 	Tracing  TracingConfig  `yaml:"tracing"`
 	Etcd     EtcdConfig     `yaml:"etcd"`
 	GRPC     GRPCConfig     `yaml:"grpc"`
+	DNS      DNSConfig      `yaml:"dns"`
+	Dial     DialConfig     `yaml:"dial"`
+	Cluster  ClusterConfig  `yaml:"cluster"`
+	SLO      SLOConfig      `yaml:"slo"`
+	Debug    DebugConfig    `yaml:"debug"`
 	Routes   []Route        `yaml:"routes"`
+
+	// FeatureFlags are evaluated per request and sent upstream as headers
+	FeatureFlags FeatureFlagsConfig `yaml:"feature_flags"`
+
+	// Reload applies upstream changes in the routes file on SIGHUP
+	Reload ReloadConfig `yaml:"reload"`
+
+	// RateLimits are named limits routes share through rate_limit_ref
+	RateLimits map[string]RateLimitConfig `yaml:"rate_limits"`
+
+	// ForwardedHeaders controls the X-Forwarded-* and Forwarded headers sent
+	// upstream
+	ForwardedHeaders ForwardedHeadersConfig `yaml:"forwarded_headers"`
+
+	// MiddlewareOrder lists route middleware outermost first
+	MiddlewareOrder []string `yaml:"middleware_order"`
+
+	// Portal serves developer self-service endpoints for API keys and docs
+	Portal PortalConfig `yaml:"portal"`
+
+	// Usage exports per-key, per-route request counts for billing
+	Usage UsageConfig `yaml:"usage"`
+
+	// Notifications posts operational events to webhooks
+	Notifications NotificationsConfig `yaml:"notifications"`
+
+	// Certificates monitors the expiry of the configured TLS certificates
+	Certificates CertificatesConfig `yaml:"certificates"`
+
+	// SPIFFE obtains the gateway's workload identity from a SPIRE agent
+	SPIFFE SPIFFEConfig `yaml:"spiffe"`
+
+	// L4Proxy forwards raw TCP and UDP traffic from dedicated listeners
+	L4Proxy L4ProxyConfig `yaml:"l4_proxy"`
+
+	// HealthChecks schedules the upstream health checks of all routes
+	HealthChecks HealthChecksConfig `yaml:"health_checks"`
+
+	// TestTraffic routes requests with a signed test token to the routes'
+	// sandbox upstreams
+	TestTraffic TestTrafficConfig `yaml:"test_traffic"`
+
+	// FieldEncryption holds the keys of routes' field encryption
+	FieldEncryption FieldEncryptionConfig `yaml:"field_encryption"`
+
+	// NetworkZones tells internal clients from external ones for the routes'
+	// split_horizon upstreams
+	NetworkZones NetworkZonesConfig `yaml:"network_zones"`
+
+	// OPA loads the policy bundles routes evaluate Rego policies from
+	OPA OPAEngineConfig `yaml:"opa"`
+
+	// Deprecations warn of legacy settings read from the file
+	Deprecations []string `yaml:"-"`
 }
 
 // ServerConfig contains server configuration
@@ -33,6 +97,56 @@ type ServerConfig struct {
 	MaxHeaderBytes    int    `yaml:"max_header_bytes"`
 	EnableHTTP2       bool   `yaml:"enable_http2"`
 	EnableCompression bool   `yaml:"enable_compression"`
+
+	// NotFound customizes the response for unmatched requests when no route
+	// sets catch_all
+	NotFound NotFoundConfig `yaml:"not_found"`
+
+	// SlowClient aborts clients that send or read data too slowly
+	SlowClient SlowClientConfig `yaml:"slow_client"`
+
+	// KeepAlive limits how long client connections are reused
+	KeepAlive KeepAliveConfig `yaml:"keep_alive"`
+
+	// ResponseHeaders adds timing and identity headers to responses
+	ResponseHeaders ResponseHeadersConfig `yaml:"response_headers"`
+}
+
+// ResponseHeadersConfig adds debugging headers to every response, so clients
+// and CDN logs can be correlated with the gateway instance that served them.
+// Latencies are in milliseconds up to when the response headers are sent.
+type ResponseHeadersConfig struct {
+	Enabled         bool   `yaml:"enabled"`
+	UpstreamLatency bool   `yaml:"upstream_latency"` // X-Upstream-Latency, omitted when no upstream was called
+	GatewayLatency  bool   `yaml:"gateway_latency"`  // X-Gateway-Latency, total time in the gateway
+	ServedBy        bool   `yaml:"served_by"`        // X-Served-By with the instance ID
+	InstanceID      string `yaml:"instance_id"`      // The host name if empty
+	Server          string `yaml:"server"`           // Replaces the upstream's Server header if set
+}
+
+// KeepAliveConfig closes client connections after a number of requests or
+// an age, so load behind L4 load balancers spreads over new gateway
+// instances. Zero disables a limit.
+type KeepAliveConfig struct {
+	MaxRequests int `yaml:"max_requests"` // Requests served per connection
+	MaxAge      int `yaml:"max_age"`      // Seconds a connection is reused for
+}
+
+// SlowClientConfig protects against slowloris-style clients. Transfer rates
+// are averaged over the time spent waiting on the client, so a slow upstream
+// doesn't count against it.
+type SlowClientConfig struct {
+	Enabled      bool `yaml:"enabled"`
+	MinReadRate  int  `yaml:"min_read_rate"`  // Request body bytes/sec, 0 disables
+	MinWriteRate int  `yaml:"min_write_rate"` // Response bytes/sec, 0 disables
+	GracePeriod  int  `yaml:"grace_period"`   // Seconds allowed before rates apply
+	WriteTimeout int  `yaml:"write_timeout"`  // Seconds a single write may block, 0 disables
+}
+
+// NotFoundConfig is a custom response body for requests no route matches
+type NotFoundConfig struct {
+	ContentType string `yaml:"content_type"`
+	Body        string `yaml:"body"`
 }
 
 // AuthConfig contains authentication configuration
@@ -42,14 +156,128 @@ type AuthConfig struct {
 	APIKeyValidationURL string `yaml:"api_key_validation_url"`
 	APIKeyHeader        string `yaml:"api_key_header"`
 	JWTHeader           string `yaml:"jwt_header"`
+
+	// JWKSURL serves the identity provider's key set, verifying JWTs signed
+	// with RS*, PS* and ES* algorithms. The key set is refetched every
+	// JWKSRefreshInterval seconds, 300 by default, and when a token names a
+	// key it doesn't hold.
+	JWKSURL             string `yaml:"jwks_url"`
+	JWKSRefreshInterval int    `yaml:"jwks_refresh_interval"`
+
+	// ValidationCache caches API key validation results and verified JWTs
+	ValidationCache ValidationCacheConfig `yaml:"validation_cache"`
+}
+
+// Validate checks the JWKS settings
+func (a *AuthConfig) Validate() error {
+	if a.JWKSURL != "" {
+		jwksURL, err := url.Parse(a.JWKSURL)
+		if err != nil || (jwksURL.Scheme != "http" && jwksURL.Scheme != "https") || jwksURL.Host == "" {
+			return fmt.Errorf("invalid jwks_url: %s", a.JWKSURL)
+		}
+	}
+	if a.JWKSRefreshInterval < 0 {
+		return fmt.Errorf("jwks_refresh_interval must not be negative")
+	}
+	return nil
+}
+
+// ValidationCacheConfig caches the results of API key validation requests
+// and JWT verification in memory, and optionally in Redis so gateway
+// instances share them. The JWKS key set is shared through Redis too.
+// Rejected credentials are cached separately so a client retrying a bad key
+// doesn't reach the validation service on every request. JWTs are never
+// cached past their expiry.
+type ValidationCacheConfig struct {
+	Enabled     bool        `yaml:"enabled"`
+	MaxEntries  int         `yaml:"max_entries"`  // Results kept in memory, least recently used evicted, 10000 by default
+	TTL         int         `yaml:"ttl"`          // Seconds a valid key is cached, 60 by default
+	NegativeTTL int         `yaml:"negative_ttl"` // Seconds an invalid key is cached, 0 disables
+	Redis       RedisConfig `yaml:"redis"`
+}
+
+// Validate checks the validation cache settings
+func (v *ValidationCacheConfig) Validate() error {
+	if !v.Enabled {
+		return nil
+	}
+	if v.MaxEntries < 0 || v.TTL < 0 || v.NegativeTTL < 0 {
+		return fmt.Errorf("max_entries, ttl and negative_ttl must not be negative")
+	}
+	if v.Redis.Enabled && v.Redis.Address == "" {
+		return fmt.Errorf("redis requires an address")
+	}
+	return nil
+}
+
+// RedisConfig connects to a Redis server
+type RedisConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Address   string `yaml:"address"` // host:port
+	Password  string `yaml:"password"`
+	DB        int    `yaml:"db"`
+	KeyPrefix string `yaml:"key_prefix"` // Prepended to every key
+	Timeout   int    `yaml:"timeout"`    // Milliseconds per command, 100 by default
 }
 
 // LoggingConfig contains logging configuration
 type LoggingConfig struct {
-	Level        string `yaml:"level"`
-	Format       string `yaml:"format"`
-	Output       string `yaml:"output"`
-	EnableAccess bool   `yaml:"enable_access_log"`
+	Level         string          `yaml:"level"`
+	Format        string          `yaml:"format"`
+	Output        string          `yaml:"output"`
+	EnableAccess  bool            `yaml:"enable_access_log"`
+	AccessLog     AccessLogConfig `yaml:"access_log"`
+	LevelEndpoint string          `yaml:"level_endpoint"` // Admin endpoint for runtime log levels, limited to debug.allowed_roles
+}
+
+// AccessLogConfig controls which requests are written to the access log.
+// Errors, slow requests and requests carrying the debug header are always
+// logged; other requests are sampled.
+type AccessLogConfig struct {
+	SampleRate      int      `yaml:"sample_rate"`       // Log 1 in N successful requests
+	SlowThresholdMs int      `yaml:"slow_threshold_ms"` // Requests at least this slow are always logged
+	MinErrorStatus  int      `yaml:"min_error_status"`  // Responses with at least this status are always logged
+	Tags            []string `yaml:"tags"`              // Only log routes carrying one of these tags
+	DebugHeader     string   `yaml:"debug_header"`      // Requests with this header are always logged
+	LogQuery        bool     `yaml:"log_query"`         // Log the query string
+	LogHeaders      []string `yaml:"log_headers"`       // Request headers to log
+	LogBodyBytes    int      `yaml:"log_body_bytes"`    // Log up to this many bytes of request bodies, none by default
+
+	// Redaction masks secrets and PII in the logged path, query, headers and
+	// body before entries are written
+	Redaction AccessLogRedaction `yaml:"redaction"`
+}
+
+// AccessLogRedaction lists what is masked in access log entries. Names match
+// case-insensitively; patterns are masked wherever they match.
+type AccessLogRedaction struct {
+	QueryParams []string           `yaml:"query_params"` // Query parameters whose values are masked
+	Headers     []string           `yaml:"headers"`      // Headers whose values are masked
+	BodyFields  []string           `yaml:"body_fields"`  // JSON body properties whose values are masked at any depth
+	Patterns    []RedactionPattern `yaml:"patterns"`
+	Replacement string             `yaml:"replacement"` // "[REDACTED]" by default
+}
+
+// RedactionPattern is a named regular expression whose matches are masked
+type RedactionPattern struct {
+	Name  string `yaml:"name"` // Labels the redaction metric
+	Regex string `yaml:"regex"`
+}
+
+// Validate checks the access log settings
+func (a *AccessLogConfig) Validate() error {
+	if a.LogBodyBytes < 0 {
+		return fmt.Errorf("log_body_bytes must not be negative")
+	}
+	for i, pattern := range a.Redaction.Patterns {
+		if pattern.Name == "" {
+			return fmt.Errorf("redaction.patterns[%d] requires a name", i)
+		}
+		if _, err := regexp.Compile(pattern.Regex); err != nil {
+			return fmt.Errorf("redaction.patterns[%d]: %w", i, err)
+		}
+	}
+	return nil
 }
 
 // SecurityConfig contains security configuration
@@ -64,6 +292,33 @@ type SecurityConfig struct {
 	IPWhitelist              []string  `yaml:"ip_whitelist"`
 	IPBlacklist              []string  `yaml:"ip_blacklist"`
 	MaxBodySize              int64     `yaml:"max_body_size"`
+
+	// StripHeaders removes headers only the gateway may set from incoming
+	// requests
+	StripHeaders StripHeadersConfig `yaml:"strip_headers"`
+
+	// ClientBreaker rejects clients that keep causing errors
+	ClientBreaker ClientBreakerConfig `yaml:"client_breaker"`
+}
+
+// ClientBreakerConfig trips a breaker per client connection address when the
+// client causes too many error responses within the window. Tripped
+// clients get 429 at the edge until the block expires.
+type ClientBreakerConfig struct {
+	Enabled    bool  `yaml:"enabled"`
+	Statuses   []int `yaml:"statuses"`    // Responses counted as errors, 401 and 403 by default
+	Threshold  int   `yaml:"threshold"`   // Errors within the window that trip the breaker
+	Window     int   `yaml:"window"`      // Seconds errors are counted over
+	BlockFor   int   `yaml:"block_for"`   // Seconds a tripped client is rejected
+	MaxClients int   `yaml:"max_clients"` // Clients tracked at once; the one with the oldest error is forgotten beyond this
+}
+
+// StripHeadersConfig lists internal headers that upstreams trust because the
+// gateway sets them. Clients sending them are ignored rather than rejected.
+type StripHeadersConfig struct {
+	Enabled  bool     `yaml:"enabled"`
+	Headers  []string `yaml:"headers"`  // Header names, matched case-insensitively
+	Prefixes []string `yaml:"prefixes"` // Header name prefixes such as "X-Internal-"
 }
 
 // TLSConfig contains TLS configuration
@@ -79,32 +334,210 @@ type TLSConfig struct {
 
 // CacheConfig contains caching configuration
 type CacheConfig struct {
-	Enabled       bool     `yaml:"enabled"`
-	DefaultTTL    int      `yaml:"default_ttl"`
-	MaxTTL        int      `yaml:"max_ttl"`
-	MaxSize       int      `yaml:"max_size"`
-	IncludeHost   bool     `yaml:"include_host"`
-	VaryHeaders   []string `yaml:"vary_headers"`
-	PurgeEndpoint string   `yaml:"purge_endpoint"`
+	Enabled       bool                   `yaml:"enabled"`
+	DefaultTTL    int                    `yaml:"default_ttl"`
+	MaxTTL        int                    `yaml:"max_ttl"`
+	MaxSize       int                    `yaml:"max_size"`
+	IncludeHost   bool                   `yaml:"include_host"`
+	VaryHeaders   []string               `yaml:"vary_headers"`
+	PurgeEndpoint string                 `yaml:"purge_endpoint"`
+	PurgeAuth     CachePurgeAuthConfig   `yaml:"purge_auth"`
+	Persistence   CachePersistenceConfig `yaml:"persistence"`
+	Warm          CacheWarmConfig        `yaml:"warm"`
+	Directives    CacheDirectivesConfig  `yaml:"directives"`
+}
+
+// Cache directives operators can send with a request
+const (
+	CacheDirectiveBypass  = "bypass"  // Serve from the upstream without touching the cache
+	CacheDirectiveRefresh = "refresh" // Skip the cached entry and replace it with a fresh response
+)
+
+// CacheDirectivesConfig lets operators bypass or refresh the cache for a
+// single request, to debug stale content without purging. Directives from
+// other callers are ignored.
+type CacheDirectivesConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	Header       string   `yaml:"header"`        // X-Gateway-Cache by default
+	QueryParam   string   `yaml:"query_param"`   // Also read from this query parameter if set
+	AllowedRoles []string `yaml:"allowed_roles"` // Roles of operators, debug.allowed_roles by default
+}
+
+// Cache purge authentication methods
+const (
+	PurgeAuthAdmin = "admin" // API key or token with one of debug.allowed_roles
+	PurgeAuthMTLS  = "mtls"  // Workload certificate on the internal mTLS listener
+)
+
+// CachePurgeAuthConfig protects the purge endpoint. Callers must pass one of
+// the methods; the endpoint is open to anyone if none is set.
+type CachePurgeAuthConfig struct {
+	Methods    []string `yaml:"methods"`
+	AllowedIDs []string `yaml:"allowed_ids"` // SPIFFE IDs allowed over mTLS, any the internal listener accepts if empty
 }
 
-// CorsConfig contains CORS configuration
+// Validate checks the purge authentication methods
+func (p *CachePurgeAuthConfig) Validate() error {
+	for _, method := range p.Methods {
+		switch method {
+		case PurgeAuthAdmin, PurgeAuthMTLS:
+		default:
+			return fmt.Errorf("unknown method: %s", method)
+		}
+	}
+	for _, id := range p.AllowedIDs {
+		if !ValidSPIFFEID(id) {
+			return fmt.Errorf("invalid allowed_ids entry: %s", id)
+		}
+	}
+	return nil
+}
+
+// Allows reports whether callers may authenticate with a method
+func (p *CachePurgeAuthConfig) Allows(method string) bool {
+	for _, allowed := range p.Methods {
+		if allowed == method {
+			return true
+		}
+	}
+	return false
+}
+
+// CacheWarmConfig contains cache prefetch configuration
+type CacheWarmConfig struct {
+	Endpoint    string   `yaml:"endpoint"`
+	Paths       []string `yaml:"paths"`
+	OnStartup   bool     `yaml:"on_startup"`
+	Host        string   `yaml:"host"` // Host startup warm requests are sent for, so keys match requests with include_host
+	Concurrency int      `yaml:"concurrency"`
+	MaxPaths    int      `yaml:"max_paths"` // Paths a single warm may fetch
+}
+
+// defaultWarmMaxPaths is the number of paths a warm may fetch when
+// max_paths isn't set
+const defaultWarmMaxPaths = 100
+
+// Validate checks the warm paths are within max_paths, and that startup warms
+// have a host to key their entries by when the cache includes it
+func (c *CacheWarmConfig) Validate(includeHost bool) error {
+	if c.MaxPaths < 0 {
+		return fmt.Errorf("max_paths must not be negative")
+	}
+	maxPaths := c.MaxPaths
+	if maxPaths == 0 {
+		maxPaths = defaultWarmMaxPaths
+	}
+	if len(c.Paths) > maxPaths {
+		return fmt.Errorf("%d paths exceed max_paths of %d", len(c.Paths), maxPaths)
+	}
+	if c.OnStartup && includeHost && len(c.Paths) > 0 && c.Host == "" {
+		return fmt.Errorf("host is required to warm on startup with cache.include_host")
+	}
+	return nil
+}
+
+// CachePersistenceConfig contains disk snapshot configuration for the cache
+type CachePersistenceConfig struct {
+	Enabled          bool   `yaml:"enabled"`
+	Path             string `yaml:"path"`
+	SnapshotInterval int    `yaml:"snapshot_interval"`
+}
+
+// CorsConfig contains CORS configuration. Allowed origins may use a wildcard
+// subdomain such as https://*.example.com, and origin patterns are regular
+// expressions matched against the whole origin.
 type CorsConfig struct {
-	Enabled          bool     `yaml:"enabled"`
-	AllowAllOrigins  bool     `yaml:"allow_all_origins"`
-	AllowedOrigins   []string `yaml:"allowed_origins"`
-	AllowedMethods   []string `yaml:"allowed_methods"`
-	AllowedHeaders   []string `yaml:"allowed_headers"`
-	ExposedHeaders   []string `yaml:"exposed_headers"`
-	AllowCredentials bool     `yaml:"allow_credentials"`
-	MaxAge           int      `yaml:"max_age"`
+	Enabled               bool     `yaml:"enabled"`
+	AllowAllOrigins       bool     `yaml:"allow_all_origins"`
+	AllowedOrigins        []string `yaml:"allowed_origins"`
+	AllowedOriginPatterns []string `yaml:"allowed_origin_patterns"`
+	ReflectOrigin         bool     `yaml:"reflect_origin"`
+	OriginCacheSize       int      `yaml:"origin_cache_size"`
+	AllowedMethods        []string `yaml:"allowed_methods"`
+	AllowedHeaders        []string `yaml:"allowed_headers"`
+	ExposedHeaders        []string `yaml:"exposed_headers"`
+	AllowCredentials      bool     `yaml:"allow_credentials"`
+	MaxAge                int      `yaml:"max_age"`
+}
+
+// Validate checks the wildcard origins and origin patterns
+func (c CorsConfig) Validate() error {
+	for _, origin := range c.AllowedOrigins {
+		if err := ValidateOriginWildcard(origin); err != nil {
+			return err
+		}
+	}
+	for _, pattern := range c.AllowedOriginPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid allowed_origin_patterns entry %q: %w", pattern, err)
+		}
+	}
+	return nil
 }
 
 // MetricsConfig contains metrics configuration
 type MetricsConfig struct {
-	Enabled       bool   `yaml:"enabled"`
-	Endpoint      string `yaml:"endpoint"`
-	IncludeSystem bool   `yaml:"include_system"`
+	Enabled       bool         `yaml:"enabled"`
+	Endpoint      string       `yaml:"endpoint"`
+	IncludeSystem bool         `yaml:"include_system"`
+	StatsD        StatsDConfig `yaml:"statsd"`
+
+	// AllowedCIDRs restricts the endpoint to scrapers in these ranges, matched
+	// against the connection's address since forwarding headers can be forged.
+	// Open to anyone if empty.
+	AllowedCIDRs []string `yaml:"allowed_cidrs"`
+}
+
+// Prefixes parses the address ranges allowed to scrape the endpoint
+func (m *MetricsConfig) Prefixes() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(m.AllowedCIDRs))
+	for _, cidr := range m.AllowedCIDRs {
+		prefix, ok := parsePrefix(cidr)
+		if !ok {
+			return nil, fmt.Errorf("invalid allowed_cidrs entry: %s", cidr)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// NetworkZonesConfig classifies clients as internal or external. Requests
+// arriving on the internal listener are always internal.
+type NetworkZonesConfig struct {
+	// InternalCIDRs are matched against the connection's address since
+	// forwarding headers can be forged
+	InternalCIDRs []string `yaml:"internal_cidrs"`
+}
+
+// Prefixes parses the address ranges of internal clients
+func (n *NetworkZonesConfig) Prefixes() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(n.InternalCIDRs))
+	for _, cidr := range n.InternalCIDRs {
+		prefix, ok := parsePrefix(cidr)
+		if !ok {
+			return nil, fmt.Errorf("invalid internal_cidrs entry: %s", cidr)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// StatsD flavors
+const (
+	StatsDFlavorStatsD    = "statsd"
+	StatsDFlavorDogStatsD = "dogstatsd"
+)
+
+// StatsDConfig contains settings for pushing gateway metrics to a StatsD or
+// DogStatsD agent
+type StatsDConfig struct {
+	Enabled       bool     `yaml:"enabled"`
+	Address       string   `yaml:"address"`
+	Flavor        string   `yaml:"flavor"` // statsd or dogstatsd; plain statsd drops tags
+	Prefix        string   `yaml:"prefix"`
+	Tags          []string `yaml:"tags"`           // Constant tags in key:value form
+	FlushInterval int      `yaml:"flush_interval"` // Seconds between flushes
+	MaxPacketSize int      `yaml:"max_packet_size"`
 }
 
 // TracingConfig contains tracing configuration
@@ -116,10 +549,124 @@ type TracingConfig struct {
 	SampleRate  float64 `yaml:"sample_rate"`
 }
 
+// Rate limiting algorithms
+const (
+	RateLimitTokenBucket      = "token_bucket"       // Allows bursts up to the limit, refilled steadily
+	RateLimitLeakyBucket      = "leaky_bucket"       // Queues requests and releases them at a steady rate
+	RateLimitFixedWindow      = "fixed_window"       // Counts requests per calendar period
+	RateLimitSlidingWindowLog = "sliding_window_log" // Counts requests in the period before each request
+)
+
+// Rate limit client keys
+const (
+	RateLimitKeyIP      = "ip"      // The client IP
+	RateLimitKeySubject = "subject" // The authenticated subject
+	RateLimitKeyTenant  = "tenant"  // The authenticated tenant, shared by its users
+)
+
 // RateLimitConfig represents rate limiting configuration
 type RateLimitConfig struct {
+	Requests  int                        `yaml:"requests"`
+	Period    string                     `yaml:"period"`
+	Algorithm string                     `yaml:"algorithm"`  // token_bucket by default
+	QueueSize int                        `yaml:"queue_size"` // Requests a leaky bucket holds, the limit's requests by default
+	Methods   map[string]MethodRateLimit `yaml:"methods"`    // Limits replacing the one above for these methods
+
+	// KeyBy selects what clients are limited by: ip, subject or tenant. By
+	// default the API key or Authorization header is used, else the client
+	// IP. Unauthenticated requests fall back to the default.
+	KeyBy string `yaml:"key_by"`
+
+	// SpikeArrest caps bursts at one second's share of the limit, so 600 per
+	// minute allows at most 10 requests in any second. Token bucket only.
+	SpikeArrest bool `yaml:"spike_arrest"`
+
+	// Exempt lists callers the limit doesn't apply to, such as internal
+	// monitoring
+	Exempt RateLimitExemptions `yaml:"exempt"`
+}
+
+// RateLimitExemptions identifies callers exempt from a rate limit
+type RateLimitExemptions struct {
+	APIKeys  []string `yaml:"api_keys"` // auth.api_key_header values, best kept in named limits as ${VAR} placeholders
+	Subjects []string `yaml:"subjects"` // Subjects of authenticated callers
+	CIDRs    []string `yaml:"cidrs"`    // Connection address ranges; single addresses are accepted too
+}
+
+// Prefixes parses the exempt address ranges
+func (e *RateLimitExemptions) Prefixes() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(e.CIDRs))
+	for _, cidr := range e.CIDRs {
+		prefix, ok := parsePrefix(cidr)
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit exempt cidr: %s", cidr)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// parsePrefix parses an address range, or a single address as a range of one
+func parsePrefix(cidr string) (netip.Prefix, bool) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		addr, addrErr := netip.ParseAddr(cidr)
+		if addrErr != nil {
+			return netip.Prefix{}, false
+		}
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+	return prefix.Masked(), true
+}
+
+// MethodRateLimit limits requests of one method separately from the others
+type MethodRateLimit struct {
 	Requests int    `yaml:"requests"`
-	Period   string `yaml:"period"`
+	Period   string `yaml:"period"` // The route's period if empty
+}
+
+// Validate checks the algorithm and method overrides
+func (r *RateLimitConfig) Validate() error {
+	switch r.Algorithm {
+	case "", RateLimitTokenBucket, RateLimitLeakyBucket, RateLimitFixedWindow, RateLimitSlidingWindowLog:
+	default:
+		return fmt.Errorf("unknown rate limit algorithm: %s", r.Algorithm)
+	}
+	switch r.KeyBy {
+	case "", RateLimitKeyIP, RateLimitKeySubject, RateLimitKeyTenant:
+	default:
+		return fmt.Errorf("unknown rate limit key_by: %s", r.KeyBy)
+	}
+	if r.QueueSize < 0 {
+		return fmt.Errorf("rate limit queue_size must not be negative")
+	}
+	if r.SpikeArrest && r.Algorithm != "" && r.Algorithm != RateLimitTokenBucket {
+		return fmt.Errorf("rate limit spike_arrest requires the token_bucket algorithm")
+	}
+	for method, limit := range r.Methods {
+		if limit.Requests <= 0 {
+			return fmt.Errorf("rate limit for method %s requires a positive requests", method)
+		}
+	}
+	if _, err := r.Exempt.Prefixes(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ForMethod returns the limit applying to a method, and whether the method
+// has its own limit
+func (r *RateLimitConfig) ForMethod(method string) (RateLimitConfig, bool) {
+	for name, limit := range r.Methods {
+		if strings.EqualFold(name, method) {
+			period := limit.Period
+			if period == "" {
+				period = r.Period
+			}
+			return RateLimitConfig{Requests: limit.Requests, Period: period, Algorithm: r.Algorithm, QueueSize: r.QueueSize, SpikeArrest: r.SpikeArrest, KeyBy: r.KeyBy}, true
+		}
+	}
+	return *r, false
 }
 
 // CacheSettings represents cache settings for a route
@@ -135,6 +682,37 @@ type CircuitBreakerSettings struct {
 	Threshold     int  `yaml:"threshold"`
 	Timeout       int  `yaml:"timeout"`
 	MaxConcurrent int  `yaml:"max_concurrent"`
+
+	// FailureOn narrows which outcomes count as failures, any 5xx if unset
+	FailureOn *CircuitBreakerFailures `yaml:"failure_on"`
+}
+
+// CircuitBreakerFailures classifies request outcomes for a circuit breaker,
+// so it trips on what signals an outage rather than on every 5xx. Upstream
+// connection errors and timeouts are answered with 502, 503 or 504 and
+// classified by the error as well as the status.
+type CircuitBreakerFailures struct {
+	Statuses     []int    `yaml:"statuses"`      // Response statuses counting as failures, any 5xx if empty
+	Errors       []string `yaml:"errors"`        // Upstream errors count only if they contain one of these, any if empty
+	TimeoutsOnly bool     `yaml:"timeouts_only"` // Only upstream timeouts count as failures
+}
+
+// Validate checks the statuses and error substrings
+func (f *CircuitBreakerFailures) Validate() error {
+	if f.TimeoutsOnly && (len(f.Statuses) > 0 || len(f.Errors) > 0) {
+		return fmt.Errorf("timeouts_only can't be combined with statuses or errors")
+	}
+	for _, status := range f.Statuses {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("invalid status: %d", status)
+		}
+	}
+	for _, substring := range f.Errors {
+		if substring == "" {
+			return fmt.Errorf("errors contains an empty string")
+		}
+	}
+	return nil
 }
 
 // WebSocketConfig represents websocket-specific configuration
@@ -145,7 +723,410 @@ type WebSocketConfig struct {
 }
 
 type EtcdConfig struct {
-	Hosts string `yaml:"hosts"`
+	Hosts          string        `yaml:"hosts"` // Comma separated list of etcd endpoints
+	Username       string        `yaml:"username"`
+	Password       string        `yaml:"password"`
+	DialTimeout    int           `yaml:"dial_timeout"`
+	RequestTimeout int           `yaml:"request_timeout"`
+	TLS            EtcdTLSConfig `yaml:"tls"`
+}
+
+// ClusterConfig contains gateway clustering and gossip configuration
+type ClusterConfig struct {
+	Enabled          bool     `yaml:"enabled"`
+	NodeName         string   `yaml:"node_name"`
+	BindAddress      string   `yaml:"bind_address"`
+	AdvertiseAddress string   `yaml:"advertise_address"`
+	Seeds            []string `yaml:"seeds"`
+	GossipInterval   int      `yaml:"gossip_interval"`
+	SuspectTimeout   int      `yaml:"suspect_timeout"`
+	DeadTimeout      int      `yaml:"dead_timeout"`
+	Fanout           int      `yaml:"fanout"`
+	SecretKey        string   `yaml:"secret_key"` // Signs messages between gateways, required when enabled
+
+	// ShareCircuitBreakers broadcasts circuit breaker state changes so every
+	// gateway opens a route's breaker when one of them does. A breaker opened
+	// by a peer probes the upstream again after BreakerStateTTL seconds.
+	ShareCircuitBreakers bool `yaml:"share_circuit_breakers"`
+	BreakerStateTTL      int  `yaml:"breaker_state_ttl"`
+}
+
+// SLOConfig contains settings for evaluating route SLOs and alerting on burn rate
+type SLOConfig struct {
+	EvaluationInterval int    `yaml:"evaluation_interval"` // Seconds between burn-rate evaluations
+	AlertWebhook       string `yaml:"alert_webhook"`       // URL notified when a burn-rate alert fires or resolves
+	WebhookTimeoutMs   int    `yaml:"webhook_timeout_ms"`
+}
+
+// DebugConfig contains settings for the admin-only /debug endpoints
+type DebugConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	Pprof        bool     `yaml:"pprof"`         // Expose net/http/pprof under /debug/pprof/
+	AllowedRoles []string `yaml:"allowed_roles"` // Roles allowed to call the debug endpoints
+}
+
+// PortalConfig enables the developer portal: API key signup verified by
+// email, per-key usage and the aggregated API docs. Issued keys authenticate
+// like keys checked by api_key_validation_url.
+type PortalConfig struct {
+	Enabled             bool   `yaml:"enabled"`
+	PathPrefix          string `yaml:"path_prefix"`          // /portal by default
+	PublicURL           string `yaml:"public_url"`           // Base URL of verification links, such as https://api.example.com
+	VerificationWebhook string `yaml:"verification_webhook"` // Receives the verification links to email to developers
+	VerificationTTL     int    `yaml:"verification_ttl"`     // Seconds a verification link is valid, a day by default
+	KeyRole             string `yaml:"key_role"`             // Role of issued keys, developer by default
+	DailyQuota          int    `yaml:"daily_quota"`          // Requests per key per UTC day, 0 for unlimited
+	SignupsPerHour      int    `yaml:"signups_per_hour"`     // Signups per client address, 5 by default
+	StoreFile           string `yaml:"store_file"`           // Issued keys and usage are kept here, in memory only if empty
+}
+
+// Validate checks the portal settings
+func (p *PortalConfig) Validate() error {
+	if !p.Enabled {
+		return nil
+	}
+	if u, err := url.Parse(p.VerificationWebhook); err != nil || !u.IsAbs() {
+		return fmt.Errorf("verification_webhook must be an absolute URL")
+	}
+	// Links aren't built from the Host header, which the client controls
+	if u, err := url.Parse(p.PublicURL); err != nil || !u.IsAbs() {
+		return fmt.Errorf("public_url must be an absolute URL")
+	}
+	if p.PathPrefix != "" && !strings.HasPrefix(p.PathPrefix, "/") {
+		return fmt.Errorf("path_prefix must start with /")
+	}
+	if p.VerificationTTL < 0 || p.DailyQuota < 0 || p.SignupsPerHour < 0 {
+		return fmt.Errorf("verification_ttl, daily_quota and signups_per_hour must not be negative")
+	}
+	return nil
+}
+
+// Usage export sinks
+const (
+	UsageSinkCSV     = "csv"
+	UsageSinkWebhook = "webhook"
+	UsageSinkKafka   = "kafka"
+)
+
+// UsageConfig aggregates request counts and bytes per API key and route and
+// flushes them periodically to a sink for billing and chargeback
+type UsageConfig struct {
+	Enabled          bool             `yaml:"enabled"`
+	FlushInterval    int              `yaml:"flush_interval"` // Seconds between flushes, 60 by default
+	Sink             string           `yaml:"sink"`           // csv, webhook or kafka
+	File             string           `yaml:"file"`           // CSV file records are appended to
+	WebhookURL       string           `yaml:"webhook_url"`    // POSTed a JSON array of records
+	Kafka            UsageKafkaConfig `yaml:"kafka"`
+	TimeoutMs        int              `yaml:"timeout_ms"`        // Per flush for webhook and kafka, 5000 by default
+	IncludeAnonymous bool             `yaml:"include_anonymous"` // Also count requests without an API key
+}
+
+// UsageKafkaConfig produces usage records to a topic through a Kafka REST
+// proxy
+type UsageKafkaConfig struct {
+	RESTURL string `yaml:"rest_url"`
+	Topic   string `yaml:"topic"`
+}
+
+// Validate checks the usage export settings
+func (u *UsageConfig) Validate() error {
+	if !u.Enabled {
+		return nil
+	}
+	if u.FlushInterval < 0 || u.TimeoutMs < 0 {
+		return fmt.Errorf("flush_interval and timeout_ms must not be negative")
+	}
+	switch u.Sink {
+	case UsageSinkCSV:
+		if u.File == "" {
+			return fmt.Errorf("the csv sink requires file")
+		}
+	case UsageSinkWebhook:
+		if parsed, err := url.Parse(u.WebhookURL); err != nil || !parsed.IsAbs() {
+			return fmt.Errorf("the webhook sink requires an absolute webhook_url")
+		}
+	case UsageSinkKafka:
+		if parsed, err := url.Parse(u.Kafka.RESTURL); err != nil || !parsed.IsAbs() || u.Kafka.Topic == "" {
+			return fmt.Errorf("the kafka sink requires an absolute kafka.rest_url and a topic")
+		}
+	default:
+		return fmt.Errorf("invalid sink: %s", u.Sink)
+	}
+	return nil
+}
+
+// Operational events sent as notifications
+const (
+	EventCircuitBreakerOpened = "circuit_breaker_opened"
+	EventUpstreamUnhealthy    = "upstream_unhealthy"
+	EventConfigReloaded       = "config_reloaded"
+	EventCertificateExpiring  = "certificate_expiring"
+	EventMQTTConnected        = "mqtt_connected"
+	EventMQTTDisconnected     = "mqtt_disconnected"
+)
+
+// NotificationsConfig posts operational events as JSON to webhooks. Payloads
+// carry a text field, so Slack incoming webhooks accept them as is. Repeats
+// of an event for the same subject are suppressed within the dedup window.
+type NotificationsConfig struct {
+	Enabled           bool                  `yaml:"enabled"`
+	Webhooks          []NotificationWebhook `yaml:"webhooks"`
+	DedupWindow       int                   `yaml:"dedup_window"`        // Seconds repeats are suppressed, 300 by default
+	MaxRetries        int                   `yaml:"max_retries"`         // Retries of a failed delivery, 3 by default
+	RetryBackoffMs    int                   `yaml:"retry_backoff_ms"`    // First retry delay, doubled per retry, 1000 by default
+	TimeoutMs         int                   `yaml:"timeout_ms"`          // Per delivery attempt, 5000 by default
+	CertExpiryDays    int                   `yaml:"cert_expiry_days"`    // Notify when the server certificate expires within this many days, 14 by default
+	CertCheckInterval int                   `yaml:"cert_check_interval"` // Seconds between certificate checks, 12 hours by default
+}
+
+// NotificationWebhook is a webhook and the events it receives
+type NotificationWebhook struct {
+	URL    string   `yaml:"url"`
+	Events []string `yaml:"events"` // Every event if empty
+}
+
+// Validate checks the notification settings
+func (n *NotificationsConfig) Validate() error {
+	if !n.Enabled {
+		return nil
+	}
+	if len(n.Webhooks) == 0 {
+		return fmt.Errorf("at least one webhook is required")
+	}
+	for i, webhook := range n.Webhooks {
+		if u, err := url.Parse(webhook.URL); err != nil || !u.IsAbs() {
+			return fmt.Errorf("webhook at index %d requires an absolute url", i)
+		}
+		for _, event := range webhook.Events {
+			switch event {
+			case EventCircuitBreakerOpened, EventUpstreamUnhealthy, EventConfigReloaded, EventCertificateExpiring,
+				EventMQTTConnected, EventMQTTDisconnected:
+			default:
+				return fmt.Errorf("webhook at index %d: unknown event: %s", i, event)
+			}
+		}
+	}
+	if n.DedupWindow < 0 || n.MaxRetries < 0 || n.RetryBackoffMs < 0 || n.TimeoutMs < 0 {
+		return fmt.Errorf("durations and retries must not be negative")
+	}
+	return nil
+}
+
+// CertificatesConfig controls expiry monitoring of the server certificate and
+// the etcd client certificate and CA. A warning is logged, and a
+// certificate_expiring event sent, as a certificate passes each threshold.
+type CertificatesConfig struct {
+	CheckInterval int   `yaml:"check_interval"` // Seconds between checks, an hour by default
+	WarningDays   []int `yaml:"warning_days"`   // Days before expiry to warn at, 30, 14 and 7 by default
+}
+
+// Validate checks the certificate monitoring settings
+func (c *CertificatesConfig) Validate() error {
+	if c.CheckInterval < 0 {
+		return fmt.Errorf("check_interval must not be negative")
+	}
+	for _, days := range c.WarningDays {
+		if days <= 0 {
+			return fmt.Errorf("warning_days must be positive")
+		}
+	}
+	return nil
+}
+
+// SPIFFEConfig obtains the gateway's X.509 SVID from a SPIRE agent through
+// the SPIFFE Workload API. Routes with upstream_spiffe_id present it to their
+// upstream over mTLS, and the internal listener requires callers to present
+// one from the same trust domain.
+type SPIFFEConfig struct {
+	Enabled         bool     `yaml:"enabled"`
+	SocketPath      string   `yaml:"socket_path"`      // Workload API address, unix:///run/spire/sockets/agent.sock by default
+	InternalAddress string   `yaml:"internal_address"` // Address of the mTLS listener for mesh workloads, off if empty
+	AllowedIDs      []string `yaml:"allowed_ids"`      // SPIFFE IDs accepted by the internal listener, the whole trust domain if empty
+}
+
+// Validate checks the SPIFFE settings
+func (s *SPIFFEConfig) Validate() error {
+	if !s.Enabled {
+		return nil
+	}
+	if s.SocketPath != "" && !strings.HasPrefix(s.SocketPath, "unix://") && !strings.HasPrefix(s.SocketPath, "tcp://") {
+		return fmt.Errorf("socket_path must be a unix:// or tcp:// address")
+	}
+	for _, id := range s.AllowedIDs {
+		if !ValidSPIFFEID(id) {
+			return fmt.Errorf("invalid allowed_ids entry: %s", id)
+		}
+	}
+	return nil
+}
+
+// ValidSPIFFEID reports whether id is a SPIFFE ID such as
+// spiffe://example.org/payments
+func ValidSPIFFEID(id string) bool {
+	u, err := url.Parse(id)
+	return err == nil && u.Scheme == "spiffe" && u.Host != "" && u.Port() == "" &&
+		u.User == nil && u.RawQuery == "" && u.Fragment == ""
+}
+
+// ReloadConfig controls reloading route upstreams without a restart. Only the
+// upstream and load balancing of existing routes change on reload; the
+// rollback guard reverts a changed upstream whose error rate spikes.
+type ReloadConfig struct {
+	Enabled          bool          `yaml:"enabled"`
+	Rollback         RollbackGuard `yaml:"rollback"`
+	AlertWebhook     string        `yaml:"alert_webhook"` // POSTed a JSON alert when a change is rolled back
+	WebhookTimeoutMs int           `yaml:"webhook_timeout_ms"`
+}
+
+// Forwarded header policies
+const (
+	ForwardedAppend   = "append"   // Add the gateway's hop to the client's headers
+	ForwardedReplace  = "replace"  // Drop the client's headers and send the gateway's hop only
+	ForwardedPreserve = "preserve" // Pass the client's headers on, set only missing ones
+)
+
+// ForwardedHeadersConfig sets how the client address, host, protocol and port
+// are passed upstream in X-Forwarded-For, X-Forwarded-Host, X-Forwarded-Proto
+// and X-Forwarded-Port, and optionally in the RFC 7239 Forwarded header
+type ForwardedHeadersConfig struct {
+	Policy    string `yaml:"policy"`    // append, replace or preserve
+	Forwarded bool   `yaml:"forwarded"` // Also send the Forwarded header
+}
+
+// FeatureFlagsConfig contains feature flag definitions evaluated per request.
+// Flags are defined inline or in a YAML file of the same shape, which wins
+// and is reloaded when it changes.
+type FeatureFlagsConfig struct {
+	Enabled        bool                   `yaml:"enabled"`
+	File           string                 `yaml:"file"`
+	ReloadInterval int                    `yaml:"reload_interval"` // Seconds between file change checks, 0 disables
+	HeaderPrefix   string                 `yaml:"header_prefix"`   // Flag results are sent as <prefix><flag name>
+	UserClaim      string                 `yaml:"user_claim"`      // JWT claim identifying the user
+	TenantClaim    string                 `yaml:"tenant_claim"`    // JWT claim identifying the tenant
+	Flags          map[string]FeatureFlag `yaml:"flags"`
+}
+
+// FeatureFlag is on for the listed users and tenants and for a stable
+// percentage of the remaining callers
+type FeatureFlag struct {
+	Enabled    bool     `yaml:"enabled"`
+	Percentage float64  `yaml:"percentage"` // 0-100 of callers, bucketed by user, tenant or client IP
+	Users      []string `yaml:"users"`
+	Tenants    []string `yaml:"tenants"`
+}
+
+// EtcdTLSConfig contains TLS settings for connecting to etcd
+type EtcdTLSConfig struct {
+	Enabled            bool   `yaml:"enabled"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	CAFile             string `yaml:"ca_file"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// DNSConfig contains upstream DNS resolution configuration
+type DNSConfig struct {
+	Enabled     bool           `yaml:"enabled"`
+	Resolvers   []string       `yaml:"resolvers"`
+	CacheTTL    int            `yaml:"cache_ttl"`
+	NegativeTTL int            `yaml:"negative_ttl"`
+	Timeout     int            `yaml:"timeout"`
+	HostTTL     map[string]int `yaml:"host_ttl"`
+}
+
+// DialConfig contains upstream connection dialing configuration
+type DialConfig struct {
+	PreferIPVersion string `yaml:"prefer_ip_version"`
+	FallbackDelay   int    `yaml:"fallback_delay_ms"`
+	Timeout         int    `yaml:"timeout"`
+	KeepAlive       int    `yaml:"keep_alive"`
+	BindInterface   string `yaml:"bind_interface"`
+	SourceIP        string `yaml:"source_ip"`
+
+	// FailureTTL is how many milliseconds a failed connect to an address
+	// fails further connects to it at once, until one probe connects again.
+	// Off if 0.
+	FailureTTL int `yaml:"failure_ttl_ms"`
+}
+
+// Validate checks the address family preference, source address and
+// durations
+func (d *DialConfig) Validate() error {
+	switch d.PreferIPVersion {
+	case "", "ipv4", "ipv6":
+		// Valid preferences
+	default:
+		return fmt.Errorf("invalid prefer_ip_version: %s", d.PreferIPVersion)
+	}
+	if d.SourceIP != "" && net.ParseIP(d.SourceIP) == nil {
+		return fmt.Errorf("invalid source_ip: %s", d.SourceIP)
+	}
+	if d.Timeout < 0 || d.FallbackDelay < 0 {
+		return fmt.Errorf("timeout and fallback_delay_ms must not be negative")
+	}
+	if d.FailureTTL < 0 {
+		return fmt.Errorf("failure_ttl_ms must not be negative")
+	}
+	return nil
+}
+
+// HealthChecksConfig bounds the upstream health checks running at once and
+// spreads them over their interval
+type HealthChecksConfig struct {
+	Workers int     `yaml:"workers"` // Probes running at once
+	Jitter  float64 `yaml:"jitter"`  // Fraction of the interval each check moves by at random
+}
+
+// Validate checks the worker count and jitter
+func (c *HealthChecksConfig) Validate() error {
+	if c.Workers < 0 {
+		return fmt.Errorf("workers must not be negative")
+	}
+	if c.Jitter < 0 || c.Jitter >= 1 {
+		return fmt.Errorf("jitter must be at least 0 and less than 1")
+	}
+	return nil
+}
+
+// Validate checks a flag's name and rollout percentage
+func (f FeatureFlag) Validate(name string) error {
+	if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+		return fmt.Errorf("invalid flag name: %q", name)
+	}
+	if f.Percentage < 0 || f.Percentage > 100 {
+		return fmt.Errorf("flag %s percentage must be between 0 and 100", name)
+	}
+	return nil
+}
+
+// Merge returns a copy of the dial configuration with non-zero fields from override applied
+func (d DialConfig) Merge(override *DialConfig) DialConfig {
+	if override == nil {
+		return d
+	}
+	if override.PreferIPVersion != "" {
+		d.PreferIPVersion = override.PreferIPVersion
+	}
+	if override.FallbackDelay != 0 {
+		d.FallbackDelay = override.FallbackDelay
+	}
+	if override.Timeout != 0 {
+		d.Timeout = override.Timeout
+	}
+	if override.KeepAlive != 0 {
+		d.KeepAlive = override.KeepAlive
+	}
+	if override.BindInterface != "" {
+		d.BindInterface = override.BindInterface
+	}
+	if override.SourceIP != "" {
+		d.SourceIP = override.SourceIP
+	}
+	if override.FailureTTL != 0 {
+		d.FailureTTL = override.FailureTTL
+	}
+	return d
 }
 
 // LoadConfig loads configuration from a YAML file
@@ -199,10 +1180,117 @@ func parseConfig(data []byte) (*Config, error) {
 	// Replace environment variables in the format ${VAR_NAME}
 	data = replaceEnvVars(data)
 
-	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
+	deprecations, err := normalizeDocument(&doc)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if doc.Kind != 0 {
+		if err := doc.Decode(&config); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+	}
+	config.Deprecations = deprecations
+	if err := config.Dial.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid dial: %w", err)
+	}
+	if err := ValidateMiddlewareOrder(config.MiddlewareOrder); err != nil {
+		return nil, fmt.Errorf("invalid middleware_order: %w", err)
+	}
+	if err := config.Cors.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid cors: %w", err)
+	}
+	if config.Server.KeepAlive.MaxRequests < 0 || config.Server.KeepAlive.MaxAge < 0 {
+		return nil, fmt.Errorf("invalid server.keep_alive: max_requests and max_age must not be negative")
+	}
+	if strings.ContainsAny(config.Server.ResponseHeaders.Server+config.Server.ResponseHeaders.InstanceID, "\r\n") {
+		return nil, fmt.Errorf("invalid server.response_headers: server and instance_id must not contain line breaks")
+	}
+	switch config.ForwardedHeaders.Policy {
+	case "", ForwardedAppend, ForwardedReplace, ForwardedPreserve:
+	default:
+		return nil, fmt.Errorf("invalid forwarded_headers.policy: %s", config.ForwardedHeaders.Policy)
+	}
+	if err := config.Cache.PurgeAuth.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid cache.purge_auth: %w", err)
+	}
+	if config.Cache.PurgeAuth.Allows(PurgeAuthMTLS) && (!config.SPIFFE.Enabled || config.SPIFFE.InternalAddress == "") {
+		return nil, fmt.Errorf("invalid cache.purge_auth: mtls requires spiffe.internal_address")
+	}
+	if config.Cluster.Enabled && config.Cluster.SecretKey == "" {
+		return nil, fmt.Errorf("invalid cluster: secret_key is required to sign messages between gateways")
+	}
+	if err := config.Cache.Warm.Validate(config.Cache.IncludeHost); err != nil {
+		return nil, fmt.Errorf("invalid cache.warm: %w", err)
+	}
+	if _, err := config.Metrics.Prefixes(); err != nil {
+		return nil, fmt.Errorf("invalid metrics: %w", err)
+	}
+	if _, err := config.NetworkZones.Prefixes(); err != nil {
+		return nil, fmt.Errorf("invalid network_zones: %w", err)
+	}
+	if err := config.Auth.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid auth: %w", err)
+	}
+	if err := config.Auth.ValidationCache.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid auth.validation_cache: %w", err)
+	}
+	if err := config.Usage.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid usage: %w", err)
+	}
+	if err := config.Notifications.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid notifications: %w", err)
+	}
+	if err := config.SPIFFE.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid spiffe: %w", err)
+	}
+	if err := config.L4Proxy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid l4_proxy: %w", err)
+	}
+	if err := config.Certificates.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid certificates: %w", err)
+	}
+	if err := config.Portal.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid portal: %w", err)
+	}
+	if err := config.GRPC.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid grpc: %w", err)
+	}
+	if err := config.Reload.Rollback.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid reload.rollback: %w", err)
+	}
+	if err := config.HealthChecks.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid health_checks: %w", err)
+	}
+	if err := config.OPA.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid opa: %w", err)
+	}
+	if err := config.TestTraffic.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid test_traffic: %w", err)
+	}
+	if err := config.FieldEncryption.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid field_encryption: %w", err)
+	}
+	if err := config.Logging.AccessLog.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid logging.access_log: %w", err)
+	}
+	for name, limit := range config.RateLimits {
+		if limit.Requests <= 0 {
+			return nil, fmt.Errorf("invalid rate_limits: %s requires a positive requests", name)
+		}
+		if err := limit.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid rate_limits: %s: %w", name, err)
+		}
+	}
+	for name, flag := range config.FeatureFlags.Flags {
+		if err := flag.Validate(name); err != nil {
+			return nil, fmt.Errorf("invalid feature_flags: %w", err)
+		}
+	}
 
 	// Set defaults
 	setConfigDefaults(&config)
@@ -225,6 +1313,49 @@ func setConfigDefaults(config *Config) {
 	if config.Server.MaxHeaderBytes == 0 {
 		config.Server.MaxHeaderBytes = 1 << 20 // Default max header bytes (1MB)
 	}
+	if config.Server.SlowClient.GracePeriod == 0 {
+		config.Server.SlowClient.GracePeriod = 5
+	}
+	if config.Server.SlowClient.MinReadRate == 0 {
+		config.Server.SlowClient.MinReadRate = 240
+	}
+	if config.Server.SlowClient.MinWriteRate == 0 {
+		config.Server.SlowClient.MinWriteRate = 240
+	}
+
+	// Logging defaults
+	if config.Logging.AccessLog.SampleRate == 0 {
+		config.Logging.AccessLog.SampleRate = 1 // Default to logging every request
+	}
+	if config.Logging.AccessLog.MinErrorStatus == 0 {
+		config.Logging.AccessLog.MinErrorStatus = 500
+	}
+	if config.Logging.AccessLog.DebugHeader == "" {
+		config.Logging.AccessLog.DebugHeader = "X-Debug-Log"
+	}
+	redaction := &config.Logging.AccessLog.Redaction
+	if redaction.QueryParams == nil {
+		redaction.QueryParams = []string{"access_token", "api_key", "apikey", "key", "password", "secret", "token"}
+	}
+	if redaction.Headers == nil {
+		redaction.Headers = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-API-Key"}
+	}
+	if redaction.BodyFields == nil {
+		redaction.BodyFields = []string{"password", "secret", "token", "access_token", "refresh_token", "api_key"}
+	}
+	if redaction.Patterns == nil {
+		redaction.Patterns = []RedactionPattern{
+			{Name: "email", Regex: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`},
+			{Name: "bearer", Regex: `(?i)bearer\s+[A-Za-z0-9._~+/=-]+`},
+			{Name: "jwt", Regex: `eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`},
+		}
+	}
+	if redaction.Replacement == "" {
+		redaction.Replacement = "[REDACTED]"
+	}
+	if config.Logging.LevelEndpoint == "" {
+		config.Logging.LevelEndpoint = "/admin/log/level"
+	}
 
 	// Auth defaults
 	if config.Auth.JWTHeader == "" {
@@ -233,6 +1364,21 @@ func setConfigDefaults(config *Config) {
 	if config.Auth.APIKeyHeader == "" {
 		config.Auth.APIKeyHeader = "X-API-Auth-Token"
 	}
+	if config.Auth.JWKSRefreshInterval == 0 {
+		config.Auth.JWKSRefreshInterval = 300
+	}
+	if config.Auth.ValidationCache.MaxEntries == 0 {
+		config.Auth.ValidationCache.MaxEntries = 10000
+	}
+	if config.Auth.ValidationCache.TTL == 0 {
+		config.Auth.ValidationCache.TTL = 60
+	}
+	if config.Auth.ValidationCache.Redis.KeyPrefix == "" {
+		config.Auth.ValidationCache.Redis.KeyPrefix = "gateway:apikey:"
+	}
+	if config.Auth.ValidationCache.Redis.Timeout == 0 {
+		config.Auth.ValidationCache.Redis.Timeout = 100
+	}
 
 	// Cache defaults
 	if config.Cache.DefaultTTL == 0 {
@@ -247,6 +1393,120 @@ func setConfigDefaults(config *Config) {
 	if len(config.Cache.VaryHeaders) == 0 {
 		config.Cache.VaryHeaders = []string{"Accept", "Accept-Encoding"}
 	}
+	if config.Cache.Persistence.Path == "" {
+		config.Cache.Persistence.Path = "data/cache.snapshot"
+	}
+	if config.Cache.Persistence.SnapshotInterval == 0 {
+		config.Cache.Persistence.SnapshotInterval = 60 // Default snapshot every 60 seconds
+	}
+	if config.Etcd.DialTimeout == 0 {
+		config.Etcd.DialTimeout = 5 // Default etcd dial timeout of 5 seconds
+	}
+	if config.Etcd.RequestTimeout == 0 {
+		config.Etcd.RequestTimeout = 3 // Default etcd request timeout of 3 seconds
+	}
+	if config.Cluster.BindAddress == "" {
+		config.Cluster.BindAddress = ":7946"
+	}
+	if config.Cluster.GossipInterval == 0 {
+		config.Cluster.GossipInterval = 1 // Default gossip every second
+	}
+	if config.Cluster.SuspectTimeout == 0 {
+		config.Cluster.SuspectTimeout = 5
+	}
+	if config.Cluster.DeadTimeout == 0 {
+		config.Cluster.DeadTimeout = 30
+	}
+	if config.Cluster.Fanout == 0 {
+		config.Cluster.Fanout = 3
+	}
+	if config.Cluster.BreakerStateTTL == 0 {
+		config.Cluster.BreakerStateTTL = 10
+	}
+	if config.SLO.EvaluationInterval == 0 {
+		config.SLO.EvaluationInterval = 30 // Default evaluation every 30 seconds
+	}
+	if config.SLO.WebhookTimeoutMs == 0 {
+		config.SLO.WebhookTimeoutMs = 2000
+	}
+	if len(config.Debug.AllowedRoles) == 0 {
+		config.Debug.AllowedRoles = []string{"admin"}
+	}
+	if config.Reload.Rollback.Enabled {
+		config.Reload.Rollback.SetDefaults()
+	}
+	if config.Reload.WebhookTimeoutMs == 0 {
+		config.Reload.WebhookTimeoutMs = 2000
+	}
+	if config.ForwardedHeaders.Policy == "" {
+		config.ForwardedHeaders.Policy = ForwardedAppend
+	}
+	if config.Usage.FlushInterval == 0 {
+		config.Usage.FlushInterval = 60
+	}
+	if config.Usage.TimeoutMs == 0 {
+		config.Usage.TimeoutMs = 5000
+	}
+	if config.Notifications.DedupWindow == 0 {
+		config.Notifications.DedupWindow = 300
+	}
+	if config.Notifications.MaxRetries == 0 {
+		config.Notifications.MaxRetries = 3
+	}
+	if config.Notifications.RetryBackoffMs == 0 {
+		config.Notifications.RetryBackoffMs = 1000
+	}
+	if config.Notifications.TimeoutMs == 0 {
+		config.Notifications.TimeoutMs = 5000
+	}
+	if config.SPIFFE.SocketPath == "" {
+		config.SPIFFE.SocketPath = "unix:///run/spire/sockets/agent.sock"
+	}
+	for i := range config.L4Proxy.Listeners {
+		config.L4Proxy.Listeners[i].setDefaults()
+	}
+	if config.Certificates.CheckInterval == 0 {
+		config.Certificates.CheckInterval = 60 * 60
+	}
+	if len(config.Certificates.WarningDays) == 0 {
+		config.Certificates.WarningDays = []int{30, 14, 7}
+	}
+	if config.Portal.PathPrefix == "" {
+		config.Portal.PathPrefix = "/portal"
+	}
+	if config.Portal.VerificationTTL == 0 {
+		config.Portal.VerificationTTL = 24 * 60 * 60
+	}
+	if config.Portal.SignupsPerHour == 0 {
+		config.Portal.SignupsPerHour = 5
+	}
+	if config.Portal.KeyRole == "" {
+		config.Portal.KeyRole = "developer"
+	}
+	if config.FeatureFlags.HeaderPrefix == "" {
+		config.FeatureFlags.HeaderPrefix = "X-Feature-"
+	}
+	if config.FeatureFlags.UserClaim == "" {
+		config.FeatureFlags.UserClaim = "sub"
+	}
+	if config.FeatureFlags.TenantClaim == "" {
+		config.FeatureFlags.TenantClaim = "tenant"
+	}
+	if config.Cache.Directives.Header == "" {
+		config.Cache.Directives.Header = "X-Gateway-Cache"
+	}
+	if len(config.Cache.Directives.AllowedRoles) == 0 {
+		config.Cache.Directives.AllowedRoles = config.Debug.AllowedRoles
+	}
+	if config.Cache.Warm.Endpoint == "" {
+		config.Cache.Warm.Endpoint = "/admin/cache/warm"
+	}
+	if config.Cache.Warm.Concurrency == 0 {
+		config.Cache.Warm.Concurrency = 4 // Default of 4 concurrent warm requests
+	}
+	if config.Cache.Warm.MaxPaths == 0 {
+		config.Cache.Warm.MaxPaths = defaultWarmMaxPaths
+	}
 
 	// CORS defaults
 	if len(config.Cors.AllowedMethods) == 0 {
@@ -261,6 +1521,9 @@ func setConfigDefaults(config *Config) {
 	if config.Cors.MaxAge == 0 {
 		config.Cors.MaxAge = 86400 // Default max age of 24 hours
 	}
+	if config.Cors.OriginCacheSize == 0 {
+		config.Cors.OriginCacheSize = 1024 // Default of 1024 cached origin decisions
+	}
 
 	// Security defaults
 	if config.Security.HSTSMaxAge == 0 {
@@ -269,12 +1532,48 @@ func setConfigDefaults(config *Config) {
 	if config.Security.MaxBodySize == 0 {
 		config.Security.MaxBodySize = 10 << 20 // Default max body size of 10MB
 	}
+	if len(config.Security.ClientBreaker.Statuses) == 0 {
+		config.Security.ClientBreaker.Statuses = []int{401, 403}
+	}
+	if config.Security.ClientBreaker.Threshold == 0 {
+		config.Security.ClientBreaker.Threshold = 20
+	}
+	if config.Security.ClientBreaker.Window == 0 {
+		config.Security.ClientBreaker.Window = 60
+	}
+	if config.Security.ClientBreaker.BlockFor == 0 {
+		config.Security.ClientBreaker.BlockFor = 300
+	}
+	if config.Security.ClientBreaker.MaxClients == 0 {
+		config.Security.ClientBreaker.MaxClients = 100000
+	}
+	if len(config.Security.StripHeaders.Headers) == 0 {
+		config.Security.StripHeaders.Headers = []string{
+			"X-Gateway-Proxy", "X-Client-Geo-Country", "X-Authenticated-User", "X-User-ID", "X-User-Role",
+		}
+	}
 
 	// Metrics defaults
 	if config.Metrics.Endpoint == "" {
 		config.Metrics.Endpoint = "/metrics"
 	}
 
+	if config.Metrics.StatsD.Address == "" {
+		config.Metrics.StatsD.Address = "127.0.0.1:8125"
+	}
+	if config.Metrics.StatsD.Flavor == "" {
+		config.Metrics.StatsD.Flavor = StatsDFlavorDogStatsD
+	}
+	if config.Metrics.StatsD.Prefix == "" {
+		config.Metrics.StatsD.Prefix = "gateway"
+	}
+	if config.Metrics.StatsD.FlushInterval == 0 {
+		config.Metrics.StatsD.FlushInterval = 10 // Default flush every 10 seconds
+	}
+	if config.Metrics.StatsD.MaxPacketSize == 0 {
+		config.Metrics.StatsD.MaxPacketSize = 1432 // Fits an Ethernet MTU
+	}
+
 	// Tracing defaults
 	if config.Tracing.Provider == "" {
 		config.Tracing.Provider = "jaeger"
@@ -285,6 +1584,49 @@ func setConfigDefaults(config *Config) {
 	if config.Tracing.SampleRate == 0 {
 		config.Tracing.SampleRate = 0.1 // Default sample rate of 10%
 	}
+
+	// DNS defaults
+	if config.DNS.CacheTTL == 0 {
+		config.DNS.CacheTTL = 30 // Default positive cache TTL of 30 seconds
+	}
+	if config.DNS.NegativeTTL == 0 {
+		config.DNS.NegativeTTL = 5 // Default negative cache TTL of 5 seconds
+	}
+	if config.DNS.Timeout == 0 {
+		config.DNS.Timeout = 5 // Default resolver timeout of 5 seconds
+	}
+
+	// Dial defaults
+	if config.Dial.Timeout == 0 {
+		config.Dial.Timeout = 30 // Default connect timeout of 30 seconds
+	}
+	if config.Dial.KeepAlive == 0 {
+		config.Dial.KeepAlive = 30 // Default TCP keep-alive period of 30 seconds
+	}
+	if config.Dial.FallbackDelay == 0 {
+		config.Dial.FallbackDelay = 300 // Default Happy Eyeballs fallback delay of 300ms
+	}
+
+	// Test traffic defaults
+	for i := range config.OPA.Bundles {
+		if config.OPA.Bundles[i].PollInterval == 0 {
+			config.OPA.Bundles[i].PollInterval = 60 // Default bundle server poll interval of a minute
+		}
+	}
+	if config.TestTraffic.Header == "" {
+		config.TestTraffic.Header = "X-Test-Traffic"
+	}
+	if config.TestTraffic.MaxAge == 0 {
+		config.TestTraffic.MaxAge = 86400 // Default token lifetime of up to a day
+	}
+
+	// Health check scheduling defaults
+	if config.HealthChecks.Workers == 0 {
+		config.HealthChecks.Workers = 16 // Default of 16 probes at once
+	}
+	if config.HealthChecks.Jitter == 0 {
+		config.HealthChecks.Jitter = 0.1 // Default jitter of 10% of the interval
+	}
 }
 
 // replaceEnvVars replaces environment variables in the format ${VAR_NAME} with their values
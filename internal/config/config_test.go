@@ -174,6 +174,20 @@ auth:
 `
 	_, err = parseConfig([]byte(invalidConfig))
 	assert.Error(t, err)
+
+	// Test unknown middleware in middleware_order
+	_, err = parseConfig([]byte("middleware_order: [auth, gzip]\n"))
+	assert.ErrorContains(t, err, "unknown middleware: gzip")
+
+	// Test invalid CORS origins
+	_, err = parseConfig([]byte("cors:\n  allowed_origins: [\"https://app.*.example.com\"]\n"))
+	assert.ErrorContains(t, err, "invalid cors")
+	_, err = parseConfig([]byte("cors:\n  allowed_origin_patterns: [\"(\"]\n"))
+	assert.ErrorContains(t, err, "invalid cors")
+
+	// Test invalid reload rollback guard
+	_, err = parseConfig([]byte("reload:\n  rollback:\n    enabled: true\n    max_error_rate: 150\n"))
+	assert.ErrorContains(t, err, "invalid reload.rollback")
 }
 
 func TestSetConfigDefaults(t *testing.T) {
@@ -186,6 +200,15 @@ func TestSetConfigDefaults(t *testing.T) {
 	assert.Equal(t, 30, emptyConfig.Server.WriteTimeout)
 	assert.Equal(t, 120, emptyConfig.Server.IdleTimeout)
 	assert.Equal(t, 1<<20, emptyConfig.Server.MaxHeaderBytes)
+	assert.Equal(t, 5, emptyConfig.Server.SlowClient.GracePeriod)
+	assert.Equal(t, 240, emptyConfig.Server.SlowClient.MinReadRate)
+	assert.Equal(t, 240, emptyConfig.Server.SlowClient.MinWriteRate)
+
+	// Check logging defaults
+	assert.Equal(t, 1, emptyConfig.Logging.AccessLog.SampleRate)
+	assert.Equal(t, 500, emptyConfig.Logging.AccessLog.MinErrorStatus)
+	assert.Equal(t, "X-Debug-Log", emptyConfig.Logging.AccessLog.DebugHeader)
+	assert.Equal(t, "/admin/log/level", emptyConfig.Logging.LevelEndpoint)
 
 	// Check auth defaults
 	assert.Equal(t, "Authorization", emptyConfig.Auth.JWTHeader)
@@ -196,11 +219,26 @@ func TestSetConfigDefaults(t *testing.T) {
 	assert.Equal(t, 3600, emptyConfig.Cache.MaxTTL)
 	assert.Equal(t, 1000, emptyConfig.Cache.MaxSize)
 	assert.Equal(t, []string{"Accept", "Accept-Encoding"}, emptyConfig.Cache.VaryHeaders)
+	assert.Equal(t, "data/cache.snapshot", emptyConfig.Cache.Persistence.Path)
+	assert.Equal(t, 60, emptyConfig.Cache.Persistence.SnapshotInterval)
+	assert.Equal(t, ":7946", emptyConfig.Cluster.BindAddress)
+	assert.Equal(t, 1, emptyConfig.Cluster.GossipInterval)
+	assert.Equal(t, 5, emptyConfig.Cluster.SuspectTimeout)
+	assert.Equal(t, 30, emptyConfig.Cluster.DeadTimeout)
+	assert.Equal(t, 3, emptyConfig.Cluster.Fanout)
+	assert.Equal(t, 5, emptyConfig.Etcd.DialTimeout)
+	assert.Equal(t, 3, emptyConfig.Etcd.RequestTimeout)
+	assert.Equal(t, 30, emptyConfig.SLO.EvaluationInterval)
+	assert.Equal(t, []string{"admin"}, emptyConfig.Debug.AllowedRoles)
+	assert.Equal(t, 2000, emptyConfig.SLO.WebhookTimeoutMs)
+	assert.Equal(t, "/admin/cache/warm", emptyConfig.Cache.Warm.Endpoint)
+	assert.Equal(t, 4, emptyConfig.Cache.Warm.Concurrency)
 
 	// Check CORS defaults
 	assert.Equal(t, []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}, emptyConfig.Cors.AllowedMethods)
 	assert.Contains(t, emptyConfig.Cors.AllowedHeaders, "Authorization")
 	assert.Equal(t, 86400, emptyConfig.Cors.MaxAge)
+	assert.Equal(t, 1024, emptyConfig.Cors.OriginCacheSize)
 
 	// Check security defaults
 	assert.Equal(t, 31536000, emptyConfig.Security.HSTSMaxAge)
@@ -208,12 +246,27 @@ func TestSetConfigDefaults(t *testing.T) {
 
 	// Check metrics defaults
 	assert.Equal(t, "/metrics", emptyConfig.Metrics.Endpoint)
+	assert.Equal(t, "127.0.0.1:8125", emptyConfig.Metrics.StatsD.Address)
+	assert.Equal(t, StatsDFlavorDogStatsD, emptyConfig.Metrics.StatsD.Flavor)
+	assert.Equal(t, "gateway", emptyConfig.Metrics.StatsD.Prefix)
+	assert.Equal(t, 10, emptyConfig.Metrics.StatsD.FlushInterval)
+	assert.Equal(t, 1432, emptyConfig.Metrics.StatsD.MaxPacketSize)
 
 	// Check tracing defaults
 	assert.Equal(t, "jaeger", emptyConfig.Tracing.Provider)
 	assert.Equal(t, "api-gateway", emptyConfig.Tracing.ServiceName)
 	assert.Equal(t, 0.1, emptyConfig.Tracing.SampleRate)
 
+	// Check DNS defaults
+	assert.Equal(t, 30, emptyConfig.DNS.CacheTTL)
+	assert.Equal(t, 5, emptyConfig.DNS.NegativeTTL)
+	assert.Equal(t, 5, emptyConfig.DNS.Timeout)
+
+	// Check dial defaults
+	assert.Equal(t, 30, emptyConfig.Dial.Timeout)
+	assert.Equal(t, 30, emptyConfig.Dial.KeepAlive)
+	assert.Equal(t, 300, emptyConfig.Dial.FallbackDelay)
+
 	// Test with some values already set
 	configWithValues := &Config{
 		Server: ServerConfig{
@@ -238,6 +291,44 @@ func TestSetConfigDefaults(t *testing.T) {
 	assert.Equal(t, "X-API-Auth-Token", configWithValues.Auth.APIKeyHeader)
 }
 
+func TestDialConfigMerge(t *testing.T) {
+	global := DialConfig{
+		PreferIPVersion: "ipv6",
+		FallbackDelay:   300,
+		Timeout:         30,
+		KeepAlive:       30,
+	}
+
+	// No override returns the global settings unchanged
+	assert.Equal(t, global, global.Merge(nil))
+
+	merged := global.Merge(&DialConfig{
+		PreferIPVersion: "ipv4",
+		SourceIP:        "10.0.0.5",
+		FailureTTL:      2000,
+	})
+	assert.Equal(t, "ipv4", merged.PreferIPVersion)
+	assert.Equal(t, "10.0.0.5", merged.SourceIP)
+	assert.Equal(t, 300, merged.FallbackDelay)
+	assert.Equal(t, 30, merged.Timeout)
+	assert.Equal(t, 2000, merged.FailureTTL)
+
+	// The original is not modified
+	assert.Equal(t, "ipv6", global.PreferIPVersion)
+
+	_, err := parseConfig([]byte("dial:\n  failure_ttl_ms: -1\n"))
+	assert.EqualError(t, err, "invalid dial: failure_ttl_ms must not be negative")
+
+	_, err = parseConfig([]byte("dial:\n  prefer_ip_version: ipv5\n"))
+	assert.EqualError(t, err, "invalid dial: invalid prefer_ip_version: ipv5")
+
+	_, err = parseConfig([]byte("dial:\n  source_ip: nope\n"))
+	assert.EqualError(t, err, "invalid dial: invalid source_ip: nope")
+
+	_, err = parseConfig([]byte("dial:\n  timeout: -1\n"))
+	assert.EqualError(t, err, "invalid dial: timeout and fallback_delay_ms must not be negative")
+}
+
 func TestReplaceEnvVars(t *testing.T) {
 	// Set some environment variables for testing
 	os.Setenv("TEST_HOST", "localhost")
@@ -261,3 +352,355 @@ auth:
 	// TEST_SECRET is not set, so it should remain as is (we don't have full templating)
 	assert.Contains(t, string(replacedConfig), "${TEST_SECRET:-default-secret}")
 }
+
+func TestGRPCErrorStatuses(t *testing.T) {
+	cfg, err := parseConfig([]byte(`
+grpc:
+  error_statuses:
+    FAILED_PRECONDITION: 412
+`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]int{"FAILED_PRECONDITION": 412}, cfg.GRPC.ErrorStatuses)
+	}
+
+	_, err = parseConfig([]byte(`
+grpc:
+  error_statuses:
+    MISSING: 404
+`))
+	assert.ErrorContains(t, err, "unknown gRPC code: MISSING")
+
+	_, err = parseConfig([]byte(`
+grpc:
+  error_statuses:
+    NOT_FOUND: 42
+`))
+	assert.ErrorContains(t, err, "NOT_FOUND has invalid HTTP status 42")
+}
+
+func TestGRPCDescriptors(t *testing.T) {
+	cfg, err := parseConfig([]byte(`
+grpc:
+  descriptors:
+    dir: /etc/gateway/descriptors
+    reload_interval: 10
+`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, GRPCDescriptors{Dir: "/etc/gateway/descriptors", ReloadInterval: 10}, cfg.GRPC.Descriptors)
+	}
+
+	_, err = parseConfig([]byte(`
+grpc:
+  descriptors:
+    reload_interval: -1
+`))
+	assert.ErrorContains(t, err, "invalid grpc: descriptors.reload_interval must not be negative")
+}
+
+func TestForwardedHeadersPolicy(t *testing.T) {
+	cfg, err := parseConfig([]byte("server:\n  address: \":8080\"\n"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, ForwardedAppend, cfg.ForwardedHeaders.Policy)
+	}
+
+	_, err = parseConfig([]byte("forwarded_headers:\n  policy: trust\n"))
+	assert.ErrorContains(t, err, "invalid forwarded_headers.policy: trust")
+}
+
+func TestPortalConfig(t *testing.T) {
+	cfg, err := parseConfig([]byte(`
+portal:
+  enabled: true
+  public_url: "https://api.example.com"
+  verification_webhook: "https://mailer.internal/verify"
+`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/portal", cfg.Portal.PathPrefix)
+		assert.Equal(t, 86400, cfg.Portal.VerificationTTL)
+		assert.Equal(t, "developer", cfg.Portal.KeyRole)
+	}
+
+	_, err = parseConfig([]byte("portal:\n  enabled: true\n  verification_webhook: \"https://mailer.internal/verify\"\n"))
+	assert.ErrorContains(t, err, "invalid portal: public_url must be an absolute URL")
+}
+
+func TestUsageConfig(t *testing.T) {
+	cfg, err := parseConfig([]byte("usage:\n  enabled: true\n  sink: csv\n  file: data/usage.csv\n"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 60, cfg.Usage.FlushInterval)
+		assert.Equal(t, 5000, cfg.Usage.TimeoutMs)
+	}
+
+	_, err = parseConfig([]byte("usage:\n  enabled: true\n  sink: kafka\n  kafka:\n    rest_url: http://kafka-rest:8082\n"))
+	assert.ErrorContains(t, err, "invalid usage: the kafka sink requires an absolute kafka.rest_url and a topic")
+
+	_, err = parseConfig([]byte("usage:\n  enabled: true\n  sink: s3\n"))
+	assert.ErrorContains(t, err, "invalid usage: invalid sink: s3")
+}
+
+func TestNotificationsConfig(t *testing.T) {
+	cfg, err := parseConfig([]byte("notifications:\n  enabled: true\n  webhooks:\n    - url: https://hooks.slack.com/services/T/B/X\n      events: [circuit_breaker_opened]\n"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 300, cfg.Notifications.DedupWindow)
+		assert.Equal(t, 3, cfg.Notifications.MaxRetries)
+	}
+
+	_, err = parseConfig([]byte("notifications:\n  enabled: true\n"))
+	assert.ErrorContains(t, err, "invalid notifications: at least one webhook is required")
+
+	_, err = parseConfig([]byte("notifications:\n  enabled: true\n  webhooks:\n    - url: https://hooks.example.com\n      events: [disk_full]\n"))
+	assert.ErrorContains(t, err, "invalid notifications: webhook at index 0: unknown event: disk_full")
+}
+
+func TestCertificatesConfig(t *testing.T) {
+	cfg, err := parseConfig([]byte("auth:\n  jwt_secret: test\n"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3600, cfg.Certificates.CheckInterval)
+		assert.Equal(t, []int{30, 14, 7}, cfg.Certificates.WarningDays)
+	}
+
+	_, err = parseConfig([]byte("certificates:\n  warning_days: [14, 0]\n"))
+	assert.ErrorContains(t, err, "invalid certificates: warning_days must be positive")
+}
+
+func TestSPIFFEConfig(t *testing.T) {
+	cfg, err := parseConfig([]byte("spiffe:\n  enabled: true\n"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "unix:///run/spire/sockets/agent.sock", cfg.SPIFFE.SocketPath)
+	}
+
+	_, err = parseConfig([]byte("spiffe:\n  enabled: true\n  socket_path: /run/spire/agent.sock\n"))
+	assert.ErrorContains(t, err, "invalid spiffe: socket_path must be a unix:// or tcp:// address")
+
+	_, err = parseConfig([]byte("spiffe:\n  enabled: true\n  allowed_ids: [\"spiffe://example.org:8443/billing\"]\n"))
+	assert.ErrorContains(t, err, "invalid spiffe: invalid allowed_ids entry")
+
+	assert.True(t, ValidSPIFFEID("spiffe://example.org/ns/payments/sa/api"))
+	assert.False(t, ValidSPIFFEID("spiffe:///payments"))
+}
+
+func TestValidationCacheConfig(t *testing.T) {
+	cfg, err := parseConfig([]byte("auth:\n  validation_cache:\n    enabled: true\n"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 10000, cfg.Auth.ValidationCache.MaxEntries)
+		assert.Equal(t, 60, cfg.Auth.ValidationCache.TTL)
+		assert.Equal(t, "gateway:apikey:", cfg.Auth.ValidationCache.Redis.KeyPrefix)
+	}
+
+	_, err = parseConfig([]byte("auth:\n  validation_cache:\n    enabled: true\n    redis:\n      enabled: true\n"))
+	assert.ErrorContains(t, err, "invalid auth.validation_cache: redis requires an address")
+}
+
+func TestL4ProxyConfig(t *testing.T) {
+	cfg, err := parseConfig([]byte(`
+l4_proxy:
+  enabled: true
+  listeners:
+    - name: postgres
+      address: ":5432"
+      upstream: "db:5432"
+    - name: dns
+      protocol: udp
+      address: ":53"
+      load_balancing:
+        method: round_robin
+        endpoints: ["10.0.0.1:53", "10.0.0.2:53"]
+        health_check_config:
+          type: http
+`))
+	if assert.NoError(t, err) {
+		postgres := cfg.L4Proxy.Listeners[0]
+		assert.Equal(t, L4ProtocolTCP, postgres.Protocol)
+		assert.Equal(t, 5000, postgres.ConnectTimeout)
+		assert.Equal(t, 300, postgres.IdleTimeout)
+		assert.Equal(t, []string{"db:5432"}, postgres.LoadBalancing.Endpoints)
+		assert.Equal(t, HealthCheckTCP, postgres.LoadBalancing.HealthCheckConfig.Type)
+
+		dns := cfg.L4Proxy.Listeners[1]
+		assert.Equal(t, 60, dns.IdleTimeout)
+		assert.Equal(t, "http", dns.LoadBalancing.HealthCheckConfig.Scheme)
+	}
+
+	_, err = parseConfig([]byte("l4_proxy:\n  enabled: true\n  listeners:\n    - name: db\n      address: \":5432\"\n"))
+	assert.ErrorContains(t, err, "invalid l4_proxy: listener db: upstream or load_balancing.endpoints is required")
+
+	_, err = parseConfig([]byte("l4_proxy:\n  enabled: true\n  listeners:\n    - name: db\n      address: \":5432\"\n      upstream: \"tcp://db:5432\"\n"))
+	assert.ErrorContains(t, err, "invalid upstream endpoint")
+
+	_, err = parseConfig([]byte("l4_proxy:\n  enabled: true\n  listeners:\n    - name: db\n      protocol: sctp\n      address: \":5432\"\n      upstream: \"db:5432\"\n"))
+	assert.ErrorContains(t, err, "invalid protocol: sctp")
+
+	_, err = parseConfig([]byte("l4_proxy:\n  enabled: true\n  listeners:\n    - name: db\n      address: \":5432\"\n      upstream: \"db:5432\"\n    - name: db\n      address: \":5433\"\n      upstream: \"db:5432\"\n"))
+	assert.ErrorContains(t, err, "duplicate listener name: db")
+}
+
+func TestResponseHeadersConfig(t *testing.T) {
+	cfg, err := parseConfig([]byte("server:\n  response_headers:\n    enabled: true\n    served_by: true\n    instance_id: gw-eu-1\n"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "gw-eu-1", cfg.Server.ResponseHeaders.InstanceID)
+	}
+
+	_, err = parseConfig([]byte("server:\n  response_headers:\n    server: \"gateway\\r\\nX-Injected: 1\"\n"))
+	assert.ErrorContains(t, err, "invalid server.response_headers")
+}
+
+func TestHealthChecksConfig(t *testing.T) {
+	cfg, err := parseConfig([]byte("server:\n  address: \":8080\"\n"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 16, cfg.HealthChecks.Workers)
+		assert.Equal(t, 0.1, cfg.HealthChecks.Jitter)
+	}
+
+	cfg, err = parseConfig([]byte("health_checks:\n  workers: 4\n  jitter: 0.25\n"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 4, cfg.HealthChecks.Workers)
+		assert.Equal(t, 0.25, cfg.HealthChecks.Jitter)
+	}
+
+	_, err = parseConfig([]byte("health_checks:\n  workers: -1\n"))
+	assert.ErrorContains(t, err, "invalid health_checks: workers")
+	_, err = parseConfig([]byte("health_checks:\n  jitter: 1\n"))
+	assert.ErrorContains(t, err, "invalid health_checks: jitter")
+}
+
+func TestTestTrafficConfig(t *testing.T) {
+	cfg, err := parseConfig([]byte("test_traffic:\n  enabled: true\n  secret: s3cret\n"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "X-Test-Traffic", cfg.TestTraffic.Header)
+		assert.Equal(t, 86400, cfg.TestTraffic.MaxAge)
+	}
+
+	_, err = parseConfig([]byte("test_traffic:\n  enabled: true\n"))
+	assert.ErrorContains(t, err, "invalid test_traffic: secret is required")
+	_, err = parseConfig([]byte("test_traffic:\n  enabled: true\n  secret: s3cret\n  max_age: -1\n"))
+	assert.ErrorContains(t, err, "invalid test_traffic: max_age")
+}
+
+func TestOPAEngineConfig(t *testing.T) {
+	cfg, err := parseConfig([]byte("opa:\n  bundles:\n    - name: authz\n      url: https://bundles.example.com/authz.tar.gz\n    - name: local\n      path: policies\n"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 60, cfg.OPA.Bundles[0].PollInterval)
+	}
+
+	for yaml, want := range map[string]string{
+		"opa:\n  bundles:\n    - path: policies\n":                                          "bundle name is required",
+		"opa:\n  bundles:\n    - {name: a, path: p}\n    - {name: a, path: q}\n":            "duplicate bundle: a",
+		"opa:\n  bundles:\n    - name: a\n":                                                 "exactly one of path and url",
+		"opa:\n  bundles:\n    - {name: a, path: p, url: 'https://b/a.tar.gz'}\n":           "exactly one of path and url",
+		"opa:\n  bundles:\n    - {name: a, url: 'ftp://b/a.tar.gz'}\n":                      "invalid url",
+		"opa:\n  bundles:\n    - {name: a, url: 'https://b/a.tar.gz', poll_interval: -1}\n": "poll_interval",
+	} {
+		_, err := parseConfig([]byte(yaml))
+		assert.ErrorContains(t, err, "invalid opa: ")
+		assert.ErrorContains(t, err, want)
+	}
+}
+
+func TestFieldEncryptionConfig(t *testing.T) {
+	cfg, err := parseConfig([]byte("field_encryption:\n  keys:\n    pii: \"AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=\"\n"))
+	if assert.NoError(t, err) {
+		assert.Len(t, cfg.FieldEncryption.Keys, 1)
+	}
+
+	_, err = parseConfig([]byte("field_encryption:\n  keys:\n    pii: \"c2hvcnQ=\"\n"))
+	assert.ErrorContains(t, err, "invalid field_encryption: key pii must be 32 bytes in base64")
+}
+
+func TestAccessLogRedactionConfig(t *testing.T) {
+	cfg, err := parseConfig([]byte("logging:\n  access_log:\n    log_query: true\n"))
+	if assert.NoError(t, err) {
+		redaction := cfg.Logging.AccessLog.Redaction
+		assert.Contains(t, redaction.QueryParams, "access_token")
+		assert.Contains(t, redaction.Headers, "Authorization")
+		assert.Contains(t, redaction.BodyFields, "password")
+		assert.Len(t, redaction.Patterns, 3)
+		assert.Equal(t, "[REDACTED]", redaction.Replacement)
+	}
+
+	// Explicitly empty lists turn the defaults off
+	cfg, err = parseConfig([]byte("logging:\n  access_log:\n    redaction:\n      patterns: []\n"))
+	if assert.NoError(t, err) {
+		assert.Empty(t, cfg.Logging.AccessLog.Redaction.Patterns)
+	}
+
+	_, err = parseConfig([]byte("logging:\n  access_log:\n    redaction:\n      patterns:\n        - name: broken\n          regex: \"[a-\"\n"))
+	assert.ErrorContains(t, err, "invalid logging.access_log: redaction.patterns[0]")
+	_, err = parseConfig([]byte("logging:\n  access_log:\n    log_body_bytes: -1\n"))
+	assert.ErrorContains(t, err, "invalid logging.access_log: log_body_bytes")
+}
+
+func TestEndpointAccessConfig(t *testing.T) {
+	cfg, err := parseConfig([]byte(`
+cache:
+  purge_auth:
+    methods: [admin, mtls]
+    allowed_ids: ["spiffe://example.org/ops"]
+spiffe:
+  enabled: true
+  internal_address: ":8443"
+metrics:
+  allowed_cidrs: ["10.0.0.0/8", "::1"]
+`))
+	if assert.NoError(t, err) {
+		assert.True(t, cfg.Cache.PurgeAuth.Allows(PurgeAuthMTLS))
+		prefixes, err := cfg.Metrics.Prefixes()
+		assert.NoError(t, err)
+		assert.Equal(t, "::1/128", prefixes[1].String())
+	}
+
+	_, err = parseConfig([]byte("cache:\n  purge_auth:\n    methods: [basic]\n"))
+	assert.ErrorContains(t, err, "invalid cache.purge_auth: unknown method: basic")
+
+	_, err = parseConfig([]byte("cache:\n  purge_auth:\n    methods: [mtls]\n"))
+	assert.ErrorContains(t, err, "invalid cache.purge_auth: mtls requires spiffe.internal_address")
+
+	_, err = parseConfig([]byte("cache:\n  purge_auth:\n    allowed_ids: [ops]\n"))
+	assert.ErrorContains(t, err, "invalid cache.purge_auth: invalid allowed_ids entry: ops")
+
+	_, err = parseConfig([]byte("metrics:\n  allowed_cidrs: [\"10.0.0.0/33\"]\n"))
+	assert.ErrorContains(t, err, "invalid metrics: invalid allowed_cidrs entry: 10.0.0.0/33")
+
+	_, err = parseConfig([]byte("network_zones:\n  internal_cidrs: [internal]\n"))
+	assert.ErrorContains(t, err, "invalid network_zones: invalid internal_cidrs entry: internal")
+}
+
+func TestCacheDirectivesConfig(t *testing.T) {
+	cfg, err := parseConfig([]byte("debug:\n  allowed_roles: [ops]\ncache:\n  directives:\n    enabled: true\n"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "X-Gateway-Cache", cfg.Cache.Directives.Header)
+		assert.Equal(t, []string{"ops"}, cfg.Cache.Directives.AllowedRoles)
+	}
+}
+
+func TestCacheWarmConfig(t *testing.T) {
+	cfg, err := parseConfig([]byte("cache:\n  warm:\n    paths: [/a]\n"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 100, cfg.Cache.Warm.MaxPaths)
+	}
+
+	_, err = parseConfig([]byte("cache:\n  warm:\n    max_paths: 1\n    paths: [/a, /b]\n"))
+	assert.ErrorContains(t, err, "invalid cache.warm: 2 paths exceed max_paths of 1")
+
+	_, err = parseConfig([]byte("cache:\n  include_host: true\n  warm:\n    on_startup: true\n    paths: [/a]\n"))
+	assert.ErrorContains(t, err, "invalid cache.warm: host is required")
+
+	_, err = parseConfig([]byte("cache:\n  include_host: true\n  warm:\n    on_startup: true\n    host: api.example.com\n    paths: [/a]\n"))
+	assert.NoError(t, err)
+}
+
+func TestClusterConfig(t *testing.T) {
+	_, err := parseConfig([]byte("cluster:\n  enabled: true\n"))
+	assert.ErrorContains(t, err, "invalid cluster: secret_key is required")
+
+	_, err = parseConfig([]byte("cluster:\n  enabled: true\n  secret_key: shared-secret\n"))
+	assert.NoError(t, err)
+}
+
+func TestAuthJWKSConfig(t *testing.T) {
+	_, err := parseConfig([]byte("auth:\n  jwks_url: ftp://idp/keys\n"))
+	assert.ErrorContains(t, err, "invalid auth: invalid jwks_url")
+
+	cfg, err := parseConfig([]byte("auth:\n  jwks_url: https://idp.example.com/.well-known/jwks.json\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 300, cfg.Auth.JWKSRefreshInterval)
+}
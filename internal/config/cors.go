@@ -1,13 +1,34 @@
 package config
 
+import (
+	"fmt"
+	"strings"
+)
+
 // CORSConfig contains CORS configuration
 type CORSConfig struct {
-	Enabled          bool     `yaml:"enabled"`
-	AllowAllOrigins  bool     `yaml:"allow_all_origins"`
-	AllowedOrigins   []string `yaml:"allowed_origins"`
-	AllowedMethods   []string `yaml:"allowed_methods"`
-	AllowedHeaders   []string `yaml:"allowed_headers"`
-	ExposedHeaders   []string `yaml:"exposed_headers"`
-	AllowCredentials bool     `yaml:"allow_credentials"`
-	MaxAge           int      `yaml:"max_age"`
+	Enabled               bool     `yaml:"enabled"`
+	AllowAllOrigins       bool     `yaml:"allow_all_origins"`
+	AllowedOrigins        []string `yaml:"allowed_origins"`
+	AllowedOriginPatterns []string `yaml:"allowed_origin_patterns"`
+	ReflectOrigin         bool     `yaml:"reflect_origin"`
+	OriginCacheSize       int      `yaml:"origin_cache_size"`
+	AllowedMethods        []string `yaml:"allowed_methods"`
+	AllowedHeaders        []string `yaml:"allowed_headers"`
+	ExposedHeaders        []string `yaml:"exposed_headers"`
+	AllowCredentials      bool     `yaml:"allow_credentials"`
+	MaxAge                int      `yaml:"max_age"`
+}
+
+// ValidateOriginWildcard checks that an allowed origin containing a wildcard
+// has the form scheme://*.domain
+func ValidateOriginWildcard(origin string) error {
+	if origin == "*" || !strings.Contains(origin, "*") {
+		return nil
+	}
+	scheme, host, ok := strings.Cut(origin, "://")
+	if !ok || scheme == "" || !strings.HasPrefix(host, "*.") || strings.Count(origin, "*") != 1 || len(host) < 3 {
+		return fmt.Errorf("invalid wildcard origin %q, expected scheme://*.domain", origin)
+	}
+	return nil
 }
@@ -1,6 +1,12 @@
 package config
 
-import "time"
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
 
 // GRPCConfig holds gRPC-specific configuration
 type GRPCConfig struct {
@@ -27,6 +33,47 @@ type GRPCConfig struct {
 
 	// KeepAliveTimeout is how long to wait before closing an unresponsive connection
 	KeepAliveTimeout time.Duration `yaml:"keepalive_timeout" default:"10s"`
+
+	// ErrorStatuses overrides the HTTP status answered for gRPC error codes
+	// from gRPC upstreams of HTTP routes, by code name such as NOT_FOUND
+	ErrorStatuses map[string]int `yaml:"error_statuses"`
+
+	// Descriptors loads descriptor sets of services not compiled into the
+	// gateway
+	Descriptors GRPCDescriptors `yaml:"descriptors"`
+}
+
+// GRPCDescriptors is a directory of compiled descriptor sets, .protoset or
+// .desc files as written by protoc --descriptor_set_out. Imports missing
+// from a set are taken from the descriptors compiled into the gateway.
+type GRPCDescriptors struct {
+	Dir            string `yaml:"dir"`
+	ReloadInterval int    `yaml:"reload_interval"` // Seconds between directory change checks, 0 disables
+}
+
+// Validate checks the gRPC code names and HTTP statuses of the error mapping
+func (c *GRPCConfig) Validate() error {
+	for name, status := range c.ErrorStatuses {
+		if _, err := ParseGRPCCode(name); err != nil {
+			return fmt.Errorf("invalid error_statuses: %w", err)
+		}
+		if status < 100 || status > 599 {
+			return fmt.Errorf("invalid error_statuses: %s has invalid HTTP status %d", name, status)
+		}
+	}
+	if c.Descriptors.ReloadInterval < 0 {
+		return fmt.Errorf("descriptors.reload_interval must not be negative")
+	}
+	return nil
+}
+
+// ParseGRPCCode parses a gRPC code name such as NOT_FOUND
+func ParseGRPCCode(name string) (codes.Code, error) {
+	var code codes.Code
+	if err := code.UnmarshalJSON([]byte(strconv.Quote(name))); err != nil {
+		return 0, fmt.Errorf("unknown gRPC code: %s", name)
+	}
+	return code, nil
 }
 
 // DefaultGRPCConfig returns the default gRPC configuration
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// L4 listener protocols
+const (
+	L4ProtocolTCP = "tcp"
+	L4ProtocolUDP = "udp"
+)
+
+// Health check probe types
+const (
+	HealthCheckHTTP = "http" // GET of the health check path
+	HealthCheckTCP  = "tcp"  // TCP connect to the endpoint
+)
+
+// L4ProxyConfig forwards raw TCP and UDP traffic to services that don't speak
+// HTTP. Listeners balance across their endpoints with the same load balancing
+// and health checking as routes.
+type L4ProxyConfig struct {
+	Enabled   bool         `yaml:"enabled"`
+	Listeners []L4Listener `yaml:"listeners"`
+}
+
+// L4Listener accepts connections or datagrams on an address and forwards them
+// to an upstream host:port. UDP datagrams from one client address form a
+// session sharing one upstream socket until it idles out.
+type L4Listener struct {
+	Name           string               `yaml:"name"`
+	Protocol       string               `yaml:"protocol"`        // tcp or udp, tcp by default
+	Address        string               `yaml:"address"`         // Listen address such as ":5432"
+	Upstream       string               `yaml:"upstream"`        // host:port, unless load_balancing lists endpoints
+	LoadBalancing  *LoadBalancingConfig `yaml:"load_balancing"`  // Endpoints are host:port; health checks connect over TCP by default
+	ConnectTimeout int                  `yaml:"connect_timeout"` // Milliseconds to connect to an endpoint, 5000 by default
+	IdleTimeout    int                  `yaml:"idle_timeout"`    // Seconds without traffic before a connection or UDP session closes, 300 by default (60 for UDP)
+	MaxConnections int                  `yaml:"max_connections"` // Concurrent connections or UDP sessions, unlimited if 0
+}
+
+// Validate checks the L4 listeners
+func (c *L4ProxyConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	names := make(map[string]bool, len(c.Listeners))
+	for i := range c.Listeners {
+		listener := &c.Listeners[i]
+		if listener.Name == "" {
+			return fmt.Errorf("listener at index %d requires a name", i)
+		}
+		if names[listener.Name] {
+			return fmt.Errorf("duplicate listener name: %s", listener.Name)
+		}
+		names[listener.Name] = true
+		if err := listener.Validate(); err != nil {
+			return fmt.Errorf("listener %s: %w", listener.Name, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks an L4 listener's address, upstream and limits
+func (l *L4Listener) Validate() error {
+	switch l.Protocol {
+	case "", L4ProtocolTCP, L4ProtocolUDP:
+	default:
+		return fmt.Errorf("invalid protocol: %s", l.Protocol)
+	}
+	if _, _, err := net.SplitHostPort(l.Address); err != nil {
+		return fmt.Errorf("invalid address: %s", l.Address)
+	}
+
+	var endpoints []string
+	if l.LoadBalancing != nil {
+		endpoints = l.LoadBalancing.Endpoints
+	}
+	if len(endpoints) == 0 {
+		if l.Upstream == "" {
+			return fmt.Errorf("upstream or load_balancing.endpoints is required")
+		}
+		endpoints = []string{l.Upstream}
+	}
+	for _, endpoint := range endpoints {
+		if !validHostPort(endpoint) {
+			return fmt.Errorf("invalid upstream endpoint, expected host:port: %s", endpoint)
+		}
+	}
+
+	if l.LoadBalancing != nil && l.LoadBalancing.HealthCheckConfig != nil {
+		switch l.LoadBalancing.HealthCheckConfig.Type {
+		case "", HealthCheckHTTP, HealthCheckTCP:
+		default:
+			return fmt.Errorf("invalid load_balancing.health_check_config.type: %s", l.LoadBalancing.HealthCheckConfig.Type)
+		}
+	}
+	if l.ConnectTimeout < 0 || l.IdleTimeout < 0 || l.MaxConnections < 0 {
+		return fmt.Errorf("timeouts and max_connections must not be negative")
+	}
+	return nil
+}
+
+// setDefaults fills in the listener protocol, timeouts and health check type
+func (l *L4Listener) setDefaults() {
+	if l.Protocol == "" {
+		l.Protocol = L4ProtocolTCP
+	}
+	if l.ConnectTimeout == 0 {
+		l.ConnectTimeout = 5000
+	}
+	if l.IdleTimeout == 0 {
+		l.IdleTimeout = 300
+		if l.Protocol == L4ProtocolUDP {
+			l.IdleTimeout = 60
+		}
+	}
+	if l.LoadBalancing == nil {
+		l.LoadBalancing = &LoadBalancingConfig{}
+	}
+	if len(l.LoadBalancing.Endpoints) == 0 && l.Upstream != "" {
+		l.LoadBalancing.Endpoints = []string{l.Upstream}
+	}
+	if l.LoadBalancing.Driver == "" {
+		l.LoadBalancing.Driver = "static"
+	}
+	if l.LoadBalancing.HealthCheckConfig == nil {
+		l.LoadBalancing.HealthCheckConfig = &HealthCheckConfig{}
+	}
+	if l.LoadBalancing.HealthCheckConfig.Type == "" {
+		l.LoadBalancing.HealthCheckConfig.Type = HealthCheckTCP
+	}
+	if l.LoadBalancing.HealthCheckConfig.Type == HealthCheckHTTP && l.LoadBalancing.HealthCheckConfig.Scheme == "" {
+		l.LoadBalancing.HealthCheckConfig.Scheme = "http"
+	}
+}
+
+// validHostPort reports whether s is a host:port with a numeric port
+func validHostPort(s string) bool {
+	host, port, err := net.SplitHostPort(s)
+	if err != nil || host == "" {
+		return false
+	}
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n < 65536
+}
@@ -0,0 +1,101 @@
+package config
+
+import "fmt"
+
+// Middleware names accepted in middleware_order lists
+const (
+	MiddlewareRequestValidation    = "request_validation"
+	MiddlewareMQTT                 = "mqtt"
+	MiddlewareAuth                 = "auth"
+	MiddlewareExtAuthz             = "ext_authz"
+	MiddlewareOPA                  = "opa"
+	MiddlewarePriority             = "priority"
+	MiddlewareFeatureFlags         = "feature_flags"
+	MiddlewareRequestDecompression = "request_decompression"
+	MiddlewareCompression          = "compression"
+	MiddlewareRedaction            = "redaction"
+	MiddlewareCache                = "cache"
+	MiddlewareCollapse             = "collapse"
+	MiddlewareFieldEncryption      = "field_encryption"
+	MiddlewareResponseValidation   = "response_validation"
+	MiddlewareRetry                = "retry"
+	MiddlewareRateLimit            = "rate_limit"
+	MiddlewareHeaderTransform      = "header_transform"
+	MiddlewareBodyRewrite          = "body_rewrite"
+	MiddlewareURLRewrite           = "url_rewrite"
+)
+
+// DefaultMiddlewareOrder is the order requests pass through route middleware,
+// outermost first
+var DefaultMiddlewareOrder = []string{
+	MiddlewareRequestValidation,
+	MiddlewareMQTT,
+	MiddlewareAuth,
+	MiddlewareExtAuthz,
+	MiddlewareOPA,
+	MiddlewarePriority,
+	MiddlewareFeatureFlags,
+	MiddlewareRequestDecompression,
+	MiddlewareCompression,
+	MiddlewareRedaction,
+	MiddlewareCache,
+	MiddlewareCollapse,
+	MiddlewareFieldEncryption,
+	MiddlewareResponseValidation,
+	MiddlewareRetry,
+	MiddlewareRateLimit,
+	MiddlewareHeaderTransform,
+	MiddlewareBodyRewrite,
+	MiddlewareURLRewrite,
+}
+
+// ValidateMiddlewareOrder checks a middleware order for unknown or repeated names
+func ValidateMiddlewareOrder(order []string) error {
+	seen := make(map[string]bool, len(order))
+	for _, name := range order {
+		if !isKnownMiddleware(name) {
+			return fmt.Errorf("unknown middleware: %s", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("duplicate middleware: %s", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// ResolveMiddlewareOrder returns the effective order for a route. The route
+// override wins over the global order; middleware missing from the chosen list
+// run after the listed ones in their default relative order.
+func ResolveMiddlewareOrder(global, route []string) []string {
+	order := global
+	if len(route) > 0 {
+		order = route
+	}
+
+	resolved := make([]string, 0, len(DefaultMiddlewareOrder))
+	listed := make(map[string]bool, len(order))
+	for _, name := range order {
+		if isKnownMiddleware(name) && !listed[name] {
+			resolved = append(resolved, name)
+			listed[name] = true
+		}
+	}
+	for _, name := range DefaultMiddlewareOrder {
+		if !listed[name] {
+			resolved = append(resolved, name)
+		}
+	}
+
+	return resolved
+}
+
+// isKnownMiddleware reports whether name is a configurable middleware
+func isKnownMiddleware(name string) bool {
+	for _, known := range DefaultMiddlewareOrder {
+		if name == known {
+			return true
+		}
+	}
+	return false
+}
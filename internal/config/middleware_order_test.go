@@ -0,0 +1,34 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateMiddlewareOrder(t *testing.T) {
+	assert.NoError(t, ValidateMiddlewareOrder(nil))
+	assert.NoError(t, ValidateMiddlewareOrder([]string{"rate_limit", "auth"}))
+	assert.EqualError(t, ValidateMiddlewareOrder([]string{"auth", "gzip"}), "unknown middleware: gzip")
+	assert.EqualError(t, ValidateMiddlewareOrder([]string{"auth", "auth"}), "duplicate middleware: auth")
+}
+
+func TestResolveMiddlewareOrder(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		assert.Equal(t, DefaultMiddlewareOrder, ResolveMiddlewareOrder(nil, nil))
+	})
+
+	t.Run("global order with unlisted middleware appended", func(t *testing.T) {
+		order := ResolveMiddlewareOrder([]string{"rate_limit", "auth"}, nil)
+		assert.Equal(t, []string{
+			"rate_limit", "auth", "request_validation", "mqtt", "ext_authz", "opa", "priority", "feature_flags", "request_decompression", "compression", "redaction", "cache", "collapse", "field_encryption", "response_validation", "retry", "header_transform", "body_rewrite", "url_rewrite",
+		}, order)
+	})
+
+	t.Run("route override wins", func(t *testing.T) {
+		order := ResolveMiddlewareOrder([]string{"rate_limit"}, []string{"cache"})
+		assert.Equal(t, "cache", order[0])
+		assert.Equal(t, "request_validation", order[1])
+		assert.Len(t, order, len(DefaultMiddlewareOrder))
+	})
+}
@@ -0,0 +1,250 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the schema version of the config and routes files this
+// gateway writes. Files without a version: are version 0, whose legacy
+// layouts are still read and are upgraded with the migrate command.
+const CurrentVersion = 1
+
+// checkVersion rejects schema versions this gateway doesn't know
+func checkVersion(version int) error {
+	if version < 0 || version > CurrentVersion {
+		return fmt.Errorf("unsupported version %d: this gateway reads files up to version %d", version, CurrentVersion)
+	}
+	return nil
+}
+
+// migrations upgrade a document from the version at their index to the next
+var migrations = []func(root *yaml.Node) ([]string, error){
+	migrateRouteMiddlewares,
+}
+
+// Migrate upgrades a config or routes file to the current schema version,
+// returning the upgraded file and a description of each change. Comments
+// and key order are kept. A file already at the current version is returned
+// unchanged.
+func Migrate(data []byte) ([]byte, []string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse file: %w", err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("file must be a mapping")
+	}
+	root := doc.Content[0]
+
+	version, err := documentVersion(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	if version == CurrentVersion {
+		return data, nil, nil
+	}
+
+	var changes []string
+	for _, migrate := range migrations[version:] {
+		applied, err := migrate(root)
+		if err != nil {
+			return nil, nil, err
+		}
+		changes = append(changes, applied...)
+	}
+	setVersion(root)
+	changes = append(changes, fmt.Sprintf("set version to %d", CurrentVersion))
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, nil, fmt.Errorf("failed to write file: %w", err)
+	}
+	return out.Bytes(), changes, nil
+}
+
+// documentVersion returns the checked schema version of a document, 0 if it
+// has none
+func documentVersion(root *yaml.Node) (int, error) {
+	node := mappingValue(root, "version")
+	if node == nil {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(resolveAlias(node).Value)
+	if err != nil {
+		return 0, fmt.Errorf("version must be a number")
+	}
+	return version, checkVersion(version)
+}
+
+// normalizeDocument checks the version of a config or routes document and
+// moves the middleware settings unversioned files set on routes under their
+// middlewares, returning a deprecation warning for each. Current files must
+// set them under middlewares.
+func normalizeDocument(doc *yaml.Node) ([]string, error) {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	root := doc.Content[0]
+	version, err := documentVersion(root)
+	if err != nil {
+		return nil, err
+	}
+	legacy, err := moveLegacyMiddlewares(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var deprecations []string
+	for _, setting := range legacy {
+		if version > 0 {
+			return nil, fmt.Errorf("%s: %s must be set under middlewares", setting.route, setting.key)
+		}
+		deprecations = append(deprecations, fmt.Sprintf(
+			"%s: %s outside middlewares is deprecated, run the migrate command to move it", setting.route, setting.key))
+	}
+	return deprecations, nil
+}
+
+// setVersion sets the version of a document to the current one, adding it
+// as the first key if missing
+func setVersion(root *yaml.Node) {
+	value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(CurrentVersion)}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "version" {
+			root.Content[i+1] = value
+			return
+		}
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"}
+	root.Content = append([]*yaml.Node{key, value}, root.Content...)
+}
+
+// legacyRouteKeys are the middleware settings version 0 files could set on
+// the route itself, which are only read under middlewares:
+var legacyRouteKeys = func() []string {
+	routeKeys := map[string]bool{}
+	for _, key := range yamlKeys(reflect.TypeOf(Route{})) {
+		routeKeys[key] = true
+	}
+	var keys []string
+	for _, key := range yamlKeys(reflect.TypeOf(Middlewares{})) {
+		if !routeKeys[key] {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}()
+
+// yamlKeys returns the YAML keys of a struct's fields
+func yamlKeys(t reflect.Type) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name != "" && name != "-" {
+			keys = append(keys, name)
+		}
+	}
+	return keys
+}
+
+// legacySetting is a middleware setting found on a route or route template
+type legacySetting struct {
+	route string // Route or template, as in routes[0] (/users)
+	key   string
+}
+
+// migrateRouteMiddlewares moves middleware settings set on routes and route
+// templates, such as rate_limit, under their middlewares:
+func migrateRouteMiddlewares(root *yaml.Node) ([]string, error) {
+	legacy, err := moveLegacyMiddlewares(root)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]string, 0, len(legacy))
+	for _, setting := range legacy {
+		changes = append(changes, fmt.Sprintf("%s: moved %s under middlewares", setting.route, setting.key))
+	}
+	return changes, nil
+}
+
+// moveLegacyMiddlewares moves the middleware settings of the routes and
+// route templates of a document under their middlewares
+func moveLegacyMiddlewares(root *yaml.Node) ([]legacySetting, error) {
+	var moved []legacySetting
+	if routes := mappingValue(root, "routes"); routes != nil && resolveAlias(routes).Kind == yaml.SequenceNode {
+		for i, route := range resolveAlias(routes).Content {
+			name := fmt.Sprintf("routes[%d]", i)
+			if path := mappingValue(resolveAlias(route), "path"); path != nil {
+				name += " (" + path.Value + ")"
+			}
+			settings, err := moveToMiddlewares(resolveAlias(route), name)
+			if err != nil {
+				return nil, err
+			}
+			moved = append(moved, settings...)
+		}
+	}
+	if templates := mappingValue(root, "templates"); templates != nil && resolveAlias(templates).Kind == yaml.MappingNode {
+		templates = resolveAlias(templates)
+		for i := 0; i+1 < len(templates.Content); i += 2 {
+			settings, err := moveToMiddlewares(resolveAlias(templates.Content[i+1]), "templates."+templates.Content[i].Value)
+			if err != nil {
+				return nil, err
+			}
+			moved = append(moved, settings...)
+		}
+	}
+	return moved, nil
+}
+
+// moveToMiddlewares moves the legacy middleware keys of a route mapping
+// under its middlewares mapping, creating it if needed
+func moveToMiddlewares(route *yaml.Node, name string) ([]legacySetting, error) {
+	if route.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+
+	var moved []legacySetting
+	for _, key := range legacyRouteKeys {
+		value := mappingValue(route, key)
+		if value == nil {
+			continue
+		}
+
+		middlewares := mappingValue(route, "middlewares")
+		if middlewares == nil || middlewares.Tag == "!!null" {
+			removeMappingKey(route, "middlewares")
+			middlewares = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			route.Content = append(route.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "middlewares"}, middlewares)
+		}
+		if middlewares.Kind != yaml.MappingNode {
+			// Moving keys into an anchored mapping would change every route sharing it
+			return nil, fmt.Errorf("%s: middlewares must be a mapping to move %s under it", name, key)
+		}
+		if mappingValue(middlewares, key) != nil {
+			return nil, fmt.Errorf("%s: %s is set both on the route and under middlewares", name, key)
+		}
+
+		for i := 0; i+1 < len(route.Content); i += 2 {
+			if route.Content[i].Value == key {
+				middlewares.Content = append(middlewares.Content, route.Content[i], route.Content[i+1])
+				break
+			}
+		}
+		removeMappingKey(route, key)
+		moved = append(moved, legacySetting{route: name, key: key})
+	}
+	return moved, nil
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateRoutes(t *testing.T) {
+	migrated, changes, err := Migrate([]byte(`# Gateway routes
+templates:
+  internal:
+    require_auth: true
+routes:
+  - path: "/search"
+    upstream: "http://search:8080"
+    timeout: 10
+    # Shared with the suggest route
+    rate_limit:
+      requests: 100
+      period: "minute"
+    middlewares:
+      cache:
+        enabled: true
+  - path: "/users"
+    upstream: "http://users:8080"
+    extends: internal
+    rate_limit_ref: public
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"routes[0] (/search): moved rate_limit under middlewares",
+		"routes[1] (/users): moved rate_limit_ref under middlewares",
+		"templates.internal: moved require_auth under middlewares",
+		"set version to 1",
+	}, changes)
+	assert.Contains(t, string(migrated), "# Shared with the suggest route")
+
+	routes, err := ParseRoutes(migrated)
+	require.NoError(t, err)
+	assert.Equal(t, CurrentVersion, routes.Version)
+	search := routes.Routes[0]
+	assert.Equal(t, 10, search.Timeout)
+	require.NotNil(t, search.Middlewares.RateLimit)
+	assert.Equal(t, 100, search.Middlewares.RateLimit.Requests)
+	assert.True(t, search.Middlewares.Cache.Enabled)
+	users := routes.Routes[1]
+	assert.Equal(t, "public", users.Middlewares.RateLimitRef)
+	assert.True(t, users.Middlewares.RequireAuth)
+
+	// Current files are left as they are
+	again, changes, err := Migrate(migrated)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+	assert.Equal(t, migrated, again)
+}
+
+func TestMigrateConfig(t *testing.T) {
+	migrated, changes, err := Migrate([]byte(`version: 0
+server:
+  address: ":8080"
+routes:
+  - path: "/api"
+    upstream: "http://api:8080"
+    cache:
+      enabled: true
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"routes[0] (/api): moved cache under middlewares", "set version to 1"}, changes)
+
+	cfg, err := parseConfig(migrated)
+	require.NoError(t, err)
+	assert.Equal(t, CurrentVersion, cfg.Version)
+	assert.True(t, cfg.Routes[0].Middlewares.Cache.Enabled)
+}
+
+func TestMigrateConflicts(t *testing.T) {
+	_, _, err := Migrate([]byte(`
+routes:
+  - path: "/search"
+    upstream: "http://search:8080"
+    rate_limit:
+      requests: 100
+    middlewares:
+      rate_limit:
+        requests: 10
+`))
+	assert.EqualError(t, err, "routes[0] (/search): rate_limit is set both on the route and under middlewares")
+
+	// Keys can't be moved into a mapping other routes share
+	_, _, err = Migrate([]byte(`
+routes:
+  - path: "/a"
+    upstream: "http://a:8080"
+    middlewares: &shared
+      require_auth: true
+  - path: "/b"
+    upstream: "http://b:8080"
+    cache:
+      enabled: true
+    middlewares: *shared
+`))
+	assert.EqualError(t, err, "routes[1] (/b): middlewares must be a mapping to move cache under it")
+
+	_, _, err = Migrate([]byte("version: 2\nroutes: []\n"))
+	assert.EqualError(t, err, "unsupported version 2: this gateway reads files up to version 1")
+}
+
+func TestVersionCheck(t *testing.T) {
+	_, err := ParseRoutes([]byte("version: 3\nroutes: []\n"))
+	assert.EqualError(t, err, "unsupported version 3: this gateway reads files up to version 1")
+
+	_, err = parseConfig([]byte("version: -1\n"))
+	assert.EqualError(t, err, "unsupported version -1: this gateway reads files up to version 1")
+
+	routes, err := ParseRoutes([]byte("routes: []\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, routes.Version)
+}
+
+func TestLegacyRouteSettings(t *testing.T) {
+	routes, err := ParseRoutes([]byte(`
+templates:
+  internal:
+    require_auth: true
+routes:
+  - path: "/search"
+    upstream: "http://search:8080"
+    rate_limit:
+      requests: 100
+      period: "minute"
+    middlewares:
+      cache:
+        enabled: true
+  - path: "/users"
+    upstream: "http://users:8080"
+    extends: internal
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"routes[0] (/search): rate_limit outside middlewares is deprecated, run the migrate command to move it",
+		"templates.internal: require_auth outside middlewares is deprecated, run the migrate command to move it",
+	}, routes.Deprecations)
+	search := routes.Routes[0].Middlewares
+	require.NotNil(t, search.RateLimit)
+	assert.Equal(t, 100, search.RateLimit.Requests)
+	assert.True(t, search.Cache.Enabled)
+	assert.True(t, routes.Routes[1].Middlewares.RequireAuth)
+
+	cfg, err := parseConfig([]byte(`
+routes:
+  - path: "/api"
+    upstream: "http://api:8080"
+    cache:
+      enabled: true
+`))
+	require.NoError(t, err)
+	assert.Len(t, cfg.Deprecations, 1)
+	assert.True(t, cfg.Routes[0].Middlewares.Cache.Enabled)
+
+	// Versioned files only read them under middlewares
+	_, err = ParseRoutes([]byte(`
+version: 1
+routes:
+  - path: "/search"
+    upstream: "http://search:8080"
+    rate_limit:
+      requests: 100
+`))
+	assert.EqualError(t, err, "routes[0] (/search): rate_limit must be set under middlewares")
+
+	_, err = ParseRoutes([]byte(`
+routes:
+  - path: "/search"
+    upstream: "http://search:8080"
+    require_auth: false
+    middlewares:
+      require_auth: true
+`))
+	assert.EqualError(t, err, "routes[0] (/search): require_auth is set both on the route and under middlewares")
+}
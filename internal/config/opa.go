@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// OPAEngineConfig lists the policy bundles of the embedded OPA engine, which
+// evaluates the Rego policies routes attach with middlewares.opa
+type OPAEngineConfig struct {
+	Bundles []OPABundleConfig `yaml:"bundles"`
+}
+
+// OPABundleConfig is a policy bundle read from disk or downloaded from a
+// bundle server
+type OPABundleConfig struct {
+	Name         string `yaml:"name"`
+	Path         string `yaml:"path"`          // Bundle directory or .tar.gz file
+	URL          string `yaml:"url"`           // Bundle .tar.gz served by a bundle server
+	PollInterval int    `yaml:"poll_interval"` // Seconds between downloads from the bundle server, 60 by default
+}
+
+// Validate checks that each bundle has a unique name and one source
+func (c *OPAEngineConfig) Validate() error {
+	names := make(map[string]bool)
+	for _, b := range c.Bundles {
+		if b.Name == "" {
+			return fmt.Errorf("bundle name is required")
+		}
+		if names[b.Name] {
+			return fmt.Errorf("duplicate bundle: %s", b.Name)
+		}
+		names[b.Name] = true
+
+		if (b.Path == "") == (b.URL == "") {
+			return fmt.Errorf("bundle %s: exactly one of path and url is required", b.Name)
+		}
+		if b.URL != "" {
+			bundleURL, err := url.Parse(b.URL)
+			if err != nil || (bundleURL.Scheme != "http" && bundleURL.Scheme != "https") || bundleURL.Host == "" {
+				return fmt.Errorf("bundle %s: invalid url: %s", b.Name, b.URL)
+			}
+		}
+		if b.PollInterval < 0 {
+			return fmt.Errorf("bundle %s: poll_interval must not be negative", b.Name)
+		}
+	}
+	return nil
+}
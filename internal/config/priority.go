@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Priority is a request priority as carried by the RFC 9218 Priority header
+type Priority struct {
+	Urgency     int  // 0, the most urgent, to 7
+	Incremental bool // Whether the response is useful in parts
+}
+
+// DefaultPriority applies to requests without a Priority header
+var DefaultPriority = Priority{Urgency: 3}
+
+// MaxUrgency is the least urgent urgency
+const MaxUrgency = 7
+
+// ParsePriority parses a Priority header value. Invalid parameters keep
+// their default, as RFC 9218 asks of receivers, and are reported in the
+// error; unknown parameters are ignored.
+func ParsePriority(value string) (Priority, error) {
+	priority := DefaultPriority
+	var err error
+	for _, member := range strings.Split(value, ",") {
+		// Parameters of dictionary members carry nothing RFC 9218 defines
+		member, _, _ = strings.Cut(member, ";")
+		key, item, hasValue := strings.Cut(strings.TrimSpace(member), "=")
+		switch key {
+		case "u":
+			urgency, parseErr := strconv.Atoi(item)
+			if parseErr != nil || urgency < 0 || urgency > MaxUrgency {
+				err = fmt.Errorf("invalid urgency: %s", item)
+				continue
+			}
+			priority.Urgency = urgency
+		case "i":
+			switch {
+			case !hasValue || item == "?1":
+				priority.Incremental = true
+			case item == "?0":
+				priority.Incremental = false
+			default:
+				err = fmt.Errorf("invalid incremental: %s", item)
+			}
+		}
+	}
+	return priority, err
+}
+
+// String formats the priority as a Priority header value
+func (p Priority) String() string {
+	if p.Incremental {
+		return "u=" + strconv.Itoa(p.Urgency) + ", i"
+	}
+	return "u=" + strconv.Itoa(p.Urgency)
+}
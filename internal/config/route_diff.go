@@ -0,0 +1,153 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// RouteDiff lists the differences between two route configurations, keyed
+// by route path
+type RouteDiff struct {
+	Added    []string      `json:"added"`
+	Removed  []string      `json:"removed"`
+	Modified []RouteChange `json:"modified"`
+}
+
+// RouteChange lists what changed on a route present in both configurations.
+// Settings are named by their YAML keys; values are left out as they may
+// hold secrets.
+type RouteChange struct {
+	Path        string            `json:"path"`
+	Fields      []string          `json:"fields,omitempty"`
+	Middlewares MiddlewareChanges `json:"middlewares"`
+}
+
+// MiddlewareChanges lists the middlewares configured, removed or reconfigured
+// on a route
+type MiddlewareChanges struct {
+	Added    []string `json:"added,omitempty"`
+	Removed  []string `json:"removed,omitempty"`
+	Modified []string `json:"modified,omitempty"`
+}
+
+// Empty reports whether the configurations are the same
+func (d RouteDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// DiffRoutes compares the current routes with candidate routes
+func DiffRoutes(current, candidate []Route) RouteDiff {
+	diff := RouteDiff{
+		Added:    []string{},
+		Removed:  []string{},
+		Modified: []RouteChange{},
+	}
+
+	currentByPath := make(map[string]Route, len(current))
+	for _, route := range current {
+		currentByPath[route.Path] = route
+	}
+	candidateByPath := make(map[string]Route, len(candidate))
+	for _, route := range candidate {
+		candidateByPath[route.Path] = route
+	}
+
+	for _, route := range candidate {
+		old, ok := currentByPath[route.Path]
+		if !ok {
+			diff.Added = append(diff.Added, route.Path)
+			continue
+		}
+		if change, changed := diffRoute(old, route); changed {
+			diff.Modified = append(diff.Modified, change)
+		}
+	}
+	for _, route := range current {
+		if _, ok := candidateByPath[route.Path]; !ok {
+			diff.Removed = append(diff.Removed, route.Path)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.Modified, func(i, j int) bool { return diff.Modified[i].Path < diff.Modified[j].Path })
+	return diff
+}
+
+// diffRoute compares two versions of a route
+func diffRoute(old, updated Route) (RouteChange, bool) {
+	change := RouteChange{Path: updated.Path}
+
+	oldValue, newValue := reflect.ValueOf(old), reflect.ValueOf(updated)
+	for i := 0; i < oldValue.NumField(); i++ {
+		field := oldValue.Type().Field(i)
+		if field.Name == "Middlewares" {
+			continue
+		}
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			change.Fields = append(change.Fields, yamlName(field))
+		}
+	}
+
+	change.Middlewares = diffMiddlewares(old.Middlewares, updated.Middlewares)
+	changed := len(change.Fields) > 0 || len(change.Middlewares.Added) > 0 ||
+		len(change.Middlewares.Removed) > 0 || len(change.Middlewares.Modified) > 0
+	return change, changed
+}
+
+// diffMiddlewares compares the middleware settings of two versions of a route.
+// A middleware that is unset or disabled counts as not configured.
+func diffMiddlewares(old, updated *Middlewares) MiddlewareChanges {
+	var changes MiddlewareChanges
+	if old == nil {
+		old = &Middlewares{}
+	}
+	if updated == nil {
+		updated = &Middlewares{}
+	}
+
+	oldValue, newValue := reflect.ValueOf(*old), reflect.ValueOf(*updated)
+	for i := 0; i < oldValue.NumField(); i++ {
+		name := yamlName(oldValue.Type().Field(i))
+		oldField, newField := oldValue.Field(i), newValue.Field(i)
+		wasOn, isOn := middlewareConfigured(oldField), middlewareConfigured(newField)
+		switch {
+		case !wasOn && isOn:
+			changes.Added = append(changes.Added, name)
+		case wasOn && !isOn:
+			changes.Removed = append(changes.Removed, name)
+		case wasOn && !reflect.DeepEqual(oldField.Interface(), newField.Interface()):
+			changes.Modified = append(changes.Modified, name)
+		}
+	}
+	return changes
+}
+
+// middlewareConfigured reports whether a middleware setting turns the
+// middleware on: a true flag, a non-empty reference, or a set config that
+// isn't explicitly disabled
+func middlewareConfigured(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Bool:
+		return value.Bool()
+	case reflect.String:
+		return value.String() != ""
+	}
+	if value.IsNil() {
+		return false
+	}
+	if enabled := value.Elem().FieldByName("Enabled"); enabled.IsValid() && enabled.Kind() == reflect.Bool {
+		return enabled.Bool()
+	}
+	return true
+}
+
+// yamlName returns the YAML key of a struct field
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
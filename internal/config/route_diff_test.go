@@ -0,0 +1,62 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffRoutes(t *testing.T) {
+	current, err := ParseRoutes([]byte(`
+routes:
+  - path: "/users"
+    upstream: "http://users:8080"
+    middlewares:
+      require_auth: true
+      rate_limit:
+        requests: 100
+        period: "minute"
+      cache:
+        enabled: true
+  - path: "/orders"
+    upstream: "http://orders:8080"
+  - path: "/legacy"
+    upstream: "http://legacy:8080"
+`))
+	require.NoError(t, err)
+	candidate, err := ParseRoutes([]byte(`
+routes:
+  - path: "/users"
+    upstream: "http://users-v2:8080"
+    timeout: 10
+    middlewares:
+      rate_limit:
+        requests: 200
+        period: "minute"
+      cache:
+        enabled: false
+      compression:
+        enabled: true
+  - path: "/orders"
+    upstream: "http://orders:8080"
+  - path: "/payments"
+    upstream: "http://payments:8080"
+`))
+	require.NoError(t, err)
+
+	diff := DiffRoutes(current.Routes, candidate.Routes)
+	assert.False(t, diff.Empty())
+	assert.Equal(t, []string{"/payments"}, diff.Added)
+	assert.Equal(t, []string{"/legacy"}, diff.Removed)
+	require.Len(t, diff.Modified, 1)
+
+	change := diff.Modified[0]
+	assert.Equal(t, "/users", change.Path)
+	assert.Equal(t, []string{"upstream", "timeout"}, change.Fields)
+	assert.Equal(t, []string{"compression"}, change.Middlewares.Added)
+	assert.Equal(t, []string{"require_auth", "cache"}, change.Middlewares.Removed)
+	assert.Equal(t, []string{"rate_limit"}, change.Middlewares.Modified)
+
+	assert.True(t, DiffRoutes(current.Routes, current.Routes).Empty())
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// expandRouteTemplates merges the templates into the routes extending them
+// and removes the templates from the routes document. Templates are named
+// partial routes under templates:, which routes and other templates reference
+// with extends:. They are expanded before routes are decoded, so route
+// defaults only fill in what neither the route nor its template sets.
+func expandRouteTemplates(doc *yaml.Node) error {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+	root := doc.Content[0]
+
+	templates := map[string]*yaml.Node{}
+	if node := mappingValue(root, "templates"); node != nil {
+		node = resolveAlias(node)
+		if node.Kind != yaml.MappingNode {
+			return fmt.Errorf("templates must be a mapping of template names to routes")
+		}
+		for i := 0; i < len(node.Content); i += 2 {
+			name, template := node.Content[i].Value, resolveAlias(node.Content[i+1])
+			if template.Kind != yaml.MappingNode {
+				return fmt.Errorf("template %s must be a mapping", name)
+			}
+			if mappingValue(template, "path") != nil {
+				return fmt.Errorf("template %s must not set path", name)
+			}
+			templates[name] = template
+		}
+		removeMappingKey(root, "templates")
+	}
+
+	resolved := make(map[string]*yaml.Node, len(templates))
+	var resolve func(name string, chain []string) (*yaml.Node, error)
+	resolve = func(name string, chain []string) (*yaml.Node, error) {
+		if node, ok := resolved[name]; ok {
+			return node, nil
+		}
+		for _, seen := range chain {
+			if seen == name {
+				return nil, fmt.Errorf("template %s extends itself through %v", name, append(chain, name))
+			}
+		}
+		template, ok := templates[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown template: %s", name)
+		}
+		node, err := extend(template, func(parent string) (*yaml.Node, error) {
+			return resolve(parent, append(chain, name))
+		})
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", name, err)
+		}
+		resolved[name] = node
+		return node, nil
+	}
+
+	routes := mappingValue(root, "routes")
+	if routes == nil || resolveAlias(routes).Kind != yaml.SequenceNode {
+		return nil
+	}
+	routes = resolveAlias(routes)
+	for i, route := range routes.Content {
+		route = resolveAlias(route)
+		if route.Kind != yaml.MappingNode {
+			continue
+		}
+		node, err := extend(route, func(name string) (*yaml.Node, error) {
+			return resolve(name, nil)
+		})
+		if err != nil {
+			return fmt.Errorf("route at index %d: %w", i, err)
+		}
+		routes.Content[i] = node
+	}
+	return nil
+}
+
+// extend merges a route or template over the template it extends, if any
+func extend(node *yaml.Node, template func(name string) (*yaml.Node, error)) (*yaml.Node, error) {
+	extends := mappingValue(node, "extends")
+	if extends == nil {
+		return node, nil
+	}
+	extends = resolveAlias(extends)
+	if extends.Kind != yaml.ScalarNode || extends.Value == "" {
+		return nil, fmt.Errorf("extends must be a template name")
+	}
+
+	base, err := template(extends.Value)
+	if err != nil {
+		return nil, err
+	}
+	own := *node
+	own.Content = append([]*yaml.Node(nil), node.Content...)
+	removeMappingKey(&own, "extends")
+	return mergeNodes(base, &own, "")
+}
+
+// mergeNodes merges override over base. Mappings are merged key by key, any
+// other value replaces the base's; a null removes it. Replacing a mapping
+// with a value of another kind is rejected as a likely mistake.
+func mergeNodes(base, override *yaml.Node, path string) (*yaml.Node, error) {
+	base, override = resolveAlias(base), resolveAlias(override)
+	if override.Tag == "!!null" || base.Tag == "!!null" {
+		return override, nil
+	}
+	if base.Kind != yaml.MappingNode && override.Kind != yaml.MappingNode {
+		return override, nil
+	}
+	if base.Kind != override.Kind {
+		return nil, fmt.Errorf("%s conflicts with the template: mappings can only be merged with mappings", path)
+	}
+
+	merged := *base
+	merged.Content = append([]*yaml.Node(nil), base.Content...)
+	for i := 0; i < len(override.Content); i += 2 {
+		key, value := override.Content[i], override.Content[i+1]
+		keyPath := key.Value
+		if path != "" {
+			keyPath = path + "." + key.Value
+		}
+
+		found := false
+		for j := 0; j < len(merged.Content); j += 2 {
+			if merged.Content[j].Value != key.Value {
+				continue
+			}
+			node, err := mergeNodes(merged.Content[j+1], value, keyPath)
+			if err != nil {
+				return nil, err
+			}
+			merged.Content[j+1] = node
+			found = true
+			break
+		}
+		if !found {
+			merged.Content = append(merged.Content, key, value)
+		}
+	}
+	return &merged, nil
+}
+
+// mappingValue returns the value of a key of a mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// removeMappingKey removes a key from a mapping node
+func removeMappingKey(node *yaml.Node, key string) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content = append(node.Content[:i:i], node.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// resolveAlias returns the node an alias refers to
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouteTemplates(t *testing.T) {
+	routes, err := ParseRoutes([]byte(`
+defaults:
+  timeout: 10
+templates:
+  internal-api:
+    methods: ["GET", "POST"]
+    timeout: 20
+    middlewares:
+      require_auth: true
+      cache:
+        enabled: true
+        ttl: 60
+  internal-reports:
+    extends: internal-api
+    timeout: 120
+routes:
+  - path: "/users"
+    upstream: "http://users:8080"
+    extends: internal-api
+    middlewares:
+      cache:
+        ttl: 5
+  - path: "/reports"
+    upstream: "http://reports:8080"
+    extends: internal-reports
+    middlewares:
+      cache: null
+  - path: "/public"
+    upstream: "http://public:8080"
+`))
+	require.NoError(t, err)
+
+	users := routes.Routes[0]
+	assert.Equal(t, []string{"GET", "POST"}, users.Methods)
+	assert.Equal(t, 20, users.Timeout)
+	assert.True(t, users.Middlewares.RequireAuth)
+	assert.Equal(t, &RouteCacheConfig{Enabled: true, TTL: 5}, users.Middlewares.Cache)
+
+	reports := routes.Routes[1]
+	assert.Equal(t, 120, reports.Timeout)
+	assert.True(t, reports.Middlewares.RequireAuth)
+	assert.Nil(t, reports.Middlewares.Cache)
+
+	// Routes without a template still get the defaults
+	assert.Equal(t, 10, routes.Routes[2].Timeout)
+}
+
+func TestRouteTemplatesValidation(t *testing.T) {
+	testCases := []struct {
+		name string
+		yaml string
+		err  string
+	}{
+		{
+			name: "unknown template",
+			yaml: `
+routes:
+  - path: "/users"
+    upstream: "http://users:8080"
+    extends: missing
+`,
+			err: "route at index 0: unknown template: missing",
+		},
+		{
+			name: "cycle",
+			yaml: `
+templates:
+  a:
+    extends: b
+  b:
+    extends: a
+routes:
+  - path: "/users"
+    upstream: "http://users:8080"
+    extends: a
+`,
+			err: "extends itself",
+		},
+		{
+			name: "template sets path",
+			yaml: `
+templates:
+  a:
+    path: "/users"
+routes: []
+`,
+			err: "template a must not set path",
+		},
+		{
+			name: "mapping replaced by scalar",
+			yaml: `
+templates:
+  a:
+    middlewares:
+      cache:
+        enabled: true
+routes:
+  - path: "/users"
+    upstream: "http://users:8080"
+    extends: a
+    middlewares:
+      cache: true
+`,
+			err: "middlewares.cache conflicts with the template",
+		},
+		{
+			name: "merged route is validated",
+			yaml: `
+templates:
+  a:
+    timeout: 10
+    max_duration: -1
+routes:
+  - path: "/users"
+    upstream: "http://users:8080"
+    extends: a
+`,
+			err: "invalid route at index 0",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseRoutes([]byte(tc.yaml))
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
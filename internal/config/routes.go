@@ -2,14 +2,35 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
 // RouteConfig represents a route configuration in routes.yaml
 type RouteConfig struct {
-	Routes []Route `yaml:"routes"`
+	Version  int            `yaml:"version"` // Schema version, see CurrentVersion
+	Defaults *RouteDefaults `yaml:"defaults"`
+	Routes   []Route        `yaml:"routes"`
+
+	// Deprecations warn of legacy settings read from the file
+	Deprecations []string `yaml:"-"`
+}
+
+// RouteDefaults are inherited by every route that doesn't set them itself.
+// A route's own setting replaces the default, except header transforms, whose
+// headers are merged with the route's taking precedence.
+type RouteDefaults struct {
+	Timeout         int               `yaml:"timeout"`
+	RetryPolicy     *RetryPolicy      `yaml:"retry_policy"`
+	RateLimit       *RateLimitConfig  `yaml:"rate_limit"`
+	RateLimitRef    string            `yaml:"rate_limit_ref"`
+	Cache           *RouteCacheConfig `yaml:"cache"`
+	HeaderTransform *HeaderTransform  `yaml:"header_transform"`
 }
 
 // Route represents a single API route
@@ -21,14 +42,372 @@ type Route struct {
 	EndpointsProtocol string               `yaml:"endpoints_protocol"`
 	RPCServer         string               `yaml:"rpc_server"`
 	StripPrefix       bool                 `yaml:"strip_prefix"`
-	Timeout           int                  `yaml:"timeout"`
+	Timeout           int                  `yaml:"timeout"`           // Seconds to wait for upstream response headers
+	BodyIdleTimeout   int                  `yaml:"body_idle_timeout"` // Seconds the upstream response body may stall
+	MaxDuration       int                  `yaml:"max_duration"`      // Seconds for the whole request, including the body
+	GRPCDeadline      int                  `yaml:"grpc_deadline"`     // Seconds allowed for gRPC calls sent without a deadline
 	WebSocket         *WebSocketConfig     `yaml:"websocket"`
 	LoadBalancing     *LoadBalancingConfig `yaml:"load_balancing"`
 	ErrorHandling     *ErrorHandling       `yaml:"error_handling"`
 	Compression       bool                 `yaml:"compression"`
 	IPWhitelist       []string             `yaml:"ip_whitelist"`
 	IPBlacklist       []string             `yaml:"ip_blacklist"`
-	Middlewares       *Middlewares         `yaml:"middlewares"`
+	Middlewares       *Middlewares         `yaml:"middlewares"` // Never nil on loaded routes
+	Dial              *DialConfig          `yaml:"dial"`
+	UpstreamProxy     string               `yaml:"upstream_proxy"`
+	UpstreamSPIFFEID  string               `yaml:"upstream_spiffe_id"` // Upstream reached over mTLS with the gateway's SVID, presenting this SPIFFE ID
+	// Host header and TLS server name sent upstream, for shared ingresses and
+	// CDNs routing on a name other than the upstream URL's. The SNI defaults
+	// to the host header's hostname when only that is set.
+	UpstreamHostHeader string            `yaml:"upstream_host_header"`
+	UpstreamSNI        string            `yaml:"upstream_sni"`
+	MiddlewareOrder    []string          `yaml:"middleware_order"`
+	Signing            *RequestSigning   `yaml:"signing"`
+	Tags               []string          `yaml:"tags"`
+	Labels             map[string]string `yaml:"labels"`
+	SLO                *RouteSLO         `yaml:"slo"`
+	CatchAll           bool              `yaml:"catch_all"` // Serve requests no other route matches
+	Hedging            *HedgingConfig    `yaml:"hedging"`
+	Static             *StaticConfig     `yaml:"static"`      // Files served by STATIC routes
+	GRPCBridge         *GRPCBridgeConfig `yaml:"grpc_bridge"` // Stream of GRPC_WEBSOCKET routes
+	GRPCMetadata       *GRPCMetadata     `yaml:"grpc_metadata"`
+	BlueGreen          *BlueGreenConfig  `yaml:"blue_green"`
+	SOAP               *SOAPConfig       `yaml:"soap"` // SOAP/XML operation routing and parser limits
+	ContentRouting     *ContentRouting   `yaml:"content_routing"`
+	SplitHorizon       *SplitHorizon     `yaml:"split_horizon"`
+	Compat             *UpstreamCompat   `yaml:"compat"` // Workarounds for legacy upstreams
+	Prewarm            *PrewarmConfig    `yaml:"prewarm"`
+	Spool              *SpoolConfig      `yaml:"spool"`
+	SandboxUpstream    string            `yaml:"sandbox_upstream"` // Upstream of signed test traffic, see test_traffic
+
+	// Documentation listed by /admin/routes for developer portals
+	Description string `yaml:"description"`
+	Owner       string `yaml:"owner"`    // Team or contact responsible for the route
+	DocsURL     string `yaml:"docs_url"` // Absolute URL of the API's documentation
+}
+
+// PrewarmConfig opens and health checks upstream connections before a route
+// takes traffic, so the first requests don't pay for DNS lookups and TLS
+// handshakes. Requests arriving meanwhile wait up to the timeout.
+type PrewarmConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Connections int    `yaml:"connections"` // Opened per endpoint, 2 by default
+	Path        string `yaml:"path"`        // Requested on each connection, /health by default
+	Timeout     int    `yaml:"timeout"`     // Seconds to wait for the warmup, 10 by default
+}
+
+// SpoolConfig receives request bodies in full, on disk past the memory
+// threshold, before proxying them, so slow uploads don't hold upstream
+// connections open. The upstream gets the body with its Content-Length.
+type SpoolConfig struct {
+	Enabled         bool   `yaml:"enabled"`
+	Directory       string `yaml:"directory"`        // The system temporary directory by default
+	MaxBodySize     int64  `yaml:"max_body_size"`    // Bytes, larger requests get 413, 10GB by default
+	MaxDiskUsage    int64  `yaml:"max_disk_usage"`   // Bytes of the route's bodies on disk at once, requests past it get 507; unlimited if 0
+	MemoryThreshold int64  `yaml:"memory_threshold"` // Bytes of bodies kept in memory, 64KB by default
+}
+
+// UpstreamCompat adapts upstream requests for legacy upstreams. Requests are
+// always sent over HTTP/1.1.
+type UpstreamCompat struct {
+	HeaderCase            []string `yaml:"header_case"`             // Header names sent with exactly this casing
+	ForceContentLength    bool     `yaml:"force_content_length"`    // Buffer chunked request bodies to send Content-Length
+	MaxBufferSize         int64    `yaml:"max_buffer_size"`         // Bytes buffered for force_content_length
+	DisableExpectContinue bool     `yaml:"disable_expect_continue"` // Drop Expect: 100-continue
+}
+
+// Blue/green deployment colors
+const (
+	DeploymentBlue  = "blue"
+	DeploymentGreen = "green"
+)
+
+// BlueGreenConfig sends a route's traffic to one of two upstream groups. The
+// active group can be switched through the admin API and, with rollback
+// enabled, is switched back if errors spike while the new group bakes.
+type BlueGreenConfig struct {
+	Active   string         `yaml:"active"` // blue or green, blue by default
+	Blue     *UpstreamGroup `yaml:"blue"`
+	Green    *UpstreamGroup `yaml:"green"`
+	Rollback *RollbackGuard `yaml:"rollback"`
+}
+
+// SOAPConfig inspects SOAP and XML requests of a route. Requests with a body
+// must have an XML content type. Operations send matching requests to their
+// own upstream; others go to the route's upstream.
+type SOAPConfig struct {
+	Enabled     bool            `yaml:"enabled"`
+	Operations  []SOAPOperation `yaml:"operations"`    // Checked in order
+	MaxBodySize int64           `yaml:"max_body_size"` // Bytes, larger requests get 413, 1MB by default
+	MaxDepth    int             `yaml:"max_depth"`     // Element nesting, deeper documents get 400, 64 by default
+	PassThrough bool            `yaml:"pass_through"`  // Forward bodies untouched without parsing; operations match on soap_action only
+}
+
+// SOAPOperation routes requests by SOAP action or root element. The root
+// element is the first element in the SOAP Body, or the document element of
+// plain XML. Both must match when both are set.
+type SOAPOperation struct {
+	Name          string               `yaml:"name"`
+	SOAPAction    string               `yaml:"soap_action"`  // SOAPAction header, or the action parameter of a SOAP 1.2 Content-Type
+	RootElement   string               `yaml:"root_element"` // Local name of the root element
+	Upstream      string               `yaml:"upstream"`
+	LoadBalancing *LoadBalancingConfig `yaml:"load_balancing"`
+}
+
+// ContentRouting sends requests to the upstream of the first rule matching a
+// value of their body, found at a JSON path such as $.event_type or
+// $.data.items[0].kind, or an XML element path such as /event/type. Other
+// requests, including ones whose body can't be parsed or lacks the value,
+// go to the route's upstream.
+type ContentRouting struct {
+	RouteOn     string        `yaml:"route_on"`
+	Rules       []ContentRule `yaml:"rules"`         // Checked in order
+	MaxBodySize int64         `yaml:"max_body_size"` // Bytes, larger requests get 413, 64KB by default
+}
+
+// ContentRule routes requests whose body value is one of its values
+type ContentRule struct {
+	Name          string               `yaml:"name"`
+	Values        []string             `yaml:"values"` // Numbers and booleans match their JSON text
+	Upstream      string               `yaml:"upstream"`
+	LoadBalancing *LoadBalancingConfig `yaml:"load_balancing"`
+}
+
+// SplitHorizon sends requests from internal clients, arriving on the internal
+// listener or connecting from network_zones.internal_cidrs, to their own
+// upstream. Other requests go to the route's upstream.
+type SplitHorizon struct {
+	Upstream      string               `yaml:"upstream"`
+	LoadBalancing *LoadBalancingConfig `yaml:"load_balancing"`
+}
+
+// ContentPath is a parsed route_on path
+type ContentPath struct {
+	XML      bool
+	Segments []string // JSON properties and array indexes, or XML element names
+}
+
+// ParseContentPath parses a route_on path, $. followed by dotted JSON
+// properties with optional [n] array indexes, or / separated XML elements
+func ParseContentPath(path string) (ContentPath, error) {
+	switch {
+	case strings.HasPrefix(path, "$."):
+		var segments []string
+		for _, part := range strings.Split(strings.TrimPrefix(path, "$."), ".") {
+			name, rest, _ := strings.Cut(part, "[")
+			if name == "" {
+				return ContentPath{}, fmt.Errorf("invalid JSON path %s", path)
+			}
+			segments = append(segments, name)
+			for rest != "" {
+				index, after, ok := strings.Cut(rest, "]")
+				if _, err := strconv.Atoi(index); !ok || err != nil {
+					return ContentPath{}, fmt.Errorf("invalid array index in %s", path)
+				}
+				segments = append(segments, index)
+				if after != "" && !strings.HasPrefix(after, "[") {
+					return ContentPath{}, fmt.Errorf("invalid JSON path %s", path)
+				}
+				rest = strings.TrimPrefix(after, "[")
+			}
+		}
+		return ContentPath{Segments: segments}, nil
+	case strings.HasPrefix(path, "/"):
+		segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+		for _, segment := range segments {
+			if segment == "" {
+				return ContentPath{}, fmt.Errorf("invalid XML path %s", path)
+			}
+		}
+		return ContentPath{XML: true, Segments: segments}, nil
+	}
+	return ContentPath{}, fmt.Errorf("route_on must be a JSON path starting with $. or an XML path starting with /")
+}
+
+// UpstreamGroup is one deployment of a route's upstream
+type UpstreamGroup struct {
+	Upstream      string               `yaml:"upstream"`
+	LoadBalancing *LoadBalancingConfig `yaml:"load_balancing"`
+}
+
+// RollbackGuard reverts an upstream change when the new upstream's 5xx rate
+// exceeds the limit within the bake window
+type RollbackGuard struct {
+	Enabled      bool    `yaml:"enabled"`
+	BakeWindow   int     `yaml:"bake_window"`    // Seconds after a change during which errors are watched
+	MaxErrorRate float64 `yaml:"max_error_rate"` // Percent of responses
+	MinRequests  int     `yaml:"min_requests"`   // Requests needed before the rate is judged
+}
+
+// StaticConfig serves files from a directory instead of an upstream
+type StaticConfig struct {
+	Root             string `yaml:"root"`
+	Index            string `yaml:"index"`             // File served for directories, index.html by default
+	SPAFallback      bool   `yaml:"spa_fallback"`      // Serve the root index for unknown paths without an extension
+	MaxAge           int    `yaml:"max_age"`           // Seconds browsers may cache files; index files are always revalidated
+	Precompressed    bool   `yaml:"precompressed"`     // Serve .br and .gz siblings to clients accepting them
+	DirectoryListing bool   `yaml:"directory_listing"` // List directories without an index file
+}
+
+// GRPCBridgeConfig maps the messages of a WebSocket connection onto a
+// bidirectional gRPC stream to the route's upstream. Client messages are JSON
+// encodings of the method's input, answered with JSON encodings of its
+// output. An empty message ends the client's side of the stream.
+type GRPCBridgeConfig struct {
+	Method         string   `yaml:"method"`           // Full method name such as chat.v1.ChatService/Chat
+	ForwardHeaders []string `yaml:"forward_headers"`  // Request headers sent upstream as metadata
+	MaxMessageSize int64    `yaml:"max_message_size"` // Bytes of a client message, 1MB by default
+}
+
+// GRPCMetadata transforms the metadata of calls on GRPC routes, as
+// header_transform does for HTTP headers. Request rules apply to the metadata
+// sent upstream and response rules to the headers and trailers returned to
+// the client, with added keys sent as trailers. Rules run in the order
+// remove, rename, add.
+type GRPCMetadata struct {
+	Request  GRPCMetadataRules `yaml:"request"`
+	Response GRPCMetadataRules `yaml:"response"`
+	// Metadata keys sent upstream with a value of the authenticated caller:
+	// identity.subject, identity.tenant, identity.role, identity.scopes,
+	// identity.type or jwt.<claim>. Clients can't set these keys themselves.
+	Claims map[string]string `yaml:"claims"`
+}
+
+// GRPCMetadataRules adds, removes and renames metadata keys
+type GRPCMetadataRules struct {
+	Add    map[string]string `yaml:"add"` // Replaces values already set
+	Remove []string          `yaml:"remove"`
+	Rename map[string]string `yaml:"rename"` // Old key to new key
+}
+
+// Validate checks that the rules name metadata keys the gateway may set
+func (g *GRPCMetadata) Validate() error {
+	for phase, rules := range map[string]GRPCMetadataRules{"request": g.Request, "response": g.Response} {
+		for key := range rules.Add {
+			if err := validMetadataKey(key); err != nil {
+				return fmt.Errorf("%s.add: %w", phase, err)
+			}
+		}
+		for _, key := range rules.Remove {
+			if err := validMetadataKey(key); err != nil {
+				return fmt.Errorf("%s.remove: %w", phase, err)
+			}
+		}
+		for from, to := range rules.Rename {
+			if err := validMetadataKey(from); err != nil {
+				return fmt.Errorf("%s.rename: %w", phase, err)
+			}
+			if err := validMetadataKey(to); err != nil {
+				return fmt.Errorf("%s.rename: %w", phase, err)
+			}
+		}
+	}
+	for key, source := range g.Claims {
+		if err := validMetadataKey(key); err != nil {
+			return fmt.Errorf("claims: %w", err)
+		}
+		switch source {
+		case "identity.subject", "identity.tenant", "identity.role", "identity.scopes", "identity.type":
+		default:
+			if !strings.HasPrefix(source, "jwt.") || source == "jwt." {
+				return fmt.Errorf("claims: unknown value %s for %s", source, key)
+			}
+		}
+	}
+	return nil
+}
+
+// reservedMetadata lists keys set by the gRPC transport
+var reservedMetadata = map[string]bool{
+	"content-type": true,
+	"user-agent":   true,
+	"te":           true,
+	"connection":   true,
+}
+
+// validMetadataKey reports whether key is a metadata key other than the ones
+// reserved for gRPC and its transport. Keys are case insensitive.
+func validMetadataKey(key string) error {
+	key = strings.ToLower(key)
+	if key == "" {
+		return fmt.Errorf("empty metadata key")
+	}
+	if strings.HasPrefix(key, "grpc-") || reservedMetadata[key] {
+		return fmt.Errorf("reserved metadata key: %s", key)
+	}
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return fmt.Errorf("invalid metadata key: %s", key)
+		}
+	}
+	return nil
+}
+
+// HedgingConfig sends a second attempt to another endpoint when the first one
+// hasn't returned response headers after the delay, using whichever answers
+// first. The budget caps hedges to a percentage of requests.
+type HedgingConfig struct {
+	Enabled       bool     `yaml:"enabled"`
+	DelayMs       int      `yaml:"delay_ms"`
+	BudgetPercent float64  `yaml:"budget_percent"`
+	Methods       []string `yaml:"methods"` // Idempotent methods to hedge, GET and HEAD if empty
+}
+
+// RouteSLO represents the service level objectives of a route. Targets are
+// percentages of requests; the latency target defaults to the availability target.
+type RouteSLO struct {
+	Availability       float64 `yaml:"availability"`         // e.g. 99.9 percent of requests without a 5xx
+	LatencyThresholdMs int     `yaml:"latency_threshold_ms"` // Requests slower than this count against the latency SLO
+	LatencyTarget      float64 `yaml:"latency_target"`       // e.g. 99 percent of requests under the threshold
+}
+
+// labelNamePattern matches names usable as Prometheus labels and span attributes
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// reservedLabelNames are label names the gateway sets itself
+var reservedLabelNames = map[string]bool{
+	"route":  true,
+	"method": true,
+	"status": true,
+}
+
+// Request signing types
+const (
+	SigningAWSSigV4 = "aws_sigv4"
+	SigningHMAC     = "hmac"
+)
+
+// RequestSigning represents outbound request signing for a route
+type RequestSigning struct {
+	Type string       `yaml:"type"`
+	AWS  *AWSSigV4    `yaml:"aws"`
+	HMAC *HMACSigning `yaml:"hmac"`
+}
+
+// AWSSigV4 represents AWS Signature Version 4 signing settings. Credentials fall
+// back to the standard AWS environment variables and may be exchanged for those
+// of an assumed role.
+type AWSSigV4 struct {
+	Region          string `yaml:"region"`
+	Service         string `yaml:"service"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	SessionToken    string `yaml:"session_token"`
+	RoleARN         string `yaml:"role_arn"`
+	RoleSessionName string `yaml:"role_session_name"`
+	ExternalID      string `yaml:"external_id"`
+	STSEndpoint     string `yaml:"sts_endpoint"`
+	UnsignedPayload bool   `yaml:"unsigned_payload"`
+}
+
+// HMACSigning represents generic HMAC signing settings
+type HMACSigning struct {
+	KeyID           string `yaml:"key_id"`
+	Secret          string `yaml:"secret"`
+	Algorithm       string `yaml:"algorithm"`
+	Header          string `yaml:"header"`
+	TimestampHeader string `yaml:"timestamp_header"`
+	KeyIDHeader     string `yaml:"key_id_header"`
 }
 
 // RouteCacheConfig contains cache configuration for a route
@@ -36,6 +415,12 @@ type RouteCacheConfig struct {
 	Enabled            bool `yaml:"enabled"`
 	TTL                int  `yaml:"ttl"`
 	CacheAuthenticated bool `yaml:"cache_authenticated"`
+
+	// Namespace partitions the cache: entries are keyed, limited and purged
+	// per namespace. The route path by default; routes naming the same
+	// namespace share its entries and should set the same max_size.
+	Namespace string `yaml:"namespace"`
+	MaxSize   int    `yaml:"max_size"` // Entries the namespace holds, only the global max_size applies if 0
 }
 
 // RetryPolicy represents retry configuration for a route
@@ -54,22 +439,83 @@ type LoadBalancingConfig struct {
 	Driver            string             `yaml:"driver"`
 	Discoveries       *Discoveries       `yaml:"discoveries"`
 	HealthCheckConfig *HealthCheckConfig `yaml:"health_check_config"`
+	EWMAAlpha         float64            `yaml:"ewma_alpha"`
+	Warmup            int                `yaml:"warmup"`
+	SlowStart         *SlowStartConfig   `yaml:"slow_start"`
+	SessionAffinity   *SessionAffinity   `yaml:"session_affinity"`
+}
+
+// SessionAffinity pins clients to an endpoint with a signed cookie the
+// gateway issues on the first response. The pin is dropped while the
+// endpoint is unhealthy or gone.
+type SessionAffinity struct {
+	Enabled    bool   `yaml:"enabled"`
+	CookieName string `yaml:"cookie_name"`
+	Secret     string `yaml:"secret"`  // HMAC key signing the cookie
+	MaxAge     int    `yaml:"max_age"` // Cookie lifetime in seconds, 0 for a session cookie
+	Secure     bool   `yaml:"secure"`
+}
+
+// DefaultSlowStartMinWeight is the traffic share a new endpoint starts with
+// when min_weight isn't set
+const DefaultSlowStartMinWeight = 0.1
+
+// SlowStartConfig represents the traffic ramp for newly discovered endpoints
+type SlowStartConfig struct {
+	Duration  int     `yaml:"duration"`
+	MinWeight float64 `yaml:"min_weight"` // Starting share of a full endpoint's traffic, above 0 and at most 1
+}
+
+// UnmarshalYAML defaults min_weight before decoding, so an explicit 0 is
+// rejected rather than taken as unset
+func (s *SlowStartConfig) UnmarshalYAML(node *yaml.Node) error {
+	type plain SlowStartConfig
+	decoded := plain{MinWeight: DefaultSlowStartMinWeight}
+	if err := node.Decode(&decoded); err != nil {
+		return err
+	}
+	*s = SlowStartConfig(decoded)
+	return nil
 }
 
 // HealthCheckConfig represents health check configuration
 type HealthCheckConfig struct {
-	Path               string `yaml:"path"`
-	Interval           int    `yaml:"interval"`
-	Timeout            int    `yaml:"timeout"`
-	HealthyThreshold   int    `yaml:"healthy_threshold"`
-	UnhealthyThreshold int    `yaml:"unhealthy_threshold"`
+	Type               string            `yaml:"type"` // http or tcp, http by default for routes
+	Path               string            `yaml:"path"`
+	Interval           int               `yaml:"interval"`
+	Timeout            int               `yaml:"timeout"`
+	HealthyThreshold   int               `yaml:"healthy_threshold"`
+	UnhealthyThreshold int               `yaml:"unhealthy_threshold"`
+	Headers            map[string]string `yaml:"headers"`
+	BearerToken        string            `yaml:"bearer_token"`
+	ExpectedStatuses   []int             `yaml:"expected_statuses"`
+	Scheme             string            `yaml:"scheme"`
+	TLSSkipVerify      bool              `yaml:"tls_skip_verify"`
 }
 
 // HeaderTransform represents header transformation configuration
+// Values may reference request data with {variable} placeholders, e.g.
+// "{jwt.sub}", "{route.path}" or "{now_unix_ms}".
 type HeaderTransform struct {
 	Request  map[string]string `yaml:"request"`
 	Response map[string]string `yaml:"response"`
 	Remove   []string          `yaml:"remove"`
+	RemoveIf []HeaderRemoval   `yaml:"remove_if"`
+}
+
+// Header transform phases
+const (
+	HeaderPhaseRequest  = "request"
+	HeaderPhaseResponse = "response"
+)
+
+// HeaderRemoval removes a request or response header when a templated value
+// matches a pattern, or is empty if no pattern is set
+type HeaderRemoval struct {
+	Header  string `yaml:"header"`
+	Phase   string `yaml:"phase"`
+	Value   string `yaml:"value"`
+	Matches string `yaml:"matches"`
 }
 
 // URLRewrite represents URL rewriting configuration
@@ -90,26 +536,210 @@ type ErrorHandling struct {
 	Templates      map[int]string `yaml:"templates"`
 }
 
+// BodyRewrite represents response body URL rewriting configuration
+type BodyRewrite struct {
+	Enabled      bool              `yaml:"enabled"`
+	Rules        []BodyRewriteRule `yaml:"rules"`
+	ContentTypes []string          `yaml:"content_types"`
+	MaxSize      int64             `yaml:"max_size"`
+}
+
+// BodyRewriteRule replaces occurrences of From with To. An empty To is the
+// gateway's external URL for the route.
+type BodyRewriteRule struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// RequestDecompression represents request body decompression configuration
+type RequestDecompression struct {
+	Enabled   bool     `yaml:"enabled"`
+	Encodings []string `yaml:"encodings"`
+	MaxSize   int64    `yaml:"max_size"`
+}
+
+// JWTValidation represents additional JWT requirements for a route
+type JWTValidation struct {
+	Audience []string          `yaml:"audience"`
+	Issuer   string            `yaml:"issuer"`
+	MaxAge   int               `yaml:"max_age"`
+	Claims   map[string]string `yaml:"claims"`
+}
+
+// External authorization protocols
+const (
+	ExtAuthzModeHTTP = "http" // JSON check requests posted to url
+	ExtAuthzModeGRPC = "grpc" // Envoy's envoy.service.auth.v3.Authorization service
+)
+
+// ExtAuthzConfig represents external authorization service configuration
+type ExtAuthzConfig struct {
+	Enabled   bool     `yaml:"enabled"`
+	Mode      string   `yaml:"mode"` // http by default
+	URL       string   `yaml:"url"`  // grpc://host:port or grpcs://host:port in grpc mode
+	TimeoutMs int      `yaml:"timeout_ms"`
+	FailOpen  bool     `yaml:"fail_open"`
+	Headers   []string `yaml:"headers"`
+	CacheTTL  int      `yaml:"cache_ttl"`
+}
+
+// OPAConfig represents evaluation of a Rego policy by the embedded OPA
+// engine, from the bundles of the opa config
+type OPAConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Policy    string `yaml:"policy"` // Rule under data, such as gateway.authz.decision
+	TimeoutMs int    `yaml:"timeout_ms"`
+	FailOpen  bool   `yaml:"fail_open"`
+}
+
 type Middlewares struct {
-	RequireAuth     bool                    `yaml:"require_auth"`
-	RateLimit       *RateLimitConfig        `yaml:"rate_limit"`
-	Cache           *RouteCacheConfig       `yaml:"cache"`
-	CircuitBreaker  *CircuitBreakerSettings `yaml:"circuit_breaker"`
-	RetryPolicy     *RetryPolicy            `yaml:"retry_policy"`
-	HeaderTransform *HeaderTransform        `yaml:"header_transform"`
-	URLRewrite      *URLRewrite             `yaml:"url_rewrite"`
+	RequireAuth          bool                    `yaml:"require_auth"`
+	JWT                  *JWTValidation          `yaml:"jwt"`
+	ExtAuthz             *ExtAuthzConfig         `yaml:"ext_authz"`
+	OPA                  *OPAConfig              `yaml:"opa"`
+	RateLimit            *RateLimitConfig        `yaml:"rate_limit"`
+	RateLimitRef         string                  `yaml:"rate_limit_ref"` // Named limit from config, shared with other routes
+	Cache                *RouteCacheConfig       `yaml:"cache"`
+	CircuitBreaker       *CircuitBreakerSettings `yaml:"circuit_breaker"`
+	RetryPolicy          *RetryPolicy            `yaml:"retry_policy"`
+	HeaderTransform      *HeaderTransform        `yaml:"header_transform"`
+	URLRewrite           *URLRewrite             `yaml:"url_rewrite"`
+	RequestDecompression *RequestDecompression   `yaml:"request_decompression"`
+	BodyRewrite          *BodyRewrite            `yaml:"body_rewrite"`
+	Collapse             *CollapseConfig         `yaml:"collapse"`
+	Compression          *ResponseCompression    `yaml:"compression"`
+	RequestValidation    *RequestValidation      `yaml:"request_validation"`
+	ResponseValidation   *ResponseValidation     `yaml:"response_validation"`
+	FieldEncryption      *FieldEncryption        `yaml:"field_encryption"`
+	Redaction            *ResponseRedaction      `yaml:"redaction"`
+	FeatureFlags         *RouteFeatureFlags      `yaml:"feature_flags"`
+	MQTT                 *MQTTConfig             `yaml:"mqtt"`
+	Priority             *RequestPriority        `yaml:"priority"`
+}
+
+// RequestPriority schedules the route's requests by their RFC 9218 Priority
+// header. Beyond max_concurrent, requests wait most urgent first, and the
+// least urgent are shed with a 503 when the queue is full or they wait too
+// long. Requests without the header are sent upstream with the default.
+type RequestPriority struct {
+	Enabled        bool   `yaml:"enabled"`
+	Default        string `yaml:"default"`          // Priority of unlabelled requests, such as "u=5"; u=3 if empty
+	MinUrgency     int    `yaml:"min_urgency"`      // More urgent client priorities are lowered to this
+	MaxConcurrent  int    `yaml:"max_concurrent"`   // Requests proxied at once, unlimited if 0
+	MaxQueue       int    `yaml:"max_queue"`        // Requests waiting for a slot, max_concurrent by default
+	QueueTimeoutMs int    `yaml:"queue_timeout_ms"` // Longest wait for a slot, 1000 by default
+}
+
+// DefaultPriority returns the priority of requests without a Priority header
+func (p *RequestPriority) DefaultPriority() Priority {
+	if p.Default == "" {
+		return DefaultPriority
+	}
+	// The default was checked with the configuration
+	priority, _ := ParsePriority(p.Default)
+	return priority
+}
+
+// MQTTConfig authorizes MQTT-over-WebSocket connections at the upgrade.
+// Requests must be WebSocket upgrades offering an MQTT subprotocol and are
+// authenticated like require_auth, so browser clients may pass their token in
+// the query. The device is the authenticated subject unless device_claim
+// names a JWT claim.
+type MQTTConfig struct {
+	Enabled                 bool     `yaml:"enabled"`
+	Subprotocols            []string `yaml:"subprotocols"`               // Accepted Sec-WebSocket-Protocol values, mqtt and mqttv3.1 by default
+	MaxConnectionsPerDevice int      `yaml:"max_connections_per_device"` // Concurrent connections per device on the route, unlimited if 0
+	DeviceClaim             string   `yaml:"device_claim"`               // JWT claim identifying the device
+}
+
+// RouteFeatureFlags sends the gateway's feature flag results upstream as
+// headers. Results are also available to header templates as {feature.<name>}.
+type RouteFeatureFlags struct {
+	Enabled bool     `yaml:"enabled"`
+	Flags   []string `yaml:"flags"` // Flags to evaluate, all flags if empty
+}
+
+// RequestValidation rejects requests the upstream would not accept before
+// they are proxied
+type RequestValidation struct {
+	Enabled             bool     `yaml:"enabled"`
+	AllowedContentTypes []string `yaml:"allowed_content_types"` // Media types of request bodies, "type/*" allowed; others get 415
+	RequiredHeaders     []string `yaml:"required_headers"`      // Requests missing one get 400
+	StrictMethods       bool     `yaml:"strict_methods"`        // Methods outside the route's methods get 405
+	HandleOptions       bool     `yaml:"handle_options"`        // Answer OPTIONS with the allowed methods instead of proxying
+}
+
+// ResponseValidation checks a sample of upstream JSON responses against the
+// route's OpenAPI document to catch contract drift. Responses are matched by
+// the path sent upstream, under the base path of the document's servers.
+// Mismatches are counted and logged; the response is sent unchanged.
+type ResponseValidation struct {
+	Enabled       bool    `yaml:"enabled"`
+	Spec          string  `yaml:"spec"`           // OpenAPI 3 document in YAML or JSON
+	SamplePercent float64 `yaml:"sample_percent"` // 0-100 of responses validated, 10 by default
+	MaxBodySize   int     `yaml:"max_body_size"`  // Bytes of larger responses aren't validated, 1MB by default
+}
+
+// ResponseRedaction removes JSON fields from responses to callers not
+// allowed to see them, so each backend needn't filter them itself. Fields
+// are paths as in field_encryption. Callers are allowed by their role or by
+// one of their scopes; unauthenticated callers never are.
+type ResponseRedaction struct {
+	Enabled     bool            `yaml:"enabled"`
+	Rules       []RedactionRule `yaml:"rules"`
+	MaxBodySize int             `yaml:"max_body_size"` // Bytes of JSON responses redacted, larger ones are withheld; 1MB by default
+}
+
+// RedactionRule lists fields and who may see them
+type RedactionRule struct {
+	Fields []string `yaml:"fields"`
+	Roles  []string `yaml:"roles"`  // Roles that see the fields
+	Scopes []string `yaml:"scopes"` // Scopes, such as API key permissions, that see the fields
+}
+
+// ResponseCompression compresses responses for clients that accept it.
+// Responses the upstream already compressed are passed through, or decoded
+// and re-encoded when the client can't use or prefers another encoding.
+type ResponseCompression struct {
+	Enabled                bool     `yaml:"enabled"`
+	Encodings              []string `yaml:"encodings"`     // Preference order, br and gzip by default
+	MinSize                int      `yaml:"min_size"`      // Responses with a smaller Content-Length are sent as is
+	ContentTypes           []string `yaml:"content_types"` // Compressible content type prefixes
+	Reencode               bool     `yaml:"reencode"`      // Re-encode upstream-compressed responses to the client's preferred encoding
+	UpstreamAcceptEncoding string   `yaml:"upstream_accept_encoding"`
+}
+
+// Accept-Encoding handling towards the upstream
+const (
+	UpstreamAcceptEncodingForward = "forward" // Send the client's Accept-Encoding
+	UpstreamAcceptEncodingStrip   = "strip"   // Ask for uncompressed responses and compress at the gateway
+	UpstreamAcceptEncodingGateway = "gateway" // Ask for any encoding the gateway can decode
+)
+
+// CollapseConfig shares one upstream call between identical concurrent GET
+// requests. Requests are identical when method, host, path, query, the
+// Authorization and Cookie headers and the vary headers match.
+type CollapseConfig struct {
+	Enabled     bool     `yaml:"enabled"`
+	VaryHeaders []string `yaml:"vary_headers"`
+	MaxBodySize int      `yaml:"max_body_size"` // Bytes shared with waiting requests
 }
 
 type Discoveries struct {
-	Name      string `yaml:"name"`
-	Prefix    string `yaml:"prefix"`
-	FailLimit int    `yaml:"fail_limit"`
+	Name            string `yaml:"name"`
+	Prefix          string `yaml:"prefix"`
+	FailLimit       int    `yaml:"fail_limit"`
+	RequireLease    bool   `yaml:"require_lease"`
+	RefreshInterval int    `yaml:"refresh_interval"`
 }
 
 // Protocol types
 const (
-	ProtocolHTTP = "HTTP"
-	ProtocolGRPC = "GRPC"
+	ProtocolHTTP   = "HTTP"
+	ProtocolGRPC   = "GRPC"
+	ProtocolStatic = "STATIC"
+	// Browsers connect over WebSocket to a gRPC stream
+	ProtocolGRPCWebSocket = "GRPC_WEBSOCKET"
 )
 
 // Validate validates the route configuration
@@ -117,14 +747,21 @@ func (r *Route) Validate() error {
 	if r.Path == "" {
 		return fmt.Errorf("path is required")
 	}
-	if r.Upstream == "" {
+	if r.Protocol == ProtocolStatic {
+		if r.Static == nil || r.Static.Root == "" {
+			return fmt.Errorf("static routes require static.root")
+		}
+		if strings.ContainsAny(r.Static.Index, `/\`) {
+			return fmt.Errorf("static.index must be a file name")
+		}
+	} else if r.Upstream == "" && r.BlueGreen == nil {
 		return fmt.Errorf("upstream is required")
 	}
 
 	// Validate protocol settings
 	if r.Protocol != "" {
 		switch r.Protocol {
-		case ProtocolHTTP, ProtocolGRPC:
+		case ProtocolHTTP, ProtocolGRPC, ProtocolStatic, ProtocolGRPCWebSocket:
 			// Valid protocols
 		default:
 			return fmt.Errorf("invalid protocol: %s", r.Protocol)
@@ -133,6 +770,84 @@ func (r *Route) Validate() error {
 		// Default to HTTP if not specified
 		r.Protocol = ProtocolHTTP
 	}
+	if r.BodyIdleTimeout < 0 || r.MaxDuration < 0 {
+		return fmt.Errorf("body_idle_timeout and max_duration must not be negative")
+	}
+	if r.GRPCDeadline < 0 {
+		return fmt.Errorf("grpc_deadline must not be negative")
+	}
+	if r.Hedging != nil && r.Hedging.Enabled {
+		if r.Hedging.DelayMs <= 0 {
+			return fmt.Errorf("hedging requires a positive delay_ms")
+		}
+		if r.Hedging.BudgetPercent < 0 || r.Hedging.BudgetPercent > 100 {
+			return fmt.Errorf("hedging budget_percent must be between 0 and 100")
+		}
+	}
+	if r.Compat != nil {
+		for _, name := range r.Compat.HeaderCase {
+			if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+				return fmt.Errorf("invalid compat.header_case: %q", name)
+			}
+		}
+		if r.Compat.MaxBufferSize < 0 {
+			return fmt.Errorf("compat.max_buffer_size must not be negative")
+		}
+	}
+	if r.DocsURL != "" {
+		if u, err := url.Parse(r.DocsURL); err != nil || !u.IsAbs() {
+			return fmt.Errorf("docs_url must be an absolute URL")
+		}
+	}
+	if r.Prewarm != nil && r.Prewarm.Enabled {
+		if r.Prewarm.Connections < 0 || r.Prewarm.Connections > 100 {
+			return fmt.Errorf("prewarm.connections must be between 0 and 100")
+		}
+		if r.Prewarm.Timeout < 0 {
+			return fmt.Errorf("prewarm.timeout must not be negative")
+		}
+	}
+	if r.Middlewares != nil && r.Middlewares.Compression != nil {
+		for _, encoding := range r.Middlewares.Compression.Encodings {
+			if encoding != "br" && encoding != "gzip" {
+				return fmt.Errorf("invalid compression encoding: %s", encoding)
+			}
+		}
+		switch r.Middlewares.Compression.UpstreamAcceptEncoding {
+		case "", UpstreamAcceptEncodingForward, UpstreamAcceptEncodingStrip, UpstreamAcceptEncodingGateway:
+		default:
+			return fmt.Errorf("invalid compression upstream_accept_encoding: %s", r.Middlewares.Compression.UpstreamAcceptEncoding)
+		}
+	}
+	if r.Middlewares != nil && r.Middlewares.RequestDecompression != nil {
+		for _, encoding := range r.Middlewares.RequestDecompression.Encodings {
+			switch encoding {
+			case "gzip", "x-gzip", "br", "deflate":
+				// Decodable request codings
+			default:
+				return fmt.Errorf("invalid request_decompression encoding: %s", encoding)
+			}
+		}
+	}
+	if r.Middlewares != nil && r.Middlewares.Cache != nil && r.Middlewares.Cache.MaxSize < 0 {
+		return fmt.Errorf("cache.max_size must not be negative")
+	}
+	if r.Middlewares != nil && r.Middlewares.RateLimit != nil {
+		if r.Middlewares.RateLimitRef != "" {
+			return fmt.Errorf("rate_limit and rate_limit_ref are mutually exclusive")
+		}
+		if err := r.Middlewares.RateLimit.Validate(); err != nil {
+			return fmt.Errorf("invalid rate_limit: %w", err)
+		}
+	}
+	if r.BlueGreen != nil {
+		if err := r.BlueGreen.Validate(); err != nil {
+			return err
+		}
+	}
+	if r.CatchAll && r.Protocol != ProtocolHTTP {
+		return fmt.Errorf("catch_all is only supported for HTTP routes")
+	}
 
 	// Validate endpoint protocol
 	if r.EndpointsProtocol != "" {
@@ -147,44 +862,686 @@ func (r *Route) Validate() error {
 		r.EndpointsProtocol = r.Protocol
 	}
 
+	// Validate conditional header removals
+	if r.Middlewares != nil && r.Middlewares.HeaderTransform != nil {
+		for i, removal := range r.Middlewares.HeaderTransform.RemoveIf {
+			if removal.Header == "" {
+				return fmt.Errorf("header_transform.remove_if[%d] requires a header", i)
+			}
+			switch removal.Phase {
+			case "", HeaderPhaseRequest, HeaderPhaseResponse:
+			default:
+				return fmt.Errorf("invalid header_transform.remove_if[%d].phase: %s", i, removal.Phase)
+			}
+			if _, err := regexp.Compile(removal.Matches); err != nil {
+				return fmt.Errorf("invalid header_transform.remove_if[%d].matches: %w", i, err)
+			}
+		}
+	}
+
+	// Validate request validation settings
+	if r.Middlewares != nil && r.Middlewares.RequestValidation != nil {
+		for _, contentType := range r.Middlewares.RequestValidation.AllowedContentTypes {
+			mediaType, subtype, ok := strings.Cut(contentType, "/")
+			if !ok || mediaType == "" || subtype == "" {
+				return fmt.Errorf("invalid middlewares.request_validation.allowed_content_types entry: %s", contentType)
+			}
+		}
+		for _, header := range r.Middlewares.RequestValidation.RequiredHeaders {
+			if header == "" {
+				return fmt.Errorf("middlewares.request_validation.required_headers contains an empty header name")
+			}
+		}
+	}
+
+	// Validate response validation settings
+	if r.Middlewares != nil && r.Middlewares.ResponseValidation != nil && r.Middlewares.ResponseValidation.Enabled {
+		validation := r.Middlewares.ResponseValidation
+		if validation.Spec == "" {
+			return fmt.Errorf("middlewares.response_validation.spec is required")
+		}
+		if validation.SamplePercent < 0 || validation.SamplePercent > 100 {
+			return fmt.Errorf("middlewares.response_validation.sample_percent must be between 0 and 100")
+		}
+		if validation.MaxBodySize < 0 {
+			return fmt.Errorf("middlewares.response_validation.max_body_size must not be negative")
+		}
+	}
+
+	// Validate field encryption settings
+	if r.Middlewares != nil && r.Middlewares.FieldEncryption != nil && r.Middlewares.FieldEncryption.Enabled {
+		if err := r.Middlewares.FieldEncryption.validate(); err != nil {
+			return fmt.Errorf("invalid middlewares.field_encryption: %w", err)
+		}
+	}
+
+	// Validate response redaction rules
+	if r.Middlewares != nil && r.Middlewares.Redaction != nil && r.Middlewares.Redaction.Enabled {
+		if len(r.Middlewares.Redaction.Rules) == 0 {
+			return fmt.Errorf("middlewares.redaction requires rules")
+		}
+		for i, rule := range r.Middlewares.Redaction.Rules {
+			if len(rule.Fields) == 0 {
+				return fmt.Errorf("middlewares.redaction.rules[%d] requires fields", i)
+			}
+			if err := validateFieldPaths(rule.Fields); err != nil {
+				return fmt.Errorf("invalid middlewares.redaction.rules[%d]: %w", i, err)
+			}
+		}
+		if r.Middlewares.Redaction.MaxBodySize < 0 {
+			return fmt.Errorf("middlewares.redaction.max_body_size must not be negative")
+		}
+	}
+
+	// Validate request priority settings
+	if r.Middlewares != nil && r.Middlewares.Priority != nil && r.Middlewares.Priority.Enabled {
+		priority := r.Middlewares.Priority
+		if priority.Default != "" {
+			if _, err := ParsePriority(priority.Default); err != nil {
+				return fmt.Errorf("invalid middlewares.priority.default: %w", err)
+			}
+		}
+		if priority.MinUrgency < 0 || priority.MinUrgency > MaxUrgency {
+			return fmt.Errorf("middlewares.priority.min_urgency must be between 0 and %d", MaxUrgency)
+		}
+		if priority.MaxConcurrent < 0 || priority.MaxQueue < 0 || priority.QueueTimeoutMs < 0 {
+			return fmt.Errorf("middlewares.priority max_concurrent, max_queue and queue_timeout_ms must not be negative")
+		}
+	}
+
+	// Validate circuit breaker failure classification
+	if r.Middlewares != nil && r.Middlewares.CircuitBreaker != nil && r.Middlewares.CircuitBreaker.FailureOn != nil {
+		if err := r.Middlewares.CircuitBreaker.FailureOn.Validate(); err != nil {
+			return fmt.Errorf("invalid middlewares.circuit_breaker.failure_on: %w", err)
+		}
+	}
+
+	// Validate MQTT settings
+	if r.Middlewares != nil && r.Middlewares.MQTT != nil && r.Middlewares.MQTT.Enabled {
+		if r.Protocol != ProtocolHTTP {
+			return fmt.Errorf("middlewares.mqtt is only supported for HTTP routes")
+		}
+		if r.Middlewares.MQTT.MaxConnectionsPerDevice < 0 {
+			return fmt.Errorf("middlewares.mqtt.max_connections_per_device must not be negative")
+		}
+		for _, subprotocol := range r.Middlewares.MQTT.Subprotocols {
+			if subprotocol == "" {
+				return fmt.Errorf("middlewares.mqtt.subprotocols contains an empty subprotocol")
+			}
+		}
+	}
+
+	// Validate route labels
+	for name := range r.Labels {
+		if !labelNamePattern.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid label name: %q", name)
+		}
+		if reservedLabelNames[name] {
+			return fmt.Errorf("label name %q is reserved", name)
+		}
+	}
+
+	// Validate SLO targets
+	if r.SLO != nil {
+		if r.SLO.Availability == 0 && r.SLO.LatencyThresholdMs == 0 {
+			return fmt.Errorf("slo requires availability or latency_threshold_ms")
+		}
+		if r.SLO.Availability < 0 || r.SLO.Availability >= 100 {
+			return fmt.Errorf("invalid slo.availability: %v", r.SLO.Availability)
+		}
+		if r.SLO.LatencyThresholdMs < 0 {
+			return fmt.Errorf("invalid slo.latency_threshold_ms: %d", r.SLO.LatencyThresholdMs)
+		}
+		if r.SLO.LatencyTarget < 0 || r.SLO.LatencyTarget >= 100 {
+			return fmt.Errorf("invalid slo.latency_target: %v", r.SLO.LatencyTarget)
+		}
+		if r.SLO.LatencyThresholdMs > 0 && r.SLO.LatencyTarget == 0 && r.SLO.Availability == 0 {
+			return fmt.Errorf("slo.latency_target is required without an availability target")
+		}
+	}
+
+	// Validate dial settings
+	if r.Dial != nil {
+		if err := r.Dial.Validate(); err != nil {
+			return fmt.Errorf("invalid dial: %w", err)
+		}
+	}
+
+	// Validate health check probe settings
+	if r.LoadBalancing != nil && r.LoadBalancing.HealthCheckConfig != nil {
+		hc := r.LoadBalancing.HealthCheckConfig
+		switch hc.Type {
+		case "", HealthCheckHTTP, HealthCheckTCP:
+			// Valid probe types
+		default:
+			return fmt.Errorf("invalid health_check_config.type: %s", hc.Type)
+		}
+		switch hc.Scheme {
+		case "", "http", "https":
+			// Valid probe schemes
+		default:
+			return fmt.Errorf("invalid health_check_config.scheme: %s", hc.Scheme)
+		}
+		for _, status := range hc.ExpectedStatuses {
+			if status < 100 || status > 599 {
+				return fmt.Errorf("invalid health_check_config.expected_statuses entry: %d", status)
+			}
+		}
+	}
+
+	// Validate slow start settings
+	if r.LoadBalancing != nil && r.LoadBalancing.SlowStart != nil {
+		if r.LoadBalancing.SlowStart.Duration < 0 {
+			return fmt.Errorf("invalid load_balancing.slow_start.duration: %d", r.LoadBalancing.SlowStart.Duration)
+		}
+		if r.LoadBalancing.SlowStart.MinWeight <= 0 || r.LoadBalancing.SlowStart.MinWeight > 1 {
+			return fmt.Errorf("invalid load_balancing.slow_start.min_weight: %v, must be above 0 and at most 1", r.LoadBalancing.SlowStart.MinWeight)
+		}
+	}
+
+	// Validate session affinity settings
+	if r.LoadBalancing != nil && r.LoadBalancing.SessionAffinity != nil && r.LoadBalancing.SessionAffinity.Enabled {
+		if r.LoadBalancing.SessionAffinity.Secret == "" {
+			return fmt.Errorf("load_balancing.session_affinity.secret is required")
+		}
+		if r.LoadBalancing.SessionAffinity.MaxAge < 0 {
+			return fmt.Errorf("invalid load_balancing.session_affinity.max_age: %d", r.LoadBalancing.SessionAffinity.MaxAge)
+		}
+	}
+
+	// Validate JWT requirements
+	if r.Middlewares != nil && r.Middlewares.JWT != nil {
+		if r.Middlewares.JWT.MaxAge < 0 {
+			return fmt.Errorf("invalid middlewares.jwt.max_age: %d", r.Middlewares.JWT.MaxAge)
+		}
+		for claim := range r.Middlewares.JWT.Claims {
+			if claim == "" {
+				return fmt.Errorf("middlewares.jwt.claims contains an empty claim name")
+			}
+		}
+	}
+
+	// Validate external authorization settings
+	if r.Middlewares != nil && r.Middlewares.ExtAuthz != nil && r.Middlewares.ExtAuthz.Enabled {
+		authzURL, err := url.Parse(r.Middlewares.ExtAuthz.URL)
+		switch r.Middlewares.ExtAuthz.Mode {
+		case "", ExtAuthzModeHTTP:
+			if err != nil || (authzURL.Scheme != "http" && authzURL.Scheme != "https") || authzURL.Host == "" {
+				return fmt.Errorf("invalid middlewares.ext_authz.url: %s", r.Middlewares.ExtAuthz.URL)
+			}
+		case ExtAuthzModeGRPC:
+			if err != nil || (authzURL.Scheme != "grpc" && authzURL.Scheme != "grpcs") || authzURL.Host == "" || authzURL.Port() == "" {
+				return fmt.Errorf("invalid middlewares.ext_authz.url, expected grpc://host:port or grpcs://host:port: %s", r.Middlewares.ExtAuthz.URL)
+			}
+		default:
+			return fmt.Errorf("invalid middlewares.ext_authz.mode: %s", r.Middlewares.ExtAuthz.Mode)
+		}
+		if r.Middlewares.ExtAuthz.TimeoutMs < 0 || r.Middlewares.ExtAuthz.CacheTTL < 0 {
+			return fmt.Errorf("middlewares.ext_authz timeout_ms and cache_ttl must not be negative")
+		}
+	}
+
+	// Validate OPA policy settings
+	if r.Middlewares != nil && r.Middlewares.OPA != nil && r.Middlewares.OPA.Enabled {
+		if r.Middlewares.OPA.Policy == "" {
+			return fmt.Errorf("middlewares.opa.policy is required")
+		}
+		if r.Middlewares.OPA.TimeoutMs < 0 {
+			return fmt.Errorf("invalid middlewares.opa.timeout_ms: %d", r.Middlewares.OPA.TimeoutMs)
+		}
+	}
+
+	// Validate response body rewriting
+	if r.Middlewares != nil && r.Middlewares.BodyRewrite != nil && r.Middlewares.BodyRewrite.Enabled {
+		for _, rule := range r.Middlewares.BodyRewrite.Rules {
+			if rule.From == "" {
+				return fmt.Errorf("middlewares.body_rewrite.rules entries require from")
+			}
+		}
+		if r.Middlewares.BodyRewrite.MaxSize < 0 {
+			return fmt.Errorf("invalid middlewares.body_rewrite.max_size: %d", r.Middlewares.BodyRewrite.MaxSize)
+		}
+	}
+
+	// Validate middleware order override
+	if err := ValidateMiddlewareOrder(r.MiddlewareOrder); err != nil {
+		return fmt.Errorf("invalid middleware_order: %w", err)
+	}
+
+	// Validate forward proxy settings
+	if r.UpstreamProxy != "" {
+		proxyURL, err := url.Parse(r.UpstreamProxy)
+		if err != nil {
+			return fmt.Errorf("invalid upstream_proxy: %w", err)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5", "socks5h":
+			// Valid proxy schemes
+		default:
+			return fmt.Errorf("invalid upstream_proxy scheme: %s", proxyURL.Scheme)
+		}
+		if proxyURL.Host == "" {
+			return fmt.Errorf("upstream_proxy host is required")
+		}
+		if strings.HasPrefix(proxyURL.Scheme, "socks5") && proxyURL.Port() == "" {
+			return fmt.Errorf("upstream_proxy port is required for SOCKS proxies")
+		}
+	}
+
+	// Validate the upstream of test traffic
+	if r.SandboxUpstream != "" {
+		sandboxURL, err := url.Parse(r.SandboxUpstream)
+		if err != nil || (sandboxURL.Scheme != "http" && sandboxURL.Scheme != "https") || sandboxURL.Host == "" {
+			return fmt.Errorf("invalid sandbox_upstream: %s", r.SandboxUpstream)
+		}
+	}
+
+	// Validate the upstream host and server name overrides
+	if r.UpstreamHostHeader != "" && !validHost(r.UpstreamHostHeader) {
+		return fmt.Errorf("invalid upstream_host_header: %s", r.UpstreamHostHeader)
+	}
+	if r.UpstreamSNI != "" && (strings.Contains(r.UpstreamSNI, ":") || !validHost(r.UpstreamSNI)) {
+		return fmt.Errorf("invalid upstream_sni: %s", r.UpstreamSNI)
+	}
+
+	// Validate the upstream's workload identity
+	if r.UpstreamSPIFFEID != "" && !ValidSPIFFEID(r.UpstreamSPIFFEID) {
+		return fmt.Errorf("invalid upstream_spiffe_id: %s", r.UpstreamSPIFFEID)
+	}
+
+	// Validate outbound request signing
+	if r.Signing != nil {
+		switch r.Signing.Type {
+		case SigningAWSSigV4:
+			if r.Signing.AWS == nil || r.Signing.AWS.Region == "" || r.Signing.AWS.Service == "" {
+				return fmt.Errorf("signing.aws requires region and service")
+			}
+			if (r.Signing.AWS.AccessKeyID == "") != (r.Signing.AWS.SecretAccessKey == "") {
+				return fmt.Errorf("signing.aws access_key_id and secret_access_key must be set together")
+			}
+			if r.Signing.AWS.SessionToken != "" && r.Signing.AWS.AccessKeyID == "" {
+				return fmt.Errorf("signing.aws session_token requires access_key_id and secret_access_key")
+			}
+			if r.Signing.AWS.STSEndpoint != "" {
+				stsURL, err := url.Parse(r.Signing.AWS.STSEndpoint)
+				if err != nil || (stsURL.Scheme != "https" && stsURL.Scheme != "http") || stsURL.Host == "" {
+					return fmt.Errorf("invalid signing.aws.sts_endpoint: %s", r.Signing.AWS.STSEndpoint)
+				}
+			}
+		case SigningHMAC:
+			if r.Signing.HMAC == nil || r.Signing.HMAC.Secret == "" {
+				return fmt.Errorf("signing.hmac.secret is required")
+			}
+			switch r.Signing.HMAC.Algorithm {
+			case "", "sha256", "sha512":
+				// Supported digests
+			default:
+				return fmt.Errorf("invalid signing.hmac.algorithm: %s", r.Signing.HMAC.Algorithm)
+			}
+		default:
+			return fmt.Errorf("invalid signing.type: %s", r.Signing.Type)
+		}
+	}
+
 	// Additional gRPC-specific validation
 	if r.Protocol == ProtocolGRPC {
 		if r.RPCServer == "" {
 			return fmt.Errorf("rpc_server is required for gRPC routes")
 		}
 	}
+	if r.Protocol == ProtocolGRPCWebSocket {
+		if r.GRPCBridge == nil {
+			return fmt.Errorf("grpc_bridge is required for GRPC_WEBSOCKET routes")
+		}
+		service, method, ok := strings.Cut(r.GRPCBridge.Method, "/")
+		if !ok || service == "" || method == "" || strings.Contains(method, "/") {
+			return fmt.Errorf("invalid grpc_bridge.method: %s", r.GRPCBridge.Method)
+		}
+		if r.GRPCBridge.MaxMessageSize < 0 {
+			return fmt.Errorf("grpc_bridge.max_message_size must not be negative")
+		}
+	}
+	if r.GRPCMetadata != nil {
+		if r.Protocol != ProtocolGRPC {
+			return fmt.Errorf("grpc_metadata is only supported on gRPC routes")
+		}
+		if err := r.GRPCMetadata.Validate(); err != nil {
+			return fmt.Errorf("invalid grpc_metadata.%w", err)
+		}
+	}
 
+	if r.SOAP != nil && r.SOAP.Enabled {
+		if err := r.validateSOAP(); err != nil {
+			return err
+		}
+	}
+	if r.ContentRouting != nil {
+		if err := r.validateContentRouting(); err != nil {
+			return err
+		}
+	}
+	if r.SplitHorizon != nil {
+		if err := r.validateSplitHorizon(); err != nil {
+			return err
+		}
+	}
+	if r.Spool != nil && r.Spool.Enabled {
+		if r.Protocol != ProtocolHTTP {
+			return fmt.Errorf("spool is only supported for HTTP routes")
+		}
+		if r.Spool.MaxBodySize < 0 || r.Spool.MaxDiskUsage < 0 || r.Spool.MemoryThreshold < 0 {
+			return fmt.Errorf("spool.max_body_size, spool.max_disk_usage and spool.memory_threshold must not be negative")
+		}
+	}
+
+	return nil
+}
+
+// validateSOAP checks the SOAP operations and limits, and that the route
+// forwards bodies as they are
+func (r *Route) validateSOAP() error {
+	if r.Protocol != ProtocolHTTP || r.EndpointsProtocol == ProtocolGRPC {
+		return fmt.Errorf("soap is only supported for HTTP routes with HTTP endpoints")
+	}
+	if r.SOAP.MaxBodySize < 0 || r.SOAP.MaxDepth < 0 {
+		return fmt.Errorf("soap.max_body_size and soap.max_depth must not be negative")
+	}
+	if r.SOAP.PassThrough && r.Middlewares != nil && r.Middlewares.BodyRewrite != nil && r.Middlewares.BodyRewrite.Enabled {
+		return fmt.Errorf("soap.pass_through routes can't enable body_rewrite")
+	}
+	for i, operation := range r.SOAP.Operations {
+		if operation.SOAPAction == "" && operation.RootElement == "" {
+			return fmt.Errorf("soap.operations[%d] requires a soap_action or root_element", i)
+		}
+		if operation.RootElement != "" && r.SOAP.PassThrough {
+			return fmt.Errorf("soap.operations[%d]: root_element can't be matched in pass_through mode", i)
+		}
+		if operation.Upstream == "" && (operation.LoadBalancing == nil || len(operation.LoadBalancing.Endpoints) == 0) {
+			return fmt.Errorf("soap.operations[%d] requires an upstream", i)
+		}
+	}
+	return nil
+}
+
+// validateContentRouting checks the path and rules of content routing, and
+// that the route is an HTTP route not already dispatching another way
+func (r *Route) validateContentRouting() error {
+	if r.Protocol != ProtocolHTTP || r.EndpointsProtocol == ProtocolGRPC {
+		return fmt.Errorf("content_routing is only supported for HTTP routes with HTTP endpoints")
+	}
+	if (r.SOAP != nil && r.SOAP.Enabled) || r.BlueGreen != nil {
+		return fmt.Errorf("content_routing can't be combined with soap or blue_green")
+	}
+	if _, err := ParseContentPath(r.ContentRouting.RouteOn); err != nil {
+		return fmt.Errorf("invalid content_routing.route_on: %w", err)
+	}
+	if r.ContentRouting.MaxBodySize < 0 {
+		return fmt.Errorf("content_routing.max_body_size must not be negative")
+	}
+	if len(r.ContentRouting.Rules) == 0 {
+		return fmt.Errorf("content_routing requires rules")
+	}
+	for i, rule := range r.ContentRouting.Rules {
+		if len(rule.Values) == 0 {
+			return fmt.Errorf("content_routing.rules[%d] requires values", i)
+		}
+		if rule.Upstream == "" && (rule.LoadBalancing == nil || len(rule.LoadBalancing.Endpoints) == 0) {
+			return fmt.Errorf("content_routing.rules[%d] requires an upstream", i)
+		}
+	}
+	return nil
+}
+
+// validateSplitHorizon checks that an HTTP route not already dispatching
+// another way has an internal upstream
+func (r *Route) validateSplitHorizon() error {
+	if r.Protocol != ProtocolHTTP || r.EndpointsProtocol == ProtocolGRPC {
+		return fmt.Errorf("split_horizon is only supported for HTTP routes with HTTP endpoints")
+	}
+	if (r.SOAP != nil && r.SOAP.Enabled) || r.ContentRouting != nil || r.BlueGreen != nil {
+		return fmt.Errorf("split_horizon can't be combined with soap, content_routing or blue_green")
+	}
+	if r.SplitHorizon.Upstream == "" && (r.SplitHorizon.LoadBalancing == nil || len(r.SplitHorizon.LoadBalancing.Endpoints) == 0) {
+		return fmt.Errorf("split_horizon requires an upstream")
+	}
+	return nil
+}
+
+// Validate checks that both upstream groups are set and the rollback limits
+func (b *BlueGreenConfig) Validate() error {
+	switch b.Active {
+	case "", DeploymentBlue, DeploymentGreen:
+	default:
+		return fmt.Errorf("invalid blue_green.active: %s", b.Active)
+	}
+	if b.Blue == nil || b.Blue.Upstream == "" || b.Green == nil || b.Green.Upstream == "" {
+		return fmt.Errorf("blue_green requires blue.upstream and green.upstream")
+	}
+	if b.Rollback != nil {
+		if err := b.Rollback.Validate(); err != nil {
+			return fmt.Errorf("invalid blue_green.rollback: %w", err)
+		}
+	}
+	return nil
+}
+
+// Validate checks the bake window and error rate limits
+func (g *RollbackGuard) Validate() error {
+	if !g.Enabled {
+		return nil
+	}
+	if g.BakeWindow < 0 || g.MinRequests < 0 {
+		return fmt.Errorf("bake_window and min_requests must not be negative")
+	}
+	if g.MaxErrorRate <= 0 || g.MaxErrorRate > 100 {
+		return fmt.Errorf("max_error_rate must be between 0 and 100")
+	}
+	return nil
+}
+
+// SetDefaults fills in the bake window and minimum request count
+func (g *RollbackGuard) SetDefaults() {
+	if g.BakeWindow == 0 {
+		g.BakeWindow = 300
+	}
+	if g.MinRequests == 0 {
+		g.MinRequests = 20
+	}
+}
+
+// ResolveRateLimitRefs sets the rate limit of routes referencing a named limit.
+// Routes sharing a reference share one set of buckets.
+func (rc *RouteConfig) ResolveRateLimitRefs(limits map[string]RateLimitConfig) error {
+	for i, route := range rc.Routes {
+		ref := route.Middlewares.RateLimitRef
+		if ref == "" {
+			continue
+		}
+		limit, ok := limits[ref]
+		if !ok {
+			return fmt.Errorf("route %s references unknown rate limit: %s", route.Path, ref)
+		}
+		rc.Routes[i].Middlewares.RateLimit = &limit
+	}
 	return nil
 }
 
 // LoadRoutes loads route configurations from a YAML file
 func LoadRoutes(path string) (*RouteConfig, error) {
-	routesFile, err := os.Open(path)
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open routes file: %w", err)
 	}
-	defer routesFile.Close()
+	return ParseRoutes(data)
+}
 
-	var routeConfig RouteConfig
-	decoder := yaml.NewDecoder(routesFile)
-	if err := decoder.Decode(&routeConfig); err != nil {
+// Validate checks the route defaults
+func (d *RouteDefaults) Validate() error {
+	if d.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	if d.RateLimit != nil && d.RateLimitRef != "" {
+		return fmt.Errorf("rate_limit and rate_limit_ref are mutually exclusive")
+	}
+	if d.RateLimit != nil {
+		if err := d.RateLimit.Validate(); err != nil {
+			return fmt.Errorf("invalid rate_limit: %w", err)
+		}
+	}
+	return nil
+}
+
+// apply sets the defaults a route doesn't set itself. Routes get copies so
+// filling in their own defaults leaves the other routes untouched.
+func (d *RouteDefaults) apply(route *Route) {
+	if route.Timeout == 0 {
+		route.Timeout = d.Timeout
+	}
+	if route.Middlewares == nil {
+		route.Middlewares = &Middlewares{}
+	}
+	m := route.Middlewares
+	if m.RetryPolicy == nil && d.RetryPolicy != nil {
+		policy := *d.RetryPolicy
+		m.RetryPolicy = &policy
+	}
+	// A route with its own limit, named or not, doesn't inherit either
+	if m.RateLimit == nil && m.RateLimitRef == "" {
+		if d.RateLimit != nil {
+			limit := *d.RateLimit
+			m.RateLimit = &limit
+		}
+		m.RateLimitRef = d.RateLimitRef
+	}
+	if m.Cache == nil && d.Cache != nil {
+		cache := *d.Cache
+		m.Cache = &cache
+	}
+	if d.HeaderTransform != nil {
+		m.HeaderTransform = mergeHeaderTransforms(d.HeaderTransform, m.HeaderTransform)
+	}
+}
+
+// mergeHeaderTransforms returns the default header transform with the route's
+// merged in. Headers set by both take the route's value.
+func mergeHeaderTransforms(defaults, route *HeaderTransform) *HeaderTransform {
+	merged := &HeaderTransform{
+		Request:  make(map[string]string, len(defaults.Request)),
+		Response: make(map[string]string, len(defaults.Response)),
+		Remove:   append([]string(nil), defaults.Remove...),
+		RemoveIf: append([]HeaderRemoval(nil), defaults.RemoveIf...),
+	}
+	for name, value := range defaults.Request {
+		merged.Request[name] = value
+	}
+	for name, value := range defaults.Response {
+		merged.Response[name] = value
+	}
+	if route == nil {
+		return merged
+	}
+	for name, value := range route.Request {
+		merged.Request[name] = value
+	}
+	for name, value := range route.Response {
+		merged.Response[name] = value
+	}
+	merged.Remove = append(merged.Remove, route.Remove...)
+	merged.RemoveIf = append(merged.RemoveIf, route.RemoveIf...)
+	return merged
+}
+
+// ParseRoutes parses and validates route configurations, filling in defaults
+func ParseRoutes(data []byte) (*RouteConfig, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
 		return nil, fmt.Errorf("failed to parse routes file: %w", err)
 	}
+	// Legacy settings are normalized before templates spread them to routes
+	deprecations, err := normalizeDocument(&doc)
+	if err != nil {
+		return nil, err
+	}
+	if err := expandRouteTemplates(&doc); err != nil {
+		return nil, fmt.Errorf("invalid route templates: %w", err)
+	}
+
+	var routeConfig RouteConfig
+	if doc.Kind != 0 {
+		if err := doc.Decode(&routeConfig); err != nil {
+			return nil, fmt.Errorf("failed to parse routes file: %w", err)
+		}
+	}
+
+	routeConfig.Deprecations = deprecations
+
+	// Routes inherit the shared defaults before they are validated
+	if routeConfig.Defaults != nil {
+		if err := routeConfig.Defaults.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid route defaults: %w", err)
+		}
+		for i := range routeConfig.Routes {
+			routeConfig.Defaults.apply(&routeConfig.Routes[i])
+		}
+	}
 
 	// Validate routes
+	catchAll := ""
 	for i, route := range routeConfig.Routes {
 		if err := route.Validate(); err != nil {
 			return nil, fmt.Errorf("invalid route at index %d: %w", i, err)
 		}
+		if route.CatchAll {
+			if catchAll != "" {
+				return nil, fmt.Errorf("invalid route at index %d: catch_all is already set on %s", i, catchAll)
+			}
+			catchAll = route.Path
+		}
 
-		if len(route.Methods) == 0 && route.Protocol != ProtocolGRPC {
+		if route.Middlewares == nil {
+			routeConfig.Routes[i].Middlewares = &Middlewares{}
+			route.Middlewares = routeConfig.Routes[i].Middlewares
+		}
+
+		if len(route.Methods) == 0 && route.Protocol == ProtocolStatic {
+			// Files are only read
+			routeConfig.Routes[i].Methods = []string{"GET", "HEAD"}
+		} else if len(route.Methods) == 0 && route.Protocol == ProtocolGRPCWebSocket {
+			// WebSocket handshakes are GET requests
+			routeConfig.Routes[i].Methods = []string{"GET"}
+		} else if len(route.Methods) == 0 && route.Protocol != ProtocolGRPC {
 			// Default to all methods if none specified for HTTP routes
 			routeConfig.Routes[i].Methods = []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS", "HEAD"}
 		}
+		if route.GRPCBridge != nil && route.GRPCBridge.MaxMessageSize == 0 {
+			routeConfig.Routes[i].GRPCBridge.MaxMessageSize = 1 << 20
+		}
+		if route.Static != nil && route.Static.Index == "" {
+			routeConfig.Routes[i].Static.Index = "index.html"
+		}
+		if route.Prewarm != nil && route.Prewarm.Enabled {
+			if route.Prewarm.Connections == 0 {
+				routeConfig.Routes[i].Prewarm.Connections = 2
+			}
+			if route.Prewarm.Path == "" {
+				routeConfig.Routes[i].Prewarm.Path = "/health"
+			}
+			if route.Prewarm.Timeout == 0 {
+				routeConfig.Routes[i].Prewarm.Timeout = 10
+			}
+		}
+		if route.Compat != nil && route.Compat.MaxBufferSize == 0 {
+			// Buffer request bodies of up to 10MB
+			routeConfig.Routes[i].Compat.MaxBufferSize = 10 << 20
+		}
 		if route.Timeout == 0 {
 			// Default timeout of 30 seconds
 			routeConfig.Routes[i].Timeout = 30
 		}
+		if route.Protocol == ProtocolGRPC && route.GRPCDeadline == 0 {
+			// gRPC calls without a deadline get the route's timeout
+			routeConfig.Routes[i].GRPCDeadline = routeConfig.Routes[i].Timeout
+		}
 
 		// Set defaults for retry policy
 		if route.Middlewares.RetryPolicy != nil && route.Middlewares.RetryPolicy.Enabled {
@@ -196,6 +1553,172 @@ func LoadRoutes(path string) (*RouteConfig, error) {
 			}
 		}
 
+		// Set defaults for blue/green deployments
+		if route.BlueGreen != nil {
+			if route.BlueGreen.Active == "" {
+				routeConfig.Routes[i].BlueGreen.Active = DeploymentBlue
+			}
+			if route.BlueGreen.Rollback != nil && route.BlueGreen.Rollback.Enabled {
+				routeConfig.Routes[i].BlueGreen.Rollback.SetDefaults()
+			}
+		}
+
+		// Set defaults for session affinity
+		if route.LoadBalancing != nil && route.LoadBalancing.SessionAffinity != nil && route.LoadBalancing.SessionAffinity.CookieName == "" {
+			routeConfig.Routes[i].LoadBalancing.SessionAffinity.CookieName = "GW_AFFINITY"
+		}
+
+		// Set defaults for request hedging
+		if route.Hedging != nil && route.Hedging.Enabled {
+			if route.Hedging.BudgetPercent == 0 {
+				routeConfig.Routes[i].Hedging.BudgetPercent = 10
+			}
+			if len(route.Hedging.Methods) == 0 {
+				routeConfig.Routes[i].Hedging.Methods = []string{"GET", "HEAD"}
+			}
+		}
+
+		// The compression flag enables response compression with defaults
+		if route.Compression && route.Middlewares.Compression == nil {
+			routeConfig.Routes[i].Middlewares.Compression = &ResponseCompression{Enabled: true}
+			route.Middlewares.Compression = routeConfig.Routes[i].Middlewares.Compression
+		}
+
+		// Set defaults for response compression
+		if route.Middlewares.Compression != nil && route.Middlewares.Compression.Enabled {
+			compression := routeConfig.Routes[i].Middlewares.Compression
+			if len(compression.Encodings) == 0 {
+				compression.Encodings = []string{"br", "gzip"}
+			}
+			if compression.MinSize == 0 {
+				compression.MinSize = 1024
+			}
+			if len(compression.ContentTypes) == 0 {
+				compression.ContentTypes = []string{
+					"text/", "application/json", "application/javascript", "application/xml", "image/svg+xml",
+				}
+			}
+			if compression.UpstreamAcceptEncoding == "" {
+				compression.UpstreamAcceptEncoding = UpstreamAcceptEncodingForward
+			}
+		}
+
+		// The gateway answers OPTIONS itself, so the route must accept it
+		if route.Middlewares.RequestValidation != nil && route.Middlewares.RequestValidation.Enabled &&
+			route.Middlewares.RequestValidation.HandleOptions && len(routeConfig.Routes[i].Methods) > 0 {
+			hasOptions := false
+			for _, method := range routeConfig.Routes[i].Methods {
+				if strings.EqualFold(method, "OPTIONS") {
+					hasOptions = true
+				}
+			}
+			if !hasOptions {
+				routeConfig.Routes[i].Methods = append(routeConfig.Routes[i].Methods, "OPTIONS")
+			}
+		}
+
+		// Set defaults for response validation
+		if route.Middlewares.ResponseValidation != nil && route.Middlewares.ResponseValidation.Enabled {
+			if route.Middlewares.ResponseValidation.SamplePercent == 0 {
+				routeConfig.Routes[i].Middlewares.ResponseValidation.SamplePercent = 10
+			}
+			if route.Middlewares.ResponseValidation.MaxBodySize == 0 {
+				routeConfig.Routes[i].Middlewares.ResponseValidation.MaxBodySize = 1 << 20 // 1MB
+			}
+		}
+
+		// Set defaults for field encryption
+		if route.Middlewares.FieldEncryption != nil && route.Middlewares.FieldEncryption.Enabled {
+			if route.Middlewares.FieldEncryption.MaxBodySize == 0 {
+				routeConfig.Routes[i].Middlewares.FieldEncryption.MaxBodySize = 1 << 20 // 1MB
+			}
+		}
+
+		// Set defaults for response redaction
+		if route.Middlewares.Redaction != nil && route.Middlewares.Redaction.Enabled {
+			if route.Middlewares.Redaction.MaxBodySize == 0 {
+				routeConfig.Routes[i].Middlewares.Redaction.MaxBodySize = 1 << 20 // 1MB
+			}
+		}
+
+		// Set defaults for request priority
+		if route.Middlewares.Priority != nil && route.Middlewares.Priority.Enabled {
+			if route.Middlewares.Priority.MaxQueue == 0 {
+				routeConfig.Routes[i].Middlewares.Priority.MaxQueue = route.Middlewares.Priority.MaxConcurrent
+			}
+			if route.Middlewares.Priority.QueueTimeoutMs == 0 {
+				routeConfig.Routes[i].Middlewares.Priority.QueueTimeoutMs = 1000
+			}
+		}
+
+		// Set defaults for request collapsing
+		if route.Middlewares.Collapse != nil && route.Middlewares.Collapse.Enabled {
+			if route.Middlewares.Collapse.MaxBodySize == 0 {
+				routeConfig.Routes[i].Middlewares.Collapse.MaxBodySize = 1 << 20 // 1MB
+			}
+		}
+
+		// Set defaults for SOAP inspection
+		if route.SOAP != nil && route.SOAP.Enabled {
+			if route.SOAP.MaxBodySize == 0 {
+				routeConfig.Routes[i].SOAP.MaxBodySize = 1 << 20 // 1MB
+			}
+			if route.SOAP.MaxDepth == 0 {
+				routeConfig.Routes[i].SOAP.MaxDepth = 64
+			}
+		}
+
+		// Set defaults for content routing
+		if route.ContentRouting != nil && route.ContentRouting.MaxBodySize == 0 {
+			routeConfig.Routes[i].ContentRouting.MaxBodySize = 64 << 10 // 64KB
+		}
+
+		// Set defaults for request spooling
+		if route.Spool != nil && route.Spool.Enabled {
+			if route.Spool.MaxBodySize == 0 {
+				routeConfig.Routes[i].Spool.MaxBodySize = 10 << 30 // 10GB
+			}
+			if route.Spool.MemoryThreshold == 0 {
+				routeConfig.Routes[i].Spool.MemoryThreshold = 64 << 10 // 64KB
+			}
+		}
+
+		// Set defaults for MQTT over WebSockets
+		if route.Middlewares.MQTT != nil && route.Middlewares.MQTT.Enabled {
+			if len(route.Middlewares.MQTT.Subprotocols) == 0 {
+				routeConfig.Routes[i].Middlewares.MQTT.Subprotocols = []string{"mqtt", "mqttv3.1"}
+			}
+		}
+
+		// Set defaults for external authorization
+		if route.Middlewares.ExtAuthz != nil && route.Middlewares.ExtAuthz.Enabled {
+			if route.Middlewares.ExtAuthz.Mode == "" {
+				routeConfig.Routes[i].Middlewares.ExtAuthz.Mode = ExtAuthzModeHTTP
+			}
+			if route.Middlewares.ExtAuthz.TimeoutMs == 0 {
+				routeConfig.Routes[i].Middlewares.ExtAuthz.TimeoutMs = 500
+			}
+		}
+
+		// Set defaults for response body rewriting
+		if route.Middlewares.BodyRewrite != nil && route.Middlewares.BodyRewrite.Enabled {
+			if len(route.Middlewares.BodyRewrite.ContentTypes) == 0 {
+				routeConfig.Routes[i].Middlewares.BodyRewrite.ContentTypes = []string{
+					"text/html", "application/json", "application/javascript", "text/css", "application/xml",
+				}
+			}
+			if route.Middlewares.BodyRewrite.MaxSize == 0 {
+				routeConfig.Routes[i].Middlewares.BodyRewrite.MaxSize = 10 << 20 // 10MB
+			}
+		}
+
+		// Set defaults for OPA policy evaluation
+		if route.Middlewares.OPA != nil && route.Middlewares.OPA.Enabled {
+			if route.Middlewares.OPA.TimeoutMs == 0 {
+				routeConfig.Routes[i].Middlewares.OPA.TimeoutMs = 500
+			}
+		}
+
 		// Set defaults for circuit breaker
 		if route.Middlewares.CircuitBreaker != nil && route.Middlewares.CircuitBreaker.Enabled {
 			if route.Middlewares.CircuitBreaker.Threshold == 0 {
@@ -212,7 +1735,36 @@ func LoadRoutes(path string) (*RouteConfig, error) {
 				routeConfig.Routes[i].Middlewares.Cache.TTL = 60
 			}
 		}
+
+		// Set defaults for request decompression
+		if route.Middlewares.RequestDecompression != nil && route.Middlewares.RequestDecompression.Enabled {
+			if len(route.Middlewares.RequestDecompression.Encodings) == 0 {
+				routeConfig.Routes[i].Middlewares.RequestDecompression.Encodings = []string{"gzip", "br"}
+			}
+			if route.Middlewares.RequestDecompression.MaxSize == 0 {
+				routeConfig.Routes[i].Middlewares.RequestDecompression.MaxSize = 10 << 20 // 10MB
+			}
+		}
 	}
 
 	return &routeConfig, nil
 }
+
+// UpstreamServerName returns the TLS server name sent to the upstream, or an
+// empty string to use the upstream URL's hostname
+func (r *Route) UpstreamServerName() string {
+	if r.UpstreamSNI != "" {
+		return r.UpstreamSNI
+	}
+	if r.UpstreamHostHeader != "" {
+		return (&url.URL{Host: r.UpstreamHostHeader}).Hostname()
+	}
+	return ""
+}
+
+// validHost reports whether host is a host or host:port usable in a Host
+// header
+func validHost(host string) bool {
+	u, err := url.Parse("http://" + host)
+	return err == nil && u.Host == host && u.Hostname() != "" && u.User == nil
+}
@@ -0,0 +1,31 @@
+package config
+
+import "fmt"
+
+// TestTrafficConfig identifies end-to-end test requests by a token signed
+// with the shared secret. Test requests go to the route's sandbox_upstream
+// and are left out of usage, metrics and SLOs, and out of rate limits when
+// sent to a sandbox.
+type TestTrafficConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Header  string `yaml:"header"`  // Request header carrying the token, X-Test-Traffic by default
+	Secret  string `yaml:"secret"`  // HMAC key signing tokens
+	MaxAge  int    `yaml:"max_age"` // Seconds a token may be valid for at most, a day by default
+	// Reject test requests to routes without a sandbox upstream instead of
+	// sending them to the route's upstream
+	RequireSandbox bool `yaml:"require_sandbox"`
+}
+
+// Validate checks that enabled test traffic has a secret
+func (c *TestTrafficConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Secret == "" {
+		return fmt.Errorf("secret is required")
+	}
+	if c.MaxAge < 0 {
+		return fmt.Errorf("max_age must not be negative")
+	}
+	return nil
+}
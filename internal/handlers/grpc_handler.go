@@ -39,11 +39,18 @@ func NewGRPCHandler(route *config.Route, log logger.Logger) (*GRPCHandler, error
 	}, nil
 }
 
+// SetDescriptors looks up methods not compiled into the gateway in the
+// descriptor registry
+func (h *GRPCHandler) SetDescriptors(descriptors *proxy.DescriptorRegistry) {
+	h.grpcProxy.SetDescriptors(descriptors)
+}
+
 // ForwardUnary forwards a unary gRPC request to the upstream service
 func (h *GRPCHandler) ForwardUnary(
 	ctx context.Context,
 	fullMethodName string,
 	requestMessage proto.Message,
+	opts ...grpc.CallOption,
 ) (proto.Message, metadata.MD, error) {
 	h.mu.RLock()
 	target := h.route.Upstream
@@ -56,7 +63,7 @@ func (h *GRPCHandler) ForwardUnary(
 	}
 
 	// Forward the gRPC request
-	return h.grpcProxy.ForwardGRPC(ctx, fullMethodName, target, requestMessage)
+	return h.grpcProxy.ForwardGRPC(ctx, fullMethodName, target, requestMessage, opts...)
 }
 
 // ServerStreamForwarder handles server streaming gRPC methods
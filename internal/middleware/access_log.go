@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/util"
+	"api-gateway/pkg/logger"
+)
+
+// AccessLogger writes one log entry per request, sampling successful requests
+// while keeping every error, slow request and explicitly debugged request
+type AccessLogger struct {
+	config   *config.AccessLogConfig
+	redactor *LogRedactor
+	log      logger.Logger
+}
+
+// NewAccessLogger creates a new access log middleware
+func NewAccessLogger(config *config.AccessLogConfig, log logger.Logger) *AccessLogger {
+	redactor, err := NewLogRedactor(&config.Redaction)
+	if err != nil {
+		log.Error("Invalid access log redaction, masking logged values whole",
+			logger.Error(err),
+		)
+	}
+	return &AccessLogger{
+		config:   config,
+		redactor: redactor,
+		log:      log,
+	}
+}
+
+// Log records requests to the route. Routes without a configured tag are not
+// logged unless the request carries the debug header.
+func (a *AccessLogger) Log(next http.Handler, route config.Route) http.Handler {
+	tagged := a.routeTagged(route)
+
+	// Each route samples independently so busy routes don't crowd out quiet ones
+	var counter uint64
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		debug := a.config.DebugHeader != "" && r.Header.Get(a.config.DebugHeader) != ""
+		if !tagged && !debug {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r, caller := withRequestCaller(r)
+		var body *bodyCapture
+		if a.config.LogBodyBytes > 0 && hasBody(r) {
+			body = &bodyCapture{ReadCloser: r.Body, limit: a.config.LogBodyBytes}
+			r.Body = body
+		}
+		start := time.Now()
+		recorder := &statusRecorder{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+		}
+		next.ServeHTTP(recorder, r)
+		duration := time.Since(start)
+
+		reason := a.logReason(debug, recorder.statusCode, duration, &counter)
+		if reason == "" {
+			return
+		}
+
+		fields := []logger.Field{
+			logger.String("method", r.Method),
+			logger.String("path", a.redactor.Path(r.URL.Path)),
+			logger.String("route", route.Path),
+			logger.Int("status", recorder.statusCode),
+			logger.Int("duration_ms", int(duration.Milliseconds())),
+			logger.Int("bytes", int(recorder.bytes)),
+			logger.String("client_ip", util.GetClientIP(r)),
+			logger.String("user_agent", r.UserAgent()),
+			logger.String("reason", reason),
+		}
+		if a.config.LogQuery && r.URL.RawQuery != "" {
+			fields = append(fields, logger.String("query", a.redactor.Query(r.URL.RawQuery)))
+		}
+		if headers := a.redactor.Headers(r.Header, a.config.LogHeaders); len(headers) > 0 {
+			fields = append(fields, logger.Any("headers", headers))
+		}
+		if body != nil && len(body.data) > 0 {
+			fields = append(fields, logger.String("body", a.redactor.Body(r.Header.Get("Content-Type"), body.data)))
+		}
+		if requestID := RequestIDFromContext(r.Context()); requestID != "" {
+			fields = append(fields, logger.String("request_id", requestID))
+		}
+		if IsTestTraffic(r) {
+			fields = append(fields, logger.Bool("test_traffic", true))
+		}
+		if identity := caller.identity; identity != nil {
+			fields = append(fields, logger.String("auth_type", identity.Type))
+			if identity.Subject != "" {
+				fields = append(fields, logger.String("subject", identity.Subject))
+			}
+			if identity.Tenant != "" {
+				fields = append(fields, logger.String("tenant", identity.Tenant))
+			}
+		}
+		if len(route.Labels) > 0 {
+			fields = append(fields, logger.Any("labels", route.Labels))
+		}
+		a.log.Info("Access log", fields...)
+	})
+}
+
+// routeTagged reports whether the route passes the tag filter
+func (a *AccessLogger) routeTagged(route config.Route) bool {
+	if len(a.config.Tags) == 0 {
+		return true
+	}
+	for _, want := range a.config.Tags {
+		for _, tag := range route.Tags {
+			if tag == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// logReason returns why a completed request is logged, or an empty string if
+// it is sampled out
+func (a *AccessLogger) logReason(debug bool, status int, duration time.Duration, counter *uint64) string {
+	switch {
+	case debug:
+		return "debug"
+	case a.config.MinErrorStatus > 0 && status >= a.config.MinErrorStatus:
+		return "error"
+	case a.config.SlowThresholdMs > 0 && duration >= time.Duration(a.config.SlowThresholdMs)*time.Millisecond:
+		return "slow"
+	}
+
+	rate := uint64(a.config.SampleRate)
+	if rate <= 1 || atomic.AddUint64(counter, 1)%rate == 1 {
+		return "sampled"
+	}
+	return ""
+}
+
+// statusRecorder captures the status code and size of a response without
+// buffering it
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	bytes       int64
+	wroteHeader bool
+}
+
+// WriteHeader captures the status code
+func (w *statusRecorder) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.statusCode = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write counts the response bytes
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush sends buffered data to the client
+func (w *statusRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack lets upgraded connections bypass the recorder
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingLogger counts the info entries it receives
+type recordingLogger struct {
+	mockLogger
+	mutex   sync.Mutex
+	entries []map[string]interface{}
+}
+
+func (l *recordingLogger) Info(msg string, fields ...logger.Field) {
+	entry := make(map[string]interface{})
+	for _, field := range fields {
+		entry[field.Key] = field.Value
+	}
+	l.mutex.Lock()
+	l.entries = append(l.entries, entry)
+	l.mutex.Unlock()
+}
+
+func (l *recordingLogger) count() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.entries)
+}
+
+func statusHandler(status int, delay time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.WriteHeader(status)
+		w.Write([]byte("ok"))
+	})
+}
+
+func TestAccessLogger_Sampling(t *testing.T) {
+	log := &recordingLogger{}
+	accessLogger := NewAccessLogger(&config.AccessLogConfig{
+		SampleRate:     10,
+		MinErrorStatus: 500,
+		DebugHeader:    "X-Debug-Log",
+	}, log)
+	route := config.Route{Path: "/api"}
+
+	t.Run("successful requests are sampled", func(t *testing.T) {
+		handler := accessLogger.Log(statusHandler(http.StatusOK, 0), route)
+		for i := 0; i < 25; i++ {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/items", nil))
+		}
+		assert.Equal(t, 3, log.count())
+		assert.Equal(t, "sampled", log.entries[0]["reason"])
+		assert.Equal(t, http.StatusOK, log.entries[0]["status"])
+		assert.Equal(t, 2, log.entries[0]["bytes"])
+	})
+
+	t.Run("errors are always logged", func(t *testing.T) {
+		log.entries = nil
+		handler := accessLogger.Log(statusHandler(http.StatusBadGateway, 0), route)
+		for i := 0; i < 5; i++ {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/items", nil))
+		}
+		assert.Equal(t, 5, log.count())
+		assert.Equal(t, "error", log.entries[4]["reason"])
+	})
+
+	t.Run("debug header forces logging", func(t *testing.T) {
+		log.entries = nil
+		handler := accessLogger.Log(statusHandler(http.StatusOK, 0), route)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/items", nil))
+		for i := 0; i < 3; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/api/items", nil)
+			req.Header.Set("X-Debug-Log", "1")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}
+		assert.Equal(t, 4, log.count())
+		assert.Equal(t, "debug", log.entries[3]["reason"])
+	})
+}
+
+func TestAccessLogger_SlowRequests(t *testing.T) {
+	log := &recordingLogger{}
+	accessLogger := NewAccessLogger(&config.AccessLogConfig{
+		SampleRate:      1000,
+		SlowThresholdMs: 10,
+	}, log)
+	route := config.Route{Path: "/api"}
+
+	fast := accessLogger.Log(statusHandler(http.StatusOK, 0), route)
+	fast.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api", nil))
+	fast.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api", nil))
+	assert.Equal(t, 1, log.count())
+
+	slow := accessLogger.Log(statusHandler(http.StatusOK, 20*time.Millisecond), route)
+	slow.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api", nil))
+	slow.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api", nil))
+	assert.Equal(t, 3, log.count())
+	assert.Equal(t, "slow", log.entries[2]["reason"])
+}
+
+func TestAccessLogger_Tags(t *testing.T) {
+	log := &recordingLogger{}
+	accessLogger := NewAccessLogger(&config.AccessLogConfig{
+		SampleRate:     1,
+		MinErrorStatus: 500,
+		Tags:           []string{"payments"},
+		DebugHeader:    "X-Debug-Log",
+	}, log)
+
+	tagged := accessLogger.Log(statusHandler(http.StatusOK, 0), config.Route{Path: "/pay", Tags: []string{"payments"}})
+	untagged := accessLogger.Log(statusHandler(http.StatusInternalServerError, 0), config.Route{Path: "/other"})
+
+	tagged.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/pay", nil))
+	untagged.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/other", nil))
+	assert.Equal(t, 1, log.count())
+	assert.Equal(t, "/pay", log.entries[0]["route"])
+
+	req := httptest.NewRequest(http.MethodGet, "/other", nil)
+	req.Header.Set("X-Debug-Log", "true")
+	untagged.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, 2, log.count())
+	assert.Equal(t, http.StatusInternalServerError, log.entries[1]["status"])
+}
+
+func TestAccessLogger_Identity(t *testing.T) {
+	log := &recordingLogger{}
+	accessLogger := NewAccessLogger(&config.AccessLogConfig{SampleRate: 1}, log)
+
+	// The auth middleware runs inside the access log
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recordCaller(r.Context(), &auth.Identity{Type: auth.IdentityAPIKey, Subject: "user-1", Tenant: "acme"})
+		w.WriteHeader(http.StatusOK)
+	})
+	accessLogger.Log(inner, config.Route{Path: "/api"}).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api", nil))
+
+	assert.Equal(t, 1, log.count())
+	assert.Equal(t, "api_key", log.entries[0]["auth_type"])
+	assert.Equal(t, "user-1", log.entries[0]["subject"])
+	assert.Equal(t, "acme", log.entries[0]["tenant"])
+}
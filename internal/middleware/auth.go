@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
 
 	"api-gateway/internal/auth"
@@ -24,6 +26,32 @@ func NewAuthMiddleware(authService *auth.AuthService, authConfig *config.AuthCon
 	}
 }
 
+// requestCallerKey is the context key of the request's requestCaller
+type requestCallerKey struct{}
+
+// requestCaller receives the identity the auth middleware authenticated deeper
+// in the chain, so handlers wrapping the chain can attribute the request
+type requestCaller struct {
+	identity *auth.Identity
+}
+
+// withRequestCaller returns the request's caller, adding one to its context
+// if an outer handler hasn't already
+func withRequestCaller(r *http.Request) (*http.Request, *requestCaller) {
+	if caller, ok := r.Context().Value(requestCallerKey{}).(*requestCaller); ok {
+		return r, caller
+	}
+	caller := &requestCaller{}
+	return r.WithContext(context.WithValue(r.Context(), requestCallerKey{}, caller)), caller
+}
+
+// recordCaller stores the authenticated identity in the request's caller
+func recordCaller(ctx context.Context, identity *auth.Identity) {
+	if caller, ok := ctx.Value(requestCallerKey{}).(*requestCaller); ok {
+		caller.identity = identity
+	}
+}
+
 // safeError is a helper function to safely write error responses
 func safeError(w http.ResponseWriter, msg string, statusCode int) {
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
@@ -33,6 +61,24 @@ func safeError(w http.ResponseWriter, msg string, statusCode int) {
 	w.Write([]byte(msg))
 }
 
+// authError sends the response for a failed authentication
+func authError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrNoToken):
+		safeError(w, "Authorization required", http.StatusUnauthorized)
+	case errors.Is(err, auth.ErrInvalidToken), errors.Is(err, auth.ErrExpiredToken),
+		errors.Is(err, auth.ErrInvalidAudience), errors.Is(err, auth.ErrInvalidIssuer),
+		errors.Is(err, auth.ErrTokenTooOld):
+		safeError(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, auth.ErrForbidden), errors.Is(err, auth.ErrClaimMismatch):
+		safeError(w, "Forbidden: Insufficient permissions", http.StatusForbidden)
+	case errors.Is(err, auth.ErrQuotaExceeded):
+		safeError(w, err.Error(), http.StatusTooManyRequests)
+	default:
+		safeError(w, "Authentication failed", http.StatusUnauthorized)
+	}
+}
+
 // Authenticate checks if the request has valid authentication
 func (m *AuthMiddleware) Authenticate(next http.Handler, route config.Route) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -56,7 +102,7 @@ func (m *AuthMiddleware) Authenticate(next http.Handler, route config.Route) htt
 		}
 
 		// Validate the token - passing empty slice for allowedRoles to skip role checking
-		valid, err := m.authService.ValidateToken(r, []string{})
+		identity, err := m.authService.Authenticate(r, []string{}, route.Middlewares.JWT)
 		if err != nil {
 			m.log.Debug("Authentication failed",
 				logger.String("path", r.URL.Path),
@@ -64,21 +110,11 @@ func (m *AuthMiddleware) Authenticate(next http.Handler, route config.Route) htt
 				logger.Error(err),
 			)
 
-			// Send appropriate error response using our safe error function
-			switch err {
-			case auth.ErrNoToken:
-				safeError(w, "Authorization required", http.StatusUnauthorized)
-			case auth.ErrInvalidToken, auth.ErrExpiredToken:
-				safeError(w, err.Error(), http.StatusUnauthorized)
-			case auth.ErrForbidden:
-				safeError(w, "Forbidden: Insufficient permissions", http.StatusForbidden)
-			default:
-				safeError(w, "Authentication failed", http.StatusUnauthorized)
-			}
+			authError(w, err)
 			return
 		}
 
-		if !valid {
+		if identity == nil {
 			m.log.Debug("Authentication invalid",
 				logger.String("path", r.URL.Path),
 				logger.String("method", r.Method),
@@ -87,7 +123,9 @@ func (m *AuthMiddleware) Authenticate(next http.Handler, route config.Route) htt
 			return
 		}
 
-		// Authentication succeeded, continue to the next handler
-		next.ServeHTTP(w, r)
+		// Authentication succeeded, expose the caller to inner handlers and
+		// to the usage recorder and access log wrapping the chain
+		recordCaller(r.Context(), identity)
+		next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), identity)))
 	})
 }
@@ -318,3 +318,53 @@ func TestAuthenticateWithAPIKey(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Equal(t, "test-api-key", receivedAPIKey)
 }
+
+func TestAuthenticateWithJWTConstraints(t *testing.T) {
+	middleware := NewAuthMiddleware(createTestAuthService(), &config.AuthConfig{APIKeyHeader: "X-API-Key"}, &mockLogger{})
+
+	route := config.Route{
+		Path: "/orders",
+		Middlewares: &config.Middlewares{
+			RequireAuth: true,
+			JWT: &config.JWTValidation{
+				Issuer: "https://issuer.example.com",
+				Claims: map[string]string{"tenant": "acme"},
+			},
+		},
+	}
+	handler := middleware.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The authenticated caller is available to inner handlers
+		identity := auth.IdentityFromContext(r.Context())
+		assert.NotNil(t, identity)
+		assert.Equal(t, auth.IdentityJWT, identity.Type)
+		assert.Equal(t, "acme", identity.Claims["tenant"])
+		w.WriteHeader(http.StatusOK)
+	}), route)
+
+	sign := func(claims jwt.MapClaims) string {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret"))
+		return token
+	}
+
+	tests := []struct {
+		name     string
+		claims   jwt.MapClaims
+		expected int
+	}{
+		{"matching claims", jwt.MapClaims{"iss": "https://issuer.example.com", "tenant": "acme"}, http.StatusOK},
+		{"wrong issuer", jwt.MapClaims{"iss": "https://other.example.com", "tenant": "acme"}, http.StatusUnauthorized},
+		{"wrong tenant", jwt.MapClaims{"iss": "https://issuer.example.com", "tenant": "globex"}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/orders", nil)
+			req.Header.Set("Authorization", "Bearer "+sign(tt.claims))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+			assert.Equal(t, tt.expected, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// BodyRewriter replaces upstream absolute URLs in responses with the gateway's
+// external URL
+type BodyRewriter struct {
+	log logger.Logger
+}
+
+// NewBodyRewriter creates a new response body rewriting middleware
+func NewBodyRewriter(log logger.Logger) *BodyRewriter {
+	return &BodyRewriter{
+		log: log,
+	}
+}
+
+// rewriteRule is a resolved replacement
+type rewriteRule struct {
+	from []byte
+	to   []byte
+}
+
+// Rewrite streams matching responses through the route's URL replacements.
+// Rules default to mapping the route upstream and endpoints to the external URL.
+func (b *BodyRewriter) Rewrite(next http.Handler, route config.Route) http.Handler {
+	cfg := route.Middlewares.BodyRewrite
+	if cfg == nil || !cfg.Enabled {
+		return next
+	}
+
+	rules := cfg.Rules
+	if len(rules) == 0 {
+		rules = []config.BodyRewriteRule{{From: route.Upstream}}
+		if route.LoadBalancing != nil {
+			for _, endpoint := range route.LoadBalancing.Endpoints {
+				rules = append(rules, config.BodyRewriteRule{From: endpoint})
+			}
+		}
+	}
+
+	maxSize := cfg.MaxSize
+	if maxSize <= 0 {
+		maxSize = 10 << 20
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		external := externalBaseURL(r, route)
+		resolved := make([]rewriteRule, 0, len(rules))
+		for _, rule := range rules {
+			to := rule.To
+			if to == "" {
+				to = external
+			}
+			from := strings.TrimRight(rule.From, "/")
+			if from == "" {
+				continue
+			}
+			resolved = append(resolved, rewriteRule{from: []byte(from), to: []byte(strings.TrimRight(to, "/"))})
+		}
+
+		// Ask for an identity encoded response so the body can be rewritten
+		r.Header.Del("Accept-Encoding")
+
+		rw := &bodyRewriteWriter{
+			ResponseWriter: w,
+			rules:          resolved,
+			contentTypes:   cfg.ContentTypes,
+			maxSize:        maxSize,
+		}
+		next.ServeHTTP(rw, r)
+
+		if err := rw.finish(); err != nil {
+			b.log.Debug("Failed to write rewritten response",
+				logger.String("path", r.URL.Path),
+				logger.Error(err),
+			)
+		}
+	})
+}
+
+// externalBaseURL returns the URL clients use to reach the route's upstream root
+func externalBaseURL(r *http.Request, route config.Route) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = strings.TrimSpace(strings.Split(proto, ",")[0])
+	}
+
+	base := scheme + "://" + r.Host
+	if route.StripPrefix {
+		base += strings.TrimRight(strings.TrimSuffix(route.Path, "*"), "/")
+	}
+	return base
+}
+
+// bodyRewriteWriter rewrites eligible response bodies as they are written
+type bodyRewriteWriter struct {
+	http.ResponseWriter
+	rules        []rewriteRule
+	contentTypes []string
+	maxSize      int64
+
+	wroteHeader bool
+	replacer    *streamReplacer
+}
+
+// WriteHeader decides whether the response is rewritten and adjusts headers
+func (w *bodyRewriteWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	header := w.Header()
+	for _, name := range []string{"Location", "Content-Location"} {
+		if value := header.Get(name); value != "" {
+			header.Set(name, string(replaceAll([]byte(value), w.rules)))
+		}
+	}
+
+	if w.shouldRewrite(header) {
+		header.Del("Content-Length")
+		header.Del("ETag")
+		w.replacer = newStreamReplacer(w.ResponseWriter, w.rules, w.maxSize)
+	}
+
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// shouldRewrite checks content type, encoding and declared size
+func (w *bodyRewriteWriter) shouldRewrite(header http.Header) bool {
+	if encoding := header.Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		return false
+	}
+	if length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil && length > w.maxSize {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, allowed := range w.contentTypes {
+		if strings.EqualFold(mediaType, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// Write passes the body through the replacer if the response is rewritten
+func (w *bodyRewriteWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.replacer == nil {
+		return w.ResponseWriter.Write(p)
+	}
+	return w.replacer.Write(p)
+}
+
+// Flush sends the rewritten output written so far to the client, holding
+// back only a possible partial match
+func (w *bodyRewriteWriter) Flush() {
+	if w.replacer != nil {
+		if err := w.replacer.Flush(); err != nil {
+			return
+		}
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// finish writes any data held back while waiting for a possible match
+func (w *bodyRewriteWriter) finish() error {
+	if w.replacer == nil {
+		return nil
+	}
+	return w.replacer.Close()
+}
+
+// streamReplacer replaces rule matches in a byte stream, holding back only a
+// possible partial match between writes. Input beyond limit passes through unchanged.
+type streamReplacer struct {
+	out       io.Writer
+	rules     []rewriteRule
+	limit     int64
+	processed int64
+	pending   []byte
+}
+
+// newStreamReplacer creates a replacer trying longer matches first
+func newStreamReplacer(out io.Writer, rules []rewriteRule, limit int64) *streamReplacer {
+	sorted := append([]rewriteRule(nil), rules...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].from) > len(sorted[j].from)
+	})
+	return &streamReplacer{out: out, rules: sorted, limit: limit}
+}
+
+// Write rewrites p and writes the settled output
+func (s *streamReplacer) Write(p []byte) (int, error) {
+	if s.processed >= s.limit {
+		if err := s.process(true); err != nil {
+			return 0, err
+		}
+		return s.out.Write(p)
+	}
+
+	s.processed += int64(len(p))
+	s.pending = append(s.pending, p...)
+
+	if err := s.process(false); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes the pending data that can no longer start a match. Past the
+// limit, later input passes through unchanged, so the whole tail is written.
+func (s *streamReplacer) Flush() error {
+	return s.process(s.processed >= s.limit)
+}
+
+// Close rewrites and writes the held back tail
+func (s *streamReplacer) Close() error {
+	return s.process(true)
+}
+
+// process rewrites the pending data, holding back a possible partial match at
+// the end unless final is set
+func (s *streamReplacer) process(final bool) error {
+	var out bytes.Buffer
+	i := 0
+	for i < len(s.pending) {
+		if !final && s.partialAt(i) {
+			break
+		}
+		if rule, ok := s.matchAt(i); ok {
+			out.Write(rule.to)
+			i += len(rule.from)
+			continue
+		}
+		out.WriteByte(s.pending[i])
+		i++
+	}
+	s.pending = append(s.pending[:0], s.pending[i:]...)
+
+	if out.Len() == 0 {
+		return nil
+	}
+	_, err := s.out.Write(out.Bytes())
+	return err
+}
+
+// matchAt returns the rule matching the pending data at offset i
+func (s *streamReplacer) matchAt(i int) (rewriteRule, bool) {
+	for _, rule := range s.rules {
+		if bytes.HasPrefix(s.pending[i:], rule.from) {
+			return rule, true
+		}
+	}
+	return rewriteRule{}, false
+}
+
+// partialAt reports whether the pending data from i is an incomplete match
+func (s *streamReplacer) partialAt(i int) bool {
+	rest := s.pending[i:]
+	for _, rule := range s.rules {
+		if len(rest) < len(rule.from) && bytes.HasPrefix(rule.from, rest) {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceAll applies the rules to a complete value
+func replaceAll(value []byte, rules []rewriteRule) []byte {
+	var out bytes.Buffer
+	replacer := newStreamReplacer(&out, rules, math.MaxInt64)
+	replacer.Write(value)
+	replacer.Close()
+	return out.Bytes()
+}
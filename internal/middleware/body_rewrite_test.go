@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBodyRewriter(t *testing.T) {
+	route := config.Route{
+		Path:        "/users/*",
+		Upstream:    "http://users-svc:8080",
+		StripPrefix: true,
+		Middlewares: &config.Middlewares{
+			BodyRewrite: &config.BodyRewrite{
+				Enabled:      true,
+				ContentTypes: []string{"application/json", "text/html"},
+				MaxSize:      1 << 20,
+			},
+		},
+	}
+
+	serve := func(route config.Route, upstream http.HandlerFunc) *httptest.ResponseRecorder {
+		handler := NewBodyRewriter(&mockLogger{}).Rewrite(upstream, route)
+		req := httptest.NewRequest(http.MethodGet, "http://api.example.com/users/1", nil)
+		req.Header.Set("X-Forwarded-Proto", "https")
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("rewrites upstream URLs to the external URL", func(t *testing.T) {
+		rec := serve(route, func(w http.ResponseWriter, r *http.Request) {
+			assert.Empty(t, r.Header.Get("Accept-Encoding"))
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Header().Set("Content-Length", "64")
+			w.Header().Set("Location", "http://users-svc:8080/1")
+			w.Write([]byte(`{"self":"http://users-svc:8080/1","other":"http://billing:9000/1"}`))
+		})
+
+		assert.Equal(t, `{"self":"https://api.example.com/users/1","other":"http://billing:9000/1"}`, rec.Body.String())
+		assert.Equal(t, "https://api.example.com/users/1", rec.Header().Get("Location"))
+		assert.Empty(t, rec.Header().Get("Content-Length"))
+	})
+
+	t.Run("matches split across writes", func(t *testing.T) {
+		rec := serve(route, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<a href="http://users-s`))
+			w.Write([]byte(`vc:8080/profile">me</a> http://users-svc:80`))
+			w.Write([]byte(`80`))
+		})
+
+		assert.Equal(t, `<a href="https://api.example.com/users/profile">me</a> https://api.example.com/users`, rec.Body.String())
+	})
+
+	t.Run("skips other content types and encoded bodies", func(t *testing.T) {
+		rec := serve(route, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/svg+xml")
+			w.Write([]byte(`http://users-svc:8080/logo`))
+		})
+		assert.Equal(t, `http://users-svc:8080/logo`, rec.Body.String())
+
+		rec = serve(route, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Encoding", "br")
+			w.Write([]byte(`http://users-svc:8080/raw`))
+		})
+		assert.Equal(t, `http://users-svc:8080/raw`, rec.Body.String())
+	})
+
+	t.Run("size limits", func(t *testing.T) {
+		limited := route
+		limited.Middlewares = &config.Middlewares{BodyRewrite: &config.BodyRewrite{
+			Enabled:      true,
+			ContentTypes: []string{"text/html"},
+			MaxSize:      32,
+		}}
+
+		// Declared oversized bodies are not rewritten
+		rec := serve(limited, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Content-Length", "100")
+			w.Write([]byte(`http://users-svc:8080/a`))
+		})
+		assert.Equal(t, `http://users-svc:8080/a`, rec.Body.String())
+
+		// Streamed bodies are rewritten up to the limit and passed through after it
+		rec = serve(limited, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`http://users-svc:8080/a ` + strings.Repeat("x", 40)))
+			w.Write([]byte(` http://users-svc:8080/b`))
+		})
+		assert.True(t, strings.HasPrefix(rec.Body.String(), "https://api.example.com/users/a "))
+		assert.True(t, strings.HasSuffix(rec.Body.String(), " http://users-svc:8080/b"))
+	})
+
+	t.Run("explicit rules", func(t *testing.T) {
+		explicit := route
+		explicit.Middlewares = &config.Middlewares{BodyRewrite: &config.BodyRewrite{
+			Enabled:      true,
+			ContentTypes: []string{"application/json"},
+			Rules: []config.BodyRewriteRule{
+				{From: "http://internal", To: "https://public.example.com"},
+				{From: "http://internal:8443/"},
+			},
+		}}
+
+		rec := serve(explicit, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`["http://internal/a","http://internal:8443/b"]`))
+		})
+		assert.Equal(t, `["https://public.example.com/a","https://api.example.com/users/b"]`, rec.Body.String())
+	})
+}
+
+func TestStreamReplacerPrefersLongerMatches(t *testing.T) {
+	var out bytes.Buffer
+	replacer := newStreamReplacer(&out, []rewriteRule{
+		{from: []byte("http://a"), to: []byte("A")},
+		{from: []byte("http://a:8080"), to: []byte("B")},
+	}, 1<<20)
+
+	replacer.Write([]byte("http://a:80"))
+	replacer.Write([]byte("80/x http://a"))
+	replacer.Close()
+
+	assert.Equal(t, "B/x A", out.String())
+}
+
+func TestStreamReplacerFlush(t *testing.T) {
+	rules := []rewriteRule{{from: []byte("http://a"), to: []byte("A")}}
+
+	// Only a possible partial match is held back
+	var out bytes.Buffer
+	replacer := newStreamReplacer(&out, rules, 1<<20)
+	replacer.Write([]byte("data: x http://"))
+	assert.NoError(t, replacer.Flush())
+	assert.Equal(t, "data: x ", out.String())
+
+	// At the limit the tail can no longer match, so it is written out
+	out.Reset()
+	replacer = newStreamReplacer(&out, rules, 15)
+	replacer.Write([]byte("data: x http://"))
+	assert.NoError(t, replacer.Flush())
+	assert.Equal(t, "data: x http://", out.String())
+}
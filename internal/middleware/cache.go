@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"sync"
@@ -18,6 +19,9 @@ import (
 
 // CacheEntry represents a cached HTTP response
 type CacheEntry struct {
+	Namespace  string
+	Path       string
+	Subject    string // Caller the entry was cached for, on routes caching authenticated responses
 	StatusCode int
 	Body       []byte
 	Headers    http.Header
@@ -32,16 +36,46 @@ type CacheMiddleware struct {
 	log       logger.Logger
 	size      int
 	evictList []string // List of cache keys ordered by access time
+
+	// Entry counts and limits of the route namespaces
+	namespaces map[string]*cacheNamespace
+
+	// Disk persistence lifecycle
+	stopSnapshots chan struct{}
+	snapshotsDone chan struct{}
+
+	// Forwards purges to other gateway instances
+	broadcastPurge func(namespace, pathPattern, subject string) error
+
+	// Checks the callers of cache directives, returning the operator's subject
+	authorizeDirective func(r *http.Request) (string, bool)
+	credentialHeaders  []string
+}
+
+// cacheNamespace is the partition of the cache one or more routes store
+// their entries in
+type cacheNamespace struct {
+	maxSize int // Entries the namespace may hold, unlimited if 0
+	entries int
+	keys    []string // Insertion order for eviction, kept only with a maxSize
 }
 
 // NewCacheMiddleware creates a new cache middleware
 func NewCacheMiddleware(config *config.CacheConfig, log logger.Logger) *CacheMiddleware {
-	return &CacheMiddleware{
-		cache:     make(map[string]*CacheEntry),
-		config:    config,
-		log:       log,
-		evictList: make([]string, 0),
+	c := &CacheMiddleware{
+		cache:      make(map[string]*CacheEntry),
+		config:     config,
+		log:        log,
+		evictList:  make([]string, 0),
+		namespaces: make(map[string]*cacheNamespace),
 	}
+
+	// Warm from disk and keep snapshots fresh if persistence is enabled
+	if config.Enabled && config.Persistence.Enabled {
+		c.startSnapshots()
+	}
+
+	return c
 }
 
 // PurgeCache handles cache purge requests
@@ -52,38 +86,38 @@ func (c *CacheMiddleware) PurgeCache(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-
-	// Get the path pattern to purge from query parameter
+	// Get the path pattern or the user whose entries to purge from query
+	// parameters, and the namespace a path purge is limited to
 	pathPattern := r.URL.Query().Get("path")
+	subject := r.URL.Query().Get("user")
+	namespace := r.URL.Query().Get("namespace")
+	if subject != "" && (pathPattern != "" || namespace != "") {
+		http.Error(w, "path and namespace cannot be combined with user", http.StatusBadRequest)
+		return
+	}
 
-	beforeCount := len(c.cache)
-	if pathPattern != "" {
-		// Purge specific path pattern
-		for key := range c.cache {
-			if strings.Contains(key, pathPattern) {
-				delete(c.cache, key)
-			}
-		}
+	var purgedCount, afterCount int
+	if subject != "" {
+		purgedCount, afterCount = c.PurgeSubject(subject)
 	} else {
-		// Purge all cache if no path specified
-		c.cache = make(map[string]*CacheEntry)
+		purgedCount, afterCount = c.PurgeNamespace(namespace, pathPattern)
 	}
-	afterCount := len(c.cache)
-	purgedCount := beforeCount - afterCount
 
-	c.log.Info("Cache purged",
-		logger.String("path_pattern", pathPattern),
-		logger.Int("purged_entries", purgedCount),
-		logger.Int("remaining_entries", afterCount),
-	)
+	// Apply the same purge on every other gateway instance
+	propagated := false
+	if c.broadcastPurge != nil {
+		if err := c.broadcastPurge(namespace, pathPattern, subject); err != nil {
+			c.log.Error("Failed to propagate cache purge", logger.Error(err))
+		} else {
+			propagated = true
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
 	var message string
-	if pathPattern != "" {
+	if pathPattern != "" || subject != "" || namespace != "" {
 		message = "purged"
 	} else {
 		message = "all items purged"
@@ -94,10 +128,100 @@ func (c *CacheMiddleware) PurgeCache(w http.ResponseWriter, r *http.Request) {
 		"message":           message,
 		"purged_entries":    purgedCount,
 		"remaining_entries": afterCount,
+		"propagated":        propagated,
+	}
+	if namespace != "" {
+		response["namespace"] = namespace
 	}
 	json.NewEncoder(w).Encode(response)
 }
 
+// Purge removes cached entries whose key contains pathPattern, or every entry if
+// pathPattern is empty, and returns the purged and remaining entry counts
+func (c *CacheMiddleware) Purge(pathPattern string) (int, int) {
+	return c.PurgeNamespace("", pathPattern)
+}
+
+// PurgeNamespace is Purge limited to the entries of a namespace, or across
+// all namespaces if namespace is empty
+func (c *CacheMiddleware) PurgeNamespace(namespace, pathPattern string) (int, int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	beforeCount := len(c.cache)
+	if pathPattern != "" || namespace != "" {
+		// Purge specific path pattern, matching the request path since keys are hashed
+		for key, entry := range c.cache {
+			if namespace != "" && entry.Namespace != namespace {
+				continue
+			}
+			if pathPattern == "" || strings.Contains(entry.Path, pathPattern) || strings.Contains(key, pathPattern) {
+				c.remove(key)
+			}
+		}
+	} else {
+		// Purge all cache if no path specified
+		c.cache = make(map[string]*CacheEntry)
+		for name, ns := range c.namespaces {
+			ns.entries = 0
+			ns.keys = nil
+			cacheNamespaceEntries.WithLabelValues(name).Set(0)
+		}
+	}
+	afterCount := len(c.cache)
+	purgedCount := beforeCount - afterCount
+
+	c.log.Info("Cache purged",
+		logger.String("namespace", namespace),
+		logger.String("path_pattern", pathPattern),
+		logger.Int("purged_entries", purgedCount),
+		logger.Int("remaining_entries", afterCount),
+	)
+
+	return purgedCount, afterCount
+}
+
+// PurgeSubject removes the entries cached for an authenticated caller, so
+// data deletion requests reach the cache too, and returns the purged and
+// remaining entry counts
+func (c *CacheMiddleware) PurgeSubject(subject string) (int, int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	beforeCount := len(c.cache)
+	for key, entry := range c.cache {
+		if entry.Subject == subject {
+			c.remove(key)
+		}
+	}
+	afterCount := len(c.cache)
+	purgedCount := beforeCount - afterCount
+
+	// The subject itself is personal data, so it isn't logged
+	c.log.Info("Cache purged for user",
+		logger.Int("purged_entries", purgedCount),
+		logger.Int("remaining_entries", afterCount),
+	)
+
+	return purgedCount, afterCount
+}
+
+// SetPurgeBroadcaster registers a function that forwards purges received on the
+// purge endpoint to the other gateway instances. Purges of a user's entries
+// carry the user's subject and an empty namespace and path pattern.
+func (c *CacheMiddleware) SetPurgeBroadcaster(broadcast func(namespace, pathPattern, subject string) error) {
+	c.broadcastPurge = broadcast
+}
+
+// SetDirectiveAuthorizer registers the check of the operators allowed to send
+// cache directives. The credentialHeaders carrying their credentials are
+// removed from directive requests, so a refresh stores the response other
+// callers get, unless the route caches authenticated responses.
+func (c *CacheMiddleware) SetDirectiveAuthorizer(authorize func(r *http.Request) (string, bool), credentialHeaders ...string) {
+	c.authorizeDirective = authorize
+	c.credentialHeaders = credentialHeaders
+}
+
 // RegisterPurgeEndpoint registers the cache purge endpoint
 func (c *CacheMiddleware) RegisterPurgeEndpoint(router http.Handler) http.Handler {
 	if !c.config.Enabled || c.config.PurgeEndpoint == "" {
@@ -121,10 +245,29 @@ func (c *CacheMiddleware) RegisterPurgeEndpoint(router http.Handler) http.Handle
 
 // Cache middleware caches responses for GET requests
 func (c *CacheMiddleware) Cache(next http.Handler, route config.Route) http.Handler {
+	namespace := route.Path
+	if route.Middlewares.Cache != nil {
+		if route.Middlewares.Cache.Namespace != "" {
+			namespace = route.Middlewares.Cache.Namespace
+		}
+		c.setNamespaceLimit(namespace, route.Middlewares.Cache.MaxSize)
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Set X-Cache header for misses by default
 		w.Header().Set("X-Cache", "MISS")
 
+		// Apply the bypass or refresh directive of an operator
+		directive := ""
+		if c.config.Directives.Enabled {
+			r, directive = c.cacheDirective(r, route, namespace)
+		}
+		if directive == config.CacheDirectiveBypass {
+			w.Header().Set("X-Cache", "BYPASS")
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		// Skip caching if not enabled for this route or if it's not a GET request
 		if !c.shouldCache(r, route) {
 			next.ServeHTTP(w, r)
@@ -132,11 +275,19 @@ func (c *CacheMiddleware) Cache(next http.Handler, route config.Route) http.Hand
 		}
 
 		// Generate cache key from request
-		key := c.generateCacheKey(r)
-
-		// Try to get from cache
-		entry := c.getFromCache(key)
+		key := c.generateCacheKey(namespace, r)
+
+		// Try to get from cache, unless refreshing it
+		var entry *CacheEntry
+		if directive == config.CacheDirectiveRefresh {
+			w.Header().Set("X-Cache", "REFRESH")
+			// Have caches between the gateway and the upstream revalidate too
+			r.Header.Set("Cache-Control", "no-cache")
+		} else {
+			entry = c.getFromCache(key)
+		}
 		if entry != nil {
+			cacheNamespaceHits.WithLabelValues(namespace).Inc()
 			c.log.Debug("Cache hit",
 				logger.String("path", r.URL.Path),
 				logger.String("method", r.Method),
@@ -147,6 +298,7 @@ func (c *CacheMiddleware) Cache(next http.Handler, route config.Route) http.Hand
 		}
 
 		// If not in cache, capture the response
+		cacheNamespaceMisses.WithLabelValues(namespace).Inc()
 		c.log.Debug("Cache miss",
 			logger.String("path", r.URL.Path),
 			logger.String("method", r.Method),
@@ -154,14 +306,14 @@ func (c *CacheMiddleware) Cache(next http.Handler, route config.Route) http.Hand
 		)
 
 		// Create a buffer to store the response
-		buf := &bytes.Buffer{}
+		buf := getBuffer()
+		defer putBuffer(buf)
 
 		// Create a custom response writer to capture the response
 		crw := &cachingResponseWriter{
 			ResponseWriter: w,
 			buffer:         buf,
 			statusCode:     http.StatusOK,
-			headers:        make(http.Header),
 		}
 
 		// Process the request
@@ -178,11 +330,80 @@ func (c *CacheMiddleware) Cache(next http.Handler, route config.Route) http.Hand
 			return
 		}
 
-		// Store in cache
-		c.storeInCache(key, crw.statusCode, buf.Bytes(), crw.headers, ttl)
+		// Store in cache, copying the body out of the pooled buffer
+		c.storeInCache(key, namespace, r.URL.Path, cacheSubject(r, route), crw.statusCode, bytes.Clone(buf.Bytes()), crw.headers, ttl)
 	})
 }
 
+// cacheDirective returns the request without the directive header and query
+// parameter, and the directive to apply if an operator sent it. Directives
+// from other callers are ignored.
+func (c *CacheMiddleware) cacheDirective(r *http.Request, route config.Route, namespace string) (*http.Request, string) {
+	directives := &c.config.Directives
+	value := r.Header.Get(directives.Header)
+	inQuery := directives.QueryParam != "" && r.URL.Query().Has(directives.QueryParam)
+	if value == "" && !inQuery {
+		return r, ""
+	}
+
+	// The directive isn't part of the request that is cached or forwarded
+	r = r.Clone(r.Context())
+	r.Header.Del(directives.Header)
+	if inQuery {
+		if value == "" {
+			value = r.URL.Query().Get(directives.QueryParam)
+		}
+		r.URL.RawQuery = removeQueryParam(r.URL.RawQuery, directives.QueryParam)
+	}
+
+	directive := strings.ToLower(strings.TrimSpace(value))
+	if directive != config.CacheDirectiveBypass && directive != config.CacheDirectiveRefresh {
+		return r, ""
+	}
+
+	operator, ok := "", false
+	if c.authorizeDirective != nil {
+		operator, ok = c.authorizeDirective(r)
+	}
+	if !ok {
+		cacheDirectives.WithLabelValues(namespace, directive, "denied").Inc()
+		c.log.Warn("Ignored cache directive from a caller who isn't an operator",
+			logger.String("directive", directive),
+			logger.String("path", r.URL.Path),
+		)
+		return r, ""
+	}
+
+	if route.Middlewares.Cache == nil || !route.Middlewares.Cache.CacheAuthenticated {
+		for _, header := range c.credentialHeaders {
+			r.Header.Del(header)
+		}
+	}
+	cacheDirectives.WithLabelValues(namespace, directive, "applied").Inc()
+	c.log.Info("Applied cache directive",
+		logger.String("directive", directive),
+		logger.String("operator", operator),
+		logger.String("namespace", namespace),
+		logger.String("path", r.URL.Path),
+	)
+	return r, directive
+}
+
+// removeQueryParam removes a parameter from a query string, keeping the
+// others in order so the cache key doesn't change
+func removeQueryParam(rawQuery, name string) string {
+	parts := strings.Split(rawQuery, "&")
+	kept := parts[:0]
+	for _, part := range parts {
+		key, _, _ := strings.Cut(part, "=")
+		if unescaped, err := url.QueryUnescape(key); err == nil && unescaped == name {
+			continue
+		}
+		kept = append(kept, part)
+	}
+	return strings.Join(kept, "&")
+}
+
 // shouldCache determines if a request should be cached
 func (c *CacheMiddleware) shouldCache(r *http.Request, route config.Route) bool {
 	// Check if cache is globally disabled
@@ -214,10 +435,23 @@ func (c *CacheMiddleware) shouldCache(r *http.Request, route config.Route) bool
 	return true
 }
 
-// generateCacheKey creates a unique key for the cache entry
-func (c *CacheMiddleware) generateCacheKey(r *http.Request) string {
+// cacheSubject returns the caller an entry is cached for, so it can be purged
+// with the caller's data. Only routes caching authenticated responses tag
+// their entries.
+func cacheSubject(r *http.Request, route config.Route) string {
+	if !route.Middlewares.Cache.CacheAuthenticated {
+		return ""
+	}
+	if identity := IdentityFromContext(r.Context()); identity != nil {
+		return identity.Subject
+	}
+	return ""
+}
+
+// generateCacheKey creates a unique key for the cache entry within its namespace
+func (c *CacheMiddleware) generateCacheKey(namespace string, r *http.Request) string {
 	// Basic key components
-	key := r.Method + ":" + r.URL.Path + ":" + r.URL.RawQuery
+	key := namespace + "|" + r.Method + ":" + r.URL.Path + ":" + r.URL.RawQuery
 
 	// Add host if vhost-based routing is used
 	if c.config.IncludeHost {
@@ -262,19 +496,25 @@ func (c *CacheMiddleware) removeFromCache(key string) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	delete(c.cache, key)
+	c.remove(key)
 }
 
 // storeInCache stores a value in the cache
-func (c *CacheMiddleware) storeInCache(key string, statusCode int, body []byte, headers http.Header, ttl time.Duration) {
+func (c *CacheMiddleware) storeInCache(key, namespace, path, subject string, statusCode int, body []byte, headers http.Header, ttl time.Duration) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
+	// Make room in the entry's namespace first, so a busy route only evicts
+	// its own entries
+	if ns := c.namespaces[namespace]; ns != nil && ns.maxSize > 0 && ns.entries >= ns.maxSize {
+		c.evictNamespace(namespace, ns)
+	}
+
 	// Check if we need to evict entries
 	if c.config.MaxSize > 0 && len(c.cache) >= c.config.MaxSize {
 		// Evict oldest entries
 		for _, oldKey := range c.evictList[:len(c.evictList)/2] {
-			delete(c.cache, oldKey)
+			c.remove(oldKey)
 		}
 		c.evictList = c.evictList[len(c.evictList)/2:]
 		c.log.Info("Cache eviction performed",
@@ -296,6 +536,9 @@ func (c *CacheMiddleware) storeInCache(key string, statusCode int, body []byte,
 
 	// Create a cache entry
 	entry := &CacheEntry{
+		Namespace:  namespace,
+		Path:       path,
+		Subject:    subject,
 		StatusCode: statusCode,
 		Body:       body,
 		Headers:    headersCopy,
@@ -303,7 +546,7 @@ func (c *CacheMiddleware) storeInCache(key string, statusCode int, body []byte,
 	}
 
 	// Store in cache and update eviction list
-	c.cache[key] = entry
+	c.insert(key, entry)
 	c.evictList = append(c.evictList, key)
 
 	// Set up automatic expiration
@@ -312,6 +555,107 @@ func (c *CacheMiddleware) storeInCache(key string, statusCode int, body []byte,
 	})
 }
 
+// setNamespaceLimit sets the number of entries a namespace may hold
+func (c *CacheMiddleware) setNamespaceLimit(name string, maxSize int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.namespace(name).maxSize = maxSize
+}
+
+// namespace returns the state of a namespace, creating it if new. The mutex
+// must be held.
+func (c *CacheMiddleware) namespace(name string) *cacheNamespace {
+	ns, ok := c.namespaces[name]
+	if !ok {
+		ns = &cacheNamespace{}
+		c.namespaces[name] = ns
+	}
+	return ns
+}
+
+// insert stores an entry, counting it in its namespace. The mutex must be
+// held.
+func (c *CacheMiddleware) insert(key string, entry *CacheEntry) {
+	c.remove(key)
+	c.cache[key] = entry
+	if entry.Namespace == "" {
+		return
+	}
+
+	ns := c.namespace(entry.Namespace)
+	ns.entries++
+	cacheNamespaceEntries.WithLabelValues(entry.Namespace).Set(float64(ns.entries))
+	if ns.maxSize > 0 {
+		ns.keys = append(ns.keys, key)
+		// Drop the keys of entries that expired or were purged meanwhile
+		if len(ns.keys) > 2*ns.maxSize {
+			c.compactKeys(entry.Namespace, ns)
+		}
+	}
+}
+
+// remove deletes an entry, uncounting it from its namespace. The mutex must
+// be held.
+func (c *CacheMiddleware) remove(key string) {
+	entry, ok := c.cache[key]
+	if !ok {
+		return
+	}
+	delete(c.cache, key)
+
+	if ns := c.namespaces[entry.Namespace]; ns != nil && ns.entries > 0 {
+		ns.entries--
+		cacheNamespaceEntries.WithLabelValues(entry.Namespace).Set(float64(ns.entries))
+	}
+}
+
+// evictNamespace removes the oldest half of a full namespace's entries. The
+// mutex must be held.
+func (c *CacheMiddleware) evictNamespace(name string, ns *cacheNamespace) {
+	c.compactKeys(name, ns)
+	evict := len(ns.keys) - ns.maxSize/2
+	if evict <= 0 {
+		return
+	}
+	for _, key := range ns.keys[:evict] {
+		c.remove(key)
+	}
+	ns.keys = ns.keys[evict:]
+
+	c.log.Info("Cache namespace eviction performed",
+		logger.String("namespace", name),
+		logger.Int("evicted_count", evict),
+		logger.Int("remaining_entries", ns.entries),
+	)
+}
+
+// compactKeys keeps the keys of a namespace's cached entries, each once at
+// its latest insertion. Entries cached before the namespace had a limit, such
+// as those restored from a snapshot, come first. The mutex must be held.
+func (c *CacheMiddleware) compactKeys(name string, ns *cacheNamespace) {
+	seen := make(map[string]bool, ns.entries)
+	live := make([]string, 0, ns.entries)
+	for i := len(ns.keys) - 1; i >= 0; i-- {
+		key := ns.keys[i]
+		if entry, ok := c.cache[key]; ok && entry.Namespace == name && !seen[key] {
+			seen[key] = true
+			live = append(live, key)
+		}
+	}
+	if len(live) < ns.entries {
+		for key, entry := range c.cache {
+			if entry.Namespace == name && !seen[key] {
+				live = append(live, key)
+			}
+		}
+	}
+	for i, j := 0, len(live)-1; i < j; i, j = i+1, j-1 {
+		live[i], live[j] = live[j], live[i]
+	}
+	ns.keys = live
+}
+
 // serveFromCache serves a cached response
 func (c *CacheMiddleware) serveFromCache(w http.ResponseWriter, entry *CacheEntry) {
 	// Calculate age of the cache entry
@@ -388,30 +732,26 @@ type cachingResponseWriter struct {
 // WriteHeader captures the status code
 func (crw *cachingResponseWriter) WriteHeader(statusCode int) {
 	crw.statusCode = statusCode
-
-	// Ensure all headers from the original response are copied to our headers
-	for k, v := range crw.ResponseWriter.Header() {
-		for _, val := range v {
-			crw.headers.Add(k, val)
-		}
-	}
-
+	crw.captureHeaders()
 	crw.ResponseWriter.WriteHeader(statusCode)
 }
 
 // Write captures the response body
 func (crw *cachingResponseWriter) Write(b []byte) (int, error) {
 	// Make sure we capture headers before writing the body
-	for k, v := range crw.ResponseWriter.Header() {
-		for _, val := range v {
-			crw.headers.Add(k, val)
-		}
-	}
-
+	crw.captureHeaders()
 	crw.buffer.Write(b)
 	return crw.ResponseWriter.Write(b)
 }
 
+// captureHeaders copies the response headers once they are sent. Headers
+// set afterwards never reach the client, so they aren't cached either.
+func (crw *cachingResponseWriter) captureHeaders() {
+	if crw.headers == nil {
+		crw.headers = crw.ResponseWriter.Header().Clone()
+	}
+}
+
 // Header captures the response headers
 func (crw *cachingResponseWriter) Header() http.Header {
 	h := crw.ResponseWriter.Header()
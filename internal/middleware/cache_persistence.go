@@ -0,0 +1,209 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"api-gateway/pkg/logger"
+)
+
+// snapshotMagic identifies cache snapshot files and their format version
+var snapshotMagic = []byte("GWCACHE1")
+
+// cacheSnapshot is the on-disk representation of the cache
+type cacheSnapshot struct {
+	SavedAt time.Time
+	Entries map[string]*CacheEntry
+}
+
+// SaveSnapshot writes all unexpired cache entries to the configured snapshot file.
+// The file is written to a temporary path and renamed so a crash never leaves a
+// partially written snapshot behind.
+func (c *CacheMiddleware) SaveSnapshot() error {
+	path := c.config.Persistence.Path
+	if path == "" {
+		return errors.New("cache snapshot path not configured")
+	}
+
+	now := time.Now()
+	snapshot := cacheSnapshot{
+		SavedAt: now,
+		Entries: make(map[string]*CacheEntry),
+	}
+
+	c.mutex.RLock()
+	for key, entry := range c.cache {
+		if now.Before(entry.Expiration) {
+			snapshot.Entries[key] = entry
+		}
+	}
+	c.mutex.RUnlock()
+
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(&snapshot); err != nil {
+		return fmt.Errorf("failed to encode cache snapshot: %w", err)
+	}
+	checksum := sha256.Sum256(payload.Bytes())
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	for _, chunk := range [][]byte{snapshotMagic, checksum[:], payload.Bytes()} {
+		if _, err := tmp.Write(chunk); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to write cache snapshot: %w", err)
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync cache snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close cache snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace cache snapshot: %w", err)
+	}
+
+	c.log.Debug("Cache snapshot saved",
+		logger.String("path", path),
+		logger.Int("entries", len(snapshot.Entries)),
+	)
+
+	return nil
+}
+
+// LoadSnapshot restores unexpired entries from the snapshot file into the cache.
+// Corrupt or truncated snapshots are rejected without touching the cache.
+func (c *CacheMiddleware) LoadSnapshot() (int, error) {
+	path := c.config.Persistence.Path
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read cache snapshot: %w", err)
+	}
+
+	headerLen := len(snapshotMagic) + sha256.Size
+	if len(data) < headerLen || !bytes.Equal(data[:len(snapshotMagic)], snapshotMagic) {
+		return 0, errors.New("cache snapshot has an invalid header")
+	}
+
+	payload := data[headerLen:]
+	checksum := sha256.Sum256(payload)
+	if !bytes.Equal(checksum[:], data[len(snapshotMagic):headerLen]) {
+		return 0, errors.New("cache snapshot checksum mismatch")
+	}
+
+	var snapshot cacheSnapshot
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&snapshot); err != nil {
+		return 0, fmt.Errorf("failed to decode cache snapshot: %w", err)
+	}
+
+	// Restore entries soonest-to-expire first so they are evicted first
+	keys := make([]string, 0, len(snapshot.Entries))
+	for key := range snapshot.Entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return snapshot.Entries[keys[i]].Expiration.Before(snapshot.Entries[keys[j]].Expiration)
+	})
+
+	now := time.Now()
+	restored := 0
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, key := range keys {
+		entry := snapshot.Entries[key]
+		remaining := entry.Expiration.Sub(now)
+		if remaining <= 0 {
+			continue
+		}
+		if c.config.MaxSize > 0 && len(c.cache) >= c.config.MaxSize {
+			break
+		}
+
+		c.insert(key, entry)
+		c.evictList = append(c.evictList, key)
+		restored++
+
+		expiredKey := key
+		time.AfterFunc(remaining, func() {
+			c.removeFromCache(expiredKey)
+		})
+	}
+
+	return restored, nil
+}
+
+// startSnapshots loads the last snapshot and periodically persists the cache
+func (c *CacheMiddleware) startSnapshots() {
+	restored, err := c.LoadSnapshot()
+	if err != nil {
+		c.log.Warn("Ignoring unusable cache snapshot",
+			logger.String("path", c.config.Persistence.Path),
+			logger.String("reason", err.Error()),
+		)
+	} else {
+		c.log.Info("Cache warmed from snapshot",
+			logger.String("path", c.config.Persistence.Path),
+			logger.Int("entries", restored),
+		)
+	}
+
+	interval := time.Duration(c.config.Persistence.SnapshotInterval) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	c.stopSnapshots = make(chan struct{})
+	c.snapshotsDone = make(chan struct{})
+
+	go func() {
+		defer close(c.snapshotsDone)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.SaveSnapshot(); err != nil {
+					c.log.Error("Failed to save cache snapshot", logger.Error(err))
+				}
+			case <-c.stopSnapshots:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops periodic snapshots and writes a final snapshot if persistence is enabled
+func (c *CacheMiddleware) Close() error {
+	if c.stopSnapshots == nil {
+		return nil
+	}
+
+	close(c.stopSnapshots)
+	<-c.snapshotsDone
+	c.stopSnapshots = nil
+
+	return c.SaveSnapshot()
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPersistentCacheConfig(t *testing.T) *config.CacheConfig {
+	return &config.CacheConfig{
+		Enabled: true,
+		MaxSize: 100,
+		Persistence: config.CachePersistenceConfig{
+			Enabled:          true,
+			Path:             filepath.Join(t.TempDir(), "cache", "cache.snapshot"),
+			SnapshotInterval: 3600,
+		},
+	}
+}
+
+func TestCacheSnapshotRoundTrip(t *testing.T) {
+	cfg := newPersistentCacheConfig(t)
+
+	cache := NewCacheMiddleware(cfg, &mockCacheLogger{})
+	cache.storeInCache("fresh", "", "/fresh", "", http.StatusOK, []byte("cached body"), http.Header{"Content-Type": []string{"text/plain"}}, time.Minute)
+	cache.cache["stale"] = &CacheEntry{StatusCode: http.StatusOK, Body: []byte("old"), Expiration: time.Now().Add(-time.Second)}
+	require.NoError(t, cache.Close())
+
+	// A new instance is warmed from the snapshot
+	restored := NewCacheMiddleware(cfg, &mockCacheLogger{})
+	defer restored.Close()
+
+	entry := restored.getFromCache("fresh")
+	require.NotNil(t, entry)
+	assert.Equal(t, []byte("cached body"), entry.Body)
+	assert.Equal(t, "text/plain", entry.Headers.Get("Content-Type"))
+	assert.Nil(t, restored.getFromCache("stale"), "expired entries must not be restored")
+}
+
+func TestCacheSnapshotCorruption(t *testing.T) {
+	cfg := newPersistentCacheConfig(t)
+
+	cache := NewCacheMiddleware(cfg, &mockCacheLogger{})
+	cache.storeInCache("key", "", "/key", "", http.StatusOK, []byte("body"), http.Header{}, time.Minute)
+	require.NoError(t, cache.Close())
+
+	data, err := os.ReadFile(cfg.Persistence.Path)
+	require.NoError(t, err)
+
+	t.Run("flipped byte", func(t *testing.T) {
+		corrupt := append([]byte(nil), data...)
+		corrupt[len(corrupt)-1] ^= 0xFF
+		require.NoError(t, os.WriteFile(cfg.Persistence.Path, corrupt, 0644))
+
+		c := &CacheMiddleware{cache: make(map[string]*CacheEntry), config: cfg, log: &mockCacheLogger{}}
+		restored, err := c.LoadSnapshot()
+		assert.Error(t, err)
+		assert.Equal(t, 0, restored)
+		assert.Empty(t, c.cache)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(cfg.Persistence.Path, data[:4], 0644))
+
+		c := &CacheMiddleware{cache: make(map[string]*CacheEntry), config: cfg, log: &mockCacheLogger{}}
+		_, err := c.LoadSnapshot()
+		assert.Error(t, err)
+	})
+
+	t.Run("startup ignores corrupt snapshot", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(cfg.Persistence.Path, []byte("garbage"), 0644))
+
+		c := NewCacheMiddleware(cfg, &mockCacheLogger{})
+		defer c.Close()
+		assert.Empty(t, c.cache)
+	})
+}
+
+func TestCacheSnapshotMissingFile(t *testing.T) {
+	cfg := newPersistentCacheConfig(t)
+	c := &CacheMiddleware{cache: make(map[string]*CacheEntry), config: cfg, log: &mockCacheLogger{}}
+
+	restored, err := c.LoadSnapshot()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, restored)
+}
+
+func TestCacheCloseWithoutPersistence(t *testing.T) {
+	c := NewCacheMiddleware(&config.CacheConfig{Enabled: true}, &mockCacheLogger{})
+	assert.NoError(t, c.Close())
+}
@@ -1,14 +1,17 @@
 package middleware
 
 import (
+	"api-gateway/internal/auth"
 	"api-gateway/internal/config"
 	"api-gateway/pkg/logger"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -740,7 +743,7 @@ func TestCacheMiddleware_StoreInCache_Eviction(t *testing.T) {
 		headers := make(http.Header)
 		headers.Set("Content-Type", "text/plain")
 
-		middleware.storeInCache(key, http.StatusOK, body, headers, 60*time.Second)
+		middleware.storeInCache(key, "", "/"+key, "", http.StatusOK, body, headers, 60*time.Second)
 	}
 
 	// Cache should have evicted oldest entries
@@ -831,3 +834,305 @@ func TestCacheMiddleware_PurgeCache_MethodNotAllowed(t *testing.T) {
 	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
 	assert.Contains(t, rec.Body.String(), "Method not allowed")
 }
+
+// TestCacheMiddleware_PurgeCache_Broadcast tests that purges are forwarded to other instances
+func TestCacheMiddleware_PurgeCache_Broadcast(t *testing.T) {
+	cfg := &config.CacheConfig{
+		Enabled:       true,
+		DefaultTTL:    60,
+		PurgeEndpoint: "/purge",
+	}
+	middleware := NewCacheMiddleware(cfg, &mockCacheLogger{})
+	middleware.cache["article/123"] = &CacheEntry{Expiration: time.Now().Add(time.Minute)}
+
+	var broadcasted []string
+	middleware.SetPurgeBroadcaster(func(namespace, pathPattern, subject string) error {
+		broadcasted = append(broadcasted, pathPattern)
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	middleware.PurgeCache(rec, httptest.NewRequest("POST", "http://example.com/purge?path=article", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []string{"article"}, broadcasted)
+	assert.Contains(t, rec.Body.String(), `"propagated":true`)
+	assert.Empty(t, middleware.cache)
+
+	// Purges applied on behalf of other instances are not forwarded again
+	middleware.cache["article/456"] = &CacheEntry{Expiration: time.Now().Add(time.Minute)}
+	purged, remaining := middleware.Purge("article")
+	assert.Equal(t, 1, purged)
+	assert.Equal(t, 0, remaining)
+	assert.Len(t, broadcasted, 1)
+
+	// A failed broadcast still purges locally
+	middleware.SetPurgeBroadcaster(func(namespace, pathPattern, subject string) error {
+		return errors.New("peer unreachable")
+	})
+	middleware.cache["product/789"] = &CacheEntry{Expiration: time.Now().Add(time.Minute)}
+	rec = httptest.NewRecorder()
+	middleware.PurgeCache(rec, httptest.NewRequest("POST", "http://example.com/purge", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"propagated":false`)
+	assert.Empty(t, middleware.cache)
+}
+
+// TestCacheMiddleware_PurgeSubject tests purging the entries cached for a user
+func TestCacheMiddleware_PurgeSubject(t *testing.T) {
+	middleware := NewCacheMiddleware(&config.CacheConfig{
+		Enabled:       true,
+		DefaultTTL:    60,
+		VaryHeaders:   []string{"Authorization"},
+		PurgeEndpoint: "/purge",
+	}, &mockCacheLogger{})
+	route := config.Route{
+		Path:        "/profile",
+		Middlewares: &config.Middlewares{Cache: &config.RouteCacheConfig{Enabled: true, TTL: 60, CacheAuthenticated: true}},
+	}
+	handler := middleware.Cache(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("profile"))
+	}), route)
+
+	for _, subject := range []string{"ada", "bob", ""} {
+		req := httptest.NewRequest("GET", "http://example.com/profile", nil)
+		if subject != "" {
+			req.Header.Set("Authorization", "Bearer "+subject)
+			req = req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{Type: auth.IdentityJWT, Subject: subject}))
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	assert.Len(t, middleware.cache, 3)
+
+	var broadcasted []string
+	middleware.SetPurgeBroadcaster(func(namespace, pathPattern, subject string) error {
+		broadcasted = append(broadcasted, pathPattern+"|"+subject)
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	middleware.PurgeCache(rec, httptest.NewRequest("POST", "http://example.com/purge?user=ada", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"purged_entries":1`)
+	assert.Equal(t, []string{"|ada"}, broadcasted)
+	for _, entry := range middleware.cache {
+		assert.NotEqual(t, "ada", entry.Subject)
+	}
+	assert.Len(t, middleware.cache, 2)
+
+	// Entries aren't tagged on routes that don't cache authenticated responses
+	route.Middlewares.Cache.CacheAuthenticated = false
+	req := httptest.NewRequest("GET", "http://example.com/profile", nil)
+	req = req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{Type: auth.IdentityJWT, Subject: "ada"}))
+	assert.Empty(t, cacheSubject(req, route))
+
+	rec = httptest.NewRecorder()
+	middleware.PurgeCache(rec, httptest.NewRequest("POST", "http://example.com/purge?user=bob&path=/profile", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Len(t, middleware.cache, 2)
+}
+
+func TestCacheMiddleware_PooledBuffers(t *testing.T) {
+	middleware := NewCacheMiddleware(&config.CacheConfig{Enabled: true, DefaultTTL: 60, MaxTTL: 300}, &mockCacheLogger{})
+
+	// The body is written in parts, after the headers are set
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Path", r.URL.Path)
+		w.Write([]byte("body of "))
+		w.Write([]byte(r.URL.Path))
+	})
+	route := config.Route{
+		Path:        "/",
+		Middlewares: &config.Middlewares{Cache: &config.RouteCacheConfig{Enabled: true, TTL: 60}},
+	}
+	handler := middleware.Cache(testHandler, route)
+
+	// Later misses reuse the buffer that captured the first response
+	for _, path := range []string{"/first", "/second", "/third"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com"+path, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "http://example.com/first", nil))
+	assert.Equal(t, "HIT", rec.Header().Get("X-Cache"))
+	assert.Equal(t, "body of /first", rec.Body.String())
+	assert.Equal(t, []string{"/first"}, rec.Header().Values("X-Path"))
+}
+
+func BenchmarkCacheMiss(b *testing.B) {
+	// Without a TTL responses pass through the capturing writer uncached
+	middleware := NewCacheMiddleware(&config.CacheConfig{Enabled: true}, &mockCacheLogger{})
+	body := []byte(fmt.Sprintf("%16384d", 0))
+	handler := middleware.Cache(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}), config.Route{
+		Path:        "/",
+		Middlewares: &config.Middlewares{Cache: &config.RouteCacheConfig{Enabled: true}},
+	})
+	req := httptest.NewRequest("GET", "http://example.com/items", nil)
+	w := discardResponseWriter{header: make(http.Header)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		clear(w.header)
+		handler.ServeHTTP(w, req)
+	}
+}
+
+// TestCacheMiddleware_Namespaces tests that routes cache, evict and purge
+// their entries separately
+func TestCacheMiddleware_Namespaces(t *testing.T) {
+	middleware := NewCacheMiddleware(&config.CacheConfig{Enabled: true, DefaultTTL: 60, MaxSize: 100}, &mockCacheLogger{})
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("body of " + r.URL.Path))
+	})
+	users := middleware.Cache(upstream, config.Route{
+		Path:        "/ns-users",
+		Middlewares: &config.Middlewares{Cache: &config.RouteCacheConfig{Enabled: true, TTL: 60, MaxSize: 4}},
+	})
+	orders := middleware.Cache(upstream, config.Route{
+		Path:        "/ns-orders",
+		Middlewares: &config.Middlewares{Cache: &config.RouteCacheConfig{Enabled: true, TTL: 60, Namespace: "ns-orders"}},
+	})
+	get := func(handler http.Handler, path string) string {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "http://example.com"+path, nil))
+		return rec.Header().Get("X-Cache")
+	}
+
+	hits := testutil.ToFloat64(cacheNamespaceHits.WithLabelValues("ns-orders"))
+	misses := testutil.ToFloat64(cacheNamespaceMisses.WithLabelValues("ns-orders"))
+	for i := 0; i < 3; i++ {
+		get(orders, fmt.Sprintf("/ns-orders/%d", i))
+	}
+	assert.Equal(t, "HIT", get(orders, "/ns-orders/0"))
+	assert.Equal(t, hits+1, testutil.ToFloat64(cacheNamespaceHits.WithLabelValues("ns-orders")))
+	assert.Equal(t, misses+3, testutil.ToFloat64(cacheNamespaceMisses.WithLabelValues("ns-orders")))
+
+	// The same request is cached separately in each namespace
+	assert.Equal(t, "MISS", get(users, "/ns-orders/0"))
+	assert.Equal(t, "HIT", get(users, "/ns-orders/0"))
+
+	// A full namespace evicts its oldest entries, leaving the others alone
+	for i := 0; i < 4; i++ {
+		get(users, fmt.Sprintf("/ns-users/%d", i))
+	}
+	assert.Equal(t, 3, middleware.namespaces["/ns-users"].entries)
+	assert.Equal(t, 3.0, testutil.ToFloat64(cacheNamespaceEntries.WithLabelValues("/ns-users")))
+	assert.Equal(t, "MISS", get(users, "/ns-orders/0"))
+	assert.Equal(t, "HIT", get(users, "/ns-users/3"))
+	assert.Equal(t, 3, middleware.namespaces["ns-orders"].entries)
+
+	// Purges can be limited to a namespace
+	rec := httptest.NewRecorder()
+	middleware.PurgeCache(rec, httptest.NewRequest("POST", "http://example.com/purge?namespace=ns-orders&path=/ns-orders/1", nil))
+	assert.Contains(t, rec.Body.String(), `"purged_entries":1`)
+	assert.Contains(t, rec.Body.String(), `"namespace":"ns-orders"`)
+	purged, _ := middleware.PurgeNamespace("/ns-users", "")
+	assert.Equal(t, 4, purged)
+	assert.Equal(t, 0, middleware.namespaces["/ns-users"].entries)
+	assert.Equal(t, "HIT", get(orders, "/ns-orders/0"))
+	assert.Equal(t, 2.0, testutil.ToFloat64(cacheNamespaceEntries.WithLabelValues("ns-orders")))
+
+	rec = httptest.NewRecorder()
+	middleware.PurgeCache(rec, httptest.NewRequest("POST", "http://example.com/purge?namespace=ns-orders&user=ada", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	middleware.Purge("")
+	assert.Empty(t, middleware.cache)
+	assert.Equal(t, 0.0, testutil.ToFloat64(cacheNamespaceEntries.WithLabelValues("ns-orders")))
+}
+
+func TestCacheMiddleware_Directives(t *testing.T) {
+	cfg := &config.CacheConfig{
+		Enabled: true, DefaultTTL: 60, MaxSize: 100,
+		Directives: config.CacheDirectivesConfig{Enabled: true, Header: "X-Gateway-Cache", QueryParam: "gateway_cache"},
+	}
+	middleware := NewCacheMiddleware(cfg, &mockCacheLogger{})
+	middleware.SetDirectiveAuthorizer(func(r *http.Request) (string, bool) {
+		return "operator", r.Header.Get("Authorization") == "Bearer operator"
+	}, "Authorization")
+
+	calls := 0
+	var forwarded *http.Request
+	handler := middleware.Cache(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		forwarded = r
+		w.Write([]byte(fmt.Sprintf("response %d", calls)))
+	}), config.Route{
+		Path:        "/directive-users",
+		Middlewares: &config.Middlewares{Cache: &config.RouteCacheConfig{Enabled: true, TTL: 60}},
+	})
+	get := func(target, directive, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "http://example.com"+target, nil)
+		if directive != "" {
+			req.Header.Set("X-Gateway-Cache", directive)
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, "MISS", get("/directive-users?a=1&b=2", "", "").Header().Get("X-Cache"))
+	assert.Equal(t, "HIT", get("/directive-users?a=1&b=2", "", "").Header().Get("X-Cache"))
+
+	t.Run("bypass", func(t *testing.T) {
+		applied := testutil.ToFloat64(cacheDirectives.WithLabelValues("/directive-users", "bypass", "applied"))
+		rec := get("/directive-users?a=1&b=2", "bypass", "Bearer operator")
+		assert.Equal(t, "BYPASS", rec.Header().Get("X-Cache"))
+		assert.Equal(t, "response 2", rec.Body.String())
+		assert.Empty(t, forwarded.Header.Get("X-Gateway-Cache"))
+		assert.Equal(t, applied+1, testutil.ToFloat64(cacheDirectives.WithLabelValues("/directive-users", "bypass", "applied")))
+
+		// The cached entry is left alone
+		assert.Equal(t, "response 1", get("/directive-users?a=1&b=2", "", "").Body.String())
+	})
+
+	t.Run("refresh", func(t *testing.T) {
+		rec := get("/directive-users?a=1&b=2", "Refresh", "Bearer operator")
+		assert.Equal(t, "REFRESH", rec.Header().Get("X-Cache"))
+		assert.Equal(t, "response 3", rec.Body.String())
+		assert.Equal(t, "no-cache", forwarded.Header.Get("Cache-Control"))
+		// Operator credentials aren't forwarded with the refresh
+		assert.Empty(t, forwarded.Header.Get("Authorization"))
+
+		rec = get("/directive-users?a=1&b=2", "", "")
+		assert.Equal(t, "HIT", rec.Header().Get("X-Cache"))
+		assert.Equal(t, "response 3", rec.Body.String())
+	})
+
+	t.Run("query parameter", func(t *testing.T) {
+		rec := get("/directive-users?a=1&gateway_cache=refresh&b=2", "", "Bearer operator")
+		assert.Equal(t, "REFRESH", rec.Header().Get("X-Cache"))
+		assert.Equal(t, "a=1&b=2", forwarded.URL.RawQuery)
+		assert.Equal(t, "response 4", get("/directive-users?a=1&b=2", "", "").Body.String())
+	})
+
+	t.Run("ignored from other callers", func(t *testing.T) {
+		denied := testutil.ToFloat64(cacheDirectives.WithLabelValues("/directive-users", "refresh", "denied"))
+		rec := get("/directive-users?a=1&b=2", "refresh", "")
+		assert.Equal(t, "HIT", rec.Header().Get("X-Cache"))
+		assert.Equal(t, "response 4", rec.Body.String())
+		assert.Equal(t, denied+1, testutil.ToFloat64(cacheDirectives.WithLabelValues("/directive-users", "refresh", "denied")))
+
+		// Unknown directives are dropped too
+		assert.Equal(t, "HIT", get("/directive-users?a=1&b=2", "later", "").Header().Get("X-Cache"))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		cfg.Directives.Enabled = false
+		defer func() { cfg.Directives.Enabled = true }()
+		assert.Equal(t, "HIT", get("/directive-users?a=1&b=2", "bypass", "").Header().Get("X-Cache"))
+	})
+}
+
+func TestRemoveQueryParam(t *testing.T) {
+	assert.Equal(t, "b=2&a=1", removeQueryParam("b=2&gateway_cache=bypass&a=1", "gateway_cache"))
+	assert.Equal(t, "", removeQueryParam("gateway_cache", "gateway_cache"))
+	assert.Equal(t, "a=1", removeQueryParam("a=1&gateway%5Fcache=refresh", "gateway_cache"))
+}
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"api-gateway/pkg/logger"
+)
+
+// WarmRequest is the body accepted by the cache warm endpoint
+type WarmRequest struct {
+	Paths   []string          `json:"paths"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// WarmResult describes the outcome of warming a single path
+type WarmResult struct {
+	Path       string `json:"path"`
+	StatusCode int    `json:"status_code"`
+	Cache      string `json:"cache"`
+}
+
+// Warm fetches the given paths through handler so cacheable responses are stored,
+// running at most concurrency requests at a time
+func (c *CacheMiddleware) Warm(ctx context.Context, handler http.Handler, paths []string, host string, headers map[string]string) []WarmResult {
+	concurrency := c.config.Warm.Concurrency
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+
+	results := make([]WarmResult, len(paths))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, path := range paths {
+		results[i] = WarmResult{Path: path}
+		if !strings.HasPrefix(path, "/") {
+			results[i].StatusCode = http.StatusBadRequest
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, path string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+			if err != nil {
+				results[i].StatusCode = http.StatusBadRequest
+				return
+			}
+			if host != "" {
+				req.Host = host
+			}
+			for name, value := range headers {
+				req.Header.Set(name, value)
+			}
+
+			w := &warmResponseWriter{header: make(http.Header), statusCode: http.StatusOK}
+			handler.ServeHTTP(w, req)
+
+			results[i].StatusCode = w.statusCode
+			results[i].Cache = w.header.Get("X-Cache")
+		}(i, path)
+	}
+	wg.Wait()
+
+	warmed := 0
+	for _, result := range results {
+		if result.StatusCode < 400 {
+			warmed++
+		}
+	}
+	c.log.Info("Cache warm completed",
+		logger.Int("paths", len(paths)),
+		logger.Int("warmed", warmed),
+	)
+
+	return results
+}
+
+// WarmHandler handles on-demand cache warm requests, dispatching them through handler
+func (c *CacheMiddleware) WarmHandler(handler http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var warmReq WarmRequest
+		if err := json.NewDecoder(r.Body).Decode(&warmReq); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if len(warmReq.Paths) == 0 {
+			http.Error(w, "No paths to warm", http.StatusBadRequest)
+			return
+		}
+		if maxPaths := c.config.Warm.MaxPaths; maxPaths > 0 && len(warmReq.Paths) > maxPaths {
+			http.Error(w, fmt.Sprintf("At most %d paths can be warmed at once", maxPaths), http.StatusBadRequest)
+			return
+		}
+
+		results := c.Warm(r.Context(), handler, warmReq.Paths, r.Host, warmReq.Headers)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"results": results,
+		})
+	}
+}
+
+// warmResponseWriter records the status and headers of a warm request and discards the body
+type warmResponseWriter struct {
+	header     http.Header
+	statusCode int
+	written    bool
+}
+
+// Header returns the response headers
+func (w *warmResponseWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader records the status code
+func (w *warmResponseWriter) WriteHeader(statusCode int) {
+	if w.written {
+		return
+	}
+	w.statusCode = statusCode
+	w.written = true
+}
+
+// Write discards the body
+func (w *warmResponseWriter) Write(b []byte) (int, error) {
+	w.written = true
+	return len(b), nil
+}
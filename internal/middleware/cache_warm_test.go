@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newWarmTestHandler(c *CacheMiddleware, hits *int32, inflight *int32, peak *int32) http.Handler {
+	route := config.Route{
+		Path: "/api",
+		Middlewares: &config.Middlewares{
+			Cache: &config.RouteCacheConfig{Enabled: true, TTL: 60},
+		},
+	}
+
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		if peak != nil {
+			current := atomic.AddInt32(inflight, 1)
+			for {
+				old := atomic.LoadInt32(peak)
+				if current <= old || atomic.CompareAndSwapInt32(peak, old, current) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			atomic.AddInt32(inflight, -1)
+		}
+		if r.URL.Path == "/api/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("payload " + r.URL.Path))
+	})
+
+	return c.Cache(upstream, route)
+}
+
+func TestCacheWarm(t *testing.T) {
+	c := NewCacheMiddleware(&config.CacheConfig{Enabled: true, MaxSize: 100, Warm: config.CacheWarmConfig{Concurrency: 2}}, &mockCacheLogger{})
+	var hits, inflight, peak int32
+	handler := newWarmTestHandler(c, &hits, &inflight, &peak)
+
+	results := c.Warm(context.Background(), handler, []string{"/api/a", "/api/b", "/api/c", "/api/missing", "relative"}, "", nil)
+	require.Len(t, results, 5)
+
+	assert.Equal(t, http.StatusOK, results[0].StatusCode)
+	assert.Equal(t, "MISS", results[0].Cache)
+	assert.Equal(t, http.StatusNotFound, results[3].StatusCode)
+	assert.Equal(t, http.StatusBadRequest, results[4].StatusCode)
+	assert.LessOrEqual(t, peak, int32(2), "concurrency limit should be respected")
+
+	// Warmed paths are now served from cache
+	before := atomic.LoadInt32(&hits)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/b", nil))
+	assert.Equal(t, "HIT", rec.Header().Get("X-Cache"))
+	assert.Equal(t, "payload /api/b", rec.Body.String())
+	assert.Equal(t, before, atomic.LoadInt32(&hits))
+}
+
+func TestCacheWarmHandler(t *testing.T) {
+	c := NewCacheMiddleware(&config.CacheConfig{Enabled: true, MaxSize: 100, Warm: config.CacheWarmConfig{MaxPaths: 2}}, &mockCacheLogger{})
+	var hits int32
+	handler := newWarmTestHandler(c, &hits, nil, nil)
+	warm := c.WarmHandler(handler)
+
+	t.Run("warms paths", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		warm(rec, httptest.NewRequest(http.MethodPost, "/admin/cache/warm", strings.NewReader(`{"paths":["/api/x","/api/x"]}`)))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var body struct {
+			Success bool         `json:"success"`
+			Results []WarmResult `json:"results"`
+		}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		assert.True(t, body.Success)
+		assert.Len(t, body.Results, 2)
+	})
+
+	t.Run("rejects empty body", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		warm(rec, httptest.NewRequest(http.MethodPost, "/admin/cache/warm", strings.NewReader(`{"paths":[]}`)))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("rejects too many paths", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		warm(rec, httptest.NewRequest(http.MethodPost, "/admin/cache/warm", strings.NewReader(`{"paths":["/api/x","/api/y","/api/z"]}`)))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("rejects invalid json", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		warm(rec, httptest.NewRequest(http.MethodPost, "/admin/cache/warm", strings.NewReader(`not json`)))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("rejects GET", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		warm(rec, httptest.NewRequest(http.MethodGet, "/admin/cache/warm", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	})
+}
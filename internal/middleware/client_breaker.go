@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"container/list"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/util"
+	"api-gateway/pkg/logger"
+)
+
+// ClientBreaker rejects clients that keep causing error responses, such as
+// repeated authentication failures, before they reach the auth service or
+// upstreams. Clients are identified by the address of their connection, since
+// API keys aren't verified yet and forwarding headers can be forged.
+type ClientBreaker struct {
+	config   *config.ClientBreakerConfig
+	statuses map[int]bool
+	log      logger.Logger
+
+	mutex     sync.Mutex
+	clients   map[string]*list.Element
+	order     *list.List // Most recent error first
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// clientErrors counts the errors of one client in the current window
+type clientErrors struct {
+	client       string
+	windowStart  time.Time
+	errors       int
+	blockedUntil time.Time
+}
+
+// NewClientBreaker creates a new per-client breaker
+func NewClientBreaker(cfg *config.ClientBreakerConfig, log logger.Logger) *ClientBreaker {
+	statuses := make(map[int]bool, len(cfg.Statuses))
+	for _, status := range cfg.Statuses {
+		statuses[status] = true
+	}
+	return &ClientBreaker{
+		config:   cfg,
+		statuses: statuses,
+		log:      log,
+		clients:  make(map[string]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+// Protect rejects blocked clients with 429 and counts the error responses of
+// the others
+func (b *ClientBreaker) Protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := b.clientID(r)
+		if wait := b.blockedFor(client); wait > 0 {
+			clientBreakerRejections.Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			http.Error(w, "Too many failed requests. Try again later.", http.StatusTooManyRequests)
+			return
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		if b.statuses[recorder.statusCode] {
+			b.recordError(client, r)
+		}
+	})
+}
+
+// clientID identifies the client of a request by its connection
+func (b *ClientBreaker) clientID(r *http.Request) string {
+	if addr, ok := util.ConnectionAddr(r); ok {
+		return addr.String()
+	}
+	return r.RemoteAddr
+}
+
+// blockedFor returns how long the client stays blocked, or zero
+func (b *ClientBreaker) blockedFor(client string) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	elem, ok := b.clients[client]
+	if !ok {
+		return 0
+	}
+	state := elem.Value.(*clientErrors)
+	if wait := state.blockedUntil.Sub(b.now()); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// recordError counts an error response and trips the client's breaker once
+// the threshold is reached within the window. Past max_clients the client
+// with the oldest error is forgotten.
+func (b *ClientBreaker) recordError(client string, r *http.Request) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := b.now()
+	window := time.Duration(b.config.Window) * time.Second
+	b.sweep(now, window)
+
+	var state *clientErrors
+	if elem, ok := b.clients[client]; ok {
+		state = elem.Value.(*clientErrors)
+		b.order.MoveToFront(elem)
+	} else {
+		if b.order.Len() >= b.config.MaxClients {
+			b.forget(b.order.Back())
+		}
+		state = &clientErrors{client: client, windowStart: now}
+		b.clients[client] = b.order.PushFront(state)
+	}
+	if now.Sub(state.windowStart) >= window {
+		state.windowStart = now
+		state.errors = 0
+	}
+	state.errors++
+	if state.errors < b.config.Threshold || now.Before(state.blockedUntil) {
+		return
+	}
+
+	state.blockedUntil = now.Add(time.Duration(b.config.BlockFor) * time.Second)
+	state.errors = 0
+	clientBreakerTrips.Inc()
+	b.log.Warn("Blocking client after repeated failed requests",
+		logger.String("client", client),
+		logger.String("path", r.URL.Path),
+		logger.Int("block_seconds", b.config.BlockFor),
+	)
+}
+
+// sweep forgets clients whose window and block have expired, at most once
+// per window. The caller must hold the mutex.
+func (b *ClientBreaker) sweep(now time.Time, window time.Duration) {
+	if now.Sub(b.lastSweep) < window {
+		return
+	}
+	b.lastSweep = now
+	for elem := b.order.Front(); elem != nil; {
+		next := elem.Next()
+		state := elem.Value.(*clientErrors)
+		if now.Sub(state.windowStart) >= window && !now.Before(state.blockedUntil) {
+			b.forget(elem)
+		}
+		elem = next
+	}
+}
+
+// forget stops tracking a client. The caller must hold the mutex.
+func (b *ClientBreaker) forget(elem *list.Element) {
+	b.order.Remove(elem)
+	delete(b.clients, elem.Value.(*clientErrors).client)
+}
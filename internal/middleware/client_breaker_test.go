@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientBreaker(t *testing.T) {
+	cfg := &config.ClientBreakerConfig{
+		Enabled:    true,
+		Statuses:   []int{http.StatusUnauthorized},
+		Threshold:  3,
+		Window:     60,
+		BlockFor:   300,
+		MaxClients: 10,
+	}
+	breaker := NewClientBreaker(cfg, &mockLogger{})
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+
+	handler := breaker.Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(ip, apiKey, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "http://example.com/api", nil)
+		req.RemoteAddr = ip + ":1234"
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Failures below the threshold and successes pass through
+	assert.Equal(t, http.StatusUnauthorized, serve("10.0.0.1", "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve("10.0.0.1", "", "").Code)
+	assert.Equal(t, http.StatusOK, serve("10.0.0.1", "", "Bearer ok").Code)
+
+	// The third failure blocks the client, including its valid requests
+	assert.Equal(t, http.StatusUnauthorized, serve("10.0.0.1", "", "").Code)
+	rec := serve("10.0.0.1", "", "Bearer ok")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "301", rec.Header().Get("Retry-After"))
+
+	// Other clients are tracked separately, while rotating API keys or
+	// forwarding headers doesn't escape the block
+	assert.Equal(t, http.StatusOK, serve("10.0.0.2", "", "Bearer ok").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("10.0.0.1", "key-1", "Bearer ok").Code)
+	req := httptest.NewRequest("GET", "http://example.com/api", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Real-IP", "10.0.0.2")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+
+	// The block expires
+	now = now.Add(301 * time.Second)
+	assert.Equal(t, http.StatusOK, serve("10.0.0.1", "", "Bearer ok").Code)
+
+	// Failures spread over more than a window don't trip the breaker
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusUnauthorized, serve("10.0.0.3", "", "").Code)
+		now = now.Add(time.Minute)
+	}
+	assert.Equal(t, http.StatusOK, serve("10.0.0.3", "", "Bearer ok").Code)
+}
+
+func TestClientBreakerEvictsOldestClient(t *testing.T) {
+	cfg := &config.ClientBreakerConfig{Statuses: []int{http.StatusUnauthorized}, Threshold: 2, Window: 60, BlockFor: 300, MaxClients: 2}
+	breaker := NewClientBreaker(cfg, &mockLogger{})
+	handler := breaker.Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	serve := func(ip string) int {
+		req := httptest.NewRequest("GET", "http://example.com/api", nil)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	serve("10.0.0.1")
+	serve("10.0.0.2")
+	serve("10.0.0.3")
+	assert.Len(t, breaker.clients, 2)
+	assert.NotContains(t, breaker.clients, "10.0.0.1")
+
+	// New clients are still tracked once the table is full
+	assert.Equal(t, http.StatusUnauthorized, serve("10.0.0.3"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("10.0.0.3"))
+}
@@ -0,0 +1,175 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// collapseKeyHeaders are always part of the collapse key so responses are
+// never shared between callers with different credentials
+var collapseKeyHeaders = []string{"Authorization", "Cookie"}
+
+// inflightRequest is an upstream call shared by identical requests
+type inflightRequest struct {
+	done chan struct{}
+
+	// Set by the leading request before done is closed
+	statusCode int
+	header     http.Header
+	body       []byte
+	shareable  bool
+}
+
+// RequestCollapser lets identical concurrent GET requests share one upstream
+// call. The first request goes upstream and streams to its client as usual;
+// requests arriving while it is in flight wait and receive a copy.
+type RequestCollapser struct {
+	log logger.Logger
+
+	mutex    sync.Mutex
+	inflight map[string]*inflightRequest
+}
+
+// NewRequestCollapser creates a new request collapsing middleware
+func NewRequestCollapser(log logger.Logger) *RequestCollapser {
+	return &RequestCollapser{
+		log:      log,
+		inflight: make(map[string]*inflightRequest),
+	}
+}
+
+// Collapse shares upstream calls between identical in-flight requests
+func (c *RequestCollapser) Collapse(next http.Handler, route config.Route) http.Handler {
+	if route.Middlewares == nil || route.Middlewares.Collapse == nil || !route.Middlewares.Collapse.Enabled {
+		return next
+	}
+	cfg := route.Middlewares.Collapse
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || (r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := collapseKey(r, cfg.VaryHeaders)
+
+		c.mutex.Lock()
+		call, exists := c.inflight[key]
+		if !exists {
+			call = &inflightRequest{done: make(chan struct{})}
+			c.inflight[key] = call
+		}
+		c.mutex.Unlock()
+
+		if exists {
+			c.wait(w, r, next, route, call)
+			return
+		}
+
+		// Lead the call, copying the response for waiting requests
+		recorder := &collapseRecorder{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+			maxSize:        cfg.MaxBodySize,
+		}
+		defer func() {
+			c.mutex.Lock()
+			delete(c.inflight, key)
+			c.mutex.Unlock()
+
+			call.statusCode = recorder.statusCode
+			call.header = recorder.header
+			call.body = recorder.body.Bytes()
+			call.shareable = recorder.header != nil && !recorder.truncated
+			close(call.done)
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+// wait serves a request from the in-flight call, or sends it upstream itself
+// if the shared response is unavailable
+func (c *RequestCollapser) wait(w http.ResponseWriter, r *http.Request, next http.Handler, route config.Route, call *inflightRequest) {
+	select {
+	case <-call.done:
+	case <-r.Context().Done():
+		return
+	}
+
+	if !call.shareable {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	collapsedRequests.WithLabelValues(route.Path).Inc()
+	c.log.Debug("Served collapsed request",
+		logger.String("path", r.URL.Path),
+		logger.Int("status", call.statusCode),
+	)
+
+	for key, values := range call.header {
+		w.Header()[key] = append([]string(nil), values...)
+	}
+	w.WriteHeader(call.statusCode)
+	w.Write(call.body)
+}
+
+// collapseKey identifies identical requests
+func collapseKey(r *http.Request, varyHeaders []string) string {
+	hasher := sha256.New()
+	hasher.Write([]byte(r.Method + "\x00" + r.Host + "\x00" + r.URL.Path + "\x00" + r.URL.RawQuery))
+	for _, headers := range [][]string{collapseKeyHeaders, varyHeaders} {
+		for _, header := range headers {
+			hasher.Write([]byte("\x00" + header + "=" + r.Header.Get(header)))
+		}
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// collapseRecorder passes the leading response through while keeping a copy
+// of it for waiting requests, up to maxSize bytes of body
+type collapseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	header     http.Header
+	body       bytes.Buffer
+	maxSize    int
+	truncated  bool
+}
+
+// WriteHeader snapshots the headers and status before passing them on
+func (cr *collapseRecorder) WriteHeader(statusCode int) {
+	if cr.header != nil {
+		return
+	}
+	cr.statusCode = statusCode
+	cr.header = cr.ResponseWriter.Header().Clone()
+	cr.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write copies the body while passing it on
+func (cr *collapseRecorder) Write(b []byte) (int, error) {
+	if cr.header == nil {
+		cr.WriteHeader(http.StatusOK)
+	}
+	if !cr.truncated {
+		if cr.body.Len()+len(b) > cr.maxSize {
+			cr.truncated = true
+			cr.body.Reset()
+		} else {
+			cr.body.Write(b)
+		}
+	}
+	return cr.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the original writer so flushing reaches it
+func (cr *collapseRecorder) Unwrap() http.ResponseWriter {
+	return cr.ResponseWriter
+}
@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestCollapser(t *testing.T) {
+	route := config.Route{
+		Path: "/api",
+		Middlewares: &config.Middlewares{
+			Collapse: &config.CollapseConfig{Enabled: true, VaryHeaders: []string{"Accept"}, MaxBodySize: 16},
+		},
+	}
+
+	// newUpstream returns a handler that holds requests until released, so
+	// concurrent requests overlap
+	newUpstream := func(body string) (http.Handler, *atomic.Int32, chan struct{}) {
+		var calls atomic.Int32
+		release := make(chan struct{})
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			<-release
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(body))
+		}), &calls, release
+	}
+
+	// serveConcurrently sends the requests at once and returns the recorders
+	serveConcurrently := func(handler http.Handler, calls *atomic.Int32, release chan struct{}, requests []*http.Request) []*httptest.ResponseRecorder {
+		recorders := make([]*httptest.ResponseRecorder, len(requests))
+		var wg sync.WaitGroup
+		for i, req := range requests {
+			recorders[i] = httptest.NewRecorder()
+			wg.Add(1)
+			go func(rec *httptest.ResponseRecorder, req *http.Request) {
+				defer wg.Done()
+				handler.ServeHTTP(rec, req)
+			}(recorders[i], req)
+		}
+		// Let the first request reach the upstream and the rest start waiting
+		assert.Eventually(t, func() bool { return calls.Load() >= 1 }, time.Second, time.Millisecond)
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		return recorders
+	}
+
+	t.Run("identical requests share one upstream call", func(t *testing.T) {
+		upstream, calls, release := newUpstream("shared")
+		handler := NewRequestCollapser(&mockLogger{}).Collapse(upstream, route)
+
+		var requests []*http.Request
+		for i := 0; i < 5; i++ {
+			requests = append(requests, httptest.NewRequest("GET", "http://example.com/api?id=1", nil))
+		}
+		recorders := serveConcurrently(handler, calls, release, requests)
+
+		assert.Equal(t, int32(1), calls.Load())
+		for _, rec := range recorders {
+			assert.Equal(t, http.StatusAccepted, rec.Code)
+			assert.Equal(t, "text/plain", rec.Header().Get("Content-Type"))
+			assert.Equal(t, "shared", rec.Body.String())
+		}
+	})
+
+	t.Run("different credentials are not shared", func(t *testing.T) {
+		upstream, calls, release := newUpstream("private")
+		handler := NewRequestCollapser(&mockLogger{}).Collapse(upstream, route)
+
+		first := httptest.NewRequest("GET", "http://example.com/api", nil)
+		first.Header.Set("Authorization", "Bearer a")
+		second := httptest.NewRequest("GET", "http://example.com/api", nil)
+		second.Header.Set("Authorization", "Bearer b")
+		serveConcurrently(handler, calls, release, []*http.Request{first, second})
+
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("vary headers are part of the key", func(t *testing.T) {
+		upstream, calls, release := newUpstream("varied")
+		handler := NewRequestCollapser(&mockLogger{}).Collapse(upstream, route)
+
+		first := httptest.NewRequest("GET", "http://example.com/api", nil)
+		first.Header.Set("Accept", "application/json")
+		second := httptest.NewRequest("GET", "http://example.com/api", nil)
+		second.Header.Set("Accept", "text/html")
+		serveConcurrently(handler, calls, release, []*http.Request{first, second})
+
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("oversized responses are fetched again", func(t *testing.T) {
+		upstream, calls, release := newUpstream(strings.Repeat("x", 32))
+		handler := NewRequestCollapser(&mockLogger{}).Collapse(upstream, route)
+
+		recorders := serveConcurrently(handler, calls, release, []*http.Request{
+			httptest.NewRequest("GET", "http://example.com/api", nil),
+			httptest.NewRequest("GET", "http://example.com/api", nil),
+		})
+
+		assert.Equal(t, int32(2), calls.Load())
+		for _, rec := range recorders {
+			assert.Equal(t, strings.Repeat("x", 32), rec.Body.String())
+		}
+	})
+
+	t.Run("non-GET requests are not collapsed", func(t *testing.T) {
+		upstream, calls, release := newUpstream("created")
+		handler := NewRequestCollapser(&mockLogger{}).Collapse(upstream, route)
+
+		serveConcurrently(handler, calls, release, []*http.Request{
+			httptest.NewRequest("POST", "http://example.com/api", nil),
+			httptest.NewRequest("POST", "http://example.com/api", nil),
+		})
+
+		assert.Equal(t, int32(2), calls.Load())
+	})
+}
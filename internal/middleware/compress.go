@@ -0,0 +1,301 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+
+	"github.com/andybalholm/brotli"
+)
+
+// gatewayAcceptEncoding is sent upstream when the gateway decodes responses
+// itself
+const gatewayAcceptEncoding = "br, gzip"
+
+// ResponseCompressor compresses responses for clients that accept it without
+// compressing responses the upstream already compressed a second time
+type ResponseCompressor struct {
+	log logger.Logger
+}
+
+// NewResponseCompressor creates a new response compression middleware
+func NewResponseCompressor(log logger.Logger) *ResponseCompressor {
+	return &ResponseCompressor{
+		log: log,
+	}
+}
+
+// Compress encodes responses with the client's preferred encoding
+func (c *ResponseCompressor) Compress(next http.Handler, cfg *config.ResponseCompression) http.Handler {
+	if cfg == nil || !cfg.Enabled {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding := r.Header.Get("Accept-Encoding")
+		switch cfg.UpstreamAcceptEncoding {
+		case config.UpstreamAcceptEncodingStrip:
+			r.Header.Del("Accept-Encoding")
+		case config.UpstreamAcceptEncodingGateway:
+			r.Header.Set("Accept-Encoding", gatewayAcceptEncoding)
+		}
+
+		writer := &compressWriter{
+			ResponseWriter: w,
+			config:         cfg,
+			acceptEncoding: acceptEncoding,
+			preferred:      NegotiateEncoding(acceptEncoding, cfg.Encodings),
+			head:           r.Method == http.MethodHead,
+			log:            c.log,
+		}
+		defer writer.close()
+		next.ServeHTTP(writer, r)
+	})
+}
+
+// NegotiateEncoding returns the supported encoding the Accept-Encoding header
+// weighs highest, preferring earlier supported encodings on ties, or "" if the
+// client accepts none of them
+func NegotiateEncoding(acceptEncoding string, supported []string) string {
+	best, bestWeight := "", 0.0
+	for _, encoding := range supported {
+		if weight := encodingWeight(acceptEncoding, encoding); weight > bestWeight {
+			best, bestWeight = encoding, weight
+		}
+	}
+	return best
+}
+
+// AcceptsEncoding reports whether an Accept-Encoding header allows an encoding
+func AcceptsEncoding(acceptEncoding, encoding string) bool {
+	return encodingWeight(acceptEncoding, encoding) > 0
+}
+
+// encodingWeight returns the q-value an Accept-Encoding header gives an
+// encoding, falling back to the "*" entry
+func encodingWeight(acceptEncoding, encoding string) float64 {
+	weight, wildcard := -1.0, 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.TrimSpace(name)
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+
+		switch {
+		case strings.EqualFold(name, encoding):
+			weight = q
+		case name == "*":
+			wildcard = q
+		}
+	}
+	if weight < 0 {
+		return wildcard
+	}
+	return weight
+}
+
+// compressWriter decides how to encode the response once its headers are
+// known: compress it, pass an upstream encoding through or transcode it
+type compressWriter struct {
+	http.ResponseWriter
+	config         *config.ResponseCompression
+	acceptEncoding string
+	preferred      string
+	head           bool
+	log            logger.Logger
+
+	wroteHeader bool
+	out         io.Writer
+	encoder     encoder
+	pipe        *io.PipeWriter
+	done        chan struct{}
+}
+
+// encoder is a compressing writer
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// WriteHeader picks the encoding before sending the headers
+func (w *compressWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.out = w.ResponseWriter
+	w.chooseEncoding(statusCode)
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write sends the body through the chosen encoding
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.out.Write(b)
+}
+
+// Flush sends compressed data buffered so far to the client. Transcoded
+// responses are flushed when complete.
+func (w *compressWriter) Flush() {
+	if w.pipe != nil {
+		return
+	}
+	if w.encoder != nil {
+		w.encoder.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap returns the original writer so response controllers reach it
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// chooseEncoding sets up compression, pass-through or transcoding based on
+// the response headers
+func (w *compressWriter) chooseEncoding(statusCode int) {
+	header := w.Header()
+	if w.head || statusCode < http.StatusOK || statusCode == http.StatusNoContent || statusCode == http.StatusNotModified ||
+		header.Get("Content-Range") != "" || strings.Contains(header.Get("Cache-Control"), "no-transform") {
+		return
+	}
+
+	upstreamEncoding := strings.ToLower(strings.TrimSpace(header.Get("Content-Encoding")))
+	if upstreamEncoding != "" && upstreamEncoding != "identity" {
+		addVary(header, "Accept-Encoding")
+
+		// Already compressed responses are never compressed again
+		clientAccepts := AcceptsEncoding(w.acceptEncoding, upstreamEncoding)
+		if clientAccepts && (!w.config.Reencode || w.preferred == "" || w.preferred == upstreamEncoding) {
+			return
+		}
+		if !canDecode(upstreamEncoding) {
+			return
+		}
+		w.transcode(upstreamEncoding)
+		return
+	}
+
+	if !w.compressible(header.Get("Content-Type")) {
+		return
+	}
+	addVary(header, "Accept-Encoding")
+	if w.preferred == "" {
+		return
+	}
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil && length < w.config.MinSize {
+		return
+	}
+
+	header.Del("Content-Length")
+	header.Set("Content-Encoding", w.preferred)
+	weakenETag(header)
+	w.encoder = getEncoder(w.preferred, w.ResponseWriter)
+	w.out = w.encoder
+}
+
+// transcode decodes the upstream encoding and re-encodes the body with the
+// client's preferred encoding, or sends it plain if it accepts none
+func (w *compressWriter) transcode(upstreamEncoding string) {
+	header := w.Header()
+	header.Del("Content-Length")
+	header.Del("Content-Encoding")
+	if w.preferred != "" {
+		header.Set("Content-Encoding", w.preferred)
+	}
+	weakenETag(header)
+
+	reader, writer := io.Pipe()
+	w.pipe = writer
+	w.out = writer
+	w.done = make(chan struct{})
+	target := w.preferred
+
+	go func() {
+		defer close(w.done)
+
+		decoded, err := newDecoder(upstreamEncoding, reader)
+		if err == nil {
+			var dst io.Writer = w.ResponseWriter
+			var enc encoder
+			if target != "" {
+				enc = getEncoder(target, w.ResponseWriter)
+				dst = enc
+			}
+			_, err = io.Copy(dst, decoded)
+			if enc != nil {
+				enc.Close()
+				putEncoder(enc)
+			}
+		}
+		if err != nil {
+			w.log.Debug("Failed to transcode upstream response",
+				logger.String("from", upstreamEncoding),
+				logger.String("to", target),
+				logger.Error(err),
+			)
+		}
+		reader.CloseWithError(err)
+	}()
+}
+
+// close finishes the encoded body
+func (w *compressWriter) close() {
+	switch {
+	case w.pipe != nil:
+		w.pipe.Close()
+		<-w.done
+	case w.encoder != nil:
+		w.encoder.Close()
+		putEncoder(w.encoder)
+		w.encoder = nil
+	}
+}
+
+// compressible reports whether a content type is worth compressing
+func (w *compressWriter) compressible(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, prefix := range w.config.ContentTypes {
+		if strings.HasPrefix(contentType, strings.ToLower(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// weakenETag marks a strong ETag weak since the encoded bytes differ from the
+// representation it was computed for
+func weakenETag(header http.Header) {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+}
+
+// canDecode reports whether the gateway can decode a response encoding
+func canDecode(encoding string) bool {
+	switch encoding {
+	case "gzip", "x-gzip", "br":
+		return true
+	}
+	return false
+}
+
+// newDecoder returns a reader decoding r
+func newDecoder(encoding string, r io.Reader) (io.Reader, error) {
+	if encoding == "br" {
+		return brotli.NewReader(r), nil
+	}
+	return gzip.NewReader(r)
+}
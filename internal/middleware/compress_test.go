@@ -0,0 +1,218 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"api-gateway/internal/config"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	supported := []string{"br", "gzip"}
+
+	assert.Equal(t, "br", NegotiateEncoding("gzip, deflate, br", supported))
+	assert.Equal(t, "gzip", NegotiateEncoding("gzip;q=1.0, br;q=0.5", supported))
+	assert.Equal(t, "gzip", NegotiateEncoding("gzip, br;q=0", supported))
+	assert.Equal(t, "br", NegotiateEncoding("*", supported))
+	assert.Equal(t, "gzip", NegotiateEncoding("*, br;q=0", supported))
+	assert.Equal(t, "", NegotiateEncoding("deflate", supported))
+	assert.Equal(t, "", NegotiateEncoding("", supported))
+
+	assert.True(t, AcceptsEncoding("GZIP;q=0.5", "gzip"))
+	assert.False(t, AcceptsEncoding("gzip;q=0", "gzip"))
+}
+
+func TestResponseCompressor(t *testing.T) {
+	body := strings.Repeat(`{"message": "hello world"}`, 100)
+	newConfig := func() *config.ResponseCompression {
+		return &config.ResponseCompression{
+			Enabled:      true,
+			Encodings:    []string{"br", "gzip"},
+			MinSize:      1024,
+			ContentTypes: []string{"text/", "application/json"},
+		}
+	}
+
+	// upstream returns a handler answering with body, encoded if encoding is set,
+	// and recording the Accept-Encoding it received
+	upstream := func(encoding string, seenAcceptEncoding *string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if seenAcceptEncoding != nil {
+				*seenAcceptEncoding = r.Header.Get("Accept-Encoding")
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("ETag", `"v1"`)
+			if encoding == "" {
+				w.Write([]byte(body))
+				return
+			}
+			w.Header().Set("Content-Encoding", encoding)
+			w.Write(encode(t, encoding, body))
+		})
+	}
+	serve := func(handler http.Handler, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "http://example.com/api", nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	compressor := NewResponseCompressor(&mockLogger{})
+
+	t.Run("compresses with the preferred encoding", func(t *testing.T) {
+		rec := serve(compressor.Compress(upstream("", nil), newConfig()), "gzip, br")
+
+		assert.Equal(t, "br", rec.Header().Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+		assert.Equal(t, `W/"v1"`, rec.Header().Get("ETag"))
+		assert.Equal(t, body, decode(t, "br", rec.Body.Bytes()))
+	})
+
+	t.Run("upstream compressed responses are passed through", func(t *testing.T) {
+		rec := serve(compressor.Compress(upstream("gzip", nil), newConfig()), "gzip, br")
+
+		assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+		assert.Equal(t, `"v1"`, rec.Header().Get("ETag"))
+		assert.Equal(t, body, decode(t, "gzip", rec.Body.Bytes()))
+	})
+
+	t.Run("upstream compressed responses are re-encoded when enabled", func(t *testing.T) {
+		cfg := newConfig()
+		cfg.Reencode = true
+		rec := serve(compressor.Compress(upstream("gzip", nil), cfg), "gzip, br")
+
+		assert.Equal(t, "br", rec.Header().Get("Content-Encoding"))
+		assert.Equal(t, body, decode(t, "br", rec.Body.Bytes()))
+	})
+
+	t.Run("encodings the client can't accept are decoded", func(t *testing.T) {
+		rec := serve(compressor.Compress(upstream("br", nil), newConfig()), "")
+
+		assert.Empty(t, rec.Header().Get("Content-Encoding"))
+		assert.Equal(t, body, rec.Body.String())
+	})
+
+	t.Run("small and incompressible responses are sent as is", func(t *testing.T) {
+		small := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Length", "2")
+			w.Write([]byte("{}"))
+		})
+		rec := serve(compressor.Compress(small, newConfig()), "gzip")
+		assert.Empty(t, rec.Header().Get("Content-Encoding"))
+		assert.Equal(t, "{}", rec.Body.String())
+
+		image := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte(body))
+		})
+		rec = serve(compressor.Compress(image, newConfig()), "gzip")
+		assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	})
+
+	t.Run("accept encoding forwarding", func(t *testing.T) {
+		testCases := []struct {
+			mode string
+			want string
+		}{
+			{mode: config.UpstreamAcceptEncodingForward, want: "gzip"},
+			{mode: config.UpstreamAcceptEncodingStrip, want: ""},
+			{mode: config.UpstreamAcceptEncodingGateway, want: gatewayAcceptEncoding},
+		}
+		for _, tc := range testCases {
+			cfg := newConfig()
+			cfg.UpstreamAcceptEncoding = tc.mode
+			var seen string
+			serve(compressor.Compress(upstream("", &seen), cfg), "gzip")
+			assert.Equal(t, tc.want, seen, tc.mode)
+		}
+	})
+}
+
+// encode compresses s with the encoding
+func encode(t *testing.T, encoding, s string) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser = gzip.NewWriter(&buf)
+	if encoding == "br" {
+		w = brotli.NewWriter(&buf)
+	}
+	_, err := w.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// decode decompresses b with the encoding
+func decode(t *testing.T, encoding string, b []byte) string {
+	var r io.Reader = brotli.NewReader(bytes.NewReader(b))
+	if encoding == "gzip" {
+		gz, err := gzip.NewReader(bytes.NewReader(b))
+		require.NoError(t, err)
+		r = gz
+	}
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestResponseCompressorPooledEncoders(t *testing.T) {
+	compressor := NewResponseCompressor(&mockLogger{})
+	cfg := &config.ResponseCompression{
+		Enabled:      true,
+		Encodings:    []string{"br", "gzip"},
+		ContentTypes: []string{"text/"},
+	}
+	handler := compressor.Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, strings.Repeat(r.URL.Path, 50))
+	}), cfg)
+
+	// Each response is encoded on its own by the reused encoders
+	for i := 0; i < 3; i++ {
+		for _, encoding := range []string{"gzip", "br"} {
+			path := fmt.Sprintf("/%s/%d", encoding, i)
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set("Accept-Encoding", encoding)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, encoding, rec.Header().Get("Content-Encoding"))
+			assert.Equal(t, strings.Repeat(path, 50), decode(t, encoding, rec.Body.Bytes()))
+		}
+	}
+}
+
+func BenchmarkCompressGzip(b *testing.B) {
+	compressor := NewResponseCompressor(&mockLogger{})
+	body := []byte(strings.Repeat(`{"message": "hello world"}`, 600))
+	handler := compressor.Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}), &config.ResponseCompression{
+		Enabled:      true,
+		Encodings:    []string{"gzip"},
+		ContentTypes: []string{"application/json"},
+	})
+	req := httptest.NewRequest(http.MethodGet, "/items", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := discardResponseWriter{header: make(http.Header)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		clear(w.header)
+		handler.ServeHTTP(w, req)
+	}
+}
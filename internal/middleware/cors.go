@@ -2,8 +2,10 @@ package middleware
 
 import (
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 
 	"api-gateway/internal/config"
 	"api-gateway/pkg/logger"
@@ -13,14 +15,78 @@ import (
 type CORSMiddleware struct {
 	config *config.CORSConfig
 	log    logger.Logger
+
+	anyOrigin bool
+	exact     map[string]bool
+	wildcards []originWildcard
+	patterns  []*regexp.Regexp
+	allowFunc func(origin string) bool
+
+	cacheMutex sync.Mutex
+	cache      map[string]bool
+}
+
+// originWildcard matches origins of the form scheme://*.domain
+type originWildcard struct {
+	prefix string
+	suffix string
+}
+
+// match reports whether origin is a subdomain matched by the wildcard
+func (o originWildcard) match(origin string) bool {
+	if len(origin) <= len(o.prefix)+len(o.suffix) ||
+		!strings.HasPrefix(origin, o.prefix) || !strings.HasSuffix(origin, o.suffix) {
+		return false
+	}
+	// The subdomain part must stay within the host
+	subdomain := origin[len(o.prefix) : len(origin)-len(o.suffix)]
+	return !strings.ContainsAny(subdomain, "/:@?#")
 }
 
 // NewCORSMiddleware creates a new CORS middleware
 func NewCORSMiddleware(config *config.CORSConfig, log logger.Logger) *CORSMiddleware {
-	return &CORSMiddleware{
-		config: config,
-		log:    log,
+	c := &CORSMiddleware{
+		config:    config,
+		log:       log,
+		anyOrigin: config.AllowAllOrigins,
+		exact:     make(map[string]bool),
+		cache:     make(map[string]bool),
+	}
+
+	for _, origin := range config.AllowedOrigins {
+		switch {
+		case origin == "*":
+			c.anyOrigin = true
+		case strings.Contains(origin, "*"):
+			prefix, suffix, _ := strings.Cut(origin, "*")
+			c.wildcards = append(c.wildcards, originWildcard{prefix: prefix, suffix: suffix})
+		default:
+			c.exact[origin] = true
+		}
 	}
+
+	for _, pattern := range config.AllowedOriginPatterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			log.Error("Ignoring invalid CORS origin pattern",
+				logger.String("pattern", pattern),
+				logger.Error(err),
+			)
+			continue
+		}
+		c.patterns = append(c.patterns, re)
+	}
+
+	return c
+}
+
+// SetAllowOriginFunc sets a callback deciding origins not allowed by the
+// configuration. Decisions are cached like configured matches.
+func (c *CORSMiddleware) SetAllowOriginFunc(fn func(origin string) bool) {
+	c.cacheMutex.Lock()
+	defer c.cacheMutex.Unlock()
+	c.allowFunc = fn
+	c.cache = make(map[string]bool)
 }
 
 // CORS middleware handles Cross-Origin Resource Sharing
@@ -32,6 +98,12 @@ func (c *CORSMiddleware) CORS(next http.Handler) http.Handler {
 			return
 		}
 
+		// Unless every origin gets the same "*" response, responses differ by
+		// Origin and caches must key on it, including for rejected origins
+		if !useWildcardOrigin(c.config) {
+			addVary(w.Header(), "Origin")
+		}
+
 		origin := r.Header.Get("Origin")
 		if origin == "" {
 			// Not a CORS request, continue
@@ -86,6 +158,7 @@ func (w *corsResponseWriter) handlePreflight(requestMethod string) {
 	w.Header().Set("Access-Control-Allow-Methods", strings.Join(w.config.AllowedMethods, ","))
 	w.Header().Set("Access-Control-Allow-Headers", strings.Join(w.config.AllowedHeaders, ","))
 	w.Header().Set("Access-Control-Max-Age", strconv.Itoa(w.config.MaxAge))
+	addVary(w.Header(), "Access-Control-Request-Method", "Access-Control-Request-Headers")
 
 	w.log.Info("CORS preflight request processed",
 		logger.String("origin", w.origin),
@@ -121,15 +194,11 @@ func (w *corsResponseWriter) setCORSHeaders() {
 	}
 
 	// Set allowed origin
-	useWildcard := w.config.AllowAllOrigins ||
-		(len(w.config.AllowedOrigins) == 1 && w.config.AllowedOrigins[0] == "*" &&
-			!w.config.AllowCredentials)
-
-	if useWildcard {
+	if useWildcardOrigin(w.config) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 	} else {
 		w.Header().Set("Access-Control-Allow-Origin", w.origin)
-		w.Header().Set("Vary", "Origin")
+		addVary(w.Header(), "Origin")
 	}
 
 	// Set other CORS headers
@@ -142,20 +211,73 @@ func (w *corsResponseWriter) setCORSHeaders() {
 	}
 }
 
-// isOriginAllowed checks if the origin is allowed
+// useWildcardOrigin reports whether every allowed origin gets
+// Access-Control-Allow-Origin: *. Browsers reject "*" with credentials, so the
+// origin is reflected instead in that case.
+func useWildcardOrigin(cfg *config.CORSConfig) bool {
+	if cfg.ReflectOrigin || cfg.AllowCredentials {
+		return false
+	}
+	return cfg.AllowAllOrigins ||
+		(len(cfg.AllowedOrigins) == 1 && cfg.AllowedOrigins[0] == "*")
+}
+
+// addVary adds values to the Vary header unless already present
+func addVary(header http.Header, values ...string) {
+	existing := make(map[string]bool)
+	for _, line := range header.Values("Vary") {
+		for _, value := range strings.Split(line, ",") {
+			existing[strings.ToLower(strings.TrimSpace(value))] = true
+		}
+	}
+	for _, value := range values {
+		if !existing[strings.ToLower(value)] && !existing["*"] {
+			header.Add("Vary", value)
+		}
+	}
+}
+
+// isOriginAllowed checks if the origin is allowed, caching wildcard, pattern
+// and callback decisions
 func (c *CORSMiddleware) isOriginAllowed(origin string) bool {
-	if c.config.AllowAllOrigins {
+	if c.anyOrigin || c.exact[origin] {
 		return true
 	}
 
-	for _, allowedOrigin := range c.config.AllowedOrigins {
-		if allowedOrigin == "*" {
+	c.cacheMutex.Lock()
+	allowed, cached := c.cache[origin]
+	allowFunc := c.allowFunc
+	c.cacheMutex.Unlock()
+	if cached {
+		return allowed
+	}
+
+	allowed = c.matchOrigin(origin, allowFunc)
+
+	if c.config.OriginCacheSize > 0 {
+		c.cacheMutex.Lock()
+		// Origins are client controlled, so the cache is bounded by starting
+		// over once it is full
+		if len(c.cache) >= c.config.OriginCacheSize {
+			c.cache = make(map[string]bool)
+		}
+		c.cache[origin] = allowed
+		c.cacheMutex.Unlock()
+	}
+	return allowed
+}
+
+// matchOrigin checks the wildcard origins, patterns and callback
+func (c *CORSMiddleware) matchOrigin(origin string, allowFunc func(string) bool) bool {
+	for _, wildcard := range c.wildcards {
+		if wildcard.match(origin) {
 			return true
 		}
-		if allowedOrigin == origin {
+	}
+	for _, pattern := range c.patterns {
+		if pattern.MatchString(origin) {
 			return true
 		}
 	}
-
-	return false
+	return allowFunc != nil && allowFunc(origin)
 }
@@ -368,3 +368,132 @@ func TestCORSResponseWriter_Write(t *testing.T) {
 	// Check if headers were set correctly
 	assert.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
 }
+
+func TestCORSMiddleware_OriginMatching(t *testing.T) {
+	cfg := &config.CORSConfig{
+		Enabled:               true,
+		AllowedOrigins:        []string{"https://app.example.com", "https://*.example.org"},
+		AllowedOriginPatterns: []string{`https://preview-[0-9]+\.example\.net`},
+		OriginCacheSize:       2,
+	}
+	middleware := NewCORSMiddleware(cfg, &mockCORSLogger{})
+
+	testCases := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://app.example.com", true},
+		{"https://other.example.com", false},
+		{"https://api.example.org", true},
+		{"https://a.b.example.org", true},
+		{"https://example.org", false},
+		{"http://api.example.org", false},
+		{"https://evil.com/.example.org", false},
+		{"https://user@evil.com:.example.org", false},
+		{"https://preview-42.example.net", true},
+		{"https://preview-42.example.net.evil.com", false},
+		{"https://preview-x.example.net", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.origin, func(t *testing.T) {
+			assert.Equal(t, tc.allowed, middleware.isOriginAllowed(tc.origin))
+			// Cached decisions give the same answer
+			assert.Equal(t, tc.allowed, middleware.isOriginAllowed(tc.origin))
+		})
+	}
+
+	assert.LessOrEqual(t, len(middleware.cache), cfg.OriginCacheSize)
+}
+
+func TestCORSMiddleware_AllowOriginFunc(t *testing.T) {
+	cfg := &config.CORSConfig{
+		Enabled:         true,
+		AllowedOrigins:  []string{"https://app.example.com"},
+		ReflectOrigin:   true,
+		OriginCacheSize: 10,
+	}
+	middleware := NewCORSMiddleware(cfg, &mockCORSLogger{})
+
+	calls := 0
+	middleware.SetAllowOriginFunc(func(origin string) bool {
+		calls++
+		return origin == "https://tenant.example.io"
+	})
+
+	handler := middleware.CORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "http://example.com/api/test", nil)
+		req.Header.Set("Origin", "https://tenant.example.io")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, "https://tenant.example.io", rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+	assert.Equal(t, 1, calls)
+
+	// Exact matches don't consult the callback
+	assert.True(t, middleware.isOriginAllowed("https://app.example.com"))
+	assert.False(t, middleware.isOriginAllowed("https://other.example.io"))
+	assert.Equal(t, 2, calls)
+}
+
+func TestCORSMiddleware_Vary(t *testing.T) {
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	t.Run("origin dependent responses vary on every path", func(t *testing.T) {
+		middleware := NewCORSMiddleware(&config.CORSConfig{
+			Enabled:        true,
+			AllowedOrigins: []string{"https://*.example.com"},
+			AllowedMethods: []string{"GET"},
+		}, &mockCORSLogger{})
+		handler := middleware.CORS(testHandler)
+
+		for _, origin := range []string{"", "https://evil.com", "https://app.example.com"} {
+			req := httptest.NewRequest("GET", "http://example.com/api/test", nil)
+			if origin != "" {
+				req.Header.Set("Origin", origin)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, []string{"Origin", "Accept-Encoding"}, rec.Header().Values("Vary"), origin)
+		}
+
+		req := httptest.NewRequest("OPTIONS", "http://example.com/api/test", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}, rec.Header().Values("Vary"))
+	})
+
+	t.Run("wildcard responses don't vary", func(t *testing.T) {
+		middleware := NewCORSMiddleware(&config.CORSConfig{Enabled: true, AllowAllOrigins: true}, &mockCORSLogger{})
+		req := httptest.NewRequest("GET", "http://example.com/api/test", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		rec := httptest.NewRecorder()
+		middleware.CORS(testHandler).ServeHTTP(rec, req)
+
+		assert.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, []string{"Accept-Encoding"}, rec.Header().Values("Vary"))
+	})
+
+	t.Run("credentials reflect the origin", func(t *testing.T) {
+		middleware := NewCORSMiddleware(&config.CORSConfig{Enabled: true, AllowAllOrigins: true, AllowCredentials: true}, &mockCORSLogger{})
+		req := httptest.NewRequest("GET", "http://example.com/api/test", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		rec := httptest.NewRecorder()
+		middleware.CORS(testHandler).ServeHTTP(rec, req)
+
+		assert.Equal(t, "https://app.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"))
+	})
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+
+	"github.com/andybalholm/brotli"
+)
+
+var (
+	errUnsupportedEncoding = errors.New("unsupported content encoding")
+	errBodyTooLarge        = errors.New("decompressed body too large")
+)
+
+// RequestDecompressor transparently decompresses encoded request bodies
+type RequestDecompressor struct {
+	log logger.Logger
+}
+
+// NewRequestDecompressor creates a new request decompression middleware
+func NewRequestDecompressor(log logger.Logger) *RequestDecompressor {
+	return &RequestDecompressor{
+		log: log,
+	}
+}
+
+// Decompress replaces gzip/br/deflate encoded request bodies with their plain content
+func (d *RequestDecompressor) Decompress(next http.Handler, cfg *config.RequestDecompression) http.Handler {
+	if cfg == nil || !cfg.Enabled {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentEncoding := r.Header.Get("Content-Encoding")
+		if contentEncoding == "" || strings.EqualFold(contentEncoding, "identity") || r.Body == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := d.decode(r.Body, contentEncoding, cfg)
+		r.Body.Close()
+		if err != nil {
+			d.log.Debug("Request decompression failed",
+				logger.String("path", r.URL.Path),
+				logger.String("content_encoding", contentEncoding),
+				logger.Error(err),
+			)
+
+			switch {
+			case errors.Is(err, errUnsupportedEncoding):
+				http.Error(w, "Unsupported Content-Encoding", http.StatusUnsupportedMediaType)
+			case errors.Is(err, errBodyTooLarge):
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			default:
+				http.Error(w, "Malformed compressed request body", http.StatusBadRequest)
+			}
+			return
+		}
+
+		// Present the plain body to downstream handlers and the upstream
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		r.Header.Del("Content-Encoding")
+
+		d.log.Debug("Request body decompressed",
+			logger.String("path", r.URL.Path),
+			logger.String("content_encoding", contentEncoding),
+			logger.Int("size", len(body)),
+		)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decode applies the listed content codings in reverse order, enforcing the size limit
+func (d *RequestDecompressor) decode(body io.Reader, contentEncoding string, cfg *config.RequestDecompression) ([]byte, error) {
+	encodings := strings.Split(contentEncoding, ",")
+
+	reader := body
+	for i := len(encodings) - 1; i >= 0; i-- {
+		encoding := strings.ToLower(strings.TrimSpace(encodings[i]))
+		if encoding == "identity" || encoding == "" {
+			continue
+		}
+		if !contains(cfg.Encodings, encoding) {
+			return nil, errUnsupportedEncoding
+		}
+
+		switch encoding {
+		case "gzip", "x-gzip":
+			gz, err := gzip.NewReader(reader)
+			if err != nil {
+				return nil, err
+			}
+			defer gz.Close()
+			reader = gz
+		case "br":
+			reader = brotli.NewReader(reader)
+		case "deflate":
+			// HTTP's deflate coding is the zlib format, RFC 9110 8.4.1.2
+			zr, err := zlib.NewReader(reader)
+			if err != nil {
+				return nil, err
+			}
+			defer zr.Close()
+			reader = zr
+		default:
+			return nil, errUnsupportedEncoding
+		}
+	}
+
+	maxSize := cfg.MaxSize
+	if maxSize <= 0 {
+		maxSize = 10 << 20
+	}
+
+	// Read one byte past the limit to detect oversized bodies
+	data, err := io.ReadAll(io.LimitReader(reader, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, errBodyTooLarge
+	}
+
+	return data, nil
+}
@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"api-gateway/internal/config"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func brotliBytes(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	br := brotli.NewWriter(&buf)
+	_, err := br.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, br.Close())
+	return buf.Bytes()
+}
+
+func zlibBytes(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	_, err := zw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func echoBodyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Received-Encoding", r.Header.Get("Content-Encoding"))
+		w.Header().Set("X-Received-Length", r.Header.Get("Content-Length"))
+		w.Write(body)
+	})
+}
+
+func TestRequestDecompressor(t *testing.T) {
+	payload := []byte(`{"event":"created","id":42}`)
+	cfg := &config.RequestDecompression{
+		Enabled:   true,
+		Encodings: []string{"gzip", "br"},
+		MaxSize:   1024,
+	}
+	handler := NewRequestDecompressor(&mockLogger{}).Decompress(echoBodyHandler(), cfg)
+
+	testCases := []struct {
+		name           string
+		encoding       string
+		body           []byte
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"gzip", "gzip", gzipBytes(t, payload), http.StatusOK, string(payload)},
+		{"brotli", "br", brotliBytes(t, payload), http.StatusOK, string(payload)},
+		{"plain", "", payload, http.StatusOK, string(payload)},
+		{"unsupported encoding", "deflate", payload, http.StatusUnsupportedMediaType, ""},
+		{"malformed gzip", "gzip", []byte("not gzip"), http.StatusBadRequest, ""},
+		{"too large", "gzip", gzipBytes(t, bytes.Repeat([]byte("a"), 2048)), http.StatusRequestEntityTooLarge, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/events", bytes.NewReader(tc.body))
+			if tc.encoding != "" {
+				req.Header.Set("Content-Encoding", tc.encoding)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expectedStatus, rec.Code)
+			if tc.expectedStatus == http.StatusOK {
+				assert.Equal(t, tc.expectedBody, rec.Body.String())
+				assert.Empty(t, rec.Header().Get("X-Received-Encoding"))
+			}
+			if tc.expectedStatus == http.StatusOK && tc.encoding != "" {
+				assert.Equal(t, strconv.Itoa(len(payload)), rec.Header().Get("X-Received-Length"))
+			}
+		})
+	}
+}
+
+func TestRequestDecompressorDeflate(t *testing.T) {
+	payload := []byte(`{"event":"created","id":42}`)
+	cfg := &config.RequestDecompression{Enabled: true, Encodings: []string{"deflate"}, MaxSize: 1024}
+	handler := NewRequestDecompressor(&mockLogger{}).Decompress(echoBodyHandler(), cfg)
+
+	req := httptest.NewRequest("POST", "/events", bytes.NewReader(zlibBytes(t, payload)))
+	req.Header.Set("Content-Encoding", "deflate")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, string(payload), rec.Body.String())
+}
+
+func TestRequestDecompressorDisabled(t *testing.T) {
+	next := echoBodyHandler()
+	decompressor := NewRequestDecompressor(&mockLogger{})
+
+	assert.NotNil(t, decompressor.Decompress(next, nil))
+	assert.NotNil(t, decompressor.Decompress(next, &config.RequestDecompression{Enabled: false}))
+
+	// Disabled middleware passes encoded bodies through untouched
+	body := gzipBytes(t, []byte("data"))
+	req := httptest.NewRequest("POST", "/events", bytes.NewReader(body))
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	decompressor.Decompress(next, &config.RequestDecompression{Enabled: false}).ServeHTTP(rec, req)
+
+	assert.Equal(t, "gzip", rec.Header().Get("X-Received-Encoding"))
+	assert.Equal(t, body, rec.Body.Bytes())
+}
@@ -0,0 +1,311 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/config"
+	"api-gateway/internal/util"
+	"api-gateway/pkg/logger"
+
+	"google.golang.org/grpc"
+)
+
+// maxExtAuthzCacheEntries bounds the number of cached authorization decisions
+const maxExtAuthzCacheEntries = 10000
+
+// ExtAuthzRequest is the JSON body sent to the external authorization service
+type ExtAuthzRequest struct {
+	Method   string            `json:"method"`
+	Path     string            `json:"path"`
+	Query    string            `json:"query,omitempty"`
+	Host     string            `json:"host"`
+	Headers  map[string]string `json:"headers"`
+	ClientIP string            `json:"client_ip"`
+	Identity *auth.Identity    `json:"identity,omitempty"`
+}
+
+// ExtAuthzResponse is the optional JSON body of an allow decision
+type ExtAuthzResponse struct {
+	Headers map[string]string `json:"headers"`
+}
+
+// extAuthzDecision is the outcome of an authorization check
+type extAuthzDecision struct {
+	allowed         bool
+	statusCode      int
+	body            []byte
+	contentType     string
+	responseHeaders map[string]string // Sent to the client with a denial
+	headers         map[string]string
+	removeHeaders   []string
+	expiration      time.Time
+}
+
+// ExtAuthz delegates authorization decisions to an external HTTP or gRPC
+// service
+type ExtAuthz struct {
+	client *http.Client
+	conns  map[string]*grpc.ClientConn // gRPC authorization services by url
+	cache  map[string]*extAuthzDecision
+	mutex  sync.Mutex
+	log    logger.Logger
+}
+
+// NewExtAuthz creates a new external authorization middleware
+func NewExtAuthz(log logger.Logger) *ExtAuthz {
+	return &ExtAuthz{
+		client: &http.Client{
+			// A redirect is the service's answer, not a new place to ask
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		conns: make(map[string]*grpc.ClientConn),
+		cache: make(map[string]*extAuthzDecision),
+		log:   log,
+	}
+}
+
+// Close closes the connections to gRPC authorization services
+func (e *ExtAuthz) Close() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for target, conn := range e.conns {
+		conn.Close()
+		delete(e.conns, target)
+	}
+}
+
+// Authorize asks the authorization service whether each request may proceed.
+// In http mode a 2xx response allows the request and may inject headers for
+// the upstream, and any other 4xx response is relayed to the client. In grpc
+// mode an OK status allows the request and any other status denies it with
+// the denied response, 403 by default. Errors and 5xx responses are handled
+// according to the fail-open policy.
+func (e *ExtAuthz) Authorize(next http.Handler, cfg *config.ExtAuthzConfig) http.Handler {
+	if cfg == nil || !cfg.Enabled {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checkReq := e.buildCheckRequest(r, cfg)
+
+		var key string
+		if cfg.CacheTTL > 0 {
+			key = extAuthzCacheKey(cfg.URL, checkReq)
+		}
+
+		decision := e.cached(key)
+		if decision == nil {
+			var err error
+			decision, err = e.check(r.Context(), cfg, checkReq)
+			if err != nil {
+				e.log.Warn("External authorization check failed",
+					logger.String("path", r.URL.Path),
+					logger.Bool("fail_open", cfg.FailOpen),
+					logger.String("reason", err.Error()),
+				)
+				if !cfg.FailOpen {
+					safeError(w, "Authorization service unavailable", http.StatusServiceUnavailable)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			e.store(key, decision, time.Duration(cfg.CacheTTL)*time.Second)
+		}
+
+		if !decision.allowed {
+			e.log.Debug("Request denied by external authorization",
+				logger.String("path", r.URL.Path),
+				logger.Int("status", decision.statusCode),
+			)
+			if decision.contentType != "" {
+				w.Header().Set("Content-Type", decision.contentType)
+			}
+			for name, value := range decision.responseHeaders {
+				w.Header().Set(name, value)
+			}
+			w.WriteHeader(decision.statusCode)
+			w.Write(decision.body)
+			return
+		}
+
+		for _, name := range decision.removeHeaders {
+			r.Header.Del(name)
+		}
+		for name, value := range decision.headers {
+			r.Header.Set(name, value)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// buildCheckRequest describes the request for the authorization service
+func (e *ExtAuthz) buildCheckRequest(r *http.Request, cfg *config.ExtAuthzConfig) *ExtAuthzRequest {
+	return &ExtAuthzRequest{
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Query:    r.URL.RawQuery,
+		Host:     r.Host,
+		Headers:  requestHeaderMap(r, cfg.Headers),
+		ClientIP: util.GetClientIP(r),
+		Identity: auth.IdentityFromContext(r.Context()),
+	}
+}
+
+// requestHeaderMap returns the named request headers, or all of them if names is
+// empty, keyed by lowercase name with multiple values joined
+func requestHeaderMap(r *http.Request, names []string) map[string]string {
+	headers := make(map[string]string)
+	if len(names) > 0 {
+		for _, name := range names {
+			if values := r.Header.Values(name); len(values) > 0 {
+				headers[strings.ToLower(name)] = strings.Join(values, ", ")
+			}
+		}
+		return headers
+	}
+
+	for name, values := range r.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ", ")
+	}
+	return headers
+}
+
+// check calls the authorization service and interprets its response
+func (e *ExtAuthz) check(ctx context.Context, cfg *config.ExtAuthzConfig, checkReq *ExtAuthzRequest) (*extAuthzDecision, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.TimeoutMs)*time.Millisecond)
+	defer cancel()
+
+	if cfg.Mode == config.ExtAuthzModeGRPC {
+		return e.checkGRPC(ctx, cfg, checkReq)
+	}
+	return e.checkHTTP(ctx, cfg, checkReq)
+}
+
+// checkHTTP posts the check request as JSON to the authorization service
+func (e *ExtAuthz) checkHTTP(ctx context.Context, cfg *config.ExtAuthzConfig, checkReq *ExtAuthzRequest) (*extAuthzDecision, error) {
+	body, err := json.Marshal(checkReq)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		decision := &extAuthzDecision{allowed: true}
+		if len(bytes.TrimSpace(respBody)) > 0 && strings.Contains(resp.Header.Get("Content-Type"), "json") {
+			var authzResp ExtAuthzResponse
+			if err := json.Unmarshal(respBody, &authzResp); err != nil {
+				return nil, fmt.Errorf("invalid authorization response: %w", err)
+			}
+			decision.headers = authzResp.Headers
+		}
+		return decision, nil
+	case resp.StatusCode >= 500:
+		// Only failures of the service itself are subject to fail_open
+		return nil, fmt.Errorf("authorization service returned status %d", resp.StatusCode)
+	case resp.StatusCode >= 400:
+		return &extAuthzDecision{
+			statusCode:  resp.StatusCode,
+			body:        respBody,
+			contentType: resp.Header.Get("Content-Type"),
+		}, nil
+	default:
+		// Any other answer, such as a redirect, is a denial
+		return &extAuthzDecision{statusCode: http.StatusForbidden}, nil
+	}
+}
+
+// cached returns an unexpired cached decision for key
+func (e *ExtAuthz) cached(key string) *extAuthzDecision {
+	if key == "" {
+		return nil
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	decision, ok := e.cache[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(decision.expiration) {
+		delete(e.cache, key)
+		return nil
+	}
+	return decision
+}
+
+// store caches a decision for ttl, dropping expired entries when the cache is full
+func (e *ExtAuthz) store(key string, decision *extAuthzDecision, ttl time.Duration) {
+	if key == "" || ttl <= 0 {
+		return
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	now := time.Now()
+	if len(e.cache) >= maxExtAuthzCacheEntries {
+		for k, d := range e.cache {
+			if now.After(d.expiration) {
+				delete(e.cache, k)
+			}
+		}
+		if len(e.cache) >= maxExtAuthzCacheEntries {
+			return
+		}
+	}
+
+	decision.expiration = now.Add(ttl)
+	e.cache[key] = decision
+}
+
+// extAuthzCacheKey identifies equivalent authorization checks
+func extAuthzCacheKey(url string, checkReq *ExtAuthzRequest) string {
+	names := make([]string, 0, len(checkReq.Headers))
+	for name := range checkReq.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hasher := sha256.New()
+	fmt.Fprintf(hasher, "%s\n%s\n%s\n%s\n%s\n%s\n", url, checkReq.Method, checkReq.Host, checkReq.Path, checkReq.Query, checkReq.ClientIP)
+	for _, name := range names {
+		fmt.Fprintf(hasher, "%s=%s\n", name, checkReq.Headers[name])
+	}
+	if checkReq.Identity != nil {
+		fmt.Fprintf(hasher, "identity=%s/%s/%s\n", checkReq.Identity.Type, checkReq.Identity.Subject, checkReq.Identity.Role)
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
@@ -0,0 +1,238 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/config"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestExtAuthz(t *testing.T) {
+	var calls int32
+	var lastCheck ExtAuthzRequest
+	authzServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&lastCheck))
+
+		switch lastCheck.Headers["authorization"] {
+		case "Bearer allowed":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(ExtAuthzResponse{Headers: map[string]string{"X-User-Id": "42"}})
+		case "Bearer broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "Bearer redirected":
+			http.Redirect(w, r, "/login", http.StatusFound)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error":"denied"}`))
+		}
+	}))
+	defer authzServer.Close()
+
+	var upstreamUserID string
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamUserID = r.Header.Get("X-User-Id")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	send := func(handler http.Handler, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/orders/7?expand=items", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.RemoteAddr = "10.1.2.3:5555"
+		req = req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{Type: auth.IdentityJWT, Subject: "alice"}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("allow injects headers", func(t *testing.T) {
+		extAuthz := NewExtAuthz(&mockLogger{})
+		handler := extAuthz.Authorize(upstream, &config.ExtAuthzConfig{Enabled: true, URL: authzServer.URL, TimeoutMs: 1000})
+
+		rec := send(handler, "allowed")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "42", upstreamUserID)
+
+		assert.Equal(t, http.MethodGet, lastCheck.Method)
+		assert.Equal(t, "/orders/7", lastCheck.Path)
+		assert.Equal(t, "expand=items", lastCheck.Query)
+		assert.Equal(t, "10.1.2.3", lastCheck.ClientIP)
+		require.NotNil(t, lastCheck.Identity)
+		assert.Equal(t, "alice", lastCheck.Identity.Subject)
+	})
+
+	t.Run("deny is relayed to the client", func(t *testing.T) {
+		extAuthz := NewExtAuthz(&mockLogger{})
+		handler := extAuthz.Authorize(upstream, &config.ExtAuthzConfig{Enabled: true, URL: authzServer.URL, TimeoutMs: 1000})
+
+		rec := send(handler, "other")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"error":"denied"}`, rec.Body.String())
+	})
+
+	t.Run("failure policy", func(t *testing.T) {
+		extAuthz := NewExtAuthz(&mockLogger{})
+
+		closed := extAuthz.Authorize(upstream, &config.ExtAuthzConfig{Enabled: true, URL: authzServer.URL, TimeoutMs: 1000})
+		assert.Equal(t, http.StatusServiceUnavailable, send(closed, "broken").Code)
+
+		open := extAuthz.Authorize(upstream, &config.ExtAuthzConfig{Enabled: true, URL: authzServer.URL, TimeoutMs: 1000, FailOpen: true})
+		assert.Equal(t, http.StatusOK, send(open, "broken").Code)
+
+		// Only failures of the service fail open, other answers deny
+		assert.Equal(t, http.StatusForbidden, send(open, "redirected").Code)
+
+		unreachable := extAuthz.Authorize(upstream, &config.ExtAuthzConfig{Enabled: true, URL: "http://127.0.0.1:1", TimeoutMs: 200})
+		assert.Equal(t, http.StatusServiceUnavailable, send(unreachable, "allowed").Code)
+	})
+
+	t.Run("decisions are cached", func(t *testing.T) {
+		extAuthz := NewExtAuthz(&mockLogger{})
+		handler := extAuthz.Authorize(upstream, &config.ExtAuthzConfig{
+			Enabled:   true,
+			URL:       authzServer.URL,
+			TimeoutMs: 1000,
+			Headers:   []string{"Authorization"},
+			CacheTTL:  60,
+		})
+
+		atomic.StoreInt32(&calls, 0)
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusOK, send(handler, "allowed").Code)
+			assert.Equal(t, http.StatusForbidden, send(handler, "other").Code)
+		}
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+		assert.Equal(t, map[string]string{"authorization": "Bearer other"}, lastCheck.Headers)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		extAuthz := NewExtAuthz(&mockLogger{})
+		handler := extAuthz.Authorize(upstream, &config.ExtAuthzConfig{Enabled: false, URL: authzServer.URL})
+		assert.Equal(t, http.StatusOK, send(handler, "other").Code)
+	})
+}
+
+// fakeAuthorizationServer answers gRPC checks by the authorization header
+type fakeAuthorizationServer struct {
+	authv3.UnimplementedAuthorizationServer
+	mutex sync.Mutex
+	last  *authv3.CheckRequest
+}
+
+func (s *fakeAuthorizationServer) Check(ctx context.Context, req *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	s.mutex.Lock()
+	s.last = req
+	s.mutex.Unlock()
+
+	switch req.GetAttributes().GetRequest().GetHttp().GetHeaders()["authorization"] {
+	case "Bearer allowed":
+		return &authv3.CheckResponse{
+			Status: &rpcstatus.Status{Code: int32(codes.OK)},
+			HttpResponse: &authv3.CheckResponse_OkResponse{OkResponse: &authv3.OkHttpResponse{
+				Headers:         []*corev3.HeaderValueOption{{Header: &corev3.HeaderValue{Key: "X-User-Id", Value: "42"}}},
+				HeadersToRemove: []string{"X-Internal"},
+			}},
+		}, nil
+	case "Bearer broken":
+		return nil, status.Error(codes.Unavailable, "policy store down")
+	case "Bearer unauthenticated":
+		return &authv3.CheckResponse{
+			Status: &rpcstatus.Status{Code: int32(codes.Unauthenticated)},
+			HttpResponse: &authv3.CheckResponse_DeniedResponse{DeniedResponse: &authv3.DeniedHttpResponse{
+				Status:  &typev3.HttpStatus{Code: typev3.StatusCode_Unauthorized},
+				Headers: []*corev3.HeaderValueOption{{Header: &corev3.HeaderValue{Key: "WWW-Authenticate", Value: "Bearer"}}},
+				Body:    "sign in",
+			}},
+		}, nil
+	default:
+		return &authv3.CheckResponse{Status: &rpcstatus.Status{Code: int32(codes.PermissionDenied)}}, nil
+	}
+}
+
+func (s *fakeAuthorizationServer) lastCheck() *authv3.CheckRequest {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.last
+}
+
+func TestExtAuthzGRPC(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	authzServer := &fakeAuthorizationServer{}
+	server := grpc.NewServer()
+	authv3.RegisterAuthorizationServer(server, authzServer)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	var upstreamUserID, upstreamInternal string
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamUserID = r.Header.Get("X-User-Id")
+		upstreamInternal = r.Header.Get("X-Internal")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	extAuthz := NewExtAuthz(&mockLogger{})
+	defer extAuthz.Close()
+	cfg := &config.ExtAuthzConfig{Enabled: true, Mode: config.ExtAuthzModeGRPC, URL: "grpc://" + listener.Addr().String(), TimeoutMs: 1000}
+	handler := extAuthz.Authorize(upstream, cfg)
+
+	send := func(handler http.Handler, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/orders/7?expand=items", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("X-Internal", "yes")
+		req.RemoteAddr = "10.1.2.3:5555"
+		req = req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{Type: auth.IdentityJWT, Subject: "alice"}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("allow injects and removes headers", func(t *testing.T) {
+		rec := send(handler, "allowed")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "42", upstreamUserID)
+		assert.Empty(t, upstreamInternal)
+
+		attributes := authzServer.lastCheck().GetAttributes()
+		assert.Equal(t, http.MethodGet, attributes.GetRequest().GetHttp().GetMethod())
+		assert.Equal(t, "/orders/7?expand=items", attributes.GetRequest().GetHttp().GetPath())
+		assert.Equal(t, "10.1.2.3", attributes.GetSource().GetAddress().GetSocketAddress().GetAddress())
+		assert.Equal(t, "alice", attributes.GetContextExtensions()["identity_subject"])
+	})
+
+	t.Run("denied response is relayed to the client", func(t *testing.T) {
+		rec := send(handler, "unauthenticated")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+		assert.Equal(t, "sign in", rec.Body.String())
+
+		assert.Equal(t, http.StatusForbidden, send(handler, "other").Code)
+	})
+
+	t.Run("failure policy", func(t *testing.T) {
+		assert.Equal(t, http.StatusServiceUnavailable, send(handler, "broken").Code)
+
+		failOpen := *cfg
+		failOpen.FailOpen = true
+		assert.Equal(t, http.StatusOK, send(extAuthz.Authorize(upstream, &failOpen), "broken").Code)
+	})
+}
@@ -0,0 +1,227 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/config"
+	"api-gateway/internal/util"
+	"api-gateway/pkg/logger"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FeatureFlags evaluates feature flags for each request, keyed on the user
+// and tenant of the caller's JWT, and injects the results as request headers
+type FeatureFlags struct {
+	config *config.FeatureFlagsConfig
+	log    logger.Logger
+
+	mu      sync.RWMutex
+	flags   map[string]config.FeatureFlag
+	modTime time.Time
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// featureFlagsFile is the layout of a flags file
+type featureFlagsFile struct {
+	Flags map[string]config.FeatureFlag `yaml:"flags"`
+}
+
+type featureFlagsKey struct{}
+
+// NewFeatureFlags creates a feature flag evaluator, loading the flags file if
+// one is configured. Inline flags are used if the file can't be loaded.
+func NewFeatureFlags(cfg *config.FeatureFlagsConfig, log logger.Logger) *FeatureFlags {
+	f := &FeatureFlags{
+		config: cfg,
+		log:    log,
+		flags:  cfg.Flags,
+		stop:   make(chan struct{}),
+	}
+	if cfg.File != "" {
+		if _, err := f.reload(); err != nil {
+			log.Error("Failed to load feature flags file, using inline flags",
+				logger.String("file", cfg.File),
+				logger.Error(err),
+			)
+		}
+	}
+	return f
+}
+
+// Start watches the flags file for changes
+func (f *FeatureFlags) Start() {
+	if f.config.File == "" || f.config.ReloadInterval <= 0 {
+		return
+	}
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		ticker := time.NewTicker(time.Duration(f.config.ReloadInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-f.stop:
+				return
+			case <-ticker.C:
+				reloaded, err := f.reload()
+				if err != nil {
+					f.log.Warn("Failed to reload feature flags file, keeping current flags",
+						logger.String("file", f.config.File),
+						logger.Error(err),
+					)
+				} else if reloaded {
+					f.log.Info("Reloaded feature flags", logger.String("file", f.config.File))
+				}
+			}
+		}
+	}()
+}
+
+// Stop ends the file watch
+func (f *FeatureFlags) Stop() {
+	close(f.stop)
+	f.wg.Wait()
+}
+
+// reload reads the flags file if it changed since the last load and reports
+// whether the flags were replaced
+func (f *FeatureFlags) reload() (bool, error) {
+	info, err := os.Stat(f.config.File)
+	if err != nil {
+		return false, err
+	}
+	f.mu.RLock()
+	unchanged := info.ModTime().Equal(f.modTime)
+	f.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(f.config.File)
+	if err != nil {
+		return false, err
+	}
+	var file featureFlagsFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return false, fmt.Errorf("failed to parse feature flags file: %w", err)
+	}
+	for name, flag := range file.Flags {
+		if err := flag.Validate(name); err != nil {
+			return false, err
+		}
+	}
+
+	f.mu.Lock()
+	f.flags = file.Flags
+	f.modTime = info.ModTime()
+	f.mu.Unlock()
+	return true, nil
+}
+
+// Evaluate returns the value of each named flag, or of every flag if names is
+// empty, for the caller of the request
+func (f *FeatureFlags) Evaluate(r *http.Request, names []string) map[string]bool {
+	user, tenant := "", ""
+	if identity := auth.IdentityFromContext(r.Context()); identity != nil {
+		user = formatClaim(identity.Claim(f.config.UserClaim))
+		if user == "" {
+			user = identity.Subject
+		}
+		tenant = formatClaim(identity.Claim(f.config.TenantClaim))
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if len(names) == 0 {
+		names = make([]string, 0, len(f.flags))
+		for name := range f.flags {
+			names = append(names, name)
+		}
+	}
+
+	results := make(map[string]bool, len(names))
+	for _, name := range names {
+		flag, ok := f.flags[name]
+		results[name] = ok && evaluateFlag(name, flag, user, tenant, r)
+	}
+	return results
+}
+
+// Inject evaluates the route's flags and sends the results upstream as
+// headers. Flag headers sent by the client are dropped.
+func (f *FeatureFlags) Inject(next http.Handler, cfg *config.RouteFeatureFlags) http.Handler {
+	if cfg == nil || !cfg.Enabled {
+		return next
+	}
+	prefix := strings.ToLower(f.config.HeaderPrefix)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name := range r.Header {
+			if strings.HasPrefix(strings.ToLower(name), prefix) {
+				delete(r.Header, name)
+			}
+		}
+
+		results := f.Evaluate(r, cfg.Flags)
+		names := make([]string, 0, len(results))
+		for name := range results {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			r.Header.Set(f.config.HeaderPrefix+name, strconv.FormatBool(results[name]))
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), featureFlagsKey{}, results)))
+	})
+}
+
+// FeatureFlagsFromContext returns the flags evaluated for a request, or nil
+func FeatureFlagsFromContext(ctx context.Context) map[string]bool {
+	flags, _ := ctx.Value(featureFlagsKey{}).(map[string]bool)
+	return flags
+}
+
+// evaluateFlag decides a flag for a caller. Listed users and tenants always
+// get the flag; others are bucketed by user, then tenant, then client IP so
+// the same caller keeps the same result.
+func evaluateFlag(name string, flag config.FeatureFlag, user, tenant string, r *http.Request) bool {
+	if !flag.Enabled {
+		return false
+	}
+	if (user != "" && contains(flag.Users, user)) || (tenant != "" && contains(flag.Tenants, tenant)) {
+		return true
+	}
+	if flag.Percentage >= 100 {
+		return true
+	}
+	if flag.Percentage <= 0 {
+		return false
+	}
+
+	key := user
+	if key == "" {
+		key = tenant
+	}
+	if key == "" {
+		key = util.GetClientIP(r)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name + ":" + key))
+	return float64(h.Sum32()%10000) < flag.Percentage*100
+}
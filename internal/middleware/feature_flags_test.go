@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeatureFlags(t *testing.T) {
+	newFlags := func(flags map[string]config.FeatureFlag) *FeatureFlags {
+		return NewFeatureFlags(&config.FeatureFlagsConfig{
+			Enabled:      true,
+			HeaderPrefix: "X-Feature-",
+			UserClaim:    "sub",
+			TenantClaim:  "tenant",
+			Flags:        flags,
+		}, &mockLogger{})
+	}
+	request := func(sub, tenant string) *http.Request {
+		req := httptest.NewRequest("GET", "http://example.com/api", nil)
+		identity := &auth.Identity{Type: auth.IdentityJWT, Subject: sub, Claims: map[string]interface{}{"sub": sub, "tenant": tenant}}
+		return req.WithContext(auth.WithIdentity(req.Context(), identity))
+	}
+
+	t.Run("users and tenants are targeted", func(t *testing.T) {
+		flags := newFlags(map[string]config.FeatureFlag{
+			"NewCheckout": {Enabled: true, Users: []string{"alice"}, Tenants: []string{"beta"}},
+			"Disabled":    {Enabled: false, Percentage: 100},
+		})
+
+		assert.Equal(t, map[string]bool{"NewCheckout": true, "Disabled": false}, flags.Evaluate(request("alice", "acme"), nil))
+		assert.True(t, flags.Evaluate(request("bob", "beta"), nil)["NewCheckout"])
+		assert.False(t, flags.Evaluate(request("bob", "acme"), nil)["NewCheckout"])
+		assert.Equal(t, map[string]bool{"Missing": false}, flags.Evaluate(request("bob", "acme"), []string{"Missing"}))
+	})
+
+	t.Run("percentage rollout is stable per user", func(t *testing.T) {
+		flags := newFlags(map[string]config.FeatureFlag{"Rollout": {Enabled: true, Percentage: 50}})
+
+		on := 0
+		for i := 0; i < 1000; i++ {
+			user := "user-" + strconv.Itoa(i)
+			first := flags.Evaluate(request(user, ""), nil)["Rollout"]
+			assert.Equal(t, first, flags.Evaluate(request(user, ""), nil)["Rollout"])
+			if first {
+				on++
+			}
+		}
+		assert.InDelta(t, 500, on, 100)
+	})
+
+	t.Run("results are injected as headers", func(t *testing.T) {
+		flags := newFlags(map[string]config.FeatureFlag{
+			"NewCheckout": {Enabled: true, Users: []string{"alice"}},
+			"DarkMode":    {Enabled: true},
+		})
+
+		var seen http.Header
+		var fromContext map[string]bool
+		handler := flags.Inject(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = r.Header.Clone()
+			fromContext = FeatureFlagsFromContext(r.Context())
+		}), &config.RouteFeatureFlags{Enabled: true, Flags: []string{"NewCheckout"}})
+
+		req := request("alice", "")
+		req.Header.Set("X-Feature-DarkMode", "true")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		assert.Equal(t, "true", seen.Get("X-Feature-NewCheckout"))
+		assert.Empty(t, seen.Get("X-Feature-DarkMode"), "client supplied flag headers are dropped")
+		assert.Equal(t, map[string]bool{"NewCheckout": true}, fromContext)
+	})
+
+	t.Run("flags file replaces inline flags", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "flags.yaml")
+		require.NoError(t, os.WriteFile(path, []byte("flags:\n  FromFile:\n    enabled: true\n    percentage: 100\n"), 0o644))
+
+		flags := NewFeatureFlags(&config.FeatureFlagsConfig{
+			Enabled: true,
+			File:    path,
+			Flags:   map[string]config.FeatureFlag{"Inline": {Enabled: true, Percentage: 100}},
+		}, &mockLogger{})
+
+		assert.Equal(t, map[string]bool{"FromFile": true}, flags.Evaluate(request("alice", ""), nil))
+	})
+}
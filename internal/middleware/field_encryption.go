@@ -0,0 +1,345 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// fieldCiphertextPrefix starts encrypted field values, which are
+// enc:v1:<key name>:<base64url of nonce and sealed JSON value>
+const fieldCiphertextPrefix = "enc:v1:"
+
+// Directions of field encryption failures in the metric
+const (
+	fieldEncryptionRequest  = "request"
+	fieldEncryptionResponse = "response"
+)
+
+// FieldEncryptor encrypts configured JSON fields of responses, so values such
+// as PII leave the internal network only as ciphertext, and decrypts fields
+// of requests carrying such ciphertext back for the upstream. Fields are
+// sealed with AES-256-GCM under the route's named key.
+type FieldEncryptor struct {
+	keys map[string]cipher.AEAD
+	log  logger.Logger
+}
+
+// NewFieldEncryptor creates the field encryption middleware with the
+// configured keys. Keys that aren't valid are logged and left out, so routes
+// using them refuse their requests.
+func NewFieldEncryptor(cfg *config.FieldEncryptionConfig, log logger.Logger) *FieldEncryptor {
+	keys := make(map[string]cipher.AEAD, len(cfg.Keys))
+	for name, key := range cfg.Keys {
+		aead, err := newFieldCipher(key)
+		if err != nil {
+			log.Error("Invalid field encryption key",
+				logger.String("key", name),
+				logger.Error(err),
+			)
+			continue
+		}
+		keys[name] = aead
+	}
+	return &FieldEncryptor{
+		keys: keys,
+		log:  log,
+	}
+}
+
+// newFieldCipher creates the AES-256-GCM cipher of a base64 encoded key
+func newFieldCipher(key string) (cipher.AEAD, error) {
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode key: %w", err)
+	}
+	if len(decoded) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(decoded))
+	}
+	block, err := aes.NewCipher(decoded)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Protect decrypts the route's request fields and encrypts its response
+// fields. It fails closed: requests with ciphertext that doesn't decrypt are
+// rejected, and responses that can't be encrypted are replaced by a 502
+// rather than sent in the clear.
+func (e *FieldEncryptor) Protect(next http.Handler, route config.Route) http.Handler {
+	cfg := route.Middlewares.FieldEncryption
+	if cfg == nil || !cfg.Enabled {
+		return next
+	}
+
+	key, ok := e.keys[cfg.Key]
+	if !ok {
+		e.log.Error("Unknown field encryption key, refusing the route's requests",
+			logger.String("path", route.Path),
+			logger.String("key", cfg.Key),
+		)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		})
+	}
+	accepted := map[string]cipher.AEAD{cfg.Key: key}
+	for _, name := range cfg.PreviousKeys {
+		if previous, ok := e.keys[name]; ok {
+			accepted[name] = previous
+		}
+	}
+	encrypt := splitFieldPaths(cfg.EncryptResponse)
+	decrypt := splitFieldPaths(cfg.DecryptRequest)
+	maxSize := int64(cfg.MaxBodySize)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(decrypt) > 0 && hasBody(r) {
+			if status, err := decryptRequest(r, decrypt, accepted, maxSize); err != nil {
+				e.log.Warn("Rejected request with undecryptable fields",
+					logger.String("path", r.URL.Path),
+					logger.String("route", route.Path),
+					logger.Error(err),
+				)
+				fieldEncryptionFailures.WithLabelValues(route.Path, fieldEncryptionRequest).Inc()
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+		}
+
+		if len(encrypt) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Ask for an identity encoded response so its fields can be read
+		r.Header.Del("Accept-Encoding")
+
+		response := newBufferedResponse()
+		defer response.release()
+		next.ServeHTTP(response, r)
+
+		if err := encryptResponse(response, encrypt, cfg.Key, key, maxSize); err != nil {
+			e.log.Error("Failed to encrypt response fields, withholding the response",
+				logger.String("path", r.URL.Path),
+				logger.String("route", route.Path),
+				logger.Int("status", response.statusCode),
+				logger.Error(err),
+			)
+			fieldEncryptionFailures.WithLabelValues(route.Path, fieldEncryptionResponse).Inc()
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			return
+		}
+		response.copyTo(w)
+	})
+}
+
+// decryptRequest replaces the ciphertext at paths in a JSON request body
+// with its plaintext. On failure it returns the status to answer with.
+func decryptRequest(r *http.Request, paths [][]string, keys map[string]cipher.AEAD, maxSize int64) (int, error) {
+	if !isJSON(r.Header.Get("Content-Type")) {
+		return 0, nil
+	}
+	if encoding := r.Header.Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		return http.StatusUnsupportedMediaType, fmt.Errorf("request body is %s encoded", encoding)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxSize+1))
+	r.Body.Close()
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if int64(len(data)) > maxSize {
+		return http.StatusRequestEntityTooLarge, fmt.Errorf("request body larger than %d bytes", maxSize)
+	}
+
+	out, err := transformJSON(data, paths, func(value any) (any, error) {
+		return decryptField(value, keys)
+	})
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(out))
+	r.ContentLength = int64(len(out))
+	r.Header.Set("Content-Length", strconv.Itoa(len(out)))
+	return 0, nil
+}
+
+// encryptResponse replaces the values at paths in a buffered JSON response
+// with their ciphertext. Bodies that aren't JSON pass unchanged.
+func encryptResponse(response *bufferedResponse, paths [][]string, name string, key cipher.AEAD, maxSize int64) error {
+	header := response.Header()
+	if response.body.Len() == 0 || !isJSON(header.Get("Content-Type")) {
+		return nil
+	}
+	if encoding := header.Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		return fmt.Errorf("response body is %s encoded", encoding)
+	}
+	if int64(response.body.Len()) > maxSize {
+		return fmt.Errorf("response body larger than %d bytes", maxSize)
+	}
+
+	out, err := transformJSON(response.body.Bytes(), paths, func(value any) (any, error) {
+		return encryptField(value, name, key)
+	})
+	if err != nil {
+		return err
+	}
+
+	response.body.Reset()
+	response.body.Write(out)
+	header.Set("Content-Length", strconv.Itoa(len(out)))
+	header.Del("ETag")
+	return nil
+}
+
+// transformJSON applies fn to the values at paths in a JSON document
+func transformJSON(data []byte, paths [][]string, fn func(any) (any, error)) ([]byte, error) {
+	document, err := decodeJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		if document, err = transformField(document, path, fn); err != nil {
+			return nil, err
+		}
+	}
+	return encodeJSON(document)
+}
+
+// decodeJSON decodes a JSON body, keeping numbers as written
+func decodeJSON(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return document, nil
+}
+
+// encodeJSON encodes a document decoded by decodeJSON without escaping HTML
+func encodeJSON(document any) ([]byte, error) {
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(document); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(out.Bytes(), []byte("\n")), nil
+}
+
+// transformField applies fn to the values at path below value. Paths that
+// don't exist in the document are skipped.
+func transformField(value any, path []string, fn func(any) (any, error)) (any, error) {
+	if len(path) == 0 {
+		return fn(value)
+	}
+
+	var err error
+	switch value := value.(type) {
+	case map[string]any:
+		if path[0] == "*" {
+			for name, child := range value {
+				if value[name], err = transformField(child, path[1:], fn); err != nil {
+					return nil, err
+				}
+			}
+		} else if child, ok := value[path[0]]; ok {
+			if value[path[0]], err = transformField(child, path[1:], fn); err != nil {
+				return nil, err
+			}
+		}
+	case []any:
+		if path[0] == "*" {
+			for i, child := range value {
+				if value[i], err = transformField(child, path[1:], fn); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return value, nil
+}
+
+// encryptField seals the JSON encoding of a value. Nulls stay null.
+func encryptField(value any, name string, key cipher.AEAD) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, key.NonceSize(), key.NonceSize()+len(plaintext)+key.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := key.Seal(nonce, nonce, plaintext, []byte(name))
+	return fieldCiphertextPrefix + name + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// decryptField opens a value sealed by encryptField with one of keys.
+// Values that aren't ciphertext are left as they are.
+func decryptField(value any, keys map[string]cipher.AEAD) (any, error) {
+	text, ok := value.(string)
+	if !ok || !strings.HasPrefix(text, fieldCiphertextPrefix) {
+		return value, nil
+	}
+
+	name, encoded, ok := strings.Cut(strings.TrimPrefix(text, fieldCiphertextPrefix), ":")
+	if !ok {
+		return nil, errors.New("malformed encrypted field")
+	}
+	key, ok := keys[name]
+	if !ok {
+		return nil, fmt.Errorf("field encrypted with unaccepted key %s", name)
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < key.NonceSize() {
+		return nil, errors.New("malformed encrypted field")
+	}
+	plaintext, err := key.Open(nil, sealed[:key.NonceSize()], sealed[key.NonceSize():], []byte(name))
+	if err != nil {
+		return nil, errors.New("encrypted field failed authentication")
+	}
+
+	decrypted, err := decodeJSON(plaintext)
+	if err != nil {
+		return nil, errors.New("malformed encrypted field")
+	}
+	return decrypted, nil
+}
+
+// splitFieldPaths splits dot separated field paths
+func splitFieldPaths(fields []string) [][]string {
+	paths := make([][]string, 0, len(fields))
+	for _, field := range fields {
+		paths = append(paths, strings.Split(field, "."))
+	}
+	return paths
+}
+
+// isJSON reports whether a Content-Type is JSON
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
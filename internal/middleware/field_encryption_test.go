@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFieldEncryptor creates the middleware with two keys, current and old
+func newFieldEncryptor() *FieldEncryptor {
+	return NewFieldEncryptor(&config.FieldEncryptionConfig{Keys: map[string]string{
+		"current": base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)),
+		"old":     base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32)),
+	}}, &mockLogger{})
+}
+
+// encryptedRoute returns a route encrypting and decrypting fields
+func encryptedRoute(encrypt, decrypt []string) config.Route {
+	return config.Route{
+		Path: "/customers",
+		Middlewares: &config.Middlewares{FieldEncryption: &config.FieldEncryption{
+			Enabled:         true,
+			Key:             "current",
+			PreviousKeys:    []string{"old"},
+			EncryptResponse: encrypt,
+			DecryptRequest:  decrypt,
+			MaxBodySize:     1024,
+		}},
+	}
+}
+
+func TestFieldEncryptorEncryptsResponseFields(t *testing.T) {
+	e := newFieldEncryptor()
+	route := encryptedRoute([]string{"email", "addresses.*.street", "missing.field"}, nil)
+
+	var acceptEncoding string
+	handler := e.Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`{"id": 12345678901234567890, "email": "ada@example.com", "addresses": [{"street": "1 Main St", "city": "Springfield"}, {"street": null}]}`))
+	}), route)
+
+	req := httptest.NewRequest(http.MethodGet, "/customers/1", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, acceptEncoding)
+	assert.Empty(t, rec.Header().Get("ETag"))
+	assert.Equal(t, strconv.Itoa(rec.Body.Len()), rec.Header().Get("Content-Length"))
+
+	var body map[string]any
+	decoder := json.NewDecoder(rec.Body)
+	decoder.UseNumber()
+	require.NoError(t, decoder.Decode(&body))
+	assert.Equal(t, json.Number("12345678901234567890"), body["id"])
+	email := body["email"].(string)
+	assert.True(t, strings.HasPrefix(email, "enc:v1:current:"))
+	addresses := body["addresses"].([]any)
+	street := addresses[0].(map[string]any)["street"].(string)
+	assert.True(t, strings.HasPrefix(street, "enc:v1:current:"))
+	assert.Equal(t, "Springfield", addresses[0].(map[string]any)["city"])
+	assert.Nil(t, addresses[1].(map[string]any)["street"])
+
+	// The ciphertext decrypts to the original value
+	plaintext, err := decryptField(email, e.keys)
+	require.NoError(t, err)
+	assert.Equal(t, "ada@example.com", plaintext)
+}
+
+func TestFieldEncryptorDecryptsRequestFields(t *testing.T) {
+	e := newFieldEncryptor()
+	route := encryptedRoute(nil, []string{"card", "*.ssn"})
+
+	var received string
+	handler := e.Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		received = string(data)
+		assert.Equal(t, int64(len(data)), r.ContentLength)
+	}), route)
+
+	card, err := encryptField(map[string]any{"number": "4111"}, "old", e.keys["old"])
+	require.NoError(t, err)
+	ssn, err := encryptField("123-45-6789", "current", e.keys["current"])
+	require.NoError(t, err)
+
+	body := `{"card": "` + card.(string) + `", "holder": {"ssn": "` + ssn.(string) + `"}, "note": "<b>plain</b>"}`
+	req := httptest.NewRequest(http.MethodPost, "/customers", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"card": {"number": "4111"}, "holder": {"ssn": "123-45-6789"}, "note": "<b>plain</b>"}`, received)
+	assert.Contains(t, received, "<b>plain</b>")
+}
+
+func TestFieldEncryptorFailsClosed(t *testing.T) {
+	e := newFieldEncryptor()
+	other := NewFieldEncryptor(&config.FieldEncryptionConfig{Keys: map[string]string{
+		"current": base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{3}, 32)),
+		"unknown": base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{4}, 32)),
+	}}, &mockLogger{})
+	forged, _ := encryptField("x", "current", other.keys["current"])
+	unaccepted, _ := encryptField("x", "unknown", other.keys["unknown"])
+
+	reached := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { reached = true })
+	handler := e.Protect(next, encryptedRoute(nil, []string{"card"}))
+
+	for name, tt := range map[string]struct {
+		body   string
+		status int
+	}{
+		"forged ciphertext": {`{"card": "` + forged.(string) + `"}`, http.StatusBadRequest},
+		"unaccepted key":    {`{"card": "` + unaccepted.(string) + `"}`, http.StatusBadRequest},
+		"malformed":         {`{"card": "enc:v1:current"}`, http.StatusBadRequest},
+		"invalid JSON":      {`{"card":`, http.StatusBadRequest},
+		"too large":         {`{"card": "` + strings.Repeat("a", 2048) + `"}`, http.StatusRequestEntityTooLarge},
+	} {
+		reached = false
+		req := httptest.NewRequest(http.MethodPost, "/customers", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, tt.status, rec.Code, name)
+		assert.False(t, reached, name)
+	}
+
+	// Responses that can't be encrypted are withheld
+	for name, upstream := range map[string]http.HandlerFunc{
+		"invalid JSON": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"email": "ada@example.com"`))
+		},
+		"compressed": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write([]byte("\x1f\x8b"))
+		},
+	} {
+		rec := httptest.NewRecorder()
+		e.Protect(upstream, encryptedRoute([]string{"email"}, nil)).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/customers/1", nil))
+		assert.Equal(t, http.StatusBadGateway, rec.Code, name)
+		assert.NotContains(t, rec.Body.String(), "ada@example.com", name)
+	}
+
+	// Routes referencing a missing key refuse requests
+	route := encryptedRoute([]string{"email"}, nil)
+	route.Middlewares.FieldEncryption.Key = "missing"
+	rec := httptest.NewRecorder()
+	e.Protect(next, route).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/customers/1", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	// and so do routes referencing a key that isn't valid
+	invalid := NewFieldEncryptor(&config.FieldEncryptionConfig{Keys: map[string]string{
+		"current": base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 16)),
+	}}, &mockLogger{})
+	assert.NotContains(t, invalid.keys, "current")
+	rec = httptest.NewRecorder()
+	invalid.Protect(next, encryptedRoute([]string{"email"}, nil)).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/customers/1", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestFieldEncryptorPassesOtherBodies(t *testing.T) {
+	e := newFieldEncryptor()
+	handler := e.Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("upstream unavailable"))
+	}), encryptedRoute([]string{"email"}, []string{"card"}))
+
+	req := httptest.NewRequest(http.MethodPost, "/customers", strings.NewReader("card=4111"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "upstream unavailable", rec.Body.String())
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"strings"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/config"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// GRPCRequestMetadata returns a copy of the metadata of a call on a gRPC
+// route with the route's request rules applied and the configured claims
+// of the caller set. Claim keys sent by the client are always dropped, so
+// a call without an identity can't pass its own.
+func GRPCRequestMetadata(md metadata.MD, cfg *config.GRPCMetadata, identity *auth.Identity) metadata.MD {
+	md = md.Copy()
+	if md == nil {
+		md = metadata.MD{}
+	}
+	if cfg == nil {
+		return md
+	}
+	applyMetadataRules(md, cfg.Request)
+	for key, source := range cfg.Claims {
+		key = strings.ToLower(key)
+		delete(md, key)
+		if value := identityValue(identity, source); value != "" {
+			md.Set(key, value)
+		}
+	}
+	return md
+}
+
+// GRPCResponseMetadata applies the route's response rules to the header and
+// trailer metadata returned by the upstream. Added keys go to the trailers.
+func GRPCResponseMetadata(header, trailer metadata.MD, cfg *config.GRPCMetadata) (metadata.MD, metadata.MD) {
+	header, trailer = header.Copy(), trailer.Copy()
+	if trailer == nil {
+		trailer = metadata.MD{}
+	}
+	if cfg == nil {
+		return header, trailer
+	}
+	rules := cfg.Response
+	applyMetadataRules(header, config.GRPCMetadataRules{Remove: rules.Remove, Rename: rules.Rename})
+	applyMetadataRules(trailer, rules)
+	return header, trailer
+}
+
+// applyMetadataRules removes, renames and adds keys of md in place
+func applyMetadataRules(md metadata.MD, rules config.GRPCMetadataRules) {
+	if md == nil {
+		return
+	}
+	for _, key := range rules.Remove {
+		delete(md, strings.ToLower(key))
+	}
+	for from, to := range rules.Rename {
+		from, to = strings.ToLower(from), strings.ToLower(to)
+		if values, ok := md[from]; ok {
+			delete(md, from)
+			md[to] = values
+		}
+	}
+	for key, value := range rules.Add {
+		md.Set(key, value)
+	}
+}
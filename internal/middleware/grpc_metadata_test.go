@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"testing"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestGRPCRequestMetadata(t *testing.T) {
+	cfg := &config.GRPCMetadata{
+		Request: config.GRPCMetadataRules{
+			Add:    map[string]string{"X-Gateway": "edge"},
+			Remove: []string{"x-debug"},
+			Rename: map[string]string{"x-client-id": "x-consumer-id"},
+		},
+		Claims: map[string]string{
+			"x-user-id": "identity.subject",
+			"x-scopes":  "identity.scopes",
+			"x-org":     "jwt.org.id",
+		},
+	}
+	identity := &auth.Identity{
+		Subject: "user-1",
+		Scopes:  []string{"read", "write"},
+		Claims:  map[string]interface{}{"org": map[string]interface{}{"id": "acme"}},
+	}
+	sent := metadata.Pairs("x-debug", "1", "x-client-id", "web", "x-gateway", "spoofed", "x-user-id", "admin", "x-trace", "abc")
+
+	md := GRPCRequestMetadata(sent, cfg, identity)
+	assert.Equal(t, metadata.MD{
+		"x-consumer-id": {"web"},
+		"x-gateway":     {"edge"},
+		"x-trace":       {"abc"},
+		"x-user-id":     {"user-1"},
+		"x-scopes":      {"read write"},
+		"x-org":         {"acme"},
+	}, md)
+	assert.Equal(t, []string{"admin"}, sent.Get("x-user-id"), "the call's metadata is left unchanged")
+
+	// Without an identity the client's claim keys are still dropped
+	md = GRPCRequestMetadata(sent, cfg, nil)
+	assert.Empty(t, md.Get("x-user-id"))
+	assert.Empty(t, md.Get("x-org"))
+
+	assert.Equal(t, metadata.MD{"x-trace": {"abc"}}, GRPCRequestMetadata(metadata.Pairs("x-trace", "abc"), nil, identity))
+}
+
+func TestGRPCResponseMetadata(t *testing.T) {
+	cfg := &config.GRPCMetadata{Response: config.GRPCMetadataRules{
+		Add:    map[string]string{"x-served-by": "gateway"},
+		Remove: []string{"x-internal-host"},
+		Rename: map[string]string{"x-backend-version": "x-version"},
+	}}
+	header := metadata.Pairs("x-internal-host", "10.0.0.4", "x-backend-version", "2")
+	trailer := metadata.Pairs("x-internal-host", "10.0.0.4", "x-cost", "3")
+
+	header, trailer = GRPCResponseMetadata(header, trailer, cfg)
+	assert.Equal(t, metadata.MD{"x-version": {"2"}}, header)
+	assert.Equal(t, metadata.MD{"x-cost": {"3"}, "x-served-by": {"gateway"}}, trailer)
+
+	header, trailer = GRPCResponseMetadata(nil, nil, cfg)
+	assert.Empty(t, header)
+	assert.Equal(t, metadata.MD{"x-served-by": {"gateway"}}, trailer)
+}
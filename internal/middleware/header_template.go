@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/config"
+	"api-gateway/internal/util"
+)
+
+// headerTemplate is a header value with {variable} placeholders
+type headerTemplate struct {
+	parts []templatePart
+}
+
+// templatePart is either literal text or a variable reference
+type templatePart struct {
+	literal  string
+	variable string
+}
+
+// parseHeaderTemplate splits a value into literals and variables. Braces that
+// don't enclose a variable name are kept as literal text.
+func parseHeaderTemplate(value string) *headerTemplate {
+	t := &headerTemplate{}
+	for value != "" {
+		start := strings.IndexByte(value, '{')
+		if start < 0 {
+			t.parts = append(t.parts, templatePart{literal: value})
+			break
+		}
+		end := strings.IndexByte(value[start:], '}')
+		if end < 0 || !isVariableName(value[start+1:start+end]) {
+			t.parts = append(t.parts, templatePart{literal: value[:start+1]})
+			value = value[start+1:]
+			continue
+		}
+		if start > 0 {
+			t.parts = append(t.parts, templatePart{literal: value[:start]})
+		}
+		t.parts = append(t.parts, templatePart{variable: value[start+1 : start+end]})
+		value = value[start+end+1:]
+	}
+	return t
+}
+
+// isVariableName reports whether name can be a template variable
+func isVariableName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// static reports whether the template has no variables
+func (t *headerTemplate) static() bool {
+	for _, part := range t.parts {
+		if part.variable != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// render substitutes the variables, with unknown variables rendering empty.
+// Line breaks in variable values are replaced so they can't inject headers.
+func (t *headerTemplate) render(vars *templateVars) string {
+	var b strings.Builder
+	for _, part := range t.parts {
+		if part.variable != "" {
+			b.WriteString(headerValueReplacer.Replace(vars.lookup(part.variable)))
+		} else {
+			b.WriteString(part.literal)
+		}
+	}
+	return b.String()
+}
+
+// headerValueReplacer removes characters not allowed in header values
+var headerValueReplacer = strings.NewReplacer("\r", " ", "\n", " ")
+
+// templateVars resolves template variables for one request
+type templateVars struct {
+	request  *http.Request
+	route    *config.Route
+	identity *auth.Identity
+	now      time.Time
+}
+
+// newTemplateVars captures the request context used by header templates
+func newTemplateVars(r *http.Request, route *config.Route) *templateVars {
+	return &templateVars{
+		request:  r,
+		route:    route,
+		identity: auth.IdentityFromContext(r.Context()),
+		now:      time.Now(),
+	}
+}
+
+// lookup returns the value of a variable
+func (v *templateVars) lookup(name string) string {
+	switch name {
+	case "now_unix":
+		return strconv.FormatInt(v.now.Unix(), 10)
+	case "now_unix_ms":
+		return strconv.FormatInt(v.now.UnixMilli(), 10)
+	case "now_rfc3339":
+		return v.now.UTC().Format(time.RFC3339)
+	case "client_ip":
+		return util.GetClientIP(v.request)
+	case "request.method":
+		return v.request.Method
+	case "request.path":
+		return v.request.URL.Path
+	case "request.query":
+		return v.request.URL.RawQuery
+	case "request.host":
+		return v.request.Host
+	case "request.scheme":
+		if v.request.TLS != nil {
+			return "https"
+		}
+		return "http"
+	case "route.path":
+		if v.route != nil {
+			return v.route.Path
+		}
+		return ""
+	case "route.upstream":
+		if v.route != nil {
+			return v.route.Upstream
+		}
+		return ""
+	}
+
+	switch {
+	case strings.HasPrefix(name, "jwt."), strings.HasPrefix(name, "identity."):
+		return identityValue(v.identity, name)
+	case strings.HasPrefix(name, "feature."):
+		if value, ok := FeatureFlagsFromContext(v.request.Context())[strings.TrimPrefix(name, "feature.")]; ok {
+			return strconv.FormatBool(value)
+		}
+	case strings.HasPrefix(name, "request.header."):
+		return v.request.Header.Get(strings.TrimPrefix(name, "request.header."))
+	case strings.HasPrefix(name, "request.query."):
+		return v.request.URL.Query().Get(strings.TrimPrefix(name, "request.query."))
+	case strings.HasPrefix(name, "route.label."):
+		if v.route != nil {
+			return v.route.Labels[strings.TrimPrefix(name, "route.label.")]
+		}
+	}
+	return ""
+}
+
+// identityValue returns the value of the caller named by an identity.* or
+// jwt.* variable
+func identityValue(identity *auth.Identity, source string) string {
+	if identity == nil {
+		return ""
+	}
+	if claim, ok := strings.CutPrefix(source, "jwt."); ok {
+		return formatClaim(identity.Claim(claim))
+	}
+	switch source {
+	case "identity.type":
+		return identity.Type
+	case "identity.subject":
+		return identity.Subject
+	case "identity.tenant":
+		return identity.Tenant
+	case "identity.role":
+		return identity.Role
+	case "identity.scopes":
+		return strings.Join(identity.Scopes, " ")
+	}
+	return ""
+}
+
+// formatClaim renders a claim value as header text, joining arrays with commas
+func formatClaim(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, formatClaim(item))
+		}
+		return strings.Join(items, ",")
+	case map[string]interface{}:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
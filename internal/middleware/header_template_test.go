@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHeaderTemplate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		value  string
+		static bool
+	}{
+		{name: "plain value", value: "gateway", static: true},
+		{name: "empty value", value: "", static: true},
+		{name: "single variable", value: "{jwt.sub}", static: false},
+		{name: "variable with literals", value: "user-{jwt.sub}-x", static: false},
+		{name: "json braces", value: `{"a": 1}`, static: true},
+		{name: "unclosed brace", value: "{jwt.sub", static: true},
+		{name: "empty braces", value: "{}", static: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl := parseHeaderTemplate(tc.value)
+			assert.Equal(t, tc.static, tmpl.static())
+			if tc.static {
+				assert.Equal(t, tc.value, tmpl.render(&templateVars{}))
+			}
+		})
+	}
+}
+
+func TestHeaderTemplateRender(t *testing.T) {
+	route := &config.Route{
+		Path:     "/api/*",
+		Upstream: "http://svc:8080",
+		Labels:   map[string]string{"team": "identity"},
+	}
+	identity := &auth.Identity{
+		Type:    "jwt",
+		Subject: "user-1",
+		Tenant:  "acme",
+		Role:    "admin",
+		Scopes:  []string{"items:read", "items:write"},
+		Claims: map[string]interface{}{
+			"sub":    "user-1",
+			"groups": []interface{}{"a", "b"},
+			"org":    map[string]interface{}{"id": "acme"},
+			"level":  float64(3),
+		},
+	}
+
+	req := httptest.NewRequest("POST", "http://example.com/api/items?page=2", nil)
+	req.Header.Set("X-Request-ID", "abc")
+	req = req.WithContext(auth.WithIdentity(req.Context(), identity))
+
+	vars := newTemplateVars(req, route)
+	vars.now = time.Unix(1700000000, 123000000)
+
+	testCases := []struct {
+		template string
+		expected string
+	}{
+		{"{jwt.sub}", "user-1"},
+		{"{jwt.groups}", "a,b"},
+		{"{jwt.org.id}", "acme"},
+		{"{jwt.level}", "3"},
+		{"{jwt.missing}", ""},
+		{"{identity.role}", "admin"},
+		{"{identity.type}", "jwt"},
+		{"{identity.tenant}", "acme"},
+		{"{identity.scopes}", "items:read items:write"},
+		{"{route.path}", "/api/*"},
+		{"{route.upstream}", "http://svc:8080"},
+		{"{route.label.team}", "identity"},
+		{"{request.method} {request.path}", "POST /api/items"},
+		{"{request.query.page}", "2"},
+		{"{request.header.X-Request-ID}", "abc"},
+		{"{request.host}", "example.com"},
+		{"{request.scheme}", "http"},
+		{"{now_unix}", "1700000000"},
+		{"{now_unix_ms}", "1700000000123"},
+		{"{now_rfc3339}", "2023-11-14T22:13:20Z"},
+		{"{unknown}", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.template, func(t *testing.T) {
+			assert.Equal(t, tc.expected, parseHeaderTemplate(tc.template).render(vars))
+		})
+	}
+
+	t.Run("without identity or route", func(t *testing.T) {
+		vars := newTemplateVars(httptest.NewRequest("GET", "/", nil), nil)
+		assert.Equal(t, "", parseHeaderTemplate("{jwt.sub}{identity.role}{route.path}").render(vars))
+	})
+
+	t.Run("strips line breaks", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req = req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{
+			Claims: map[string]interface{}{"sub": "a\r\nX-Injected: 1"},
+		}))
+		assert.Equal(t, "a  X-Injected: 1", parseHeaderTemplate("{jwt.sub}").render(newTemplateVars(req, nil)))
+	})
+}
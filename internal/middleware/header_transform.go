@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"net/http"
+	"regexp"
 
 	"api-gateway/internal/config"
 	"api-gateway/pkg/logger"
@@ -19,23 +20,75 @@ func NewHeaderTransformer(log logger.Logger) *HeaderTransformer {
 	}
 }
 
+// compiledTransform is a header transform with parsed templates and patterns
+type compiledTransform struct {
+	route    *config.Route
+	request  map[string]*headerTemplate
+	response map[string]*headerTemplate
+	remove   []string
+	removeIf []compiledRemoval
+}
+
+// compiledRemoval is a conditional header removal
+type compiledRemoval struct {
+	header  string
+	phase   string
+	value   *headerTemplate
+	matches *regexp.Regexp
+}
+
+// applies reports whether the header should be removed for this request
+func (c compiledRemoval) applies(vars *templateVars) bool {
+	value := c.value.render(vars)
+	if c.matches == nil {
+		return value == ""
+	}
+	return c.matches.MatchString(value)
+}
+
 // Transform applies header transformations based on configuration
 func (h *HeaderTransformer) Transform(next http.Handler, transform *config.HeaderTransform) http.Handler {
+	return h.transform(next, transform, nil)
+}
+
+// TransformRoute applies the route's header transformations, making route
+// variables such as {route.path} available to templates
+func (h *HeaderTransformer) TransformRoute(next http.Handler, route config.Route) http.Handler {
+	if route.Middlewares == nil {
+		return next
+	}
+	return h.transform(next, route.Middlewares.HeaderTransform, &route)
+}
+
+// transform compiles the transform once and applies it to each request
+func (h *HeaderTransformer) transform(next http.Handler, transform *config.HeaderTransform, route *config.Route) http.Handler {
+	if transform == nil {
+		return next
+	}
+	compiled := h.compile(transform, route)
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if transform == nil {
-			next.ServeHTTP(w, r)
-			return
-		}
+		vars := newTemplateVars(r, route)
 
 		// Apply request header transformations
-		for key, value := range transform.Request {
-			r.Header.Set(key, value)
+		for key, value := range compiled.request {
+			if value.static() {
+				r.Header.Set(key, value.render(vars))
+			} else if rendered := value.render(vars); rendered != "" {
+				r.Header.Set(key, rendered)
+			}
+		}
+		for _, removal := range compiled.removeIf {
+			if removal.phase != config.HeaderPhaseResponse && removal.applies(vars) {
+				r.Header.Del(removal.header)
+			}
 		}
 
 		// Create a custom response writer to handle response header transformations
 		tw := &transformResponseWriter{
 			ResponseWriter: w,
-			transform:      transform,
+			transform:      compiled,
+			vars:           vars,
 			log:            h.log,
 		}
 
@@ -44,11 +97,49 @@ func (h *HeaderTransformer) Transform(next http.Handler, transform *config.Heade
 	})
 }
 
+// compile parses the transform's templates and removal patterns
+func (h *HeaderTransformer) compile(transform *config.HeaderTransform, route *config.Route) *compiledTransform {
+	compiled := &compiledTransform{
+		route:    route,
+		request:  make(map[string]*headerTemplate, len(transform.Request)),
+		response: make(map[string]*headerTemplate, len(transform.Response)),
+		remove:   transform.Remove,
+	}
+	for key, value := range transform.Request {
+		compiled.request[key] = parseHeaderTemplate(value)
+	}
+	for key, value := range transform.Response {
+		compiled.response[key] = parseHeaderTemplate(value)
+	}
+
+	for _, removal := range transform.RemoveIf {
+		c := compiledRemoval{
+			header: removal.Header,
+			phase:  removal.Phase,
+			value:  parseHeaderTemplate(removal.Value),
+		}
+		if removal.Matches != "" {
+			pattern, err := regexp.Compile(removal.Matches)
+			if err != nil {
+				h.log.Error("Ignoring header removal with invalid pattern",
+					logger.String("header", removal.Header),
+					logger.Error(err),
+				)
+				continue
+			}
+			c.matches = pattern
+		}
+		compiled.removeIf = append(compiled.removeIf, c)
+	}
+	return compiled
+}
+
 // transformResponseWriter is a wrapper for http.ResponseWriter that
 // applies header transformations to responses
 type transformResponseWriter struct {
 	http.ResponseWriter
-	transform   *config.HeaderTransform
+	transform   *compiledTransform
+	vars        *templateVars
 	log         logger.Logger
 	wroteHeader bool
 }
@@ -61,18 +152,26 @@ func (tw *transformResponseWriter) WriteHeader(statusCode int) {
 	tw.wroteHeader = true
 
 	// Apply response header transformations
-	for key, value := range tw.transform.Response {
-		// Empty value means remove the header
-		if value == "" {
-			tw.ResponseWriter.Header().Del(key)
-		} else {
-			tw.ResponseWriter.Header().Set(key, value)
+	header := tw.ResponseWriter.Header()
+	for key, value := range tw.transform.response {
+		rendered := value.render(tw.vars)
+		switch {
+		case rendered != "":
+			header.Set(key, rendered)
+		case value.static():
+			// Empty value means remove the header
+			header.Del(key)
 		}
 	}
 
 	// Remove headers if specified
-	for _, header := range tw.transform.Remove {
-		tw.ResponseWriter.Header().Del(header)
+	for _, name := range tw.transform.remove {
+		header.Del(name)
+	}
+	for _, removal := range tw.transform.removeIf {
+		if removal.phase == config.HeaderPhaseResponse && removal.applies(tw.vars) {
+			header.Del(removal.header)
+		}
 	}
 
 	tw.ResponseWriter.WriteHeader(statusCode)
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"api-gateway/internal/auth"
 	"api-gateway/internal/config"
 	"api-gateway/pkg/logger"
 	"net/http"
@@ -262,3 +263,81 @@ func TestHeaderTransformer_WriteHeaderOnlyOnce(t *testing.T) {
 	assert.Equal(t, "Created", rec.Body.String())
 	assert.Equal(t, "new-value", rec.Header().Get("X-Original"))
 }
+
+func TestHeaderTransformer_TransformRoute(t *testing.T) {
+	transformer := NewHeaderTransformer(&mockTransformLogger{})
+
+	route := config.Route{
+		Path:     "/api/*",
+		Upstream: "http://svc:8080",
+		Middlewares: &config.Middlewares{
+			HeaderTransform: &config.HeaderTransform{
+				Request: map[string]string{
+					"X-User-ID":      "{jwt.sub}",
+					"X-Gateway-Path": "{route.path}",
+					"X-Static":       "static",
+				},
+				Response: map[string]string{
+					"X-Served-At": "{now_unix_ms}",
+					"X-Tenant":    "{jwt.tenant}",
+				},
+				RemoveIf: []config.HeaderRemoval{
+					{Header: "X-Internal", Value: "{identity.role}", Matches: "^(user|)$"},
+					{Header: "X-Debug", Phase: config.HeaderPhaseResponse, Value: "{request.header.X-Debug-Mode}"},
+				},
+			},
+		},
+	}
+
+	var received http.Header
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.Header().Set("X-Debug", "trace")
+		w.Header().Set("X-Tenant", "upstream")
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := transformer.TransformRoute(testHandler, route)
+
+	t.Run("renders templates from identity and route", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "http://example.com/api/test", nil)
+		req.Header.Set("X-Internal", "1")
+		req = req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{
+			Role:   "admin",
+			Claims: map[string]interface{}{"sub": "user-1"},
+		}))
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, "user-1", received.Get("X-User-ID"))
+		assert.Equal(t, "/api/*", received.Get("X-Gateway-Path"))
+		assert.Equal(t, "static", received.Get("X-Static"))
+		assert.Equal(t, "1", received.Get("X-Internal"))
+		assert.NotEmpty(t, rec.Header().Get("X-Served-At"))
+		// Empty templated values leave the header untouched
+		assert.Equal(t, "upstream", rec.Header().Get("X-Tenant"))
+		// X-Debug-Mode was not sent, so the debug header is removed
+		assert.Empty(t, rec.Header().Get("X-Debug"))
+	})
+
+	t.Run("applies conditional removals", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "http://example.com/api/test", nil)
+		req.Header.Set("X-Internal", "1")
+		req.Header.Set("X-Debug-Mode", "on")
+		req.Header.Set("X-User-ID", "spoofed")
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		// Anonymous callers lose the internal header
+		assert.Empty(t, received.Get("X-Internal"))
+		// No subject claim, so the client value is kept
+		assert.Equal(t, "spoofed", received.Get("X-User-ID"))
+		assert.Equal(t, "trace", rec.Header().Get("X-Debug"))
+	})
+
+	t.Run("route without transform", func(t *testing.T) {
+		plain := config.Route{Path: "/api/*"}
+		assert.NotNil(t, transformer.TransformRoute(testHandler, plain))
+	})
+}
@@ -0,0 +1,217 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"api-gateway/internal/config"
+)
+
+// Sources of masked values in the gateway_access_log_redactions_total metric
+const (
+	logRedactionPath   = "path"
+	logRedactionQuery  = "query"
+	logRedactionHeader = "header"
+	logRedactionBody   = "body"
+)
+
+// defaultLogReplacement replaces masked values when none is configured
+const defaultLogReplacement = "[REDACTED]"
+
+// LogRedactor masks secrets and PII in the request details written to the
+// access log: values of sensitive query parameters, headers and JSON body
+// properties, and anything matching the configured patterns
+type LogRedactor struct {
+	queryParams map[string]bool
+	headers     map[string]bool
+	bodyFields  map[string]bool
+	patterns    []logPattern
+	maskAll     bool // A pattern didn't compile, so values are masked whole
+	replacement string
+}
+
+// logPattern is a compiled redaction pattern
+type logPattern struct {
+	name   string
+	regexp *regexp.Regexp
+}
+
+// NewLogRedactor creates a redactor from the access log redaction settings.
+// If a pattern doesn't compile, the redactor masks every value patterns would
+// be matched against and the error is returned with it.
+func NewLogRedactor(cfg *config.AccessLogRedaction) (*LogRedactor, error) {
+	l := &LogRedactor{
+		queryParams: lowerSet(cfg.QueryParams),
+		headers:     lowerSet(cfg.Headers),
+		bodyFields:  lowerSet(cfg.BodyFields),
+		replacement: cfg.Replacement,
+	}
+	if l.replacement == "" {
+		l.replacement = defaultLogReplacement
+	}
+	for _, pattern := range cfg.Patterns {
+		compiled, err := regexp.Compile(pattern.Regex)
+		if err != nil {
+			l.patterns = nil
+			l.maskAll = true
+			return l, fmt.Errorf("invalid redaction pattern %s: %w", pattern.Name, err)
+		}
+		l.patterns = append(l.patterns, logPattern{name: pattern.Name, regexp: compiled})
+	}
+	return l, nil
+}
+
+// Path masks pattern matches in a request path
+func (l *LogRedactor) Path(path string) string {
+	return l.mask(logRedactionPath, path)
+}
+
+// Query masks the values of sensitive parameters and pattern matches in a
+// raw query string. Masked values are logged unescaped.
+func (l *LogRedactor) Query(query string) string {
+	if query == "" {
+		return ""
+	}
+	pairs := strings.Split(query, "&")
+	for i, pair := range pairs {
+		key, value, _ := strings.Cut(pair, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if l.queryParams[strings.ToLower(name)] {
+			if value != "" {
+				pairs[i] = key + "=" + l.replacement
+				accessLogRedactions.WithLabelValues(logRedactionQuery, strings.ToLower(name)).Inc()
+			}
+			continue
+		}
+		unescaped, err := url.QueryUnescape(value)
+		if err != nil {
+			unescaped = value
+		}
+		if masked := l.mask(logRedactionQuery, unescaped); masked != unescaped {
+			pairs[i] = key + "=" + masked
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// Headers returns the named request headers present in header, with the
+// values of sensitive headers and pattern matches masked
+func (l *LogRedactor) Headers(header http.Header, names []string) map[string]string {
+	var logged map[string]string
+	for _, name := range names {
+		values := header.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		if logged == nil {
+			logged = make(map[string]string, len(names))
+		}
+		canonical := http.CanonicalHeaderKey(name)
+		if l.headers[strings.ToLower(name)] {
+			logged[canonical] = l.replacement
+			accessLogRedactions.WithLabelValues(logRedactionHeader, strings.ToLower(name)).Inc()
+			continue
+		}
+		logged[canonical] = l.mask(logRedactionHeader, strings.Join(values, ", "))
+	}
+	return logged
+}
+
+// Body masks the values of sensitive properties of a JSON body and pattern
+// matches in any body. JSON bodies that can't be decoded, such as truncated
+// ones, are masked whole since their properties can't be told apart.
+func (l *LogRedactor) Body(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if !isJSON(contentType) {
+		return l.mask(logRedactionBody, string(body))
+	}
+
+	document, err := decodeJSON(body)
+	if err != nil {
+		accessLogRedactions.WithLabelValues(logRedactionBody, "unparsed").Inc()
+		return l.replacement
+	}
+	document = l.maskFields(document)
+	out, err := encodeJSON(document)
+	if err != nil {
+		accessLogRedactions.WithLabelValues(logRedactionBody, "unparsed").Inc()
+		return l.replacement
+	}
+	return string(out)
+}
+
+// maskFields replaces the values of sensitive properties below value and
+// masks pattern matches in the other strings
+func (l *LogRedactor) maskFields(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for name, child := range value {
+			if l.bodyFields[strings.ToLower(name)] {
+				value[name] = l.replacement
+				accessLogRedactions.WithLabelValues(logRedactionBody, strings.ToLower(name)).Inc()
+				continue
+			}
+			value[name] = l.maskFields(child)
+		}
+	case []any:
+		for i, child := range value {
+			value[i] = l.maskFields(child)
+		}
+	case string:
+		return l.mask(logRedactionBody, value)
+	}
+	return value
+}
+
+// mask replaces the pattern matches in text
+func (l *LogRedactor) mask(source, text string) string {
+	if l.maskAll {
+		if text == "" {
+			return text
+		}
+		accessLogRedactions.WithLabelValues(source, "pattern:invalid").Inc()
+		return l.replacement
+	}
+	for _, pattern := range l.patterns {
+		masked := pattern.regexp.ReplaceAllLiteralString(text, l.replacement)
+		if masked != text {
+			accessLogRedactions.WithLabelValues(source, "pattern:"+pattern.name).Inc()
+			text = masked
+		}
+	}
+	return text
+}
+
+// bodyCapture keeps the first bytes of a request body as it is read
+type bodyCapture struct {
+	io.ReadCloser
+	data  []byte
+	limit int
+}
+
+// Read copies what fits of the read bytes
+func (b *bodyCapture) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if room := b.limit - len(b.data); room > 0 && n > 0 {
+		b.data = append(b.data, p[:min(n, room)]...)
+	}
+	return n, err
+}
+
+// lowerSet returns the lowercased names as a set
+func lowerSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[strings.ToLower(name)] = true
+	}
+	return set
+}
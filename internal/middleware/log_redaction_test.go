@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"api-gateway/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// logRedaction returns redaction settings like the configured defaults
+func logRedaction() *config.AccessLogRedaction {
+	return &config.AccessLogRedaction{
+		QueryParams: []string{"token", "api_key"},
+		Headers:     []string{"Authorization", "Cookie"},
+		BodyFields:  []string{"password"},
+		Patterns: []config.RedactionPattern{
+			{Name: "email", Regex: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`},
+			{Name: "bearer", Regex: `(?i)bearer\s+[A-Za-z0-9._~+/=-]+`},
+		},
+	}
+}
+
+func TestLogRedactorQuery(t *testing.T) {
+	l, err := NewLogRedactor(logRedaction())
+	require.NoError(t, err)
+
+	tokens := testutil.ToFloat64(accessLogRedactions.WithLabelValues(logRedactionQuery, "token"))
+	assert.Equal(t, "page=2&Token=[REDACTED]&api_key=&to=[REDACTED]&q=a%20b",
+		l.Query("page=2&Token=s3cret&api_key=&to=ada%40example.com&q=a%20b"))
+	assert.Equal(t, tokens+1, testutil.ToFloat64(accessLogRedactions.WithLabelValues(logRedactionQuery, "token")))
+	assert.Equal(t, "", l.Query(""))
+
+	assert.Equal(t, "/users/[REDACTED]/orders", l.Path("/users/ada@example.com/orders"))
+}
+
+func TestLogRedactorHeaders(t *testing.T) {
+	l, err := NewLogRedactor(logRedaction())
+	require.NoError(t, err)
+	header := http.Header{}
+	header.Set("Authorization", "Basic YWRhOnB3")
+	header.Set("X-Forwarded-User", "ada@example.com")
+	header.Set("X-Trace", "Bearer abc.def")
+	header.Set("Accept", "application/json")
+
+	assert.Equal(t, map[string]string{
+		"Authorization":    "[REDACTED]",
+		"X-Forwarded-User": "[REDACTED]",
+		"X-Trace":          "[REDACTED]",
+		"Accept":           "application/json",
+	}, l.Headers(header, []string{"authorization", "x-forwarded-user", "x-trace", "accept", "cookie"}))
+	assert.Nil(t, l.Headers(header, []string{"cookie"}))
+}
+
+func TestLogRedactorBody(t *testing.T) {
+	redaction := logRedaction()
+	redaction.Replacement = "***"
+	l, err := NewLogRedactor(redaction)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{"user": {"Password": "***", "email": "***"}, "items": [{"note": "call ***"}], "count": 2}`,
+		l.Body("application/json", []byte(`{"user": {"Password": "hunter2", "email": "ada@example.com"}, "items": [{"note": "call bob@example.org"}], "count": 2}`)))
+	assert.Equal(t, "***", l.Body("application/json", []byte(`{"password": "hunt`)))
+	assert.Equal(t, "contact=***", l.Body("application/x-www-form-urlencoded", []byte("contact=ada@example.com")))
+	assert.Equal(t, "", l.Body("application/json", nil))
+}
+
+func TestLogRedactorInvalidPattern(t *testing.T) {
+	redaction := logRedaction()
+	redaction.Patterns = append(redaction.Patterns, config.RedactionPattern{Name: "broken", Regex: "("})
+	l, err := NewLogRedactor(redaction)
+	assert.ErrorContains(t, err, "invalid redaction pattern broken")
+
+	// Values patterns would be matched against are masked whole
+	assert.Equal(t, "[REDACTED]", l.Path("/users/42/orders"))
+	assert.Equal(t, "page=[REDACTED]&Token=[REDACTED]", l.Query("page=2&Token=s3cret"))
+	assert.JSONEq(t, `{"note": "[REDACTED]", "count": 2}`, l.Body("application/json", []byte(`{"note": "hello", "count": 2}`)))
+	assert.Equal(t, "", l.Body("text/plain", nil))
+}
+
+func TestAccessLoggerRedactsEntries(t *testing.T) {
+	log := &recordingLogger{}
+	accessLogger := NewAccessLogger(&config.AccessLogConfig{
+		SampleRate:   1,
+		LogQuery:     true,
+		LogHeaders:   []string{"Authorization", "Accept"},
+		LogBodyBytes: 64,
+		Redaction:    *logRedaction(),
+	}, log)
+
+	var received string
+	handler := accessLogger.Log(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		received = string(data)
+	}), config.Route{Path: "/login"})
+
+	body := `{"user": "ada@example.com", "password": "hunter2"}`
+	req := httptest.NewRequest(http.MethodPost, "/login/ada@example.com?token=s3cret&lang=en", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer s3cret")
+	req.Header.Set("Accept", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	// The upstream still receives the whole body
+	assert.Equal(t, body, received)
+	if assert.Equal(t, 1, log.count()) {
+		entry := log.entries[0]
+		assert.Equal(t, "/login/[REDACTED]", entry["path"])
+		assert.Equal(t, "token=[REDACTED]&lang=en", entry["query"])
+		assert.Equal(t, map[string]string{"Authorization": "[REDACTED]", "Accept": "application/json"}, entry["headers"])
+		assert.JSONEq(t, `{"user": "[REDACTED]", "password": "[REDACTED]"}`, entry["body"].(string))
+	}
+
+	// Truncated bodies can't be parsed and are masked whole
+	accessLogger.config.LogBodyBytes = 10
+	req = httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if assert.Equal(t, 2, log.count()) {
+		assert.Equal(t, "[REDACTED]", log.entries[1]["body"])
+	}
+}
@@ -1,7 +1,9 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
@@ -59,6 +61,43 @@ var (
 		[]string{"path"},
 	)
 
+	// cacheNamespaceHits counts cache hits by namespace
+	cacheNamespaceHits = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_cache_namespace_hits_total",
+			Help: "Cache hits by namespace",
+		},
+		[]string{"namespace"},
+	)
+
+	// cacheNamespaceMisses counts cache misses by namespace
+	cacheNamespaceMisses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_cache_namespace_misses_total",
+			Help: "Cache misses by namespace",
+		},
+		[]string{"namespace"},
+	)
+
+	// cacheNamespaceEntries counts the cached entries by namespace
+	cacheNamespaceEntries = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_cache_namespace_entries",
+			Help: "Cached entries by namespace",
+		},
+		[]string{"namespace"},
+	)
+
+	// cacheDirectives counts the cache directives sent by callers, by whether
+	// they were applied
+	cacheDirectives = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_cache_directives_total",
+			Help: "Cache bypass and refresh directives by namespace, directive and result",
+		},
+		[]string{"namespace", "directive", "result"},
+	)
+
 	// RateLimitRejections tracks rate limit rejections
 	rateLimitRejections = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -67,6 +106,165 @@ var (
 		},
 		[]string{"path"},
 	)
+
+	// rateLimitExempted tracks requests passed without counting towards a
+	// rate limit because the caller is exempt
+	rateLimitExempted = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_rate_limit_exempted_total",
+			Help: "Total number of requests exempted from rate limits",
+		},
+		[]string{"path", "reason"},
+	)
+
+	// SLOBurnRate tracks how fast each route spends its error budget
+	sloBurnRate = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_slo_burn_rate",
+			Help: "Error budget burn rate per route, SLO and window (1 = spending exactly the budget)",
+		},
+		[]string{"route", "slo", "window"},
+	)
+
+	// SLOAlertActive tracks firing burn-rate alerts
+	sloAlertActive = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_slo_alert_active",
+			Help: "Burn-rate alert state per route, SLO and severity (1 = firing)",
+		},
+		[]string{"route", "slo", "severity"},
+	)
+
+	// CollapsedRequests tracks requests served from another request's upstream call
+	collapsedRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_collapsed_requests_total",
+			Help: "Total number of requests that shared an identical in-flight request's response",
+		},
+		[]string{"route"},
+	)
+
+	// SlowClientAborts tracks requests aborted because the client transferred too slowly
+	slowClientAborts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_slow_client_aborts_total",
+			Help: "Total number of requests aborted because the client sent or read data too slowly",
+		},
+		[]string{"direction"},
+	)
+
+	// StrippedHeaders tracks internal headers removed from client requests
+	strippedHeaders = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "gateway_stripped_headers_total",
+			Help: "Total number of internal headers removed from client requests",
+		},
+	)
+
+	// ClientBreakerTrips tracks clients blocked for causing too many errors
+	clientBreakerTrips = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "gateway_client_breaker_trips_total",
+			Help: "Total number of times a client was blocked for causing too many error responses",
+		},
+	)
+
+	// ClientBreakerRejections tracks requests rejected from blocked clients
+	clientBreakerRejections = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "gateway_client_breaker_rejections_total",
+			Help: "Total number of requests rejected because their client is blocked",
+		},
+	)
+
+	// MQTTConnections tracks open MQTT-over-WebSocket connections
+	mqttConnections = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_mqtt_connections",
+			Help: "Open MQTT-over-WebSocket connections",
+		},
+		[]string{"path"},
+	)
+
+	// MQTTRejections tracks MQTT connections refused at the upgrade
+	mqttRejections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_mqtt_rejections_total",
+			Help: "Total number of MQTT-over-WebSocket connections refused at the upgrade",
+		},
+		[]string{"path", "reason"},
+	)
+
+	// testTrafficRequests tracks requests with a test traffic token by route
+	// and whether they went to the sandbox, the route's upstream or were
+	// rejected
+	testTrafficRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_test_traffic_requests_total",
+			Help: "Total number of requests carrying a test traffic token",
+		},
+		[]string{"route", "result"},
+	)
+
+	// responseValidations tracks sampled responses checked against the
+	// route's OpenAPI document by outcome
+	responseValidations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_response_validation_total",
+			Help: "Total number of sampled upstream responses checked against OpenAPI documents",
+		},
+		[]string{"route", "result"},
+	)
+
+	// opaBundleLoads tracks policy bundle loads by bundle and result
+	opaBundleLoads = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_opa_bundle_loads_total",
+			Help: "Total number of policy bundle versions loaded or rejected by the embedded OPA engine",
+		},
+		[]string{"bundle", "result"},
+	)
+
+	// fieldEncryptionFailures tracks requests rejected and responses
+	// withheld because their fields couldn't be decrypted or encrypted
+	fieldEncryptionFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_field_encryption_failures_total",
+			Help: "Total number of requests and responses whose fields couldn't be decrypted or encrypted",
+		},
+		[]string{"route", "direction"},
+	)
+
+	// responseRedactions tracks responses with fields removed for the caller
+	// and responses withheld because they couldn't be redacted
+	responseRedactions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_response_redactions_total",
+			Help: "Total number of responses redacted or withheld for restricted callers",
+		},
+		[]string{"route", "result"},
+	)
+
+	// priorityRequests tracks requests scheduled by priority, by urgency and
+	// whether they were admitted, queued or shed
+	priorityRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_priority_requests_total",
+			Help: "Total number of requests scheduled by priority",
+		},
+		[]string{"route", "urgency", "result"},
+	)
+
+	// accessLogRedactions tracks values masked in access log entries by
+	// where they were found and the parameter, header, field or pattern
+	// that matched
+	accessLogRedactions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_access_log_redactions_total",
+			Help: "Total number of values masked in access log entries",
+		},
+		[]string{"source", "rule"},
+	)
 )
 
 func init() {
@@ -76,13 +274,47 @@ func init() {
 	prometheus.MustRegister(circuitBreakerStatus)
 	prometheus.MustRegister(cacheHits)
 	prometheus.MustRegister(cacheMisses)
+	prometheus.MustRegister(cacheNamespaceHits)
+	prometheus.MustRegister(cacheNamespaceMisses)
+	prometheus.MustRegister(cacheNamespaceEntries)
+	prometheus.MustRegister(cacheDirectives)
 	prometheus.MustRegister(rateLimitRejections)
+	prometheus.MustRegister(rateLimitExempted)
+	prometheus.MustRegister(sloBurnRate)
+	prometheus.MustRegister(sloAlertActive)
+	prometheus.MustRegister(collapsedRequests)
+	prometheus.MustRegister(slowClientAborts)
+	prometheus.MustRegister(strippedHeaders)
+	prometheus.MustRegister(clientBreakerTrips)
+	prometheus.MustRegister(clientBreakerRejections)
+	prometheus.MustRegister(mqttConnections)
+	prometheus.MustRegister(mqttRejections)
+	prometheus.MustRegister(testTrafficRequests)
+	prometheus.MustRegister(responseValidations)
+	prometheus.MustRegister(opaBundleLoads)
+	prometheus.MustRegister(fieldEncryptionFailures)
+	prometheus.MustRegister(responseRedactions)
+	prometheus.MustRegister(priorityRequests)
+	prometheus.MustRegister(accessLogRedactions)
 }
 
 // MetricsMiddleware provides metrics collection and endpoints
 type MetricsMiddleware struct {
 	config *config.MetricsConfig
 	log    logger.Logger
+
+	// Per-route metrics carry the route labels as Prometheus labels
+	routeLabelNames []string
+	routeRequests   *prometheus.CounterVec
+	routeDuration   *prometheus.HistogramVec
+
+	// timings receives each request duration, e.g. for StatsD timers
+	timings TimingSink
+}
+
+// TimingSink receives individual request durations
+type TimingSink interface {
+	Timing(name string, d time.Duration, tags map[string]string)
 }
 
 // NewMetricsMiddleware creates a new metrics middleware
@@ -144,6 +376,121 @@ func (m *MetricsMiddleware) Metrics(next http.Handler) http.Handler {
 	})
 }
 
+// RegisterRouteLabels creates the per-route request metrics, labeled by route,
+// method, status and every label name declared by any route. Routes without a
+// label report it as empty.
+func (m *MetricsMiddleware) RegisterRouteLabels(routes []config.Route) {
+	if !m.config.Enabled {
+		return
+	}
+
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, route := range routes {
+		for name := range route.Labels {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	labelNames := append([]string{"route", "method", "status"}, names...)
+
+	requests := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_route_requests_total",
+			Help: "Total number of requests per route",
+		},
+		labelNames,
+	)
+	duration := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "gateway_route_request_duration_seconds",
+			Help:    "Request duration per route in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		labelNames,
+	)
+
+	var err error
+	if requests, err = registerCollector(requests); err != nil {
+		m.log.Error("Failed to register route metrics", logger.Error(err))
+		return
+	}
+	if duration, err = registerCollector(duration); err != nil {
+		m.log.Error("Failed to register route metrics", logger.Error(err))
+		return
+	}
+
+	m.routeLabelNames = names
+	m.routeRequests = requests
+	m.routeDuration = duration
+}
+
+// registerCollector registers c, reusing an identical collector registered earlier
+func registerCollector[C prometheus.Collector](c C) (C, error) {
+	if err := prometheus.Register(c); err != nil {
+		var already prometheus.AlreadyRegisteredError
+		if errors.As(err, &already) {
+			if existing, ok := already.ExistingCollector.(C); ok {
+				return existing, nil
+			}
+		}
+		return c, err
+	}
+	return c, nil
+}
+
+// SetTimingSink sends every route request duration to sink in addition to the
+// Prometheus histogram. It must be called before routes are registered.
+func (m *MetricsMiddleware) SetTimingSink(sink TimingSink) {
+	m.timings = sink
+}
+
+// RouteMetrics records request count and duration for a route, leaving out
+// test traffic
+func (m *MetricsMiddleware) RouteMetrics(next http.Handler, route config.Route) http.Handler {
+	if !m.config.Enabled || m.routeRequests == nil {
+		return next
+	}
+
+	values := make([]string, 0, len(m.routeLabelNames)+3)
+	values = append(values, route.Path, "", "")
+	for _, name := range m.routeLabelNames {
+		values = append(values, route.Labels[name])
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsTestTraffic(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		recorder := &statusRecorder{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+		}
+		next.ServeHTTP(recorder, r)
+
+		duration := time.Since(start)
+		labels := append([]string(nil), values...)
+		labels[1] = r.Method
+		labels[2] = strconv.Itoa(recorder.statusCode)
+		m.routeRequests.WithLabelValues(labels...).Inc()
+		m.routeDuration.WithLabelValues(labels...).Observe(duration.Seconds())
+
+		if m.timings != nil {
+			tags := make(map[string]string, len(route.Labels)+3)
+			for name, value := range route.Labels {
+				tags[name] = value
+			}
+			tags["route"], tags["method"], tags["status"] = labels[0], labels[1], labels[2]
+			m.timings.Timing("route.request.duration", duration, tags)
+		}
+	})
+}
+
 // IncrementCacheHit increments the cache hit counter
 func (m *MetricsMiddleware) IncrementCacheHit(path string) {
 	if m.config.Enabled {
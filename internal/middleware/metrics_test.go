@@ -416,3 +416,38 @@ func TestMetricsMiddleware_MetricsDisabled(t *testing.T) {
 	assert.Equal(t, float64(0), rateLimitValue)
 	assert.Equal(t, float64(0), circuitBreakerValue)
 }
+
+func TestMetricsMiddleware_RouteMetrics(t *testing.T) {
+	middleware := NewMetricsMiddleware(&config.MetricsConfig{Enabled: true, Endpoint: "/metrics"}, &mockMetricsLogger{})
+	routes := []config.Route{
+		{Path: "/payments", Labels: map[string]string{"team": "payments", "tier": "critical"}},
+		{Path: "/search", Labels: map[string]string{"team": "discovery"}},
+		{Path: "/health"},
+	}
+	middleware.RegisterRouteLabels(routes)
+	assert.Equal(t, []string{"team", "tier"}, middleware.routeLabelNames)
+
+	// Registering the same label set again reuses the existing collectors
+	again := NewMetricsMiddleware(&config.MetricsConfig{Enabled: true}, &mockMetricsLogger{})
+	again.RegisterRouteLabels(routes)
+	assert.Same(t, middleware.routeRequests, again.routeRequests)
+
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	for _, route := range routes {
+		middleware.RouteMetrics(upstream, route).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", route.Path, nil))
+	}
+
+	value, err := getMetricValue(middleware.routeRequests, map[string]string{
+		"route": "/payments", "method": "POST", "status": "201", "team": "payments", "tier": "critical",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), value)
+
+	value, err = getMetricValue(middleware.routeRequests, map[string]string{
+		"route": "/search", "method": "POST", "status": "201", "team": "discovery", "tier": "",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), value)
+}
@@ -0,0 +1,230 @@
+package middleware
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/config"
+	"api-gateway/internal/notify"
+	"api-gateway/internal/util"
+	"api-gateway/pkg/logger"
+
+	"github.com/gorilla/websocket"
+)
+
+// MQTTAuthorizer admits MQTT-over-WebSocket connections. Credentials are
+// checked once at the upgrade, after which the connection is passed through
+// to the broker untouched.
+type MQTTAuthorizer struct {
+	authService *auth.AuthService
+	notifier    *notify.Notifier
+	log         logger.Logger
+
+	// Open connections by route path and device
+	connections map[string]int
+	mutex       sync.Mutex
+}
+
+// NewMQTTAuthorizer creates a new MQTT connection authorizer. notifier
+// receives connect and disconnect events and may be nil.
+func NewMQTTAuthorizer(authService *auth.AuthService, notifier *notify.Notifier, log logger.Logger) *MQTTAuthorizer {
+	return &MQTTAuthorizer{
+		authService: authService,
+		notifier:    notifier,
+		log:         log,
+		connections: make(map[string]int),
+	}
+}
+
+// Authorize requires requests to be authenticated WebSocket upgrades offering
+// one of the route's MQTT subprotocols, and holds the device's connection slot
+// for as long as next serves the upgraded connection
+func (m *MQTTAuthorizer) Authorize(next http.Handler, route config.Route) http.Handler {
+	cfg := route.Middlewares.MQTT
+	if cfg == nil || !cfg.Enabled {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !websocket.IsWebSocketUpgrade(r) {
+			mqttRejections.WithLabelValues(route.Path, "not_websocket").Inc()
+			w.Header().Set("Upgrade", "websocket")
+			safeError(w, "MQTT connections require a WebSocket upgrade", http.StatusUpgradeRequired)
+			return
+		}
+		if !offersSubprotocol(r, cfg.Subprotocols) {
+			mqttRejections.WithLabelValues(route.Path, "subprotocol").Inc()
+			safeError(w, "Unsupported WebSocket subprotocol, expected one of: "+strings.Join(cfg.Subprotocols, ", "), http.StatusBadRequest)
+			return
+		}
+
+		identity, err := m.authService.Authenticate(r, nil, route.Middlewares.JWT)
+		if err != nil || identity == nil {
+			m.log.Debug("MQTT connection failed authentication",
+				logger.String("path", route.Path),
+				logger.String("client_ip", util.GetClientIP(r)),
+				logger.Error(err),
+			)
+			mqttRejections.WithLabelValues(route.Path, "auth").Inc()
+			authError(w, err)
+			return
+		}
+
+		device := mqttDevice(identity, cfg.DeviceClaim)
+		if device == "" {
+			mqttRejections.WithLabelValues(route.Path, "no_device").Inc()
+			safeError(w, "Credentials do not identify a device", http.StatusForbidden)
+			return
+		}
+
+		key := route.Path + "\x00" + device
+		if !m.acquire(key, cfg.MaxConnectionsPerDevice) {
+			m.log.Warn("MQTT device connection limit reached",
+				logger.String("path", route.Path),
+				logger.String("device", device),
+				logger.Int("limit", cfg.MaxConnectionsPerDevice),
+			)
+			mqttRejections.WithLabelValues(route.Path, "device_limit").Inc()
+			w.Header().Set("Retry-After", "5")
+			safeError(w, "Too many connections for device", http.StatusTooManyRequests)
+			return
+		}
+		defer m.release(key)
+
+		// The connection is open once the proxy takes over the client's
+		// connection for the broker's 101 response
+		clientIP := util.GetClientIP(r)
+		var connectedAt time.Time
+		writer := &mqttUpgradeWriter{
+			statusRecorder: &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK},
+			onUpgrade: func() {
+				connectedAt = time.Now()
+				m.connected(route.Path, device, identity, clientIP)
+			},
+		}
+
+		recordCaller(r.Context(), identity)
+		next.ServeHTTP(writer, r.WithContext(auth.WithIdentity(r.Context(), identity)))
+
+		if !connectedAt.IsZero() {
+			m.disconnected(route.Path, device, clientIP, time.Since(connectedAt))
+		}
+	})
+}
+
+// acquire takes one of the device's connection slots, failing if limit
+// connections are already open. A limit of 0 is unlimited.
+func (m *MQTTAuthorizer) acquire(key string, limit int) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if limit > 0 && m.connections[key] >= limit {
+		return false
+	}
+	m.connections[key]++
+	return true
+}
+
+// release returns a connection slot taken by acquire
+func (m *MQTTAuthorizer) release(key string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.connections[key]--
+	if m.connections[key] <= 0 {
+		delete(m.connections, key)
+	}
+}
+
+// connected records a device's connection to the broker
+func (m *MQTTAuthorizer) connected(path, device string, identity *auth.Identity, clientIP string) {
+	mqttConnections.WithLabelValues(path).Inc()
+	m.log.Info("MQTT device connected",
+		logger.String("path", path),
+		logger.String("device", device),
+		logger.String("tenant", identity.Tenant),
+		logger.String("client_ip", clientIP),
+	)
+	m.notifier.Notify(notify.Event{
+		Type:     config.EventMQTTConnected,
+		Severity: notify.SeverityInfo,
+		Subject:  device,
+		Message:  fmt.Sprintf("MQTT device %s connected from %s", device, clientIP),
+		Details: map[string]string{
+			"path":      path,
+			"device":    device,
+			"tenant":    identity.Tenant,
+			"auth_type": identity.Type,
+			"client_ip": clientIP,
+		},
+	})
+}
+
+// disconnected records the end of a device's connection
+func (m *MQTTAuthorizer) disconnected(path, device, clientIP string, duration time.Duration) {
+	mqttConnections.WithLabelValues(path).Dec()
+	m.log.Info("MQTT device disconnected",
+		logger.String("path", path),
+		logger.String("device", device),
+		logger.String("client_ip", clientIP),
+		logger.String("duration", duration.Round(time.Millisecond).String()),
+	)
+	m.notifier.Notify(notify.Event{
+		Type:     config.EventMQTTDisconnected,
+		Severity: notify.SeverityInfo,
+		Subject:  device,
+		Message:  fmt.Sprintf("MQTT device %s disconnected after %s", device, duration.Round(time.Second)),
+		Details: map[string]string{
+			"path":             path,
+			"device":           device,
+			"client_ip":        clientIP,
+			"duration_seconds": strconv.FormatInt(int64(duration.Seconds()), 10),
+		},
+	})
+}
+
+// mqttDevice returns the device an identity authenticates, read from claim
+// when set and present, or the subject
+func mqttDevice(identity *auth.Identity, claim string) string {
+	if claim != "" {
+		if value := identity.Claim(claim); value != nil {
+			return fmt.Sprint(value)
+		}
+	}
+	return identity.Subject
+}
+
+// offersSubprotocol reports whether the request offers one of subprotocols
+func offersSubprotocol(r *http.Request, subprotocols []string) bool {
+	for _, offered := range websocket.Subprotocols(r) {
+		for _, subprotocol := range subprotocols {
+			if offered == subprotocol {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mqttUpgradeWriter reports when the client's connection is hijacked for the
+// upgrade
+type mqttUpgradeWriter struct {
+	*statusRecorder
+	onUpgrade func()
+}
+
+// Hijack hands over the client's connection and records the upgrade
+func (w *mqttUpgradeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := w.statusRecorder.Hijack()
+	if err == nil {
+		w.onUpgrade()
+	}
+	return conn, rw, err
+}
@@ -0,0 +1,215 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/config"
+	"api-gateway/internal/notify"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMQTTBroker starts a WebSocket echo server speaking the mqtt subprotocol
+func newMQTTBroker(t *testing.T) *httptest.Server {
+	upgrader := websocket.Upgrader{Subprotocols: []string{"mqtt"}}
+	broker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(messageType, message)
+		}
+	}))
+	t.Cleanup(broker.Close)
+	return broker
+}
+
+// newMQTTGateway proxies to broker through the MQTT authorizer
+func newMQTTGateway(t *testing.T, broker *httptest.Server, cfg *config.MQTTConfig, notifier *notify.Notifier) *httptest.Server {
+	target, err := url.Parse(broker.URL)
+	require.NoError(t, err)
+	authorizer := NewMQTTAuthorizer(createTestAuthService(), notifier, &mockLogger{})
+	route := config.Route{Path: "/mqtt", Middlewares: &config.Middlewares{MQTT: cfg}}
+	gateway := httptest.NewServer(authorizer.Authorize(httputil.NewSingleHostReverseProxy(target), route))
+	t.Cleanup(gateway.Close)
+	return gateway
+}
+
+// dialMQTT opens a WebSocket to the gateway offering subprotocol
+func dialMQTT(gateway *httptest.Server, token, subprotocol string) (*websocket.Conn, *http.Response, error) {
+	wsURL := "ws" + strings.TrimPrefix(gateway.URL, "http") + "/mqtt"
+	if token != "" {
+		wsURL += "?token=" + url.QueryEscape(token)
+	}
+	dialer := websocket.Dialer{Subprotocols: []string{subprotocol}, HandshakeTimeout: 2 * time.Second}
+	return dialer.Dial(wsURL, nil)
+}
+
+func createTestDeviceJWT(subject, deviceID string) string {
+	claims := jwt.MapClaims{
+		"sub": subject,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	if deviceID != "" {
+		claims["device_id"] = deviceID
+	}
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret"))
+	return token
+}
+
+func TestMQTTAuthorizerRejectsBadUpgrades(t *testing.T) {
+	broker := newMQTTBroker(t)
+	gateway := newMQTTGateway(t, broker, &config.MQTTConfig{Enabled: true, Subprotocols: []string{"mqtt"}}, nil)
+	token := createTestDeviceJWT("device-1", "")
+
+	t.Run("plain request", func(t *testing.T) {
+		resp, err := http.Get(gateway.URL + "/mqtt?token=" + token)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUpgradeRequired, resp.StatusCode)
+	})
+
+	t.Run("other subprotocol", func(t *testing.T) {
+		_, resp, err := dialMQTT(gateway, token, "graphql-ws")
+		require.Error(t, err)
+		require.NotNil(t, resp)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("no credentials", func(t *testing.T) {
+		_, resp, err := dialMQTT(gateway, "", "mqtt")
+		require.Error(t, err)
+		require.NotNil(t, resp)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		_, resp, err := dialMQTT(gateway, "not-a-token", "mqtt")
+		require.Error(t, err)
+		require.NotNil(t, resp)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+}
+
+func TestMQTTAuthorizerPassesThrough(t *testing.T) {
+	broker := newMQTTBroker(t)
+	gateway := newMQTTGateway(t, broker, &config.MQTTConfig{Enabled: true, Subprotocols: []string{"mqtt"}}, nil)
+
+	conn, resp, err := dialMQTT(gateway, createTestDeviceJWT("device-1", ""), "mqtt")
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, "mqtt", resp.Header.Get("Sec-WebSocket-Protocol"))
+
+	// MQTT CONNECT packets travel as binary frames
+	packet := []byte{0x10, 0x0c, 0x00, 0x04, 'M', 'Q', 'T', 'T', 0x04, 0x02, 0x00, 0x3c, 0x00, 0x00}
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, packet))
+	messageType, echoed, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, websocket.BinaryMessage, messageType)
+	assert.Equal(t, packet, echoed)
+}
+
+func TestMQTTAuthorizerDeviceLimit(t *testing.T) {
+	broker := newMQTTBroker(t)
+	gateway := newMQTTGateway(t, broker, &config.MQTTConfig{
+		Enabled:                 true,
+		Subprotocols:            []string{"mqtt"},
+		MaxConnectionsPerDevice: 1,
+		DeviceClaim:             "device_id",
+	}, nil)
+
+	first, _, err := dialMQTT(gateway, createTestDeviceJWT("user-1", "sensor-1"), "mqtt")
+	require.NoError(t, err)
+
+	// The same device under another subject is still limited
+	_, resp, err := dialMQTT(gateway, createTestDeviceJWT("user-2", "sensor-1"), "mqtt")
+	require.Error(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	// Other devices are unaffected
+	other, _, err := dialMQTT(gateway, createTestDeviceJWT("user-1", "sensor-2"), "mqtt")
+	require.NoError(t, err)
+	other.Close()
+
+	// The slot is freed when the connection closes
+	first.Close()
+	require.Eventually(t, func() bool {
+		conn, _, err := dialMQTT(gateway, createTestDeviceJWT("user-1", "sensor-1"), "mqtt")
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}, 2*time.Second, 20*time.Millisecond)
+}
+
+func TestMQTTAuthorizerEvents(t *testing.T) {
+	var mutex sync.Mutex
+	var events []notify.Event
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event notify.Event
+		json.NewDecoder(r.Body).Decode(&event)
+		mutex.Lock()
+		events = append(events, event)
+		mutex.Unlock()
+	}))
+	defer webhook.Close()
+
+	notifier := notify.New(&config.NotificationsConfig{
+		Enabled:     true,
+		Webhooks:    []config.NotificationWebhook{{URL: webhook.URL}},
+		DedupWindow: 300,
+		TimeoutMs:   1000,
+	}, &mockLogger{})
+	notifier.Start()
+	defer notifier.Stop()
+
+	broker := newMQTTBroker(t)
+	gateway := newMQTTGateway(t, broker, &config.MQTTConfig{Enabled: true, Subprotocols: []string{"mqtt"}}, notifier)
+
+	conn, _, err := dialMQTT(gateway, createTestDeviceJWT("device-1", ""), "mqtt")
+	require.NoError(t, err)
+	conn.Close()
+
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(events) == 2
+	}, 2*time.Second, 20*time.Millisecond)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, config.EventMQTTConnected, events[0].Type)
+	assert.Equal(t, "device-1", events[0].Subject)
+	assert.Equal(t, "/mqtt", events[0].Details["path"])
+	assert.Equal(t, auth.IdentityJWT, events[0].Details["auth_type"])
+	assert.Equal(t, config.EventMQTTDisconnected, events[1].Type)
+	assert.Equal(t, "device-1", events[1].Subject)
+}
+
+func TestMQTTDevice(t *testing.T) {
+	identity := &auth.Identity{Subject: "user-1", Claims: map[string]interface{}{"device": map[string]interface{}{"id": "sensor-9"}}}
+
+	assert.Equal(t, "user-1", mqttDevice(identity, ""))
+	assert.Equal(t, "sensor-9", mqttDevice(identity, "device.id"))
+	assert.Equal(t, "user-1", mqttDevice(identity, "missing"))
+}
@@ -0,0 +1,380 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/config"
+	"api-gateway/internal/util"
+	"api-gateway/pkg/logger"
+
+	"github.com/open-policy-agent/opa/v1/bundle"
+	"github.com/open-policy-agent/opa/v1/loader"
+	"github.com/open-policy-agent/opa/v1/rego"
+)
+
+// OPAInput is the request context policies are evaluated against
+type OPAInput struct {
+	Method   string                 `json:"method"`
+	Path     string                 `json:"path"`
+	Segments []string               `json:"segments"`
+	Query    map[string][]string    `json:"query"`
+	Host     string                 `json:"host"`
+	Headers  map[string]string      `json:"headers"`
+	ClientIP string                 `json:"client_ip"`
+	Identity *auth.Identity         `json:"identity,omitempty"`
+	Claims   map[string]interface{} `json:"claims,omitempty"`
+}
+
+// OPADecision is the object form of a policy result. A policy may also return a
+// plain boolean.
+type OPADecision struct {
+	Allow         bool              `json:"allow"`
+	Status        int               `json:"status"`
+	Reason        string            `json:"reason"`
+	Headers       map[string]string `json:"headers"`
+	RemoveHeaders []string          `json:"remove_headers"`
+}
+
+// maxBundleSize bounds the bundles downloaded from bundle servers
+const maxBundleSize = 64 << 20
+
+// OPAMiddleware enforces Rego policies evaluated by an embedded OPA engine.
+// Policies come from bundles on disk or downloaded from bundle servers,
+// which are polled for new versions.
+type OPAMiddleware struct {
+	config   *config.OPAEngineConfig
+	client   *http.Client
+	log      logger.Logger
+	policies atomic.Pointer[opaPolicies]
+
+	mutex   sync.Mutex
+	bundles map[string]*bundle.Bundle // Loaded bundles by name
+	etags   map[string]string         // ETags of the downloaded bundles
+	used    map[string]bool           // Policies routes evaluate
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// opaPolicies are the queries of the policies in a set of bundles, prepared
+// when first evaluated
+type opaPolicies struct {
+	bundles map[string]*bundle.Bundle
+	mutex   sync.Mutex
+	queries map[string]*opaQuery
+}
+
+// opaQuery is a prepared policy query, or the error preparing it
+type opaQuery struct {
+	query rego.PreparedEvalQuery
+	err   error
+}
+
+// NewOPAMiddleware creates a new OPA policy middleware. Start loads the bundles.
+func NewOPAMiddleware(cfg *config.OPAEngineConfig, log logger.Logger) *OPAMiddleware {
+	return &OPAMiddleware{
+		config:  cfg,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		log:     log,
+		bundles: make(map[string]*bundle.Bundle),
+		etags:   make(map[string]string),
+		used:    make(map[string]bool),
+		stop:    make(chan struct{}),
+	}
+}
+
+// Start loads the bundles and polls the bundle servers for new versions.
+// Policies are evaluated once every bundle has loaded; until then requests
+// are handled as if the engine were unavailable.
+func (m *OPAMiddleware) Start() {
+	for _, source := range m.config.Bundles {
+		m.load(source)
+		if source.URL != "" {
+			m.wg.Add(1)
+			go m.poll(source)
+		}
+	}
+}
+
+// Stop stops polling the bundle servers
+func (m *OPAMiddleware) Stop() {
+	close(m.stop)
+	m.wg.Wait()
+}
+
+// poll downloads a bundle again every poll interval
+func (m *OPAMiddleware) poll(source config.OPABundleConfig) {
+	defer m.wg.Done()
+	ticker := time.NewTicker(time.Duration(source.PollInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.load(source)
+		}
+	}
+}
+
+// load reads or downloads a bundle and activates it, keeping the previous
+// version if it can't be loaded
+func (m *OPAMiddleware) load(source config.OPABundleConfig) {
+	var b *bundle.Bundle
+	var err error
+	if source.URL != "" {
+		b, err = m.download(source)
+	} else {
+		b, err = loader.NewFileLoader().AsBundle(source.Path)
+	}
+	if err != nil {
+		opaBundleLoads.WithLabelValues(source.Name, "failed").Inc()
+		m.log.Error("Failed to load policy bundle",
+			logger.String("bundle", source.Name),
+			logger.Error(err),
+		)
+		return
+	}
+	if b == nil {
+		// The bundle server has no new version
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	previous := m.bundles[source.Name]
+	m.bundles[source.Name] = b
+	if err := m.activate(); err != nil {
+		if previous != nil {
+			m.bundles[source.Name] = previous
+		} else {
+			delete(m.bundles, source.Name)
+		}
+		delete(m.etags, source.Name)
+		opaBundleLoads.WithLabelValues(source.Name, "failed").Inc()
+		m.log.Error("Failed to compile policy bundle, keeping the previous version",
+			logger.String("bundle", source.Name),
+			logger.Error(err),
+		)
+		return
+	}
+	opaBundleLoads.WithLabelValues(source.Name, "loaded").Inc()
+	m.log.Info("Loaded policy bundle",
+		logger.String("bundle", source.Name),
+		logger.String("revision", b.Manifest.Revision),
+	)
+}
+
+// download fetches a bundle from its bundle server, returning nil if it
+// hasn't changed since the last download
+func (m *OPAMiddleware) download(source config.OPABundleConfig) (*bundle.Bundle, error) {
+	req, err := http.NewRequest(http.MethodGet, source.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	m.mutex.Lock()
+	if etag := m.etags[source.Name]; etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	m.mutex.Unlock()
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("bundle server returned status %d", resp.StatusCode)
+	}
+
+	b, err := bundle.NewReader(io.LimitReader(resp.Body, maxBundleSize)).Read()
+	if err != nil {
+		return nil, err
+	}
+	m.mutex.Lock()
+	m.etags[source.Name] = resp.Header.Get("ETag")
+	m.mutex.Unlock()
+	return &b, nil
+}
+
+// activate prepares the policies routes use from the loaded bundles, and
+// evaluates them from then on. Nothing is evaluated until every bundle has
+// loaded. The caller holds the mutex.
+func (m *OPAMiddleware) activate() error {
+	if len(m.bundles) < len(m.config.Bundles) {
+		return nil
+	}
+
+	bundles := make(map[string]*bundle.Bundle, len(m.bundles))
+	for name, b := range m.bundles {
+		bundles[name] = b
+	}
+	policies := &opaPolicies{bundles: bundles, queries: make(map[string]*opaQuery)}
+	for policy := range m.used {
+		if _, err := policies.prepare(policy); err != nil {
+			return fmt.Errorf("policy %s: %w", policy, err)
+		}
+	}
+	m.policies.Store(policies)
+	return nil
+}
+
+// prepare returns the query of a policy, preparing it on first use
+func (p *opaPolicies) prepare(policy string) (rego.PreparedEvalQuery, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if prepared, ok := p.queries[policy]; ok {
+		return prepared.query, prepared.err
+	}
+
+	options := []func(*rego.Rego){rego.Query(policyRef(policy))}
+	for name, b := range p.bundles {
+		options = append(options, rego.ParsedBundle(name, b))
+	}
+	query, err := rego.New(options...).PrepareForEval(context.Background())
+	p.queries[policy] = &opaQuery{query: query, err: err}
+	return query, err
+}
+
+// policyRef returns the reference to a policy under data, given with dots or
+// slashes
+func policyRef(policy string) string {
+	return "data." + strings.Trim(strings.ReplaceAll(policy, "/", "."), ".")
+}
+
+// Enforce evaluates the route policy for each request, rejecting denied requests
+// and applying the header changes of allowed ones
+func (m *OPAMiddleware) Enforce(next http.Handler, cfg *config.OPAConfig) http.Handler {
+	if cfg == nil || !cfg.Enabled {
+		return next
+	}
+
+	m.mutex.Lock()
+	m.used[cfg.Policy] = true
+	m.mutex.Unlock()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decision, err := m.evaluate(r.Context(), cfg, m.buildInput(r))
+		if err != nil {
+			m.log.Warn("Policy evaluation failed",
+				logger.String("path", r.URL.Path),
+				logger.String("policy", cfg.Policy),
+				logger.Bool("fail_open", cfg.FailOpen),
+				logger.String("reason", err.Error()),
+			)
+			if !cfg.FailOpen {
+				safeError(w, "Policy evaluation unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !decision.Allow {
+			m.log.Debug("Request denied by policy",
+				logger.String("path", r.URL.Path),
+				logger.String("policy", cfg.Policy),
+				logger.String("reason", decision.Reason),
+			)
+			status := decision.Status
+			if status < 400 || status > 599 {
+				status = http.StatusForbidden
+			}
+			message := decision.Reason
+			if message == "" {
+				message = "Forbidden by policy"
+			}
+			safeError(w, message, status)
+			return
+		}
+
+		for _, name := range decision.RemoveHeaders {
+			r.Header.Del(name)
+		}
+		for name, value := range decision.Headers {
+			r.Header.Set(name, value)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// buildInput describes the request for policy evaluation
+func (m *OPAMiddleware) buildInput(r *http.Request) *OPAInput {
+	input := &OPAInput{
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Segments: strings.Split(strings.Trim(r.URL.Path, "/"), "/"),
+		Query:    r.URL.Query(),
+		Host:     r.Host,
+		Headers:  requestHeaderMap(r, nil),
+		ClientIP: util.GetClientIP(r),
+		Identity: auth.IdentityFromContext(r.Context()),
+	}
+	if input.Identity != nil {
+		input.Claims = input.Identity.Claims
+	}
+	return input
+}
+
+// evaluate evaluates the route policy against the request
+func (m *OPAMiddleware) evaluate(ctx context.Context, cfg *config.OPAConfig, input *OPAInput) (*OPADecision, error) {
+	policies := m.policies.Load()
+	if policies == nil {
+		return nil, errors.New("policy bundles not loaded")
+	}
+	query, err := policies.prepare(cfg.Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.TimeoutMs)*time.Millisecond)
+	defer cancel()
+
+	results, err := query.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 || len(results[0].Expressions) == 0 {
+		return parseOPAResult(nil)
+	}
+
+	result, err := json.Marshal(results[0].Expressions[0].Value)
+	if err != nil {
+		return nil, err
+	}
+	return parseOPAResult(result)
+}
+
+// parseOPAResult interprets a boolean or object policy result. An undefined
+// result denies the request.
+func parseOPAResult(raw json.RawMessage) (*OPADecision, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return &OPADecision{Allow: false, Reason: "Policy decision undefined"}, nil
+	}
+
+	var allow bool
+	if err := json.Unmarshal(raw, &allow); err == nil {
+		return &OPADecision{Allow: allow}, nil
+	}
+
+	var decision OPADecision
+	if err := json.Unmarshal(raw, &decision); err != nil {
+		return nil, fmt.Errorf("unsupported policy result: %s", raw)
+	}
+	return &decision, nil
+}
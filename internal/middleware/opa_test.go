@@ -0,0 +1,213 @@
+package middleware
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const gatewayPolicy = `package gateway
+
+default authz := {"allow": false, "status": 401, "reason": "tenant required"}
+
+authz := {"allow": true, "headers": {"X-Tenant": "acme"}, "remove_headers": ["X-Debug"]} if {
+	input.claims.tenant == "acme"
+}
+
+boolean := input.headers["x-policy"] == "boolean"
+
+echo := {"allow": true, "headers": {
+	"X-Method": input.method,
+	"X-Segment": input.segments[0],
+	"X-Force": input.query.force[0],
+	"X-Client": input.client_ip,
+	"X-Subject": input.identity.subject,
+}}
+`
+
+// writePolicyBundle writes a bundle directory holding policy
+func writePolicyBundle(t *testing.T, policy string) string {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "policy.rego"), []byte(policy), 0644))
+	return dir
+}
+
+// policyTarball returns a bundle .tar.gz holding policy
+func policyTarball(t *testing.T, policy string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "/policy.rego", Mode: 0644, Size: int64(len(policy))}))
+	_, err := tw.Write([]byte(policy))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+// newTestOPA starts an engine with a bundle directory holding policy
+func newTestOPA(t *testing.T, policy string) *OPAMiddleware {
+	m := NewOPAMiddleware(&config.OPAEngineConfig{Bundles: []config.OPABundleConfig{
+		{Name: "gateway", Path: writePolicyBundle(t, policy)},
+	}}, &mockLogger{})
+	m.Start()
+	t.Cleanup(m.Stop)
+	return m
+}
+
+func TestOPAMiddleware(t *testing.T) {
+	var upstreamHeaders http.Header
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHeaders = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	})
+
+	m := newTestOPA(t, gatewayPolicy)
+	enforce := func(policy string) http.Handler {
+		return m.Enforce(upstream, &config.OPAConfig{Enabled: true, Policy: policy, TimeoutMs: 1000})
+	}
+
+	send := func(handler http.Handler, tenant, policy string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/projects/7?force=true", nil)
+		req.RemoteAddr = "10.1.2.3:5555"
+		req.Header.Set("X-Debug", "1")
+		if policy != "" {
+			req.Header.Set("X-Policy", policy)
+		}
+		if tenant != "" {
+			req = req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{
+				Type:    auth.IdentityJWT,
+				Subject: "alice",
+				Claims:  map[string]interface{}{"tenant": tenant},
+			}))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("allow with header mutation", func(t *testing.T) {
+		rec := send(enforce("gateway.authz"), "acme", "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "acme", upstreamHeaders.Get("X-Tenant"))
+		assert.Empty(t, upstreamHeaders.Get("X-Debug"))
+	})
+
+	t.Run("request input", func(t *testing.T) {
+		rec := send(enforce("gateway/echo"), "acme", "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, http.MethodDelete, upstreamHeaders.Get("X-Method"))
+		assert.Equal(t, "projects", upstreamHeaders.Get("X-Segment"))
+		assert.Equal(t, "true", upstreamHeaders.Get("X-Force"))
+		assert.Equal(t, "10.1.2.3", upstreamHeaders.Get("X-Client"))
+		assert.Equal(t, "alice", upstreamHeaders.Get("X-Subject"))
+	})
+
+	t.Run("deny with status and reason", func(t *testing.T) {
+		rec := send(enforce("gateway.authz"), "globex", "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, "tenant required", rec.Body.String())
+	})
+
+	t.Run("boolean result", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send(enforce("gateway.boolean"), "", "boolean").Code)
+		assert.Equal(t, http.StatusForbidden, send(enforce("gateway.boolean"), "", "").Code)
+	})
+
+	t.Run("undefined result denies", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, send(enforce("gateway.missing"), "acme", "").Code)
+	})
+
+	t.Run("failure policy", func(t *testing.T) {
+		// Without its bundles loaded the engine can't evaluate policies
+		unloaded := NewOPAMiddleware(&config.OPAEngineConfig{Bundles: []config.OPABundleConfig{
+			{Name: "gateway", Path: filepath.Join(t.TempDir(), "missing")},
+		}}, &mockLogger{})
+		unloaded.Start()
+		defer unloaded.Stop()
+
+		cfg := &config.OPAConfig{Enabled: true, Policy: "gateway.authz", TimeoutMs: 1000}
+		assert.Equal(t, http.StatusServiceUnavailable, send(unloaded.Enforce(upstream, cfg), "acme", "").Code)
+
+		cfg.FailOpen = true
+		assert.Equal(t, http.StatusOK, send(unloaded.Enforce(upstream, cfg), "acme", "").Code)
+	})
+}
+
+func TestOPABundleServer(t *testing.T) {
+	var version atomic.Value
+	version.Store("1")
+	var downloads int32
+	bundleServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&downloads, 1)
+		v := version.Load().(string)
+		if r.Header.Get("If-None-Match") == v {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", v)
+		policy := "package gateway\n\nallow := false\n"
+		if v == "2" {
+			policy = "package gateway\n\nallow := true\n"
+		}
+		if v == "broken" {
+			policy = "package gateway\n\nallow := \n"
+		}
+		w.Write(policyTarball(t, policy))
+	}))
+	defer bundleServer.Close()
+
+	source := config.OPABundleConfig{Name: "gateway", URL: bundleServer.URL + "/bundle.tar.gz", PollInterval: 60}
+	m := NewOPAMiddleware(&config.OPAEngineConfig{Bundles: []config.OPABundleConfig{source}}, &mockLogger{})
+	handler := m.Enforce(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), &config.OPAConfig{Enabled: true, Policy: "gateway.allow", TimeoutMs: 1000})
+	m.Start()
+	defer m.Stop()
+
+	status := func() int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusForbidden, status())
+
+	// Unchanged bundles aren't loaded again
+	m.load(source)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&downloads))
+	assert.Equal(t, http.StatusForbidden, status())
+
+	version.Store("2")
+	m.load(source)
+	assert.Equal(t, http.StatusOK, status())
+
+	// A bundle that doesn't compile leaves the previous version in place
+	version.Store("broken")
+	m.load(source)
+	assert.Equal(t, http.StatusOK, status())
+}
+
+func TestParseOPAResult(t *testing.T) {
+	decision, err := parseOPAResult(json.RawMessage(`false`))
+	require.NoError(t, err)
+	assert.False(t, decision.Allow)
+
+	decision, err = parseOPAResult(json.RawMessage(`{"allow": true, "headers": {"X-Role": "admin"}}`))
+	require.NoError(t, err)
+	assert.True(t, decision.Allow)
+	assert.Equal(t, "admin", decision.Headers["X-Role"])
+
+	_, err = parseOPAResult(json.RawMessage(`"yes"`))
+	assert.Error(t, err)
+}
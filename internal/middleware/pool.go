@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// maxPooledBufferSize is the largest buffer kept for reuse. Larger ones are
+// left to the garbage collector so a few big responses don't pin memory.
+const maxPooledBufferSize = 1 << 20
+
+var (
+	// bufferPool holds response body buffers of the retry and cache writers
+	bufferPool = sync.Pool{
+		New: func() any { return new(bytes.Buffer) },
+	}
+
+	// bufferedResponsePool holds retry attempt responses with their header maps
+	bufferedResponsePool = sync.Pool{
+		New: func() any { return &bufferedResponse{header: make(http.Header, 8)} },
+	}
+
+	// gzipPool and brotliPool hold compressors, which are costly to set up
+	gzipPool = sync.Pool{
+		New: func() any { return gzip.NewWriter(io.Discard) },
+	}
+	brotliPool = sync.Pool{
+		New: func() any { return brotli.NewWriterLevel(io.Discard, brotli.DefaultCompression) },
+	}
+)
+
+// getBuffer returns an empty buffer from the pool
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// putBuffer returns buf to the pool. Nothing may use it afterwards.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// getEncoder returns a pooled writer compressing into w
+func getEncoder(encoding string, w io.Writer) encoder {
+	if encoding == "br" {
+		enc := brotliPool.Get().(*brotli.Writer)
+		enc.Reset(w)
+		return enc
+	}
+	enc := gzipPool.Get().(*gzip.Writer)
+	enc.Reset(w)
+	return enc
+}
+
+// putEncoder returns a closed encoder to its pool
+func putEncoder(enc encoder) {
+	switch enc := enc.(type) {
+	case *gzip.Writer:
+		enc.Reset(io.Discard)
+		gzipPool.Put(enc)
+	case *brotli.Writer:
+		enc.Reset(io.Discard)
+		brotliPool.Put(enc)
+	}
+}
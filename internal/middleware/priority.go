@@ -0,0 +1,200 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// Outcomes of scheduled requests in the gateway_priority_requests_total metric
+const (
+	priorityAdmitted = "admitted" // Proxied without waiting
+	priorityQueued   = "queued"   // Proxied after waiting for a slot
+	priorityShed     = "shed"     // Rejected with a 503
+)
+
+// PriorityScheduler orders a route's requests by their RFC 9218 Priority
+// header, letting the most urgent through first when the route is at its
+// concurrency limit and shedding the least urgent
+type PriorityScheduler struct {
+	log logger.Logger
+}
+
+// NewPriorityScheduler creates a new request priority middleware
+func NewPriorityScheduler(log logger.Logger) *PriorityScheduler {
+	return &PriorityScheduler{
+		log: log,
+	}
+}
+
+// Schedule admits the route's requests by priority and forwards the
+// priority upstream, setting the route's default on unlabelled requests
+func (p *PriorityScheduler) Schedule(next http.Handler, route config.Route) http.Handler {
+	cfg := route.Middlewares.Priority
+	if cfg == nil || !cfg.Enabled {
+		return next
+	}
+	defaultPriority := cfg.DefaultPriority()
+	timeout := time.Duration(cfg.QueueTimeoutMs) * time.Millisecond
+
+	var gate *priorityGate
+	if cfg.MaxConcurrent > 0 {
+		gate = newPriorityGate(cfg.MaxConcurrent, cfg.MaxQueue)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		priority := defaultPriority
+		if value := r.Header.Get("Priority"); value != "" {
+			// Invalid parameters keep the RFC 9218 defaults
+			priority, _ = config.ParsePriority(value)
+			if priority.Urgency < cfg.MinUrgency {
+				priority.Urgency = cfg.MinUrgency
+				r.Header.Set("Priority", priority.String())
+			}
+		} else if cfg.Default != "" {
+			r.Header.Set("Priority", priority.String())
+		}
+
+		if gate == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		urgency := strconv.Itoa(priority.Urgency)
+		result := gate.acquire(r.Context(), priority.Urgency, timeout)
+		priorityRequests.WithLabelValues(route.Path, urgency, result).Inc()
+		if result == priorityShed {
+			p.log.Debug("Shed request",
+				logger.String("path", r.URL.Path),
+				logger.String("route", route.Path),
+				logger.Int("urgency", priority.Urgency),
+			)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		defer gate.release()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// priorityGate limits concurrent requests, queueing the ones beyond the
+// limit by urgency
+type priorityGate struct {
+	mutex    sync.Mutex
+	active   int
+	limit    int
+	maxQueue int
+	queued   int
+	waiting  [config.MaxUrgency + 1][]*priorityWaiter // FIFO per urgency
+}
+
+// priorityWaiter is a queued request. Its channel is closed once it is
+// granted a slot or shed.
+type priorityWaiter struct {
+	ready chan struct{}
+	done  bool
+	shed  bool
+}
+
+// newPriorityGate creates a gate admitting limit requests at once with up
+// to maxQueue waiting
+func newPriorityGate(limit, maxQueue int) *priorityGate {
+	return &priorityGate{
+		limit:    limit,
+		maxQueue: maxQueue,
+	}
+}
+
+// acquire waits for a slot and returns whether the request was admitted at
+// once, after queueing or shed. A full queue sheds its least urgent request,
+// which may be the arriving one.
+func (g *priorityGate) acquire(ctx context.Context, urgency int, timeout time.Duration) string {
+	g.mutex.Lock()
+	if g.active < g.limit && g.queued == 0 {
+		g.active++
+		g.mutex.Unlock()
+		return priorityAdmitted
+	}
+	if g.queued >= g.maxQueue {
+		least := g.leastUrgent()
+		if least <= urgency {
+			g.mutex.Unlock()
+			return priorityShed
+		}
+		evicted := g.waiting[least][len(g.waiting[least])-1]
+		g.waiting[least] = g.waiting[least][:len(g.waiting[least])-1]
+		g.queued--
+		evicted.done, evicted.shed = true, true
+		close(evicted.ready)
+	}
+	waiter := &priorityWaiter{ready: make(chan struct{})}
+	g.waiting[urgency] = append(g.waiting[urgency], waiter)
+	g.queued++
+	g.mutex.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-waiter.ready:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if !waiter.done {
+		// Gave up waiting
+		g.remove(urgency, waiter)
+		return priorityShed
+	}
+	if waiter.shed {
+		return priorityShed
+	}
+	return priorityQueued
+}
+
+// release frees a slot, handing it to the most urgent waiting request
+func (g *priorityGate) release() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	for urgency := range g.waiting {
+		if len(g.waiting[urgency]) == 0 {
+			continue
+		}
+		waiter := g.waiting[urgency][0]
+		g.waiting[urgency] = g.waiting[urgency][1:]
+		g.queued--
+		waiter.done = true
+		close(waiter.ready)
+		return
+	}
+	g.active--
+}
+
+// leastUrgent returns the least urgent urgency with waiting requests, or -1
+func (g *priorityGate) leastUrgent() int {
+	for urgency := len(g.waiting) - 1; urgency >= 0; urgency-- {
+		if len(g.waiting[urgency]) > 0 {
+			return urgency
+		}
+	}
+	return -1
+}
+
+// remove takes a request that gave up out of the queue
+func (g *priorityGate) remove(urgency int, waiter *priorityWaiter) {
+	for i, queued := range g.waiting[urgency] {
+		if queued == waiter {
+			g.waiting[urgency] = append(g.waiting[urgency][:i], g.waiting[urgency][i+1:]...)
+			g.queued--
+			return
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// queuedCount returns the number of requests waiting at the gate
+func (g *priorityGate) queuedCount() int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.queued
+}
+
+func TestPrioritySchedulerForwardsPriority(t *testing.T) {
+	route := config.Route{Path: "/reports", Middlewares: &config.Middlewares{Priority: &config.RequestPriority{
+		Enabled:    true,
+		Default:    "u=5",
+		MinUrgency: 2,
+	}}}
+	var forwarded string
+	handler := NewPriorityScheduler(&mockLogger{}).Schedule(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get("Priority")
+	}), route)
+
+	for sent, expected := range map[string]string{
+		"":         "u=5",     // The route default labels the request
+		"u=4, i":   "u=4, i",  // Client priorities pass unchanged
+		"u=0":      "u=2",     // More urgent than allowed
+		"u=9, i":   "u=9, i",  // Invalid but harmless for the upstream
+		"u=1;x, i": "u=2, i",  // Lowered, keeping incremental
+		"foo=bar":  "foo=bar", // Unknown parameters are ignored
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/reports", nil)
+		if sent != "" {
+			req.Header.Set("Priority", sent)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, expected, forwarded, sent)
+	}
+}
+
+func TestPriorityGateOrdersByUrgency(t *testing.T) {
+	gate := newPriorityGate(1, 10)
+	require.Equal(t, priorityAdmitted, gate.acquire(context.Background(), 3, time.Second))
+
+	var mutex sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i, urgency := range []int{5, 1, 3, 1} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, priorityQueued, gate.acquire(context.Background(), urgency, 5*time.Second))
+			mutex.Lock()
+			order = append(order, urgency)
+			mutex.Unlock()
+			gate.release()
+		}()
+		require.Eventually(t, func() bool { return gate.queuedCount() == i+1 }, time.Second, time.Millisecond)
+	}
+
+	gate.release()
+	wg.Wait()
+	assert.Equal(t, []int{1, 1, 3, 5}, order)
+	assert.Equal(t, 0, gate.active)
+}
+
+func TestPriorityGateSheds(t *testing.T) {
+	gate := newPriorityGate(1, 2)
+	require.Equal(t, priorityAdmitted, gate.acquire(context.Background(), 3, time.Second))
+
+	results := map[int]chan string{6: make(chan string, 1), 4: make(chan string, 1), 2: make(chan string, 1)}
+	for i, urgency := range []int{6, 4} {
+		go func() { results[urgency] <- gate.acquire(context.Background(), urgency, 5*time.Second) }()
+		require.Eventually(t, func() bool { return gate.queuedCount() == i+1 }, time.Second, time.Millisecond)
+	}
+
+	// A full queue sheds arrivals no more urgent than its least urgent request
+	assert.Equal(t, priorityShed, gate.acquire(context.Background(), 6, time.Second))
+
+	// More urgent arrivals take the place of the least urgent request
+	go func() { results[2] <- gate.acquire(context.Background(), 2, 5*time.Second) }()
+	assert.Equal(t, priorityShed, <-results[6])
+
+	gate.release()
+	assert.Equal(t, priorityQueued, <-results[2])
+	gate.release()
+	assert.Equal(t, priorityQueued, <-results[4])
+	gate.release()
+
+	// Requests waiting too long give up
+	assert.Equal(t, priorityAdmitted, gate.acquire(context.Background(), 3, time.Second))
+	assert.Equal(t, priorityShed, gate.acquire(context.Background(), 0, 10*time.Millisecond))
+	assert.Equal(t, 0, gate.queuedCount())
+}
+
+func TestPrioritySchedulerRejectsShedRequests(t *testing.T) {
+	route := config.Route{Path: "/busy", Middlewares: &config.Middlewares{Priority: &config.RequestPriority{
+		Enabled:        true,
+		MaxConcurrent:  1,
+		MaxQueue:       1,
+		QueueTimeoutMs: 10,
+	}}}
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := NewPriorityScheduler(&mockLogger{}).Schedule(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Block") != "" {
+			close(started)
+			<-release
+		}
+	}), route)
+
+	go func() {
+		req := httptest.NewRequest(http.MethodGet, "/busy", nil)
+		req.Header.Set("X-Block", "1")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	<-started
+
+	shed := testutil.ToFloat64(priorityRequests.WithLabelValues("/busy", "3", priorityShed))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/busy", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	assert.Equal(t, shed+1, testutil.ToFloat64(priorityRequests.WithLabelValues("/busy", "3", priorityShed)))
+	close(release)
+}
@@ -2,13 +2,17 @@ package middleware
 
 import (
 	"fmt"
+	"math"
 	"net"
 	"net/http"
+	"net/netip"
 	"strings"
 	"sync"
 	"time"
 
+	"api-gateway/internal/auth"
 	"api-gateway/internal/config"
+	"api-gateway/internal/util"
 	"api-gateway/pkg/logger"
 )
 
@@ -17,35 +21,76 @@ type RateLimiter struct {
 	limits       map[string]config.RateLimitConfig
 	buckets      map[string]map[string]*tokenBucket
 	bucketsMutex sync.RWMutex
+	apiKeyHeader string
 	log          logger.Logger
 }
 
-// tokenBucket implements the token bucket algorithm for rate limiting
+// tokenBucket holds a client's rate limit state. It implements the token
+// bucket algorithm, and the other algorithms when one is configured.
 type tokenBucket struct {
 	tokens         float64
 	maxTokens      float64
 	refillRate     float64
 	lastRefillTime time.Time
 	mutex          sync.Mutex
+
+	algorithm   string
+	limit       int           // Requests per window for the window algorithms
+	window      time.Duration // Length of the limit's period
+	windowStart time.Time     // Start of the current fixed window
+	count       int           // Requests in the current fixed window
+	log         []time.Time   // Times of the requests in the sliding window
 }
 
 // NewRateLimiter creates a new rate limiting middleware
 func NewRateLimiter(log logger.Logger) *RateLimiter {
 	return &RateLimiter{
-		limits:  make(map[string]config.RateLimitConfig),
-		buckets: make(map[string]map[string]*tokenBucket),
-		log:     log,
+		limits:       make(map[string]config.RateLimitConfig),
+		buckets:      make(map[string]map[string]*tokenBucket),
+		apiKeyHeader: "X-API-Key",
+		log:          log,
+	}
+}
+
+// SetAPIKeyHeader sets the header clients send their API key in
+func (rl *RateLimiter) SetAPIKeyHeader(header string) {
+	rl.apiKeyHeader = header
+}
+
+// RateLimitKey returns the key of a route's buckets: the named limit it
+// references, shared with other routes, or its own path
+func RateLimitKey(route config.Route) string {
+	if route.Middlewares.RateLimitRef != "" {
+		return "ref:" + route.Middlewares.RateLimitRef
 	}
+	return route.Path
+}
+
+// methodRateLimitKey returns the key of the buckets of a method with its own
+// limit
+func methodRateLimitKey(key, method string) string {
+	return key + " " + strings.ToUpper(method)
 }
 
-// AddLimit adds a rate limit for a specific path
+// AddLimit adds a rate limit for a specific path or key, with separate
+// buckets for methods with their own limit. Adding a key again keeps its
+// limit and buckets.
 func (rl *RateLimiter) AddLimit(path string, limit config.RateLimitConfig) {
+	if _, exists := rl.limits[path]; exists {
+		return
+	}
 	rl.limits[path] = limit
 	rl.buckets[path] = make(map[string]*tokenBucket)
+	for method := range limit.Methods {
+		methodLimit, _ := limit.ForMethod(method)
+		rl.limits[methodRateLimitKey(path, method)] = methodLimit
+		rl.buckets[methodRateLimitKey(path, method)] = make(map[string]*tokenBucket)
+	}
 	rl.log.Info("Rate limit added",
 		logger.String("path", path),
 		logger.Int("requests", limit.Requests),
-		logger.String("period", limit.Period))
+		logger.String("period", limit.Period),
+		logger.Int("method_limits", len(limit.Methods)))
 }
 
 // getBucket gets or creates a token bucket for a client
@@ -89,25 +134,29 @@ func (rl *RateLimiter) getBucket(path, clientID string) *tokenBucket {
 		}
 	} else {
 		// Calculate tokens per second based on the limit
-		var tokensPerSecond float64
-		switch limit.Period {
-		case "second":
-			tokensPerSecond = float64(limit.Requests)
-		case "minute":
-			tokensPerSecond = float64(limit.Requests) / 60
-		case "hour":
-			tokensPerSecond = float64(limit.Requests) / 3600
-		case "day":
-			tokensPerSecond = float64(limit.Requests) / 86400
-		default:
-			tokensPerSecond = float64(limit.Requests) / 60 // Default to minute
-		}
+		period := rateLimitPeriod(limit.Period)
+		tokensPerSecond := float64(limit.Requests) / period.Seconds()
 
 		bucket = &tokenBucket{
 			tokens:         float64(limit.Requests),
 			maxTokens:      float64(limit.Requests),
 			refillRate:     tokensPerSecond,
 			lastRefillTime: time.Now(),
+			algorithm:      limit.Algorithm,
+			limit:          limit.Requests,
+			window:         period,
+		}
+		if limit.SpikeArrest {
+			// Allow at most one second's share at once, refilled as before
+			bucket.maxTokens = math.Max(1, math.Floor(tokensPerSecond))
+			bucket.tokens = bucket.maxTokens
+		}
+		if limit.Algorithm == config.RateLimitLeakyBucket {
+			// The bucket fills with queued requests and leaks at the limit's rate
+			bucket.tokens = 0
+			if limit.QueueSize > 0 {
+				bucket.maxTokens = float64(limit.QueueSize)
+			}
 		}
 
 		rl.log.Debug("New rate limit bucket created",
@@ -148,27 +197,70 @@ func (rl *RateLimiter) getClientIP(r *http.Request) string {
 	return ip
 }
 
-// RateLimit middleware applies rate limiting to requests
+// clientID returns the identifier of the client's buckets. Keys by the
+// authenticated identity are prefixed so they can't collide with IPs or
+// API keys.
+func (rl *RateLimiter) clientID(r *http.Request, keyBy string) string {
+	identity := auth.IdentityFromContext(r.Context())
+	switch keyBy {
+	case config.RateLimitKeyIP:
+		return rl.getClientIP(r)
+	case config.RateLimitKeySubject:
+		if identity != nil && identity.Subject != "" {
+			return "subject:" + identity.Subject
+		}
+	case config.RateLimitKeyTenant:
+		if identity != nil && identity.Tenant != "" {
+			return "tenant:" + identity.Tenant
+		}
+	}
+
+	// Use the API key or auth token if available for per-user rate limiting,
+	// else the IP
+	if apiKey := r.Header.Get(rl.apiKeyHeader); apiKey != "" {
+		return apiKey
+	}
+	if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+		return authHeader
+	}
+	return rl.getClientIP(r)
+}
+
+// RateLimit middleware applies rate limiting to requests. Exempt callers
+// pass without counting towards the limit.
 func (rl *RateLimiter) RateLimit(next http.Handler, route config.Route) http.Handler {
+	var exemptions *rateLimitExemptions
+	if route.Middlewares.RateLimit != nil {
+		var err error
+		exemptions, err = newRateLimitExemptions(&route.Middlewares.RateLimit.Exempt, rl.apiKeyHeader)
+		if err != nil {
+			rl.log.Error("Invalid rate limit exemptions, exempting no address ranges",
+				logger.String("path", route.Path),
+				logger.Error(err),
+			)
+		}
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Skip rate limiting if not configured for this route
-		if route.Middlewares.RateLimit == nil || route.Middlewares.RateLimit.Requests == 0 {
+		// Skip rate limiting if not configured for this route, and for test
+		// traffic sent to the sandbox, which doesn't count towards clients'
+		// limits. Test traffic reaching the production upstream is limited.
+		if route.Middlewares.RateLimit == nil || route.Middlewares.RateLimit.Requests == 0 || IsSandboxed(r, route) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if reason := exemptions.match(r); reason != "" {
+			rateLimitExempted.WithLabelValues(route.Path, reason).Inc()
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		// Get a unique identifier for this client
-		// In addition to IP, we can use API key or auth info if available
-		clientID := rl.getClientIP(r)
+		clientID := rl.clientID(r, route.Middlewares.RateLimit.KeyBy)
 
-		// Add auth information if available for per-user rate limiting
-		if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
-			clientID = apiKey // Use API key as identifier if present
-		} else if authHeader := r.Header.Get("Authorization"); authHeader != "" {
-			clientID = authHeader // Use auth token as identifier
+		pathKey := RateLimitKey(route)
+		if _, ok := route.Middlewares.RateLimit.ForMethod(r.Method); ok {
+			pathKey = methodRateLimitKey(pathKey, r.Method)
 		}
-
-		pathKey := route.Path
 		rl.log.Debug("Rate limit check",
 			logger.String("path", r.URL.Path),
 			logger.String("pathKey", pathKey),
@@ -183,8 +275,16 @@ func (rl *RateLimiter) RateLimit(next http.Handler, route config.Route) http.Han
 			return
 		}
 
-		// Try to consume a token
-		if allowed := rl.tryConsume(bucket); !allowed {
+		// Leaky buckets queue requests to leave at the limit's rate instead of
+		// letting them through in bursts
+		var delay time.Duration
+		var allowed bool
+		if bucket.algorithm == config.RateLimitLeakyBucket {
+			delay, allowed = rl.reserve(bucket)
+		} else {
+			allowed = rl.tryConsume(bucket)
+		}
+		if !allowed {
 			rl.log.Info("Rate limit exceeded",
 				logger.String("path", r.URL.Path),
 				logger.String("method", r.Method),
@@ -197,18 +297,115 @@ func (rl *RateLimiter) RateLimit(next http.Handler, route config.Route) http.Han
 			http.Error(w, "Rate limit exceeded. Try again later.", http.StatusTooManyRequests)
 			return
 		}
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				timer.Stop()
+				return
+			}
+		}
 
 		// Continue to the next handler
 		next.ServeHTTP(w, r)
 	})
 }
 
-// tryConsume attempts to consume a token from the bucket
+// Reasons for exempting requests in the gateway_rate_limit_exempted_total
+// metric
+const (
+	exemptAPIKey  = "api_key"
+	exemptSubject = "subject"
+	exemptCIDR    = "cidr"
+)
+
+// rateLimitExemptions matches the callers exempt from a route's limit
+type rateLimitExemptions struct {
+	apiKeyHeader string
+	apiKeys      map[string]bool
+	subjects     map[string]bool
+	prefixes     []netip.Prefix
+}
+
+// newRateLimitExemptions prepares a limit's exemptions for matching, or
+// returns nil if it has none. If the ranges don't parse, the exemptions are
+// returned without them along with the error.
+func newRateLimitExemptions(cfg *config.RateLimitExemptions, apiKeyHeader string) (*rateLimitExemptions, error) {
+	if len(cfg.APIKeys) == 0 && len(cfg.Subjects) == 0 && len(cfg.CIDRs) == 0 {
+		return nil, nil
+	}
+	e := &rateLimitExemptions{
+		apiKeyHeader: apiKeyHeader,
+		apiKeys:      make(map[string]bool, len(cfg.APIKeys)),
+		subjects:     make(map[string]bool, len(cfg.Subjects)),
+	}
+	for _, key := range cfg.APIKeys {
+		e.apiKeys[key] = true
+	}
+	for _, subject := range cfg.Subjects {
+		e.subjects[subject] = true
+	}
+	prefixes, err := cfg.Prefixes()
+	if err != nil {
+		return e, err
+	}
+	e.prefixes = prefixes
+	return e, nil
+}
+
+// match returns why a request is exempt, or an empty string if it isn't
+func (e *rateLimitExemptions) match(r *http.Request) string {
+	if e == nil {
+		return ""
+	}
+	if apiKey := r.Header.Get(e.apiKeyHeader); apiKey != "" && e.apiKeys[apiKey] {
+		return exemptAPIKey
+	}
+	if identity := IdentityFromContext(r.Context()); identity != nil && identity.Subject != "" && e.subjects[identity.Subject] {
+		return exemptSubject
+	}
+	// Forwarding headers can be forged, so only the connection's address counts
+	if len(e.prefixes) > 0 {
+		if addr, ok := util.ConnectionAddr(r); ok {
+			for _, prefix := range e.prefixes {
+				if prefix.Contains(addr) {
+					return exemptCIDR
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// rateLimitPeriod returns the length of a rate limit period, a minute if
+// the period is unknown
+func rateLimitPeriod(period string) time.Duration {
+	switch period {
+	case "second":
+		return time.Second
+	case "hour":
+		return time.Hour
+	case "day":
+		return 24 * time.Hour
+	default:
+		return time.Minute
+	}
+}
+
+// tryConsume attempts to consume a token from the bucket, or to count the
+// request in the window of the window algorithms
 func (rl *RateLimiter) tryConsume(bucket *tokenBucket) bool {
 	bucket.mutex.Lock()
 	defer bucket.mutex.Unlock()
 
 	now := time.Now()
+	switch bucket.algorithm {
+	case config.RateLimitFixedWindow:
+		return bucket.consumeFixedWindow(now)
+	case config.RateLimitSlidingWindowLog:
+		return bucket.consumeSlidingWindowLog(now)
+	}
 	elapsed := now.Sub(bucket.lastRefillTime).Seconds()
 
 	// Refill the bucket based on time elapsed
@@ -228,3 +425,58 @@ func (rl *RateLimiter) tryConsume(bucket *tokenBucket) bool {
 	bucket.tokens--
 	return true
 }
+
+// consumeFixedWindow counts the request in the current window, which starts
+// at a multiple of the period
+func (b *tokenBucket) consumeFixedWindow(now time.Time) bool {
+	if start := now.Truncate(b.window); !start.Equal(b.windowStart) {
+		b.windowStart = start
+		b.count = 0
+	}
+	if b.count >= b.limit {
+		return false
+	}
+	b.count++
+	return true
+}
+
+// consumeSlidingWindowLog allows the request if fewer than the limit were
+// allowed in the period before it. The log holds up to limit timestamps.
+func (b *tokenBucket) consumeSlidingWindowLog(now time.Time) bool {
+	cutoff := now.Add(-b.window)
+	expired := 0
+	for expired < len(b.log) && !b.log[expired].After(cutoff) {
+		expired++
+	}
+	b.log = b.log[expired:]
+	if len(b.log) >= b.limit {
+		return false
+	}
+	b.log = append(b.log, now)
+	return true
+}
+
+// reserve queues a request in a leaky bucket and returns how long it must
+// wait to leave at the limit's rate. Requests that would overflow the queue
+// are rejected.
+func (rl *RateLimiter) reserve(bucket *tokenBucket) (time.Duration, bool) {
+	bucket.mutex.Lock()
+	defer bucket.mutex.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(bucket.lastRefillTime).Seconds()
+	bucket.lastRefillTime = now
+
+	// Leak the requests that left since the last one
+	bucket.tokens -= elapsed * bucket.refillRate
+	if bucket.tokens < 0 {
+		bucket.tokens = 0
+	}
+	if bucket.tokens+1 > bucket.maxTokens {
+		return 0, false
+	}
+
+	delay := time.Duration(bucket.tokens / bucket.refillRate * float64(time.Second))
+	bucket.tokens++
+	return delay, true
+}
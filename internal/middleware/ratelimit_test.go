@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"api-gateway/internal/auth"
 	"api-gateway/internal/config"
 	"api-gateway/pkg/logger"
 	"net/http"
@@ -8,7 +9,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // mockRateLimitLogger for testing
@@ -308,6 +311,267 @@ func TestRateLimiter_NoRateLimit(t *testing.T) {
 	}
 }
 
+func TestRateLimiter_SharedLimit(t *testing.T) {
+	limiter := NewRateLimiter(&mockRateLimitLogger{})
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	limit := config.RateLimitConfig{Requests: 3, Period: "minute"}
+	newRoute := func(path string) config.Route {
+		return config.Route{
+			Path:        path,
+			Middlewares: &config.Middlewares{RateLimit: &limit, RateLimitRef: "public-api"},
+		}
+	}
+	users, orders := newRoute("/users"), newRoute("/orders")
+	assert.Equal(t, "ref:public-api", RateLimitKey(users))
+	limiter.AddLimit(RateLimitKey(users), limit)
+	limiter.AddLimit(RateLimitKey(orders), limit)
+
+	handlers := []http.Handler{limiter.RateLimit(testHandler, users), limiter.RateLimit(testHandler, orders)}
+	codes := make([]int, 0, 4)
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest("GET", "http://example.com/", nil)
+		req.RemoteAddr = "192.168.1.1:12345"
+		rec := httptest.NewRecorder()
+		handlers[i%2].ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+
+	// Both routes draw from one bucket
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, codes)
+}
+
+func TestRateLimiter_KeyBy(t *testing.T) {
+	limiter := NewRateLimiter(&mockRateLimitLogger{})
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	limit := config.RateLimitConfig{Requests: 2, Period: "minute", KeyBy: config.RateLimitKeyTenant}
+	route := config.Route{Path: "/orders", Middlewares: &config.Middlewares{RateLimit: &limit}}
+	limiter.AddLimit(RateLimitKey(route), limit)
+	handler := limiter.RateLimit(testHandler, route)
+
+	send := func(subject, tenant string) int {
+		req := httptest.NewRequest("GET", "http://example.com/orders", nil)
+		req.RemoteAddr = "192.168.1.1:12345"
+		req = req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{Type: auth.IdentityJWT, Subject: subject, Tenant: tenant}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Users of one tenant share its bucket
+	assert.Equal(t, http.StatusOK, send("alice", "acme"))
+	assert.Equal(t, http.StatusOK, send("bob", "acme"))
+	assert.Equal(t, http.StatusTooManyRequests, send("carol", "acme"))
+	assert.Equal(t, http.StatusOK, send("dave", "globex"))
+
+	// Without a tenant the client IP is used
+	assert.Equal(t, http.StatusOK, send("erin", ""))
+}
+
+func TestRateLimiter_Exemptions(t *testing.T) {
+	limiter := NewRateLimiter(&mockRateLimitLogger{})
+	limiter.SetAPIKeyHeader("X-API-Auth-Token")
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	limit := config.RateLimitConfig{
+		Requests: 1,
+		Period:   "minute",
+		KeyBy:    config.RateLimitKeyIP,
+		Exempt: config.RateLimitExemptions{
+			APIKeys:  []string{"monitoring-key"},
+			Subjects: []string{"probe"},
+			CIDRs:    []string{"10.0.0.0/8", "192.168.1.7"},
+		},
+	}
+	route := config.Route{Path: "/exempt", Middlewares: &config.Middlewares{RateLimit: &limit}}
+	limiter.AddLimit(RateLimitKey(route), limit)
+	handler := limiter.RateLimit(testHandler, route)
+
+	send := func(remoteAddr, apiKey, subject string) int {
+		req := httptest.NewRequest("GET", "http://example.com/exempt", nil)
+		req.RemoteAddr = remoteAddr
+		if apiKey != "" {
+			req.Header.Set("X-API-Auth-Token", apiKey)
+		}
+		if subject != "" {
+			req = req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{Type: auth.IdentityJWT, Subject: subject}))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	cidr := testutil.ToFloat64(rateLimitExempted.WithLabelValues("/exempt", exemptCIDR))
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, send("10.1.2.3:1234", "", ""))
+		assert.Equal(t, http.StatusOK, send("192.168.1.7:1234", "", ""))
+		assert.Equal(t, http.StatusOK, send("192.168.1.1:1234", "monitoring-key", ""))
+		assert.Equal(t, http.StatusOK, send("192.168.1.1:1234", "", "probe"))
+	}
+	assert.Equal(t, cidr+6, testutil.ToFloat64(rateLimitExempted.WithLabelValues("/exempt", exemptCIDR)))
+	assert.Equal(t, float64(3), testutil.ToFloat64(rateLimitExempted.WithLabelValues("/exempt", exemptAPIKey)))
+
+	// Exempt requests didn't use the client's bucket, other callers are limited
+	assert.Equal(t, http.StatusOK, send("192.168.1.1:1234", "other-key", "alice"))
+	assert.Equal(t, http.StatusTooManyRequests, send("192.168.1.1:1234", "other-key", "alice"))
+
+	// Forwarding headers don't make a client exempt
+	req := httptest.NewRequest("GET", "http://example.com/exempt", nil)
+	req.RemoteAddr = "192.168.1.1:1234"
+	req.Header.Set("X-Real-IP", "10.0.0.1")
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+	cidr = testutil.ToFloat64(rateLimitExempted.WithLabelValues("/exempt", exemptCIDR))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, cidr, testutil.ToFloat64(rateLimitExempted.WithLabelValues("/exempt", exemptCIDR)))
+}
+
+func TestRateLimiter_InvalidExemptCIDRs(t *testing.T) {
+	limiter := NewRateLimiter(&mockRateLimitLogger{})
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	limit := config.RateLimitConfig{
+		Requests: 1,
+		Period:   "minute",
+		KeyBy:    config.RateLimitKeyIP,
+		Exempt: config.RateLimitExemptions{
+			APIKeys: []string{"monitoring-key"},
+			CIDRs:   []string{"10.0.0.0/8", "not-a-cidr"},
+		},
+	}
+	route := config.Route{Path: "/exempt-invalid", Middlewares: &config.Middlewares{RateLimit: &limit}}
+	limiter.AddLimit(RateLimitKey(route), limit)
+	handler := limiter.RateLimit(testHandler, route)
+
+	send := func(apiKey string) int {
+		req := httptest.NewRequest("GET", "http://example.com/exempt-invalid", nil)
+		req.RemoteAddr = "10.1.2.3:1234"
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Without valid ranges no address is exempt, other exemptions still apply
+	assert.Equal(t, http.StatusOK, send(""))
+	assert.Equal(t, http.StatusTooManyRequests, send(""))
+	assert.Equal(t, http.StatusOK, send("monitoring-key"))
+}
+
+func TestRateLimiter_MethodLimits(t *testing.T) {
+	limiter := NewRateLimiter(&mockRateLimitLogger{})
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	limit := config.RateLimitConfig{
+		Requests: 3,
+		Period:   "minute",
+		Methods:  map[string]config.MethodRateLimit{"post": {Requests: 1}},
+	}
+	route := config.Route{Path: "/orders", Middlewares: &config.Middlewares{RateLimit: &limit}}
+	limiter.AddLimit(route.Path, limit)
+	assert.Equal(t, config.RateLimitConfig{Requests: 1, Period: "minute"}, limiter.limits["/orders POST"])
+	handler := limiter.RateLimit(testHandler, route)
+
+	serve := func(method string) int {
+		req := httptest.NewRequest(method, "http://example.com/orders", nil)
+		req.RemoteAddr = "192.168.1.1:12345"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// POST has its own, stricter bucket
+	assert.Equal(t, http.StatusOK, serve("POST"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("POST"))
+
+	// Other methods share the route's bucket
+	assert.Equal(t, http.StatusOK, serve("GET"))
+	assert.Equal(t, http.StatusOK, serve("DELETE"))
+	assert.Equal(t, http.StatusOK, serve("GET"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("GET"))
+}
+
+func TestRateLimiter_Algorithms(t *testing.T) {
+	limiter := NewRateLimiter(&mockRateLimitLogger{})
+
+	t.Run("fixed window", func(t *testing.T) {
+		bucket := &tokenBucket{algorithm: config.RateLimitFixedWindow, limit: 2, window: time.Minute}
+		start := time.Now().Truncate(time.Minute)
+		assert.True(t, bucket.consumeFixedWindow(start))
+		assert.True(t, bucket.consumeFixedWindow(start.Add(time.Second)))
+		assert.False(t, bucket.consumeFixedWindow(start.Add(59*time.Second)))
+
+		// The count resets at the start of the next window
+		assert.True(t, bucket.consumeFixedWindow(start.Add(time.Minute)))
+	})
+
+	t.Run("sliding window log", func(t *testing.T) {
+		bucket := &tokenBucket{algorithm: config.RateLimitSlidingWindowLog, limit: 2, window: time.Minute}
+		start := time.Now()
+		assert.True(t, bucket.consumeSlidingWindowLog(start))
+		assert.True(t, bucket.consumeSlidingWindowLog(start.Add(30*time.Second)))
+		assert.False(t, bucket.consumeSlidingWindowLog(start.Add(59*time.Second)))
+
+		// Only the first request has left the window
+		assert.True(t, bucket.consumeSlidingWindowLog(start.Add(61*time.Second)))
+		assert.False(t, bucket.consumeSlidingWindowLog(start.Add(62*time.Second)))
+	})
+
+	t.Run("leaky bucket", func(t *testing.T) {
+		limit := config.RateLimitConfig{Requests: 10, Period: "second", Algorithm: config.RateLimitLeakyBucket, QueueSize: 3}
+		limiter.AddLimit("/leaky", limit)
+		bucket := limiter.getBucket("/leaky", "client")
+		require.NotNil(t, bucket)
+
+		// Queued requests are spaced at the limit's rate until the queue is full
+		delay, allowed := limiter.reserve(bucket)
+		assert.True(t, allowed)
+		assert.Zero(t, delay)
+		delay, allowed = limiter.reserve(bucket)
+		assert.True(t, allowed)
+		assert.InDelta(t, 100*time.Millisecond, delay, float64(10*time.Millisecond))
+		_, allowed = limiter.reserve(bucket)
+		assert.True(t, allowed)
+		_, allowed = limiter.reserve(bucket)
+		assert.False(t, allowed)
+	})
+}
+
+func TestRateLimiter_SpikeArrest(t *testing.T) {
+	limiter := NewRateLimiter(&mockRateLimitLogger{})
+	limiter.AddLimit("/legacy", config.RateLimitConfig{Requests: 600, Period: "minute", SpikeArrest: true})
+	limiter.AddLimit("/slow", config.RateLimitConfig{Requests: 30, Period: "minute", SpikeArrest: true})
+
+	// 600 per minute allows a burst of 10, refilled at 10 per second
+	bucket := limiter.getBucket("/legacy", "client")
+	require.NotNil(t, bucket)
+	assert.Equal(t, float64(10), bucket.maxTokens)
+	assert.Equal(t, float64(10), bucket.refillRate)
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		if limiter.tryConsume(bucket) {
+			allowed++
+		}
+	}
+	assert.Equal(t, 10, allowed)
+
+	// Limits below one per second still allow single requests
+	bucket = limiter.getBucket("/slow", "client")
+	assert.Equal(t, float64(1), bucket.maxTokens)
+}
+
 // TestRateLimiter_GetBucket tests the getBucket function
 func TestRateLimiter_GetBucket(t *testing.T) {
 	log := &mockRateLimitLogger{}
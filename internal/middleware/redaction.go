@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// Outcomes of redacted responses in the gateway_response_redactions_total metric
+const (
+	redactionApplied  = "redacted"
+	redactionWithheld = "withheld"
+)
+
+// Redactor removes JSON fields from responses to callers whose role or
+// scopes don't allow them
+type Redactor struct {
+	log logger.Logger
+}
+
+// NewRedactor creates a new response redaction middleware
+func NewRedactor(log logger.Logger) *Redactor {
+	return &Redactor{
+		log: log,
+	}
+}
+
+// Redact strips the fields the caller may not see from the route's JSON
+// responses. Responses that can't be redacted are replaced by a 502 rather
+// than sent whole. Redact must run inside the auth middleware to see the
+// caller.
+func (d *Redactor) Redact(next http.Handler, route config.Route) http.Handler {
+	cfg := route.Middlewares.Redaction
+	if cfg == nil || !cfg.Enabled {
+		return next
+	}
+	maxSize := cfg.MaxBodySize
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths := redactedPaths(cfg.Rules, IdentityFromContext(r.Context()))
+		if len(paths) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Ask for an identity encoded response so its fields can be read
+		r.Header.Del("Accept-Encoding")
+
+		response := newBufferedResponse()
+		defer response.release()
+		next.ServeHTTP(response, r)
+
+		redacted, err := redactResponse(response, paths, maxSize)
+		if err != nil {
+			d.log.Error("Failed to redact response, withholding it",
+				logger.String("path", r.URL.Path),
+				logger.String("route", route.Path),
+				logger.Int("status", response.statusCode),
+				logger.Error(err),
+			)
+			responseRedactions.WithLabelValues(route.Path, redactionWithheld).Inc()
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			return
+		}
+		if redacted {
+			responseRedactions.WithLabelValues(route.Path, redactionApplied).Inc()
+		}
+		response.copyTo(w)
+	})
+}
+
+// redactedPaths returns the fields of the rules that don't allow the caller
+func redactedPaths(rules []config.RedactionRule, identity *auth.Identity) [][]string {
+	var paths [][]string
+	for _, rule := range rules {
+		if !redactionAllows(rule, identity) {
+			paths = append(paths, splitFieldPaths(rule.Fields)...)
+		}
+	}
+	return paths
+}
+
+// redactionAllows reports whether a rule lets the caller see its fields
+func redactionAllows(rule config.RedactionRule, identity *auth.Identity) bool {
+	if identity == nil {
+		return false
+	}
+	for _, role := range rule.Roles {
+		if identity.Role != "" && identity.Role == role {
+			return true
+		}
+	}
+	for _, scope := range rule.Scopes {
+		for _, granted := range identity.Scopes {
+			if granted == scope {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// redactResponse removes the fields at paths from a buffered JSON response
+// and reports whether any was present. Bodies that aren't JSON pass
+// unchanged.
+func redactResponse(response *bufferedResponse, paths [][]string, maxSize int) (bool, error) {
+	header := response.Header()
+	if response.body.Len() == 0 || !isJSON(header.Get("Content-Type")) {
+		return false, nil
+	}
+	if encoding := header.Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		return false, fmt.Errorf("response body is %s encoded", encoding)
+	}
+	if response.body.Len() > maxSize {
+		return false, fmt.Errorf("response body larger than %d bytes", maxSize)
+	}
+
+	document, err := decodeJSON(response.body.Bytes())
+	if err != nil {
+		return false, err
+	}
+	removed := false
+	for _, path := range paths {
+		if removeField(document, path) {
+			removed = true
+		}
+	}
+	if !removed {
+		return false, nil
+	}
+
+	out, err := encodeJSON(document)
+	if err != nil {
+		return false, err
+	}
+	response.body.Reset()
+	response.body.Write(out)
+	header.Set("Content-Length", strconv.Itoa(len(out)))
+	header.Del("ETag")
+	return true, nil
+}
+
+// removeField deletes the properties at path below value and reports
+// whether any existed
+func removeField(value any, path []string) bool {
+	removed := false
+	switch value := value.(type) {
+	case map[string]any:
+		if len(path) == 1 {
+			if path[0] == "*" {
+				removed = len(value) > 0
+				clear(value)
+			} else if _, ok := value[path[0]]; ok {
+				delete(value, path[0])
+				removed = true
+			}
+			break
+		}
+		if path[0] == "*" {
+			for _, child := range value {
+				removed = removeField(child, path[1:]) || removed
+			}
+		} else if child, ok := value[path[0]]; ok {
+			removed = removeField(child, path[1:])
+		}
+	case []any:
+		// Array elements can't be removed without shifting the others, so
+		// only paths through arrays apply
+		if path[0] == "*" && len(path) > 1 {
+			for _, child := range value {
+				removed = removeField(child, path[1:]) || removed
+			}
+		}
+	}
+	return removed
+}
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// redactedRoute returns a route hiding PII from all but admins and pii:read
+func redactedRoute() config.Route {
+	return config.Route{
+		Path: "/redacted",
+		Middlewares: &config.Middlewares{Redaction: &config.ResponseRedaction{
+			Enabled: true,
+			Rules: []config.RedactionRule{
+				{Fields: []string{"ssn", "customers.*.email"}, Roles: []string{"admin"}, Scopes: []string{"pii:read"}},
+				{Fields: []string{"internal"}, Roles: []string{"admin"}},
+			},
+			MaxBodySize: 1024,
+		}},
+	}
+}
+
+func TestRedactorRedact(t *testing.T) {
+	const body = `{"id": 1, "ssn": "123-45-6789", "internal": {"score": 7}, "customers": [{"name": "ada", "email": "ada@example.com"}, {"name": "bob"}]}`
+	handler := NewRedactor(&mockLogger{}).Redact(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(body))
+	}), redactedRoute())
+
+	tests := []struct {
+		name     string
+		identity *auth.Identity
+		expected string
+	}{
+		{"anonymous", nil, `{"id": 1, "customers": [{"name": "ada"}, {"name": "bob"}]}`},
+		{"restricted role", &auth.Identity{Type: auth.IdentityJWT, Role: "user"}, `{"id": 1, "customers": [{"name": "ada"}, {"name": "bob"}]}`},
+		{"allowed scope", &auth.Identity{Type: auth.IdentityAPIKey, Scopes: []string{"pii:read"}}, `{"id": 1, "ssn": "123-45-6789", "customers": [{"name": "ada", "email": "ada@example.com"}, {"name": "bob"}]}`},
+		{"allowed role", &auth.Identity{Type: auth.IdentityJWT, Role: "admin"}, body},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/redacted", nil)
+			if tt.identity != nil {
+				req = req.WithContext(auth.WithIdentity(req.Context(), tt.identity))
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.JSONEq(t, tt.expected, rec.Body.String())
+			if tt.expected == body {
+				assert.Equal(t, `"v1"`, rec.Header().Get("ETag"))
+			} else {
+				assert.Empty(t, rec.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestRedactorWithholdsUnreadableResponses(t *testing.T) {
+	route := redactedRoute()
+	d := NewRedactor(&mockLogger{})
+
+	for name, upstream := range map[string]http.HandlerFunc{
+		"invalid JSON": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"ssn": "123-45-6789"`))
+		},
+		"too large": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"ssn": "123-45-6789", "padding": "` + strings.Repeat("a", 2048) + `"}`))
+		},
+	} {
+		withheld := testutil.ToFloat64(responseRedactions.WithLabelValues(route.Path, redactionWithheld))
+		rec := httptest.NewRecorder()
+		d.Redact(upstream, route).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/redacted", nil))
+		assert.Equal(t, http.StatusBadGateway, rec.Code, name)
+		assert.NotContains(t, rec.Body.String(), "123-45-6789", name)
+		assert.Equal(t, withheld+1, testutil.ToFloat64(responseRedactions.WithLabelValues(route.Path, redactionWithheld)), name)
+	}
+
+	// Other content passes unchanged
+	rec := httptest.NewRecorder()
+	d.Redact(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("ok"))
+	}), route).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/redacted", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ok", rec.Body.String())
+}
+
+func TestRemoveField(t *testing.T) {
+	document, err := decodeJSON([]byte(`[{"a": {"b": 1, "c": 2}}, {"a": {"c": 3}}, "x"]`))
+	assert.NoError(t, err)
+
+	assert.True(t, removeField(document, []string{"*", "a", "c"}))
+	assert.False(t, removeField(document, []string{"*", "a", "c"}))
+	assert.False(t, removeField(document, []string{"*"}))
+	out, _ := encodeJSON(document)
+	assert.JSONEq(t, `[{"a": {"b": 1}}, {"a": {}}, "x"]`, string(out))
+
+	assert.True(t, removeField(document, []string{"*", "a", "*"}))
+	out, _ = encodeJSON(document)
+	assert.JSONEq(t, `[{"a": {}}, {"a": {}}, "x"]`, string(out))
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/config"
+)
+
+// RequestIDHeader carries the request ID from clients and to upstreams
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds request IDs accepted from clients
+const maxRequestIDLength = 128
+
+// requestContextKey is the context key of the request's RequestContext
+type requestContextKey struct{}
+
+// RequestContext is what the gateway knows about a request as it passes
+// through the route's middleware, so middleware reads it from the request
+// rather than each being handed the route when the chain is built
+type RequestContext struct {
+	// Route is the matched route
+	Route *config.Route
+	// RequestID identifies the request in logs, here and upstream
+	RequestID string
+	// TestTraffic is set for requests with a valid test traffic token
+	TestTraffic bool
+
+	// caller receives the identity authenticated deeper in the chain
+	caller *requestCaller
+}
+
+// WithRequestContext returns a copy of ctx carrying rc
+func WithRequestContext(ctx context.Context, rc *RequestContext) context.Context {
+	return context.WithValue(ctx, requestContextKey{}, rc)
+}
+
+// RequestContextFromContext returns the request context stored by
+// WithRequestContext, or nil
+func RequestContextFromContext(ctx context.Context) *RequestContext {
+	rc, _ := ctx.Value(requestContextKey{}).(*RequestContext)
+	return rc
+}
+
+// RouteFromContext returns the route handling the request, or nil
+func RouteFromContext(ctx context.Context) *config.Route {
+	if rc := RequestContextFromContext(ctx); rc != nil {
+		return rc.Route
+	}
+	return nil
+}
+
+// RequestIDFromContext returns the request's ID, or an empty string
+func RequestIDFromContext(ctx context.Context) string {
+	if rc := RequestContextFromContext(ctx); rc != nil {
+		return rc.RequestID
+	}
+	return ""
+}
+
+// IdentityFromContext returns the authenticated caller of the request, or
+// nil. Handlers wrapping the auth middleware see it once the chain inside
+// them has run.
+func IdentityFromContext(ctx context.Context) *auth.Identity {
+	if identity := auth.IdentityFromContext(ctx); identity != nil {
+		return identity
+	}
+	if rc := RequestContextFromContext(ctx); rc != nil && rc.caller != nil {
+		return rc.caller.identity
+	}
+	return nil
+}
+
+// TenantFromContext returns the tenant of the authenticated caller, or an
+// empty string
+func TenantFromContext(ctx context.Context) string {
+	if identity := IdentityFromContext(ctx); identity != nil {
+		return identity.Tenant
+	}
+	return ""
+}
+
+// RouteContext stores the route and the request ID in the context of the
+// route's requests. The ID is the client's X-Request-ID if it sent a usable
+// one, or a random one, and is passed upstream in the same header.
+func RouteContext(next http.Handler, route config.Route) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+			r.Header.Set(RequestIDHeader, requestID)
+		}
+
+		r, caller := withRequestCaller(r)
+		rc := &RequestContext{Route: &route, RequestID: requestID, caller: caller}
+		next.ServeHTTP(w, r.WithContext(WithRequestContext(r.Context(), rc)))
+	})
+}
+
+// validRequestID reports whether a client's request ID is safe to log and
+// forward: non-empty, bounded and of printable ASCII without spaces
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 128-bit request ID in hex
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteContext(t *testing.T) {
+	route := config.Route{Path: "/orders", Upstream: "http://orders:8080"}
+
+	var seenRoute *config.Route
+	var seenID, seenHeader string
+	handler := RouteContext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenRoute = RouteFromContext(r.Context())
+		seenID = RequestIDFromContext(r.Context())
+		seenHeader = r.Header.Get(RequestIDHeader)
+	}), route)
+
+	// A client's request ID is kept
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	req.Header.Set(RequestIDHeader, "req-42")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if assert.NotNil(t, seenRoute) {
+		assert.Equal(t, "/orders", seenRoute.Path)
+	}
+	assert.Equal(t, "req-42", seenID)
+	assert.Equal(t, "req-42", seenHeader)
+
+	// Missing or unusable IDs are replaced and passed upstream
+	for _, id := range []string{"", "has space", strings.Repeat("a", 129)} {
+		req = httptest.NewRequest(http.MethodGet, "/orders", nil)
+		req.Header.Set(RequestIDHeader, id)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Len(t, seenID, 32)
+		assert.Equal(t, seenID, seenHeader)
+	}
+
+	// Requests outside a route have no context
+	assert.Nil(t, RouteFromContext(req.Context()))
+	assert.Empty(t, RequestIDFromContext(req.Context()))
+}
+
+func TestRequestContextIdentity(t *testing.T) {
+	identity := &auth.Identity{Type: auth.IdentityJWT, Subject: "alice", Tenant: "acme"}
+
+	// Middleware outside the auth middleware sees the identity it
+	// authenticated once the inner chain has run
+	var outer, inner string
+	authenticate := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recordCaller(r.Context(), identity)
+		inner = TenantFromContext(auth.WithIdentity(r.Context(), identity))
+	})
+	handler := RouteContext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Nil(t, IdentityFromContext(r.Context()))
+		authenticate.ServeHTTP(w, r)
+		outer = TenantFromContext(r.Context())
+	}), config.Route{Path: "/orders"})
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders", nil))
+	assert.Equal(t, "acme", inner)
+	assert.Equal(t, "acme", outer)
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// RequestValidator rejects requests with a disallowed content type, missing
+// required headers or a method the route doesn't accept
+type RequestValidator struct {
+	log logger.Logger
+}
+
+// NewRequestValidator creates a new request validation middleware
+func NewRequestValidator(log logger.Logger) *RequestValidator {
+	return &RequestValidator{
+		log: log,
+	}
+}
+
+// Validate checks requests against the route's request validation settings
+func (v *RequestValidator) Validate(next http.Handler, route config.Route) http.Handler {
+	cfg := route.Middlewares.RequestValidation
+	if cfg == nil || !cfg.Enabled {
+		return next
+	}
+
+	methods := make([]string, 0, len(route.Methods))
+	for _, method := range route.Methods {
+		methods = append(methods, strings.ToUpper(method))
+	}
+	allow := strings.Join(methods, ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.HandleOptions && r.Method == http.MethodOptions {
+			w.Header().Set("Allow", allow)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if cfg.StrictMethods && len(methods) > 0 && !methodAllowed(methods, r.Method) {
+			w.Header().Set("Allow", allow)
+			v.reject(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		for _, header := range cfg.RequiredHeaders {
+			if r.Header.Get(header) == "" {
+				v.reject(w, r, http.StatusBadRequest, "Missing required header: "+header)
+				return
+			}
+		}
+
+		if len(cfg.AllowedContentTypes) > 0 && hasBody(r) && !contentTypeAllowed(cfg.AllowedContentTypes, r.Header.Get("Content-Type")) {
+			v.reject(w, r, http.StatusUnsupportedMediaType, "Unsupported Content-Type")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// reject responds with an error status
+func (v *RequestValidator) reject(w http.ResponseWriter, r *http.Request, statusCode int, message string) {
+	v.log.Debug("Rejected invalid request",
+		logger.String("method", r.Method),
+		logger.String("path", r.URL.Path),
+		logger.Int("status", statusCode),
+		logger.String("reason", message),
+	)
+	http.Error(w, message, statusCode)
+}
+
+// methodAllowed reports whether a method is listed, treating HEAD as allowed
+// wherever GET is
+func methodAllowed(methods []string, method string) bool {
+	for _, allowed := range methods {
+		if allowed == method || (method == http.MethodHead && allowed == http.MethodGet) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasBody reports whether a request carries a body
+func hasBody(r *http.Request) bool {
+	return r.ContentLength > 0 || (r.ContentLength < 0 && r.Body != nil && r.Body != http.NoBody)
+}
+
+// contentTypeAllowed reports whether a Content-Type header matches one of the
+// allowed media types, which may end in "/*"
+func contentTypeAllowed(allowed []string, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, candidate := range allowed {
+		candidate = strings.ToLower(candidate)
+		if prefix, ok := strings.CutSuffix(candidate, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if mediaType == candidate {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestValidator(t *testing.T) {
+	route := config.Route{
+		Path:    "/api",
+		Methods: []string{"GET", "POST", "OPTIONS"},
+		Middlewares: &config.Middlewares{
+			RequestValidation: &config.RequestValidation{
+				Enabled:             true,
+				AllowedContentTypes: []string{"application/json", "multipart/*"},
+				RequiredHeaders:     []string{"X-Request-ID"},
+				StrictMethods:       true,
+				HandleOptions:       true,
+			},
+		},
+	}
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := NewRequestValidator(&mockLogger{}).Validate(upstream, route)
+
+	serve := func(method, contentType, body string, requestID bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://example.com/api", strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if requestID {
+			req.Header.Set("X-Request-ID", "abc")
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	testCases := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		requestID   bool
+		wantStatus  int
+	}{
+		{name: "valid json body", method: "POST", contentType: "application/json; charset=utf-8", body: "{}", requestID: true, wantStatus: http.StatusOK},
+		{name: "wildcard content type", method: "POST", contentType: "multipart/form-data; boundary=x", body: "--x--", requestID: true, wantStatus: http.StatusOK},
+		{name: "disallowed content type", method: "POST", contentType: "text/plain", body: "hi", requestID: true, wantStatus: http.StatusUnsupportedMediaType},
+		{name: "body without content type", method: "POST", body: "{}", requestID: true, wantStatus: http.StatusUnsupportedMediaType},
+		{name: "bodyless request skips content type", method: "GET", requestID: true, wantStatus: http.StatusOK},
+		{name: "missing required header", method: "GET", wantStatus: http.StatusBadRequest},
+		{name: "HEAD allowed with GET", method: "HEAD", requestID: true, wantStatus: http.StatusOK},
+		{name: "unlisted method", method: "DELETE", requestID: true, wantStatus: http.StatusMethodNotAllowed},
+		{name: "OPTIONS answered by the gateway", method: "OPTIONS", wantStatus: http.StatusNoContent},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serve(tc.method, tc.contentType, tc.body, tc.requestID)
+			assert.Equal(t, tc.wantStatus, rec.Code)
+			if tc.wantStatus == http.StatusMethodNotAllowed || tc.wantStatus == http.StatusNoContent {
+				assert.Equal(t, "GET, POST, OPTIONS", rec.Header().Get("Allow"))
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/proxy"
+	"api-gateway/pkg/logger"
+)
+
+// Response metadata headers
+const (
+	HeaderUpstreamLatency = "X-Upstream-Latency"
+	HeaderGatewayLatency  = "X-Gateway-Latency"
+	HeaderServedBy        = "X-Served-By"
+)
+
+// ResponseMetadata adds timing and gateway identity headers to responses to
+// help debugging from clients and correlating CDN logs
+type ResponseMetadata struct {
+	config     *config.ResponseHeadersConfig
+	instanceID string
+	log        logger.Logger
+}
+
+// NewResponseMetadata creates the response metadata middleware. The instance
+// ID defaults to the host name.
+func NewResponseMetadata(cfg *config.ResponseHeadersConfig, log logger.Logger) *ResponseMetadata {
+	instanceID := cfg.InstanceID
+	if instanceID == "" && cfg.ServedBy {
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Warn("Failed to get host name for X-Served-By, set server.response_headers.instance_id",
+				logger.Error(err),
+			)
+		}
+		instanceID = hostname
+	}
+	return &ResponseMetadata{
+		config:     cfg,
+		instanceID: instanceID,
+		log:        log,
+	}
+}
+
+// Inject sets the configured headers when the response headers are written
+func (m *ResponseMetadata) Inject(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		var timing *proxy.UpstreamTiming
+		if m.config.UpstreamLatency {
+			var ctx context.Context
+			ctx, timing = proxy.WithUpstreamTiming(r.Context())
+			r = r.WithContext(ctx)
+		}
+
+		next.ServeHTTP(&metadataWriter{ResponseWriter: w, metadata: m, start: start, timing: timing}, r)
+	})
+}
+
+// setHeaders adds the metadata to response headers about to be sent
+func (m *ResponseMetadata) setHeaders(header http.Header, start time.Time, timing *proxy.UpstreamTiming) {
+	if timing != nil {
+		if duration, ok := timing.Duration(); ok {
+			header.Set(HeaderUpstreamLatency, strconv.FormatInt(duration.Milliseconds(), 10))
+		}
+	}
+	if m.config.GatewayLatency {
+		header.Set(HeaderGatewayLatency, strconv.FormatInt(time.Since(start).Milliseconds(), 10))
+	}
+	if m.config.ServedBy && m.instanceID != "" {
+		header.Set(HeaderServedBy, m.instanceID)
+	}
+	if m.config.Server != "" {
+		header.Set("Server", m.config.Server)
+	}
+}
+
+// metadataWriter adds the metadata headers just before the status is written
+type metadataWriter struct {
+	http.ResponseWriter
+	metadata    *ResponseMetadata
+	start       time.Time
+	timing      *proxy.UpstreamTiming
+	wroteHeader bool
+}
+
+// WriteHeader adds the headers and writes the status
+func (w *metadataWriter) WriteHeader(statusCode int) {
+	// Informational responses don't end the exchange
+	if !w.wroteHeader && statusCode >= http.StatusOK {
+		w.wroteHeader = true
+		w.metadata.setHeaders(w.Header(), w.start, w.timing)
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write sends the headers first if the handler didn't
+func (w *metadataWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends buffered data to the client
+func (w *metadataWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack lets upgraded connections bypass the writer
+func (w *metadataWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (w *metadataWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
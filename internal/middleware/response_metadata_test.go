@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/proxy"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseMetadataProxied(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+		w.Header().Set("Server", "nginx/1.25.3")
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	route := config.Route{Path: "/api", Upstream: upstream.URL, Middlewares: &config.Middlewares{}}
+	httpProxy := proxy.NewHTTPProxy(&config.Config{}, &config.RouteConfig{Routes: []config.Route{route}}, &mockLogger{})
+	metadata := NewResponseMetadata(&config.ResponseHeadersConfig{
+		Enabled:         true,
+		UpstreamLatency: true,
+		GatewayLatency:  true,
+		ServedBy:        true,
+		InstanceID:      "gw-eu-1",
+		Server:          "gateway",
+	}, &mockLogger{})
+	handler := metadata.Inject(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		httpProxy.ProxyRequest(route).ServeHTTP(w, r)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	upstreamLatency, err := strconv.Atoi(rec.Header().Get(HeaderUpstreamLatency))
+	require.NoError(t, err)
+	gatewayLatency, err := strconv.Atoi(rec.Header().Get(HeaderGatewayLatency))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, upstreamLatency, 30)
+	assert.GreaterOrEqual(t, gatewayLatency, upstreamLatency+20)
+	assert.Equal(t, "gw-eu-1", rec.Header().Get(HeaderServedBy))
+	assert.Equal(t, "gateway", rec.Header().Get("Server"))
+	assert.Equal(t, "ok", rec.Body.String())
+}
+
+func TestResponseMetadataGatewayResponse(t *testing.T) {
+	metadata := NewResponseMetadata(&config.ResponseHeadersConfig{
+		Enabled:         true,
+		UpstreamLatency: true,
+		GatewayLatency:  true,
+	}, &mockLogger{})
+
+	// Responses written without calling an upstream have no upstream latency
+	handler := metadata.Inject(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api", nil))
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.NotContains(t, rec.Header(), HeaderUpstreamLatency)
+	assert.NotEmpty(t, rec.Header().Get(HeaderGatewayLatency))
+	assert.NotContains(t, rec.Header(), HeaderServedBy)
+	assert.Empty(t, rec.Header().Get("Server"))
+
+	// Implicit 200 responses get the headers too
+	handler = metadata.Inject(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("pong"))
+	}))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	assert.NotEmpty(t, rec.Header().Get(HeaderGatewayLatency))
+}
+
+func TestResponseMetadataDefaultInstanceID(t *testing.T) {
+	metadata := NewResponseMetadata(&config.ResponseHeadersConfig{Enabled: true, ServedBy: true}, &mockLogger{})
+	assert.NotEmpty(t, metadata.instanceID)
+}
@@ -0,0 +1,203 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/openapi"
+	"api-gateway/pkg/logger"
+)
+
+// Outcomes of sampled responses in the gateway_response_validation_total metric
+const (
+	responseValid        = "valid"
+	responseInvalid      = "invalid"
+	responseUndocumented = "undocumented"
+	responseSkipped      = "skipped"
+)
+
+// ResponseValidator checks a sample of upstream responses against the
+// route's OpenAPI document. It only detects mismatches: they are counted and
+// logged, and the client gets the response as the upstream sent it.
+type ResponseValidator struct {
+	log    logger.Logger
+	sample func() float64
+}
+
+// NewResponseValidator creates a new response validation middleware
+func NewResponseValidator(log logger.Logger) *ResponseValidator {
+	return &ResponseValidator{
+		log:    log,
+		sample: func() float64 { return rand.Float64() * 100 },
+	}
+}
+
+// Validate checks sampled responses of the route against its OpenAPI
+// document. A document that can't be loaded turns validation off for the
+// route rather than failing it.
+func (v *ResponseValidator) Validate(next http.Handler, route config.Route) http.Handler {
+	cfg := route.Middlewares.ResponseValidation
+	if cfg == nil || !cfg.Enabled {
+		return next
+	}
+
+	doc, err := openapi.Load(cfg.Spec)
+	if err != nil {
+		v.log.Error("Failed to load OpenAPI document, not validating responses",
+			logger.String("path", route.Path),
+			logger.String("spec", cfg.Spec),
+			logger.Error(err),
+		)
+		return next
+	}
+
+	// The document describes the upstream's paths, so responses are matched
+	// by the path the proxy sends upstream
+	var upstreamBase string
+	if target, err := url.Parse(route.Upstream); err == nil {
+		upstreamBase = target.Path
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v.sample() >= cfg.SamplePercent {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		capture := &responseCapture{
+			statusRecorder: &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK},
+			body:           getBuffer(),
+			limit:          cfg.MaxBodySize,
+		}
+		defer putBuffer(capture.body)
+		next.ServeHTTP(capture, r)
+
+		v.check(doc, route, r, upstreamPath(route, upstreamBase, r.URL.Path), capture)
+	})
+}
+
+// upstreamPath returns the path the proxy sends upstream for a request path:
+// the upstream's path joined with the request path, less the route path if
+// the route strips it
+func upstreamPath(route config.Route, upstreamBase, path string) string {
+	switch {
+	case upstreamBase == "":
+	case strings.HasSuffix(upstreamBase, "/") && strings.HasPrefix(path, "/"):
+		path = upstreamBase + path[1:]
+	case !strings.HasSuffix(upstreamBase, "/") && !strings.HasPrefix(path, "/"):
+		path = upstreamBase + "/" + path
+	default:
+		path = upstreamBase + path
+	}
+	if route.StripPrefix && strings.HasPrefix(path, route.Path) {
+		path = strings.TrimPrefix(path, route.Path)
+		if path == "" {
+			path = "/"
+		}
+	}
+	return path
+}
+
+// check validates a captured response and reports the outcome
+func (v *ResponseValidator) check(doc *openapi.Document, route config.Route, r *http.Request, path string, capture *responseCapture) {
+	status := capture.statusCode
+	operation, template := doc.Operation(r.Method, path)
+	if operation == nil {
+		v.report(route, r, status, responseUndocumented, "operation not in the OpenAPI document", template)
+		return
+	}
+	response := operation.Response(status)
+	if response == nil {
+		v.report(route, r, status, responseUndocumented, "status not documented for the operation", template)
+		return
+	}
+
+	contentType := capture.Header().Get("Content-Type")
+	body := capture.body.Bytes()
+	if !response.Documented() {
+		if len(body) > 0 {
+			v.report(route, r, status, responseInvalid, "response has a body but none is documented", template)
+		} else {
+			v.report(route, r, status, responseValid, "", template)
+		}
+		return
+	}
+	if r.Method == http.MethodHead || status == http.StatusNoContent || status == http.StatusNotModified {
+		v.report(route, r, status, responseValid, "", template)
+		return
+	}
+
+	schema, ok := response.Schema(contentType)
+	if !ok {
+		v.report(route, r, status, responseInvalid, "content type not documented: "+contentType, template)
+		return
+	}
+
+	// Only uncompressed JSON bodies seen in full can be checked
+	encoding := capture.Header().Get("Content-Encoding")
+	if schema == nil || !openapi.IsJSON(contentType) || capture.truncated || (encoding != "" && encoding != "identity") {
+		v.report(route, r, status, responseSkipped, "", template)
+		return
+	}
+
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		v.report(route, r, status, responseInvalid, "invalid JSON: "+err.Error(), template)
+		return
+	}
+	if err := schema.Validate(value); err != nil {
+		v.report(route, r, status, responseInvalid, err.Error(), template)
+		return
+	}
+	v.report(route, r, status, responseValid, "", template)
+}
+
+// report counts a validated response and logs mismatches
+func (v *ResponseValidator) report(route config.Route, r *http.Request, status int, result, reason, template string) {
+	responseValidations.WithLabelValues(route.Path, result).Inc()
+	if result != responseInvalid && result != responseUndocumented {
+		return
+	}
+
+	fields := []logger.Field{
+		logger.String("route", route.Path),
+		logger.String("method", r.Method),
+		logger.String("path", r.URL.Path),
+		logger.Int("status", status),
+		logger.String("result", result),
+		logger.String("reason", reason),
+	}
+	if template != "" {
+		fields = append(fields, logger.String("operation", template))
+	}
+	if requestID := RequestIDFromContext(r.Context()); requestID != "" {
+		fields = append(fields, logger.String("request_id", requestID))
+	}
+	v.log.Warn("Upstream response doesn't match the OpenAPI document", fields...)
+}
+
+// responseCapture passes a response through while keeping a copy of its
+// body for validation, up to a limit
+type responseCapture struct {
+	*statusRecorder
+	body      *bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// Write sends b to the client and keeps a copy while under the limit
+func (w *responseCapture) Write(b []byte) (int, error) {
+	if !w.truncated {
+		if w.body.Len()+len(b) > w.limit {
+			w.truncated = true
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.statusRecorder.Write(b)
+}
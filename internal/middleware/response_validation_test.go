@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"api-gateway/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const usersSpec = `
+openapi: 3.0.3
+paths:
+  /users/{id}:
+    get:
+      responses:
+        "200":
+          content:
+            application/json:
+              schema:
+                type: object
+                required: [id, name]
+                properties:
+                  id: {type: integer}
+                  name: {type: string}
+        "204": {}
+`
+
+// newValidatedRoute writes the users document and returns a route validating
+// every response against it
+func newValidatedRoute(t *testing.T, path string, maxBodySize int) config.Route {
+	spec := filepath.Join(t.TempDir(), "users.yaml")
+	require.NoError(t, os.WriteFile(spec, []byte(usersSpec), 0644))
+	return config.Route{
+		Path: path,
+		Middlewares: &config.Middlewares{ResponseValidation: &config.ResponseValidation{
+			Enabled:       true,
+			Spec:          spec,
+			SamplePercent: 100,
+			MaxBodySize:   maxBodySize,
+		}},
+	}
+}
+
+func TestResponseValidator(t *testing.T) {
+	route := newValidatedRoute(t, "/rv-users", 1024)
+	v := NewResponseValidator(&mockLogger{})
+
+	tests := []struct {
+		name        string
+		path        string
+		status      int
+		contentType string
+		body        string
+		result      string
+	}{
+		{"valid", "/users/1", http.StatusOK, "application/json", `{"id": 1, "name": "ada"}`, responseValid},
+		{"schema mismatch", "/users/1", http.StatusOK, "application/json", `{"id": "1"}`, responseInvalid},
+		{"invalid JSON", "/users/1", http.StatusOK, "application/json", `{"id":`, responseInvalid},
+		{"undocumented content type", "/users/1", http.StatusOK, "text/html", `<p>ada</p>`, responseInvalid},
+		{"no content", "/users/1", http.StatusNoContent, "", "", responseValid},
+		{"undocumented status", "/users/1", http.StatusInternalServerError, "application/json", `{}`, responseUndocumented},
+		{"undocumented operation", "/accounts/1", http.StatusOK, "application/json", `{}`, responseUndocumented},
+		{"too large", "/users/1", http.StatusOK, "application/json", `{"id": 1, "name": "` + string(make([]byte, 2048)) + `"}`, responseSkipped},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := v.Validate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}), route)
+
+			before := testutil.ToFloat64(responseValidations.WithLabelValues(route.Path, tt.result))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			// The response is passed through whatever the outcome
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, tt.body, rec.Body.String())
+			assert.Equal(t, before+1, testutil.ToFloat64(responseValidations.WithLabelValues(route.Path, tt.result)))
+		})
+	}
+}
+
+func TestResponseValidatorUpstreamPath(t *testing.T) {
+	v := NewResponseValidator(&mockLogger{})
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": 1, "name": "ada"}`))
+	})
+	validated := func(route config.Route, path string) bool {
+		before := testutil.ToFloat64(responseValidations.WithLabelValues(route.Path, responseValid))
+		v.Validate(upstream, route).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		return testutil.ToFloat64(responseValidations.WithLabelValues(route.Path, responseValid)) == before+1
+	}
+
+	// The route path is matched unless the route strips it
+	route := newValidatedRoute(t, "/rv-api", 1024)
+	route.Upstream = "http://users:8080"
+	assert.False(t, validated(route, "/rv-api/users/1"))
+	route.StripPrefix = true
+	assert.True(t, validated(route, "/rv-api/users/1"))
+
+	// Paths are matched under the base path of the document's servers
+	spec := filepath.Join(t.TempDir(), "users.yaml")
+	require.NoError(t, os.WriteFile(spec, []byte("servers:\n  - url: https://users.example.com/v1\n"+usersSpec), 0644))
+	route = newValidatedRoute(t, "/rv-v1", 1024)
+	route.Upstream = "http://users:8080/v1"
+	route.Middlewares.ResponseValidation.Spec = spec
+	assert.True(t, validated(route, "/users/1"))
+}
+
+func TestUpstreamPath(t *testing.T) {
+	route := config.Route{Path: "/api", StripPrefix: true}
+	assert.Equal(t, "/users/1", upstreamPath(route, "", "/api/users/1"))
+	assert.Equal(t, "/", upstreamPath(route, "", "/api"))
+	assert.Equal(t, "/v1/api/users", upstreamPath(route, "/v1/", "/api/users"))
+
+	route.StripPrefix = false
+	assert.Equal(t, "/v1/api/users", upstreamPath(route, "/v1", "/api/users"))
+}
+
+func TestResponseValidatorSampling(t *testing.T) {
+	route := newValidatedRoute(t, "/rv-sampled", 1024)
+	route.Middlewares.ResponseValidation.SamplePercent = 25
+	v := NewResponseValidator(&mockLogger{})
+
+	samples := []float64{10, 30, 24.9, 90}
+	v.sample = func() float64 {
+		sample := samples[0]
+		samples = samples[1:]
+		return sample
+	}
+	handler := v.Validate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": 1}`))
+	}), route)
+
+	before := testutil.ToFloat64(responseValidations.WithLabelValues(route.Path, responseInvalid))
+	for i := 0; i < 4; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	}
+	assert.Equal(t, before+2, testutil.ToFloat64(responseValidations.WithLabelValues(route.Path, responseInvalid)))
+}
+
+func TestResponseValidatorMissingSpec(t *testing.T) {
+	route := newValidatedRoute(t, "/rv-missing", 1024)
+	route.Middlewares.ResponseValidation.Spec = filepath.Join(t.TempDir(), "missing.yaml")
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := NewResponseValidator(&mockLogger{}).Validate(next, route)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
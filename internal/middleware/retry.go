@@ -5,10 +5,11 @@ import (
 	"context"
 	"io"
 	"net/http"
-	"strings"
+	"strconv"
 	"time"
 
 	"api-gateway/internal/config"
+	"api-gateway/internal/proxy"
 	"api-gateway/pkg/logger"
 )
 
@@ -31,13 +32,6 @@ func (r *RetryMiddleware) Retry(next http.Handler, policy *config.RetryPolicy) h
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		// Create a response recorder to capture the response
-		recorder := &responseRecorder{
-			ResponseWriter: w,
-			statusCode:     http.StatusOK,
-			body:           new(bytes.Buffer),
-		}
-
 		var err error
 		// Copy the request body for potential retries
 		var bodyBytes []byte
@@ -54,6 +48,10 @@ func (r *RetryMiddleware) Retry(next http.Handler, policy *config.RetryPolicy) h
 			req.Body.Close()
 		}
 
+		// Record the upstream endpoints tried so retries go elsewhere
+		ctx, upstreamAttempts := proxy.WithUpstreamAttempts(req.Context())
+		req = req.WithContext(ctx)
+
 		// Try the request multiple times if needed
 		attempts := policy.Attempts
 		perTryTimeout := time.Duration(policy.PerTryTimeout) * time.Second
@@ -65,11 +63,7 @@ func (r *RetryMiddleware) Retry(next http.Handler, policy *config.RetryPolicy) h
 			}
 
 			// Track the attempt in request headers for debugging
-			req.Header.Set("X-Retry-Attempt",
-				strings.Join([]string{
-					string('0' + rune(attempt)),
-					string('0' + rune(attempts))},
-					"/"))
+			req.Header.Set("X-Retry-Attempt", strconv.Itoa(attempt)+"/"+strconv.Itoa(attempts))
 
 			// Create a context with timeout for this attempt
 			ctx := req.Context()
@@ -79,23 +73,16 @@ func (r *RetryMiddleware) Retry(next http.Handler, policy *config.RetryPolicy) h
 				defer cancel()
 			}
 
-			// Serve the request with the new context
-			recorder.Reset()
-			next.ServeHTTP(recorder, req.WithContext(ctx))
+			// Buffer the attempt so a failed one never reaches the client
+			response := newBufferedResponse()
+			next.ServeHTTP(response, req.WithContext(ctx))
 
 			// Check if we should retry
-			shouldRetry := r.shouldRetry(policy.RetryOn, recorder.statusCode, err)
+			shouldRetry := r.shouldRetry(policy.RetryOn, response.statusCode, err)
 			if !shouldRetry || attempt == attempts {
 				// On the last attempt or if we shouldn't retry, copy the response to the original writer
-				for key, values := range recorder.Header() {
-					for _, value := range values {
-						w.Header().Add(key, value)
-					}
-				}
-				w.WriteHeader(recorder.statusCode)
-				if recorder.body != nil {
-					w.Write(recorder.body.Bytes())
-				}
+				response.copyTo(w)
+				response.release()
 				return
 			}
 
@@ -103,8 +90,10 @@ func (r *RetryMiddleware) Retry(next http.Handler, policy *config.RetryPolicy) h
 				logger.String("path", req.URL.Path),
 				logger.Int("attempt", attempt),
 				logger.Int("max_attempts", attempts),
-				logger.Int("status_code", recorder.statusCode),
+				logger.Int("status_code", response.statusCode),
+				logger.Any("endpoints", upstreamAttempts.Endpoints()),
 			)
+			response.release()
 
 			// Slight delay before retry using exponential backoff
 			backoff := time.Duration(attempt*attempt*50) * time.Millisecond
@@ -113,6 +102,59 @@ func (r *RetryMiddleware) Retry(next http.Handler, policy *config.RetryPolicy) h
 	})
 }
 
+// bufferedResponse holds the response of one attempt until it is known
+// whether it will be retried. Responses are pooled along with their header
+// map and body buffer.
+type bufferedResponse struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+// newBufferedResponse returns an empty buffered response from the pool
+func newBufferedResponse() *bufferedResponse {
+	b := bufferedResponsePool.Get().(*bufferedResponse)
+	b.statusCode = http.StatusOK
+	return b
+}
+
+// release returns the response to the pool once it has been copied or
+// discarded
+func (b *bufferedResponse) release() {
+	if b.body.Cap() > maxPooledBufferSize {
+		return
+	}
+	clear(b.header)
+	b.body.Reset()
+	bufferedResponsePool.Put(b)
+}
+
+// Header returns the buffered headers
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+// WriteHeader records the status code
+func (b *bufferedResponse) WriteHeader(statusCode int) {
+	b.statusCode = statusCode
+}
+
+// Write buffers the body
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+// copyTo writes the buffered response to w
+func (b *bufferedResponse) copyTo(w http.ResponseWriter) {
+	for key, values := range b.header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(b.statusCode)
+	w.Write(b.body.Bytes())
+}
+
 // shouldRetry determines if a request should be retried based on the retry policy
 func (r *RetryMiddleware) shouldRetry(retryOn []string, statusCode int, err error) bool {
 	// If there was a network error, retry
@@ -491,3 +491,96 @@ func TestContains(t *testing.T) {
 		})
 	}
 }
+
+func TestRetryMiddleware_OnlyFinalAttemptReachesClient(t *testing.T) {
+	middleware := NewRetryMiddleware(&mockRetryLogger{})
+
+	callCount := 0
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callCount++
+		if callCount == 1 {
+			w.Header().Set("X-Failed", "true")
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("Bad Gateway"))
+			return
+		}
+		assert.Equal(t, "2/2", r.Header.Get("X-Retry-Attempt"))
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Success"))
+	})
+
+	handler := middleware.Retry(testHandler, &config.RetryPolicy{
+		Enabled:  true,
+		Attempts: 2,
+		RetryOn:  []string{"server_error"},
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "http://example.com/api/test", nil))
+
+	assert.Equal(t, 2, callCount)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "Success", rec.Body.String())
+	assert.Empty(t, rec.Header().Get("X-Failed"))
+}
+
+func TestRetryMiddleware_PooledResponsesStartEmpty(t *testing.T) {
+	middleware := NewRetryMiddleware(&mockRetryLogger{})
+
+	callCount := 0
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callCount++
+		if callCount == 1 {
+			w.Header().Set("X-Failed", "true")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("Unavailable"))
+			return
+		}
+		// The retried attempt relies on the implicit 200
+		w.Write([]byte("Success"))
+	})
+
+	handler := middleware.Retry(testHandler, &config.RetryPolicy{
+		Enabled:  true,
+		Attempts: 2,
+		RetryOn:  []string{"server_error"},
+	})
+
+	for i := 0; i < 3; i++ {
+		callCount = 0
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "http://example.com/api/test", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "Success", rec.Body.String())
+		assert.Empty(t, rec.Header().Get("X-Failed"))
+	}
+}
+
+func BenchmarkRetryBufferedResponse(b *testing.B) {
+	middleware := NewRetryMiddleware(&mockRetryLogger{})
+	body := bytes.Repeat([]byte("x"), 16*1024)
+	handler := middleware.Retry(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}), &config.RetryPolicy{Enabled: true, Attempts: 2, RetryOn: []string{"server_error"}})
+	req := httptest.NewRequest("GET", "http://example.com/api/test", nil)
+	w := discardResponseWriter{header: make(http.Header)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		clear(w.header)
+		handler.ServeHTTP(w, req)
+	}
+}
+
+// discardResponseWriter drops what is written to it, so benchmarks measure
+// the middleware rather than a recorder
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w discardResponseWriter) Header() http.Header         { return w.header }
+func (w discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w discardResponseWriter) WriteHeader(statusCode int)  {}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"api-gateway/internal/config"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// routeLabelsKey is the context key for the matched route's labels
+type routeLabelsKey struct{}
+
+// WithRouteLabels returns a copy of ctx carrying the route labels
+func WithRouteLabels(ctx context.Context, labels map[string]string) context.Context {
+	return context.WithValue(ctx, routeLabelsKey{}, labels)
+}
+
+// RouteLabelsFromContext returns the labels of the route handling the request
+func RouteLabelsFromContext(ctx context.Context) map[string]string {
+	labels, _ := ctx.Value(routeLabelsKey{}).(map[string]string)
+	return labels
+}
+
+// RouteLabels tags requests with the route labels, adding them to the request
+// context and to the active trace span as route.label.<name> attributes
+func RouteLabels(next http.Handler, route config.Route) http.Handler {
+	if len(route.Labels) == 0 {
+		return next
+	}
+
+	attributes := make([]attribute.KeyValue, 0, len(route.Labels))
+	for name, value := range route.Labels {
+		attributes = append(attributes, attribute.String("route.label."+name, value))
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		trace.SpanFromContext(ctx).SetAttributes(attributes...)
+		next.ServeHTTP(w, r.WithContext(WithRouteLabels(ctx, route.Labels)))
+	})
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRouteLabels(t *testing.T) {
+	route := config.Route{Path: "/payments", Labels: map[string]string{"team": "payments", "tier": "critical"}}
+
+	t.Run("labels reach context and span", func(t *testing.T) {
+		recorder := tracetest.NewSpanRecorder()
+		tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+		var seen map[string]string
+		handler := RouteLabels(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = RouteLabelsFromContext(r.Context())
+		}), route)
+
+		req := httptest.NewRequest(http.MethodGet, "/payments", nil)
+		ctx, span := tracer.Start(req.Context(), "request")
+		handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(ctx))
+		span.End()
+
+		assert.Equal(t, route.Labels, seen)
+		spans := recorder.Ended()
+		if assert.Len(t, spans, 1) {
+			assert.Contains(t, spans[0].Attributes(), attribute.String("route.label.team", "payments"))
+			assert.Contains(t, spans[0].Attributes(), attribute.String("route.label.tier", "critical"))
+		}
+	})
+
+	t.Run("routes without labels are untouched", func(t *testing.T) {
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		handler := RouteLabels(next, config.Route{Path: "/other"})
+		assert.NotNil(t, handler)
+		assert.Nil(t, RouteLabelsFromContext(httptest.NewRequest(http.MethodGet, "/", nil).Context()))
+	})
+}
@@ -0,0 +1,350 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// sloBucketCount is the number of one-minute buckets kept per route, covering
+// the longest burn-rate window
+const sloBucketCount = 360
+
+// SLO kinds
+const (
+	sloAvailability = "availability"
+	sloLatency      = "latency"
+)
+
+// sloWindows are the burn-rate windows exposed as metrics
+var sloWindows = []struct {
+	name     string
+	duration time.Duration
+}{
+	{"5m", 5 * time.Minute},
+	{"30m", 30 * time.Minute},
+	{"1h", time.Hour},
+	{"6h", 6 * time.Hour},
+}
+
+// sloAlertRule fires when both the long and the short window burn faster than
+// the threshold, so alerts are both significant and still ongoing
+type sloAlertRule struct {
+	severity  string
+	long      string
+	short     string
+	threshold float64
+}
+
+// sloAlertRules are the standard multi-window burn-rate alerts for a 30 day
+// budget: 2% of the budget spent in an hour pages, 5% in six hours opens a ticket
+var sloAlertRules = []sloAlertRule{
+	{severity: "page", long: "1h", short: "5m", threshold: 14.4},
+	{severity: "ticket", long: "6h", short: "30m", threshold: 6},
+}
+
+// SLOAlert is the JSON body posted to the alert webhook
+type SLOAlert struct {
+	Route         string    `json:"route"`
+	SLO           string    `json:"slo"`
+	Severity      string    `json:"severity"`
+	Status        string    `json:"status"`
+	Target        float64   `json:"target"`
+	Threshold     float64   `json:"burn_rate_threshold"`
+	LongWindow    string    `json:"long_window"`
+	LongBurnRate  float64   `json:"long_burn_rate"`
+	ShortWindow   string    `json:"short_window"`
+	ShortBurnRate float64   `json:"short_burn_rate"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+// sloBucket counts the requests of one minute
+type sloBucket struct {
+	minute int64
+	total  uint64
+	errors uint64
+	slow   uint64
+}
+
+// routeSLO holds the objectives and recent request counts of a route
+type routeSLO struct {
+	route     string
+	objective config.RouteSLO
+
+	mutex   sync.Mutex
+	buckets [sloBucketCount]sloBucket
+	firing  map[string]bool
+}
+
+// record counts a completed request
+func (s *routeSLO) record(now time.Time, status int, duration time.Duration) {
+	minute := now.Unix() / 60
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	bucket := &s.buckets[minute%sloBucketCount]
+	if bucket.minute != minute {
+		*bucket = sloBucket{minute: minute}
+	}
+	bucket.total++
+	if status >= 500 {
+		bucket.errors++
+	}
+	if s.objective.LatencyThresholdMs > 0 && duration > time.Duration(s.objective.LatencyThresholdMs)*time.Millisecond {
+		bucket.slow++
+	}
+}
+
+// window sums the buckets of the last d, including the current minute
+func (s *routeSLO) window(now time.Time, d time.Duration) (total, errors, slow uint64) {
+	current := now.Unix() / 60
+	oldest := current - int64(d/time.Minute) + 1
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, bucket := range s.buckets {
+		if bucket.minute >= oldest && bucket.minute <= current {
+			total += bucket.total
+			errors += bucket.errors
+			slow += bucket.slow
+		}
+	}
+	return total, errors, slow
+}
+
+// targets returns the enabled SLO kinds and their target percentages
+func (s *routeSLO) targets() map[string]float64 {
+	targets := make(map[string]float64)
+	if s.objective.Availability > 0 {
+		targets[sloAvailability] = s.objective.Availability
+	}
+	if s.objective.LatencyThresholdMs > 0 {
+		target := s.objective.LatencyTarget
+		if target == 0 {
+			target = s.objective.Availability
+		}
+		targets[sloLatency] = target
+	}
+	return targets
+}
+
+// burnRate is how many times faster than sustainable the error budget is spent
+func burnRate(bad, total uint64, target float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	budget := 1 - target/100
+	return (float64(bad) / float64(total)) / budget
+}
+
+// SLOTracker measures route availability and latency against their objectives,
+// exposing multi-window burn rates as metrics and posting burn-rate alerts to a
+// webhook
+type SLOTracker struct {
+	config *config.SLOConfig
+	client *http.Client
+	log    logger.Logger
+	now    func() time.Time
+
+	mutex  sync.Mutex
+	routes []*routeSLO
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewSLOTracker creates a new SLO tracker
+func NewSLOTracker(config *config.SLOConfig, log logger.Logger) *SLOTracker {
+	return &SLOTracker{
+		config: config,
+		client: &http.Client{Timeout: time.Duration(config.WebhookTimeoutMs) * time.Millisecond},
+		log:    log,
+		now:    time.Now,
+	}
+}
+
+// Track counts requests to routes that declare an SLO, other than test traffic
+func (t *SLOTracker) Track(next http.Handler, route config.Route) http.Handler {
+	if route.SLO == nil {
+		return next
+	}
+
+	slo := &routeSLO{route: route.Path, objective: *route.SLO, firing: make(map[string]bool)}
+	t.mutex.Lock()
+	t.routes = append(t.routes, slo)
+	t.mutex.Unlock()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsTestTraffic(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := t.now()
+		recorder := &statusRecorder{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+		}
+		next.ServeHTTP(recorder, r)
+
+		now := t.now()
+		slo.record(now, recorder.statusCode, now.Sub(start))
+	})
+}
+
+// Start evaluates burn rates periodically until Stop is called
+func (t *SLOTracker) Start() {
+	interval := time.Duration(t.config.EvaluationInterval) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	t.stop = make(chan struct{})
+	t.done = make(chan struct{})
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				t.evaluate()
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends periodic evaluation
+func (t *SLOTracker) Stop() {
+	if t.stop == nil {
+		return
+	}
+	close(t.stop)
+	<-t.done
+	t.stop = nil
+}
+
+// evaluate updates the burn-rate metrics and fires or resolves alerts
+func (t *SLOTracker) evaluate() {
+	now := t.now()
+
+	t.mutex.Lock()
+	routes := append([]*routeSLO(nil), t.routes...)
+	t.mutex.Unlock()
+
+	for _, slo := range routes {
+		rates := make(map[string]map[string]float64)
+		for _, window := range sloWindows {
+			total, errors, slow := slo.window(now, window.duration)
+			for kind, target := range slo.targets() {
+				bad := errors
+				if kind == sloLatency {
+					bad = slow
+				}
+				rate := burnRate(bad, total, target)
+				if rates[kind] == nil {
+					rates[kind] = make(map[string]float64)
+				}
+				rates[kind][window.name] = rate
+				sloBurnRate.WithLabelValues(slo.route, kind, window.name).Set(rate)
+			}
+		}
+
+		for kind, target := range slo.targets() {
+			for _, rule := range sloAlertRules {
+				long, short := rates[kind][rule.long], rates[kind][rule.short]
+				active := long > rule.threshold && short > rule.threshold
+
+				key := kind + "/" + rule.severity
+				slo.mutex.Lock()
+				changed := slo.firing[key] != active
+				slo.firing[key] = active
+				slo.mutex.Unlock()
+
+				value := 0.0
+				if active {
+					value = 1
+				}
+				sloAlertActive.WithLabelValues(slo.route, kind, rule.severity).Set(value)
+
+				if !changed {
+					continue
+				}
+
+				status := "resolved"
+				if active {
+					status = "firing"
+				}
+				t.log.Warn("SLO burn-rate alert "+status,
+					logger.String("route", slo.route),
+					logger.String("slo", kind),
+					logger.String("severity", rule.severity),
+					logger.Any("long_burn_rate", long),
+					logger.Any("short_burn_rate", short),
+				)
+				t.notify(SLOAlert{
+					Route:         slo.route,
+					SLO:           kind,
+					Severity:      rule.severity,
+					Status:        status,
+					Target:        target,
+					Threshold:     rule.threshold,
+					LongWindow:    rule.long,
+					LongBurnRate:  long,
+					ShortWindow:   rule.short,
+					ShortBurnRate: short,
+					Timestamp:     now,
+				})
+			}
+		}
+	}
+}
+
+// notify posts an alert to the webhook if one is configured
+func (t *SLOTracker) notify(alert SLOAlert) {
+	if t.config.AlertWebhook == "" {
+		return
+	}
+
+	if err := t.post(alert); err != nil {
+		t.log.Error("Failed to send SLO alert",
+			logger.String("route", alert.Route),
+			logger.String("webhook", t.config.AlertWebhook),
+			logger.Error(err),
+		)
+	}
+}
+
+// post sends alert as JSON to the webhook
+func (t *SLOTracker) post(alert SLOAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, t.config.AlertWebhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
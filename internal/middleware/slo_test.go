@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBurnRate(t *testing.T) {
+	assert.Equal(t, 0.0, burnRate(0, 0, 99.9))
+	assert.InDelta(t, 1.0, burnRate(1, 1000, 99.9), 1e-9)
+	assert.InDelta(t, 10.0, burnRate(10, 100, 99), 1e-9)
+}
+
+func TestRouteSLO_Window(t *testing.T) {
+	slo := &routeSLO{objective: config.RouteSLO{Availability: 99, LatencyThresholdMs: 100}}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	slo.record(now.Add(-10*time.Minute), http.StatusOK, time.Millisecond)
+	slo.record(now.Add(-2*time.Minute), http.StatusBadGateway, time.Millisecond)
+	slo.record(now, http.StatusOK, 200*time.Millisecond)
+
+	total, errors, slow := slo.window(now, 5*time.Minute)
+	assert.Equal(t, uint64(2), total)
+	assert.Equal(t, uint64(1), errors)
+	assert.Equal(t, uint64(1), slow)
+
+	total, _, _ = slo.window(now, time.Hour)
+	assert.Equal(t, uint64(3), total)
+
+	// Buckets older than the ring are reused
+	slo.record(now.Add(sloBucketCount*time.Minute), http.StatusOK, time.Millisecond)
+	total, _, _ = slo.window(now.Add(sloBucketCount*time.Minute), 6*time.Hour)
+	assert.Equal(t, uint64(1), total)
+}
+
+func TestSLOTracker_Alerts(t *testing.T) {
+	var mutex sync.Mutex
+	var alerts []SLOAlert
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert SLOAlert
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&alert))
+		mutex.Lock()
+		alerts = append(alerts, alert)
+		mutex.Unlock()
+	}))
+	defer webhook.Close()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker := NewSLOTracker(&config.SLOConfig{AlertWebhook: webhook.URL, WebhookTimeoutMs: 1000}, &mockLogger{})
+	tracker.now = func() time.Time { return now }
+
+	status := http.StatusInternalServerError
+	handler := tracker.Track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}), config.Route{Path: "/orders", SLO: &config.RouteSLO{Availability: 99.9}})
+
+	untracked := tracker.Track(http.NotFoundHandler(), config.Route{Path: "/other"})
+	assert.NotNil(t, untracked)
+	assert.Len(t, tracker.routes, 1)
+
+	// Every request fails: the fast and slow windows all burn at 1000x
+	for i := 0; i < 10; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders", nil))
+	}
+	tracker.evaluate()
+
+	value, err := getMetricValue(sloBurnRate, map[string]string{"route": "/orders", "slo": "availability", "window": "5m"})
+	require.NoError(t, err)
+	assert.InDelta(t, 1000.0, value, 1e-6)
+
+	require.Len(t, alerts, 2)
+	assert.Equal(t, "firing", alerts[0].Status)
+	assert.Equal(t, "availability", alerts[0].SLO)
+
+	// Evaluating again without change sends nothing new
+	tracker.evaluate()
+	assert.Len(t, alerts, 2)
+
+	// Once the failures leave the short windows the alerts resolve
+	now = now.Add(45 * time.Minute)
+	status = http.StatusOK
+	for i := 0; i < 10; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders", nil))
+	}
+	tracker.evaluate()
+
+	require.Len(t, alerts, 4)
+	assert.Equal(t, "resolved", alerts[2].Status)
+	assert.Equal(t, "resolved", alerts[3].Status)
+
+	value, err = getMetricValue(sloAlertActive, map[string]string{"route": "/orders", "slo": "availability", "severity": "page"})
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, value)
+}
+
+func TestSLOTracker_StartStop(t *testing.T) {
+	tracker := NewSLOTracker(&config.SLOConfig{EvaluationInterval: 1}, &mockLogger{})
+	tracker.Start()
+	tracker.Stop()
+	tracker.Stop()
+}
@@ -0,0 +1,249 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// SlowClientGuard aborts requests whose client sends the body or drains the
+// response slower than the configured rates. Deadlines are set on the
+// connection around each read and write, so a stalled client is cut off
+// instead of holding a connection and a handler open.
+type SlowClientGuard struct {
+	config       *config.SlowClientConfig
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	log          logger.Logger
+}
+
+// NewSlowClientGuard creates a new slow client guard. The server's read and
+// write timeouts are kept as overall limits.
+func NewSlowClientGuard(cfg *config.ServerConfig, log logger.Logger) *SlowClientGuard {
+	return &SlowClientGuard{
+		config:       &cfg.SlowClient,
+		readTimeout:  time.Duration(cfg.ReadTimeout) * time.Second,
+		writeTimeout: time.Duration(cfg.WriteTimeout) * time.Second,
+		log:          log,
+	}
+}
+
+// Guard enforces the minimum transfer rates on requests
+func (g *SlowClientGuard) Guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		var readLimit, writeLimit time.Time
+		if g.readTimeout > 0 {
+			readLimit = start.Add(g.readTimeout)
+		}
+		if g.writeTimeout > 0 {
+			writeLimit = start.Add(g.writeTimeout)
+		}
+
+		// Connections that don't support deadlines can't be guarded
+		rc := http.NewResponseController(w)
+		if rc.SetReadDeadline(readLimit) != nil || rc.SetWriteDeadline(writeLimit) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		grace := time.Duration(g.config.GracePeriod) * time.Second
+
+		var body *slowClientBody
+		if g.config.MinReadRate > 0 && r.Body != nil && r.Body != http.NoBody {
+			body = &slowClientBody{
+				ReadCloser: r.Body,
+				rc:         rc,
+				budget:     transferBudget{rate: g.config.MinReadRate, grace: grace},
+				limit:      readLimit,
+			}
+			r.Body = body
+		}
+
+		writer := &slowClientWriter{
+			ResponseWriter: w,
+			rc:             rc,
+			body:           body,
+			budget:         transferBudget{rate: g.config.MinWriteRate, grace: grace},
+			writeTimeout:   time.Duration(g.config.WriteTimeout) * time.Second,
+			limit:          writeLimit,
+		}
+		next.ServeHTTP(writer, r)
+
+		if body != nil && body.aborted {
+			slowClientAborts.WithLabelValues("request_body").Inc()
+			g.log.Warn("Aborted request with slow request body",
+				logger.String("path", r.URL.Path),
+				logger.String("remote_addr", r.RemoteAddr),
+				logger.Int("bytes_read", int(body.budget.transferred)),
+			)
+			if !writer.wroteHeader || writer.suppressed {
+				writer.ResponseWriter.Header().Set("Connection", "close")
+				http.Error(writer.ResponseWriter, "Request body sent too slowly", http.StatusRequestTimeout)
+			}
+		}
+		if writer.aborted {
+			slowClientAborts.WithLabelValues("response").Inc()
+			g.log.Warn("Aborted response to slow client",
+				logger.String("path", r.URL.Path),
+				logger.String("remote_addr", r.RemoteAddr),
+				logger.Int("bytes_written", int(writer.budget.transferred)),
+			)
+		}
+	})
+}
+
+// transferBudget tracks how long a client may take to transfer data at a
+// minimum rate. Only time spent waiting on the client counts.
+type transferBudget struct {
+	rate        int
+	grace       time.Duration
+	transferred int64
+	waited      time.Duration
+}
+
+// deadline returns when n more bytes starting now must have been transferred,
+// or the zero time if no rate is enforced
+func (b *transferBudget) deadline(now time.Time, n int) time.Time {
+	if b.rate <= 0 {
+		return time.Time{}
+	}
+	allowed := b.grace + time.Duration(float64(b.transferred+int64(n))/float64(b.rate)*float64(time.Second))
+	return now.Add(allowed - b.waited)
+}
+
+// record adds a finished transfer to the budget
+func (b *transferBudget) record(n int, waited time.Duration) {
+	b.transferred += int64(n)
+	b.waited += waited
+}
+
+// earliest returns the earlier of two deadlines, where the zero time means none
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
+
+// isDeadlineExceeded reports whether err is a connection deadline expiring
+// before the overall limit
+func isDeadlineExceeded(err error, limit time.Time) bool {
+	return errors.Is(err, os.ErrDeadlineExceeded) && (limit.IsZero() || time.Now().Before(limit))
+}
+
+// slowClientBody reads the request body within the minimum read rate
+type slowClientBody struct {
+	io.ReadCloser
+	rc      *http.ResponseController
+	budget  transferBudget
+	limit   time.Time
+	aborted bool
+}
+
+// Read reads from the client, failing if the next byte doesn't arrive in time
+func (b *slowClientBody) Read(p []byte) (int, error) {
+	start := time.Now()
+	b.rc.SetReadDeadline(earliest(b.budget.deadline(start, 1), b.limit))
+	n, err := b.ReadCloser.Read(p)
+	// Clear the deadline so the server's background read isn't cut off
+	b.rc.SetReadDeadline(b.limit)
+	b.budget.record(n, time.Since(start))
+
+	if err != nil && isDeadlineExceeded(err, b.limit) {
+		b.aborted = true
+	}
+	return n, err
+}
+
+// slowClientWriter writes the response within the minimum write rate and
+// write timeout
+type slowClientWriter struct {
+	http.ResponseWriter
+	rc           *http.ResponseController
+	body         *slowClientBody
+	budget       transferBudget
+	writeTimeout time.Duration
+	limit        time.Time
+	wroteHeader  bool
+	suppressed   bool
+	aborted      bool
+}
+
+// WriteHeader sends the status, unless the request body was aborted, in which
+// case the guard answers with 408 instead
+func (w *slowClientWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if w.body != nil && w.body.aborted {
+		w.suppressed = true
+		return
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write sends response data to the client
+func (w *slowClientWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.suppressed {
+		return len(b), nil
+	}
+
+	var n int
+	err := w.timed(len(b), func() error {
+		var err error
+		n, err = w.ResponseWriter.Write(b)
+		return err
+	})
+	return n, err
+}
+
+// Flush sends buffered data to the client
+func (w *slowClientWriter) Flush() {
+	if w.suppressed {
+		return
+	}
+	w.timed(0, w.rc.Flush)
+}
+
+// Hijack lets upgraded connections bypass the guard
+func (w *slowClientWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the original writer so response controllers reach it
+func (w *slowClientWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// timed runs a write of n bytes under the write deadline
+func (w *slowClientWriter) timed(n int, write func() error) error {
+	start := time.Now()
+	deadline := w.budget.deadline(start, n)
+	if w.writeTimeout > 0 {
+		deadline = earliest(deadline, start.Add(w.writeTimeout))
+	}
+	w.rc.SetWriteDeadline(earliest(deadline, w.limit))
+	err := write()
+	w.rc.SetWriteDeadline(w.limit)
+	w.budget.record(n, time.Since(start))
+
+	if err != nil && isDeadlineExceeded(err, w.limit) {
+		w.aborted = true
+	}
+	return err
+}
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferBudget(t *testing.T) {
+	now := time.Now()
+
+	budget := transferBudget{rate: 100, grace: time.Second}
+	assert.Equal(t, now.Add(time.Second+10*time.Millisecond), budget.deadline(now, 1))
+
+	// Time spent waiting on the client uses up the allowance
+	budget.record(100, 1500*time.Millisecond)
+	assert.Equal(t, now.Add(510*time.Millisecond), budget.deadline(now, 1))
+
+	disabled := transferBudget{}
+	assert.True(t, disabled.deadline(now, 1).IsZero())
+}
+
+func TestSlowClientGuard(t *testing.T) {
+	newGuard := func(slowClient config.SlowClientConfig) *SlowClientGuard {
+		return NewSlowClientGuard(&config.ServerConfig{SlowClient: slowClient}, &mockLogger{})
+	}
+
+	t.Run("slow request body is aborted with 408", func(t *testing.T) {
+		guard := newGuard(config.SlowClientConfig{Enabled: true, MinReadRate: 100})
+		server := httptest.NewServer(guard.Guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := io.ReadAll(r.Body); err != nil {
+				http.Error(w, "upstream failed", http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("ok"))
+		})))
+		defer server.Close()
+
+		conn, err := net.Dial("tcp", server.Listener.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+
+		// Send one byte, then stall far below the minimum rate
+		fmt.Fprintf(conn, "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 10\r\n\r\nx")
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusRequestTimeout, resp.StatusCode)
+		assert.True(t, resp.Close)
+	})
+
+	t.Run("request body within the rate is read", func(t *testing.T) {
+		guard := newGuard(config.SlowClientConfig{Enabled: true, MinReadRate: 100})
+		server := httptest.NewServer(guard.Guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			w.Write(body)
+		})))
+		defer server.Close()
+
+		resp, err := http.Post(server.URL, "text/plain", strings.NewReader("payload"))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "payload", string(body))
+	})
+
+	t.Run("client not draining the response is aborted", func(t *testing.T) {
+		writeErr := make(chan error, 1)
+		guard := newGuard(config.SlowClientConfig{Enabled: true, MinWriteRate: 100 << 20})
+		server := httptest.NewServer(guard.Guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			chunk := make([]byte, 64<<10)
+			for i := 0; i < 1024; i++ {
+				if _, err := w.Write(chunk); err != nil {
+					writeErr <- err
+					return
+				}
+			}
+			writeErr <- nil
+		})))
+		defer server.Close()
+
+		conn, err := net.Dial("tcp", server.Listener.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+
+		// Request the response and never read it
+		fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+
+		select {
+		case err := <-writeErr:
+			assert.True(t, errors.Is(err, os.ErrDeadlineExceeded))
+		case <-time.After(10 * time.Second):
+			t.Fatal("write to a stalled client was not aborted")
+		}
+	})
+
+	t.Run("unsupported writers are passed through", func(t *testing.T) {
+		guard := newGuard(config.SlowClientConfig{Enabled: true, MinReadRate: 100, MinWriteRate: 100})
+		handler := guard.Guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}))
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, "ok", rec.Body.String())
+	})
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// HeaderStripper removes internal headers from incoming requests so clients
+// can't spoof values upstreams trust because the gateway sets them
+type HeaderStripper struct {
+	headers  []string
+	prefixes []string
+	log      logger.Logger
+}
+
+// NewHeaderStripper creates a new ingress header stripper
+func NewHeaderStripper(cfg *config.StripHeadersConfig, log logger.Logger) *HeaderStripper {
+	headers := make([]string, 0, len(cfg.Headers))
+	for _, name := range cfg.Headers {
+		headers = append(headers, textproto.CanonicalMIMEHeaderKey(name))
+	}
+	prefixes := make([]string, 0, len(cfg.Prefixes))
+	for _, prefix := range cfg.Prefixes {
+		if prefix != "" {
+			prefixes = append(prefixes, strings.ToLower(prefix))
+		}
+	}
+	return &HeaderStripper{
+		headers:  headers,
+		prefixes: prefixes,
+		log:      log,
+	}
+}
+
+// Strip removes the configured headers before the request reaches the rest of
+// the chain
+func (s *HeaderStripper) Strip(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var stripped []string
+		for _, name := range s.headers {
+			if _, ok := r.Header[name]; ok {
+				r.Header.Del(name)
+				stripped = append(stripped, name)
+			}
+		}
+		if len(s.prefixes) > 0 {
+			for name := range r.Header {
+				if s.hasPrefix(name) {
+					delete(r.Header, name)
+					stripped = append(stripped, name)
+				}
+			}
+		}
+
+		if len(stripped) > 0 {
+			strippedHeaders.Add(float64(len(stripped)))
+			s.log.Debug("Stripped internal headers from request",
+				logger.String("path", r.URL.Path),
+				logger.String("remote_addr", r.RemoteAddr),
+				logger.Any("headers", stripped),
+			)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hasPrefix reports whether a header name starts with a stripped prefix
+func (s *HeaderStripper) hasPrefix(name string) bool {
+	name = strings.ToLower(name)
+	for _, prefix := range s.prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
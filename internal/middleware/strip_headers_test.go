@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderStripper(t *testing.T) {
+	stripper := NewHeaderStripper(&config.StripHeadersConfig{
+		Enabled:  true,
+		Headers:  []string{"x-gateway-proxy", "X-Client-Geo-Country"},
+		Prefixes: []string{"X-Internal-"},
+	}, &mockLogger{})
+
+	var seen http.Header
+	handler := stripper.Strip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Clone()
+	}))
+
+	req := httptest.NewRequest("GET", "http://example.com/api", nil)
+	req.Header.Set("X-Gateway-Proxy", "true")
+	req.Header.Set("X-Client-Geo-Country", "US")
+	req.Header.Set("X-Internal-Tenant", "acme")
+	req.Header.Set("X-Request-ID", "abc")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Empty(t, seen.Get("X-Gateway-Proxy"))
+	assert.Empty(t, seen.Get("X-Client-Geo-Country"))
+	assert.Empty(t, seen.Get("X-Internal-Tenant"))
+	assert.Equal(t, "abc", seen.Get("X-Request-ID"))
+}
@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// Outcomes of test requests in the gateway_test_traffic_requests_total metric
+const (
+	testTrafficSandbox  = "sandbox"
+	testTrafficUpstream = "upstream"
+	testTrafficRejected = "rejected"
+)
+
+// TestTraffic recognizes end-to-end test requests by a signed token, so they
+// can run against the production configuration without reaching production
+// upstreams or counting towards quotas and analytics
+type TestTraffic struct {
+	config *config.TestTrafficConfig
+	log    logger.Logger
+	now    func() time.Time
+}
+
+// NewTestTraffic creates the test traffic middleware
+func NewTestTraffic(config *config.TestTrafficConfig, log logger.Logger) *TestTraffic {
+	return &TestTraffic{
+		config: config,
+		log:    log,
+		now:    time.Now,
+	}
+}
+
+// IsTestTraffic reports whether the request carried a valid test token
+func IsTestTraffic(r *http.Request) bool {
+	rc := RequestContextFromContext(r.Context())
+	return rc != nil && rc.TestTraffic
+}
+
+// IsSandboxed reports whether the request is test traffic the route sends to
+// its sandbox upstream rather than its production upstream
+func IsSandboxed(r *http.Request, route config.Route) bool {
+	if route.SandboxUpstream == "" || route.Protocol == config.ProtocolStatic || route.Protocol == config.ProtocolGRPCWebSocket {
+		return false
+	}
+	return IsTestTraffic(r)
+}
+
+// NewTestTrafficToken returns a token valid until expires, for test suites
+// to send in the test traffic header
+func NewTestTrafficToken(secret string, expires time.Time) string {
+	payload := strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + signTestTraffic(secret, payload)
+}
+
+// Detect marks requests with a valid token as test traffic, for Sandbox to
+// send to the route's sandbox upstream and for quotas and analytics to skip.
+// Requests with an invalid token are rejected rather than served as
+// production traffic, and so are test requests to routes without a sandbox
+// if one is required. The token never reaches the upstream. Detect must run
+// inside RouteContext.
+func (t *TestTraffic) Detect(next http.Handler, route config.Route) http.Handler {
+	if !t.config.Enabled {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(t.config.Header)
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		r.Header.Del(t.config.Header)
+
+		if err := t.verify(token); err != nil {
+			t.log.Warn("Rejected test traffic token",
+				logger.String("path", r.URL.Path),
+				logger.String("route", route.Path),
+				logger.String("reason", err.Error()),
+			)
+			testTrafficRequests.WithLabelValues(route.Path, testTrafficRejected).Inc()
+			http.Error(w, "Invalid test traffic token", http.StatusForbidden)
+			return
+		}
+
+		outcome := testTrafficSandbox
+		if route.SandboxUpstream == "" {
+			if t.config.RequireSandbox {
+				testTrafficRequests.WithLabelValues(route.Path, testTrafficRejected).Inc()
+				http.Error(w, "No sandbox upstream for test traffic", http.StatusServiceUnavailable)
+				return
+			}
+			outcome = testTrafficUpstream
+		}
+		testTrafficRequests.WithLabelValues(route.Path, outcome).Inc()
+
+		if rc := RequestContextFromContext(r.Context()); rc != nil {
+			rc.TestTraffic = true
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Sandbox sends test traffic to sandbox and other requests to upstream
+func Sandbox(upstream, sandbox http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsTestTraffic(r) {
+			sandbox.ServeHTTP(w, r)
+			return
+		}
+		upstream.ServeHTTP(w, r)
+	})
+}
+
+// verify checks a token's signature and expiry. Tokens valid for longer
+// than max_age are refused so a leaked token can't be used for long.
+func (t *TestTraffic) verify(token string) error {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return errors.New("malformed token")
+	}
+	if !hmac.Equal([]byte(signature), []byte(signTestTraffic(t.config.Secret, payload))) {
+		return errors.New("invalid signature")
+	}
+	expires, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		return errors.New("malformed token")
+	}
+	now := t.now()
+	switch {
+	case now.Unix() >= expires:
+		return errors.New("token expired")
+	case expires-now.Unix() > int64(t.config.MaxAge):
+		return errors.New("token valid for longer than max_age")
+	}
+	return nil
+}
+
+// signTestTraffic returns the signature of a token payload
+func signTestTraffic(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("test-traffic:" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
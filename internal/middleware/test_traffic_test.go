@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestTraffic creates the middleware with a fixed clock
+func newTestTraffic(cfg config.TestTrafficConfig, now time.Time) *TestTraffic {
+	cfg.Enabled = true
+	if cfg.Header == "" {
+		cfg.Header = "X-Test-Traffic"
+	}
+	if cfg.MaxAge == 0 {
+		cfg.MaxAge = 3600
+	}
+	t := NewTestTraffic(&cfg, &mockLogger{})
+	t.now = func() time.Time { return now }
+	return t
+}
+
+func TestTestTrafficDetect(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	traffic := newTestTraffic(config.TestTrafficConfig{Secret: "s3cret"}, now)
+	route := config.Route{Path: "/orders", SandboxUpstream: "http://orders-sandbox:8080"}
+
+	var served, test bool
+	var header string
+	handler := RouteContext(traffic.Detect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served, test = true, IsTestTraffic(r)
+		header = r.Header.Get("X-Test-Traffic")
+	}), route), route)
+
+	serve := func(token string) int {
+		served, test, header = false, false, ""
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		if token != "" {
+			req.Header.Set("X-Test-Traffic", token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Requests without a token are production traffic
+	assert.Equal(t, http.StatusOK, serve(""))
+	assert.True(t, served)
+	assert.False(t, test)
+
+	// A valid token marks the request and doesn't reach the upstream
+	sandboxed := testutil.ToFloat64(testTrafficRequests.WithLabelValues("/orders", testTrafficSandbox))
+	assert.Equal(t, http.StatusOK, serve(NewTestTrafficToken("s3cret", now.Add(time.Minute))))
+	assert.True(t, test)
+	assert.Empty(t, header)
+	assert.Equal(t, sandboxed+1, testutil.ToFloat64(testTrafficRequests.WithLabelValues("/orders", testTrafficSandbox)))
+
+	// Invalid tokens are rejected rather than served as production traffic
+	for name, token := range map[string]string{
+		"malformed":    "not-a-token",
+		"wrong secret": NewTestTrafficToken("other", now.Add(time.Minute)),
+		"expired":      NewTestTrafficToken("s3cret", now.Add(-time.Second)),
+		"past max_age": NewTestTrafficToken("s3cret", now.Add(2*time.Hour)),
+		"tampered":     NewTestTrafficToken("s3cret", now.Add(time.Minute)) + "x",
+	} {
+		assert.Equal(t, http.StatusForbidden, serve(token), name)
+		assert.False(t, served, name)
+	}
+}
+
+func TestTestTrafficRequireSandbox(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	token := NewTestTrafficToken("s3cret", now.Add(time.Minute))
+	route := config.Route{Path: "/users"}
+
+	var test bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { test = IsTestTraffic(r) })
+
+	// Without a sandbox, test traffic goes to the upstream unless one is
+	// required
+	traffic := newTestTraffic(config.TestTrafficConfig{Secret: "s3cret"}, now)
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set("X-Test-Traffic", token)
+	rec := httptest.NewRecorder()
+	RouteContext(traffic.Detect(next, route), route).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, test)
+
+	traffic = newTestTraffic(config.TestTrafficConfig{Secret: "s3cret", RequireSandbox: true}, now)
+	req = httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set("X-Test-Traffic", token)
+	rec = httptest.NewRecorder()
+	RouteContext(traffic.Detect(next, route), route).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestSandbox(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	traffic := newTestTraffic(config.TestTrafficConfig{Secret: "s3cret"}, now)
+	route := config.Route{Path: "/orders", SandboxUpstream: "http://orders-sandbox:8080"}
+
+	var reached string
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { reached = "upstream" })
+	sandbox := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { reached = "sandbox" })
+	handler := RouteContext(traffic.Detect(Sandbox(upstream, sandbox), route), route)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders", nil))
+	assert.Equal(t, "upstream", reached)
+
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	req.Header.Set("X-Test-Traffic", NewTestTrafficToken("s3cret", now.Add(time.Minute)))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "sandbox", reached)
+}
+
+func TestTestTrafficSkipsRateLimits(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	traffic := newTestTraffic(config.TestTrafficConfig{Secret: "s3cret"}, now)
+	limit := config.RateLimitConfig{Requests: 1, Period: "minute"}
+	route := config.Route{Path: "/limited", SandboxUpstream: "http://limited-sandbox:8080", Middlewares: &config.Middlewares{RateLimit: &limit}}
+	rl := NewRateLimiter(&mockLogger{})
+	rl.AddLimit(route.Path, limit)
+	handler := RouteContext(traffic.Detect(rl.RateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), route), route), route)
+
+	token := NewTestTrafficToken("s3cret", now.Add(time.Minute))
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+		req.Header.Set("X-Test-Traffic", token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	// Production traffic still has its whole limit
+	for _, code := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/limited", nil))
+		assert.Equal(t, code, rec.Code)
+	}
+}
+
+func TestTestTrafficWithoutSandboxIsRateLimited(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	traffic := newTestTraffic(config.TestTrafficConfig{Secret: "s3cret"}, now)
+	limit := config.RateLimitConfig{Requests: 1, Period: "minute"}
+	route := config.Route{Path: "/limited", Middlewares: &config.Middlewares{RateLimit: &limit}}
+	rl := NewRateLimiter(&mockLogger{})
+	rl.AddLimit(route.Path, limit)
+	handler := RouteContext(traffic.Detect(rl.RateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), route), route), route)
+
+	// Test traffic reaching the production upstream spends its limit
+	token := NewTestTrafficToken("s3cret", now.Add(time.Minute))
+	for _, code := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+		req.Header.Set("X-Test-Traffic", token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, code, rec.Code)
+	}
+}
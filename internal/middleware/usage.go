@@ -0,0 +1,373 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// maxPendingUsage caps the records kept for retry while the sink fails
+const maxPendingUsage = 100000
+
+// anonymousUsageKey is the key of requests made without credentials
+const anonymousUsageKey = "anonymous"
+
+// UsageRecord is the usage of one API key on one route over a flush period
+type UsageRecord struct {
+	PeriodStart   time.Time `json:"period_start"`
+	PeriodEnd     time.Time `json:"period_end"`
+	Key           string    `json:"key"`
+	Route         string    `json:"route"`
+	Requests      int64     `json:"requests"`
+	RequestBytes  int64     `json:"request_bytes"`
+	ResponseBytes int64     `json:"response_bytes"`
+}
+
+// usageKey identifies the counters of a key on a route
+type usageKey struct {
+	key   string
+	route string
+}
+
+// usageCounts are the counters of a key on a route
+type usageCounts struct {
+	requests      int64
+	requestBytes  int64
+	responseBytes int64
+}
+
+// usageSink receives the records of each flush
+type usageSink interface {
+	write(ctx context.Context, records []UsageRecord) error
+}
+
+// UsageRecorder aggregates request counts and bytes per API key and route and
+// flushes them periodically to the configured sink. Records that fail to
+// flush are retried with the next flush.
+type UsageRecorder struct {
+	config    *config.UsageConfig
+	keyHeader string
+	sink      usageSink
+	log       logger.Logger
+	now       func() time.Time
+
+	mutex       sync.Mutex
+	counts      map[usageKey]*usageCounts
+	periodStart time.Time
+	pending     []UsageRecord
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewUsageRecorder creates a usage recorder for the configured sink. API keys
+// are read from keyHeader for keys the auth middleware didn't attribute.
+func NewUsageRecorder(cfg *config.UsageConfig, keyHeader string, log logger.Logger) *UsageRecorder {
+	client := &http.Client{Timeout: time.Duration(cfg.TimeoutMs) * time.Millisecond}
+
+	var sink usageSink
+	switch cfg.Sink {
+	case config.UsageSinkWebhook:
+		sink = &webhookUsageSink{url: cfg.WebhookURL, client: client}
+	case config.UsageSinkKafka:
+		sink = &kafkaUsageSink{url: cfg.Kafka.RESTURL, topic: cfg.Kafka.Topic, client: client}
+	default:
+		sink = &csvUsageSink{path: cfg.File}
+	}
+
+	return &UsageRecorder{
+		config:      cfg,
+		keyHeader:   keyHeader,
+		sink:        sink,
+		log:         log,
+		now:         time.Now,
+		counts:      make(map[usageKey]*usageCounts),
+		periodStart: time.Now(),
+	}
+}
+
+// Record counts the requests to the route and their request and response
+// bytes by caller. Test traffic isn't counted.
+func (u *UsageRecorder) Record(next http.Handler, route config.Route) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsTestTraffic(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		r, caller := withRequestCaller(r)
+
+		var body *countingReader
+		if r.Body != nil && r.Body != http.NoBody {
+			body = &countingReader{ReadCloser: r.Body}
+			r.Body = body
+		}
+		recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		key := u.callerKey(caller, r)
+		if key == anonymousUsageKey && !u.config.IncludeAnonymous {
+			return
+		}
+		var requestBytes int64
+		if body != nil {
+			requestBytes = body.n
+		}
+		u.add(usageKey{key: key, route: route.Path}, requestBytes, recorder.bytes)
+	})
+}
+
+// callerKey returns the key usage is attributed to: the authenticated
+// subject, else a fingerprint of the API key sent, else anonymous
+func (u *UsageRecorder) callerKey(caller *requestCaller, r *http.Request) string {
+	if caller.identity != nil && caller.identity.Subject != "" {
+		return caller.identity.Subject
+	}
+	if token := r.Header.Get(u.keyHeader); u.keyHeader != "" && token != "" {
+		// Raw keys never leave the gateway
+		sum := sha256.Sum256([]byte(token))
+		return "sha256:" + hex.EncodeToString(sum[:8])
+	}
+	return anonymousUsageKey
+}
+
+// add counts a request
+func (u *UsageRecorder) add(key usageKey, requestBytes, responseBytes int64) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	counts, ok := u.counts[key]
+	if !ok {
+		counts = &usageCounts{}
+		u.counts[key] = counts
+	}
+	counts.requests++
+	counts.requestBytes += requestBytes
+	counts.responseBytes += responseBytes
+}
+
+// Start flushes usage periodically until Stop is called
+func (u *UsageRecorder) Start() {
+	u.stop = make(chan struct{})
+	u.done = make(chan struct{})
+	go func() {
+		defer close(u.done)
+		ticker := time.NewTicker(time.Duration(u.config.FlushInterval) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				u.flush()
+			case <-u.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends periodic flushing and flushes the usage counted since
+func (u *UsageRecorder) Stop() {
+	if u.stop != nil {
+		close(u.stop)
+		<-u.done
+		u.stop = nil
+	}
+	u.flush()
+}
+
+// flush writes the usage of the period ending now, with the records of
+// failed flushes, to the sink
+func (u *UsageRecorder) flush() {
+	now := u.now()
+
+	u.mutex.Lock()
+	records := u.pending
+	for key, counts := range u.counts {
+		records = append(records, UsageRecord{
+			PeriodStart:   u.periodStart,
+			PeriodEnd:     now,
+			Key:           key.key,
+			Route:         key.route,
+			Requests:      counts.requests,
+			RequestBytes:  counts.requestBytes,
+			ResponseBytes: counts.responseBytes,
+		})
+	}
+	u.counts = make(map[usageKey]*usageCounts)
+	u.periodStart = now
+	u.pending = nil
+	u.mutex.Unlock()
+
+	if len(records) == 0 {
+		return
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		if !records[i].PeriodStart.Equal(records[j].PeriodStart) {
+			return records[i].PeriodStart.Before(records[j].PeriodStart)
+		}
+		if records[i].Key != records[j].Key {
+			return records[i].Key < records[j].Key
+		}
+		return records[i].Route < records[j].Route
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(u.config.TimeoutMs)*time.Millisecond)
+	defer cancel()
+	err := u.sink.write(ctx, records)
+	if err == nil {
+		return
+	}
+
+	// Keep the records for the next flush, dropping the oldest past the cap
+	if len(records) > maxPendingUsage {
+		u.log.Error("Dropped usage records the sink could not take",
+			logger.Int("records", len(records)-maxPendingUsage),
+		)
+		records = records[len(records)-maxPendingUsage:]
+	}
+	u.log.Warn("Failed to flush usage, retrying with the next flush",
+		logger.String("sink", u.config.Sink),
+		logger.Int("records", len(records)),
+		logger.Error(err),
+	)
+	u.mutex.Lock()
+	u.pending = append(records, u.pending...)
+	u.mutex.Unlock()
+}
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+// Read counts the bytes read
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// usageCSVHeader is the header row of usage CSV files
+var usageCSVHeader = []string{"period_start", "period_end", "key", "route", "requests", "request_bytes", "response_bytes"}
+
+// csvUsageSink appends records to a CSV file, writing the header to new files
+type csvUsageSink struct {
+	path string
+}
+
+func (s *csvUsageSink) write(ctx context.Context, records []UsageRecord) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	writer := csv.NewWriter(file)
+	if info.Size() == 0 {
+		writer.Write(usageCSVHeader)
+	}
+	for _, record := range records {
+		writer.Write([]string{
+			record.PeriodStart.UTC().Format(time.RFC3339),
+			record.PeriodEnd.UTC().Format(time.RFC3339),
+			record.Key,
+			record.Route,
+			strconv.FormatInt(record.Requests, 10),
+			strconv.FormatInt(record.RequestBytes, 10),
+			strconv.FormatInt(record.ResponseBytes, 10),
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// webhookUsageSink POSTs records as a JSON array
+type webhookUsageSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *webhookUsageSink) write(ctx context.Context, records []UsageRecord) error {
+	body, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	return postUsage(ctx, s.client, s.url, "application/json", body)
+}
+
+// kafkaUsageSink produces one message per record, keyed by API key, through
+// a Kafka REST proxy
+type kafkaUsageSink struct {
+	url    string
+	topic  string
+	client *http.Client
+}
+
+// kafkaMessage is a record in a Kafka REST proxy produce request
+type kafkaMessage struct {
+	Key   string      `json:"key"`
+	Value UsageRecord `json:"value"`
+}
+
+func (s *kafkaUsageSink) write(ctx context.Context, records []UsageRecord) error {
+	messages := make([]kafkaMessage, 0, len(records))
+	for _, record := range records {
+		messages = append(messages, kafkaMessage{Key: record.Key, Value: record})
+	}
+	body, err := json.Marshal(map[string]interface{}{"records": messages})
+	if err != nil {
+		return err
+	}
+	target, err := url.JoinPath(s.url, "topics", s.topic)
+	if err != nil {
+		return err
+	}
+	return postUsage(ctx, s.client, target, "application/vnd.kafka.json.v2+json", body)
+}
+
+// postUsage POSTs a body, failing on non-2xx responses
+func postUsage(ctx context.Context, client *http.Client, target, contentType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("usage sink returned status %d", resp.StatusCode)
+	}
+	return nil
+}
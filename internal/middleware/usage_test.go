@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageRecorderCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage", "usage.csv")
+	u := NewUsageRecorder(&config.UsageConfig{Sink: config.UsageSinkCSV, File: path, TimeoutMs: 1000}, "X-API-Key", &mockLogger{})
+
+	handler := u.Record(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			recordCaller(r.Context(), &auth.Identity{Type: auth.IdentityJWT, Subject: "user-1"})
+		}
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte("hello"))
+	}), config.Route{Path: "/orders"})
+
+	send := func(body string, header, value string) {
+		req := httptest.NewRequest("POST", "/orders", strings.NewReader(body))
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	send("abc", "Authorization", "Bearer token")
+	send("abcdef", "Authorization", "Bearer token")
+	send("", "X-API-Key", "secret-key")
+	send("", "", "") // Anonymous requests are not counted by default
+
+	u.flush()
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	require.NoError(t, err)
+
+	require.Len(t, rows, 3)
+	assert.Equal(t, usageCSVHeader, rows[0])
+	assert.True(t, strings.HasPrefix(rows[1][2], "sha256:"))
+	assert.NotContains(t, rows[1][2], "secret-key")
+	assert.Equal(t, []string{"user-1", "/orders", "2", "9", "10"}, rows[2][2:])
+
+	// Later flushes append without repeating the header
+	send("", "Authorization", "Bearer token")
+	u.flush()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(data), "period_start"))
+	assert.Equal(t, 4, strings.Count(string(data), "\n"))
+}
+
+func TestUsageRecorderRetriesFailedFlushes(t *testing.T) {
+	var fail atomic.Bool
+	fail.Store(true)
+	var received []UsageRecord
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var records []UsageRecord
+		json.NewDecoder(r.Body).Decode(&records)
+		received = append(received, records...)
+	}))
+	defer sink.Close()
+
+	u := NewUsageRecorder(&config.UsageConfig{Sink: config.UsageSinkWebhook, WebhookURL: sink.URL, TimeoutMs: 1000}, "X-API-Key", &mockLogger{})
+	u.add(usageKey{key: "key_1", route: "/orders"}, 10, 20)
+	u.flush()
+	assert.Empty(t, received)
+
+	fail.Store(false)
+	u.add(usageKey{key: "key_1", route: "/orders"}, 1, 2)
+	u.flush()
+	require.Len(t, received, 2)
+	assert.Equal(t, int64(10), received[0].RequestBytes)
+	assert.Equal(t, int64(1), received[1].RequestBytes)
+}
+
+func TestUsageRecorderKafka(t *testing.T) {
+	var path, contentType string
+	var body struct {
+		Records []struct {
+			Key   string      `json:"key"`
+			Value UsageRecord `json:"value"`
+		} `json:"records"`
+	}
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer proxy.Close()
+
+	u := NewUsageRecorder(&config.UsageConfig{
+		Sink:      config.UsageSinkKafka,
+		Kafka:     config.UsageKafkaConfig{RESTURL: proxy.URL, Topic: "gateway-usage"},
+		TimeoutMs: 1000,
+	}, "X-API-Key", &mockLogger{})
+	u.add(usageKey{key: "key_1", route: "/orders"}, 0, 0)
+	u.flush()
+
+	assert.Equal(t, "/topics/gateway-usage", path)
+	assert.Equal(t, "application/vnd.kafka.json.v2+json", contentType)
+	require.Len(t, body.Records, 1)
+	assert.Equal(t, "key_1", body.Records[0].Key)
+	assert.Equal(t, int64(1), body.Records[0].Value.Requests)
+}
@@ -0,0 +1,232 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// queueSize caps the events waiting for delivery; events past it are dropped
+const queueSize = 1000
+
+// Event severities
+const (
+	SeverityInfo    = "info"
+	SeverityWarning = "warning"
+)
+
+// Event is an operational event such as a circuit breaker opening
+type Event struct {
+	Type     string            `json:"event"`
+	Severity string            `json:"severity"`
+	Subject  string            `json:"subject"` // What the event is about, such as a route path or endpoint
+	Message  string            `json:"message"`
+	Details  map[string]string `json:"details,omitempty"`
+	Time     time.Time         `json:"time"`
+}
+
+// payload is the JSON POSTed to webhooks. Slack incoming webhooks display
+// the text field.
+type payload struct {
+	Text string `json:"text"`
+	Event
+}
+
+// Notifier posts operational events to the configured webhooks in the
+// background. Events repeating the type and subject of one sent within the
+// dedup window are dropped, and failed deliveries are retried with backoff.
+type Notifier struct {
+	config *config.NotificationsConfig
+	client *http.Client
+	log    logger.Logger
+	now    func() time.Time
+
+	mutex sync.Mutex
+	sent  map[string]time.Time // Last time each type and subject was queued
+
+	queue    chan Event
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// New creates a notifier
+func New(cfg *config.NotificationsConfig, log logger.Logger) *Notifier {
+	return &Notifier{
+		config: cfg,
+		client: &http.Client{Timeout: time.Duration(cfg.TimeoutMs) * time.Millisecond},
+		log:    log,
+		now:    time.Now,
+		sent:   make(map[string]time.Time),
+		queue:  make(chan Event, queueSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Notify queues an event for delivery without blocking. A nil notifier
+// ignores events, so callers need not check whether notifications are on.
+func (n *Notifier) Notify(event Event) {
+	if n == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = n.now()
+	}
+	if event.Severity == "" {
+		event.Severity = SeverityWarning
+	}
+	if n.duplicate(event) {
+		n.log.Debug("Suppressed duplicate notification",
+			logger.String("event", event.Type),
+			logger.String("subject", event.Subject),
+		)
+		return
+	}
+
+	select {
+	case n.queue <- event:
+	default:
+		n.log.Warn("Notification queue full, dropping event",
+			logger.String("event", event.Type),
+			logger.String("subject", event.Subject),
+		)
+	}
+}
+
+// duplicate reports whether an event of the same type and subject was queued
+// within the dedup window, recording the event otherwise
+func (n *Notifier) duplicate(event Event) bool {
+	window := time.Duration(n.config.DedupWindow) * time.Second
+	key := event.Type + "\x00" + event.Subject
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	for k, sent := range n.sent {
+		if event.Time.Sub(sent) >= window {
+			delete(n.sent, k)
+		}
+	}
+	if _, ok := n.sent[key]; ok {
+		return true
+	}
+	n.sent[key] = event.Time
+	return false
+}
+
+// Start delivers queued events until Stop is called
+func (n *Notifier) Start() {
+	go func() {
+		defer close(n.done)
+		for {
+			select {
+			case event := <-n.queue:
+				n.deliver(event)
+			case <-n.stop:
+				// Send what is queued once, without retries
+				for {
+					select {
+					case event := <-n.queue:
+						n.deliver(event)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Stop ends delivery after one attempt at the events still queued
+func (n *Notifier) Stop() {
+	n.stopOnce.Do(func() {
+		close(n.stop)
+		<-n.done
+	})
+}
+
+// deliver sends an event to every webhook subscribed to it
+func (n *Notifier) deliver(event Event) {
+	body, err := json.Marshal(payload{Text: text(event), Event: event})
+	if err != nil {
+		return
+	}
+	for _, webhook := range n.config.Webhooks {
+		if !subscribed(webhook, event.Type) {
+			continue
+		}
+		if err := n.send(webhook.URL, body); err != nil {
+			n.log.Error("Failed to send notification",
+				logger.String("event", event.Type),
+				logger.String("subject", event.Subject),
+				logger.String("webhook", webhook.URL),
+				logger.Error(err),
+			)
+		}
+	}
+}
+
+// send POSTs a payload, retrying network errors, 429 and 5xx responses with
+// doubling backoff. Retries stop when the notifier is stopped.
+func (n *Notifier) send(url string, body []byte) error {
+	backoff := time.Duration(n.config.RetryBackoffMs) * time.Millisecond
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		if retry, err = n.post(url, body); err == nil || !retry || attempt >= n.config.MaxRetries {
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-n.stop:
+			timer.Stop()
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// post sends one delivery attempt, reporting whether a failure is worth
+// retrying
+func (n *Notifier) post(url string, body []byte) (bool, error) {
+	resp, err := n.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+}
+
+// subscribed reports whether a webhook receives events of a type
+func subscribed(webhook config.NotificationWebhook, eventType string) bool {
+	if len(webhook.Events) == 0 {
+		return true
+	}
+	for _, e := range webhook.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// text returns the line chat webhooks display for an event
+func text(event Event) string {
+	return fmt.Sprintf("[%s] %s: %s", event.Severity, event.Subject, event.Message)
+}
@@ -0,0 +1,170 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockLogger implements the logger.Logger interface for testing
+type mockLogger struct{}
+
+func (m *mockLogger) Debug(msg string, fields ...logger.Field)  {}
+func (m *mockLogger) Info(msg string, fields ...logger.Field)   {}
+func (m *mockLogger) Warn(msg string, fields ...logger.Field)   {}
+func (m *mockLogger) Error(msg string, fields ...logger.Field)  {}
+func (m *mockLogger) Fatal(msg string, fields ...logger.Field)  {}
+func (m *mockLogger) With(fields ...logger.Field) logger.Logger { return m }
+
+// webhookRecorder is a webhook that fails the first failures requests
+type webhookRecorder struct {
+	mutex    sync.Mutex
+	failures int
+	attempts int
+	payloads []map[string]interface{}
+}
+
+func (wr *webhookRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	wr.mutex.Lock()
+	defer wr.mutex.Unlock()
+	wr.attempts++
+	if wr.attempts <= wr.failures {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var payload map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&payload)
+	wr.payloads = append(wr.payloads, payload)
+}
+
+func (wr *webhookRecorder) received() []map[string]interface{} {
+	wr.mutex.Lock()
+	defer wr.mutex.Unlock()
+	return append([]map[string]interface{}(nil), wr.payloads...)
+}
+
+func newTestNotifier(webhooks ...config.NotificationWebhook) *Notifier {
+	return New(&config.NotificationsConfig{
+		Enabled:        true,
+		Webhooks:       webhooks,
+		DedupWindow:    300,
+		MaxRetries:     2,
+		RetryBackoffMs: 1,
+		TimeoutMs:      1000,
+	}, &mockLogger{})
+}
+
+func TestNotifierSendsSlackCompatiblePayload(t *testing.T) {
+	webhook := &webhookRecorder{}
+	server := httptest.NewServer(webhook)
+	defer server.Close()
+
+	n := newTestNotifier(config.NotificationWebhook{URL: server.URL})
+	n.Start()
+	n.Notify(Event{
+		Type:    config.EventCircuitBreakerOpened,
+		Subject: "/users",
+		Message: "Circuit breaker opened",
+		Details: map[string]string{"upstream": "http://users:8080"},
+	})
+	n.Stop()
+
+	payloads := webhook.received()
+	require.Len(t, payloads, 1)
+	assert.Equal(t, "[warning] /users: Circuit breaker opened", payloads[0]["text"])
+	assert.Equal(t, config.EventCircuitBreakerOpened, payloads[0]["event"])
+	assert.Equal(t, "/users", payloads[0]["subject"])
+	assert.Equal(t, map[string]interface{}{"upstream": "http://users:8080"}, payloads[0]["details"])
+	assert.NotEmpty(t, payloads[0]["time"])
+}
+
+func TestNotifierDeduplicates(t *testing.T) {
+	webhook := &webhookRecorder{}
+	server := httptest.NewServer(webhook)
+	defer server.Close()
+
+	n := newTestNotifier(config.NotificationWebhook{URL: server.URL})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	n.now = func() time.Time { return now }
+	n.Start()
+
+	n.Notify(Event{Type: config.EventUpstreamUnhealthy, Subject: "http://a:8080"})
+	n.Notify(Event{Type: config.EventUpstreamUnhealthy, Subject: "http://a:8080"})
+	n.Notify(Event{Type: config.EventUpstreamUnhealthy, Subject: "http://b:8080"})
+
+	// Past the window the event is sent again
+	now = now.Add(301 * time.Second)
+	n.Notify(Event{Type: config.EventUpstreamUnhealthy, Subject: "http://a:8080"})
+	n.Stop()
+
+	var subjects []interface{}
+	for _, payload := range webhook.received() {
+		subjects = append(subjects, payload["subject"])
+	}
+	assert.Equal(t, []interface{}{"http://a:8080", "http://b:8080", "http://a:8080"}, subjects)
+}
+
+func TestNotifierRetries(t *testing.T) {
+	webhook := &webhookRecorder{failures: 2}
+	server := httptest.NewServer(webhook)
+	defer server.Close()
+
+	n := newTestNotifier(config.NotificationWebhook{URL: server.URL})
+	n.Start()
+	n.Notify(Event{Type: config.EventConfigReloaded, Subject: "abc"})
+	require.Eventually(t, func() bool { return len(webhook.received()) == 1 }, time.Second, 5*time.Millisecond)
+	n.Stop()
+	webhook.mutex.Lock()
+	assert.Equal(t, 3, webhook.attempts)
+	webhook.mutex.Unlock()
+
+	// Deliveries failing past the retries are given up
+	webhook = &webhookRecorder{failures: 10}
+	failing := httptest.NewServer(webhook)
+	defer failing.Close()
+	n = newTestNotifier(config.NotificationWebhook{URL: failing.URL})
+	n.Start()
+	n.Notify(Event{Type: config.EventConfigReloaded, Subject: "abc"})
+	require.Eventually(t, func() bool {
+		webhook.mutex.Lock()
+		defer webhook.mutex.Unlock()
+		return webhook.attempts == 3
+	}, time.Second, 5*time.Millisecond)
+	n.Stop()
+	assert.Empty(t, webhook.received())
+}
+
+func TestNotifierFiltersEventsPerWebhook(t *testing.T) {
+	all, reloads := &webhookRecorder{}, &webhookRecorder{}
+	allServer, reloadServer := httptest.NewServer(all), httptest.NewServer(reloads)
+	defer allServer.Close()
+	defer reloadServer.Close()
+
+	n := newTestNotifier(
+		config.NotificationWebhook{URL: allServer.URL},
+		config.NotificationWebhook{URL: reloadServer.URL, Events: []string{config.EventConfigReloaded}},
+	)
+	n.Start()
+	n.Notify(Event{Type: config.EventCertificateExpiring, Subject: "server.crt"})
+	n.Notify(Event{Type: config.EventConfigReloaded, Subject: "abc", Severity: SeverityInfo})
+	n.Stop()
+
+	assert.Len(t, all.received(), 2)
+	if assert.Len(t, reloads.received(), 1) {
+		assert.Equal(t, SeverityInfo, reloads.received()[0]["severity"])
+	}
+}
+
+func TestNilNotifierIgnoresEvents(t *testing.T) {
+	var n *Notifier
+	assert.NotPanics(t, func() { n.Notify(Event{Type: config.EventConfigReloaded}) })
+}
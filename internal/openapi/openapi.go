@@ -0,0 +1,376 @@
+// Package openapi reads OpenAPI 3 documents and validates JSON values
+// against their schemas
+package openapi
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document is the part of an OpenAPI 3 document describing operations and
+// their responses
+type Document struct {
+	Servers    []Server             `yaml:"servers"`
+	Paths      map[string]*PathItem `yaml:"paths"`
+	Components struct {
+		Schemas   map[string]*Schema   `yaml:"schemas"`
+		Responses map[string]*Response `yaml:"responses"`
+	} `yaml:"components"`
+
+	// Paths split into segments, for matching requests
+	templates []pathTemplate
+	// Paths of the server URLs, which the document's paths are relative to
+	basePaths []string
+}
+
+// Server is a server of the API. Its URL may be relative to the document.
+type Server struct {
+	URL string `yaml:"url"`
+}
+
+// PathItem holds the operations of a path
+type PathItem struct {
+	Get     *Operation `yaml:"get"`
+	Put     *Operation `yaml:"put"`
+	Post    *Operation `yaml:"post"`
+	Delete  *Operation `yaml:"delete"`
+	Options *Operation `yaml:"options"`
+	Head    *Operation `yaml:"head"`
+	Patch   *Operation `yaml:"patch"`
+	Trace   *Operation `yaml:"trace"`
+}
+
+// Operation is an API operation and its responses by status code, status
+// range such as 2XX, or default
+type Operation struct {
+	OperationID string               `yaml:"operationId"`
+	Responses   map[string]*Response `yaml:"responses"`
+}
+
+// Response describes the bodies of a response by media type
+type Response struct {
+	Ref     string                `yaml:"$ref"`
+	Content map[string]*MediaType `yaml:"content"`
+}
+
+// MediaType holds the schema of a body
+type MediaType struct {
+	Schema *Schema `yaml:"schema"`
+}
+
+// pathTemplate is a path of the document split into segments
+type pathTemplate struct {
+	path     string
+	segments []string
+	// Segments that aren't parameters; the most specific path wins
+	literals int
+}
+
+// Load reads an OpenAPI document in YAML or JSON
+func Load(path string) (*Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses an OpenAPI document in YAML or JSON and resolves its local
+// references
+func Parse(data []byte) (*Document, error) {
+	var doc Document
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI document: %w", err)
+	}
+	if len(doc.Paths) == 0 {
+		return nil, fmt.Errorf("OpenAPI document has no paths")
+	}
+
+	if err := doc.resolve(); err != nil {
+		return nil, err
+	}
+	for path := range doc.Paths {
+		template := pathTemplate{path: path, segments: strings.Split(strings.Trim(path, "/"), "/")}
+		for _, segment := range template.segments {
+			if !isParameter(segment) {
+				template.literals++
+			}
+		}
+		doc.templates = append(doc.templates, template)
+	}
+	for _, server := range doc.Servers {
+		serverURL, err := url.Parse(server.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid server url %q: %w", server.URL, err)
+		}
+		if basePath := strings.TrimRight(serverURL.Path, "/"); basePath != "" {
+			doc.basePaths = append(doc.basePaths, basePath)
+		}
+	}
+	return &doc, nil
+}
+
+// Operation returns the operation serving a request path and method, and
+// the templated path it was found under. The path is the one sent to the
+// server, under the base path of one of the document's servers if they have
+// one.
+func (d *Document) Operation(method, path string) (*Operation, string) {
+	for _, basePath := range d.basePaths {
+		if path == basePath || strings.HasPrefix(path, basePath+"/") {
+			path = strings.TrimPrefix(path, basePath)
+			break
+		}
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	var best *pathTemplate
+	for i := range d.templates {
+		template := &d.templates[i]
+		if !template.match(segments) {
+			continue
+		}
+		if best == nil || template.literals > best.literals {
+			best = template
+		}
+	}
+	if best == nil {
+		return nil, ""
+	}
+	return d.Paths[best.path].operation(method), best.path
+}
+
+// Response returns the response documented for a status code, falling back
+// to its status range and then to the default response
+func (o *Operation) Response(status int) *Response {
+	code := strconv.Itoa(status)
+	if response, ok := o.Responses[code]; ok {
+		return response
+	}
+	for key, response := range o.Responses {
+		if len(key) == 3 && key[0] == code[0] && strings.EqualFold(key[1:], "XX") {
+			return response
+		}
+	}
+	return o.Responses["default"]
+}
+
+// Schema returns the schema of a body with the given Content-Type, and
+// whether the response documents that content type at all
+func (r *Response) Schema(contentType string) (*Schema, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	candidates := []string{mediaType, strings.SplitN(mediaType, "/", 2)[0] + "/*", "*/*"}
+	for _, candidate := range candidates {
+		for key, content := range r.Content {
+			if !strings.EqualFold(key, candidate) {
+				continue
+			}
+			if content == nil {
+				return nil, true
+			}
+			return content.Schema, true
+		}
+	}
+	return nil, false
+}
+
+// Documented reports whether the response documents a body
+func (r *Response) Documented() bool {
+	return len(r.Content) > 0
+}
+
+// IsJSON reports whether a Content-Type is JSON
+func IsJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// operation returns the operation of a method
+func (p *PathItem) operation(method string) *Operation {
+	if p == nil {
+		return nil
+	}
+	switch method {
+	case http.MethodGet:
+		return p.Get
+	case http.MethodPut:
+		return p.Put
+	case http.MethodPost:
+		return p.Post
+	case http.MethodDelete:
+		return p.Delete
+	case http.MethodOptions:
+		return p.Options
+	case http.MethodHead:
+		if p.Head != nil {
+			return p.Head
+		}
+		return p.Get
+	case http.MethodPatch:
+		return p.Patch
+	case http.MethodTrace:
+		return p.Trace
+	}
+	return nil
+}
+
+// operations returns the operations of the path item
+func (p *PathItem) operations() []*Operation {
+	if p == nil {
+		return nil
+	}
+	var operations []*Operation
+	for _, operation := range []*Operation{p.Get, p.Put, p.Post, p.Delete, p.Options, p.Head, p.Patch, p.Trace} {
+		if operation != nil {
+			operations = append(operations, operation)
+		}
+	}
+	return operations
+}
+
+// match reports whether request path segments match the template
+func (t *pathTemplate) match(segments []string) bool {
+	if len(segments) != len(t.segments) {
+		return false
+	}
+	for i, segment := range t.segments {
+		if isParameter(segment) {
+			if segments[i] == "" {
+				return false
+			}
+		} else if segment != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isParameter reports whether a path segment is a {parameter}
+func isParameter(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+// resolve links the document's $refs to the components they name
+func (d *Document) resolve() error {
+	visited := make(map[*Schema]bool)
+	for name, schema := range d.Components.Schemas {
+		if err := d.resolveSchema(schema, visited); err != nil {
+			return fmt.Errorf("schema %s: %w", name, err)
+		}
+	}
+	for name, response := range d.Components.Responses {
+		if err := d.resolveContent(response, visited); err != nil {
+			return fmt.Errorf("response %s: %w", name, err)
+		}
+	}
+
+	for path, item := range d.Paths {
+		for _, operation := range item.operations() {
+			for status, response := range operation.Responses {
+				if response == nil {
+					continue
+				}
+				if response.Ref != "" {
+					target, err := d.responseRef(response.Ref)
+					if err != nil {
+						return fmt.Errorf("%s response %s: %w", path, status, err)
+					}
+					operation.Responses[status] = target
+					continue
+				}
+				if err := d.resolveContent(response, visited); err != nil {
+					return fmt.Errorf("%s response %s: %w", path, status, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// resolveContent resolves the schemas of a response's bodies
+func (d *Document) resolveContent(response *Response, visited map[*Schema]bool) error {
+	if response == nil {
+		return nil
+	}
+	for _, content := range response.Content {
+		if content == nil {
+			continue
+		}
+		if err := d.resolveSchema(content.Schema, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveSchema resolves a schema and the schemas it contains
+func (d *Document) resolveSchema(schema *Schema, visited map[*Schema]bool) error {
+	if schema == nil || visited[schema] {
+		return nil
+	}
+	visited[schema] = true
+
+	if schema.Ref != "" {
+		target, err := d.schemaRef(schema.Ref)
+		if err != nil {
+			return err
+		}
+		schema.resolved = target
+		return d.resolveSchema(target, visited)
+	}
+
+	children := []*Schema{schema.Items, schema.Not}
+	if schema.AdditionalProperties != nil {
+		children = append(children, schema.AdditionalProperties.Schema)
+	}
+	for _, property := range schema.Properties {
+		children = append(children, property)
+	}
+	children = append(children, schema.AllOf...)
+	children = append(children, schema.AnyOf...)
+	children = append(children, schema.OneOf...)
+	for _, child := range children {
+		if err := d.resolveSchema(child, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schemaRef returns the schema a local $ref names
+func (d *Document) schemaRef(ref string) (*Schema, error) {
+	name, ok := strings.CutPrefix(ref, "#/components/schemas/")
+	if !ok {
+		return nil, fmt.Errorf("unsupported $ref %s", ref)
+	}
+	schema, ok := d.Components.Schemas[name]
+	if !ok || schema == nil {
+		return nil, fmt.Errorf("unknown schema %s", ref)
+	}
+	return schema, nil
+}
+
+// responseRef returns the response a local $ref names
+func (d *Document) responseRef(ref string) (*Response, error) {
+	name, ok := strings.CutPrefix(ref, "#/components/responses/")
+	if !ok {
+		return nil, fmt.Errorf("unsupported $ref %s", ref)
+	}
+	response, ok := d.Components.Responses[name]
+	if !ok || response == nil {
+		return nil, fmt.Errorf("unknown response %s", ref)
+	}
+	return response, nil
+}
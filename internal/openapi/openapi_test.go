@@ -0,0 +1,175 @@
+package openapi
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ordersSpec = `
+openapi: 3.0.3
+paths:
+  /orders:
+    get:
+      operationId: listOrders
+      responses:
+        "200":
+          content:
+            application/json:
+              schema:
+                type: array
+                items:
+                  $ref: "#/components/schemas/Order"
+  /orders/{id}:
+    get:
+      operationId: getOrder
+      responses:
+        "200":
+          content:
+            application/json:
+              schema:
+                $ref: "#/components/schemas/Order"
+        4XX:
+          $ref: "#/components/responses/Error"
+  /orders/latest:
+    get:
+      responses:
+        default:
+          content:
+            "*/*": {}
+components:
+  schemas:
+    Order:
+      type: object
+      required: [id, status]
+      properties:
+        id:
+          type: integer
+        status:
+          type: string
+          enum: [open, shipped]
+  responses:
+    Error:
+      content:
+        application/problem+json:
+          schema:
+            type: object
+            required: [title]
+`
+
+func TestParseAndLookup(t *testing.T) {
+	doc, err := Parse([]byte(ordersSpec))
+	require.NoError(t, err)
+
+	operation, path := doc.Operation(http.MethodGet, "/orders/42")
+	if assert.NotNil(t, operation) {
+		assert.Equal(t, "getOrder", operation.OperationID)
+		assert.Equal(t, "/orders/{id}", path)
+	}
+
+	// Literal paths win over templates
+	_, path = doc.Operation(http.MethodGet, "/orders/latest")
+	assert.Equal(t, "/orders/latest", path)
+
+	// HEAD is served by GET
+	operation, _ = doc.Operation(http.MethodHead, "/orders")
+	if assert.NotNil(t, operation) {
+		assert.Equal(t, "listOrders", operation.OperationID)
+	}
+
+	operation, path = doc.Operation(http.MethodPost, "/orders")
+	assert.Nil(t, operation)
+	assert.Equal(t, "/orders", path)
+	operation, _ = doc.Operation(http.MethodGet, "/customers")
+	assert.Nil(t, operation)
+
+	// Responses by status, range and default
+	operation, _ = doc.Operation(http.MethodGet, "/orders/42")
+	assert.NotNil(t, operation.Response(200))
+	notFound := operation.Response(404)
+	if assert.NotNil(t, notFound) {
+		schema, ok := notFound.Schema("application/problem+json; charset=utf-8")
+		assert.True(t, ok)
+		assert.NotNil(t, schema)
+	}
+	assert.Nil(t, operation.Response(500))
+
+	latest, _ := doc.Operation(http.MethodGet, "/orders/latest")
+	schema, ok := latest.Response(503).Schema("text/plain")
+	assert.True(t, ok)
+	assert.Nil(t, schema)
+
+	_, ok = operation.Response(200).Schema("text/html")
+	assert.False(t, ok)
+}
+
+func TestServerBasePath(t *testing.T) {
+	doc, err := Parse([]byte("servers:\n  - url: https://api.example.com/v1/\npaths:\n  /orders/{id}:\n    get:\n      operationId: getOrder\n"))
+	require.NoError(t, err)
+
+	// Paths are relative to the server URL
+	operation, path := doc.Operation(http.MethodGet, "/v1/orders/42")
+	if assert.NotNil(t, operation) {
+		assert.Equal(t, "getOrder", operation.OperationID)
+		assert.Equal(t, "/orders/{id}", path)
+	}
+	operation, _ = doc.Operation(http.MethodGet, "/v10/orders/42")
+	assert.Nil(t, operation)
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := Parse([]byte("openapi: 3.0.3\n"))
+	assert.ErrorContains(t, err, "no paths")
+
+	_, err = Parse([]byte(`
+paths:
+  /orders:
+    get:
+      responses:
+        "200":
+          content:
+            application/json:
+              schema:
+                $ref: "#/components/schemas/Missing"
+`))
+	assert.ErrorContains(t, err, "unknown schema #/components/schemas/Missing")
+
+	_, err = Parse([]byte(`
+paths:
+  /orders:
+    get:
+      responses:
+        "200":
+          content:
+            application/json:
+              schema:
+                $ref: "other.yaml#/Order"
+`))
+	assert.ErrorContains(t, err, "unsupported $ref")
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"paths": {"/orders": {"get": {"responses": {"204": {}}}}}}`), 0644))
+
+	doc, err := Load(path)
+	require.NoError(t, err)
+	operation, _ := doc.Operation(http.MethodGet, "/orders/")
+	if assert.NotNil(t, operation) {
+		assert.False(t, operation.Response(204).Documented())
+	}
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestIsJSON(t *testing.T) {
+	assert.True(t, IsJSON("application/json; charset=utf-8"))
+	assert.True(t, IsJSON("application/problem+json"))
+	assert.False(t, IsJSON("text/html"))
+	assert.False(t, IsJSON(""))
+}
@@ -0,0 +1,336 @@
+package openapi
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxErrors bounds the mismatches reported for one value
+const maxErrors = 10
+
+// Schema is the subset of an OpenAPI schema object checked by Validate:
+// types, nullability, enums, object properties, array items, composition
+// and the numeric, length and pattern constraints. Formats aren't checked.
+type Schema struct {
+	Ref                  string                `yaml:"$ref"`
+	Type                 Types                 `yaml:"type"`
+	Nullable             bool                  `yaml:"nullable"`
+	Enum                 []any                 `yaml:"enum"`
+	Properties           map[string]*Schema    `yaml:"properties"`
+	Required             []string              `yaml:"required"`
+	AdditionalProperties *AdditionalProperties `yaml:"additionalProperties"`
+	Items                *Schema               `yaml:"items"`
+	AllOf                []*Schema             `yaml:"allOf"`
+	AnyOf                []*Schema             `yaml:"anyOf"`
+	OneOf                []*Schema             `yaml:"oneOf"`
+	Not                  *Schema               `yaml:"not"`
+	Minimum              *float64              `yaml:"minimum"`
+	Maximum              *float64              `yaml:"maximum"`
+	MinLength            *int                  `yaml:"minLength"`
+	MaxLength            *int                  `yaml:"maxLength"`
+	MinItems             *int                  `yaml:"minItems"`
+	MaxItems             *int                  `yaml:"maxItems"`
+	Pattern              string                `yaml:"pattern"`
+
+	// The schema $ref names
+	resolved *Schema
+	// Pattern compiled on first use
+	patternOnce sync.Once
+	pattern     *regexp.Regexp
+}
+
+// Types holds the type of a schema, a single name in OpenAPI 3.0 and a name
+// or a list in 3.1
+type Types []string
+
+// UnmarshalYAML accepts a type name or a list of them
+func (t *Types) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*t = Types{node.Value}
+		return nil
+	}
+	var types []string
+	if err := node.Decode(&types); err != nil {
+		return err
+	}
+	*t = types
+	return nil
+}
+
+// AdditionalProperties is false, true or the schema of properties not listed
+type AdditionalProperties struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+// UnmarshalYAML accepts a boolean or a schema
+func (a *AdditionalProperties) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&a.Allowed)
+	}
+	a.Allowed = true
+	return node.Decode(&a.Schema)
+}
+
+// Errors lists the places where a value doesn't match its schema
+type Errors []string
+
+// Error joins the mismatches
+func (e Errors) Error() string {
+	return strings.Join(e, "; ")
+}
+
+// Validate checks a value decoded by encoding/json against the schema. The
+// error is of type Errors and lists up to ten mismatches.
+func (s *Schema) Validate(value any) error {
+	var errs Errors
+	s.validate(value, "", &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// validate appends the mismatches of value at path to errs
+func (s *Schema) validate(value any, path string, errs *Errors) {
+	if s == nil || len(*errs) >= maxErrors {
+		return
+	}
+	if s.resolved != nil {
+		s.resolved.validate(value, path, errs)
+		return
+	}
+
+	if value == nil && (s.Nullable || s.allows("null")) {
+		return
+	}
+	if len(s.Type) > 0 && !s.typeMatches(value) {
+		s.fail(errs, path, "expected %s, got %s", strings.Join(s.Type, " or "), typeName(value))
+		return
+	}
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		s.fail(errs, path, "value is not one of the allowed values")
+	}
+
+	switch value := value.(type) {
+	case map[string]any:
+		s.validateObject(value, path, errs)
+	case []any:
+		s.validateArray(value, path, errs)
+	case string:
+		s.validateString(value, path, errs)
+	case float64:
+		if s.Minimum != nil && value < *s.Minimum {
+			s.fail(errs, path, "%v is less than the minimum %v", value, *s.Minimum)
+		}
+		if s.Maximum != nil && value > *s.Maximum {
+			s.fail(errs, path, "%v is greater than the maximum %v", value, *s.Maximum)
+		}
+	}
+
+	for _, sub := range s.AllOf {
+		sub.validate(value, path, errs)
+	}
+	if len(s.AnyOf) > 0 && countMatches(s.AnyOf, value) == 0 {
+		s.fail(errs, path, "value matches none of anyOf")
+	}
+	if len(s.OneOf) > 0 {
+		if matches := countMatches(s.OneOf, value); matches != 1 {
+			s.fail(errs, path, "value matches %d of oneOf instead of one", matches)
+		}
+	}
+	if s.Not != nil && s.Not.Validate(value) == nil {
+		s.fail(errs, path, "value matches not")
+	}
+}
+
+// validateObject checks required, listed and additional properties
+func (s *Schema) validateObject(object map[string]any, path string, errs *Errors) {
+	for _, name := range s.Required {
+		if _, ok := object[name]; !ok {
+			s.fail(errs, path, "missing required property %s", name)
+		}
+	}
+
+	// Visit properties in order so the reported mismatches are stable
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if property, ok := s.Properties[name]; ok {
+			property.validate(object[name], path+"/"+name, errs)
+			continue
+		}
+		if s.AdditionalProperties == nil {
+			continue
+		}
+		if !s.AdditionalProperties.Allowed {
+			s.fail(errs, path, "unexpected property %s", name)
+			continue
+		}
+		s.AdditionalProperties.Schema.validate(object[name], path+"/"+name, errs)
+	}
+}
+
+// validateArray checks the length and items of an array
+func (s *Schema) validateArray(array []any, path string, errs *Errors) {
+	if s.MinItems != nil && len(array) < *s.MinItems {
+		s.fail(errs, path, "%d items, fewer than %d", len(array), *s.MinItems)
+	}
+	if s.MaxItems != nil && len(array) > *s.MaxItems {
+		s.fail(errs, path, "%d items, more than %d", len(array), *s.MaxItems)
+	}
+	for i, item := range array {
+		s.Items.validate(item, fmt.Sprintf("%s/%d", path, i), errs)
+	}
+}
+
+// validateString checks the length and pattern of a string
+func (s *Schema) validateString(value, path string, errs *Errors) {
+	length := utf8.RuneCountInString(value)
+	if s.MinLength != nil && length < *s.MinLength {
+		s.fail(errs, path, "string shorter than %d", *s.MinLength)
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		s.fail(errs, path, "string longer than %d", *s.MaxLength)
+	}
+	if s.Pattern != "" {
+		s.patternOnce.Do(func() {
+			// Patterns Go can't compile are not checked
+			s.pattern, _ = regexp.Compile(s.Pattern)
+		})
+		if s.pattern != nil && !s.pattern.MatchString(value) {
+			s.fail(errs, path, "string doesn't match pattern %s", s.Pattern)
+		}
+	}
+}
+
+// typeMatches reports whether value is of one of the schema's types
+func (s *Schema) typeMatches(value any) bool {
+	for _, name := range s.Type {
+		switch name {
+		case "object":
+			if _, ok := value.(map[string]any); ok {
+				return true
+			}
+		case "array":
+			if _, ok := value.([]any); ok {
+				return true
+			}
+		case "string":
+			if _, ok := value.(string); ok {
+				return true
+			}
+		case "number":
+			if _, ok := value.(float64); ok {
+				return true
+			}
+		case "integer":
+			if number, ok := value.(float64); ok && number == math.Trunc(number) {
+				return true
+			}
+		case "boolean":
+			if _, ok := value.(bool); ok {
+				return true
+			}
+		case "null":
+			if value == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allows reports whether the schema lists a type
+func (s *Schema) allows(name string) bool {
+	for _, t := range s.Type {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// fail records a mismatch at path
+func (s *Schema) fail(errs *Errors, path, format string, args ...any) {
+	if len(*errs) >= maxErrors {
+		return
+	}
+	if path == "" {
+		path = "/"
+	}
+	*errs = append(*errs, path+": "+fmt.Sprintf(format, args...))
+}
+
+// countMatches returns how many schemas a value matches
+func countMatches(schemas []*Schema, value any) int {
+	matches := 0
+	for _, schema := range schemas {
+		if schema.Validate(value) == nil {
+			matches++
+		}
+	}
+	return matches
+}
+
+// inEnum reports whether value is one of the enum's values, comparing
+// numbers by value as YAML and JSON decode them to different types
+func inEnum(enum []any, value any) bool {
+	for _, allowed := range enum {
+		if a, ok := toFloat(allowed); ok {
+			if v, ok := toFloat(value); ok && a == v {
+				return true
+			}
+			continue
+		}
+		if reflect.DeepEqual(allowed, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// toFloat converts a decoded number to float64
+func toFloat(value any) (float64, bool) {
+	switch value := value.(type) {
+	case int:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	case uint64:
+		return float64(value), true
+	case float64:
+		return value, true
+	}
+	return 0, false
+}
+
+// typeName returns the JSON type of a decoded value
+func typeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,150 @@
+package openapi
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// parseSchema parses a schema written in YAML
+func parseSchema(t *testing.T, source string) *Schema {
+	var schema Schema
+	require.NoError(t, yaml.Unmarshal([]byte(source), &schema))
+	return &schema
+}
+
+// decode decodes a JSON value like the response validator does
+func decode(t *testing.T, source string) any {
+	var value any
+	require.NoError(t, json.Unmarshal([]byte(source), &value))
+	return value
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema := parseSchema(t, `
+type: object
+required: [id, status, items]
+additionalProperties: false
+properties:
+  id:
+    type: integer
+    minimum: 1
+  status:
+    type: string
+    enum: [open, shipped]
+  note:
+    type: string
+    nullable: true
+    maxLength: 5
+  code:
+    type: string
+    pattern: "^[A-Z]{3}$"
+  items:
+    type: array
+    minItems: 1
+    items:
+      type: object
+      required: [sku]
+      additionalProperties:
+        type: number
+      properties:
+        sku:
+          type: [string, "null"]
+`)
+
+	tests := []struct {
+		name  string
+		value string
+		err   string
+	}{
+		{"valid", `{"id": 1, "status": "open", "note": null, "code": "ABC", "items": [{"sku": "a", "qty": 2}]}`, ""},
+		{"missing property", `{"id": 1, "items": [{"sku": null}]}`, "/: missing required property status"},
+		{"wrong type", `{"id": "1", "status": "open", "items": [{"sku": "a"}]}`, "/id: expected integer, got string"},
+		{"fraction for integer", `{"id": 1.5, "status": "open", "items": [{"sku": "a"}]}`, "/id: expected integer, got number"},
+		{"minimum", `{"id": 0, "status": "open", "items": [{"sku": "a"}]}`, "/id: 0 is less than the minimum 1"},
+		{"enum", `{"id": 1, "status": "lost", "items": [{"sku": "a"}]}`, "/status: value is not one of the allowed values"},
+		{"max length", `{"id": 1, "status": "open", "note": "too long", "items": [{"sku": "a"}]}`, "/note: string longer than 5"},
+		{"pattern", `{"id": 1, "status": "open", "code": "abc", "items": [{"sku": "a"}]}`, "/code: string doesn't match pattern ^[A-Z]{3}$"},
+		{"min items", `{"id": 1, "status": "open", "items": []}`, "/items: 0 items, fewer than 1"},
+		{"nested item", `{"id": 1, "status": "open", "items": [{"sku": "a"}, {"sku": 2}]}`, "/items/1/sku: expected string or null, got number"},
+		{"additional property schema", `{"id": 1, "status": "open", "items": [{"sku": "a", "qty": "2"}]}`, "/items/0/qty: expected number, got string"},
+		{"unexpected property", `{"id": 1, "status": "open", "items": [{"sku": "a"}], "extra": true}`, "/: unexpected property extra"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := schema.Validate(decode(t, tt.value))
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSchemaComposition(t *testing.T) {
+	schema := parseSchema(t, `
+oneOf:
+  - type: string
+  - type: integer
+  - type: number
+`)
+	assert.NoError(t, schema.Validate(decode(t, `"a"`)))
+	assert.EqualError(t, schema.Validate(decode(t, `2`)), "/: value matches 2 of oneOf instead of one")
+	assert.EqualError(t, schema.Validate(decode(t, `true`)), "/: value matches 0 of oneOf instead of one")
+
+	schema = parseSchema(t, `
+allOf:
+  - required: [a]
+  - required: [b]
+anyOf:
+  - properties: {a: {type: string}}
+  - properties: {a: {type: integer}}
+not:
+  required: [c]
+`)
+	assert.NoError(t, schema.Validate(decode(t, `{"a": 1, "b": 2}`)))
+	assert.EqualError(t, schema.Validate(decode(t, `{"a": true, "c": 3}`)),
+		"/: missing required property b; /: value matches none of anyOf; /: value matches not")
+}
+
+func TestSchemaRecursiveRef(t *testing.T) {
+	doc, err := Parse([]byte(`
+paths:
+  /tree:
+    get:
+      responses:
+        "200":
+          content:
+            application/json:
+              schema:
+                $ref: "#/components/schemas/Node"
+components:
+  schemas:
+    Node:
+      type: object
+      properties:
+        children:
+          type: array
+          items:
+            $ref: "#/components/schemas/Node"
+`))
+	require.NoError(t, err)
+	operation, _ := doc.Operation("GET", "/tree")
+	schema, _ := operation.Response(200).Schema("application/json")
+
+	assert.NoError(t, schema.Validate(decode(t, `{"children": [{"children": []}]}`)))
+	assert.EqualError(t, schema.Validate(decode(t, `{"children": [{"children": [1]}]}`)),
+		"/children/0/children/0: expected object, got number")
+}
+
+func TestSchemaErrorLimit(t *testing.T) {
+	schema := parseSchema(t, "type: array\nitems:\n  type: string\n")
+	err := schema.Validate(decode(t, `[1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12]`))
+	if assert.Error(t, err) {
+		assert.Len(t, err.(Errors), maxErrors)
+	}
+}
@@ -0,0 +1,59 @@
+package portal
+
+import (
+	"html/template"
+	"net/http"
+)
+
+// confirmPage asks the developer to confirm a signup. Following the emailed
+// link only shows this page, so mail scanners opening the link don't use it
+// up before the developer sees the key.
+var confirmPage = template.Must(template.New("confirm").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Confirm your API key</title></head>
+<body>
+<h1>Confirm your API key</h1>
+<p>Issue an API key for {{.Email}}{{if .Name}} ({{.Name}}){{end}}. The key is shown only once.</p>
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit">Issue API key</button>
+</form>
+</body>
+</html>
+`))
+
+// keyPage shows a newly issued key
+var keyPage = template.Must(template.New("key").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Your API key</title></head>
+<body>
+<h1>Your API key</h1>
+<p>Send this key in the {{.Header}} header. Copy it now, it won't be shown again.</p>
+<pre>{{.Key}}</pre>
+<p>Key ID: {{.ID}}</p>
+</body>
+</html>
+`))
+
+// errorPage shows why a verification link can't be used
+var errorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>API key signup</title></head>
+<body>
+<h1>API key signup</h1>
+<p>{{.}}</p>
+</body>
+</html>
+`))
+
+// writePage renders an HTML page. Pages carrying verification tokens or keys
+// aren't cached, framed or sent as referrers.
+func writePage(w http.ResponseWriter, status int, page *template.Template, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; form-action 'self'")
+	w.WriteHeader(status)
+	page.Execute(w, data)
+}
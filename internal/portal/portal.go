@@ -0,0 +1,325 @@
+package portal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/config"
+	"api-gateway/internal/util"
+	"api-gateway/pkg/logger"
+
+	"github.com/gorilla/mux"
+)
+
+// storeSaveInterval is how often key usage is written to the store file
+const storeSaveInterval = time.Minute
+
+// Portal serves the developer portal: API key signup verified through a
+// webhook that emails the developer, per-key usage and the API docs
+type Portal struct {
+	config    *config.PortalConfig
+	keyHeader string
+	store     *keyStore
+	signups   *signupLimiter
+	client    *http.Client
+	log       logger.Logger
+	now       func() time.Time
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// signupRequest is the body of a key signup
+type signupRequest struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+// verificationEvent is POSTed to the verification webhook, which emails the
+// link to the developer
+type verificationEvent struct {
+	Type      string    `json:"type"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	VerifyURL string    `json:"verify_url"`
+	Expires   time.Time `json:"expires"`
+}
+
+// dayUsage is a key's requests on one UTC day
+type dayUsage struct {
+	Date     string `json:"date"`
+	Requests int64  `json:"requests"`
+}
+
+// New creates the portal, loading the keys it issued before. Keys are read
+// from requests through keyHeader, the gateway's API key header.
+func New(cfg *config.PortalConfig, keyHeader string, log logger.Logger) (*Portal, error) {
+	store, err := newKeyStore(cfg.StoreFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Portal{
+		config:    cfg,
+		keyHeader: keyHeader,
+		store:     store,
+		signups:   newSignupLimiter(cfg.SignupsPerHour),
+		client:    &http.Client{Timeout: 5 * time.Second},
+		log:       log,
+		now:       time.Now,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// Register adds the portal endpoints under the configured prefix. docs serves
+// the aggregated API docs.
+func (p *Portal) Register(router *mux.Router, docs http.Handler) {
+	prefix := strings.TrimSuffix(p.config.PathPrefix, "/")
+	router.HandleFunc(prefix+"/keys", p.signupHandler).Methods("POST")
+	router.HandleFunc(prefix+"/verify", p.confirmHandler).Methods("GET")
+	router.HandleFunc(prefix+"/verify", p.verifyHandler).Methods("POST")
+	router.HandleFunc(prefix+"/usage", p.usageHandler).Methods("GET")
+	router.Handle(prefix+"/docs", docs).Methods("GET")
+}
+
+// Start periodically saves key usage to the store file
+func (p *Portal) Start() {
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(storeSaveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.save()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends periodic saving and saves the keys and usage
+func (p *Portal) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+		<-p.done
+		p.save()
+	})
+}
+
+// LookupKey resolves keys issued by the portal for the auth service, counting
+// the request against the key's usage and daily quota
+func (p *Portal) LookupKey(token string) (*auth.Identity, error) {
+	id, requests, ok := p.store.use(token, p.now(), p.config.DailyQuota)
+	if !ok {
+		return nil, nil
+	}
+	if p.config.DailyQuota > 0 && requests > int64(p.config.DailyQuota) {
+		return nil, auth.ErrQuotaExceeded
+	}
+	return &auth.Identity{Type: auth.IdentityAPIKey, Subject: id, Role: p.config.KeyRole}, nil
+}
+
+// signupHandler records a signup and sends its verification link through
+// the webhook. Signups are limited per client address; forwarding headers
+// can be forged, so only the connection's address counts.
+func (p *Portal) signupHandler(w http.ResponseWriter, r *http.Request) {
+	addr, _ := util.ConnectionAddr(r)
+	if allowed, wait := p.signups.allow(addr, p.now()); !allowed {
+		p.log.Warn("Rejected portal signup over the per-client limit",
+			logger.String("remote_addr", r.RemoteAddr),
+		)
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		writeError(w, http.StatusTooManyRequests, "Too many signups, try again later")
+		return
+	}
+
+	var req signupRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	address, err := mail.ParseAddress(req.Email)
+	if err != nil || address.Name != "" {
+		writeError(w, http.StatusBadRequest, "A valid email address is required")
+		return
+	}
+
+	expires := p.now().Add(time.Duration(p.config.VerificationTTL) * time.Second)
+	token, err := p.store.addPending(address.Address, req.Name, expires)
+	if errors.Is(err, errTooManyPending) {
+		writeError(w, http.StatusServiceUnavailable, "Signups are temporarily unavailable")
+		return
+	}
+	if err != nil {
+		p.log.Error("Failed to record portal signup", logger.Error(err))
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	event := verificationEvent{
+		Type:      "api_key_verification",
+		Email:     address.Address,
+		Name:      req.Name,
+		VerifyURL: p.verifyURL(token),
+		Expires:   expires,
+	}
+	if err := p.sendVerification(event); err != nil {
+		p.store.removePending(token)
+		p.log.Error("Failed to send portal verification",
+			logger.String("webhook", p.config.VerificationWebhook),
+			logger.Error(err),
+		)
+		writeError(w, http.StatusBadGateway, "Failed to send the verification email")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"status":  "verification_sent",
+		"email":   address.Address,
+		"expires": expires,
+	})
+}
+
+// confirmHandler shows the page confirming a signup. The link's token is
+// only used up when the page's form is submitted.
+func (p *Portal) confirmHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	signup, ok := p.store.lookupPending(token, p.now())
+	if !ok {
+		writePage(w, http.StatusNotFound, errorPage, "Unknown or expired verification link.")
+		return
+	}
+	writePage(w, http.StatusOK, confirmPage, map[string]string{
+		"Email":  signup.Email,
+		"Name":   signup.Name,
+		"Token":  token,
+		"Action": strings.TrimSuffix(p.config.PathPrefix, "/") + "/verify",
+	})
+}
+
+// verifyHandler issues a key for a verified signup. The key is only shown in
+// this response, as JSON to clients accepting it and as a page otherwise.
+func (p *Portal) verifyHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	key, record, ok, err := p.store.verify(r.FormValue("token"), p.now())
+	asJSON := strings.Contains(r.Header.Get("Accept"), "application/json")
+	if err != nil {
+		p.log.Error("Failed to issue portal API key", logger.Error(err))
+		if asJSON {
+			writeError(w, http.StatusInternalServerError, "Internal server error")
+		} else {
+			writePage(w, http.StatusInternalServerError, errorPage, "Internal server error.")
+		}
+		return
+	}
+	if !ok {
+		if asJSON {
+			writeError(w, http.StatusNotFound, "Unknown or expired verification link")
+		} else {
+			writePage(w, http.StatusNotFound, errorPage, "Unknown or expired verification link.")
+		}
+		return
+	}
+	p.save()
+
+	p.log.Info("Issued portal API key",
+		logger.String("id", record.ID),
+		logger.String("email", record.Email),
+	)
+	if !asJSON {
+		writePage(w, http.StatusCreated, keyPage, map[string]string{
+			"ID":     record.ID,
+			"Key":    key,
+			"Header": p.keyHeader,
+		})
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"id":     record.ID,
+		"key":    key,
+		"header": p.keyHeader,
+		"email":  record.Email,
+		"name":   record.Name,
+	})
+}
+
+// usageHandler reports the daily usage of the key sent with the request
+func (p *Portal) usageHandler(w http.ResponseWriter, r *http.Request) {
+	record, days, ok := p.store.usage(r.Header.Get(p.keyHeader))
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "A portal API key is required")
+		return
+	}
+
+	today := p.now().UTC().Format(time.DateOnly)
+	var requestsToday int64
+	for _, day := range days {
+		if day.Date == today {
+			requestsToday = day.Requests
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":             record.ID,
+		"name":           record.Name,
+		"created":        record.Created,
+		"daily_quota":    p.config.DailyQuota,
+		"requests_today": requestsToday,
+		"days":           days,
+	})
+}
+
+// verifyURL returns the verification link of a signup
+func (p *Portal) verifyURL(token string) string {
+	return strings.TrimSuffix(p.config.PublicURL, "/") + strings.TrimSuffix(p.config.PathPrefix, "/") +
+		"/verify?" + url.Values{"token": {token}}.Encode()
+}
+
+// sendVerification POSTs a verification event to the webhook
+func (p *Portal) sendVerification(event verificationEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Post(p.config.VerificationWebhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// save writes the store file, logging failures
+func (p *Portal) save() {
+	if err := p.store.save(); err != nil {
+		p.log.Error("Failed to save portal store", logger.Error(err))
+	}
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,203 @@
+package portal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockLogger implements the logger.Logger interface for testing
+type mockLogger struct{}
+
+func (m *mockLogger) Debug(msg string, fields ...logger.Field)  {}
+func (m *mockLogger) Info(msg string, fields ...logger.Field)   {}
+func (m *mockLogger) Warn(msg string, fields ...logger.Field)   {}
+func (m *mockLogger) Error(msg string, fields ...logger.Field)  {}
+func (m *mockLogger) Fatal(msg string, fields ...logger.Field)  {}
+func (m *mockLogger) With(fields ...logger.Field) logger.Logger { return m }
+
+func newTestPortal(t *testing.T, webhook string, quota int) (*Portal, *mux.Router) {
+	p, err := New(&config.PortalConfig{
+		Enabled:             true,
+		PathPrefix:          "/portal",
+		PublicURL:           "https://api.example.com",
+		VerificationWebhook: webhook,
+		VerificationTTL:     3600,
+		KeyRole:             "developer",
+		DailyQuota:          quota,
+		SignupsPerHour:      3,
+	}, "X-API-Key", &mockLogger{})
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	p.Register(router, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"routes":[]}`))
+	}))
+	return p, router
+}
+
+func serve(router http.Handler, req *http.Request) (*httptest.ResponseRecorder, map[string]interface{}) {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var body map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	return rec, body
+}
+
+func TestPortalSignupAndUsage(t *testing.T) {
+	var event verificationEvent
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&event)
+	}))
+	defer webhook.Close()
+	p, router := newTestPortal(t, webhook.URL, 2)
+
+	// Signing up sends the verification link through the webhook
+	rec, _ := serve(router, httptest.NewRequest("POST", "/portal/keys", strings.NewReader(`{"email":"dev@example.com","name":"Reports app"}`)))
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "dev@example.com", event.Email)
+	require.True(t, strings.HasPrefix(event.VerifyURL, "https://api.example.com/portal/verify?token="))
+
+	// Following the link only shows the confirmation page, so link scanners
+	// don't use it up
+	link, err := url.Parse(event.VerifyURL)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		rec, _ = serve(router, httptest.NewRequest("GET", link.RequestURI(), nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+		assert.Contains(t, rec.Body.String(), `<form method="post" action="/portal/verify">`)
+		assert.Contains(t, rec.Body.String(), `value="`+link.Query().Get("token")+`"`)
+	}
+
+	// Confirming issues the key once
+	confirm := func() *http.Request {
+		req := httptest.NewRequest("POST", "/portal/verify", strings.NewReader(url.Values{"token": {link.Query().Get("token")}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept", "application/json")
+		return req
+	}
+	rec, issued := serve(router, confirm())
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	key := issued["key"].(string)
+	rec, _ = serve(router, confirm())
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec, _ = serve(router, httptest.NewRequest("GET", link.RequestURI(), nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// Requests authenticate until the daily quota is used up
+	identity, err := p.LookupKey(key)
+	require.NoError(t, err)
+	assert.Equal(t, &auth.Identity{Type: auth.IdentityAPIKey, Subject: issued["id"].(string), Role: "developer"}, identity)
+	_, err = p.LookupKey(key)
+	require.NoError(t, err)
+	_, err = p.LookupKey(key)
+	assert.ErrorIs(t, err, auth.ErrQuotaExceeded)
+
+	identity, err = p.LookupKey("unknown")
+	assert.NoError(t, err)
+	assert.Nil(t, identity)
+
+	req := httptest.NewRequest("GET", "/portal/usage", nil)
+	req.Header.Set("X-API-Key", key)
+	rec, usage := serve(router, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, float64(2), usage["requests_today"])
+	assert.Equal(t, float64(2), usage["daily_quota"])
+
+	rec, _ = serve(router, httptest.NewRequest("GET", "/portal/usage", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestPortalSignupValidation(t *testing.T) {
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer webhook.Close()
+	p, router := newTestPortal(t, webhook.URL, 0)
+
+	rec, _ := serve(router, httptest.NewRequest("POST", "/portal/keys", strings.NewReader(`{"email":"not an address"}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Signups whose verification can't be sent are dropped
+	rec, _ = serve(router, httptest.NewRequest("POST", "/portal/keys", strings.NewReader(`{"email":"dev@example.com"}`)))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Empty(t, p.store.pending)
+}
+
+func TestPortalVerifyPage(t *testing.T) {
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer webhook.Close()
+	p, router := newTestPortal(t, webhook.URL, 0)
+
+	token, err := p.store.addPending("dev@example.com", "<b>app</b>", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	rec, _ := serve(router, httptest.NewRequest("GET", "/portal/verify?token="+token, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "&lt;b&gt;app&lt;/b&gt;")
+
+	// Submitting the page's form shows the key on a page
+	req := httptest.NewRequest("POST", "/portal/verify", strings.NewReader("token="+token))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec, _ = serve(router, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	assert.Contains(t, rec.Body.String(), "<pre>gwk_")
+}
+
+func TestPortalSignupRateLimit(t *testing.T) {
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer webhook.Close()
+	p, router := newTestPortal(t, webhook.URL, 0)
+	start := time.Now()
+	p.now = func() time.Time { return start }
+
+	signup := func(remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest("POST", "/portal/keys", strings.NewReader(`{"email":"dev@example.com"}`))
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		rec, _ := serve(router, req)
+		return rec.Code
+	}
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusAccepted, signup("203.0.113.7:4000", "198.51.100.1"))
+	}
+	// Forwarding headers and other addresses of an IPv6 client's /64 don't
+	// get around the limit
+	assert.Equal(t, http.StatusTooManyRequests, signup("203.0.113.7:4001", "198.51.100.2"))
+	assert.Equal(t, http.StatusAccepted, signup("203.0.113.8:4000", ""))
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusAccepted, signup(fmt.Sprintf("[2001:db8::%d]:4000", i), ""))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, signup("[2001:db8::ff]:4000", ""))
+
+	// The limit resets after an hour
+	p.now = func() time.Time { return start.Add(time.Hour) }
+	assert.Equal(t, http.StatusAccepted, signup("203.0.113.7:4000", ""))
+}
+
+func TestPortalVerificationExpires(t *testing.T) {
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer webhook.Close()
+	p, _ := newTestPortal(t, webhook.URL, 0)
+
+	token, err := p.store.addPending("dev@example.com", "", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	_, _, ok, err := p.store.verify(token, time.Now().Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,80 @@
+package portal
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// signupWindow is the length of the window signups are counted in
+const signupWindow = time.Hour
+
+// maxSignupClients caps the client addresses tracked by the signup limiter
+const maxSignupClients = 10000
+
+// signupLimiter caps the signups each client address makes per hour, so the
+// verification webhook can't be used to send mass email. IPv6 clients are
+// counted by /64 since they usually control the whole prefix.
+type signupLimiter struct {
+	limit   int
+	mutex   sync.Mutex
+	clients map[netip.Prefix]*signupCount
+}
+
+// signupCount is a client's signups in the current window
+type signupCount struct {
+	start time.Time
+	count int
+}
+
+// newSignupLimiter creates a limiter allowing limit signups per client per hour
+func newSignupLimiter(limit int) *signupLimiter {
+	return &signupLimiter{
+		limit:   limit,
+		clients: make(map[netip.Prefix]*signupCount),
+	}
+}
+
+// allow counts a signup from addr, reporting whether it is within the limit
+// and otherwise how long until the client may sign up again. When too many
+// clients are tracked, signups are refused until their windows end.
+func (l *signupLimiter) allow(addr netip.Addr, now time.Time) (bool, time.Duration) {
+	bits := 32
+	if addr.Is6() {
+		bits = 64
+	}
+	client, _ := addr.Prefix(bits)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	count, ok := l.clients[client]
+	if ok && now.Sub(count.start) >= signupWindow {
+		delete(l.clients, client)
+		ok = false
+	}
+	if !ok {
+		if len(l.clients) >= maxSignupClients {
+			l.prune(now)
+			if len(l.clients) >= maxSignupClients {
+				return false, signupWindow
+			}
+		}
+		count = &signupCount{start: now}
+		l.clients[client] = count
+	}
+	if count.count >= l.limit {
+		return false, count.start.Add(signupWindow).Sub(now)
+	}
+	count.count++
+	return true, 0
+}
+
+// prune drops clients whose window ended. The caller must hold the mutex.
+func (l *signupLimiter) prune(now time.Time) {
+	for client, count := range l.clients {
+		if now.Sub(count.start) >= signupWindow {
+			delete(l.clients, client)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package portal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// usageDays is how many days of per-key usage are kept
+const usageDays = 30
+
+// maxPending caps unverified signups so they can't exhaust memory
+const maxPending = 10000
+
+var errTooManyPending = errors.New("too many pending signups")
+
+// apiKey is a key issued through the portal. Only the hash of the key is
+// kept; the key itself is shown once when the signup is verified.
+type apiKey struct {
+	ID      string           `json:"id"`
+	Email   string           `json:"email"`
+	Name    string           `json:"name"`
+	Created time.Time        `json:"created"`
+	Usage   map[string]int64 `json:"usage"` // Requests by UTC day
+}
+
+// pendingSignup is a signup waiting for its email to be verified
+type pendingSignup struct {
+	Email   string
+	Name    string
+	Expires time.Time
+}
+
+// keyStore holds issued keys by key hash, their usage and pending signups.
+// Keys and usage are written to a file if one is configured.
+type keyStore struct {
+	mutex   sync.Mutex
+	keys    map[string]*apiKey
+	pending map[string]pendingSignup
+	path    string
+	dirty   bool
+}
+
+// storeFile is the on-disk form of the key store
+type storeFile struct {
+	Keys map[string]*apiKey `json:"keys"`
+}
+
+// newKeyStore creates a key store, loading keys saved at path
+func newKeyStore(path string) (*keyStore, error) {
+	s := &keyStore{
+		keys:    make(map[string]*apiKey),
+		pending: make(map[string]pendingSignup),
+		path:    path,
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read portal store: %w", err)
+	}
+	var file storeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse portal store: %w", err)
+	}
+	for hash, key := range file.Keys {
+		if key.Usage == nil {
+			key.Usage = make(map[string]int64)
+		}
+		s.keys[hash] = key
+	}
+	return s, nil
+}
+
+// addPending records a signup and returns its verification token
+func (s *keyStore) addPending(email, name string, expires time.Time) (string, error) {
+	token, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	for hash, signup := range s.pending {
+		if now.After(signup.Expires) {
+			delete(s.pending, hash)
+		}
+	}
+	if len(s.pending) >= maxPending {
+		return "", errTooManyPending
+	}
+	s.pending[hashToken(token)] = pendingSignup{Email: email, Name: name, Expires: expires}
+	return token, nil
+}
+
+// removePending drops a signup whose verification could not be sent
+func (s *keyStore) removePending(token string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.pending, hashToken(token))
+}
+
+// lookupPending returns a pending signup without verifying it, or false if
+// the token is unknown or expired
+func (s *keyStore) lookupPending(token string, now time.Time) (pendingSignup, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	signup, ok := s.pending[hashToken(token)]
+	if !ok || now.After(signup.Expires) {
+		return pendingSignup{}, false
+	}
+	return signup, true
+}
+
+// verify issues a key for a pending signup, returning the key and its record,
+// or false if the token is unknown or expired
+func (s *keyStore) verify(token string, now time.Time) (string, *apiKey, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	hash := hashToken(token)
+	signup, ok := s.pending[hash]
+	if !ok || now.After(signup.Expires) {
+		return "", nil, false, nil
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return "", nil, false, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", nil, false, err
+	}
+	delete(s.pending, hash)
+
+	key := &apiKey{
+		ID:      "key_" + id,
+		Email:   signup.Email,
+		Name:    signup.Name,
+		Created: now,
+		Usage:   make(map[string]int64),
+	}
+	s.keys[hashToken("gwk_"+secret)] = key
+	s.dirty = true
+	copied := *key
+	return "gwk_" + secret, &copied, true, nil
+}
+
+// use counts a request made with key, returning the key's ID and its requests
+// today including this one. Requests over quota are not counted.
+func (s *keyStore) use(token string, now time.Time, quota int) (string, int64, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key, ok := s.keys[hashToken(token)]
+	if !ok {
+		return "", 0, false
+	}
+	day := now.UTC().Format(time.DateOnly)
+	if quota > 0 && key.Usage[day] >= int64(quota) {
+		return key.ID, key.Usage[day] + 1, true
+	}
+	key.Usage[day]++
+	pruneUsage(key.Usage, now)
+	s.dirty = true
+	return key.ID, key.Usage[day], true
+}
+
+// usage returns a copy of a key's record and daily usage, oldest day first
+func (s *keyStore) usage(token string) (*apiKey, []dayUsage, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key, ok := s.keys[hashToken(token)]
+	if !ok {
+		return nil, nil, false
+	}
+	days := make([]dayUsage, 0, len(key.Usage))
+	for day, requests := range key.Usage {
+		days = append(days, dayUsage{Date: day, Requests: requests})
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+	copied := *key
+	copied.Usage = nil
+	return &copied, days, true
+}
+
+// save writes keys and usage to the store file if they changed
+func (s *keyStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	s.mutex.Lock()
+	if !s.dirty {
+		s.mutex.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(storeFile{Keys: s.keys})
+	s.dirty = false
+	s.mutex.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode portal store: %w", err)
+	}
+
+	// Replace the file at once so a crash never leaves it half written
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create portal store directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create portal store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write portal store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close portal store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace portal store: %w", err)
+	}
+	return nil
+}
+
+// pruneUsage drops usage older than usageDays
+func pruneUsage(usage map[string]int64, now time.Time) {
+	oldest := now.UTC().AddDate(0, 0, -usageDays+1).Format(time.DateOnly)
+	for day := range usage {
+		if day < oldest {
+			delete(usage, day)
+		}
+	}
+}
+
+// hashToken returns the hex SHA-256 of a key or verification token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomHex returns n random bytes hex encoded
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
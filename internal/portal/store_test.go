@@ -0,0 +1,49 @@
+package portal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "portal", "keys.json")
+	store, err := newKeyStore(path)
+	require.NoError(t, err)
+
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	token, err := store.addPending("dev@example.com", "app", now.Add(time.Hour))
+	require.NoError(t, err)
+	key, record, ok, err := store.verify(token, now)
+	require.NoError(t, err)
+	require.True(t, ok)
+	store.use(key, now, 0)
+	require.NoError(t, store.save())
+
+	reloaded, err := newKeyStore(path)
+	require.NoError(t, err)
+	loaded, days, ok := reloaded.usage(key)
+	require.True(t, ok)
+	assert.Equal(t, record.ID, loaded.ID)
+	assert.Equal(t, []dayUsage{{Date: "2024-03-10", Requests: 1}}, days)
+	assert.NotContains(t, reloaded.keys, key, "keys are stored hashed")
+}
+
+func TestKeyStorePrunesOldUsage(t *testing.T) {
+	store, err := newKeyStore("")
+	require.NoError(t, err)
+
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	token, err := store.addPending("dev@example.com", "", start.Add(time.Hour))
+	require.NoError(t, err)
+	key, _, _, err := store.verify(token, start)
+	require.NoError(t, err)
+
+	store.use(key, start, 0)
+	store.use(key, start.AddDate(0, 0, usageDays), 0)
+	_, days, _ := store.usage(key)
+	assert.Equal(t, []dayUsage{{Date: "2024-03-31", Requests: 1}}, days)
+}
@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// BlueGreenSwitch sends a route's requests to its active upstream group. A
+// switch starts a bake window during which the new group's error rate is
+// watched, rolling back to the previous group if it exceeds the limit.
+type BlueGreenSwitch struct {
+	path     string
+	handlers map[string]http.Handler
+	alerter  *rollbackAlerter
+	log      logger.Logger
+
+	mutex      sync.Mutex
+	active     string
+	previous   string
+	bake       bakeWindow
+	rolledBack bool
+	switchedAt time.Time
+	now        func() time.Time
+}
+
+// BlueGreenState describes a switch for the admin API
+type BlueGreenState struct {
+	Path       string     `json:"path"`
+	Active     string     `json:"active"`
+	Previous   string     `json:"previous,omitempty"`
+	SwitchedAt *time.Time `json:"switched_at,omitempty"`
+	BakeUntil  *time.Time `json:"bake_until,omitempty"`
+	RolledBack bool       `json:"rolled_back"`
+}
+
+// newBlueGreenSwitch creates a switch between the blue and green handlers
+func newBlueGreenSwitch(route config.Route, blue, green http.Handler, alerter *rollbackAlerter, log logger.Logger) *BlueGreenSwitch {
+	return &BlueGreenSwitch{
+		path: route.Path,
+		handlers: map[string]http.Handler{
+			config.DeploymentBlue:  blue,
+			config.DeploymentGreen: green,
+		},
+		alerter: alerter,
+		log:     log,
+		active:  route.BlueGreen.Active,
+		bake:    bakeWindow{guard: route.BlueGreen.Rollback},
+		now:     time.Now,
+	}
+}
+
+// ServeHTTP proxies the request to the active group
+func (s *BlueGreenSwitch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	color := s.active
+	baking := s.bake.open(s.now())
+	s.mutex.Unlock()
+
+	if !baking {
+		s.handlers[color].ServeHTTP(w, r)
+		return
+	}
+
+	crw := &customResponseWriter{ResponseWriter: w}
+	s.handlers[color].ServeHTTP(crw, r)
+	s.record(color, crw.statusCode >= http.StatusInternalServerError)
+}
+
+// Switch makes color the active group, starting a bake window if rollback
+// is enabled
+func (s *BlueGreenSwitch) Switch(color string) error {
+	if _, ok := s.handlers[color]; !ok {
+		return fmt.Errorf("unknown deployment color: %s", color)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if color == s.active {
+		return nil
+	}
+	s.previous, s.active = s.active, color
+	s.switchedAt = s.now()
+	s.rolledBack = false
+	s.bake.start(s.switchedAt)
+
+	s.log.Info("Switched blue/green deployment",
+		logger.String("path", s.path),
+		logger.String("active", s.active),
+		logger.String("previous", s.previous),
+	)
+	return nil
+}
+
+// State returns the current switch state
+func (s *BlueGreenSwitch) State() BlueGreenState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state := BlueGreenState{
+		Path:       s.path,
+		Active:     s.active,
+		Previous:   s.previous,
+		RolledBack: s.rolledBack,
+	}
+	if !s.switchedAt.IsZero() {
+		switchedAt := s.switchedAt
+		state.SwitchedAt = &switchedAt
+	}
+	if s.bake.open(s.now()) {
+		bakeUntil := s.bake.until
+		state.BakeUntil = &bakeUntil
+	}
+	return state
+}
+
+// record counts a response served while baking and rolls back once the error
+// rate exceeds the limit
+func (s *BlueGreenSwitch) record(color string, failed bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Ignore responses from before a newer switch
+	if color != s.active || !s.bake.open(s.now()) {
+		return
+	}
+	errorRate, exceeded := s.bake.record(failed)
+	if !exceeded {
+		return
+	}
+
+	s.log.Warn("Rolling back blue/green deployment after error spike",
+		logger.String("path", s.path),
+		logger.String("from", s.active),
+		logger.String("to", s.previous),
+		logger.Any("error_rate", errorRate),
+		logger.Int("requests", s.bake.total),
+	)
+	blueGreenRollbacks.WithLabelValues(s.path).Inc()
+	s.alerter.send(rollbackAlert{
+		Event:     "blue_green_rollback",
+		Path:      s.path,
+		From:      s.active,
+		To:        s.previous,
+		ErrorRate: errorRate,
+		Requests:  s.bake.total,
+		Time:      s.now(),
+	})
+	s.active, s.previous = s.previous, s.active
+	s.switchedAt = s.now()
+	s.bake.stop()
+	s.rolledBack = true
+}
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlueGreenSwitch(t *testing.T) {
+	greenStatus := http.StatusOK
+	newUpstream := func(name string, status *int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if status != nil {
+				w.WriteHeader(*status)
+			}
+			w.Write([]byte(name))
+		}))
+	}
+	blue, green := newUpstream("blue", nil), newUpstream("green", &greenStatus)
+	defer blue.Close()
+	defer green.Close()
+
+	route := config.Route{
+		Path: "/orders",
+		BlueGreen: &config.BlueGreenConfig{
+			Active: config.DeploymentBlue,
+			Blue:   &config.UpstreamGroup{Upstream: blue.URL},
+			Green:  &config.UpstreamGroup{Upstream: green.URL},
+			Rollback: &config.RollbackGuard{
+				Enabled:      true,
+				BakeWindow:   60,
+				MaxErrorRate: 50,
+				MinRequests:  4,
+			},
+		},
+		Middlewares: &config.Middlewares{},
+	}
+	p := NewHTTPProxy(&config.Config{}, &config.RouteConfig{Routes: []config.Route{route}}, &mockLogger{})
+	handler := p.ProxyRequest(route)
+	blueGreen := p.BlueGreen("/orders")
+	require.NotNil(t, blueGreen)
+
+	serve := func() string {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "http://example.com/orders", nil))
+		return rec.Body.String()
+	}
+
+	assert.Equal(t, "blue", serve())
+	assert.Error(t, blueGreen.Switch("purple"))
+
+	// A healthy green group stays active through the bake window
+	require.NoError(t, blueGreen.Switch(config.DeploymentGreen))
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, "green", serve())
+	}
+	state := blueGreen.State()
+	assert.Equal(t, config.DeploymentGreen, state.Active)
+	assert.Equal(t, config.DeploymentBlue, state.Previous)
+	assert.NotNil(t, state.BakeUntil)
+
+	// Errors after the next switch roll it back once enough requests were seen
+	require.NoError(t, blueGreen.Switch(config.DeploymentBlue))
+	require.NoError(t, blueGreen.Switch(config.DeploymentGreen))
+	greenStatus = http.StatusBadGateway
+	for i := 0; i < 4; i++ {
+		serve()
+	}
+	assert.Equal(t, "blue", serve())
+	state = blueGreen.State()
+	assert.True(t, state.RolledBack)
+	assert.Nil(t, state.BakeUntil)
+
+	// Errors after the bake window don't roll back
+	blueGreen.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	require.NoError(t, blueGreen.Switch(config.DeploymentGreen))
+	blueGreen.now = func() time.Time { return time.Now().Add(4 * time.Minute) }
+	for i := 0; i < 4; i++ {
+		serve()
+	}
+	assert.Equal(t, config.DeploymentGreen, blueGreen.State().Active)
+}
@@ -0,0 +1,37 @@
+package proxy
+
+import "sync"
+
+// proxyBufferSize matches the buffer ReverseProxy allocates per response
+// when it has no pool
+const proxyBufferSize = 32 * 1024
+
+// proxyBuffers lends reverse proxies the buffers they copy response bodies
+// through, shared by all routes
+var proxyBuffers = &bufferPool{
+	pool: sync.Pool{
+		New: func() any {
+			buf := make([]byte, proxyBufferSize)
+			return &buf
+		},
+	},
+}
+
+// bufferPool is an httputil.BufferPool over a sync.Pool
+type bufferPool struct {
+	pool sync.Pool
+}
+
+// Get returns a buffer from the pool
+func (p *bufferPool) Get() []byte {
+	return *p.pool.Get().(*[]byte)
+}
+
+// Put returns buf to the pool
+func (p *bufferPool) Put(buf []byte) {
+	if cap(buf) != proxyBufferSize {
+		return
+	}
+	buf = buf[:proxyBufferSize]
+	p.pool.Put(&buf)
+}
@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBufferPool(t *testing.T) {
+	buf := proxyBuffers.Get()
+	assert.Len(t, buf, proxyBufferSize)
+	proxyBuffers.Put(buf[:10])
+	assert.Len(t, proxyBuffers.Get(), proxyBufferSize)
+
+	// Buffers of other sizes aren't lent out again
+	proxyBuffers.Put(make([]byte, 10))
+	assert.Len(t, proxyBuffers.Get(), proxyBufferSize)
+}
+
+func TestProxyRequestStaticTargetReused(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path + " " + r.Header.Get("Authorization")))
+	}))
+	defer upstream.Close()
+
+	route := config.Route{Path: "/items", Upstream: upstream.URL, Middlewares: &config.Middlewares{}}
+	handler := NewHTTPProxy(&config.Config{}, &config.RouteConfig{Routes: []config.Route{route}}, &mockLogger{}).ProxyRequest(route)
+
+	// Requests sharing the route's proxy keep their own state
+	for query, want := range map[string]string{
+		"?token=a": "/items Bearer a",
+		"?token=b": "/items Bearer b",
+		"":         "/items ",
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items"+query, nil))
+		assert.Equal(t, want, rec.Body.String())
+	}
+}
+
+// discardResponseWriter drops what is written to it, so benchmarks measure
+// the proxy rather than a recorder
+type discardResponseWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *discardResponseWriter) Header() http.Header         { return w.header }
+func (w *discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardResponseWriter) WriteHeader(statusCode int)  { w.status = statusCode }
+
+func BenchmarkProxyRequest(b *testing.B) {
+	body := strings.Repeat("x", 64*1024)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer upstream.Close()
+
+	route := config.Route{Path: "/items", Upstream: upstream.URL, Middlewares: &config.Middlewares{}}
+	handler := NewHTTPProxy(&config.Config{}, &config.RouteConfig{Routes: []config.Route{route}}, &mockLogger{}).ProxyRequest(route)
+	req := httptest.NewRequest(http.MethodGet, "/items?token=abc", nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	w := &discardResponseWriter{header: make(http.Header)}
+	for i := 0; i < b.N; i++ {
+		clear(w.header)
+		handler.ServeHTTP(w, req)
+		if w.status != http.StatusOK {
+			b.Fatalf("unexpected status %d", w.status)
+		}
+	}
+}
@@ -1,9 +1,12 @@
 package proxy
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
@@ -44,6 +47,8 @@ type CircuitBreakerConfig struct {
 	Timeout time.Duration
 	// MaxConcurrent is the maximum number of concurrent requests (optional)
 	MaxConcurrent int
+	// Classifier decides which outcomes are failures, any 5xx if nil
+	Classifier *FailureClassifier
 }
 
 // DefaultCircuitBreakerConfig returns a default circuit breaker configuration
@@ -68,6 +73,8 @@ type CircuitBreaker struct {
 	log           logger.Logger
 	totalRequests int
 	totalFailures int
+	broadcast     func(name string, state CircuitBreakerState)
+	listener      func(name string, state CircuitBreakerState)
 }
 
 // NewCircuitBreaker creates a new circuit breaker
@@ -123,6 +130,8 @@ func (cb *CircuitBreaker) Execute(req *http.Request, next http.Handler, w http.R
 			logger.Int("threshold", cb.config.Threshold))
 
 		w.Header().Set("X-Circuit-Breaker", "open")
+		w.Header().Set("Retry-After", strconv.Itoa(cb.retryAfter()))
+		countUpstreamError(cb.name, http.StatusServiceUnavailable, upstreamErrorCircuitOpen)
 		http.Error(w, "Service temporarily unavailable (circuit breaker open)", http.StatusServiceUnavailable)
 		return errors.New("circuit open")
 	}
@@ -143,11 +152,17 @@ func (cb *CircuitBreaker) Execute(req *http.Request, next http.Handler, w http.R
 	// Create a custom response writer to capture status code
 	crw := &customResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 
-	// Process the request
+	// Process the request, keeping the upstream error for the classifier
+	var outcome *upstreamError
+	if cb.config.Classifier != nil {
+		var ctx context.Context
+		ctx, outcome = withUpstreamError(req.Context())
+		req = req.WithContext(ctx)
+	}
 	next.ServeHTTP(crw, req)
 
-	// If status code indicates a server error, record a failure
-	if crw.statusCode >= 500 || crw.statusCode == 0 {
+	// If the outcome indicates the upstream is failing, record a failure
+	if cb.isFailure(crw.statusCode, outcome) {
 		cb.RecordFailure()
 		cb.log.Debug("Circuit breaker recorded failure",
 			logger.String("circuit", cb.name),
@@ -165,6 +180,15 @@ func (cb *CircuitBreaker) Execute(req *http.Request, next http.Handler, w http.R
 	return nil
 }
 
+// isFailure classifies a response, any 5xx counting as a failure unless the
+// breaker has a classifier
+func (cb *CircuitBreaker) isFailure(status int, outcome *upstreamError) bool {
+	if cb.config.Classifier == nil {
+		return status >= 500 || status == 0
+	}
+	return cb.config.Classifier.isFailure(status, outcome.err)
+}
+
 // AllowRequest checks if a request should be allowed based on circuit state
 func (cb *CircuitBreaker) AllowRequest() bool {
 	cb.mutex.RLock()
@@ -186,6 +210,7 @@ func (cb *CircuitBreaker) AllowRequest() bool {
 			// Double-check the state in case another goroutine changed it
 			if cb.state == Open {
 				cb.state = HalfOpen
+				cb.notify(HalfOpen)
 				cb.log.Info("Circuit breaker transitioned to half-open",
 					logger.String("circuit", cb.name),
 					logger.String("elapsed", elapsed.String()),
@@ -210,6 +235,20 @@ func (cb *CircuitBreaker) AllowRequest() bool {
 	}
 }
 
+// retryAfter returns the seconds until an open circuit lets a test request
+// through, at least 1
+func (cb *CircuitBreaker) retryAfter() int {
+	cb.mutex.RLock()
+	remaining := cb.config.Timeout - time.Since(cb.lastFailure)
+	cb.mutex.RUnlock()
+
+	seconds := int(math.Ceil(remaining.Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
 // RecordSuccess records a successful request
 func (cb *CircuitBreaker) RecordSuccess() {
 	cb.mutex.Lock()
@@ -222,6 +261,7 @@ func (cb *CircuitBreaker) RecordSuccess() {
 		// If successful in half-open state, close the circuit
 		cb.failures = 0
 		cb.state = Closed
+		cb.notify(Closed)
 		cb.log.Info("Circuit breaker closed after successful test request",
 			logger.String("circuit", cb.name),
 			logger.Int("total_requests", cb.totalRequests),
@@ -246,6 +286,7 @@ func (cb *CircuitBreaker) RecordFailure() {
 	case HalfOpen:
 		// If failed in half-open state, open the circuit again
 		cb.state = Open
+		cb.notify(Open)
 		cb.log.Warn("Circuit breaker reopened after failed test request",
 			logger.String("circuit", cb.name),
 			logger.Int("total_requests", cb.totalRequests),
@@ -258,6 +299,7 @@ func (cb *CircuitBreaker) RecordFailure() {
 		// If failures exceed threshold, open the circuit
 		if cb.failures >= cb.config.Threshold {
 			cb.state = Open
+			cb.notify(Open)
 			cb.log.Warn("Circuit breaker opened after consecutive failures",
 				logger.String("circuit", cb.name),
 				logger.Int("failures", cb.failures),
@@ -275,6 +317,78 @@ func (cb *CircuitBreaker) RecordFailure() {
 	}
 }
 
+// SetStateBroadcaster sets a function called with every state change made by
+// this breaker, for sharing the state with other gateways
+func (cb *CircuitBreaker) SetStateBroadcaster(broadcast func(name string, state CircuitBreakerState)) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.broadcast = broadcast
+}
+
+// SetStateListener sets a function called with every state change made by
+// this breaker, such as for sending notifications
+func (cb *CircuitBreaker) SetStateListener(listener func(name string, state CircuitBreakerState)) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.listener = listener
+}
+
+// notify broadcasts a state change and tells the listener without blocking
+// the request. The caller must hold the mutex.
+func (cb *CircuitBreaker) notify(state CircuitBreakerState) {
+	if cb.broadcast != nil {
+		go cb.broadcast(cb.name, state)
+	}
+	if cb.listener != nil {
+		go cb.listener(cb.name, state)
+	}
+}
+
+// ApplyRemoteState applies a state change broadcast by another gateway. An
+// open or probing peer opens this breaker for ttl, after which it probes the
+// upstream itself; a peer closing its breaker lets an open one probe early.
+// Remote changes are not broadcast again.
+func (cb *CircuitBreaker) ApplyRemoteState(state CircuitBreakerState, ttl time.Duration) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	switch state {
+	case Open, HalfOpen:
+		// Open until ttl from now, unless already open for longer
+		lastFailure := time.Now().Add(ttl - cb.config.Timeout)
+		if cb.state == Open && cb.lastFailure.After(lastFailure) {
+			return
+		}
+		if cb.state != Open {
+			cb.log.Warn("Circuit breaker opened by a peer",
+				logger.String("circuit", cb.name),
+				logger.String("peer_state", state.String()),
+				logger.String("ttl", ttl.String()),
+			)
+		}
+		cb.state = Open
+		cb.lastFailure = lastFailure
+	case Closed:
+		if cb.state == Open {
+			cb.state = HalfOpen
+			cb.failures = 0
+			cb.log.Info("Circuit breaker half-open after a peer closed it",
+				logger.String("circuit", cb.name),
+			)
+		}
+	}
+}
+
+// ParseCircuitBreakerState parses the String form of a state
+func ParseCircuitBreakerState(value string) (CircuitBreakerState, bool) {
+	for _, state := range []CircuitBreakerState{Closed, Open, HalfOpen} {
+		if state.String() == value {
+			return state, true
+		}
+	}
+	return Closed, false
+}
+
 // GetStatus returns the current state and metrics of the circuit breaker
 func (cb *CircuitBreaker) GetStatus() map[string]interface{} {
 	cb.mutex.RLock()
@@ -341,3 +455,8 @@ func (crw *customResponseWriter) Write(b []byte) (int, error) {
 	}
 	return crw.ResponseWriter.Write(b)
 }
+
+// Unwrap returns the original writer so flushing and hijacking reach it
+func (crw *customResponseWriter) Unwrap() http.ResponseWriter {
+	return crw.ResponseWriter
+}
@@ -194,3 +194,49 @@ func TestCircuitBreakerWrapper(t *testing.T) {
 	// Circuit should be closed after success
 	assert.Equal(t, Closed, cb.state)
 }
+
+func TestCircuitBreakerSharedState(t *testing.T) {
+	cb := NewCircuitBreaker("/orders", CircuitBreakerConfig{Threshold: 2, Timeout: time.Minute}, &mockLogger{})
+
+	changes := make(chan CircuitBreakerState, 4)
+	cb.SetStateBroadcaster(func(name string, state CircuitBreakerState) {
+		assert.Equal(t, "/orders", name)
+		changes <- state
+	})
+
+	// Local trips are broadcast
+	cb.RecordFailure()
+	cb.RecordFailure()
+	select {
+	case state := <-changes:
+		assert.Equal(t, Open, state)
+	case <-time.After(time.Second):
+		t.Fatal("state change not broadcast")
+	}
+
+	// A peer closing its breaker lets this one probe
+	cb.ApplyRemoteState(Closed, time.Second)
+	assert.Equal(t, "HALF-OPEN", cb.GetStatus()["state"])
+	cb.RecordSuccess()
+	assert.Equal(t, Closed, <-changes)
+
+	// A peer opening its breaker opens this one until the TTL passes
+	cb.ApplyRemoteState(Open, 50*time.Millisecond)
+	assert.False(t, cb.AllowRequest())
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, cb.AllowRequest())
+	assert.Equal(t, HalfOpen, <-changes)
+
+	// Remote changes are not broadcast again
+	select {
+	case state := <-changes:
+		t.Fatalf("unexpected broadcast of %s", state)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	state, ok := ParseCircuitBreakerState("HALF-OPEN")
+	assert.True(t, ok)
+	assert.Equal(t, HalfOpen, state)
+	_, ok = ParseCircuitBreakerState("AJAR")
+	assert.False(t, ok)
+}
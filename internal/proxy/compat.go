@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"api-gateway/internal/config"
+)
+
+var errCompatBodyTooLarge = errors.New("request body too large to buffer for the upstream")
+
+// compatTransport adapts upstream requests for legacy upstreams that need
+// exact header casing, a Content-Length instead of chunked encoding, or no
+// Expect: 100-continue
+type compatTransport struct {
+	base http.RoundTripper
+	// headerCase maps canonical header names to the casing sent upstream
+	headerCase            map[string]string
+	forceContentLength    bool
+	maxBufferSize         int64
+	disableExpectContinue bool
+}
+
+// newCompatTransport creates a transport applying a route's compatibility
+// options
+func newCompatTransport(base http.RoundTripper, cfg *config.UpstreamCompat) *compatTransport {
+	headerCase := make(map[string]string, len(cfg.HeaderCase))
+	for _, name := range cfg.HeaderCase {
+		headerCase[http.CanonicalHeaderKey(name)] = name
+	}
+	return &compatTransport{
+		base:                  base,
+		headerCase:            headerCase,
+		forceContentLength:    cfg.ForceContentLength,
+		maxBufferSize:         cfg.MaxBufferSize,
+		disableExpectContinue: cfg.DisableExpectContinue,
+	}
+}
+
+// RoundTrip adapts a copy of the request and sends it through the base transport
+func (t *compatTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	out := req.Clone(req.Context())
+
+	if t.disableExpectContinue {
+		out.Header.Del("Expect")
+	}
+
+	// Bodies of unknown length, which clients mark with a zero or negative
+	// ContentLength, would be sent chunked
+	if t.forceContentLength && out.Body != nil && out.Body != http.NoBody && out.ContentLength <= 0 {
+		body, err := io.ReadAll(io.LimitReader(req.Body, t.maxBufferSize+1))
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(body)) > t.maxBufferSize {
+			return nil, errCompatBodyTooLarge
+		}
+		out.Body = io.NopCloser(bytes.NewReader(body))
+		out.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+		if len(body) == 0 {
+			out.Body, out.GetBody = http.NoBody, nil
+		}
+		out.ContentLength = int64(len(body))
+		out.TransferEncoding = nil
+	}
+
+	// Non-canonical keys are written to the wire as they are
+	for canonical, name := range t.headerCase {
+		if values, ok := out.Header[canonical]; ok && canonical != name {
+			delete(out.Header, canonical)
+			out.Header[name] = values
+		}
+	}
+
+	return t.base.RoundTrip(out)
+}
@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompatTransportHeaders(t *testing.T) {
+	var sent *http.Request
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		sent = req
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+	transport := newCompatTransport(base, &config.UpstreamCompat{
+		HeaderCase:            []string{"SOAPAction", "X-API-KEY"},
+		DisableExpectContinue: true,
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "http://legacy/service", nil)
+	req.Header.Set("Soapaction", "urn:GetOrder")
+	req.Header.Set("X-Api-Key", "secret")
+	req.Header.Set("Expect", "100-continue")
+	_, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"urn:GetOrder"}, sent.Header["SOAPAction"])
+	assert.Equal(t, []string{"secret"}, sent.Header["X-API-KEY"])
+	assert.NotContains(t, sent.Header, "Soapaction")
+	assert.Empty(t, sent.Header.Get("Expect"))
+
+	// The original request is left alone
+	assert.Equal(t, "100-continue", req.Header.Get("Expect"))
+	assert.Contains(t, req.Header, "Soapaction")
+}
+
+func TestCompatTransportOnTheWire(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	// Read the raw request, as a Go server would canonicalize the header names
+	raw := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		var head strings.Builder
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil || line == "\r\n" {
+				break
+			}
+			head.WriteString(line)
+		}
+		raw <- head.String()
+		io.WriteString(conn, "HTTP/1.1 204 No Content\r\nConnection: close\r\n\r\n")
+	}()
+
+	transport := newCompatTransport(&http.Transport{}, &config.UpstreamCompat{
+		HeaderCase:         []string{"SOAPAction"},
+		ForceContentLength: true,
+		MaxBufferSize:      1024,
+	})
+
+	// A body of unknown length would otherwise be sent chunked
+	req, err := http.NewRequest(http.MethodPost, "http://"+listener.Addr().String()+"/", io.NopCloser(strings.NewReader("<order/>")))
+	require.NoError(t, err)
+	req.Header.Set("SOAPAction", "urn:GetOrder")
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	head := <-raw
+	assert.Contains(t, head, "SOAPAction: urn:GetOrder\r\n")
+	assert.Contains(t, head, "Content-Length: 8\r\n")
+	assert.NotContains(t, head, "Transfer-Encoding")
+}
+
+func TestCompatTransportBodyTooLarge(t *testing.T) {
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		t.Fatal("oversized request sent upstream")
+		return nil, nil
+	})
+	transport := newCompatTransport(base, &config.UpstreamCompat{ForceContentLength: true, MaxBufferSize: 4})
+
+	req := httptest.NewRequest(http.MethodPost, "http://legacy/", io.NopCloser(strings.NewReader("too long")))
+	req.ContentLength = -1
+	_, err := transport.RoundTrip(req)
+	assert.ErrorIs(t, err, errCompatBodyTooLarge)
+}
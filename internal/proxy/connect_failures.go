@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// errConnectFailureCached is returned by dials skipped because the last
+// connect to the address failed moments ago
+var errConnectFailureCached = errors.New("upstream connect failed recently")
+
+// connectFailures remembers the upstream addresses whose last connect failed,
+// so requests to a host that is down fail at once rather than each waiting
+// for the connect timeout. Once an entry expires, one dial probes the address
+// while the others keep failing fast until it connects or fails again.
+type connectFailures struct {
+	mutex    sync.Mutex
+	failures map[string]*connectFailure // By host:port
+}
+
+// connectFailure is the last failed connect to an address
+type connectFailure struct {
+	err   error
+	ttl   time.Duration
+	until time.Time // Dials fail fast until then
+}
+
+// newConnectFailures creates an empty failure cache
+func newConnectFailures() *connectFailures {
+	return &connectFailures{failures: make(map[string]*connectFailure)}
+}
+
+// check returns the cached failure of addr, or nil if the dial may go ahead.
+// A dial let through after an entry expired is the probe.
+func (c *connectFailures) check(addr string) error {
+	if c == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	failure, ok := c.failures[addr]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	if now.Before(failure.until) {
+		return fmt.Errorf("%w: %s: %v", errConnectFailureCached, addr, failure.err)
+	}
+	failure.until = now.Add(failure.ttl)
+	return nil
+}
+
+// failed records a failed connect to addr
+func (c *connectFailures) failed(addr string, err error, ttl time.Duration) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.failures[addr] = &connectFailure{err: err, ttl: ttl, until: time.Now().Add(ttl)}
+}
+
+// succeeded forgets the failures of addr once it connects
+func (c *connectFailures) succeeded(addr string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.failures, addr)
+}
+
+// failing reports whether dials to the endpoint currently fail fast
+func (c *connectFailures) failing(endpoint *url.URL) bool {
+	if c == nil {
+		return false
+	}
+	addr := endpointAddr(endpoint)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	failure, ok := c.failures[addr]
+	return ok && time.Now().Before(failure.until)
+}
+
+// endpointAddr returns the host:port dialed for an endpoint
+func endpointAddr(endpoint *url.URL) string {
+	port := endpoint.Port()
+	if port == "" {
+		port = "80"
+		if endpoint.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(endpoint.Hostname(), port)
+}
@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// closedAddr returns a local address nothing listens on
+func closedAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+	return addr
+}
+
+func TestConnectFailuresFailFast(t *testing.T) {
+	d, err := newUpstreamDialer(config.DialConfig{FailureTTL: 50}, nil)
+	require.NoError(t, err)
+	d.failures = newConnectFailures()
+	addr := closedAddr(t)
+
+	_, err = d.DialContext(context.Background(), "tcp", addr)
+	assert.True(t, errors.Is(err, syscall.ECONNREFUSED))
+
+	// Further dials fail at once with the cached failure
+	_, err = d.DialContext(context.Background(), "tcp", addr)
+	assert.True(t, errors.Is(err, errConnectFailureCached))
+	assert.Contains(t, err.Error(), "connection refused")
+	status, _, reason := classifyUpstreamError(err)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, upstreamErrorConnectCached, reason)
+
+	// Once the entry expires one dial probes, the others still fail fast
+	listener, err := net.Listen("tcp", addr)
+	require.NoError(t, err)
+	defer listener.Close()
+	time.Sleep(60 * time.Millisecond)
+	assert.NoError(t, d.failures.check(addr))
+	assert.ErrorIs(t, d.failures.check(addr), errConnectFailureCached)
+
+	// A successful connect clears the failure
+	d.failures.failures[addr].until = time.Now()
+	conn, err := d.DialContext(context.Background(), "tcp", addr)
+	require.NoError(t, err)
+	conn.Close()
+	assert.Empty(t, d.failures.failures)
+}
+
+func TestConnectFailuresIgnoreCanceledDials(t *testing.T) {
+	d, err := newUpstreamDialer(config.DialConfig{FailureTTL: 1000}, nil)
+	require.NoError(t, err)
+	d.failures = newConnectFailures()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = d.DialContext(ctx, "tcp", closedAddr(t))
+	assert.Error(t, err)
+	assert.Empty(t, d.failures.failures)
+}
+
+func TestConnectFailuresSkipEndpoints(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+	down := "http://" + closedAddr(t)
+
+	route := config.Route{
+		Path:          "/orders",
+		Upstream:      upstream.URL,
+		Middlewares:   &config.Middlewares{},
+		Dial:          &config.DialConfig{FailureTTL: 60000},
+		LoadBalancing: &config.LoadBalancingConfig{Method: "round_robin", Endpoints: []string{down, upstream.URL}},
+	}
+	p := NewHTTPProxy(&config.Config{}, &config.RouteConfig{Routes: []config.Route{route}}, &mockLogger{})
+	handler := p.ProxyRequest(route)
+
+	var statuses []int
+	for i := 0; i < 4; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders", nil))
+		statuses = append(statuses, rec.Code)
+	}
+
+	// Only the first request to the down endpoint fails, the others skip it
+	failed := 0
+	for _, status := range statuses {
+		if status != http.StatusOK {
+			failed++
+		}
+	}
+	assert.Equal(t, 1, failed, statuses)
+	downURL, _ := url.Parse(down)
+	assert.True(t, p.connectFailures.failing(downURL))
+}
+
+func TestConnectFailuresFailFastWithoutAlternative(t *testing.T) {
+	route := config.Route{
+		Path:        "/billing",
+		Upstream:    "http://" + closedAddr(t),
+		Middlewares: &config.Middlewares{},
+	}
+	p := NewHTTPProxy(&config.Config{Dial: config.DialConfig{FailureTTL: 60000}}, &config.RouteConfig{Routes: []config.Route{route}}, &mockLogger{})
+	handler := p.ProxyRequest(route)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/billing", nil))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+
+	cached := testutil.ToFloat64(upstreamErrors.WithLabelValues("/billing", "503", upstreamErrorConnectCached))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/billing", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, cached+1, testutil.ToFloat64(upstreamErrors.WithLabelValues("/billing", "503", upstreamErrorConnectCached)))
+}
+
+func TestEndpointAddr(t *testing.T) {
+	for raw, expected := range map[string]string{
+		"http://users:8080":    "users:8080",
+		"http://users":         "users:80",
+		"https://users":        "users:443",
+		"http://[2001:db8::1]": "[2001:db8::1]:80",
+	} {
+		u, err := url.Parse(raw)
+		require.NoError(t, err)
+		assert.Equal(t, expected, endpointAddr(u), raw)
+	}
+}
@@ -0,0 +1,224 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// maxContentDepth is the deepest XML element nesting content routing parses
+const maxContentDepth = 64
+
+// contentRouter sends requests to the upstream of the first rule matching the
+// value at the route's body path, or the route's upstream
+type contentRouter struct {
+	path     string
+	config   *config.ContentRouting
+	routeOn  config.ContentPath
+	rules    []contentRuleHandler
+	fallback http.Handler
+	log      logger.Logger
+}
+
+// contentRuleHandler is a rule and the proxy to its upstream
+type contentRuleHandler struct {
+	name    string
+	values  map[string]bool
+	handler http.Handler
+}
+
+// proxyContent proxies a route with content routing. Rules get their own
+// upstream proxies sharing the route's other settings.
+func (p *HTTPProxy) proxyContent(route config.Route) http.Handler {
+	// The path was checked with the configuration
+	routeOn, _ := config.ParseContentPath(route.ContentRouting.RouteOn)
+	fallbackRoute := route
+	fallbackRoute.ContentRouting = nil
+	router := &contentRouter{
+		path:     route.Path,
+		config:   route.ContentRouting,
+		routeOn:  routeOn,
+		fallback: p.ProxyRequest(fallbackRoute),
+		log:      p.log,
+	}
+
+	for i, rule := range route.ContentRouting.Rules {
+		ruleRoute := route
+		ruleRoute.ContentRouting = nil
+		ruleRoute.Upstream = rule.Upstream
+		ruleRoute.LoadBalancing = rule.LoadBalancing
+
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("rule_%d", i)
+		}
+		values := make(map[string]bool, len(rule.Values))
+		for _, value := range rule.Values {
+			values[value] = true
+		}
+		router.rules = append(router.rules, contentRuleHandler{
+			name:    name,
+			values:  values,
+			handler: p.proxyUpstream(ruleRoute),
+		})
+	}
+
+	p.log.Info("Created content router for route",
+		logger.String("path", route.Path),
+		logger.String("route_on", route.ContentRouting.RouteOn),
+		logger.Int("rules", len(route.ContentRouting.Rules)),
+	)
+	return router
+}
+
+// ServeHTTP reads the request body up to the size limit and dispatches the
+// request on the value found in it
+func (c *contentRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !hasBody(r) {
+		c.dispatch(w, r, "", false)
+		return
+	}
+	if r.ContentLength > c.config.MaxBodySize {
+		contentRoutedRequests.WithLabelValues(c.path, "too_large").Inc()
+		http.Error(w, "Request entity too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, c.config.MaxBodySize+1))
+	r.Body.Close()
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	if int64(len(body)) > c.config.MaxBodySize {
+		contentRoutedRequests.WithLabelValues(c.path, "too_large").Inc()
+		http.Error(w, "Request entity too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+
+	var value string
+	var found bool
+	if c.routeOn.XML {
+		value, found, err = xmlValue(body, c.routeOn.Segments)
+	} else {
+		value, found, err = jsonValue(body, c.routeOn.Segments)
+	}
+	if err != nil {
+		c.log.Debug("Failed to parse body for content routing",
+			logger.String("path", c.path),
+			logger.Error(err),
+		)
+	}
+	c.dispatch(w, r, value, found)
+}
+
+// dispatch proxies the request to the first rule listing the value
+func (c *contentRouter) dispatch(w http.ResponseWriter, r *http.Request, value string, found bool) {
+	if found {
+		for _, rule := range c.rules {
+			if rule.values[value] {
+				contentRoutedRequests.WithLabelValues(c.path, rule.name).Inc()
+				rule.handler.ServeHTTP(w, r)
+				return
+			}
+		}
+	}
+	contentRoutedRequests.WithLabelValues(c.path, "default").Inc()
+	c.fallback.ServeHTTP(w, r)
+}
+
+// jsonValue returns the scalar at the path of a JSON document. Numbers and
+// booleans are returned as their JSON text.
+func jsonValue(body []byte, segments []string) (string, bool, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return "", false, err
+	}
+
+	current := document
+	for _, segment := range segments {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			current = node[segment]
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return "", false, nil
+			}
+			current = node[index]
+		default:
+			return "", false, nil
+		}
+	}
+
+	switch value := current.(type) {
+	case string:
+		return value, true, nil
+	case json.Number:
+		return value.String(), true, nil
+	case bool:
+		return strconv.FormatBool(value), true, nil
+	}
+	return "", false, nil
+}
+
+// xmlValue returns the trimmed text of the first element at the path of an
+// XML document, matching elements by local name. Documents with a DTD or
+// nested too deeply are rejected.
+func xmlValue(body []byte, segments []string) (string, bool, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = true
+
+	depth := 0   // Depth of the current element
+	matched := 0 // Depth down to which the current elements follow the path
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return "", false, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+
+		switch t := token.(type) {
+		case xml.Directive:
+			// DTDs are where entity expansion attacks are declared
+			if bytes.HasPrefix(bytes.TrimSpace(bytes.ToUpper(t)), []byte("DOCTYPE")) {
+				return "", false, errXMLDTD
+			}
+		case xml.StartElement:
+			depth++
+			if depth > maxContentDepth {
+				return "", false, errXMLTooDeep
+			}
+			if matched == depth-1 && depth <= len(segments) && t.Name.Local == segments[depth-1] {
+				matched = depth
+			}
+		case xml.CharData:
+			if matched == len(segments) && depth == matched {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			if matched == len(segments) && depth == matched {
+				return strings.TrimSpace(text.String()), true, nil
+			}
+			if matched == depth {
+				matched--
+			}
+			depth--
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"api-gateway/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newContentProxy(t *testing.T, routing *config.ContentRouting, upstream string) http.Handler {
+	if routing.MaxBodySize == 0 {
+		routing.MaxBodySize = 64 << 10
+	}
+	route := config.Route{Path: "/webhooks", Upstream: upstream, ContentRouting: routing, Middlewares: &config.Middlewares{}}
+	p := NewHTTPProxy(&config.Config{}, &config.RouteConfig{Routes: []config.Route{route}}, &mockLogger{})
+	return p.ProxyRequest(route)
+}
+
+func TestContentRoutingJSON(t *testing.T) {
+	dispatcher := newSOAPUpstream(t, "dispatcher")
+	billing := newSOAPUpstream(t, "billing")
+	shipping := newSOAPUpstream(t, "shipping")
+	handler := newContentProxy(t, &config.ContentRouting{
+		RouteOn: "$.event.type",
+		Rules: []config.ContentRule{
+			{Name: "billing", Values: []string{"invoice.paid", "invoice.failed"}, Upstream: billing.URL},
+			{Name: "shipping", Values: []string{"order.shipped", "42"}, Upstream: shipping.URL},
+		},
+	}, dispatcher.URL)
+
+	for body, expected := range map[string]string{
+		`{"event": {"type": "invoice.paid", "id": 1}}`: "billing",
+		`{"event": {"type": "order.shipped"}}`:         "shipping",
+		`{"event": {"type": 42}}`:                      "shipping",
+		`{"event": {"type": "user.created"}}`:          "dispatcher",
+		`{"event": {"kind": "invoice.paid"}}`:          "dispatcher",
+		`{"event": "invoice.paid"}`:                    "dispatcher",
+		`not json`:                                     "dispatcher",
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(body)))
+		assert.Equal(t, expected, rec.Header().Get("X-Upstream"), body)
+		// The upstream receives the whole body
+		assert.Equal(t, body, rec.Body.String())
+	}
+
+	routed := testutil.ToFloat64(contentRoutedRequests.WithLabelValues("/webhooks", "default"))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/webhooks", nil))
+	assert.Equal(t, "dispatcher", rec.Header().Get("X-Upstream"))
+	assert.Equal(t, routed+1, testutil.ToFloat64(contentRoutedRequests.WithLabelValues("/webhooks", "default")))
+}
+
+func TestContentRoutingXML(t *testing.T) {
+	dispatcher := newSOAPUpstream(t, "dispatcher")
+	billing := newSOAPUpstream(t, "billing")
+	handler := newContentProxy(t, &config.ContentRouting{
+		RouteOn: "/notification/event/type",
+		Rules:   []config.ContentRule{{Values: []string{"invoice.paid"}, Upstream: billing.URL}},
+	}, dispatcher.URL)
+
+	for body, expected := range map[string]string{
+		`<notification><event><id>7</id><type> invoice.paid </type></event></notification>`:                     "billing",
+		`<n:notification xmlns:n="urn:hooks"><n:event><n:type>invoice.paid</n:type></n:event></n:notification>`: "billing",
+		`<notification><meta><type>invoice.paid</type></meta><event/></notification>`:                           "dispatcher",
+		`<?xml version="1.0"?><!DOCTYPE notification [<!ENTITY x "invoice.paid">]><notification/>`:              "dispatcher",
+		`<notification><event><type>invoice.paid`:                                                               "dispatcher",
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(body)))
+		assert.Equal(t, expected, rec.Header().Get("X-Upstream"), body)
+	}
+	// Unnamed rules are counted by position
+	assert.Equal(t, 2.0, testutil.ToFloat64(contentRoutedRequests.WithLabelValues("/webhooks", "rule_0")))
+}
+
+func TestContentRoutingBodyLimit(t *testing.T) {
+	upstream := newSOAPUpstream(t, "dispatcher")
+	handler := newContentProxy(t, &config.ContentRouting{
+		RouteOn:     "$.type",
+		MaxBodySize: 16,
+		Rules:       []config.ContentRule{{Values: []string{"a"}, Upstream: upstream.URL}},
+	}, upstream.URL)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(`{"type": "a", "padding": "xxxx"}`)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	// Bodies of unknown length are cut off at the limit too
+	req := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(`{"type": "a", "padding": "xxxx"}`))
+	req.ContentLength = -1
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
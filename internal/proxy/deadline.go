@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// errBodyIdleTimeout is returned when an upstream sends no response body data
+// for longer than the route's body idle timeout
+var errBodyIdleTimeout = errors.New("upstream response body idle timeout")
+
+// idleTimeoutTransport aborts upstream responses whose body stalls. The idle
+// time only counts while waiting on the upstream, not while a slow client is
+// being written to.
+type idleTimeoutTransport struct {
+	base    http.RoundTripper
+	timeout time.Duration
+}
+
+// RoundTrip sends the request and wraps the response body with the idle timeout
+func (t *idleTimeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// The timer only runs during reads
+	body := &idleTimeoutBody{body: resp.Body, cancel: cancel, timeout: t.timeout}
+	body.timer = time.AfterFunc(t.timeout, body.expire)
+	body.timer.Stop()
+	resp.Body = body
+	return resp, nil
+}
+
+// idleTimeoutBody cancels the upstream request when a read waits too long
+type idleTimeoutBody struct {
+	body     io.ReadCloser
+	cancel   context.CancelFunc
+	timer    *time.Timer
+	timeout  time.Duration
+	timedOut atomic.Bool
+}
+
+// Read reads from the upstream body, failing if no data arrives in time
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	if b.timedOut.Load() {
+		return 0, errBodyIdleTimeout
+	}
+	b.timer.Reset(b.timeout)
+	n, err := b.body.Read(p)
+	b.timer.Stop()
+
+	if err != nil && b.timedOut.Load() {
+		return n, errBodyIdleTimeout
+	}
+	return n, err
+}
+
+// Close releases the upstream connection and stops the timer
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	err := b.body.Close()
+	b.cancel()
+	return err
+}
+
+// expire aborts the stalled upstream read
+func (b *idleTimeoutBody) expire() {
+	b.timedOut.Store(true)
+	b.cancel()
+}
+
+// isTimeout reports whether an upstream error is a timeout, which is answered
+// with 504 rather than 503
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, errBodyIdleTimeout) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdleTimeoutTransport(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+			w.Write([]byte("second"))
+		case <-r.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	client := &http.Client{Transport: &idleTimeoutTransport{
+		base:    http.DefaultTransport,
+		timeout: 50 * time.Millisecond,
+	}}
+
+	t.Run("stalled body times out", func(t *testing.T) {
+		resp, err := client.Get(upstream.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		start := time.Now()
+		body, err := io.ReadAll(resp.Body)
+		assert.ErrorIs(t, err, errBodyIdleTimeout)
+		assert.Equal(t, "first", string(body))
+		assert.Less(t, time.Since(start), 2*time.Second)
+	})
+
+	t.Run("slow reader does not time out", func(t *testing.T) {
+		fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("complete body"))
+		}))
+		defer fast.Close()
+
+		resp, err := client.Get(fast.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		// Waiting between reads is the client's time, not the upstream's
+		time.Sleep(100 * time.Millisecond)
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "complete body", string(body))
+	})
+}
+
+func TestProxyRequestTimeouts(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+
+	testCases := []struct {
+		name  string
+		route config.Route
+	}{
+		{
+			name:  "response header timeout",
+			route: config.Route{Path: "/api", Upstream: upstream.URL, Timeout: 1, Middlewares: &config.Middlewares{}},
+		},
+		{
+			name:  "max duration",
+			route: config.Route{Path: "/api", Upstream: upstream.URL, MaxDuration: 1, Middlewares: &config.Middlewares{}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			proxy := NewHTTPProxy(&config.Config{}, &config.RouteConfig{Routes: []config.Route{tc.route}}, &mockLogger{})
+			handler := proxy.ProxyRequest(tc.route)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest("GET", "http://example.com/api", nil))
+
+			assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+		})
+	}
+}
+
+func TestIsTimeout(t *testing.T) {
+	assert.True(t, isTimeout(context.DeadlineExceeded))
+	assert.True(t, isTimeout(errBodyIdleTimeout))
+	assert.True(t, isTimeout(&timeoutError{}))
+	assert.False(t, isTimeout(context.Canceled))
+	assert.False(t, isTimeout(errors.New("connection refused")))
+}
+
+// timeoutError is a net.Error reporting a timeout
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
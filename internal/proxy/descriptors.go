@@ -0,0 +1,275 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// DescriptorRegistry holds the services of the descriptor sets in a
+// directory, reloading them when files are added, changed or removed. A set
+// that fails to load keeps the previous descriptors in use.
+type DescriptorRegistry struct {
+	config *config.GRPCDescriptors
+	log    logger.Logger
+
+	mu       sync.RWMutex
+	files    *protoregistry.Files
+	services []DescriptorService
+	sources  map[string]time.Time // Modification time by descriptor set path
+	loadedAt time.Time
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// DescriptorService is a loaded service as listed on /admin/grpc/descriptors
+type DescriptorService struct {
+	Name    string   `json:"name"`
+	File    string   `json:"file"`    // Descriptor set it was loaded from
+	Methods []string `json:"methods"` // Full method names
+}
+
+// NewDescriptorRegistry creates a registry and loads the configured directory
+func NewDescriptorRegistry(cfg *config.GRPCDescriptors, log logger.Logger) *DescriptorRegistry {
+	d := &DescriptorRegistry{
+		config: cfg,
+		log:    log,
+		files:  &protoregistry.Files{},
+		stop:   make(chan struct{}),
+	}
+	if _, err := d.reload(); err != nil {
+		log.Error("Failed to load gRPC descriptors",
+			logger.String("dir", cfg.Dir),
+			logger.Error(err),
+		)
+	}
+	return d
+}
+
+// Start watches the directory for changes
+func (d *DescriptorRegistry) Start() {
+	if d.config.ReloadInterval <= 0 {
+		return
+	}
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		ticker := time.NewTicker(time.Duration(d.config.ReloadInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+				reloaded, err := d.reload()
+				if err != nil {
+					d.log.Warn("Failed to reload gRPC descriptors, keeping current descriptors",
+						logger.String("dir", d.config.Dir),
+						logger.Error(err),
+					)
+				} else if reloaded {
+					d.log.Info("Reloaded gRPC descriptors",
+						logger.String("dir", d.config.Dir),
+						logger.Int("services", len(d.Services())),
+					)
+				}
+			}
+		}
+	}()
+}
+
+// Stop ends the directory watch
+func (d *DescriptorRegistry) Stop() {
+	close(d.stop)
+	d.wg.Wait()
+}
+
+// FindMethod returns the descriptor of a full method name such as
+// users.v1.UserService/GetUser, with or without a leading slash
+func (d *DescriptorRegistry) FindMethod(fullMethodName string) (protoreflect.MethodDescriptor, error) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(fullMethodName, "/"), "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid method name format")
+	}
+
+	d.mu.RLock()
+	files := d.files
+	d.mu.RUnlock()
+
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, err
+	}
+	sd, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, fmt.Errorf("method %s not found", method)
+	}
+	return md, nil
+}
+
+// Services returns the loaded services sorted by name
+func (d *DescriptorRegistry) Services() []DescriptorService {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.services
+}
+
+// LoadedAt returns when the descriptors were last replaced
+func (d *DescriptorRegistry) LoadedAt() time.Time {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.loadedAt
+}
+
+// reload reads the directory's descriptor sets if any was added, changed or
+// removed since the last load and reports whether the descriptors were
+// replaced
+func (d *DescriptorRegistry) reload() (bool, error) {
+	sources, err := descriptorSets(d.config.Dir)
+	if err != nil {
+		return false, err
+	}
+	d.mu.RLock()
+	unchanged := sameSources(sources, d.sources)
+	d.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	files, origins, err := loadDescriptorSets(sources)
+	if err != nil {
+		return false, err
+	}
+
+	var services []DescriptorService
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		if origins[fd.Path()] == "" {
+			// Compiled-in imports are reachable without the registry
+			return true
+		}
+		for i := 0; i < fd.Services().Len(); i++ {
+			sd := fd.Services().Get(i)
+			service := DescriptorService{Name: string(sd.FullName()), File: origins[fd.Path()]}
+			for j := 0; j < sd.Methods().Len(); j++ {
+				service.Methods = append(service.Methods, string(sd.FullName())+"/"+string(sd.Methods().Get(j).Name()))
+			}
+			services = append(services, service)
+		}
+		return true
+	})
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+
+	d.mu.Lock()
+	d.files = files
+	d.services = services
+	d.sources = sources
+	d.loadedAt = time.Now()
+	d.mu.Unlock()
+	return true, nil
+}
+
+// descriptorSets returns the modification times of the descriptor sets in dir
+func descriptorSets(dir string) (map[string]time.Time, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sources := make(map[string]time.Time)
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".protoset" && ext != ".desc") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		sources[filepath.Join(dir, entry.Name())] = info.ModTime()
+	}
+	return sources, nil
+}
+
+// sameSources reports whether two listings of descriptor sets are the same
+func sameSources(a, b map[string]time.Time) bool {
+	if len(a) != len(b) || b == nil {
+		return false
+	}
+	for path, modTime := range a {
+		if other, ok := b[path]; !ok || !other.Equal(modTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// loadDescriptorSets parses the descriptor sets into a registry, returning
+// the set each file came from. A file found in several sets is taken from
+// the first by path.
+func loadDescriptorSets(sources map[string]time.Time) (*protoregistry.Files, map[string]string, error) {
+	paths := make([]string, 0, len(sources))
+	for path := range sources {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	set := &descriptorpb.FileDescriptorSet{}
+	origins := make(map[string]string)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		var fds descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(data, &fds); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		for _, fd := range fds.File {
+			if _, seen := origins[fd.GetName()]; seen {
+				continue
+			}
+			origins[fd.GetName()] = filepath.Base(path)
+			set.File = append(set.File, fd)
+		}
+	}
+
+	// Sets built without --include_imports leave out imports such as the
+	// well-known types, which the gateway has compiled in
+	for i := 0; i < len(set.File); i++ {
+		for _, dep := range set.File[i].Dependency {
+			if _, seen := origins[dep]; seen {
+				continue
+			}
+			fd, err := protoregistry.GlobalFiles.FindFileByPath(dep)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s imports %s, which no descriptor set contains", set.File[i].GetName(), dep)
+			}
+			origins[dep] = ""
+			set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+		}
+	}
+
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid descriptors: %w", err)
+	}
+	return files, origins, nil
+}
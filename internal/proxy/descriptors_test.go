@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	_ "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// writeDescriptorSet writes a descriptor set of one service whose methods
+// take a Request message and return google.protobuf.Empty, leaving out the
+// import
+func writeDescriptorSet(t *testing.T, path, pkg, service string, methods ...string) {
+	file := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String(pkg + "/service.proto"),
+		Package:    proto.String(pkg),
+		Dependency: []string{"google/protobuf/empty.proto"},
+		Syntax:     proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Request"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("id"),
+				Number:   proto.Int32(1),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				JsonName: proto.String("id"),
+			}},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{Name: proto.String(service)}},
+	}
+	for _, method := range methods {
+		file.Service[0].Method = append(file.Service[0].Method, &descriptorpb.MethodDescriptorProto{
+			Name:       proto.String(method),
+			InputType:  proto.String("." + pkg + ".Request"),
+			OutputType: proto.String(".google.protobuf.Empty"),
+		})
+	}
+	data, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{file}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+}
+
+func TestDescriptorRegistry(t *testing.T) {
+	dir := t.TempDir()
+	writeDescriptorSet(t, filepath.Join(dir, "users.protoset"), "users.v1", "UserService", "GetUser", "ListUsers")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a descriptor set"), 0o644))
+
+	registry := NewDescriptorRegistry(&config.GRPCDescriptors{Dir: dir}, &mockLogger{})
+	assert.Equal(t, []DescriptorService{{
+		Name:    "users.v1.UserService",
+		File:    "users.protoset",
+		Methods: []string{"users.v1.UserService/GetUser", "users.v1.UserService/ListUsers"},
+	}}, registry.Services())
+
+	method, err := registry.FindMethod("/users.v1.UserService/GetUser")
+	require.NoError(t, err)
+	assert.Equal(t, protoreflect.FullName("google.protobuf.Empty"), method.Output().FullName())
+	_, err = registry.FindMethod("users.v1.UserService/DeleteUser")
+	assert.ErrorContains(t, err, "method DeleteUser not found")
+
+	// Unchanged directories aren't read again
+	reloaded, err := registry.reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded)
+
+	// Added sets are loaded
+	writeDescriptorSet(t, filepath.Join(dir, "orders.desc"), "orders.v1", "OrderService", "PlaceOrder")
+	reloaded, err = registry.reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	require.Len(t, registry.Services(), 2)
+	assert.Equal(t, "orders.v1.OrderService", registry.Services()[0].Name)
+
+	// Invalid sets keep the current descriptors
+	invalid := filepath.Join(dir, "broken.protoset")
+	require.NoError(t, os.WriteFile(invalid, []byte("\xff\xff"), 0o644))
+	_, err = registry.reload()
+	assert.ErrorContains(t, err, "failed to parse")
+	_, err = registry.FindMethod("orders.v1.OrderService/PlaceOrder")
+	assert.NoError(t, err)
+
+	// Removed sets are unloaded
+	require.NoError(t, os.Remove(invalid))
+	require.NoError(t, os.Remove(filepath.Join(dir, "orders.desc")))
+	reloaded, err = registry.reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Len(t, registry.Services(), 1)
+	_, err = registry.FindMethod("orders.v1.OrderService/PlaceOrder")
+	assert.Error(t, err)
+}
+
+func TestDescriptorRegistryWatches(t *testing.T) {
+	dir := t.TempDir()
+	registry := NewDescriptorRegistry(&config.GRPCDescriptors{Dir: dir, ReloadInterval: 1}, &mockLogger{})
+	registry.Start()
+	defer registry.Stop()
+	assert.Empty(t, registry.Services())
+
+	writeDescriptorSet(t, filepath.Join(dir, "users.protoset"), "users.v1", "UserService", "GetUser")
+	assert.Eventually(t, func() bool { return len(registry.Services()) == 1 }, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestGRPCProxyUsesDescriptorRegistry(t *testing.T) {
+	dir := t.TempDir()
+	writeDescriptorSet(t, filepath.Join(dir, "users.protoset"), "users.v1", "UserService", "GetUser")
+
+	p := NewGRPCProxy(time.Minute, 1, &mockLogger{})
+	defer p.Close()
+	_, err := p.getMethodDescriptor("users.v1.UserService/GetUser")
+	assert.Error(t, err)
+
+	p.SetDescriptors(NewDescriptorRegistry(&config.GRPCDescriptors{Dir: dir}, &mockLogger{}))
+	method, err := p.getMethodDescriptor("users.v1.UserService/GetUser")
+	require.NoError(t, err)
+
+	// Messages only the registry describes are dynamic, while compiled-in
+	// types keep their type
+	_, isDynamic := dynamicMessage(method.Input()).(*dynamicpb.Message)
+	assert.True(t, isDynamic)
+	_, isDynamic = dynamicMessage(method.Output()).(*dynamicpb.Message)
+	assert.False(t, isDynamic)
+}
@@ -0,0 +1,271 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"api-gateway/internal/config"
+)
+
+// upstreamDialer dials upstream hosts with address family preference and
+// Happy Eyeballs (RFC 8305) fallback between IPv6 and IPv4
+type upstreamDialer struct {
+	dialer        *net.Dialer
+	lookup        func(ctx context.Context, host string) ([]string, error)
+	prefer        string
+	fallbackDelay time.Duration
+	sourceIP      net.IP
+	interfaceIPs  []net.IP
+
+	// Fails dials to addresses that failed within failureTTL (nil if off)
+	failures   *connectFailures
+	failureTTL time.Duration
+}
+
+// newUpstreamDialer creates a dialer from the dial configuration
+func newUpstreamDialer(cfg config.DialConfig, lookup func(ctx context.Context, host string) ([]string, error)) (*upstreamDialer, error) {
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupHost
+	}
+
+	// Fall back to the standard library defaults for unset values
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 30
+	}
+	if cfg.KeepAlive == 0 {
+		cfg.KeepAlive = 30
+	}
+	if cfg.FallbackDelay == 0 {
+		cfg.FallbackDelay = 300
+	}
+
+	d := &upstreamDialer{
+		dialer: &net.Dialer{
+			Timeout:   time.Duration(cfg.Timeout) * time.Second,
+			KeepAlive: time.Duration(cfg.KeepAlive) * time.Second,
+		},
+		lookup:        lookup,
+		prefer:        cfg.PreferIPVersion,
+		fallbackDelay: time.Duration(cfg.FallbackDelay) * time.Millisecond,
+		failureTTL:    time.Duration(cfg.FailureTTL) * time.Millisecond,
+	}
+
+	if cfg.SourceIP != "" {
+		d.sourceIP = net.ParseIP(cfg.SourceIP)
+		if d.sourceIP == nil {
+			return nil, fmt.Errorf("invalid source IP %q", cfg.SourceIP)
+		}
+	}
+
+	if cfg.BindInterface != "" {
+		iface, err := net.InterfaceByName(cfg.BindInterface)
+		if err != nil {
+			return nil, fmt.Errorf("bind interface %q: %w", cfg.BindInterface, err)
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("bind interface %q: %w", cfg.BindInterface, err)
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLinkLocalUnicast() {
+				d.interfaceIPs = append(d.interfaceIPs, ipNet.IP)
+			}
+		}
+		if len(d.interfaceIPs) == 0 {
+			return nil, fmt.Errorf("bind interface %q has no usable addresses", cfg.BindInterface)
+		}
+	}
+
+	return d, nil
+}
+
+// DialContext resolves the host and connects, racing address families if
+// needed. With a failure TTL, addresses that just failed to connect fail at
+// once.
+func (d *upstreamDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if d.failures == nil || d.failureTTL <= 0 {
+		return d.dial(ctx, network, addr)
+	}
+	if err := d.failures.check(addr); err != nil {
+		return nil, err
+	}
+
+	conn, err := d.dial(ctx, network, addr)
+	if err != nil {
+		// Requests given up on say nothing about the upstream
+		if ctx.Err() == nil {
+			d.failures.failed(addr, err, d.failureTTL)
+		}
+		return nil, err
+	}
+	d.failures.succeeded(addr)
+	return conn, nil
+}
+
+// dial resolves the host and connects
+func (d *upstreamDialer) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no addresses found", Name: host, IsNotFound: true}
+	}
+
+	primaries, fallbacks := d.partition(addrs)
+	if len(fallbacks) == 0 || d.fallbackDelay < 0 {
+		return d.dialSerial(ctx, network, port, append(primaries, fallbacks...))
+	}
+
+	return d.dialParallel(ctx, network, port, primaries, fallbacks)
+}
+
+// Dial connects without a context, allowing use as a forward dialer for SOCKS proxies
+func (d *upstreamDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// partition splits addresses into the preferred family and the fallback family
+func (d *upstreamDialer) partition(addrs []string) (primaries, fallbacks []string) {
+	preferV4 := false
+	switch d.prefer {
+	case "ipv4":
+		preferV4 = true
+	case "ipv6":
+		preferV4 = false
+	default:
+		// Follow the resolver ordering when no preference is configured
+		preferV4 = isIPv4(addrs[0])
+	}
+
+	for _, a := range addrs {
+		if isIPv4(a) == preferV4 {
+			primaries = append(primaries, a)
+		} else {
+			fallbacks = append(fallbacks, a)
+		}
+	}
+
+	if len(primaries) == 0 {
+		return fallbacks, nil
+	}
+	return primaries, fallbacks
+}
+
+// dialResult carries the outcome of one racing dial attempt
+type dialResult struct {
+	conn    net.Conn
+	err     error
+	primary bool
+}
+
+// dialParallel races the primary family against the fallback family, starting
+// the fallback after the configured delay or as soon as the primary fails
+func (d *upstreamDialer) dialParallel(ctx context.Context, network, port string, primaries, fallbacks []string) (net.Conn, error) {
+	returned := make(chan struct{})
+	defer close(returned)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult)
+	startRacer := func(addrs []string, primary bool) {
+		go func() {
+			conn, err := d.dialSerial(ctx, network, port, addrs)
+			select {
+			case results <- dialResult{conn: conn, err: err, primary: primary}:
+			case <-returned:
+				if conn != nil {
+					conn.Close()
+				}
+			}
+		}()
+	}
+
+	startRacer(primaries, true)
+
+	fallbackTimer := time.NewTimer(d.fallbackDelay)
+	defer fallbackTimer.Stop()
+
+	var primaryErr, fallbackErr error
+	fallbackStarted := false
+	for {
+		select {
+		case <-fallbackTimer.C:
+			if !fallbackStarted {
+				fallbackStarted = true
+				startRacer(fallbacks, false)
+			}
+		case res := <-results:
+			if res.err == nil {
+				return res.conn, nil
+			}
+			if res.primary {
+				primaryErr = res.err
+			} else {
+				fallbackErr = res.err
+			}
+			if primaryErr != nil && fallbackErr != nil {
+				return nil, primaryErr
+			}
+			if res.primary && !fallbackStarted {
+				// Primary failed early, don't wait for the delay
+				fallbackStarted = true
+				startRacer(fallbacks, false)
+			}
+		}
+	}
+}
+
+// dialSerial tries each address in order until one connects
+func (d *upstreamDialer) dialSerial(ctx context.Context, network, port string, addrs []string) (net.Conn, error) {
+	var lastErr error
+	for _, ip := range addrs {
+		dialer := *d.dialer
+		if local := d.localAddrFor(ip); local != nil {
+			dialer.LocalAddr = &net.TCPAddr{IP: local}
+		}
+
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no addresses to dial")
+	}
+	return nil, lastErr
+}
+
+// localAddrFor picks a source address matching the family of the destination
+func (d *upstreamDialer) localAddrFor(ip string) net.IP {
+	v4 := isIPv4(ip)
+	if d.sourceIP != nil && (d.sourceIP.To4() != nil) == v4 {
+		return d.sourceIP
+	}
+	for _, local := range d.interfaceIPs {
+		if (local.To4() != nil) == v4 {
+			return local
+		}
+	}
+	return nil
+}
+
+// isIPv4 reports whether the address is an IPv4 literal
+func isIPv4(addr string) bool {
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.To4() != nil
+}
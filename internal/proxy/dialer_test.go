@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpstreamDialerPartition(t *testing.T) {
+	addrs := []string{"2001:db8::1", "10.0.0.1", "2001:db8::2", "10.0.0.2"}
+
+	t.Run("prefer ipv4", func(t *testing.T) {
+		d, err := newUpstreamDialer(config.DialConfig{PreferIPVersion: "ipv4"}, nil)
+		require.NoError(t, err)
+		primaries, fallbacks := d.partition(addrs)
+		assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, primaries)
+		assert.Equal(t, []string{"2001:db8::1", "2001:db8::2"}, fallbacks)
+	})
+
+	t.Run("prefer ipv6", func(t *testing.T) {
+		d, err := newUpstreamDialer(config.DialConfig{PreferIPVersion: "ipv6"}, nil)
+		require.NoError(t, err)
+		primaries, fallbacks := d.partition(addrs)
+		assert.Equal(t, []string{"2001:db8::1", "2001:db8::2"}, primaries)
+		assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, fallbacks)
+	})
+
+	t.Run("resolver order without preference", func(t *testing.T) {
+		d, err := newUpstreamDialer(config.DialConfig{}, nil)
+		require.NoError(t, err)
+		primaries, _ := d.partition([]string{"10.0.0.1", "2001:db8::1"})
+		assert.Equal(t, []string{"10.0.0.1"}, primaries)
+	})
+
+	t.Run("single family", func(t *testing.T) {
+		d, err := newUpstreamDialer(config.DialConfig{PreferIPVersion: "ipv6"}, nil)
+		require.NoError(t, err)
+		primaries, fallbacks := d.partition([]string{"10.0.0.1"})
+		assert.Equal(t, []string{"10.0.0.1"}, primaries)
+		assert.Empty(t, fallbacks)
+	})
+}
+
+func TestUpstreamDialerInvalidConfig(t *testing.T) {
+	_, err := newUpstreamDialer(config.DialConfig{SourceIP: "not-an-ip"}, nil)
+	assert.Error(t, err)
+
+	_, err = newUpstreamDialer(config.DialConfig{BindInterface: "does-not-exist0"}, nil)
+	assert.Error(t, err)
+}
+
+func TestUpstreamDialerFallback(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	u, err := url.Parse(upstream.URL)
+	require.NoError(t, err)
+	_, port, err := net.SplitHostPort(u.Host)
+	require.NoError(t, err)
+
+	// The preferred IPv6 address is unreachable, so the IPv4 fallback must win
+	d, err := newUpstreamDialer(config.DialConfig{
+		PreferIPVersion: "ipv6",
+		FallbackDelay:   50,
+		Timeout:         1,
+	}, func(ctx context.Context, host string) ([]string, error) {
+		return []string{"100::1", "127.0.0.1"}, nil
+	})
+	require.NoError(t, err)
+
+	start := time.Now()
+	client := &http.Client{Transport: &http.Transport{DialContext: d.DialContext}}
+	resp, err := client.Get("http://upstream.local:" + port + "/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestUpstreamDialerSourceIP(t *testing.T) {
+	d, err := newUpstreamDialer(config.DialConfig{SourceIP: "127.0.0.1"}, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "127.0.0.1", d.localAddrFor("10.0.0.1").String())
+	assert.Nil(t, d.localAddrFor("2001:db8::1"), "source IP must match destination family")
+}
@@ -0,0 +1,404 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/discoverer/etcd_discovery"
+	"api-gateway/pkg/logger"
+)
+
+// discoveryEjectionTime is how long an instance that reached the route's fail
+// limit is kept out of rotation
+const discoveryEjectionTime = 30 * time.Second
+
+// discoveryRetryAfter is the Retry-After, in seconds, of requests rejected
+// before the initial sync
+const discoveryRetryAfter = 1
+
+// defaultDiscoveryRefreshInterval is how often instances are fully re-listed
+// in addition to watch events
+const defaultDiscoveryRefreshInterval = 30 * time.Second
+
+// serviceSource provides the currently registered instances of a service
+type serviceSource interface {
+	GetService(serviceName string) []string
+	DiscoverServices(prefix, serviceName string) ([]string, error)
+	Updates() <-chan struct{}
+	Close() error
+}
+
+// etcdDiscovery keeps a route's service instances in sync with etcd through a
+// long-lived watch and ejects instances that fail repeatedly. A background
+// refresher pushes changes into the load balancer so the request path only
+// reads the cached endpoint list.
+type etcdDiscovery struct {
+	source    serviceSource
+	name      string
+	prefix    string
+	failLimit int
+	interval  time.Duration
+	failures  map[string]int
+	ejected   map[string]time.Time
+	mutex     sync.Mutex
+	log       logger.Logger
+
+	// Health of the etcd listing, guarded by mutex
+	instances    int       // Instances last pushed to the load balancer
+	listingError string    // Error of the last listing, empty once one succeeds
+	failingSince time.Time // First of the failed listings in a row
+
+	// Refresher lifecycle
+	kick    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	applied string // instances last pushed to the load balancer
+
+	// Closed once instances were first pushed to the load balancer
+	ready     chan struct{}
+	readyOnce sync.Once
+	started   time.Time
+}
+
+// newEtcdDiscovery connects to etcd, lists the service and starts watching it
+func newEtcdDiscovery(cfg *config.EtcdConfig, discoveries *config.Discoveries, log logger.Logger) (*etcdDiscovery, error) {
+	tlsConfig, err := newEtcdTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	var endpoints []string
+	for _, host := range strings.Split(cfg.Hosts, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			endpoints = append(endpoints, host)
+		}
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no etcd hosts configured")
+	}
+
+	sd, err := etcd_discovery.NewServiceDiscoveryWithConfig(etcd_discovery.Config{
+		Endpoints:      endpoints,
+		DialTimeout:    time.Duration(cfg.DialTimeout) * time.Second,
+		RequestTimeout: time.Duration(cfg.RequestTimeout) * time.Second,
+		Username:       cfg.Username,
+		Password:       cfg.Password,
+		TLS:            tlsConfig,
+		RequireLease:   discoveries.RequireLease,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, listErr := sd.DiscoverServices(discoveries.Prefix, discoveries.Name)
+	if listErr != nil {
+		// The watch picks up instances as they register
+		log.Warn("Initial service discovery failed",
+			logger.String("service", discoveries.Name),
+			logger.String("reason", listErr.Error()),
+		)
+	}
+	sd.WatchServices(discoveries.Name)
+
+	log.Info("Watching service instances in etcd",
+		logger.String("service", discoveries.Name),
+		logger.String("prefix", discoveries.Prefix),
+		logger.Int("instances", len(addrs)),
+		logger.Int("fail_limit", discoveries.FailLimit),
+	)
+
+	d := newDiscoveryTracker(sd, discoveries, log)
+	d.recordListing(listErr)
+	return d, nil
+}
+
+// newDiscoveryTracker wraps a service source with fail limit tracking
+func newDiscoveryTracker(source serviceSource, discoveries *config.Discoveries, log logger.Logger) *etcdDiscovery {
+	interval := defaultDiscoveryRefreshInterval
+	if discoveries.RefreshInterval > 0 {
+		interval = time.Duration(discoveries.RefreshInterval) * time.Second
+	}
+
+	return &etcdDiscovery{
+		source:    source,
+		name:      discoveries.Name,
+		prefix:    discoveries.Prefix,
+		failLimit: discoveries.FailLimit,
+		interval:  interval,
+		failures:  make(map[string]int),
+		ejected:   make(map[string]time.Time),
+		log:       log,
+		kick:      make(chan struct{}, 1),
+		ready:     make(chan struct{}),
+	}
+}
+
+// Start runs the background refresher that keeps the load balancer's endpoints
+// in sync with watch events, ejections and periodic re-listing
+func (d *etcdDiscovery) Start(lb *LoadBalancer, parse func(addrs []string) ([]*url.URL, error)) {
+	d.stop = make(chan struct{})
+	d.done = make(chan struct{})
+	d.started = time.Now()
+
+	go func() {
+		defer close(d.done)
+
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+
+		d.sync(lb, parse)
+		for {
+			select {
+			case <-d.source.Updates():
+				d.sync(lb, parse)
+			case <-d.kick:
+				d.sync(lb, parse)
+			case <-ticker.C:
+				_, err := d.source.DiscoverServices(d.prefix, d.name)
+				if err != nil {
+					d.log.Warn("Periodic service discovery failed",
+						logger.String("service", d.name),
+						logger.String("reason", err.Error()),
+					)
+				}
+				d.recordListing(err)
+				d.sync(lb, parse)
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+}
+
+// sync pushes the available instances to the load balancer if they changed
+func (d *etcdDiscovery) sync(lb *LoadBalancer, parse func(addrs []string) ([]*url.URL, error)) {
+	addrs := d.Addresses()
+	if len(addrs) == 0 {
+		// Keep serving the last known instances rather than none
+		return
+	}
+
+	sorted := append([]string(nil), addrs...)
+	sort.Strings(sorted)
+	key := strings.Join(sorted, ",")
+	if key == d.applied {
+		return
+	}
+
+	endpoints, err := parse(addrs)
+	if err != nil {
+		d.log.Error("Failed to convert address to urls",
+			logger.String("service", d.name),
+			logger.Error(err),
+		)
+		return
+	}
+
+	lb.SetHealthyEndpoints(endpoints)
+	d.applied = key
+	d.mutex.Lock()
+	d.instances = len(endpoints)
+	d.mutex.Unlock()
+	d.log.Info("Updated service endpoints",
+		logger.String("service", d.name),
+		logger.Int("instances", len(endpoints)),
+	)
+	d.readyOnce.Do(func() {
+		close(d.ready)
+		d.log.Info("Service discovery ready",
+			logger.String("service", d.name),
+			logger.Int("time_to_ready_ms", int(time.Since(d.started).Milliseconds())),
+		)
+	})
+}
+
+// recordListing records the outcome of listing the service's instances
+func (d *etcdDiscovery) recordListing(err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err == nil {
+		d.listingError = ""
+		d.failingSince = time.Time{}
+		return
+	}
+	if d.listingError == "" {
+		d.failingSince = time.Now()
+	}
+	d.listingError = err.Error()
+}
+
+// DiscoveryStatus is the state of a route's service discovery as reported by
+// the health endpoint
+type DiscoveryStatus struct {
+	Service      string     `json:"service"`
+	Instances    int        `json:"instances"`       // Endpoints being served, the last known while etcd fails
+	Error        string     `json:"error,omitempty"` // Error of the last etcd listing
+	FailingSince *time.Time `json:"failing_since,omitempty"`
+}
+
+// status returns the state of the discovery
+func (d *etcdDiscovery) status() DiscoveryStatus {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	status := DiscoveryStatus{Service: d.name, Instances: d.instances, Error: d.listingError}
+	if !d.failingSince.IsZero() {
+		since := d.failingSince
+		status.FailingSince = &since
+	}
+	return status
+}
+
+// isReady reports whether the initial sync has pushed instances to the load
+// balancer
+func (d *etcdDiscovery) isReady() bool {
+	select {
+	case <-d.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// refresh asks the background refresher to re-apply instances
+func (d *etcdDiscovery) refresh() {
+	select {
+	case d.kick <- struct{}{}:
+	default:
+	}
+}
+
+// Addresses returns the registered instances that are not currently ejected
+func (d *etcdDiscovery) Addresses() []string {
+	addrs := d.source.GetService(d.name)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if len(d.ejected) == 0 {
+		return addrs
+	}
+
+	now := time.Now()
+	available := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		until, ejected := d.ejected[addressHost(addr)]
+		if ejected && now.Before(until) {
+			continue
+		}
+		if ejected {
+			// Ejection expired, give the instance another chance
+			delete(d.ejected, addressHost(addr))
+		}
+		available = append(available, addr)
+	}
+	return available
+}
+
+// ReportResult records the outcome of a request to an instance, ejecting it
+// once it has failed FailLimit times in a row
+func (d *etcdDiscovery) ReportResult(host string, failed bool) {
+	if d.failLimit <= 0 {
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if !failed {
+		delete(d.failures, host)
+		return
+	}
+
+	d.failures[host]++
+	if d.failures[host] < d.failLimit {
+		return
+	}
+
+	// Never eject the last available instance
+	available := 0
+	for _, addr := range d.source.GetService(d.name) {
+		if _, ejected := d.ejected[addressHost(addr)]; !ejected && addressHost(addr) != host {
+			available++
+		}
+	}
+	if available == 0 {
+		return
+	}
+
+	delete(d.failures, host)
+	d.ejected[host] = time.Now().Add(discoveryEjectionTime)
+
+	// Apply the ejection now and restore the instance once it expires
+	d.refresh()
+	time.AfterFunc(discoveryEjectionTime, d.refresh)
+
+	d.log.Warn("Ejected service instance after repeated failures",
+		logger.String("service", d.name),
+		logger.String("instance", host),
+		logger.Int("fail_limit", d.failLimit),
+	)
+}
+
+// Close stops the refresher and the etcd watch
+func (d *etcdDiscovery) Close() error {
+	if d.stop != nil {
+		close(d.stop)
+		<-d.done
+		d.stop = nil
+	}
+	return d.source.Close()
+}
+
+// addressHost returns the host:port of a registered address with or without scheme
+func addressHost(addr string) string {
+	if strings.Contains(addr, "://") {
+		if u, err := url.Parse(addr); err == nil {
+			return u.Host
+		}
+	}
+	return addr
+}
+
+// newEtcdTLSConfig builds the client TLS configuration for etcd
+func newEtcdTLSConfig(cfg config.EtcdTLSConfig) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		caCert, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read etcd CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in etcd CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load etcd client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
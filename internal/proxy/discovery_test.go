@@ -0,0 +1,221 @@
+package proxy
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServiceSource serves a settable instance list
+type fakeServiceSource struct {
+	mutex   sync.Mutex
+	addrs   []string
+	updates chan struct{}
+	closed  bool
+}
+
+func newFakeServiceSource(addrs ...string) *fakeServiceSource {
+	return &fakeServiceSource{addrs: addrs, updates: make(chan struct{}, 1)}
+}
+
+func (f *fakeServiceSource) GetService(serviceName string) []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]string(nil), f.addrs...)
+}
+
+func (f *fakeServiceSource) DiscoverServices(prefix, serviceName string) ([]string, error) {
+	return f.GetService(serviceName), nil
+}
+
+func (f *fakeServiceSource) Updates() <-chan struct{} { return f.updates }
+func (f *fakeServiceSource) Close() error             { f.closed = true; return nil }
+
+// set replaces the instances and signals an update like a watch event
+func (f *fakeServiceSource) set(addrs ...string) {
+	f.mutex.Lock()
+	f.addrs = addrs
+	f.mutex.Unlock()
+	f.updates <- struct{}{}
+}
+
+func TestDiscoveryFailLimit(t *testing.T) {
+	source := newFakeServiceSource("10.0.0.1:8080", "10.0.0.2:8080")
+	d := newDiscoveryTracker(source, &config.Discoveries{Name: "svc", FailLimit: 3}, &mockLogger{})
+
+	// Failures below the limit keep the instance in rotation
+	d.ReportResult("10.0.0.1:8080", true)
+	d.ReportResult("10.0.0.1:8080", true)
+	assert.Len(t, d.Addresses(), 2)
+
+	// A success resets the consecutive failure count
+	d.ReportResult("10.0.0.1:8080", false)
+	d.ReportResult("10.0.0.1:8080", true)
+	d.ReportResult("10.0.0.1:8080", true)
+	assert.Len(t, d.Addresses(), 2)
+
+	d.ReportResult("10.0.0.1:8080", true)
+	assert.Equal(t, []string{"10.0.0.2:8080"}, d.Addresses())
+
+	// The instance returns once the ejection expires
+	d.ejected["10.0.0.1:8080"] = time.Now().Add(-time.Second)
+	assert.Len(t, d.Addresses(), 2)
+}
+
+func TestDiscoveryKeepsLastInstance(t *testing.T) {
+	source := newFakeServiceSource("http://10.0.0.1:8080")
+	d := newDiscoveryTracker(source, &config.Discoveries{Name: "svc", FailLimit: 1}, &mockLogger{})
+
+	d.ReportResult("10.0.0.1:8080", true)
+	assert.Equal(t, []string{"http://10.0.0.1:8080"}, d.Addresses())
+}
+
+func TestDiscoveryWithoutFailLimit(t *testing.T) {
+	source := newFakeServiceSource("10.0.0.1:8080", "10.0.0.2:8080")
+	d := newDiscoveryTracker(source, &config.Discoveries{Name: "svc"}, &mockLogger{})
+
+	for i := 0; i < 10; i++ {
+		d.ReportResult("10.0.0.1:8080", true)
+	}
+	assert.Len(t, d.Addresses(), 2)
+
+	require.NoError(t, d.Close())
+	assert.True(t, source.closed)
+}
+
+func TestDiscoveryRefresher(t *testing.T) {
+	source := newFakeServiceSource("10.0.0.1:8080")
+	d := newDiscoveryTracker(source, &config.Discoveries{Name: "svc", FailLimit: 1}, &mockLogger{})
+	lb, err := NewLoadBalancer(&config.LoadBalancingConfig{Method: "round_robin", Driver: "etcd"}, &mockLogger{})
+	require.NoError(t, err)
+
+	p := &HTTPProxy{log: &mockLogger{}}
+	d.Start(lb, func(addrs []string) ([]*url.URL, error) {
+		return p.parseURLs("http", addrs)
+	})
+	defer d.Close()
+
+	endpointHosts := func() []string {
+		lb.healthLock.RLock()
+		defer lb.healthLock.RUnlock()
+		var hosts []string
+		for _, endpoint := range lb.endpoints {
+			hosts = append(hosts, endpoint.Host)
+		}
+		return hosts
+	}
+
+	// Initial sync happens in the background, not on the request path
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"10.0.0.1:8080"}, endpointHosts())
+	}, time.Second, 10*time.Millisecond)
+
+	// Watch events are applied without any request
+	source.set("10.0.0.1:8080", "10.0.0.2:8080")
+	assert.Eventually(t, func() bool {
+		return len(endpointHosts()) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	// Ejections are pushed to the load balancer
+	d.ReportResult("10.0.0.2:8080", true)
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"10.0.0.1:8080"}, endpointHosts())
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestDiscoveryReady(t *testing.T) {
+	source := newFakeServiceSource()
+	d := newDiscoveryTracker(source, &config.Discoveries{Name: "svc"}, &mockLogger{})
+	lb, err := NewLoadBalancer(&config.LoadBalancingConfig{Method: "round_robin", Driver: "etcd"}, &mockLogger{})
+	require.NoError(t, err)
+
+	p := &HTTPProxy{log: &mockLogger{}, discoveries: []*etcdDiscovery{d}}
+	ready := p.Ready()
+	d.Start(lb, func(addrs []string) ([]*url.URL, error) {
+		return p.parseURLs("http", addrs)
+	})
+	defer d.Close()
+
+	// No instances registered yet
+	time.Sleep(20 * time.Millisecond)
+	assert.False(t, d.isReady())
+	select {
+	case <-ready:
+		t.Fatal("proxy ready before discovery synced")
+	default:
+	}
+
+	source.set("10.0.0.1:8080")
+	select {
+	case <-ready:
+	case <-time.After(time.Second):
+		t.Fatal("proxy not ready after discovery synced")
+	}
+	assert.True(t, d.isReady())
+}
+
+func TestDiscoveryStatus(t *testing.T) {
+	source := newFakeServiceSource("10.0.0.1:8080", "10.0.0.2:8080")
+	d := newDiscoveryTracker(source, &config.Discoveries{Name: "svc"}, &mockLogger{})
+	lb, err := NewLoadBalancer(&config.LoadBalancingConfig{Method: "round_robin", Driver: "etcd"}, &mockLogger{})
+	require.NoError(t, err)
+	p := &HTTPProxy{log: &mockLogger{}, discoveries: []*etcdDiscovery{d}}
+	d.sync(lb, func(addrs []string) ([]*url.URL, error) {
+		return p.parseURLs("http", addrs)
+	})
+	assert.Equal(t, []DiscoveryStatus{{Service: "svc", Instances: 2}}, p.DiscoveryStatus())
+
+	// Failed listings are reported while the last instances are served
+	d.recordListing(errors.New("etcd unavailable"))
+	status := p.DiscoveryStatus()[0]
+	assert.Equal(t, 2, status.Instances)
+	assert.Equal(t, "etcd unavailable", status.Error)
+	require.NotNil(t, status.FailingSince)
+	since := *status.FailingSince
+	d.recordListing(errors.New("context deadline exceeded"))
+	assert.Equal(t, since, *p.DiscoveryStatus()[0].FailingSince)
+
+	d.recordListing(nil)
+	assert.Equal(t, []DiscoveryStatus{{Service: "svc", Instances: 2}}, p.DiscoveryStatus())
+}
+
+func TestNewEtcdTLSConfig(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		tlsConfig, err := newEtcdTLSConfig(config.EtcdTLSConfig{})
+		assert.NoError(t, err)
+		assert.Nil(t, tlsConfig)
+	})
+
+	t.Run("server name only", func(t *testing.T) {
+		tlsConfig, err := newEtcdTLSConfig(config.EtcdTLSConfig{Enabled: true, ServerName: "etcd.internal"})
+		require.NoError(t, err)
+		assert.Equal(t, "etcd.internal", tlsConfig.ServerName)
+	})
+
+	t.Run("invalid CA file", func(t *testing.T) {
+		caFile := filepath.Join(t.TempDir(), "ca.pem")
+		require.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0644))
+
+		_, err := newEtcdTLSConfig(config.EtcdTLSConfig{Enabled: true, CAFile: caFile})
+		assert.Error(t, err)
+	})
+
+	t.Run("missing client certificate", func(t *testing.T) {
+		_, err := newEtcdTLSConfig(config.EtcdTLSConfig{Enabled: true, CertFile: "missing.pem", KeyFile: "missing.key"})
+		assert.Error(t, err)
+	})
+}
+
+func TestNewEtcdDiscoveryRequiresHosts(t *testing.T) {
+	_, err := newEtcdDiscovery(&config.EtcdConfig{Hosts: " , "}, &config.Discoveries{Name: "svc"}, &mockLogger{})
+	assert.Error(t, err)
+}
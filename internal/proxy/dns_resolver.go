@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// defaultLookupTimeout bounds lookups when no resolver timeout is configured
+const defaultLookupTimeout = 5 * time.Second
+
+// DNSResolver resolves upstream hostnames with optional custom nameservers
+// and caches both successful and failed lookups
+type DNSResolver struct {
+	config   *config.DNSConfig
+	resolver *net.Resolver
+	lookup   func(ctx context.Context, host string) ([]string, error)
+	cache    map[string]*dnsCacheEntry
+	mutex    sync.RWMutex
+	counter  uint64
+	log      logger.Logger
+}
+
+// dnsCacheEntry represents a cached DNS lookup result
+type dnsCacheEntry struct {
+	addrs      []string
+	err        error
+	expiration time.Time
+}
+
+// NewDNSResolver creates a new caching DNS resolver
+func NewDNSResolver(cfg *config.DNSConfig, log logger.Logger) *DNSResolver {
+	r := &DNSResolver{
+		config: cfg,
+		cache:  make(map[string]*dnsCacheEntry),
+		log:    log,
+	}
+
+	r.resolver = &net.Resolver{PreferGo: true}
+	if len(cfg.Resolvers) > 0 {
+		r.resolver.Dial = r.dialNameserver
+	}
+	r.lookup = r.resolver.LookupHost
+
+	log.Info("DNS resolver initialized",
+		logger.Any("resolvers", cfg.Resolvers),
+		logger.Int("cache_ttl", cfg.CacheTTL),
+		logger.Int("negative_ttl", cfg.NegativeTTL),
+	)
+
+	return r
+}
+
+// dialNameserver connects to one of the configured nameservers in round-robin fashion
+func (r *DNSResolver) dialNameserver(ctx context.Context, network, _ string) (net.Conn, error) {
+	count := atomic.AddUint64(&r.counter, 1)
+	nameserver := r.config.Resolvers[count%uint64(len(r.config.Resolvers))]
+	if _, _, err := net.SplitHostPort(nameserver); err != nil {
+		nameserver = net.JoinHostPort(nameserver, "53")
+	}
+
+	dialer := net.Dialer{Timeout: time.Duration(r.config.Timeout) * time.Second}
+	return dialer.DialContext(ctx, network, nameserver)
+}
+
+// LookupHost returns the addresses for a host, served from cache when possible
+func (r *DNSResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{host}, nil
+	}
+
+	r.mutex.RLock()
+	entry, exists := r.cache[host]
+	r.mutex.RUnlock()
+
+	if exists && time.Now().Before(entry.expiration) {
+		return entry.addrs, entry.err
+	}
+
+	// The result is shared with every request for the host, so the lookup
+	// isn't cut short by the request that triggered it going away
+	timeout := time.Duration(r.config.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultLookupTimeout
+	}
+	lookupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	addrs, err := r.lookup(lookupCtx, host)
+	if err == nil && len(addrs) == 0 {
+		err = &net.DNSError{Err: "no addresses found", Name: host, IsNotFound: true}
+	}
+
+	ttl := r.ttlFor(host)
+	if err != nil {
+		dnsResolutionFailures.WithLabelValues(host).Inc()
+		r.log.Warn("Upstream DNS resolution failed",
+			logger.String("host", host),
+			logger.String("reason", getErrorMessage(err)),
+		)
+		ttl = time.Duration(r.config.NegativeTTL) * time.Second
+		if lookupCtx.Err() != nil {
+			// A lookup that ran out of time says nothing about the host
+			ttl = 0
+		}
+	}
+
+	if ttl > 0 {
+		r.mutex.Lock()
+		r.cache[host] = &dnsCacheEntry{
+			addrs:      addrs,
+			err:        err,
+			expiration: time.Now().Add(ttl),
+		}
+		r.mutex.Unlock()
+	}
+
+	return addrs, err
+}
+
+// ttlFor returns the positive cache TTL for a host, honoring per-host overrides
+func (r *DNSResolver) ttlFor(host string) time.Duration {
+	if ttl, ok := r.config.HostTTL[host]; ok {
+		return time.Duration(ttl) * time.Second
+	}
+	return time.Duration(r.config.CacheTTL) * time.Second
+}
+
+// Flush removes all cached entries
+func (r *DNSResolver) Flush() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.cache = make(map[string]*dnsCacheEntry)
+}
@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestResolver(cfg *config.DNSConfig, lookup func(ctx context.Context, host string) ([]string, error)) *DNSResolver {
+	r := NewDNSResolver(cfg, &mockLogger{})
+	r.lookup = lookup
+	return r
+}
+
+func TestDNSResolverCaching(t *testing.T) {
+	calls := 0
+	r := newTestResolver(&config.DNSConfig{CacheTTL: 30, NegativeTTL: 5}, func(ctx context.Context, host string) ([]string, error) {
+		calls++
+		return []string{"10.0.0.1"}, nil
+	})
+
+	for i := 0; i < 3; i++ {
+		addrs, err := r.LookupHost(context.Background(), "upstream.local")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"10.0.0.1"}, addrs)
+	}
+	assert.Equal(t, 1, calls, "subsequent lookups should be served from cache")
+
+	r.Flush()
+	_, err := r.LookupHost(context.Background(), "upstream.local")
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestDNSResolverNegativeCaching(t *testing.T) {
+	calls := 0
+	r := newTestResolver(&config.DNSConfig{CacheTTL: 30, NegativeTTL: 5}, func(ctx context.Context, host string) ([]string, error) {
+		calls++
+		return nil, errors.New("no such host")
+	})
+
+	_, err := r.LookupHost(context.Background(), "missing.local")
+	assert.Error(t, err)
+	_, err = r.LookupHost(context.Background(), "missing.local")
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls, "failed lookups should be cached")
+}
+
+func TestDNSResolverIgnoresCallerCancellation(t *testing.T) {
+	calls := 0
+	r := newTestResolver(&config.DNSConfig{CacheTTL: 30, NegativeTTL: 5, Timeout: 1}, func(ctx context.Context, host string) ([]string, error) {
+		calls++
+		if calls == 1 {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return []string{"10.0.0.1"}, nil
+	})
+
+	// A lookup that times out isn't cached as a failure
+	_, err := r.LookupHost(context.Background(), "slow.local")
+	assert.Error(t, err)
+
+	// A canceled caller doesn't cancel the lookup
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	addrs, err := r.LookupHost(ctx, "slow.local")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1"}, addrs)
+	assert.Equal(t, 2, calls)
+}
+
+func TestDNSResolverHostTTLOverride(t *testing.T) {
+	calls := 0
+	r := newTestResolver(&config.DNSConfig{
+		CacheTTL:    30,
+		NegativeTTL: 5,
+		HostTTL:     map[string]int{"volatile.local": 0},
+	}, func(ctx context.Context, host string) ([]string, error) {
+		calls++
+		return []string{"10.0.0.2"}, nil
+	})
+
+	r.LookupHost(context.Background(), "volatile.local")
+	r.LookupHost(context.Background(), "volatile.local")
+	assert.Equal(t, 2, calls, "a zero TTL override should disable caching for the host")
+
+	assert.Equal(t, 30*time.Second, r.ttlFor("other.local"))
+}
+
+func TestDNSResolverIPPassthrough(t *testing.T) {
+	r := newTestResolver(&config.DNSConfig{CacheTTL: 30}, func(ctx context.Context, host string) ([]string, error) {
+		t.Fatal("lookup should not be called for IP literals")
+		return nil, nil
+	})
+
+	addrs, err := r.LookupHost(context.Background(), "127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1"}, addrs)
+}
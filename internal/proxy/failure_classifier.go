@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"api-gateway/internal/config"
+)
+
+// FailureClassifier decides which request outcomes count as failures for a
+// circuit breaker
+type FailureClassifier struct {
+	statuses     map[int]bool
+	errors       []string
+	timeoutsOnly bool
+}
+
+// NewFailureClassifier creates a classifier from a route's failure_on settings
+func NewFailureClassifier(cfg *config.CircuitBreakerFailures) *FailureClassifier {
+	c := &FailureClassifier{
+		errors:       cfg.Errors,
+		timeoutsOnly: cfg.TimeoutsOnly,
+	}
+	if len(cfg.Statuses) > 0 {
+		c.statuses = make(map[int]bool, len(cfg.Statuses))
+		for _, status := range cfg.Statuses {
+			c.statuses[status] = true
+		}
+	}
+	return c
+}
+
+// isFailure reports whether a response with status, answered after the
+// upstream error err if any, counts as a failure
+func (c *FailureClassifier) isFailure(status int, err error) bool {
+	if c.timeoutsOnly {
+		return err != nil && isTimeout(err)
+	}
+	if c.statuses != nil {
+		if !c.statuses[status] {
+			return false
+		}
+	} else if status < http.StatusInternalServerError {
+		return false
+	}
+	if err == nil || len(c.errors) == 0 {
+		return true
+	}
+	message := err.Error()
+	for _, substring := range c.errors {
+		if strings.Contains(message, substring) {
+			return true
+		}
+	}
+	return false
+}
+
+// upstreamError holds the error a proxied request failed with, so the
+// circuit breaker can classify it
+type upstreamError struct {
+	err error
+}
+
+type upstreamErrorKey struct{}
+
+// withUpstreamError returns a context the proxy records upstream errors in
+func withUpstreamError(ctx context.Context) (context.Context, *upstreamError) {
+	outcome := &upstreamError{}
+	return context.WithValue(ctx, upstreamErrorKey{}, outcome), outcome
+}
+
+// recordUpstreamError stores err on the request's context, if tracked
+func recordUpstreamError(ctx context.Context, err error) {
+	if outcome, ok := ctx.Value(upstreamErrorKey{}).(*upstreamError); ok {
+		outcome.err = err
+	}
+}
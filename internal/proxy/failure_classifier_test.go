@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailureClassifier(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+
+	tests := []struct {
+		name    string
+		config  config.CircuitBreakerFailures
+		status  int
+		err     error
+		failure bool
+	}{
+		{"5xx by default", config.CircuitBreakerFailures{}, http.StatusInternalServerError, nil, true},
+		{"4xx by default", config.CircuitBreakerFailures{}, http.StatusNotFound, nil, false},
+		{"listed status", config.CircuitBreakerFailures{Statuses: []int{502, 503, 504}}, http.StatusServiceUnavailable, nil, true},
+		{"unlisted 501", config.CircuitBreakerFailures{Statuses: []int{502, 503, 504}}, http.StatusNotImplemented, nil, false},
+		{"listed 429", config.CircuitBreakerFailures{Statuses: []int{429}}, http.StatusTooManyRequests, nil, true},
+		{"matching error", config.CircuitBreakerFailures{Errors: []string{"connection refused"}}, http.StatusBadGateway, refused, true},
+		{"other error", config.CircuitBreakerFailures{Errors: []string{"no such host"}}, http.StatusBadGateway, refused, false},
+		{"errors don't filter upstream 5xx", config.CircuitBreakerFailures{Errors: []string{"no such host"}}, http.StatusInternalServerError, nil, true},
+		{"timeout", config.CircuitBreakerFailures{TimeoutsOnly: true}, http.StatusGatewayTimeout, context.DeadlineExceeded, true},
+		{"upstream 504 without timeout", config.CircuitBreakerFailures{TimeoutsOnly: true}, http.StatusGatewayTimeout, nil, false},
+		{"non-timeout error", config.CircuitBreakerFailures{TimeoutsOnly: true}, http.StatusServiceUnavailable, errors.New("EOF"), false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.failure, NewFailureClassifier(&tc.config).isFailure(tc.status, tc.err))
+		})
+	}
+}
+
+func TestCircuitBreakerFailureOn(t *testing.T) {
+	// An upstream answering 501 for an unimplemented method isn't down
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotImplemented)
+	}))
+	defer upstream.Close()
+
+	// Nothing listens on a closed listener's port
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	down := "http://" + listener.Addr().String()
+	listener.Close()
+
+	failureOn := &config.CircuitBreakerFailures{Statuses: []int{502, 503, 504}, Errors: []string{"connection refused"}}
+	routes := []config.Route{
+		{Path: "/noisy", Upstream: upstream.URL},
+		{Path: "/down", Upstream: down},
+	}
+	for i := range routes {
+		routes[i].Middlewares = &config.Middlewares{CircuitBreaker: &config.CircuitBreakerSettings{
+			Enabled: true, Threshold: 2, Timeout: 30, FailureOn: failureOn,
+		}}
+	}
+	p := NewHTTPProxy(&config.Config{}, &config.RouteConfig{Routes: routes}, &mockLogger{})
+
+	for _, route := range routes {
+		handler := p.ProxyRequest(route)
+		for i := 0; i < 3; i++ {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, route.Path, nil))
+		}
+	}
+
+	assert.Equal(t, "CLOSED", p.CircuitBreaker("/noisy").GetStatus()["state"])
+	assert.Equal(t, "OPEN", p.CircuitBreaker("/down").GetStatus()["state"])
+}
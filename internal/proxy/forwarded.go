@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"api-gateway/internal/config"
+)
+
+// forwardedHeaderNames are the headers set by the forwarded headers policy
+var forwardedHeaderNames = []string{
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Forwarded-Proto",
+	"X-Forwarded-Port",
+}
+
+// forwardedHeaders sets the forwarding headers of upstream requests according
+// to the configured policy
+type forwardedHeaders struct {
+	policy    string
+	forwarded bool
+}
+
+// newForwardedHeaders creates the forwarding headers policy, appending by default
+func newForwardedHeaders(cfg *config.ForwardedHeadersConfig) forwardedHeaders {
+	policy := cfg.Policy
+	if policy == "" {
+		policy = config.ForwardedAppend
+	}
+	return forwardedHeaders{policy: policy, forwarded: cfg.Forwarded}
+}
+
+// apply sets the forwarding headers of the upstream request headers out for
+// the client request in
+func (f forwardedHeaders) apply(out http.Header, in *http.Request) {
+	peer := peerIP(in)
+	proto := requestProto(in)
+	hop := map[string]string{
+		"X-Forwarded-For":   peer,
+		"X-Forwarded-Host":  in.Host,
+		"X-Forwarded-Proto": proto,
+		"X-Forwarded-Port":  requestPort(in, proto),
+	}
+	element := forwardedElement(peer, in.Host, proto)
+
+	switch f.policy {
+	case config.ForwardedReplace:
+		for _, name := range forwardedHeaderNames {
+			setOrDelete(out, name, hop[name])
+		}
+		out.Del("Forwarded")
+		if f.forwarded {
+			out.Set("Forwarded", element)
+		}
+
+	case config.ForwardedPreserve:
+		for _, name := range forwardedHeaderNames {
+			if values := in.Header.Values(name); len(values) > 0 {
+				out[name] = append([]string(nil), values...)
+			} else {
+				setOrDelete(out, name, hop[name])
+			}
+		}
+		if values := in.Header.Values("Forwarded"); len(values) > 0 {
+			out["Forwarded"] = append([]string(nil), values...)
+		} else if f.forwarded {
+			out.Set("Forwarded", element)
+		}
+
+	default:
+		chain := in.Header.Values("X-Forwarded-For")
+		if peer != "" {
+			chain = append(chain, peer)
+		}
+		setOrDelete(out, "X-Forwarded-For", strings.Join(chain, ", "))
+		for _, name := range forwardedHeaderNames[1:] {
+			setOrDelete(out, name, hop[name])
+		}
+		if f.forwarded {
+			out.Set("Forwarded", strings.Join(append(in.Header.Values("Forwarded"), element), ", "))
+		}
+	}
+}
+
+// setOrDelete sets a header, or deletes it for an empty value
+func setOrDelete(header http.Header, name, value string) {
+	if value == "" {
+		header.Del(name)
+		return
+	}
+	header.Set(name, value)
+}
+
+// peerIP returns the address of the connection the request came from
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// requestProto returns the protocol the client used to reach the gateway
+func requestProto(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// requestPort returns the gateway port the client connected to, from the
+// listener if known, else from the Host header or the protocol's default
+func requestPort(r *http.Request, proto string) string {
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		if _, port, err := net.SplitHostPort(addr.String()); err == nil {
+			return port
+		}
+	}
+	if _, port, err := net.SplitHostPort(r.Host); err == nil {
+		return port
+	}
+	if proto == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+// forwardedElement returns the RFC 7239 Forwarded element of the gateway's hop
+func forwardedElement(peer, host, proto string) string {
+	var params []string
+	if peer != "" {
+		node := peer
+		if strings.Contains(peer, ":") {
+			// IPv6 addresses are bracketed
+			node = "[" + peer + "]"
+		}
+		params = append(params, "for="+quoteForwarded(node))
+	}
+	if host != "" {
+		params = append(params, "host="+quoteForwarded(host))
+	}
+	params = append(params, "proto="+proto)
+	return strings.Join(params, ";")
+}
+
+// quoteForwarded returns a Forwarded parameter value, quoted unless it is a
+// token
+func quoteForwarded(value string) string {
+	for _, c := range value {
+		if !isTokenChar(c) {
+			return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+		}
+	}
+	return value
+}
+
+// isTokenChar reports whether c may appear in an RFC 7230 token
+func isTokenChar(c rune) bool {
+	if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+		return true
+	}
+	return strings.ContainsRune("!#$%&'*+-.^_`|~", c)
+}
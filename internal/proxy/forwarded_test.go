@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func forwardedRequest() *http.Request {
+	req := httptest.NewRequest("GET", "http://api.example.com/orders", nil)
+	req.RemoteAddr = "203.0.113.7:51000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("Forwarded", "for=198.51.100.1")
+	return req
+}
+
+func TestForwardedHeadersPolicies(t *testing.T) {
+	tests := []struct {
+		name   string
+		config config.ForwardedHeadersConfig
+		want   http.Header
+	}{
+		{
+			name:   "append",
+			config: config.ForwardedHeadersConfig{Forwarded: true},
+			want: http.Header{
+				"X-Forwarded-For":   {"198.51.100.1, 203.0.113.7"},
+				"X-Forwarded-Host":  {"api.example.com"},
+				"X-Forwarded-Proto": {"http"},
+				"X-Forwarded-Port":  {"80"},
+				"Forwarded":         {"for=198.51.100.1, for=203.0.113.7;host=api.example.com;proto=http"},
+			},
+		},
+		{
+			name:   "replace",
+			config: config.ForwardedHeadersConfig{Policy: config.ForwardedReplace},
+			want: http.Header{
+				"X-Forwarded-For":   {"203.0.113.7"},
+				"X-Forwarded-Host":  {"api.example.com"},
+				"X-Forwarded-Proto": {"http"},
+				"X-Forwarded-Port":  {"80"},
+			},
+		},
+		{
+			name:   "preserve",
+			config: config.ForwardedHeadersConfig{Policy: config.ForwardedPreserve, Forwarded: true},
+			want: http.Header{
+				"X-Forwarded-For":   {"198.51.100.1"},
+				"X-Forwarded-Host":  {"api.example.com"},
+				"X-Forwarded-Proto": {"https"},
+				"X-Forwarded-Port":  {"80"},
+				"Forwarded":         {"for=198.51.100.1"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := forwardedRequest()
+			out := req.Header.Clone()
+			newForwardedHeaders(&tt.config).apply(out, req)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+}
+
+func TestForwardedHeadersTLS(t *testing.T) {
+	req := httptest.NewRequest("GET", "https://api.example.com/orders", nil)
+	req.RemoteAddr = "[2001:db8::1]:51000"
+	req.TLS = &tls.ConnectionState{}
+	req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.TCPAddr{IP: net.IPv4zero, Port: 8443}))
+
+	out := http.Header{}
+	newForwardedHeaders(&config.ForwardedHeadersConfig{Forwarded: true}).apply(out, req)
+	assert.Equal(t, "2001:db8::1", out.Get("X-Forwarded-For"))
+	assert.Equal(t, "https", out.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "8443", out.Get("X-Forwarded-Port"))
+	assert.Equal(t, `for="[2001:db8::1]";host=api.example.com;proto=https`, out.Get("Forwarded"))
+}
+
+func TestProxyRequestForwardedHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Received-XFF", r.Header.Get("X-Forwarded-For"))
+		w.Header().Set("X-Received-Host", r.Header.Get("X-Forwarded-Host"))
+		w.Header().Set("X-Received-Proto", r.Header.Get("X-Forwarded-Proto"))
+	}))
+	defer upstream.Close()
+
+	route := config.Route{Path: "/api", Upstream: upstream.URL, Middlewares: &config.Middlewares{}}
+	p := NewHTTPProxy(&config.Config{}, &config.RouteConfig{Routes: []config.Route{route}}, &mockLogger{})
+
+	req := httptest.NewRequest("GET", "http://api.example.com/api/orders", nil)
+	req.RemoteAddr = "203.0.113.7:51000"
+	rec := httptest.NewRecorder()
+	p.ProxyRequest(route).ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	// The client is listed once, not again by the reverse proxy
+	assert.Equal(t, "203.0.113.7", rec.Header().Get("X-Received-XFF"))
+	assert.Equal(t, "api.example.com", rec.Header().Get("X-Received-Host"))
+	assert.Equal(t, "http", rec.Header().Get("X-Received-Proto"))
+}
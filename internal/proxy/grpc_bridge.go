@@ -0,0 +1,198 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// closeCodeGRPCBase is added to the gRPC status code of a failed stream to
+// give the WebSocket close code, so 4005 is NOT_FOUND
+const closeCodeGRPCBase = 4000
+
+// maxCloseReason is the longest reason a close frame can carry
+const maxCloseReason = 123
+
+// GRPCBridge serves GRPC_WEBSOCKET routes, relaying JSON messages of a
+// WebSocket connection to and from a gRPC stream. The method's messages must
+// be registered with the protobuf registry, as for other gRPC routes.
+type GRPCBridge struct {
+	grpc     *GRPCProxy
+	upgrader websocket.Upgrader
+	log      logger.Logger
+}
+
+// NewGRPCBridge creates a WebSocket to gRPC bridge
+func NewGRPCBridge(log logger.Logger) *GRPCBridge {
+	return &GRPCBridge{
+		grpc: NewGRPCProxy(5*time.Minute, 100, log),
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			// Allow all origins, like the WebSocket proxy
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		log: log,
+	}
+}
+
+// SetDescriptors looks up bridged methods not compiled into the gateway in
+// the descriptor registry
+func (b *GRPCBridge) SetDescriptors(descriptors *DescriptorRegistry) {
+	b.grpc.SetDescriptors(descriptors)
+}
+
+// Handler bridges WebSocket connections to the route's gRPC method. The stream
+// is opened before the handshake, so an unreachable upstream is answered with
+// an HTTP error. A failed stream closes the connection with code 4000 plus the
+// gRPC status code.
+func (b *GRPCBridge) Handler(route config.Route) http.Handler {
+	bridge := route.GRPCBridge
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !websocket.IsWebSocketUpgrade(r) {
+			http.Error(w, "WebSocket upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		// Pass the configured request headers upstream as metadata
+		md := metadata.MD{}
+		for _, name := range bridge.ForwardHeaders {
+			if values := r.Header.Values(name); len(values) > 0 {
+				md.Append(strings.ToLower(name), values...)
+			}
+		}
+		ctx = metadata.NewOutgoingContext(ctx, md)
+
+		stream, method, release, err := b.grpc.OpenStream(ctx, bridge.Method, route.Upstream, time.Duration(route.Timeout)*time.Second)
+		if err != nil {
+			b.log.Error("Failed to open gRPC stream",
+				logger.String("path", route.Path),
+				logger.String("method", bridge.Method),
+				logger.Error(err),
+			)
+			if status.Code(err) == codes.Unimplemented {
+				http.Error(w, "gRPC method not available", http.StatusNotImplemented)
+			} else {
+				http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+			}
+			return
+		}
+		defer release()
+
+		conn, err := b.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			b.log.Error("Failed to upgrade client connection", logger.Error(err))
+			return
+		}
+		defer conn.Close()
+		conn.SetReadLimit(bridge.MaxMessageSize)
+
+		go b.relayRequests(conn, stream, method.Input(), cancel)
+		err = b.relayResponses(conn, stream, method.Output())
+
+		code, reason := websocket.CloseNormalClosure, ""
+		if err != nil {
+			st := status.Convert(err)
+			code, reason = closeCodeGRPCBase+int(st.Code()), truncateCloseReason(st.Message())
+			b.log.Debug("gRPC stream failed",
+				logger.String("method", bridge.Method),
+				logger.String("code", st.Code().String()),
+			)
+		}
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	})
+}
+
+// relayRequests sends the client's messages on the stream until the client
+// sends an empty message, which ends its side of the stream. The call is
+// cancelled if the client goes away or sends a message that isn't valid.
+func (b *GRPCBridge) relayRequests(conn *websocket.Conn, stream grpc.ClientStream, input protoreflect.MessageDescriptor, cancel context.CancelFunc) {
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			cancel()
+			return
+		}
+		if len(data) == 0 {
+			stream.CloseSend()
+			continue
+		}
+
+		msg := dynamicMessage(input)
+		if msg == nil {
+			cancel()
+			return
+		}
+		if err := protojson.Unmarshal(data, msg); err != nil {
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseInvalidFramePayloadData, truncateCloseReason(err.Error())),
+				time.Now().Add(time.Second))
+			cancel()
+			return
+		}
+		if err := stream.SendMsg(msg); err != nil {
+			// The stream's error is reported by relayResponses
+			return
+		}
+	}
+}
+
+// relayResponses writes the stream's messages to the client until the stream
+// ends, returning nil if it ended successfully
+func (b *GRPCBridge) relayResponses(conn *websocket.Conn, stream grpc.ClientStream, output protoreflect.MessageDescriptor) error {
+	for {
+		msg := dynamicMessage(output)
+		if msg == nil {
+			return status.Error(codes.Internal, "failed to create output message")
+		}
+		if err := stream.RecvMsg(msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		data, err := protojson.Marshal(msg)
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to encode response: %v", err)
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			return status.FromContextError(context.Canceled).Err()
+		}
+	}
+}
+
+// truncateCloseReason shortens reason to fit a close frame without splitting
+// a UTF-8 sequence
+func truncateCloseReason(reason string) string {
+	if len(reason) <= maxCloseReason {
+		return reason
+	}
+	reason = reason[:maxCloseReason]
+	for !utf8.ValidString(reason) {
+		reason = reason[:len(reason)-1]
+	}
+	return reason
+}
+
+// Close closes the bridge's gRPC connections
+func (b *GRPCBridge) Close() {
+	b.grpc.Close()
+}
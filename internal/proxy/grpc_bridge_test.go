@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// startHealthServer serves the gRPC health service, whose Watch method
+// streams status changes
+func startHealthServer(t *testing.T) (string, *health.Server, *grpc.Server) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return listener.Addr().String(), healthServer, server
+}
+
+func dialBridge(t *testing.T, route config.Route) *websocket.Conn {
+	bridge := NewGRPCBridge(&mockLogger{})
+	t.Cleanup(bridge.Close)
+	server := httptest.NewServer(bridge.Handler(route))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func TestGRPCBridgeStreams(t *testing.T) {
+	addr, healthServer, server := startHealthServer(t)
+	healthServer.SetServingStatus("orders", healthpb.HealthCheckResponse_SERVING)
+
+	conn := dialBridge(t, config.Route{
+		Path:       "/ws/health",
+		Upstream:   addr,
+		Timeout:    5,
+		GRPCBridge: &config.GRPCBridgeConfig{Method: "grpc.health.v1.Health/Watch", MaxMessageSize: 1 << 20},
+	})
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"service": "orders"}`)))
+	_, data, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"status": "SERVING"}`, string(data))
+
+	healthServer.SetServingStatus("orders", healthpb.HealthCheckResponse_NOT_SERVING)
+	_, data, err = conn.ReadMessage()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"status": "NOT_SERVING"}`, string(data))
+
+	// A failed stream closes the connection with its gRPC code
+	server.Stop()
+	_, _, err = conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, closeCodeGRPCBase+int(codes.Unavailable), closeErr.Code)
+}
+
+func TestGRPCBridgeInvalidMessage(t *testing.T) {
+	addr, _, _ := startHealthServer(t)
+	conn := dialBridge(t, config.Route{
+		Path:       "/ws/health",
+		Upstream:   addr,
+		Timeout:    5,
+		GRPCBridge: &config.GRPCBridgeConfig{Method: "grpc.health.v1.Health/Watch", MaxMessageSize: 1 << 20},
+	})
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"unknown": 1}`)))
+	_, _, err := conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, websocket.CloseInvalidFramePayloadData, closeErr.Code)
+}
+
+func TestGRPCBridgeErrors(t *testing.T) {
+	addr, _, _ := startHealthServer(t)
+	bridge := NewGRPCBridge(&mockLogger{})
+	defer bridge.Close()
+
+	// Plain HTTP requests are refused
+	route := config.Route{Path: "/ws", Upstream: addr, Timeout: 5, GRPCBridge: &config.GRPCBridgeConfig{Method: "grpc.health.v1.Health/Watch"}}
+	rec := httptest.NewRecorder()
+	bridge.Handler(route).ServeHTTP(rec, httptest.NewRequest("GET", "/ws", nil))
+	assert.Equal(t, http.StatusUpgradeRequired, rec.Code)
+
+	// Methods without registered descriptors can't be bridged
+	route.GRPCBridge.Method = "chat.v1.Chat/Stream"
+	server := httptest.NewServer(bridge.Handler(route))
+	defer server.Close()
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+}
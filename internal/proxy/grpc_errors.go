@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"api-gateway/internal/config"
+)
+
+// defaultGRPCStatuses maps gRPC codes to the HTTP statuses used by
+// google.api.http transcoding
+var defaultGRPCStatuses = map[codes.Code]int{
+	codes.OK:                 http.StatusOK,
+	codes.Canceled:           499, // Client closed request
+	codes.Unknown:            http.StatusInternalServerError,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusBadRequest,
+	codes.Aborted:            http.StatusConflict,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Internal:           http.StatusInternalServerError,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DataLoss:           http.StatusInternalServerError,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+}
+
+// grpcErrorMapper turns gRPC errors from upstreams of HTTP routes into HTTP
+// error responses
+type grpcErrorMapper struct {
+	statuses map[codes.Code]int
+}
+
+// grpcErrorBody is the JSON body of a mapped gRPC error, in the form of
+// google.rpc.Status
+type grpcErrorBody struct {
+	Code    int               `json:"code"`
+	Message string            `json:"message"`
+	Details []json.RawMessage `json:"details"`
+}
+
+// newGRPCErrorMapper creates a mapper with the configured statuses replacing
+// the defaults. Unknown code names are skipped; the config rejects them.
+func newGRPCErrorMapper(overrides map[string]int) *grpcErrorMapper {
+	statuses := make(map[codes.Code]int, len(defaultGRPCStatuses))
+	for code, status := range defaultGRPCStatuses {
+		statuses[code] = status
+	}
+	for name, status := range overrides {
+		if code, err := config.ParseGRPCCode(name); err == nil {
+			statuses[code] = status
+		}
+	}
+	return &grpcErrorMapper{statuses: statuses}
+}
+
+// httpStatus returns the HTTP status of a gRPC code
+func (m *grpcErrorMapper) httpStatus(code codes.Code) int {
+	if status, ok := m.statuses[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// modifyResponse rewrites upstream responses that carry a gRPC error in their
+// headers, as trailers-only gRPC responses do. The status is mapped and the
+// body replaced with the google.rpc.Status as JSON, details included.
+func (m *grpcErrorMapper) modifyResponse(resp *http.Response) error {
+	value := resp.Header.Get("Grpc-Status")
+	if value == "" || value == "0" {
+		return nil
+	}
+	code, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		code = uint64(codes.Unknown)
+	}
+
+	st := &spb.Status{Code: int32(code)}
+	if details := resp.Header.Get("Grpc-Status-Details-Bin"); details != "" {
+		if data, err := decodeBinaryHeader(details); err == nil {
+			if err := proto.Unmarshal(data, st); err != nil {
+				st = &spb.Status{Code: int32(code)}
+			}
+		}
+	}
+	if st.Message == "" {
+		st.Message, _ = url.PathUnescape(resp.Header.Get("Grpc-Message"))
+	}
+
+	body, err := json.Marshal(grpcErrorBody{
+		Code:    int(st.Code),
+		Message: st.Message,
+		Details: detailsJSON(st),
+	})
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.StatusCode = m.httpStatus(codes.Code(code))
+	resp.Status = ""
+	for key := range resp.Header {
+		if strings.HasPrefix(key, "Grpc-") {
+			resp.Header.Del(key)
+		}
+	}
+	resp.Header.Set("Content-Type", "application/json")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+// detailsJSON renders the details of a status. Details of types unknown to
+// the gateway keep their type URL with the raw value base64 encoded.
+func detailsJSON(st *spb.Status) []json.RawMessage {
+	details := make([]json.RawMessage, 0, len(st.Details))
+	for _, detail := range st.Details {
+		data, err := protojson.Marshal(detail)
+		if err != nil {
+			data, _ = json.Marshal(map[string]string{
+				"@type": detail.TypeUrl,
+				"value": base64.StdEncoding.EncodeToString(detail.Value),
+			})
+		}
+		details = append(details, data)
+	}
+	return details
+}
+
+// decodeBinaryHeader decodes a -bin header, which may be sent with or without
+// padding
+func decodeBinaryHeader(value string) ([]byte, error) {
+	if len(value)%4 == 0 {
+		return base64.StdEncoding.DecodeString(value)
+	}
+	return base64.RawStdEncoding.DecodeString(value)
+}
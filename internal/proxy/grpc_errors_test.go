@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func grpcErrorResponse(headers map[string]string) *http.Response {
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/grpc"}},
+		Body:       io.NopCloser(strings.NewReader("")),
+	}
+	for key, value := range headers {
+		resp.Header.Set(key, value)
+	}
+	return resp
+}
+
+func TestGRPCErrorMapping(t *testing.T) {
+	mapper := newGRPCErrorMapper(map[string]int{"FAILED_PRECONDITION": 412})
+
+	assert.Equal(t, http.StatusNotFound, mapper.httpStatus(codes.NotFound))
+	assert.Equal(t, http.StatusTooManyRequests, mapper.httpStatus(codes.ResourceExhausted))
+	assert.Equal(t, http.StatusUnauthorized, mapper.httpStatus(codes.Unauthenticated))
+	assert.Equal(t, http.StatusPreconditionFailed, mapper.httpStatus(codes.FailedPrecondition))
+	assert.Equal(t, http.StatusInternalServerError, mapper.httpStatus(codes.Code(99)))
+}
+
+func TestGRPCErrorResponse(t *testing.T) {
+	mapper := newGRPCErrorMapper(nil)
+
+	t.Run("message only", func(t *testing.T) {
+		resp := grpcErrorResponse(map[string]string{
+			"Grpc-Status":  "5",
+			"Grpc-Message": "user%20not%20found",
+		})
+		require.NoError(t, mapper.modifyResponse(resp))
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		assert.Empty(t, resp.Header.Get("Grpc-Status"))
+		body, _ := io.ReadAll(resp.Body)
+		assert.JSONEq(t, `{"code":5,"message":"user not found","details":[]}`, string(body))
+	})
+
+	t.Run("status details", func(t *testing.T) {
+		info, err := anypb.New(&errdetails.ErrorInfo{Reason: "QUOTA", Domain: "example.com"})
+		require.NoError(t, err)
+		data, err := proto.Marshal(&spb.Status{
+			Code:    int32(codes.ResourceExhausted),
+			Message: "quota exceeded",
+			Details: []*anypb.Any{info, {TypeUrl: "type.googleapis.com/example.Unknown", Value: []byte{1, 2}}},
+		})
+		require.NoError(t, err)
+
+		resp := grpcErrorResponse(map[string]string{
+			"Grpc-Status":             "8",
+			"Grpc-Status-Details-Bin": base64.RawStdEncoding.EncodeToString(data),
+		})
+		require.NoError(t, mapper.modifyResponse(resp))
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+		var body grpcErrorBody
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, 8, body.Code)
+		assert.Equal(t, "quota exceeded", body.Message)
+		require.Len(t, body.Details, 2)
+		assert.JSONEq(t, `{"@type":"type.googleapis.com/google.rpc.ErrorInfo","reason":"QUOTA","domain":"example.com"}`, string(body.Details[0]))
+		assert.JSONEq(t, `{"@type":"type.googleapis.com/example.Unknown","value":"AQI="}`, string(body.Details[1]))
+	})
+
+	t.Run("success untouched", func(t *testing.T) {
+		resp := grpcErrorResponse(map[string]string{"Grpc-Status": "0"})
+		require.NoError(t, mapper.modifyResponse(resp))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/grpc", resp.Header.Get("Content-Type"))
+	})
+}
@@ -14,6 +14,7 @@ import (
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
 
 	grpcpool "api-gateway/pkg/grpc"
 	"api-gateway/pkg/logger"
@@ -23,6 +24,7 @@ import (
 type GRPCProxy struct {
 	pool        *grpcpool.ClientPool
 	methodCache sync.Map // cache for method descriptors
+	descriptors *DescriptorRegistry
 	logger      logger.Logger
 }
 
@@ -54,12 +56,20 @@ func NewGRPCProxy(maxIdle time.Duration, maxConns int, log logger.Logger) *GRPCP
 	}
 }
 
-// ForwardGRPC handles direct gRPC to gRPC forwarding
+// SetDescriptors looks up methods not compiled into the gateway in the
+// descriptor registry
+func (p *GRPCProxy) SetDescriptors(descriptors *DescriptorRegistry) {
+	p.descriptors = descriptors
+}
+
+// ForwardGRPC handles direct gRPC to gRPC forwarding. Call options such as
+// grpc.Trailer are passed to the upstream call.
 func (p *GRPCProxy) ForwardGRPC(
 	ctx context.Context,
 	fullMethodName string,
 	target string,
 	requestMessage proto.Message,
+	opts ...grpc.CallOption,
 ) (proto.Message, metadata.MD, error) {
 	// Get connection from pool
 	conn, err := p.pool.GetConn(ctx, target)
@@ -91,9 +101,19 @@ func (p *GRPCProxy) ForwardGRPC(
 		return nil, nil, status.Error(codes.Internal, "failed to create output message")
 	}
 
-	// Make gRPC call with metadata
+	// Make gRPC call with the client's metadata. The client's deadline and
+	// cancellation carry over through ctx.
 	var header metadata.MD
-	err = conn.Invoke(ctx, fullMethodName, requestMessage, outputMsg, grpc.Header(&header))
+	opts = append(opts, grpc.Header(&header))
+	err = conn.Invoke(upstreamContext(ctx), fullMethodName, requestMessage, outputMsg, opts...)
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		p.logger.Debug("gRPC call abandoned",
+			logger.String("method", fullMethodName),
+			logger.String("target", target),
+			logger.Error(ctxErr),
+		)
+		return nil, nil, status.FromContextError(ctxErr).Err()
+	}
 	if err != nil {
 		p.logger.Error("gRPC call failed",
 			logger.String("method", fullMethodName),
@@ -106,11 +126,82 @@ func (p *GRPCProxy) ForwardGRPC(
 	return outputMsg, header, nil
 }
 
-// dynamicMessage creates a new dynamic proto message from a descriptor
+// OpenStream starts a bidirectional stream of the method on target, waiting
+// up to connectTimeout for a connection. The stream lasts as long as ctx. The
+// returned release function must be called once the stream is done.
+func (p *GRPCProxy) OpenStream(
+	ctx context.Context,
+	fullMethodName string,
+	target string,
+	connectTimeout time.Duration,
+) (grpc.ClientStream, protoreflect.MethodDescriptor, func(), error) {
+	methodDesc, err := p.getMethodDescriptor(fullMethodName)
+	if err != nil {
+		return nil, nil, nil, status.Errorf(codes.Unimplemented, "invalid gRPC method: %v", err)
+	}
+
+	connectCtx, cancel := context.WithTimeout(ctx, connectTimeout)
+	conn, err := p.pool.GetConn(connectCtx, target)
+	cancel()
+	if err != nil {
+		p.logger.Error("Failed to connect to gRPC service",
+			logger.String("target", target),
+			logger.Error(err),
+		)
+		return nil, nil, nil, status.Errorf(codes.Unavailable, "failed to connect to backend: %v", err)
+	}
+	release := func() { p.pool.ReleaseConn(target) }
+
+	desc := &grpc.StreamDesc{StreamName: string(methodDesc.Name()), ClientStreams: true, ServerStreams: true}
+	stream, err := conn.NewStream(ctx, desc, "/"+fullMethodName)
+	if err != nil {
+		release()
+		return nil, nil, nil, err
+	}
+	return stream, methodDesc, release, nil
+}
+
+// hopMetadata lists the incoming metadata set by the transport for the
+// client's connection, which must not be sent upstream
+var hopMetadata = map[string]bool{
+	":authority":   true,
+	"content-type": true,
+	"user-agent":   true,
+	"te":           true,
+	"connection":   true,
+}
+
+// upstreamContext returns ctx with the client's metadata as outgoing
+// metadata, merged with any already set. Transport and grpc- prefixed keys
+// are left out; the client's grpc-timeout is sent again from ctx's deadline.
+func upstreamContext(ctx context.Context) context.Context {
+	incoming, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	outgoing, _ := metadata.FromOutgoingContext(ctx)
+	md := outgoing.Copy()
+	if md == nil {
+		md = metadata.MD{}
+	}
+	for key, values := range incoming {
+		if hopMetadata[key] || strings.HasPrefix(key, "grpc-") {
+			continue
+		}
+		if _, set := md[key]; set {
+			continue
+		}
+		md[key] = append([]string(nil), values...)
+	}
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// dynamicMessage creates a new proto message from a descriptor, using the
+// compiled-in type if there is one
 func dynamicMessage(desc protoreflect.MessageDescriptor) proto.Message {
 	msgType, err := protoregistry.GlobalTypes.FindMessageByName(desc.FullName())
 	if err != nil {
-		return nil
+		return dynamicpb.NewMessage(desc)
 	}
 	return msgType.New().Interface()
 }
@@ -129,8 +220,12 @@ func (p *GRPCProxy) getMethodDescriptor(fullMethodName string) (protoreflect.Met
 	serviceName := parts[0]
 	methodName := parts[1]
 
-	// Get service descriptor
+	// Get service descriptor, from the registry if it isn't compiled in.
+	// Registry descriptors aren't cached as they change on reload.
 	sd, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(serviceName))
+	if err != nil && p.descriptors != nil {
+		return p.descriptors.FindMethod(fullMethodName)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -30,6 +30,10 @@ func (m *MockClientConn) Invoke(ctx context.Context, method string, args interfa
 	return m.invokeFunc(ctx, method, args, reply, opts...)
 }
 
+func (m *MockClientConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return nil, fmt.Errorf("streams not supported by mock")
+}
+
 // Define interface for testing to avoid direct dependency on the concrete type
 type ClientPoolInterface interface {
 	GetConn(ctx context.Context, target string) (grpcpool.ClientConn, error)
@@ -433,3 +437,28 @@ func TestGRPCProxyCloseMock(t *testing.T) {
 	proxy.pool.Close()
 	assert.True(t, closed, "Pool should be closed")
 }
+
+// TestUpstreamContext tests that client metadata is forwarded without the
+// transport keys
+func TestUpstreamContext(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.MD{
+		":authority":    {"gateway:9001"},
+		"content-type":  {"application/grpc"},
+		"user-agent":    {"grpc-go/1.60"},
+		"grpc-timeout":  {"5S"},
+		"authorization": {"Bearer token"},
+		"x-request-id":  {"abc"},
+	})
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-request-id", "gateway")
+
+	md, ok := metadata.FromOutgoingContext(upstreamContext(ctx))
+	require.True(t, ok)
+	assert.Equal(t, metadata.MD{
+		"authorization": {"Bearer token"},
+		"x-request-id":  {"gateway"},
+	}, md)
+
+	// Without incoming metadata the context is unchanged
+	plain := context.Background()
+	assert.Equal(t, plain, upstreamContext(plain))
+}
@@ -0,0 +1,266 @@
+package proxy
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// defaultHealthCheckWorkers bounds the probes running at once when the
+// configuration leaves it unset
+const defaultHealthCheckWorkers = 16
+
+// HealthScheduler runs the upstream health checks of every load balancer on
+// a bounded pool of workers. Each load balancer is checked on its own
+// jittered interval, so routes configured alike don't probe in lockstep, and
+// a round is skipped while the previous one is still running.
+type HealthScheduler struct {
+	workers int
+	jitter  float64
+	log     logger.Logger
+
+	mutex    sync.Mutex
+	targets  []*healthTarget
+	disabled map[string]bool
+	started  bool
+	stopped  bool
+
+	wake  chan struct{}
+	tasks chan healthTask
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// healthTarget is a load balancer whose endpoints are checked together
+type healthTarget struct {
+	route    string
+	lb       *LoadBalancer
+	interval time.Duration
+	next     time.Time
+	// Probes of the last round still queued or running
+	pending atomic.Int64
+}
+
+// healthTask is a probe of one endpoint
+type healthTask struct {
+	target   *healthTarget
+	endpoint *url.URL
+}
+
+// HealthCheckState describes the health checks of a route
+type HealthCheckState struct {
+	Path      string `json:"path"`
+	Enabled   bool   `json:"enabled"`
+	Endpoints int    `json:"endpoints"`
+	Healthy   int    `json:"healthy"`
+}
+
+// NewHealthScheduler creates a scheduler. Its workers start with the first
+// scheduled load balancer.
+func NewHealthScheduler(cfg *config.HealthChecksConfig, log logger.Logger) *HealthScheduler {
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = defaultHealthCheckWorkers
+	}
+	return &HealthScheduler{
+		workers:  workers,
+		jitter:   cfg.Jitter,
+		log:      log,
+		disabled: make(map[string]bool),
+		wake:     make(chan struct{}, 1),
+		tasks:    make(chan healthTask),
+		stop:     make(chan struct{}),
+	}
+}
+
+// add schedules the health checks of a route's load balancer. The first
+// check happens at a random point of the interval so checks of routes
+// created together are spread out.
+func (s *HealthScheduler) add(route string, lb *LoadBalancer) {
+	interval := lb.healthCheckInterval()
+	target := &healthTarget{
+		route:    route,
+		lb:       lb,
+		interval: interval,
+		next:     time.Now().Add(time.Duration(rand.Int63n(int64(interval))) + 1),
+	}
+
+	s.mutex.Lock()
+	if s.stopped {
+		s.mutex.Unlock()
+		return
+	}
+	s.targets = append(s.targets, target)
+	if !s.started {
+		s.started = true
+		s.wg.Add(s.workers + 1)
+		for i := 0; i < s.workers; i++ {
+			go s.work()
+		}
+		go s.run()
+	}
+	s.mutex.Unlock()
+
+	// Let the scheduler pick up a check due before the one it waits for
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// SetEnabled pauses or resumes the health checks of a route. Endpoints of a
+// paused route count as healthy, as they do for routes without checks.
+func (s *HealthScheduler) SetEnabled(route string, enabled bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	found := false
+	for _, target := range s.targets {
+		if target.route != route {
+			continue
+		}
+		found = true
+		if !enabled {
+			target.lb.resetHealth()
+		}
+	}
+	if !found {
+		return fmt.Errorf("no health checked route with path %s", route)
+	}
+
+	if enabled {
+		delete(s.disabled, route)
+	} else {
+		s.disabled[route] = true
+	}
+	s.log.Info("Changed route health checks",
+		logger.String("path", route),
+		logger.Bool("enabled", enabled),
+	)
+	return nil
+}
+
+// States returns the health check state of every scheduled route
+func (s *HealthScheduler) States() []HealthCheckState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	byRoute := make(map[string]*HealthCheckState)
+	for _, target := range s.targets {
+		state, ok := byRoute[target.route]
+		if !ok {
+			state = &HealthCheckState{Path: target.route, Enabled: !s.disabled[target.route]}
+			byRoute[target.route] = state
+		}
+		state.Endpoints += len(target.lb.currentEndpoints())
+		state.Healthy += len(target.lb.getHealthyEndpoints())
+	}
+
+	states := make([]HealthCheckState, 0, len(byRoute))
+	for _, state := range byRoute {
+		states = append(states, *state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Path < states[j].Path })
+	return states
+}
+
+// Stop ends the scheduling and waits for running probes to finish
+func (s *HealthScheduler) Stop() {
+	s.mutex.Lock()
+	if s.stopped {
+		s.mutex.Unlock()
+		return
+	}
+	s.stopped = true
+	close(s.stop)
+	s.mutex.Unlock()
+	s.wg.Wait()
+}
+
+// run hands due probes to the workers, waiting for a free one when all are
+// busy
+func (s *HealthScheduler) run() {
+	defer s.wg.Done()
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		tasks, wait := s.due(time.Now())
+		for _, task := range tasks {
+			select {
+			case s.tasks <- task:
+			case <-s.stop:
+				return
+			}
+		}
+		if len(tasks) > 0 {
+			continue
+		}
+
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// due returns the probes of the targets due at now, scheduling their next
+// round, and how long until the next target is due
+func (s *HealthScheduler) due(now time.Time) ([]healthTask, time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var tasks []healthTask
+	wait := time.Hour
+	for _, target := range s.targets {
+		if !target.next.After(now) {
+			target.next = now.Add(s.jittered(target.interval))
+			switch {
+			case s.disabled[target.route]:
+			case target.pending.Load() > 0:
+				healthChecksSkipped.WithLabelValues(target.route).Inc()
+			default:
+				endpoints := target.lb.currentEndpoints()
+				target.pending.Add(int64(len(endpoints)))
+				for _, endpoint := range endpoints {
+					tasks = append(tasks, healthTask{target: target, endpoint: endpoint})
+				}
+			}
+		}
+		if until := target.next.Sub(now); until < wait {
+			wait = until
+		}
+	}
+	return tasks, wait
+}
+
+// jittered moves interval by up to the configured fraction either way
+func (s *HealthScheduler) jittered(interval time.Duration) time.Duration {
+	return interval + time.Duration((rand.Float64()*2-1)*s.jitter*float64(interval))
+}
+
+// work runs probes until the scheduler stops
+func (s *HealthScheduler) work() {
+	defer s.wg.Done()
+	for {
+		select {
+		case task := <-s.tasks:
+			healthChecksInFlight.Inc()
+			task.target.lb.checkEndpointHealth(task.endpoint)
+			healthChecksInFlight.Dec()
+			task.target.pending.Add(-1)
+		case <-s.stop:
+			return
+		}
+	}
+}
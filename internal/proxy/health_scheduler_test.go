@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCheckedLoadBalancer creates a health checked load balancer over endpoints
+func newCheckedLoadBalancer(t *testing.T, endpoints ...string) *LoadBalancer {
+	lb, err := NewLoadBalancer(&config.LoadBalancingConfig{
+		Method:            "round_robin",
+		HealthCheck:       true,
+		Endpoints:         endpoints,
+		HealthCheckConfig: &config.HealthCheckConfig{Interval: 1, Timeout: 1},
+	}, &mockLogger{})
+	require.NoError(t, err)
+	return lb
+}
+
+func TestHealthSchedulerDue(t *testing.T) {
+	s := NewHealthScheduler(&config.HealthChecksConfig{Jitter: 0.2}, &mockLogger{})
+	lb := newCheckedLoadBalancer(t, "http://10.0.0.1", "http://10.0.0.2")
+	now := time.Now()
+	target := &healthTarget{route: "/due", lb: lb, interval: 10 * time.Second, next: now}
+	s.targets = append(s.targets, target)
+
+	// A due target probes each endpoint and is rescheduled within the jitter
+	tasks, wait := s.due(now)
+	assert.Len(t, tasks, 2)
+	assert.InDelta(t, 10*time.Second, wait, float64(2*time.Second))
+	assert.Equal(t, int64(2), target.pending.Load())
+
+	// Nothing is probed before the next round
+	tasks, _ = s.due(now.Add(time.Second))
+	assert.Empty(t, tasks)
+
+	// A round is skipped while probes of the last one are pending
+	skipped := testutil.ToFloat64(healthChecksSkipped.WithLabelValues("/due"))
+	tasks, _ = s.due(target.next)
+	assert.Empty(t, tasks)
+	assert.Equal(t, skipped+1, testutil.ToFloat64(healthChecksSkipped.WithLabelValues("/due")))
+
+	// Paused routes aren't probed
+	target.pending.Store(0)
+	require.NoError(t, s.SetEnabled("/due", false))
+	tasks, _ = s.due(target.next)
+	assert.Empty(t, tasks)
+
+	require.NoError(t, s.SetEnabled("/due", true))
+	tasks, _ = s.due(target.next)
+	assert.Len(t, tasks, 2)
+}
+
+func TestHealthSchedulerSetEnabled(t *testing.T) {
+	s := NewHealthScheduler(&config.HealthChecksConfig{}, &mockLogger{})
+	lb := newCheckedLoadBalancer(t, "http://10.0.0.1", "http://10.0.0.2")
+	s.targets = append(s.targets, &healthTarget{route: "/orders", lb: lb, interval: time.Second})
+	lb.setEndpointHealth(lb.endpoints[0], false)
+
+	assert.Equal(t, []HealthCheckState{{Path: "/orders", Enabled: true, Endpoints: 2, Healthy: 1}}, s.States())
+
+	// Pausing the checks brings back the endpoints they excluded
+	require.NoError(t, s.SetEnabled("/orders", false))
+	assert.Equal(t, []HealthCheckState{{Path: "/orders", Enabled: false, Endpoints: 2, Healthy: 2}}, s.States())
+
+	assert.ErrorContains(t, s.SetEnabled("/missing", false), "no health checked route")
+}
+
+func TestHealthSchedulerBoundsProbes(t *testing.T) {
+	var running, maxRunning, probes atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		probes.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	// Distinct endpoint URLs reaching the same upstream
+	var endpoints []string
+	for i := 0; i < 6; i++ {
+		endpoints = append(endpoints, fmt.Sprintf("%s/?n=%d", upstream.URL, i))
+	}
+	lb := newCheckedLoadBalancer(t, endpoints...)
+
+	s := NewHealthScheduler(&config.HealthChecksConfig{Workers: 2}, &mockLogger{})
+	s.add("/bounded", lb)
+	defer s.Stop()
+
+	assert.Eventually(t, func() bool {
+		return probes.Load() >= 6 && len(lb.getHealthyEndpoints()) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.LessOrEqual(t, maxRunning.Load(), int64(2))
+}
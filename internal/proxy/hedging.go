@@ -0,0 +1,215 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// maxHedgeTokens caps how many hedges the budget can save up
+const maxHedgeTokens = 10
+
+// hedgeBudget lets a percentage of requests be hedged. Every hedgeable request
+// deposits a fraction of a token and every hedge spends a whole one, so a burst
+// of slow requests can't multiply upstream load.
+type hedgeBudget struct {
+	mutex  sync.Mutex
+	ratio  float64
+	tokens float64
+}
+
+// newHedgeBudget creates a budget allowing percent hedges per 100 requests
+func newHedgeBudget(percent float64) *hedgeBudget {
+	return &hedgeBudget{ratio: percent / 100}
+}
+
+// deposit credits the budget for one request
+func (b *hedgeBudget) deposit() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > maxHedgeTokens {
+		b.tokens = maxHedgeTokens
+	}
+}
+
+// spend takes a token for one hedge, reporting false if none is left
+func (b *hedgeBudget) spend() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// hedgingTransport sends a second attempt when the first one hasn't returned
+// response headers within the delay and uses whichever response arrives first
+type hedgingTransport struct {
+	base      http.RoundTripper
+	route     string
+	delay     time.Duration
+	methods   map[string]bool
+	budget    *hedgeBudget
+	alternate func(primary *url.URL) *url.URL
+	log       logger.Logger
+}
+
+// newHedgingTransport wraps base with hedging. alternate picks the endpoint
+// for the hedge, or returns nil if there is none.
+func newHedgingTransport(base http.RoundTripper, route string, cfg *config.HedgingConfig, alternate func(*url.URL) *url.URL, log logger.Logger) *hedgingTransport {
+	methods := make(map[string]bool, len(cfg.Methods))
+	for _, method := range cfg.Methods {
+		methods[strings.ToUpper(method)] = true
+	}
+	if len(methods) == 0 {
+		methods["GET"], methods["HEAD"] = true, true
+	}
+
+	return &hedgingTransport{
+		base:      base,
+		route:     route,
+		delay:     time.Duration(cfg.DelayMs) * time.Millisecond,
+		methods:   methods,
+		budget:    newHedgeBudget(cfg.BudgetPercent),
+		alternate: alternate,
+		log:       log,
+	}
+}
+
+// hedgeResult is the outcome of one attempt
+type hedgeResult struct {
+	index int
+	resp  *http.Response
+	err   error
+}
+
+// RoundTrip sends the request, hedging it if it is slow
+func (t *hedgingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Only requests without a body can be replayed safely
+	if !t.methods[req.Method] || (req.Body != nil && req.Body != http.NoBody) {
+		return t.base.RoundTrip(req)
+	}
+	t.budget.deposit()
+
+	results := make(chan hedgeResult, 2)
+	var cancels []context.CancelFunc
+	send := func(r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, err := t.base.RoundTrip(r.WithContext(ctx))
+			results <- hedgeResult{index: index, resp: resp, err: err}
+		}()
+	}
+	send(req)
+
+	timer := time.NewTimer(t.delay)
+	defer timer.Stop()
+
+	pending := 1
+	for {
+		select {
+		case <-timer.C:
+			if hedge := t.hedgeRequest(req); hedge != nil {
+				pending++
+				send(hedge)
+			}
+
+		case result := <-results:
+			pending--
+			if result.err != nil && pending > 0 {
+				// The other attempt may still succeed
+				cancels[result.index]()
+				continue
+			}
+
+			// Abandon the other attempt and release its response if it arrives
+			for i, cancel := range cancels {
+				if i != result.index {
+					cancel()
+				}
+			}
+			if pending > 0 {
+				go discardHedgeResults(results, pending)
+			}
+
+			if len(cancels) > 1 {
+				outcome := "primary"
+				if result.index > 0 {
+					outcome = "hedge"
+				}
+				hedgedRequests.WithLabelValues(t.route, outcome).Inc()
+			}
+
+			if result.err != nil {
+				cancels[result.index]()
+				return nil, result.err
+			}
+			result.resp.Body = &cancelOnClose{ReadCloser: result.resp.Body, cancel: cancels[result.index]}
+			return result.resp, nil
+		}
+	}
+}
+
+// hedgeRequest builds the second attempt, or returns nil if the budget is
+// spent or there is no endpoint to send it to
+func (t *hedgingTransport) hedgeRequest(req *http.Request) *http.Request {
+	target := t.alternate(req.URL)
+	if target == nil {
+		return nil
+	}
+	if !t.budget.spend() {
+		hedgedRequests.WithLabelValues(t.route, "budget_exhausted").Inc()
+		return nil
+	}
+
+	hedge := req.Clone(req.Context())
+	// A Host header the route overrides is kept for the alternate endpoint
+	if hedge.Host == req.URL.Host {
+		hedge.Host = target.Host
+	}
+	hedge.URL.Scheme = target.Scheme
+	hedge.URL.Host = target.Host
+	if attempts := upstreamAttemptsFromContext(req.Context()); attempts != nil {
+		attempts.add(target)
+	}
+
+	t.log.Debug("Hedging slow upstream request",
+		logger.String("route", t.route),
+		logger.String("primary", req.URL.Host),
+		logger.String("hedge", target.Host),
+	)
+	return hedge
+}
+
+// discardHedgeResults closes the responses of abandoned attempts
+func discardHedgeResults(results <-chan hedgeResult, pending int) {
+	for ; pending > 0; pending-- {
+		if result := <-results; result.resp != nil {
+			result.resp.Body.Close()
+		}
+	}
+}
+
+// cancelOnClose releases the attempt's context once its body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and cancels the attempt
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
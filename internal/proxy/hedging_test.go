@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// roundTripperFunc adapts a function to http.RoundTripper
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestHedgeBudget(t *testing.T) {
+	budget := newHedgeBudget(50)
+	assert.False(t, budget.spend())
+
+	budget.deposit()
+	budget.deposit()
+	assert.True(t, budget.spend())
+	assert.False(t, budget.spend())
+
+	for i := 0; i < 100; i++ {
+		budget.deposit()
+	}
+	assert.Equal(t, float64(maxHedgeTokens), budget.tokens)
+}
+
+func TestHedgingTransport(t *testing.T) {
+	var slowCancelled atomic.Bool
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "slow:80" {
+			select {
+			case <-req.Context().Done():
+				slowCancelled.Store(true)
+				return nil, req.Context().Err()
+			case <-time.After(time.Second):
+			}
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(req.URL.Host)),
+			Request:    req,
+		}, nil
+	})
+	fast, _ := url.Parse("http://fast:80")
+	alternate := func(*url.URL) *url.URL { return fast }
+
+	newTransport := func(tokens float64) *hedgingTransport {
+		transport := newHedgingTransport(base, "/api", &config.HedgingConfig{DelayMs: 20, BudgetPercent: 10}, alternate, &mockLogger{})
+		transport.budget.tokens = tokens
+		return transport
+	}
+
+	t.Run("slow primary is hedged", func(t *testing.T) {
+		resp, err := newTransport(1).RoundTrip(httptest.NewRequest("GET", "http://slow:80/api", nil))
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		assert.Equal(t, "fast:80", string(body))
+		assert.Eventually(t, slowCancelled.Load, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("fast primary is not hedged", func(t *testing.T) {
+		transport := newTransport(1)
+		resp, err := transport.RoundTrip(httptest.NewRequest("GET", "http://fast:80/api", nil))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.InDelta(t, 1.1, transport.budget.tokens, 1e-9)
+	})
+
+	t.Run("spent budget waits for the primary", func(t *testing.T) {
+		start := time.Now()
+		resp, err := newTransport(0).RoundTrip(httptest.NewRequest("GET", "http://slow:80/api", nil))
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		assert.Equal(t, "slow:80", string(body))
+		assert.GreaterOrEqual(t, time.Since(start), time.Second)
+	})
+
+	t.Run("requests with a body are not hedged", func(t *testing.T) {
+		transport := newTransport(1)
+		resp, err := transport.RoundTrip(httptest.NewRequest("GET", "http://slow:80/api", strings.NewReader("payload")))
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		assert.Equal(t, "slow:80", string(body))
+		assert.InDelta(t, 1.0, transport.budget.tokens, 1e-9)
+	})
+}
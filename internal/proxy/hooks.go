@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/hooks"
+)
+
+// routeHooks runs the extension hooks registered when a route's proxy was
+// built. A nil routeHooks runs none.
+type routeHooks struct {
+	hooks []hooks.Hook
+	route hooks.Route
+}
+
+// newRouteHooks returns the registered hooks for a route, or nil if there
+// are none
+func newRouteHooks(route config.Route) *routeHooks {
+	registered := hooks.Registered()
+	if len(registered) == 0 {
+		return nil
+	}
+	return &routeHooks{
+		hooks: registered,
+		route: hooks.Route{
+			Path:     route.Path,
+			Upstream: route.Upstream,
+			Tags:     route.Tags,
+			Labels:   route.Labels,
+		},
+	}
+}
+
+// request runs the OnRequest hooks and answers the request if one rejects
+// it, reporting whether the request may go on
+func (h *routeHooks) request(w http.ResponseWriter, r *http.Request) bool {
+	if h == nil {
+		return true
+	}
+	for _, hook := range h.hooks {
+		err := hook.OnRequest(r, h.route)
+		if err == nil {
+			continue
+		}
+		var rejection *hooks.Rejection
+		if errors.As(err, &rejection) {
+			http.Error(w, rejection.Message, rejection.Status)
+		} else {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return false
+	}
+	return true
+}
+
+// upstreamSelected runs the OnUpstreamSelected hooks
+func (h *routeHooks) upstreamSelected(r *http.Request, upstream *url.URL) {
+	if h == nil {
+		return
+	}
+	for _, hook := range h.hooks {
+		hook.OnUpstreamSelected(r, h.route, upstream)
+	}
+}
+
+// response runs the OnResponse hooks, stopping at the first error
+func (h *routeHooks) response(resp *http.Response) error {
+	if h == nil {
+		return nil
+	}
+	for _, hook := range h.hooks {
+		if err := hook.OnResponse(resp, h.route); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// error runs the OnError hooks
+func (h *routeHooks) error(r *http.Request, err error) {
+	if h == nil {
+		return
+	}
+	for _, hook := range h.hooks {
+		hook.OnError(r, h.route, err)
+	}
+}
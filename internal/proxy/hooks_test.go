@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/hooks"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingHook records the events it receives and rejects requests with an
+// X-Reject header
+type recordingHook struct {
+	hooks.Base
+	mutex  sync.Mutex
+	events []string
+}
+
+func (h *recordingHook) record(event string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.events = append(h.events, event)
+}
+
+func (h *recordingHook) OnRequest(r *http.Request, route hooks.Route) error {
+	h.record("request " + route.Path)
+	switch r.Header.Get("X-Reject") {
+	case "teapot":
+		return &hooks.Rejection{Status: http.StatusTeapot, Message: "No coffee"}
+	case "error":
+		return errors.New("hook failed")
+	}
+	return nil
+}
+
+func (h *recordingHook) OnUpstreamSelected(r *http.Request, route hooks.Route, upstream *url.URL) {
+	h.record("upstream")
+}
+
+func (h *recordingHook) OnResponse(resp *http.Response, route hooks.Route) error {
+	h.record("response")
+	resp.Header.Set("X-Hooked", route.Labels["team"])
+	return nil
+}
+
+func (h *recordingHook) OnError(r *http.Request, route hooks.Route, err error) {
+	h.record("error")
+}
+
+func TestHTTPProxyRunsHooks(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	hook := &recordingHook{}
+	hooks.Register("recording", hook)
+	defer hooks.Unregister("recording")
+
+	route := config.Route{Path: "/orders", Upstream: upstream.URL, Labels: map[string]string{"team": "checkout"}, Middlewares: &config.Middlewares{}}
+	p := NewHTTPProxy(&config.Config{}, &config.RouteConfig{Routes: []config.Route{route}}, &mockLogger{})
+	handler := p.ProxyRequest(route)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "checkout", rec.Header().Get("X-Hooked"))
+	assert.Equal(t, []string{"request /orders", "upstream", "response"}, hook.events)
+
+	for reject, status := range map[string]int{"teapot": http.StatusTeapot, "error": http.StatusInternalServerError} {
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		req.Header.Set("X-Reject", reject)
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, status, rec.Code, reject)
+	}
+
+	// Upstreams that can't be reached are reported
+	upstream.Close()
+	hook.events = nil
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders", nil))
+	assert.Equal(t, []string{"request /orders", "upstream", "error"}, hook.events)
+}
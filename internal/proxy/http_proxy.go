@@ -1,16 +1,21 @@
 package proxy
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"api-gateway/internal/config"
+	"api-gateway/internal/notify"
+	"api-gateway/internal/spiffe"
 	"api-gateway/internal/util"
-	"api-gateway/pkg/discoverer/etcd_discovery"
 	"api-gateway/pkg/logger"
 )
 
@@ -21,20 +26,98 @@ type HTTPProxy struct {
 	log    logger.Logger
 	// Map to store circuit breakers for routes
 	circuitBreakers map[string]*CircuitBreaker
+	// Caching DNS resolver for upstream hosts (nil uses the OS resolver)
+	resolver *DNSResolver
+	// Long-lived etcd watches for discovered routes
+	discoveries []*etcdDiscovery
+	// Active upstream group switches of blue/green routes, by route path
+	blueGreen map[string]*BlueGreenSwitch
+	// Upstreams replaceable by a config reload, by route path
+	upstreams map[string]*reloadableUpstream
+	// Sends rollback alerts to the configured webhook (nil if none)
+	alerter *rollbackAlerter
+	// Maps gRPC errors from gRPC upstreams of HTTP routes to HTTP responses
+	grpcErrors *grpcErrorMapper
+	// Sets the X-Forwarded-* and Forwarded headers of upstream requests
+	forwarded forwardedHeaders
+	// Notified of opened circuit breakers and unhealthy endpoints (nil if off)
+	notifier *notify.Notifier
+	// The gateway's SPIFFE identity for upstream mTLS (nil if off)
+	spiffe *spiffe.Source
+	// Runs the health checks of the routes' load balancers
+	healthChecks *HealthScheduler
+	// Upstream addresses whose last connect failed, shared by the routes
+	connectFailures *connectFailures
 }
 
 // NewHTTPProxy creates a new HTTP proxy
 func NewHTTPProxy(config *config.Config, routes *config.RouteConfig, log logger.Logger) *HTTPProxy {
-	return &HTTPProxy{
+	p := &HTTPProxy{
 		config:          config,
 		routes:          routes,
 		log:             log,
 		circuitBreakers: make(map[string]*CircuitBreaker),
+		blueGreen:       make(map[string]*BlueGreenSwitch),
+		upstreams:       make(map[string]*reloadableUpstream),
+		alerter:         newRollbackAlerter(&config.Reload, log),
+		grpcErrors:      newGRPCErrorMapper(config.GRPC.ErrorStatuses),
+		forwarded:       newForwardedHeaders(&config.ForwardedHeaders),
+		healthChecks:    NewHealthScheduler(&config.HealthChecks, logger.Component(log, "health")),
+		connectFailures: newConnectFailures(),
 	}
+
+	if config.DNS.Enabled {
+		p.resolver = NewDNSResolver(&config.DNS, log)
+	}
+
+	return p
 }
 
 // ProxyRequest forwards the request to the upstream service
 func (p *HTTPProxy) ProxyRequest(route config.Route) http.Handler {
+	if route.Spool != nil && route.Spool.Enabled {
+		return p.proxySpooled(route)
+	}
+	if route.SOAP != nil && route.SOAP.Enabled {
+		return p.proxySOAP(route)
+	}
+	if route.SplitHorizon != nil {
+		return p.proxySplitHorizon(route)
+	}
+	if route.ContentRouting != nil {
+		return p.proxyContent(route)
+	}
+	if route.BlueGreen != nil {
+		return p.proxyBlueGreen(route)
+	}
+	if p.config.Reload.Enabled {
+		upstream := newReloadableUpstream(route, p.proxyUpstream(route), &p.config.Reload.Rollback, p.alerter, p.log)
+		p.upstreams[route.Path] = upstream
+		return upstream
+	}
+	return p.proxyUpstream(route)
+}
+
+// ProxySandbox returns a handler proxying test traffic of a route to its
+// sandbox upstream. The sandbox has no load balancing, circuit breaker or
+// hedging of its own, and isn't touched by reloads or blue/green switches.
+func (p *HTTPProxy) ProxySandbox(route config.Route) http.Handler {
+	sandbox := route
+	sandbox.Upstream = route.SandboxUpstream
+	sandbox.LoadBalancing = nil
+	sandbox.BlueGreen = nil
+	sandbox.Hedging = nil
+	sandbox.Prewarm = nil
+	if route.Middlewares != nil {
+		middlewares := *route.Middlewares
+		middlewares.CircuitBreaker = nil
+		sandbox.Middlewares = &middlewares
+	}
+	return p.proxyUpstream(sandbox)
+}
+
+// proxyUpstream builds the proxy handler of a route's upstream
+func (p *HTTPProxy) proxyUpstream(route config.Route) http.Handler {
 	// Parse the upstream URL
 	target, err := url.Parse(route.Upstream)
 	if err != nil {
@@ -65,20 +148,135 @@ func (p *HTTPProxy) ProxyRequest(route config.Route) http.Handler {
 			)
 		}
 	}
+	if loadBalancer != nil && route.LoadBalancing.HealthCheck {
+		p.healthChecks.add(route.Path, loadBalancer)
+	}
+	if loadBalancer != nil && p.notifier != nil {
+		loadBalancer.SetUnhealthyListener(func(endpoint *url.URL, reason string) {
+			p.notifier.Notify(notify.Event{
+				Type:    config.EventUpstreamUnhealthy,
+				Subject: endpoint.String(),
+				Message: "Upstream endpoint failed its health check: " + reason,
+				Details: map[string]string{"path": route.Path, "reason": reason},
+			})
+		})
+	}
+
+	// Watch service instances for routes discovered through etcd
+	var discovery *etcdDiscovery
+	if loadBalancer != nil && loadBalancer.GetDriver() == "etcd" && loadBalancer.GetServiceDiscoveries() != nil {
+		discovery, err = newEtcdDiscovery(&p.config.Etcd, loadBalancer.GetServiceDiscoveries(), logger.Component(p.log, "discovery"))
+		if err != nil {
+			p.log.Error("Failed to start service discovery",
+				logger.String("path", route.Path),
+				logger.String("etcd", p.config.Etcd.Hosts),
+				logger.Error(err),
+			)
+		} else {
+			discovery.Start(loadBalancer, func(addrs []string) ([]*url.URL, error) {
+				return p.parseURLs("http", addrs) // The use of HTTP protocol in LAN is faster than HTTPS protocol
+			})
+			p.discoveries = append(p.discoveries, discovery)
+		}
+	}
+
+	// Pin clients to an endpoint if the route asks for session affinity
+	var affinity *sessionAffinity
+	if loadBalancer != nil {
+		affinity = newSessionAffinity(route)
+	}
+
+	// Share one transport per route so upstream connections are reused
+	transport := p.newTransport(route)
+	skipFailing := p.config.Dial.Merge(route.Dial).FailureTTL > 0
+
+	// Open upstream connections before the first requests
+	var prewarm *upstreamPrewarm
+	if route.Prewarm != nil && route.Prewarm.Enabled {
+		endpoints := []*url.URL{target}
+		if loadBalancer != nil {
+			endpoints = loadBalancer.currentEndpoints()
+		}
+		prewarm = startPrewarm(route, transport, endpoints, loadBalancer, p.log)
+	}
+
+	// Adapt requests for legacy upstreams
+	var roundTripper http.RoundTripper = transport
+	if route.Compat != nil {
+		roundTripper = newCompatTransport(transport, route.Compat)
+		p.log.Info("Applied upstream compatibility options to route",
+			logger.String("path", route.Path),
+			logger.Any("header_case", route.Compat.HeaderCase),
+			logger.Bool("force_content_length", route.Compat.ForceContentLength),
+			logger.Bool("disable_expect_continue", route.Compat.DisableExpectContinue),
+		)
+	}
+
+	// Sign upstream requests if the route requires it
+	if route.Signing != nil {
+		signer, needsBody, err := newRequestSigner(route.Signing)
+		if err != nil {
+			// Unsigned requests would be rejected or, worse, accepted
+			// without the upstream authenticating the gateway
+			p.log.Error("Invalid request signing configuration, refusing requests",
+				logger.String("path", route.Path),
+				logger.Error(err),
+			)
+			roundTripper = &signingTransport{base: roundTripper, signer: invalidSigner{err: err}}
+		} else {
+			roundTripper = &signingTransport{base: roundTripper, signer: signer, needsBody: needsBody}
+			p.log.Info("Signing upstream requests for route",
+				logger.String("path", route.Path),
+				logger.String("type", route.Signing.Type),
+			)
+		}
+	}
+
+	// Abort upstream responses whose body stalls
+	if route.BodyIdleTimeout > 0 {
+		roundTripper = &idleTimeoutTransport{
+			base:    roundTripper,
+			timeout: time.Duration(route.BodyIdleTimeout) * time.Second,
+		}
+	}
+
+	// Hedge slow idempotent requests to another endpoint
+	if route.Hedging != nil && route.Hedging.Enabled {
+		alternate := func(primary *url.URL) *url.URL {
+			if loadBalancer == nil {
+				// A single upstream may still be served by several instances
+				return target
+			}
+			endpoint := loadBalancer.GetEndpointExcluding(func(u *url.URL) bool {
+				return u.Host == primary.Host
+			})
+			if endpoint == nil || endpoint.Host == primary.Host {
+				return nil
+			}
+			return endpoint
+		}
+		roundTripper = newHedgingTransport(roundTripper, route.Path, route.Hedging, alternate, p.log)
+		p.log.Info("Hedging slow requests for route",
+			logger.String("path", route.Path),
+			logger.Int("delay_ms", route.Hedging.DelayMs),
+		)
+	}
+
+	// Report the time spent on upstreams, hedged attempts included
+	roundTripper = &timingTransport{base: roundTripper}
+
+	// Run the extension hooks registered by programs embedding the gateway
+	extensions := newRouteHooks(route)
 
 	// Create a proxy handler factory function that can select the target
 	createProxy := func(targetURL *url.URL) *httputil.ReverseProxy {
-		proxy := httputil.NewSingleHostReverseProxy(targetURL)
+		proxy := &httputil.ReverseProxy{}
 
-		// Customize the director function to modify the request
-		originalDirector := proxy.Director
-		proxy.Director = func(req *http.Request) {
-			// Call the original director
-			originalDirector(req)
-
-			// Modify the request URL
-			req.URL.Scheme = targetURL.Scheme
-			req.URL.Host = targetURL.Host
+		// Build the upstream request. The client's X-Forwarded-* headers are
+		// removed from it first and set again by the forwarding policy.
+		proxy.Rewrite = func(pr *httputil.ProxyRequest) {
+			pr.SetURL(targetURL)
+			req := pr.Out
 
 			// Handle path stripping if enabled
 			if route.StripPrefix && strings.HasPrefix(req.URL.Path, route.Path) {
@@ -89,34 +287,25 @@ func (p *HTTPProxy) ProxyRequest(route config.Route) http.Handler {
 				}
 			}
 
-			// Update the Host header to match the target
+			// Update the Host header to match the target, unless the route
+			// names the host its upstream expects
 			req.Host = targetURL.Host
+			if route.UpstreamHostHeader != "" {
+				req.Host = route.UpstreamHostHeader
+			}
 
 			// Extract the real client IP
-			clientIP := util.GetClientIP(req)
+			clientIP := util.GetClientIP(pr.In)
 			p.log.Debug("Extracted client IP for HTTP proxy",
-				logger.String("remote_addr", req.RemoteAddr),
+				logger.String("remote_addr", pr.In.RemoteAddr),
 				logger.String("client_ip", clientIP),
-				logger.String("xff_header", req.Header.Get("X-Forwarded-For")),
-				logger.String("xrip_header", req.Header.Get("X-Real-IP")),
+				logger.String("xff_header", pr.In.Header.Get("X-Forwarded-For")),
+				logger.String("xrip_header", pr.In.Header.Get("X-Real-IP")),
 			)
 
-			// Add X-Forwarded headers to preserve client IP information
+			// Pass the client address, host, protocol and port upstream
+			p.forwarded.apply(req.Header, pr.In)
 			if clientIP != "" {
-				// For X-Forwarded-For, append our client IP to existing chain if present
-				if xffHeader := req.Header.Get("X-Forwarded-For"); xffHeader != "" {
-					// Keep existing chain and append current client IP to indicate proxy hop
-					// But only do this if clientIP is not already the first IP in the chain
-					// to avoid duplicating the client IP
-					if !strings.HasPrefix(xffHeader, clientIP+",") && xffHeader != clientIP {
-						req.Header.Set("X-Forwarded-For", xffHeader)
-					}
-				} else {
-					// No existing chain, just set the client IP
-					req.Header.Set("X-Forwarded-For", clientIP)
-					p.log.Debug("Set X-Forwarded-For header", logger.String("value", clientIP))
-				}
-
 				// Always set X-Real-IP to the original client IP
 				req.Header.Set("X-Real-IP", clientIP)
 				p.log.Debug("Set X-Real-IP header", logger.String("value", clientIP))
@@ -136,102 +325,137 @@ func (p *HTTPProxy) ProxyRequest(route config.Route) http.Handler {
 
 			// Check for token in URL query parameters and add it to the headers if present
 			// This ensures backward compatibility with clients that send tokens in URL
-			token := req.URL.Query().Get("token")
+			query := req.URL.Query()
+			token := query.Get("token")
 			if token != "" && req.Header.Get("Authorization") == "" {
 				req.Header.Set("Authorization", "Bearer "+token)
 				p.log.Debug("Added token from URL query to Authorization header")
 			}
 
 			// Check for API key in query parameters
-			apiKey := req.URL.Query().Get("api_key")
+			apiKey := query.Get("api_key")
 			if apiKey == "" {
-				apiKey = req.URL.Query().Get("key")
+				apiKey = query.Get("key")
 			}
 			if apiKey != "" && req.Header.Get("x-api-key") == "" {
 				req.Header.Set("x-api-key", apiKey)
 				p.log.Debug("Added API key from URL query to x-api-key header")
 			}
 
-			req.Header.Set("X-Forwarded-Host", req.Host)
-			req.Header.Set("X-Forwarded-Proto", req.URL.Scheme)
 			req.Header.Set("X-Gateway-Proxy", "true")
 		}
 
 		// Customize the error handler
 		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			recordUpstreamError(r.Context(), err)
+			extensions.error(r, err)
 			p.log.Error("Proxy error",
 				logger.String("path", r.URL.Path),
 				logger.String("method", r.Method),
 				logger.String("upstream", targetURL.String()),
 				logger.Error(err),
 			)
-			http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+			status, message, reason := classifyUpstreamError(err)
+			countUpstreamError(route.Path, status, reason)
+			http.Error(w, message, status)
 		}
 
-		// Set timeouts
-		if route.Timeout > 0 {
-			timeout := time.Duration(route.Timeout) * time.Second
-			proxy.Transport = &http.Transport{
-				ResponseHeaderTimeout: timeout,
-				ExpectContinueTimeout: 1 * time.Second,
-				MaxIdleConns:          100,
-				MaxIdleConnsPerHost:   100,
-				IdleConnTimeout:       90 * time.Second,
+		proxy.Transport = roundTripper
+		proxy.BufferPool = proxyBuffers
+
+		// Answer gRPC errors of gRPC upstreams with HTTP statuses
+		if route.Protocol == config.ProtocolHTTP && route.EndpointsProtocol == config.ProtocolGRPC {
+			proxy.ModifyResponse = p.grpcErrors.modifyResponse
+		}
+		if extensions != nil {
+			modifyResponse := proxy.ModifyResponse
+			proxy.ModifyResponse = func(resp *http.Response) error {
+				if modifyResponse != nil {
+					if err := modifyResponse(resp); err != nil {
+						return err
+					}
+				}
+				return extensions.response(resp)
 			}
 		}
 
 		return proxy
 	}
 
+	// A static target is served by a single proxy rather than one per request
+	var staticProxy *httputil.ReverseProxy
+	if loadBalancer == nil {
+		staticProxy = createProxy(target)
+	}
+
 	// Create the final handler
 	proxyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Discovered routes have no endpoints until the initial sync
+		if discovery != nil && !discovery.isReady() {
+			w.Header().Set("Retry-After", strconv.Itoa(discoveryRetryAfter))
+			http.Error(w, "Service not ready", http.StatusServiceUnavailable)
+			return
+		}
+
+		// Let the warmup finish so requests reuse its connections
+		if prewarm != nil {
+			prewarm.wait(r.Context())
+		}
+
+		if !extensions.request(w, r) {
+			return
+		}
+
+		// Bound the whole exchange, including streaming the response body
+		if route.MaxDuration > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), time.Duration(route.MaxDuration)*time.Second)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+
 		// Select target - either from load balancer or static
 		targetURL := target
+		attempts := upstreamAttemptsFromContext(r.Context())
 		if loadBalancer != nil {
-			driver := loadBalancer.GetDriver()
-			if driver != "static" {
-				discoveriesConfig := loadBalancer.GetServiceDiscoveries()
-				if discoveriesConfig != nil {
-					switch driver {
-					case "etcd":
-						var endpoints = []string{p.config.Etcd.Hosts}
-						serviceDiscovery, err := etcd_discovery.NewServiceDiscovery(endpoints, 5*time.Second)
-						if err != nil {
-							p.log.Error("Connect to etcd error",
-								logger.String("etcd", p.config.Etcd.Hosts),
-								logger.Error(err),
-							)
-						} else {
-							address, err := serviceDiscovery.DiscoverServices(discoveriesConfig.Prefix, discoveriesConfig.Name) // todo Retrieve the number of failed service retries based on discoveriesConfig.FailLimit
-							if err != nil {
-								p.log.Error("Failed to discover services",
-									logger.String("serviceName", discoveriesConfig.Name),
-									logger.Error(err),
-								)
-							} else {
-								healthyEndpoints, err := p.parseURLs("http", address) // The use of HTTP protocol in LAN is faster than HTTPS protocol
-								if err == nil {
-									loadBalancer.SetHealthyEndpoints(healthyEndpoints)
-								} else {
-									p.log.Error("Failed to convert address to urls",
-										logger.Error(err),
-									)
-								}
-							}
-						}
-					}
+			// Retries prefer endpoints not yet tried for this request, and
+			// all requests endpoints that didn't just fail to connect
+			var exclude func(*url.URL) bool
+			if attempts != nil {
+				exclude = attempts.tried
+			}
+			if skipFailing {
+				tried := exclude
+				exclude = func(u *url.URL) bool {
+					return (tried != nil && tried(u)) || p.connectFailures.failing(u)
+				}
+			}
+			var pinned *url.URL
+			if affinity != nil {
+				if key := affinity.endpoint(r); key != "" {
+					pinned = loadBalancer.getHealthyEndpoint(key)
 				}
+				affinity.stripCookie(r)
+			}
+			if pinned != nil && (exclude == nil || !exclude(pinned)) {
+				targetURL = pinned
+			} else if endpoint := loadBalancer.GetEndpointExcluding(exclude); endpoint != nil {
+				targetURL = endpoint
 			}
 
-			targetURL = loadBalancer.GetEndpoint()
+			// Issue or move the pin once the endpoint changes
+			if affinity != nil && (pinned == nil || pinned != targetURL) {
+				affinity.setCookie(w, targetURL)
+			}
 			p.log.Debug("Using load balanced endpoint",
 				logger.String("path", r.URL.Path),
 				logger.String("endpoint", targetURL.String()),
 			)
 		}
 
-		// Create or get proxy for this target
-		proxy := createProxy(targetURL)
+		if attempts != nil {
+			attempts.add(targetURL)
+		}
+		extensions.upstreamSelected(r, targetURL)
 
 		// Log the request
 		p.log.Debug("Proxying request",
@@ -241,7 +465,36 @@ func (p *HTTPProxy) ProxyRequest(route config.Route) http.Handler {
 		)
 
 		// Proxy the request to the upstream service
-		proxy.ServeHTTP(w, r)
+		if staticProxy != nil {
+			staticProxy.ServeHTTP(w, r)
+			return
+		}
+
+		// Load balanced requests get their own proxy, whose error handler
+		// reports to the load balancer
+		proxy := createProxy(targetURL)
+
+		// Feed response timing back to the load balancer
+		failed := false
+		errorHandler := proxy.ErrorHandler
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			failed = true
+			errorHandler(w, r, err)
+		}
+
+		start := time.Now()
+		crw := &customResponseWriter{ResponseWriter: w}
+		proxy.ServeHTTP(crw, r)
+
+		// Gateway errors from the upstream count as failures too, so endpoints
+		// that keep failing retried requests are ejected
+		if isGatewayError(crw.statusCode) {
+			failed = true
+		}
+		loadBalancer.RecordResponse(targetURL, time.Since(start), failed)
+		if discovery != nil {
+			discovery.ReportResult(targetURL.Host, failed)
+		}
 	})
 
 	// Apply circuit breaker if enabled
@@ -258,10 +511,26 @@ func (p *HTTPProxy) ProxyRequest(route config.Route) http.Handler {
 				Timeout:       time.Duration(route.Middlewares.CircuitBreaker.Timeout) * time.Second,
 				MaxConcurrent: route.Middlewares.CircuitBreaker.MaxConcurrent,
 			}
+			if route.Middlewares.CircuitBreaker.FailureOn != nil {
+				cbConfig.Classifier = NewFailureClassifier(route.Middlewares.CircuitBreaker.FailureOn)
+			}
 
 			// Create a new circuit breaker
 			cb = NewCircuitBreaker(circuitKey, cbConfig, p.log)
 			p.circuitBreakers[circuitKey] = cb
+			if p.notifier != nil {
+				cb.SetStateListener(func(name string, state CircuitBreakerState) {
+					if state != Open {
+						return
+					}
+					p.notifier.Notify(notify.Event{
+						Type:    config.EventCircuitBreakerOpened,
+						Subject: name,
+						Message: "Circuit breaker opened, requests to the route are rejected",
+						Details: map[string]string{"path": route.Path, "upstream": route.Upstream},
+					})
+				})
+			}
 
 			p.log.Info("Created circuit breaker for route",
 				logger.String("path", route.Path),
@@ -284,6 +553,127 @@ func (p *HTTPProxy) ProxyRequest(route config.Route) http.Handler {
 	return proxyHandler
 }
 
+// proxyBlueGreen proxies a blue/green route to its active upstream group
+func (p *HTTPProxy) proxyBlueGreen(route config.Route) http.Handler {
+	group := func(upstream *config.UpstreamGroup) http.Handler {
+		groupRoute := route
+		groupRoute.BlueGreen = nil
+		groupRoute.Upstream = upstream.Upstream
+		groupRoute.LoadBalancing = upstream.LoadBalancing
+		return p.proxyUpstream(groupRoute)
+	}
+
+	blueGreen := newBlueGreenSwitch(route, group(route.BlueGreen.Blue), group(route.BlueGreen.Green), p.alerter, p.log)
+	p.blueGreen[route.Path] = blueGreen
+	p.log.Info("Created blue/green switch for route",
+		logger.String("path", route.Path),
+		logger.String("active", route.BlueGreen.Active),
+	)
+	return blueGreen
+}
+
+// BlueGreen returns the blue/green switch of a route, or nil
+func (p *HTTPProxy) BlueGreen(path string) *BlueGreenSwitch {
+	return p.blueGreen[path]
+}
+
+// BlueGreenStates returns the state of every blue/green switch
+func (p *HTTPProxy) BlueGreenStates() []BlueGreenState {
+	states := make([]BlueGreenState, 0, len(p.blueGreen))
+	for _, blueGreen := range p.blueGreen {
+		states = append(states, blueGreen.State())
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Path < states[j].Path })
+	return states
+}
+
+// UpdateUpstreams applies the upstream and load balancing of reloaded routes
+// to the matching existing routes and returns the paths that changed. Other
+// route settings only take effect on restart.
+func (p *HTTPProxy) UpdateUpstreams(routes []config.Route) []string {
+	var changed []string
+	for _, route := range routes {
+		upstream, ok := p.upstreams[route.Path]
+		if !ok {
+			continue
+		}
+		current := upstream.current()
+		if current.Upstream == route.Upstream && reflect.DeepEqual(current.LoadBalancing, route.LoadBalancing) {
+			continue
+		}
+		updated := current
+		updated.Upstream = route.Upstream
+		updated.LoadBalancing = route.LoadBalancing
+		upstream.update(updated, p.proxyUpstream(updated))
+		changed = append(changed, route.Path)
+	}
+	return changed
+}
+
+// ShareCircuitBreakers sends the state changes of the route circuit breakers
+// to broadcast
+func (p *HTTPProxy) ShareCircuitBreakers(broadcast func(name string, state CircuitBreakerState)) {
+	for _, cb := range p.circuitBreakers {
+		cb.SetStateBroadcaster(broadcast)
+	}
+}
+
+// SetNotifier sends opened circuit breakers and endpoints failing health
+// checks to the notifier. It must be called before routes are proxied.
+func (p *HTTPProxy) SetNotifier(notifier *notify.Notifier) {
+	p.notifier = notifier
+}
+
+// SetSPIFFE presents the gateway's SVID to upstreams of routes with an
+// upstream_spiffe_id. It must be called before routes are proxied.
+func (p *HTTPProxy) SetSPIFFE(source *spiffe.Source) {
+	p.spiffe = source
+}
+
+// CircuitBreaker returns a route circuit breaker by name, or nil
+func (p *HTTPProxy) CircuitBreaker(name string) *CircuitBreaker {
+	return p.circuitBreakers[name]
+}
+
+// HealthChecks returns the scheduler of the routes' health checks
+func (p *HTTPProxy) HealthChecks() *HealthScheduler {
+	return p.healthChecks
+}
+
+// Close stops background service discovery watches and health checks
+func (p *HTTPProxy) Close() {
+	p.healthChecks.Stop()
+	for _, discovery := range p.discoveries {
+		if err := discovery.Close(); err != nil {
+			p.log.Error("Failed to close service discovery", logger.Error(err))
+		}
+	}
+	p.discoveries = nil
+}
+
+// DiscoveryStatus returns the state of the routes' service discoveries
+func (p *HTTPProxy) DiscoveryStatus() []DiscoveryStatus {
+	statuses := make([]DiscoveryStatus, 0, len(p.discoveries))
+	for _, discovery := range p.discoveries {
+		statuses = append(statuses, discovery.status())
+	}
+	return statuses
+}
+
+// Ready returns a channel closed once the service discoveries of the routes
+// created so far have completed their initial sync
+func (p *HTTPProxy) Ready() <-chan struct{} {
+	discoveries := append([]*etcdDiscovery(nil), p.discoveries...)
+	ready := make(chan struct{})
+	go func() {
+		defer close(ready)
+		for _, discovery := range discoveries {
+			<-discovery.ready
+		}
+	}()
+	return ready
+}
+
 // parseURLs returns parsed URL list with protocol auto-completion, or error on invalid format
 func (p *HTTPProxy) parseURLs(protocol string, address []string) ([]*url.URL, error) {
 	var urls []*url.URL
@@ -93,6 +93,23 @@ func TestProxyRequestBasic(t *testing.T) {
 	assert.Equal(t, "test-value", resp.Header.Get("X-Test-Header"))
 }
 
+func TestProxyRequestUpstreamHostHeader(t *testing.T) {
+	var host string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+	}))
+	defer upstream.Close()
+
+	route := config.Route{Path: "/api", Upstream: upstream.URL, Middlewares: &config.Middlewares{}}
+	proxy := NewHTTPProxy(&config.Config{}, &config.RouteConfig{Routes: []config.Route{route}}, &mockLogger{})
+	proxy.ProxyRequest(route).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/api", nil))
+	assert.Equal(t, strings.TrimPrefix(upstream.URL, "http://"), host)
+
+	route.UpstreamHostHeader = "shop.example.com"
+	proxy.ProxyRequest(route).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/api", nil))
+	assert.Equal(t, "shop.example.com", host)
+}
+
 func TestProxyRequestWithStripPrefix(t *testing.T) {
 	// Create a test server that echoes back the request path
 	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,462 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// maxL4DialAttempts bounds the endpoints tried for one connection or session
+const maxL4DialAttempts = 3
+
+// L4Proxy forwards raw TCP connections and UDP datagrams from its listeners
+// to load balanced upstream endpoints
+type L4Proxy struct {
+	listeners []*l4Listener
+	log       logger.Logger
+}
+
+// l4Listener serves one configured listener
+type l4Listener struct {
+	config *config.L4Listener
+	lb     *LoadBalancer
+	log    logger.Logger
+
+	listener   net.Listener   // TCP
+	packetConn net.PacketConn // UDP
+
+	mutex    sync.Mutex
+	closed   bool
+	clients  int                    // Open TCP client connections
+	conns    map[net.Conn]struct{}  // Open client connections and upstream sockets
+	sessions map[string]*udpSession // UDP sessions by client address
+	wg       sync.WaitGroup
+}
+
+// udpSession relays the datagrams of one client address through its own
+// upstream socket
+type udpSession struct {
+	client   net.Addr
+	upstream net.Conn
+	endpoint *url.URL
+	activity atomic.Int64 // Unix nanoseconds of the last datagram in either direction
+}
+
+// NewL4Proxy creates the configured listeners' load balancers, whose health
+// checks run on healthChecks under "l4:" and the listener name. Listeners
+// start accepting traffic on Start.
+func NewL4Proxy(cfg *config.L4ProxyConfig, healthChecks *HealthScheduler, log logger.Logger) (*L4Proxy, error) {
+	p := &L4Proxy{log: log}
+	for i := range cfg.Listeners {
+		listenerConfig := &cfg.Listeners[i]
+
+		// Endpoints are host:port; the load balancer works on URLs
+		lbConfig := *listenerConfig.LoadBalancing
+		lbConfig.Endpoints = nil
+		for _, endpoint := range listenerConfig.LoadBalancing.Endpoints {
+			lbConfig.Endpoints = append(lbConfig.Endpoints, listenerConfig.Protocol+"://"+endpoint)
+		}
+		listenerLog := log.With(logger.String("listener", listenerConfig.Name))
+		lb, err := NewLoadBalancer(&lbConfig, listenerLog)
+		if err != nil {
+			return nil, fmt.Errorf("listener %s: %w", listenerConfig.Name, err)
+		}
+		if lb == nil {
+			return nil, fmt.Errorf("listener %s: no upstream endpoints", listenerConfig.Name)
+		}
+		if lbConfig.HealthCheck {
+			healthChecks.add("l4:"+listenerConfig.Name, lb)
+		}
+
+		p.listeners = append(p.listeners, &l4Listener{
+			config:   listenerConfig,
+			lb:       lb,
+			log:      listenerLog,
+			conns:    make(map[net.Conn]struct{}),
+			sessions: make(map[string]*udpSession),
+		})
+	}
+	return p, nil
+}
+
+// Start opens every listener, closing those already opened if one fails
+func (p *L4Proxy) Start() error {
+	for i, l := range p.listeners {
+		if err := l.start(); err != nil {
+			for _, started := range p.listeners[:i] {
+				started.stop()
+			}
+			return fmt.Errorf("failed to start L4 listener %s: %w", l.config.Name, err)
+		}
+		p.log.Info("Started L4 listener",
+			logger.String("listener", l.config.Name),
+			logger.String("protocol", l.config.Protocol),
+			logger.String("address", l.addr().String()),
+			logger.Any("endpoints", l.config.LoadBalancing.Endpoints),
+		)
+	}
+	return nil
+}
+
+// Stop closes the listeners and every connection and session they carry
+func (p *L4Proxy) Stop() {
+	for _, l := range p.listeners {
+		l.stop()
+	}
+}
+
+// start opens the listener's socket and serves it in the background
+func (l *l4Listener) start() error {
+	if l.config.Protocol == config.L4ProtocolUDP {
+		packetConn, err := net.ListenPacket("udp", l.config.Address)
+		if err != nil {
+			return err
+		}
+		l.packetConn = packetConn
+		l.wg.Add(1)
+		go l.serveUDP()
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", l.config.Address)
+	if err != nil {
+		return err
+	}
+	l.listener = listener
+	l.wg.Add(1)
+	go l.serveTCP()
+	return nil
+}
+
+// addr returns the address the listener is bound to
+func (l *l4Listener) addr() net.Addr {
+	if l.packetConn != nil {
+		return l.packetConn.LocalAddr()
+	}
+	return l.listener.Addr()
+}
+
+// stop closes the socket and open connections and waits for them to finish
+func (l *l4Listener) stop() {
+	l.mutex.Lock()
+	if l.closed {
+		l.mutex.Unlock()
+		return
+	}
+	l.closed = true
+	if l.listener != nil {
+		l.listener.Close()
+	}
+	if l.packetConn != nil {
+		l.packetConn.Close()
+	}
+	for conn := range l.conns {
+		conn.Close()
+	}
+	l.mutex.Unlock()
+
+	l.wg.Wait()
+}
+
+// admit registers a client connection, failing if the listener is closed or
+// at its connection limit
+func (l *l4Listener) admit(client net.Conn) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed || l.atCapacity(l.clients) {
+		return false
+	}
+	l.clients++
+	l.conns[client] = struct{}{}
+	return true
+}
+
+// release removes a client connection registered by admit
+func (l *l4Listener) release(client net.Conn) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.clients--
+	delete(l.conns, client)
+}
+
+// track registers an upstream socket, failing if the listener is closed
+func (l *l4Listener) track(conn net.Conn) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		return false
+	}
+	l.conns[conn] = struct{}{}
+	return true
+}
+
+// untrack removes a socket registered by track
+func (l *l4Listener) untrack(conn net.Conn) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	delete(l.conns, conn)
+}
+
+// atCapacity reports whether open connections or sessions reached the limit
+func (l *l4Listener) atCapacity(open int) bool {
+	return l.config.MaxConnections > 0 && open >= l.config.MaxConnections
+}
+
+// dial connects to an endpoint, trying others when one fails. Connect times
+// feed the load balancer's response time tracking.
+func (l *l4Listener) dial() (net.Conn, *url.URL, error) {
+	timeout := time.Duration(l.config.ConnectTimeout) * time.Millisecond
+	tried := make(map[string]bool)
+	var lastErr error
+	for attempt := 0; attempt < maxL4DialAttempts; attempt++ {
+		endpoint := l.lb.GetEndpointExcluding(func(u *url.URL) bool { return tried[u.String()] })
+		if endpoint == nil || tried[endpoint.String()] {
+			break
+		}
+		tried[endpoint.String()] = true
+
+		start := time.Now()
+		conn, err := net.DialTimeout(l.config.Protocol, endpoint.Host, timeout)
+		l.lb.RecordResponse(endpoint, time.Since(start), err != nil)
+		if err == nil {
+			return conn, endpoint, nil
+		}
+		l.log.Warn("Failed to connect to L4 upstream",
+			logger.String("endpoint", endpoint.Host),
+			logger.Error(err),
+		)
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no upstream endpoint available")
+	}
+	return nil, nil, lastErr
+}
+
+// serveTCP accepts client connections until the listener closes
+func (l *l4Listener) serveTCP() {
+	defer l.wg.Done()
+	for {
+		client, err := l.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			l.log.Warn("Failed to accept L4 connection", logger.Error(err))
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+
+		if !l.admit(client) {
+			l4Connections.WithLabelValues(l.config.Name, l.config.Protocol, "rejected").Inc()
+			client.Close()
+			continue
+		}
+		l.wg.Add(1)
+		go l.handleTCP(client)
+	}
+}
+
+// handleTCP connects a client to an upstream endpoint and copies data both
+// ways until either side closes or the connection idles out
+func (l *l4Listener) handleTCP(client net.Conn) {
+	defer l.wg.Done()
+	defer l.release(client)
+	defer client.Close()
+
+	upstream, endpoint, err := l.dial()
+	if err != nil {
+		l4Connections.WithLabelValues(l.config.Name, l.config.Protocol, "upstream_error").Inc()
+		return
+	}
+	if !l.track(upstream) {
+		upstream.Close()
+		return
+	}
+	defer l.untrack(upstream)
+	defer upstream.Close()
+
+	l4Connections.WithLabelValues(l.config.Name, l.config.Protocol, "accepted").Inc()
+	l4ActiveConnections.WithLabelValues(l.config.Name, l.config.Protocol).Inc()
+	defer l4ActiveConnections.WithLabelValues(l.config.Name, l.config.Protocol).Dec()
+	l.log.Debug("L4 connection opened",
+		logger.String("client", client.RemoteAddr().String()),
+		logger.String("endpoint", endpoint.Host),
+	)
+
+	idle := time.Duration(l.config.IdleTimeout) * time.Second
+	var activity atomic.Int64
+	activity.Store(time.Now().UnixNano())
+
+	done := make(chan struct{}, 2)
+	go func() {
+		l.pipe(upstream, client, "upstream", idle, &activity)
+		done <- struct{}{}
+	}()
+	go func() {
+		l.pipe(client, upstream, "client", idle, &activity)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
+
+// pipe copies src to dst until src ends, then half-closes dst. Reads give up
+// once neither direction has seen traffic for idle, closing both sides.
+func (l *l4Listener) pipe(dst, src net.Conn, direction string, idle time.Duration, activity *atomic.Int64) {
+	bytes := l4Bytes.WithLabelValues(l.config.Name, direction)
+	buf := make([]byte, 32*1024)
+	for {
+		src.SetReadDeadline(time.Now().Add(idle))
+		n, err := src.Read(buf)
+		if n > 0 {
+			activity.Store(time.Now().UnixNano())
+			if _, writeErr := dst.Write(buf[:n]); writeErr != nil {
+				src.Close()
+				return
+			}
+			bytes.Add(float64(n))
+		}
+		if err == nil {
+			continue
+		}
+
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			// The other direction may still be busy
+			if time.Since(time.Unix(0, activity.Load())) < idle {
+				continue
+			}
+			src.Close()
+			dst.Close()
+			return
+		}
+		if err == io.EOF {
+			if tcp, ok := dst.(*net.TCPConn); ok {
+				tcp.CloseWrite()
+				return
+			}
+		}
+		dst.Close()
+		return
+	}
+}
+
+// serveUDP relays client datagrams to their session's upstream socket until
+// the listener closes
+func (l *l4Listener) serveUDP() {
+	defer l.wg.Done()
+	buf := make([]byte, 64*1024)
+	for {
+		n, client, err := l.packetConn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			l.log.Warn("Failed to read L4 datagram", logger.Error(err))
+			continue
+		}
+
+		session := l.udpSession(client)
+		if session == nil {
+			continue
+		}
+		session.activity.Store(time.Now().UnixNano())
+		if _, err := session.upstream.Write(buf[:n]); err != nil {
+			l.log.Debug("Failed to forward L4 datagram",
+				logger.String("endpoint", session.endpoint.Host),
+				logger.Error(err),
+			)
+			continue
+		}
+		l4Bytes.WithLabelValues(l.config.Name, "upstream").Add(float64(n))
+	}
+}
+
+// udpSession returns the client's session, opening one if needed. It returns
+// nil if the session limit is reached or no endpoint can be reached.
+func (l *l4Listener) udpSession(client net.Addr) *udpSession {
+	key := client.String()
+	l.mutex.Lock()
+	session, ok := l.sessions[key]
+	full := l.atCapacity(len(l.sessions))
+	l.mutex.Unlock()
+	if ok {
+		return session
+	}
+	if full {
+		l4Connections.WithLabelValues(l.config.Name, l.config.Protocol, "rejected").Inc()
+		return nil
+	}
+
+	upstream, endpoint, err := l.dial()
+	if err != nil {
+		l4Connections.WithLabelValues(l.config.Name, l.config.Protocol, "upstream_error").Inc()
+		return nil
+	}
+	session = &udpSession{client: client, upstream: upstream, endpoint: endpoint}
+	session.activity.Store(time.Now().UnixNano())
+
+	l.mutex.Lock()
+	if l.closed {
+		l.mutex.Unlock()
+		upstream.Close()
+		return nil
+	}
+	l.sessions[key] = session
+	l.conns[upstream] = struct{}{}
+	l.mutex.Unlock()
+
+	l4Connections.WithLabelValues(l.config.Name, l.config.Protocol, "accepted").Inc()
+	l4ActiveConnections.WithLabelValues(l.config.Name, l.config.Protocol).Inc()
+	l.wg.Add(1)
+	go l.relayReplies(session)
+	return session
+}
+
+// relayReplies sends the upstream's datagrams back to the session's client
+// and ends the session once it idles out or its socket closes
+func (l *l4Listener) relayReplies(session *udpSession) {
+	defer l.wg.Done()
+	defer func() {
+		l.mutex.Lock()
+		delete(l.sessions, session.client.String())
+		delete(l.conns, session.upstream)
+		l.mutex.Unlock()
+		session.upstream.Close()
+		l4ActiveConnections.WithLabelValues(l.config.Name, l.config.Protocol).Dec()
+	}()
+
+	idle := time.Duration(l.config.IdleTimeout) * time.Second
+	bytes := l4Bytes.WithLabelValues(l.config.Name, "client")
+	buf := make([]byte, 64*1024)
+	for {
+		session.upstream.SetReadDeadline(time.Now().Add(idle))
+		n, err := session.upstream.Read(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() &&
+				time.Since(time.Unix(0, session.activity.Load())) < idle {
+				continue
+			}
+			return
+		}
+		session.activity.Store(time.Now().UnixNano())
+		if _, err := l.packetConn.WriteTo(buf[:n], session.client); err != nil {
+			return
+		}
+		bytes.Add(float64(n))
+	}
+}
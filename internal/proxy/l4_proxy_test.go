@@ -0,0 +1,255 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startTCPUpstream starts a TCP server answering each line with name and the line
+func startTCPUpstream(t *testing.T, name string) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					io.WriteString(conn, name+":"+line)
+				}
+			}()
+		}
+	}()
+	return listener
+}
+
+// startUDPUpstream starts a UDP server answering each datagram with name and the datagram
+func startUDPUpstream(t *testing.T, name string) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo([]byte(name+":"+string(buf[:n])), addr)
+		}
+	}()
+	return conn
+}
+
+// startL4Proxy starts a single listener on a free port
+func startL4Proxy(t *testing.T, listener config.L4Listener) *L4Proxy {
+	listener.Name = "test"
+	listener.Address = "127.0.0.1:0"
+	cfg := &config.L4ProxyConfig{Enabled: true, Listeners: []config.L4Listener{listener}}
+	for i := range cfg.Listeners {
+		l := &cfg.Listeners[i]
+		if l.Protocol == "" {
+			l.Protocol = config.L4ProtocolTCP
+		}
+		if l.ConnectTimeout == 0 {
+			l.ConnectTimeout = 1000
+		}
+		if l.IdleTimeout == 0 {
+			l.IdleTimeout = 60
+		}
+	}
+
+	p, err := NewL4Proxy(cfg, NewHealthScheduler(&config.HealthChecksConfig{}, &mockLogger{}), &mockLogger{})
+	require.NoError(t, err)
+	require.NoError(t, p.Start())
+	t.Cleanup(p.Stop)
+	return p
+}
+
+// exchangeTCP sends a line over a new connection and returns the reply
+func exchangeTCP(t *testing.T, addr net.Addr, line string) string {
+	conn, err := net.Dial("tcp", addr.String())
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	_, err = io.WriteString(conn, line+"\n")
+	require.NoError(t, err)
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	return strings.TrimSpace(reply)
+}
+
+func TestL4ProxyTCPRoundRobin(t *testing.T) {
+	a := startTCPUpstream(t, "a")
+	b := startTCPUpstream(t, "b")
+	p := startL4Proxy(t, config.L4Listener{LoadBalancing: &config.LoadBalancingConfig{
+		Method:    "round_robin",
+		Endpoints: []string{a.Addr().String(), b.Addr().String()},
+	}})
+	addr := p.listeners[0].addr()
+
+	seen := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		reply := exchangeTCP(t, addr, "ping")
+		seen[strings.SplitN(reply, ":", 2)[0]] = true
+		assert.True(t, strings.HasSuffix(reply, ":ping"))
+	}
+	assert.Equal(t, map[string]bool{"a": true, "b": true}, seen)
+}
+
+func TestL4ProxyTCPFailover(t *testing.T) {
+	up := startTCPUpstream(t, "up")
+
+	// A port nothing listens on
+	down, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	downAddr := down.Addr().String()
+	down.Close()
+
+	p := startL4Proxy(t, config.L4Listener{LoadBalancing: &config.LoadBalancingConfig{
+		Endpoints: []string{downAddr, up.Addr().String()},
+	}})
+	addr := p.listeners[0].addr()
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "up:hello", exchangeTCP(t, addr, "hello"))
+	}
+}
+
+func TestL4ProxyTCPMaxConnections(t *testing.T) {
+	upstream := startTCPUpstream(t, "a")
+	p := startL4Proxy(t, config.L4Listener{Upstream: upstream.Addr().String(), MaxConnections: 1,
+		LoadBalancing: &config.LoadBalancingConfig{Endpoints: []string{upstream.Addr().String()}}})
+	addr := p.listeners[0].addr()
+
+	first, err := net.Dial("tcp", addr.String())
+	require.NoError(t, err)
+	defer first.Close()
+	_, err = io.WriteString(first, "one\n")
+	require.NoError(t, err)
+	reply, err := bufio.NewReader(first).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "a:one\n", reply)
+
+	// The second connection is closed without reaching the upstream
+	second, err := net.Dial("tcp", addr.String())
+	require.NoError(t, err)
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = second.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+
+	first.Close()
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr.String())
+		if err != nil {
+			return false
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(time.Second))
+		io.WriteString(conn, "two\n")
+		reply, err := bufio.NewReader(conn).ReadString('\n')
+		return err == nil && reply == "a:two\n"
+	}, 2*time.Second, 50*time.Millisecond)
+}
+
+func TestL4ProxyTCPHalfClose(t *testing.T) {
+	// The upstream answers once the client has finished sending
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		body, _ := io.ReadAll(conn)
+		conn.Write([]byte(strings.ToUpper(string(body))))
+	}()
+
+	p := startL4Proxy(t, config.L4Listener{LoadBalancing: &config.LoadBalancingConfig{
+		Endpoints: []string{listener.Addr().String()},
+	}})
+
+	conn, err := net.Dial("tcp", p.listeners[0].addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	_, err = io.WriteString(conn, "request")
+	require.NoError(t, err)
+	require.NoError(t, conn.(*net.TCPConn).CloseWrite())
+
+	reply, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "REQUEST", string(reply))
+}
+
+func TestL4ProxyUDP(t *testing.T) {
+	upstream := startUDPUpstream(t, "dns")
+	p := startL4Proxy(t, config.L4Listener{
+		Protocol:      config.L4ProtocolUDP,
+		IdleTimeout:   1,
+		LoadBalancing: &config.LoadBalancingConfig{Endpoints: []string{upstream.LocalAddr().String()}},
+	})
+	l := p.listeners[0]
+
+	client, err := net.Dial("udp", l.addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	client.SetDeadline(time.Now().Add(3 * time.Second))
+
+	buf := make([]byte, 1024)
+	for _, query := range []string{"q1", "q2"} {
+		_, err = client.Write([]byte(query))
+		require.NoError(t, err)
+		n, err := client.Read(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "dns:"+query, string(buf[:n]))
+	}
+
+	// Both datagrams shared one session, which ends once idle
+	l.mutex.Lock()
+	assert.Len(t, l.sessions, 1)
+	l.mutex.Unlock()
+	require.Eventually(t, func() bool {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		return len(l.sessions) == 0
+	}, 3*time.Second, 50*time.Millisecond)
+}
+
+func TestL4ProxyStartFailure(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer taken.Close()
+
+	cfg := &config.L4ProxyConfig{Enabled: true, Listeners: []config.L4Listener{{
+		Name:          "db",
+		Protocol:      config.L4ProtocolTCP,
+		Address:       taken.Addr().String(),
+		LoadBalancing: &config.LoadBalancingConfig{Endpoints: []string{"127.0.0.1:5432"}},
+	}}}
+	p, err := NewL4Proxy(cfg, NewHealthScheduler(&config.HealthChecksConfig{}, &mockLogger{}), &mockLogger{})
+	require.NoError(t, err)
+	assert.ErrorContains(t, p.Start(), "failed to start L4 listener db")
+}
@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"math/rand"
+	"net/url"
+	"time"
+)
+
+const (
+	// defaultEWMAAlpha weights the newest latency sample in the moving average
+	defaultEWMAAlpha = 0.3
+	// defaultWarmup is how long a newly discovered endpoint is scored at the pool average
+	defaultWarmup = 30 * time.Second
+	// ewmaStaleAfter marks averages without recent samples as unreliable so
+	// endpoints that stopped receiving traffic get probed again
+	ewmaStaleAfter = 10 * time.Second
+	// failurePenalty is added to the latency of failed upstream requests
+	failurePenalty = time.Second
+)
+
+// endpointStats tracks the response time of a single endpoint
+type endpointStats struct {
+	ewma       float64 // seconds
+	samples    int
+	firstSeen  time.Time // zero for endpoints configured at startup
+	lastSample time.Time
+}
+
+// RecordResponse feeds an upstream response time into the endpoint's moving average
+func (lb *LoadBalancer) RecordResponse(endpoint *url.URL, latency time.Duration, failed bool) {
+	if endpoint == nil {
+		return
+	}
+
+	sample := latency.Seconds()
+	if failed {
+		sample += failurePenalty.Seconds()
+	}
+
+	alpha := lb.config.EWMAAlpha
+	if alpha <= 0 || alpha > 1 {
+		alpha = defaultEWMAAlpha
+	}
+
+	lb.statsLock.Lock()
+	defer lb.statsLock.Unlock()
+
+	st := lb.endpointStatsLocked(endpoint.String(), time.Time{})
+	if st.samples == 0 {
+		st.ewma = sample
+	} else {
+		st.ewma = alpha*sample + (1-alpha)*st.ewma
+	}
+	st.samples++
+	st.lastSample = time.Now()
+}
+
+// getLeastResponseTimeEndpoint picks the faster of two random endpoints
+// ("power of two choices"), which favours low latency without herding
+func (lb *LoadBalancer) getLeastResponseTimeEndpoint(endpoints []*url.URL) *url.URL {
+	if len(endpoints) == 1 {
+		return endpoints[0]
+	}
+
+	i := rand.Intn(len(endpoints))
+	j := rand.Intn(len(endpoints) - 1)
+	if j >= i {
+		j++
+	}
+
+	lb.statsLock.Lock()
+	defer lb.statsLock.Unlock()
+
+	now := time.Now()
+	baseline := lb.baselineLocked(now)
+	if lb.responseTimeScoreLocked(endpoints[j], now, baseline) < lb.responseTimeScoreLocked(endpoints[i], now, baseline) {
+		return endpoints[j]
+	}
+	return endpoints[i]
+}
+
+// responseTimeScoreLocked returns the expected latency of an endpoint; endpoints that
+// are warming up, unsampled or stale are scored at the pool baseline
+func (lb *LoadBalancer) responseTimeScoreLocked(endpoint *url.URL, now time.Time, baseline float64) float64 {
+	st, ok := lb.stats[endpoint.String()]
+	if !ok || !lb.isReliableLocked(st, now) {
+		return baseline
+	}
+	return st.ewma
+}
+
+// baselineLocked returns the mean moving average across reliable endpoints
+func (lb *LoadBalancer) baselineLocked(now time.Time) float64 {
+	var sum float64
+	var count int
+	for _, st := range lb.stats {
+		if lb.isReliableLocked(st, now) {
+			sum += st.ewma
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+// isReliableLocked reports whether an endpoint's average should drive selection
+func (lb *LoadBalancer) isReliableLocked(st *endpointStats, now time.Time) bool {
+	if st.samples == 0 || now.Sub(st.lastSample) > ewmaStaleAfter {
+		return false
+	}
+	return st.firstSeen.IsZero() || now.Sub(st.firstSeen) >= lb.warmupDuration()
+}
+
+// warmupDuration returns the configured warmup window for new endpoints
+func (lb *LoadBalancer) warmupDuration() time.Duration {
+	if lb.config.Warmup > 0 {
+		return time.Duration(lb.config.Warmup) * time.Second
+	}
+	return defaultWarmup
+}
+
+// endpointStatsLocked returns the stats for an endpoint, creating them if needed
+func (lb *LoadBalancer) endpointStatsLocked(key string, firstSeen time.Time) *endpointStats {
+	if lb.stats == nil {
+		lb.stats = make(map[string]*endpointStats)
+	}
+	st, ok := lb.stats[key]
+	if !ok {
+		st = &endpointStats{firstSeen: firstSeen}
+		lb.stats[key] = st
+	}
+	return st
+}
+
+// trackEndpoints starts the warmup window for endpoints seen for the first time
+// and forgets endpoints that are no longer present
+func (lb *LoadBalancer) trackEndpoints(endpoints []*url.URL) {
+	lb.statsLock.Lock()
+	defer lb.statsLock.Unlock()
+
+	now := time.Now()
+	current := make(map[string]bool, len(endpoints))
+	for _, endpoint := range endpoints {
+		key := endpoint.String()
+		current[key] = true
+		lb.endpointStatsLocked(key, now)
+	}
+	for key := range lb.stats {
+		if !current[key] {
+			delete(lb.stats, key)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLeastResponseTimeLB(t *testing.T, endpoints ...string) *LoadBalancer {
+	lb, err := NewLoadBalancer(&config.LoadBalancingConfig{
+		Method:    "least_response_time",
+		Driver:    "static",
+		Endpoints: endpoints,
+	}, &mockLogger{})
+	require.NoError(t, err)
+	require.NotNil(t, lb)
+	return lb
+}
+
+func TestLeastResponseTimePrefersFasterEndpoint(t *testing.T) {
+	lb := newLeastResponseTimeLB(t, "http://fast:8080", "http://slow:8080")
+	fast, slow := lb.endpoints[0], lb.endpoints[1]
+
+	for i := 0; i < 5; i++ {
+		lb.RecordResponse(fast, 10*time.Millisecond, false)
+		lb.RecordResponse(slow, 200*time.Millisecond, false)
+	}
+
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, fast.String(), lb.GetEndpoint().String())
+	}
+}
+
+func TestLeastResponseTimeFailuresArePenalised(t *testing.T) {
+	lb := newLeastResponseTimeLB(t, "http://failing:8080", "http://healthy:8080")
+	failing, healthy := lb.endpoints[0], lb.endpoints[1]
+
+	// Fast failures must not attract traffic
+	lb.RecordResponse(failing, time.Millisecond, true)
+	lb.RecordResponse(healthy, 50*time.Millisecond, false)
+
+	assert.Equal(t, healthy.String(), lb.GetEndpoint().String())
+}
+
+func TestLeastResponseTimeEWMA(t *testing.T) {
+	lb := newLeastResponseTimeLB(t, "http://svc:8080")
+	lb.config.EWMAAlpha = 0.5
+	endpoint := lb.endpoints[0]
+
+	lb.RecordResponse(endpoint, 100*time.Millisecond, false)
+	lb.RecordResponse(endpoint, 300*time.Millisecond, false)
+
+	assert.InDelta(t, 0.2, lb.stats[endpoint.String()].ewma, 1e-9)
+	assert.Equal(t, 2, lb.stats[endpoint.String()].samples)
+}
+
+func TestLeastResponseTimeWarmup(t *testing.T) {
+	lb := newLeastResponseTimeLB(t, "http://a:8080", "http://b:8080")
+	a, b := lb.endpoints[0], lb.endpoints[1]
+	lb.RecordResponse(a, 100*time.Millisecond, false)
+	lb.RecordResponse(b, 300*time.Millisecond, false)
+
+	// A newly discovered endpoint with a slow first response is scored at the pool average
+	c, _ := url.Parse("http://c:8080")
+	lb.SetHealthyEndpoints([]*url.URL{a, b, c})
+	lb.RecordResponse(c, 2*time.Second, false)
+
+	now := time.Now()
+	baseline := lb.baselineLocked(now)
+	assert.InDelta(t, 0.2, baseline, 1e-9)
+	assert.InDelta(t, 0.2, lb.responseTimeScoreLocked(c, now, baseline), 1e-9)
+
+	// After the warmup window its own average applies
+	lb.stats[c.String()].firstSeen = now.Add(-lb.warmupDuration())
+	assert.InDelta(t, 2.0, lb.responseTimeScoreLocked(c, now, lb.baselineLocked(now)), 1e-9)
+}
+
+func TestLeastResponseTimeStaleAverages(t *testing.T) {
+	lb := newLeastResponseTimeLB(t, "http://a:8080", "http://b:8080")
+	a, b := lb.endpoints[0], lb.endpoints[1]
+	lb.RecordResponse(a, 100*time.Millisecond, false)
+	lb.RecordResponse(b, time.Second, false)
+
+	// b has not been sampled recently, so it is scored at the baseline again
+	lb.stats[b.String()].lastSample = time.Now().Add(-2 * ewmaStaleAfter)
+	now := time.Now()
+	assert.InDelta(t, 0.1, lb.responseTimeScoreLocked(b, now, lb.baselineLocked(now)), 1e-9)
+}
@@ -1,9 +1,13 @@
 package proxy
 
 import (
+	"crypto/tls"
+	"fmt"
 	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -20,6 +24,13 @@ type LoadBalancer struct {
 	healthMap  map[string]bool
 	healthLock sync.RWMutex
 	log        logger.Logger
+
+	// Called when a health check marks an endpoint unhealthy
+	onUnhealthy func(endpoint *url.URL, reason string)
+
+	// Per-endpoint tracking for response times and slow start
+	stats     map[string]*endpointStats
+	statsLock sync.Mutex
 }
 
 // NewLoadBalancer creates a new load balancer
@@ -51,16 +62,14 @@ func NewLoadBalancer(config *config.LoadBalancingConfig, log logger.Logger) (*Lo
 		counter:   0,
 		healthMap: make(map[string]bool),
 		log:       log,
+		stats:     make(map[string]*endpointStats),
 	}
 
-	// Initialize all endpoints as healthy
+	// Initialize all endpoints as healthy; configured endpoints skip warmup.
+	// Health checks, if enabled, are run by the owner's HealthScheduler.
 	for _, endpoint := range endpoints {
 		lb.healthMap[endpoint.String()] = true
-	}
-
-	// Start health checking if enabled
-	if config.HealthCheck {
-		go lb.startHealthCheck()
+		lb.stats[endpoint.String()] = &endpointStats{}
 	}
 
 	return lb, nil
@@ -68,6 +77,12 @@ func NewLoadBalancer(config *config.LoadBalancingConfig, log logger.Logger) (*Lo
 
 // GetEndpoint returns the next endpoint based on the load balancing strategy
 func (lb *LoadBalancer) GetEndpoint() *url.URL {
+	return lb.GetEndpointExcluding(nil)
+}
+
+// GetEndpointExcluding returns the next endpoint, skipping endpoints for which
+// exclude returns true unless no other healthy endpoint is left
+func (lb *LoadBalancer) GetEndpointExcluding(exclude func(*url.URL) bool) *url.URL {
 	// First check if we have any healthy endpoints
 	healthyEndpoints := lb.getHealthyEndpoints()
 	if len(healthyEndpoints) == 0 {
@@ -75,12 +90,33 @@ func (lb *LoadBalancer) GetEndpoint() *url.URL {
 		return lb.getAnyEndpoint()
 	}
 
+	// Prefer endpoints the caller hasn't excluded, such as ones that already
+	// failed this request
+	if exclude != nil {
+		var remaining []*url.URL
+		for _, endpoint := range healthyEndpoints {
+			if !exclude(endpoint) {
+				remaining = append(remaining, endpoint)
+			}
+		}
+		if len(remaining) > 0 {
+			healthyEndpoints = remaining
+		}
+	}
+
+	// Ramp traffic to newly discovered endpoints
+	if endpoint := lb.pickSlowStart(healthyEndpoints); endpoint != nil {
+		return endpoint
+	}
+
 	// Select endpoint based on strategy
 	switch lb.config.Method {
 	case "random":
 		return lb.getRandomEndpoint(healthyEndpoints)
 	case "round_robin":
 		return lb.getRoundRobinEndpoint(healthyEndpoints)
+	case "least_response_time":
+		return lb.getLeastResponseTimeEndpoint(healthyEndpoints)
 	default:
 		// Default to round-robin
 		return lb.getRoundRobinEndpoint(healthyEndpoints)
@@ -101,8 +137,29 @@ func (lb *LoadBalancer) getHealthyEndpoints() []*url.URL {
 	return healthy
 }
 
+// getHealthyEndpoint returns the endpoint with the given URL if it is still
+// served and healthy, or nil
+func (lb *LoadBalancer) getHealthyEndpoint(key string) *url.URL {
+	lb.healthLock.RLock()
+	defer lb.healthLock.RUnlock()
+
+	for _, endpoint := range lb.endpoints {
+		if endpoint.String() == key && lb.healthMap[key] {
+			return endpoint
+		}
+	}
+	return nil
+}
+
 // getAnyEndpoint returns any endpoint regardless of health status
 func (lb *LoadBalancer) getAnyEndpoint() *url.URL {
+	lb.healthLock.RLock()
+	defer lb.healthLock.RUnlock()
+
+	if len(lb.endpoints) == 0 {
+		return nil
+	}
+
 	// Just use round-robin on all endpoints
 	count := atomic.AddUint64(&lb.counter, 1)
 	return lb.endpoints[count%uint64(len(lb.endpoints))]
@@ -119,57 +176,65 @@ func (lb *LoadBalancer) getRoundRobinEndpoint(endpoints []*url.URL) *url.URL {
 	return endpoints[count%uint64(len(endpoints))]
 }
 
-// startHealthCheck periodically checks the health of all endpoints
-func (lb *LoadBalancer) startHealthCheck() {
-	interval := 10 * time.Second
+// healthCheckInterval returns the configured interval between health checks
+// or the default
+func (lb *LoadBalancer) healthCheckInterval() time.Duration {
 	if lb.config.HealthCheckConfig != nil && lb.config.HealthCheckConfig.Interval > 0 {
-		interval = time.Duration(lb.config.HealthCheckConfig.Interval) * time.Second
-	}
-
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-
-	for {
-		<-ticker.C
-		lb.checkEndpointsHealth()
+		return time.Duration(lb.config.HealthCheckConfig.Interval) * time.Second
 	}
+	return 10 * time.Second
 }
 
-// checkEndpointsHealth checks the health of all endpoints
-func (lb *LoadBalancer) checkEndpointsHealth() {
+// resetHealth marks every endpoint healthy, for when health checks stop
+func (lb *LoadBalancer) resetHealth() {
+	lb.healthLock.Lock()
+	defer lb.healthLock.Unlock()
 	for _, endpoint := range lb.endpoints {
-		go lb.checkEndpointHealth(endpoint)
+		lb.healthMap[endpoint.String()] = true
 	}
 }
 
 // checkEndpointHealth checks the health of a single endpoint
 func (lb *LoadBalancer) checkEndpointHealth(endpoint *url.URL) {
-	// Create a health check URL using configured path or default to /health
-	healthURL := *endpoint
-	healthPath := "/health"
-	if lb.config.HealthCheckConfig != nil && lb.config.HealthCheckConfig.Path != "" {
-		healthPath = lb.config.HealthCheckConfig.Path
-	}
-	healthURL.Path = healthPath
-
-	// Create a client with configured timeout or default
+	// Probe with the configured timeout or default
 	timeout := 2 * time.Second
 	if lb.config.HealthCheckConfig != nil && lb.config.HealthCheckConfig.Timeout > 0 {
 		timeout = time.Duration(lb.config.HealthCheckConfig.Timeout) * time.Second
 	}
-	client := &http.Client{
-		Timeout: timeout,
-	}
 
-	// Make the request
-	resp, err := client.Get(healthURL.String())
+	var resp *http.Response
+	var err error
+	if lb.config.HealthCheckConfig != nil && lb.config.HealthCheckConfig.Type == config.HealthCheckTCP {
+		err = probeTCP(endpoint, timeout)
+	} else {
+		client := &http.Client{
+			Timeout: timeout,
+		}
+		if lb.config.HealthCheckConfig != nil && lb.config.HealthCheckConfig.TLSSkipVerify {
+			client.Transport = &http.Transport{
+				TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+				DisableKeepAlives: true,
+			}
+		}
+
+		// Make the request
+		var req *http.Request
+		req, err = lb.newHealthCheckRequest(endpoint)
+		if err == nil {
+			resp, err = client.Do(req)
+		}
+	}
 
 	// Update health status
 	lb.healthLock.Lock()
 	defer lb.healthLock.Unlock()
 
-	// Mark as healthy if no error and status is 2xx
-	isHealthy := err == nil && resp != nil && resp.StatusCode >= 200 && resp.StatusCode < 300
+	// Mark as healthy if no error and the status is expected; TCP probes
+	// have no status
+	isHealthy := err == nil && (resp == nil || lb.isExpectedHealthStatus(resp.StatusCode))
+	if err == nil && resp != nil && !isHealthy {
+		err = fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
 
 	// Only log if status changes
 	currentHealth := lb.healthMap[endpoint.String()]
@@ -184,6 +249,9 @@ func (lb *LoadBalancer) checkEndpointHealth(endpoint *url.URL) {
 				logger.String("endpoint", endpoint.String()),
 				logger.String("reason", getErrorMessage(err)),
 			)
+			if lb.onUnhealthy != nil {
+				lb.onUnhealthy(endpoint, getErrorMessage(err))
+			}
 		}
 	}
 
@@ -195,6 +263,75 @@ func (lb *LoadBalancer) checkEndpointHealth(endpoint *url.URL) {
 	}
 }
 
+// newHealthCheckRequest builds the probe request for an endpoint using the
+// configured path, scheme override, headers and bearer token
+func (lb *LoadBalancer) newHealthCheckRequest(endpoint *url.URL) (*http.Request, error) {
+	hc := lb.config.HealthCheckConfig
+
+	// Create a health check URL using configured path or default to /health
+	healthURL := *endpoint
+	healthURL.Path = "/health"
+	if hc != nil && hc.Path != "" {
+		healthURL.Path = hc.Path
+	}
+	if hc != nil && hc.Scheme != "" {
+		healthURL.Scheme = hc.Scheme
+	}
+
+	req, err := http.NewRequest(http.MethodGet, healthURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if hc == nil {
+		return req, nil
+	}
+
+	for name, value := range hc.Headers {
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+	if hc.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+hc.BearerToken)
+	}
+
+	return req, nil
+}
+
+// probeTCP checks that an endpoint accepts TCP connections. Endpoints without
+// a port are dialed on their scheme's default port.
+func probeTCP(endpoint *url.URL, timeout time.Duration) error {
+	address := endpoint.Host
+	if endpoint.Port() == "" {
+		port := "80"
+		if endpoint.Scheme == "https" {
+			port = "443"
+		}
+		address = net.JoinHostPort(endpoint.Hostname(), port)
+	}
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// isExpectedHealthStatus reports whether a probe status code counts as healthy,
+// defaulting to any 2xx status
+func (lb *LoadBalancer) isExpectedHealthStatus(statusCode int) bool {
+	if lb.config.HealthCheckConfig == nil || len(lb.config.HealthCheckConfig.ExpectedStatuses) == 0 {
+		return statusCode >= 200 && statusCode < 300
+	}
+	for _, expected := range lb.config.HealthCheckConfig.ExpectedStatuses {
+		if statusCode == expected {
+			return true
+		}
+	}
+	return false
+}
+
 // getErrorMessage safely extracts error message
 func getErrorMessage(err error) string {
 	if err == nil {
@@ -213,12 +350,52 @@ func (lb *LoadBalancer) GetServiceDiscoveries() *config.Discoveries {
 	return lb.config.Discoveries
 }
 
-// SetHealthyEndpoints setting healthy endpoint
-func (lb *LoadBalancer) SetHealthyEndpoints(endpoints []*url.URL) bool {
+// SetUnhealthyListener sets a function called when a health check marks an
+// endpoint unhealthy. It must not block.
+func (lb *LoadBalancer) SetUnhealthyListener(listener func(endpoint *url.URL, reason string)) {
+	lb.healthLock.Lock()
+	defer lb.healthLock.Unlock()
+	lb.onUnhealthy = listener
+}
+
+// setEndpointHealth marks an endpoint healthy or unhealthy until the next
+// health check
+func (lb *LoadBalancer) setEndpointHealth(endpoint *url.URL, healthy bool) {
+	lb.healthLock.Lock()
+	defer lb.healthLock.Unlock()
+	lb.healthMap[endpoint.String()] = healthy
+}
+
+// currentEndpoints returns the endpoints being balanced
+func (lb *LoadBalancer) currentEndpoints() []*url.URL {
 	lb.healthLock.RLock()
 	defer lb.healthLock.RUnlock()
+	return lb.endpoints
+}
+
+// SetHealthyEndpoints setting healthy endpoint
+func (lb *LoadBalancer) SetHealthyEndpoints(endpoints []*url.URL) bool {
+	lb.healthLock.Lock()
+	defer lb.healthLock.Unlock()
 
 	lb.endpoints = endpoints
 
+	// Newly discovered endpoints start healthy, and removed endpoints are
+	// forgotten so they start healthy again when they come back
+	current := make(map[string]bool, len(endpoints))
+	for _, endpoint := range endpoints {
+		current[endpoint.String()] = true
+		if _, known := lb.healthMap[endpoint.String()]; !known {
+			lb.healthMap[endpoint.String()] = true
+		}
+	}
+	for key := range lb.healthMap {
+		if !current[key] {
+			delete(lb.healthMap, key)
+		}
+	}
+
+	lb.trackEndpoints(endpoints)
+
 	return true
 }
@@ -3,6 +3,7 @@ package proxy
 import (
 	"api-gateway/internal/config"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -174,6 +175,28 @@ func TestGetEndpoint(t *testing.T) {
 	})
 }
 
+func TestGetEndpointExcluding(t *testing.T) {
+	cfg := &config.LoadBalancingConfig{
+		Method:    "round_robin",
+		Driver:    "static",
+		Endpoints: []string{"http://localhost:8001", "http://localhost:8002", "http://localhost:8003"},
+	}
+	lb, err := NewLoadBalancer(cfg, &mockLogger{})
+	require.NoError(t, err)
+
+	t.Run("skips excluded endpoints", func(t *testing.T) {
+		exclude := func(u *url.URL) bool { return u.Host != "localhost:8002" }
+		for i := 0; i < 5; i++ {
+			assert.Equal(t, "http://localhost:8002", lb.GetEndpointExcluding(exclude).String())
+		}
+	})
+
+	t.Run("falls back when every endpoint is excluded", func(t *testing.T) {
+		exclude := func(*url.URL) bool { return true }
+		assert.NotNil(t, lb.GetEndpointExcluding(exclude))
+	})
+}
+
 func TestHealthCheck(t *testing.T) {
 	// Create test servers to act as healthy and unhealthy endpoints
 	healthyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -226,6 +249,114 @@ func TestHealthCheck(t *testing.T) {
 	assert.Equal(t, healthyURL.String(), healthyEndpoints[0].String())
 }
 
+func TestHealthCheckProbeOptions(t *testing.T) {
+	log := &mockLogger{}
+
+	t.Run("custom headers, host and bearer token", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Host != "internal.svc" || r.Header.Get("Authorization") != "Bearer probe-token" || r.Header.Get("X-Probe") != "gateway" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		endpoint, _ := url.Parse(server.URL)
+		lb := &LoadBalancer{
+			config: &config.LoadBalancingConfig{
+				HealthCheckConfig: &config.HealthCheckConfig{
+					Path:        "/healthz",
+					Headers:     map[string]string{"Host": "internal.svc", "X-Probe": "gateway"},
+					BearerToken: "probe-token",
+				},
+			},
+			healthMap: map[string]bool{endpoint.String(): false},
+			log:       log,
+		}
+
+		lb.checkEndpointHealth(endpoint)
+		assert.True(t, lb.healthMap[endpoint.String()])
+	})
+
+	t.Run("expected status codes", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		endpoint, _ := url.Parse(server.URL)
+		hc := &config.HealthCheckConfig{ExpectedStatuses: []int{http.StatusOK}}
+		lb := &LoadBalancer{
+			config:    &config.LoadBalancingConfig{HealthCheckConfig: hc},
+			healthMap: map[string]bool{endpoint.String(): true},
+			log:       log,
+		}
+
+		lb.checkEndpointHealth(endpoint)
+		assert.False(t, lb.healthMap[endpoint.String()], "204 is not in the expected list")
+
+		hc.ExpectedStatuses = []int{http.StatusOK, http.StatusNoContent}
+		lb.checkEndpointHealth(endpoint)
+		assert.True(t, lb.healthMap[endpoint.String()])
+	})
+
+	t.Run("https scheme override", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		// Endpoint is registered as plain http but probes must use https
+		endpoint, _ := url.Parse(server.URL)
+		endpoint.Scheme = "http"
+		lb := &LoadBalancer{
+			config: &config.LoadBalancingConfig{
+				HealthCheckConfig: &config.HealthCheckConfig{Scheme: "https", TLSSkipVerify: true},
+			},
+			healthMap: map[string]bool{endpoint.String(): false},
+			log:       log,
+		}
+
+		req, err := lb.newHealthCheckRequest(endpoint)
+		require.NoError(t, err)
+		assert.Equal(t, "https", req.URL.Scheme)
+
+		lb.checkEndpointHealth(endpoint)
+		assert.True(t, lb.healthMap[endpoint.String()])
+	})
+
+	t.Run("tcp connect", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				conn.Close()
+			}
+		}()
+
+		endpoint, _ := url.Parse("tcp://" + listener.Addr().String())
+		lb := &LoadBalancer{
+			config: &config.LoadBalancingConfig{
+				HealthCheckConfig: &config.HealthCheckConfig{Type: config.HealthCheckTCP},
+			},
+			healthMap: map[string]bool{endpoint.String(): false},
+			log:       log,
+		}
+
+		lb.checkEndpointHealth(endpoint)
+		assert.True(t, lb.healthMap[endpoint.String()])
+
+		listener.Close()
+		lb.checkEndpointHealth(endpoint)
+		assert.False(t, lb.healthMap[endpoint.String()])
+	})
+}
+
 func TestGetDriver(t *testing.T) {
 	log := &mockLogger{}
 	cfg := &config.LoadBalancingConfig{
@@ -301,6 +432,25 @@ func TestLoadBalancer_SetHealthyEndpoints(t *testing.T) {
 	assert.Contains(t, lb.endpoints, newEndpoint3)
 }
 
+// TestLoadBalancer_SetHealthyEndpointsReaddsHealthy tests that an endpoint
+// removed while unhealthy starts healthy when it is added back
+func TestLoadBalancer_SetHealthyEndpointsReaddsHealthy(t *testing.T) {
+	lb, err := NewLoadBalancer(&config.LoadBalancingConfig{
+		Method:    "round_robin",
+		Endpoints: []string{"http://endpoint1.example.com", "http://endpoint2.example.com"},
+	}, &mockLogger{})
+	require.NoError(t, err)
+
+	endpoint1, endpoint2 := lb.endpoints[0], lb.endpoints[1]
+	lb.setEndpointHealth(endpoint2, false)
+
+	lb.SetHealthyEndpoints([]*url.URL{endpoint1})
+	assert.NotContains(t, lb.healthMap, endpoint2.String())
+
+	lb.SetHealthyEndpoints([]*url.URL{endpoint1, endpoint2})
+	assert.True(t, lb.healthMap[endpoint2.String()])
+}
+
 // TestLoadBalancer_GetDriver tests the GetDriver method
 func TestLoadBalancer_GetDriver(t *testing.T) {
 	// Create mock logger
@@ -0,0 +1,191 @@
+package proxy
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// DNSResolutionFailures tracks failed upstream DNS lookups
+	dnsResolutionFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_dns_resolution_failures_total",
+			Help: "Total number of failed upstream DNS resolutions",
+		},
+		[]string{"host"},
+	)
+
+	// hedgedRequests counts hedged upstream requests by which attempt answered
+	// first, and hedges skipped because the budget was spent
+	hedgedRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_upstream_hedged_requests_total",
+			Help: "Total number of hedged upstream requests by outcome",
+		},
+		[]string{"route", "outcome"},
+	)
+
+	// blueGreenRollbacks counts blue/green switches reverted after an error spike
+	blueGreenRollbacks = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_blue_green_rollbacks_total",
+			Help: "Total number of blue/green switches rolled back because the new group's error rate spiked",
+		},
+		[]string{"route"},
+	)
+
+	// upstreamRollbacks counts reloaded upstream changes reverted after an
+	// error spike
+	upstreamRollbacks = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_upstream_rollbacks_total",
+			Help: "Total number of reloaded upstream changes rolled back because the new upstream's error rate spiked",
+		},
+		[]string{"route"},
+	)
+
+	// upstreamPrewarmDuration is how long the last connection warmup of a
+	// route took
+	upstreamPrewarmDuration = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_upstream_prewarm_duration_seconds",
+			Help: "Duration of the last upstream connection warmup of a route",
+		},
+		[]string{"route"},
+	)
+
+	// upstreamPrewarmFailures counts warmup connections that failed their
+	// health check
+	upstreamPrewarmFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_upstream_prewarm_failures_total",
+			Help: "Total number of upstream warmup connections that failed or were unhealthy",
+		},
+		[]string{"route"},
+	)
+
+	// soapRequests counts SOAP route requests by the operation they matched
+	soapRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_soap_requests_total",
+			Help: "Total number of SOAP route requests by matched operation",
+		},
+		[]string{"route", "operation"},
+	)
+
+	// soapRejections counts SOAP route requests failing the content type,
+	// size or XML checks
+	soapRejections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_soap_rejections_total",
+			Help: "Total number of SOAP route requests rejected by content type, size or XML checks",
+		},
+		[]string{"route", "reason"},
+	)
+
+	// contentRoutedRequests counts content routed requests by the rule they
+	// matched, default when none did, or too_large when rejected
+	contentRoutedRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_content_routed_requests_total",
+			Help: "Total number of content routed requests by matched rule",
+		},
+		[]string{"route", "rule"},
+	)
+
+	// splitHorizonRequests counts requests of split-horizon routes by the
+	// zone of the client, internal or external
+	splitHorizonRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_split_horizon_requests_total",
+			Help: "Total number of split-horizon routed requests by client zone",
+		},
+		[]string{"route", "zone"},
+	)
+
+	// spooledRequests counts requests of spooling routes by where their body
+	// was held, memory or disk, or why it was rejected: too_large, disk_full,
+	// failed or incomplete
+	spooledRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_spooled_requests_total",
+			Help: "Total number of requests with spooled bodies by result",
+		},
+		[]string{"route", "result"},
+	)
+
+	// spoolDiskBytes is the size of the request bodies spooled to disk
+	spoolDiskBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_spool_disk_bytes",
+			Help: "Bytes of request bodies spooled to disk",
+		},
+		[]string{"route"},
+	)
+
+	// upstreamErrors counts requests the gateway answered itself because the
+	// upstream failed or its circuit breaker was open, by the status sent and
+	// the kind of failure
+	upstreamErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_upstream_errors_total",
+			Help: "Total number of requests failed by upstream errors or open circuit breakers, by status code and reason",
+		},
+		[]string{"route", "code", "reason"},
+	)
+
+	// l4Connections counts L4 connections and UDP sessions by outcome:
+	// accepted, rejected at the connection limit, or upstream_error
+	l4Connections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_l4_connections_total",
+			Help: "Total number of L4 proxy connections and UDP sessions by result",
+		},
+		[]string{"listener", "protocol", "result"},
+	)
+
+	// l4ActiveConnections is the number of open L4 connections and UDP sessions
+	l4ActiveConnections = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_l4_active_connections",
+			Help: "Open L4 proxy connections and UDP sessions",
+		},
+		[]string{"listener", "protocol"},
+	)
+
+	// l4Bytes counts bytes relayed by L4 listeners, towards the upstream or
+	// the client
+	l4Bytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_l4_bytes_total",
+			Help: "Total number of bytes relayed by L4 proxy listeners",
+		},
+		[]string{"listener", "direction"},
+	)
+
+	// healthChecksInFlight is the number of upstream health check probes
+	// running on the scheduler's workers
+	healthChecksInFlight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "gateway_health_checks_in_flight",
+			Help: "Upstream health check probes running",
+		},
+	)
+
+	// healthChecksSkipped counts health check rounds skipped because the
+	// previous round of the route had not finished
+	healthChecksSkipped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_health_checks_skipped_total",
+			Help: "Total number of health check rounds skipped while the previous round was running",
+		},
+		[]string{"route"},
+	)
+)
+
+func init() {
+	// Register metrics with Prometheus
+	prometheus.MustRegister(dnsResolutionFailures, hedgedRequests, blueGreenRollbacks, upstreamRollbacks,
+		upstreamPrewarmDuration, upstreamPrewarmFailures, l4Connections, l4ActiveConnections, l4Bytes,
+		soapRequests, soapRejections, contentRoutedRequests, splitHorizonRequests, spooledRequests, spoolDiskBytes,
+		upstreamErrors, healthChecksInFlight, healthChecksSkipped)
+}
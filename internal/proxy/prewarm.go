@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// upstreamPrewarm opens connections to a route's endpoints in the background
+// and holds requests until it is done
+type upstreamPrewarm struct {
+	done    chan struct{}
+	timeout time.Duration
+}
+
+// startPrewarm opens cfg.Connections connections to each endpoint through the
+// route's transport, which keeps them idle for the first requests. Each
+// connection requests the warmup path; endpoints that fail are logged and,
+// with health checks on, marked unhealthy until the next check.
+func startPrewarm(route config.Route, transport http.RoundTripper, endpoints []*url.URL, lb *LoadBalancer, log logger.Logger) *upstreamPrewarm {
+	cfg := route.Prewarm
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	w := &upstreamPrewarm{done: make(chan struct{}), timeout: timeout}
+
+	go func() {
+		defer close(w.done)
+		start := time.Now()
+		client := &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+
+		var wg sync.WaitGroup
+		var failed atomic.Int64
+		for _, endpoint := range endpoints {
+			wg.Add(1)
+			go func(endpoint *url.URL) {
+				defer wg.Done()
+				if n := prewarmEndpoint(client, endpoint, cfg.Path, cfg.Connections); n > 0 {
+					failed.Add(int64(n))
+					log.Warn("Upstream endpoint failed warmup",
+						logger.String("path", route.Path),
+						logger.String("endpoint", endpoint.String()),
+						logger.Int("failed_connections", n),
+					)
+					if lb != nil && lb.config.HealthCheck {
+						lb.setEndpointHealth(endpoint, false)
+					}
+				}
+			}(endpoint)
+		}
+		wg.Wait()
+
+		elapsed := time.Since(start)
+		upstreamPrewarmDuration.WithLabelValues(route.Path).Set(elapsed.Seconds())
+		upstreamPrewarmFailures.WithLabelValues(route.Path).Add(float64(failed.Load()))
+		log.Info("Prewarmed upstream connections",
+			logger.String("path", route.Path),
+			logger.Int("endpoints", len(endpoints)),
+			logger.Int("connections", cfg.Connections),
+			logger.Int("failed", int(failed.Load())),
+			logger.Int("duration_ms", int(elapsed.Milliseconds())),
+		)
+	}()
+
+	return w
+}
+
+// prewarmEndpoint opens connections to an endpoint at once, so each needs
+// its own, and returns how many failed
+func prewarmEndpoint(client *http.Client, endpoint *url.URL, path string, connections int) int {
+	var wg sync.WaitGroup
+	var failed atomic.Int64
+	for i := 0; i < connections; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !prewarmConnection(client, endpoint, path) {
+				failed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	return int(failed.Load())
+}
+
+// prewarmConnection sends one warmup request, reporting whether the endpoint
+// answered with a 2xx or 3xx status. The body is drained so the connection
+// is kept for reuse.
+func prewarmConnection(client *http.Client, endpoint *url.URL, path string) bool {
+	target := *endpoint
+	target.Path = path
+	target.RawQuery = ""
+	resp, err := client.Get(target.String())
+	if err != nil {
+		return false
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 400
+}
+
+// wait blocks until the warmup is done, the timeout passed or the request
+// is canceled
+func (w *upstreamPrewarm) wait(ctx context.Context) {
+	select {
+	case <-w.done:
+		return
+	default:
+	}
+
+	timer := time.NewTimer(w.timeout)
+	defer timer.Stop()
+	select {
+	case <-w.done:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrewarmOpensConnections(t *testing.T) {
+	var conns, healthChecks atomic.Int32
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ready" {
+			healthChecks.Add(1)
+			// Hold the warmup requests so each needs its own connection
+			time.Sleep(20 * time.Millisecond)
+		}
+	}))
+	upstream.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	upstream.Start()
+	defer upstream.Close()
+
+	route := config.Route{
+		Path:        "/api",
+		Upstream:    upstream.URL,
+		Middlewares: &config.Middlewares{},
+		Prewarm:     &config.PrewarmConfig{Enabled: true, Connections: 3, Path: "/ready", Timeout: 5},
+	}
+	p := NewHTTPProxy(&config.Config{}, &config.RouteConfig{Routes: []config.Route{route}}, &mockLogger{})
+	handler := p.ProxyRequest(route)
+
+	// The first request waits for the warmup and reuses one of its connections
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/api/orders", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, int32(3), healthChecks.Load())
+	assert.Equal(t, int32(3), conns.Load())
+}
+
+func TestPrewarmMarksFailingEndpoints(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer healthy.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	lb, err := NewLoadBalancer(&config.LoadBalancingConfig{
+		Method:      "round_robin",
+		Driver:      "static",
+		HealthCheck: true,
+		Endpoints:   []string{healthy.URL, failing.URL},
+		// Keep the periodic check from running during the test
+		HealthCheckConfig: &config.HealthCheckConfig{Interval: 3600},
+	}, &mockLogger{})
+	require.NoError(t, err)
+
+	route := config.Route{Path: "/api", Prewarm: &config.PrewarmConfig{Enabled: true, Connections: 1, Path: "/health", Timeout: 5}}
+	warmup := startPrewarm(route, &http.Transport{}, lb.currentEndpoints(), lb, &mockLogger{})
+	warmup.wait(context.Background())
+
+	failingURL, _ := url.Parse(failing.URL)
+	healthyURL, _ := url.Parse(healthy.URL)
+	assert.Equal(t, []*url.URL{healthyURL}, lb.getHealthyEndpoints())
+	assert.NotContains(t, lb.getHealthyEndpoints(), failingURL)
+}
+
+func TestPrewarmWaitTimeout(t *testing.T) {
+	warmup := &upstreamPrewarm{done: make(chan struct{}), timeout: 10 * time.Millisecond}
+	start := time.Now()
+	warmup.wait(context.Background())
+	assert.Less(t, time.Since(start), time.Second)
+}
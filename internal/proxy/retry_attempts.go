@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// UpstreamAttempts records the endpoints tried while serving one client
+// request, so retries can prefer endpoints that haven't been tried yet
+type UpstreamAttempts struct {
+	mutex     sync.Mutex
+	endpoints []string
+}
+
+type upstreamAttemptsKey struct{}
+
+// WithUpstreamAttempts returns a context that records the upstream endpoints
+// each attempt of the request is sent to
+func WithUpstreamAttempts(ctx context.Context) (context.Context, *UpstreamAttempts) {
+	attempts := &UpstreamAttempts{}
+	return context.WithValue(ctx, upstreamAttemptsKey{}, attempts), attempts
+}
+
+// upstreamAttemptsFromContext returns the attempts recorded for the request, if tracked
+func upstreamAttemptsFromContext(ctx context.Context) *UpstreamAttempts {
+	attempts, _ := ctx.Value(upstreamAttemptsKey{}).(*UpstreamAttempts)
+	return attempts
+}
+
+// Endpoints returns the endpoints tried so far, in order
+func (a *UpstreamAttempts) Endpoints() []string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return append([]string(nil), a.endpoints...)
+}
+
+// add records an attempt against endpoint
+func (a *UpstreamAttempts) add(endpoint *url.URL) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.endpoints = append(a.endpoints, endpoint.String())
+}
+
+// tried reports whether endpoint was already used for this request
+func (a *UpstreamAttempts) tried(endpoint *url.URL) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	key := endpoint.String()
+	for _, e := range a.endpoints {
+		if e == key {
+			return true
+		}
+	}
+	return false
+}
+
+// isGatewayError reports whether status means the upstream was unavailable
+// rather than rejecting the request
+func isGatewayError(status int) bool {
+	switch status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyRequestRetriesDifferentEndpoint(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+
+	route := config.Route{
+		Path:     "/api",
+		Upstream: failing.URL,
+		LoadBalancing: &config.LoadBalancingConfig{
+			Method:    "round_robin",
+			Driver:    "static",
+			Endpoints: []string{failing.URL, healthy.URL},
+		},
+		Middlewares: &config.Middlewares{},
+	}
+	handler := NewHTTPProxy(&config.Config{}, &config.RouteConfig{Routes: []config.Route{route}}, &mockLogger{}).ProxyRequest(route)
+
+	// Whichever endpoint the first attempt uses, the second uses the other one
+	ctx, attempts := WithUpstreamAttempts(context.Background())
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "http://example.com/api", nil).WithContext(ctx)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	endpoints := attempts.Endpoints()
+	require.Len(t, endpoints, 2)
+	assert.ElementsMatch(t, []string{failing.URL, healthy.URL}, endpoints)
+}
+
+func TestIsGatewayError(t *testing.T) {
+	assert.True(t, isGatewayError(http.StatusBadGateway))
+	assert.True(t, isGatewayError(http.StatusServiceUnavailable))
+	assert.True(t, isGatewayError(http.StatusGatewayTimeout))
+	assert.False(t, isGatewayError(http.StatusInternalServerError))
+	assert.False(t, isGatewayError(http.StatusOK))
+}
@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// bakeWindow counts the responses of a newly activated upstream and reports
+// when its 5xx rate exceeds the rollback guard's limit. It is guarded by the
+// mutex of its owner.
+type bakeWindow struct {
+	guard  *config.RollbackGuard
+	until  time.Time
+	total  int
+	errors int
+}
+
+// start opens the window at now if the guard is enabled
+func (b *bakeWindow) start(now time.Time) {
+	b.total, b.errors = 0, 0
+	b.until = time.Time{}
+	if b.guard != nil && b.guard.Enabled {
+		b.until = now.Add(time.Duration(b.guard.BakeWindow) * time.Second)
+	}
+}
+
+// stop closes the window
+func (b *bakeWindow) stop() {
+	b.until = time.Time{}
+}
+
+// open reports whether responses are being watched at now
+func (b *bakeWindow) open(now time.Time) bool {
+	return now.Before(b.until)
+}
+
+// record counts a response and returns the error rate and whether it
+// exceeds the limit
+func (b *bakeWindow) record(failed bool) (float64, bool) {
+	b.total++
+	if failed {
+		b.errors++
+	}
+	if b.total < b.guard.MinRequests {
+		return 0, false
+	}
+	errorRate := float64(b.errors) / float64(b.total) * 100
+	return errorRate, errorRate > b.guard.MaxErrorRate
+}
+
+// rollbackAlert is POSTed to the alert webhook when a change is rolled back
+type rollbackAlert struct {
+	Event     string    `json:"event"`
+	Path      string    `json:"path"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	ErrorRate float64   `json:"error_rate"`
+	Requests  int       `json:"requests"`
+	Time      time.Time `json:"time"`
+}
+
+// rollbackAlerter sends rollback alerts to the configured webhook
+type rollbackAlerter struct {
+	url    string
+	client *http.Client
+	log    logger.Logger
+}
+
+// newRollbackAlerter creates an alerter, or nil if no webhook is configured
+func newRollbackAlerter(cfg *config.ReloadConfig, log logger.Logger) *rollbackAlerter {
+	if cfg.AlertWebhook == "" {
+		return nil
+	}
+	return &rollbackAlerter{
+		url:    cfg.AlertWebhook,
+		client: &http.Client{Timeout: time.Duration(cfg.WebhookTimeoutMs) * time.Millisecond},
+		log:    log,
+	}
+}
+
+// send posts the alert in the background so requests aren't held up
+func (a *rollbackAlerter) send(alert rollbackAlert) {
+	if a == nil {
+		return
+	}
+	go func() {
+		body, err := json.Marshal(alert)
+		if err != nil {
+			return
+		}
+		resp, err := a.client.Post(a.url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			a.log.Error("Failed to send rollback alert",
+				logger.String("path", alert.Path),
+				logger.Error(err),
+			)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusBadRequest {
+			a.log.Error("Rollback alert webhook rejected the alert",
+				logger.String("path", alert.Path),
+				logger.Int("status", resp.StatusCode),
+			)
+		}
+	}()
+}
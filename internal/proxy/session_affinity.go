@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"api-gateway/internal/config"
+)
+
+// sessionAffinity issues and verifies cookies pinning a client to the
+// endpoint that served its first request
+type sessionAffinity struct {
+	config *config.SessionAffinity
+	path   string
+}
+
+// newSessionAffinity returns the affinity cookie handling for a route, or nil
+// if affinity is disabled
+func newSessionAffinity(route config.Route) *sessionAffinity {
+	if route.LoadBalancing == nil || route.LoadBalancing.SessionAffinity == nil || !route.LoadBalancing.SessionAffinity.Enabled {
+		return nil
+	}
+	path := strings.TrimSuffix(route.Path, "/*")
+	if path == "" {
+		path = "/"
+	}
+	return &sessionAffinity{
+		config: route.LoadBalancing.SessionAffinity,
+		path:   path,
+	}
+}
+
+// endpoint returns the endpoint pinned by the request's affinity cookie, or
+// "" if it has none or its signature doesn't match
+func (a *sessionAffinity) endpoint(r *http.Request) string {
+	cookie, err := r.Cookie(a.config.CookieName)
+	if err != nil {
+		return ""
+	}
+	encoded, signature, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return ""
+	}
+	endpoint, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ""
+	}
+	expected := a.sign(string(endpoint))
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ""
+	}
+	return string(endpoint)
+}
+
+// setCookie pins the client to endpoint
+func (a *sessionAffinity) setCookie(w http.ResponseWriter, endpoint *url.URL) {
+	value := endpoint.String()
+	http.SetCookie(w, &http.Cookie{
+		Name:     a.config.CookieName,
+		Value:    base64.RawURLEncoding.EncodeToString([]byte(value)) + "." + a.sign(value),
+		Path:     a.path,
+		MaxAge:   a.config.MaxAge,
+		Secure:   a.config.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// sign returns the cookie signature for an endpoint
+func (a *sessionAffinity) sign(endpoint string) string {
+	mac := hmac.New(sha256.New, []byte(a.config.Secret))
+	mac.Write([]byte(endpoint))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// stripCookie removes the affinity cookie from the request so the upstream
+// doesn't see it
+func (a *sessionAffinity) stripCookie(r *http.Request) {
+	cookies := r.Cookies()
+	kept := make([]string, 0, len(cookies))
+	for _, cookie := range cookies {
+		if cookie.Name != a.config.CookieName {
+			kept = append(kept, cookie.String())
+		}
+	}
+	if len(kept) == len(cookies) {
+		return
+	}
+	r.Header.Del("Cookie")
+	if len(kept) > 0 {
+		r.Header.Set("Cookie", strings.Join(kept, "; "))
+	}
+}
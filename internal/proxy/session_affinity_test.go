@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionAffinity(t *testing.T) {
+	newUpstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := r.Cookie("GW_AFFINITY"); err == nil {
+				w.Header().Set("X-Saw-Affinity-Cookie", "true")
+			}
+			w.Write([]byte(name))
+		}))
+	}
+	a, b := newUpstream("a"), newUpstream("b")
+	defer a.Close()
+	defer b.Close()
+
+	route := config.Route{
+		Path:     "/api/*",
+		Upstream: a.URL,
+		LoadBalancing: &config.LoadBalancingConfig{
+			Method:    "round_robin",
+			Driver:    "static",
+			Endpoints: []string{a.URL, b.URL},
+			SessionAffinity: &config.SessionAffinity{
+				Enabled:    true,
+				CookieName: "GW_AFFINITY",
+				Secret:     "secret",
+			},
+		},
+		Middlewares: &config.Middlewares{},
+	}
+	handler := NewHTTPProxy(&config.Config{}, &config.RouteConfig{Routes: []config.Route{route}}, &mockLogger{}).ProxyRequest(route)
+
+	serve := func(cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "http://example.com/api/items", nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := serve(nil)
+	cookies := first.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "/api", cookies[0].Path)
+	assert.True(t, cookies[0].HttpOnly)
+
+	// Pinned requests keep going to the first endpoint without a new cookie
+	for i := 0; i < 4; i++ {
+		rec := serve(cookies[0])
+		assert.Equal(t, first.Body.String(), rec.Body.String())
+		assert.Empty(t, rec.Result().Cookies())
+		assert.Empty(t, rec.Header().Get("X-Saw-Affinity-Cookie"), "the cookie is not forwarded upstream")
+	}
+
+	// Tampered cookies are ignored and replaced
+	tampered := *cookies[0]
+	tampered.Value += "x"
+	assert.Len(t, serve(&tampered).Result().Cookies(), 1)
+}
@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHMACSigner(t *testing.T) {
+	signer := newHMACSigner(&config.HMACSigning{KeyID: "gateway-1", Secret: "shared"})
+	now := time.Unix(1700000000, 0)
+
+	req := httptest.NewRequest(http.MethodPost, "http://orders/internal/orders?dry_run=1", nil)
+	require.NoError(t, signer.Sign(req, []byte(`{"id":7}`), now))
+
+	bodyHash := sha256.Sum256([]byte(`{"id":7}`))
+	mac := hmac.New(sha256.New, []byte("shared"))
+	fmt.Fprintf(mac, "POST\n/internal/orders\ndry_run=1\n1700000000\n%s", hex.EncodeToString(bodyHash[:]))
+
+	assert.Equal(t, hex.EncodeToString(mac.Sum(nil)), req.Header.Get("X-Signature"))
+	assert.Equal(t, "1700000000", req.Header.Get("X-Signature-Timestamp"))
+	assert.Equal(t, "gateway-1", req.Header.Get("X-Signature-Key-Id"))
+
+	custom := newHMACSigner(&config.HMACSigning{Secret: "shared", Algorithm: "sha512", Header: "X-Hub-Signature"})
+	req = httptest.NewRequest(http.MethodGet, "http://orders/", nil)
+	require.NoError(t, custom.Sign(req, nil, now))
+	assert.Len(t, req.Header.Get("X-Hub-Signature"), 128)
+	assert.Empty(t, req.Header.Get("X-Signature-Key-Id"))
+}
+
+func TestProxyRequestWithSigning(t *testing.T) {
+	var received *http.Request
+	var receivedBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received, receivedBody = r, string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	route := config.Route{
+		Path:        "/signed",
+		Upstream:    upstream.URL,
+		StripPrefix: true,
+		Middlewares: &config.Middlewares{},
+		Signing: &config.RequestSigning{
+			Type: config.SigningHMAC,
+			HMAC: &config.HMACSigning{Secret: "shared"},
+		},
+	}
+	proxy := NewHTTPProxy(&config.Config{}, &config.RouteConfig{Routes: []config.Route{route}}, &mockLogger{})
+	handler := proxy.ProxyRequest(route)
+
+	req := httptest.NewRequest(http.MethodPost, "http://gateway/signed/orders", strings.NewReader("payload"))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// The body reaches the upstream intact and the signature covers the rewritten path
+	assert.Equal(t, "payload", receivedBody)
+	bodyHash := sha256.Sum256([]byte("payload"))
+	mac := hmac.New(sha256.New, []byte("shared"))
+	fmt.Fprintf(mac, "POST\n/orders\n\n%s\n%s", received.Header.Get("X-Signature-Timestamp"), hex.EncodeToString(bodyHash[:]))
+	assert.Equal(t, hex.EncodeToString(mac.Sum(nil)), received.Header.Get("X-Signature"))
+}
+
+func TestProxyRequestWithInvalidSigning(t *testing.T) {
+	called := false
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer upstream.Close()
+
+	// Routes skipping validation never send unsigned requests
+	route := config.Route{
+		Path:        "/signed",
+		Upstream:    upstream.URL,
+		Middlewares: &config.Middlewares{},
+		Signing:     &config.RequestSigning{Type: config.SigningHMAC},
+	}
+	proxy := NewHTTPProxy(&config.Config{}, &config.RouteConfig{Routes: []config.Route{route}}, &mockLogger{})
+
+	w := httptest.NewRecorder()
+	proxy.ProxyRequest(route).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://gateway/signed", nil))
+
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.False(t, called)
+}
+
+func TestSigningTransportRejectsOversizedBody(t *testing.T) {
+	transport := &signingTransport{
+		base:      http.DefaultTransport,
+		signer:    newHMACSigner(&config.HMACSigning{Secret: "shared"}),
+		needsBody: true,
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "http://127.0.0.1:1/", io.LimitReader(zeroReader{}, maxSignedBodySize+1))
+	_, err := transport.RoundTrip(req)
+	assert.ErrorIs(t, err, errSignedBodyTooLarge)
+}
+
+// zeroReader yields an endless stream of zero bytes
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
@@ -0,0 +1,331 @@
+package proxy
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"api-gateway/internal/config"
+)
+
+const (
+	sigV4Algorithm     = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat    = "20060102T150405Z"
+	sigV4DateFormat    = "20060102"
+	unsignedPayload    = "UNSIGNED-PAYLOAD"
+	defaultSTSEndpoint = "https://sts.amazonaws.com"
+	// credentialRefreshWindow renews assumed role credentials before they expire
+	credentialRefreshWindow = 5 * time.Minute
+)
+
+// awsCredentials is a set of AWS access keys
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+}
+
+// sigV4Signer signs requests with AWS Signature Version 4
+type sigV4Signer struct {
+	region          string
+	service         string
+	unsignedPayload bool
+
+	base   awsCredentials
+	role   *config.AWSSigV4
+	client *http.Client
+
+	mutex   sync.Mutex
+	current *awsCredentials
+}
+
+// newSigV4Signer creates a SigV4 signer, taking missing static credentials from
+// the standard AWS environment variables
+func newSigV4Signer(cfg *config.AWSSigV4) *sigV4Signer {
+	base := awsCredentials{
+		AccessKeyID:     cfg.AccessKeyID,
+		SecretAccessKey: cfg.SecretAccessKey,
+		SessionToken:    cfg.SessionToken,
+	}
+	if base.AccessKeyID == "" && base.SecretAccessKey == "" {
+		base.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		base.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		base.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+
+	s := &sigV4Signer{
+		region:          cfg.Region,
+		service:         cfg.Service,
+		unsignedPayload: cfg.UnsignedPayload,
+		base:            base,
+		client:          &http.Client{Timeout: 10 * time.Second},
+	}
+	if cfg.RoleARN != "" {
+		s.role = cfg
+	}
+	return s
+}
+
+// Sign adds the SigV4 authorization headers to req
+func (s *sigV4Signer) Sign(req *http.Request, body []byte, now time.Time) error {
+	creds, err := s.credentials(req.Context(), now)
+	if err != nil {
+		return err
+	}
+	signSigV4(req, body, creds, s.region, s.service, s.unsignedPayload, now)
+	return nil
+}
+
+// credentials returns the signing credentials, assuming the configured role if needed
+func (s *sigV4Signer) credentials(ctx context.Context, now time.Time) (*awsCredentials, error) {
+	if s.base.AccessKeyID == "" || s.base.SecretAccessKey == "" {
+		return nil, errors.New("no AWS credentials configured")
+	}
+	if s.role == nil {
+		return &s.base, nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.current != nil && now.Add(credentialRefreshWindow).Before(s.current.Expiration) {
+		return s.current, nil
+	}
+
+	creds, err := s.assumeRole(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	s.current = creds
+	return creds, nil
+}
+
+// assumeRoleResponse is the subset of the STS AssumeRole response we need
+type assumeRoleResponse struct {
+	Credentials struct {
+		AccessKeyID     string    `xml:"AccessKeyId"`
+		SecretAccessKey string    `xml:"SecretAccessKey"`
+		SessionToken    string    `xml:"SessionToken"`
+		Expiration      time.Time `xml:"Expiration"`
+	} `xml:"AssumeRoleResult>Credentials"`
+}
+
+// assumeRole exchanges the base credentials for temporary role credentials through STS
+func (s *sigV4Signer) assumeRole(ctx context.Context, now time.Time) (*awsCredentials, error) {
+	sessionName := s.role.RoleSessionName
+	if sessionName == "" {
+		sessionName = "api-gateway"
+	}
+
+	form := url.Values{}
+	form.Set("Action", "AssumeRole")
+	form.Set("Version", "2011-06-15")
+	form.Set("RoleArn", s.role.RoleARN)
+	form.Set("RoleSessionName", sessionName)
+	if s.role.ExternalID != "" {
+		form.Set("ExternalId", s.role.ExternalID)
+	}
+	body := []byte(form.Encode())
+
+	// The global STS endpoint is signed for us-east-1
+	endpoint, region := s.role.STSEndpoint, s.region
+	if endpoint == "" {
+		endpoint, region = defaultSTSEndpoint, "us-east-1"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(string(body)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	signSigV4(req, body, &s.base, region, "sts", false, now)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("assume role request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("assume role failed with status %d", resp.StatusCode)
+	}
+
+	var parsed assumeRoleResponse
+	if err := xml.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid assume role response: %w", err)
+	}
+	if parsed.Credentials.AccessKeyID == "" {
+		return nil, errors.New("assume role response contained no credentials")
+	}
+
+	return &awsCredentials{
+		AccessKeyID:     parsed.Credentials.AccessKeyID,
+		SecretAccessKey: parsed.Credentials.SecretAccessKey,
+		SessionToken:    parsed.Credentials.SessionToken,
+		Expiration:      parsed.Credentials.Expiration,
+	}, nil
+}
+
+// signSigV4 sets the X-Amz-Date, session token and Authorization headers on req
+func signSigV4(req *http.Request, body []byte, creds *awsCredentials, region, service string, unsigned bool, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format(sigV4TimeFormat)
+	date := now.Format(sigV4DateFormat)
+
+	payloadHash := unsignedPayload
+	if !unsigned {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	if service == "s3" || unsigned {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	canonicalHeaders, signedHeaders := sigV4CanonicalHeaders(req.Header, host)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		sigV4CanonicalURI(req.URL, service),
+		sigV4CanonicalQuery(req.URL),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := sigV4Algorithm + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// sigV4SignedHeaders lists the request headers covered by the signature besides host
+var sigV4SignedHeaders = map[string]bool{
+	"content-type":         true,
+	"content-md5":          true,
+	"x-amz-date":           true,
+	"x-amz-security-token": true,
+	"x-amz-content-sha256": true,
+}
+
+// sigV4CanonicalHeaders returns the canonical header block and signed header list
+func sigV4CanonicalHeaders(header http.Header, host string) (string, string) {
+	values := map[string]string{"host": host}
+	for name, vals := range header {
+		lower := strings.ToLower(name)
+		if !sigV4SignedHeaders[lower] && !strings.HasPrefix(lower, "x-amz-meta-") {
+			continue
+		}
+		trimmed := make([]string, len(vals))
+		for i, v := range vals {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		values[lower] = strings.Join(trimmed, ",")
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name + ":" + values[name] + "\n")
+	}
+	return canonical.String(), strings.Join(names, ";")
+}
+
+// sigV4CanonicalURI encodes the path; services other than S3 expect each
+// segment to be encoded twice
+func sigV4CanonicalURI(u *url.URL, service string) string {
+	path := u.Path
+	if path == "" {
+		return "/"
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		encoded := sigV4Escape(segment)
+		if service != "s3" {
+			encoded = sigV4Escape(encoded)
+		}
+		segments[i] = encoded
+	}
+	return strings.Join(segments, "/")
+}
+
+// sigV4CanonicalQuery returns the query string sorted by key and value
+func sigV4CanonicalQuery(u *url.URL) string {
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, sigV4Escape(key)+"="+sigV4Escape(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// sigV4Escape percent-encodes everything except RFC 3986 unreserved characters
+func sigV4Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// hmacSHA256 computes HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test vectors from the AWS Signature Version 4 test suite and documentation
+func TestSignSigV4(t *testing.T) {
+	creds := &awsCredentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		method        string
+		url           string
+		contentType   string
+		service       string
+		expectedAuthz string
+	}{
+		{
+			name:          "get vanilla",
+			method:        http.MethodGet,
+			url:           "https://example.amazonaws.com/",
+			service:       "service",
+			expectedAuthz: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:          "query parameters are sorted",
+			method:        http.MethodGet,
+			url:           "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			service:       "service",
+			expectedAuthz: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			name:          "iam list users",
+			method:        http.MethodGet,
+			url:           "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08",
+			contentType:   "application/x-www-form-urlencoded; charset=utf-8",
+			service:       "iam",
+			expectedAuthz: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			signSigV4(req, nil, creds, "us-east-1", tt.service, false, now)
+
+			assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+			assert.Equal(t, tt.expectedAuthz, req.Header.Get("Authorization"))
+		})
+	}
+}
+
+func TestSigV4CanonicalURI(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "https://bucket.s3.amazonaws.com/photos/my%20cat.jpg", nil)
+	assert.Equal(t, "/photos/my%20cat.jpg", sigV4CanonicalURI(req.URL, "s3"))
+	assert.Equal(t, "/photos/my%2520cat.jpg", sigV4CanonicalURI(req.URL, "execute-api"))
+}
+
+func TestSigV4SignerSessionAndS3Headers(t *testing.T) {
+	signer := newSigV4Signer(&config.AWSSigV4{
+		Region:          "eu-west-1",
+		Service:         "s3",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		SessionToken:    "session-token",
+	})
+
+	req := httptest.NewRequest(http.MethodPut, "https://bucket.s3.eu-west-1.amazonaws.com/key", nil)
+	require.NoError(t, signer.Sign(req, []byte("hello"), time.Now()))
+
+	assert.Equal(t, "session-token", req.Header.Get("X-Amz-Security-Token"))
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", req.Header.Get("X-Amz-Content-Sha256"))
+	assert.Contains(t, req.Header.Get("Authorization"), "SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token")
+}
+
+func TestSigV4SignerWithoutCredentials(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+
+	signer := newSigV4Signer(&config.AWSSigV4{Region: "us-east-1", Service: "execute-api"})
+	req := httptest.NewRequest(http.MethodGet, "https://api.example.com/", nil)
+	assert.Error(t, signer.Sign(req, nil, time.Now()))
+}
+
+func TestSigV4SignerAssumeRole(t *testing.T) {
+	var calls int32
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "AssumeRole", r.Form.Get("Action"))
+		assert.Equal(t, "arn:aws:iam::123456789012:role/upstream", r.Form.Get("RoleArn"))
+		assert.Equal(t, "gateway", r.Form.Get("RoleSessionName"))
+		assert.Equal(t, "tenant-1", r.Form.Get("ExternalId"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=BASEKEY/"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/eu-west-1/sts/aws4_request")
+
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(`<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>ROLEKEY</AccessKeyId>
+      <SecretAccessKey>role-secret</SecretAccessKey>
+      <SessionToken>role-token</SessionToken>
+      <Expiration>` + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `</Expiration>
+    </Credentials>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`))
+	}))
+	defer sts.Close()
+
+	signer := newSigV4Signer(&config.AWSSigV4{
+		Region:          "eu-west-1",
+		Service:         "execute-api",
+		AccessKeyID:     "BASEKEY",
+		SecretAccessKey: "base-secret",
+		RoleARN:         "arn:aws:iam::123456789012:role/upstream",
+		RoleSessionName: "gateway",
+		ExternalID:      "tenant-1",
+		STSEndpoint:     sts.URL,
+	})
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "https://api.example.com/items", nil)
+		require.NoError(t, signer.Sign(req, nil, time.Now()))
+		assert.True(t, strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=ROLEKEY/"))
+		assert.Equal(t, "role-token", req.Header.Get("X-Amz-Security-Token"))
+	}
+
+	// Role credentials are reused until they are about to expire
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
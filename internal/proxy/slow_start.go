@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"math/rand"
+	"net/url"
+	"time"
+)
+
+// pickSlowStart picks an endpoint in proportion to the endpoints' weights
+// while any of them is ramping, so a new endpoint's share grows from the
+// minimum weight to full over the slow start window. It returns nil when none
+// is ramping, leaving the choice to the strategy.
+func (lb *LoadBalancer) pickSlowStart(endpoints []*url.URL) *url.URL {
+	if lb.config.SlowStart == nil || lb.config.SlowStart.Duration <= 0 || len(endpoints) < 2 {
+		return nil
+	}
+
+	now := time.Now()
+	weights := make([]float64, len(endpoints))
+	total, ramping := 0.0, false
+	for i, endpoint := range endpoints {
+		weights[i] = lb.slowStartWeight(endpoint, now)
+		total += weights[i]
+		ramping = ramping || weights[i] < 1
+	}
+	if !ramping {
+		return nil
+	}
+
+	pick := rand.Float64() * total
+	for i, weight := range weights {
+		if pick < weight {
+			return endpoints[i]
+		}
+		pick -= weight
+	}
+	return endpoints[len(endpoints)-1]
+}
+
+// slowStartWeight returns the current weight of an endpoint between the
+// configured minimum and 1
+func (lb *LoadBalancer) slowStartWeight(endpoint *url.URL, now time.Time) float64 {
+	lb.statsLock.Lock()
+	st, ok := lb.stats[endpoint.String()]
+	var firstSeen time.Time
+	if ok {
+		firstSeen = st.firstSeen
+	}
+	lb.statsLock.Unlock()
+
+	// Endpoints configured at startup are not ramped
+	if firstSeen.IsZero() {
+		return 1
+	}
+
+	window := time.Duration(lb.config.SlowStart.Duration) * time.Second
+	elapsed := now.Sub(firstSeen)
+	if elapsed >= window {
+		return 1
+	}
+
+	minWeight := lb.config.SlowStart.MinWeight
+	return minWeight + (1-minWeight)*float64(elapsed)/float64(window)
+}
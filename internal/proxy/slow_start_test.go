@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlowStartWeight(t *testing.T) {
+	lb, err := NewLoadBalancer(&config.LoadBalancingConfig{
+		Method:    "round_robin",
+		Driver:    "static",
+		Endpoints: []string{"http://existing:8080"},
+		SlowStart: &config.SlowStartConfig{Duration: 60, MinWeight: 0.2},
+	}, &mockLogger{})
+	require.NoError(t, err)
+
+	existing := lb.endpoints[0]
+	added, _ := url.Parse("http://added:8080")
+	lb.SetHealthyEndpoints([]*url.URL{existing, added})
+
+	now := time.Now()
+	assert.Equal(t, 1.0, lb.slowStartWeight(existing, now), "configured endpoints are not ramped")
+	assert.InDelta(t, 0.2, lb.slowStartWeight(added, now), 0.01)
+	assert.InDelta(t, 0.6, lb.slowStartWeight(added, now.Add(30*time.Second)), 0.01)
+	assert.Equal(t, 1.0, lb.slowStartWeight(added, now.Add(time.Minute)))
+}
+
+func TestSlowStartTrafficShare(t *testing.T) {
+	lb, err := NewLoadBalancer(&config.LoadBalancingConfig{
+		Method:    "random",
+		Driver:    "static",
+		Endpoints: []string{"http://existing:8080"},
+		SlowStart: &config.SlowStartConfig{Duration: 600, MinWeight: 0.1},
+	}, &mockLogger{})
+	require.NoError(t, err)
+
+	existing := lb.endpoints[0]
+	added, _ := url.Parse("http://added:8080")
+	lb.SetHealthyEndpoints([]*url.URL{existing, added})
+
+	counts := map[string]int{}
+	for i := 0; i < 2000; i++ {
+		counts[lb.GetEndpoint().String()]++
+	}
+
+	// Roughly 9% instead of 50% while ramping
+	assert.Less(t, counts[added.String()], 300)
+	assert.Greater(t, counts[added.String()], 0)
+}
+
+func TestSlowStartProportionalShares(t *testing.T) {
+	lb, err := NewLoadBalancer(&config.LoadBalancingConfig{
+		Method:    "round_robin",
+		Driver:    "static",
+		Endpoints: []string{"http://existing:8080"},
+		SlowStart: &config.SlowStartConfig{Duration: 600, MinWeight: 0.1},
+	}, &mockLogger{})
+	require.NoError(t, err)
+
+	existing := lb.endpoints[0]
+	earlier, _ := url.Parse("http://earlier:8080")
+	later, _ := url.Parse("http://later:8080")
+	lb.SetHealthyEndpoints([]*url.URL{existing, earlier, later})
+	lb.stats[earlier.String()].firstSeen = time.Now().Add(-5 * time.Minute)
+
+	counts := map[string]int{}
+	for i := 0; i < 8000; i++ {
+		counts[lb.GetEndpoint().String()]++
+	}
+
+	// Weights of 1, 0.55 and 0.1 share the traffic in proportion
+	assert.InDelta(t, 0.606, float64(counts[existing.String()])/8000, 0.03)
+	assert.InDelta(t, 0.333, float64(counts[earlier.String()])/8000, 0.03)
+	assert.InDelta(t, 0.061, float64(counts[later.String()])/8000, 0.02)
+}
+
+func TestSlowStartDisabled(t *testing.T) {
+	lb := &LoadBalancer{config: &config.LoadBalancingConfig{}}
+	a, _ := url.Parse("http://a:8080")
+	b, _ := url.Parse("http://b:8080")
+
+	assert.Nil(t, lb.pickSlowStart([]*url.URL{a, b}))
+}
@@ -0,0 +1,246 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// SOAP envelope namespaces of SOAP 1.1 and 1.2
+const (
+	soap11Namespace = "http://schemas.xmlsoap.org/soap/envelope/"
+	soap12Namespace = "http://www.w3.org/2003/05/soap-envelope"
+)
+
+var (
+	errXMLDTD     = errors.New("XML documents with a DTD are not allowed")
+	errXMLTooDeep = errors.New("XML document is nested too deeply")
+	errXMLNoRoot  = errors.New("XML document has no root element")
+)
+
+// soapRouter checks SOAP and XML requests and sends them to the upstream of
+// the first matching operation, or the route's upstream
+type soapRouter struct {
+	path       string
+	config     *config.SOAPConfig
+	operations []soapOperationHandler
+	fallback   http.Handler
+	log        logger.Logger
+}
+
+// soapOperationHandler is an operation and the proxy to its upstream
+type soapOperationHandler struct {
+	config  config.SOAPOperation
+	name    string
+	handler http.Handler
+}
+
+// proxySOAP proxies a route with SOAP inspection. Operations get their own
+// upstream proxies sharing the route's other settings.
+func (p *HTTPProxy) proxySOAP(route config.Route) http.Handler {
+	fallbackRoute := route
+	fallbackRoute.SOAP = nil
+	router := &soapRouter{
+		path:     route.Path,
+		config:   route.SOAP,
+		fallback: p.ProxyRequest(fallbackRoute),
+		log:      p.log,
+	}
+
+	for i, operation := range route.SOAP.Operations {
+		operationRoute := route
+		operationRoute.SOAP = nil
+		operationRoute.BlueGreen = nil
+		operationRoute.Upstream = operation.Upstream
+		operationRoute.LoadBalancing = operation.LoadBalancing
+
+		name := operation.Name
+		if name == "" {
+			name = fmt.Sprintf("operation_%d", i)
+		}
+		router.operations = append(router.operations, soapOperationHandler{
+			config:  operation,
+			name:    name,
+			handler: p.proxyUpstream(operationRoute),
+		})
+	}
+
+	p.log.Info("Created SOAP router for route",
+		logger.String("path", route.Path),
+		logger.Int("operations", len(route.SOAP.Operations)),
+		logger.Bool("pass_through", route.SOAP.PassThrough),
+	)
+	return router
+}
+
+// ServeHTTP checks the request's content type and body and dispatches it
+func (s *soapRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Requests without a body, such as GET ?wsdl, are passed on as they are
+	if !hasBody(r) {
+		s.dispatch(w, r, soapAction(r), "")
+		return
+	}
+
+	if !isXMLContentType(r.Header.Get("Content-Type")) {
+		s.reject(w, "content_type", "Unsupported content type, expected XML", http.StatusUnsupportedMediaType)
+		return
+	}
+	if r.ContentLength > s.config.MaxBodySize {
+		s.reject(w, "too_large", "Request entity too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Bodies are streamed upstream unread, only capped at the size limit
+	if s.config.PassThrough {
+		r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxBodySize)
+		s.dispatch(w, r, soapAction(r), "")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, s.config.MaxBodySize+1))
+	r.Body.Close()
+	if err != nil {
+		s.reject(w, "read_error", "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	if int64(len(body)) > s.config.MaxBodySize {
+		s.reject(w, "too_large", "Request entity too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	root, err := inspectXML(body, s.config.MaxDepth)
+	if err != nil {
+		s.log.Debug("Rejected XML request",
+			logger.String("path", s.path),
+			logger.Error(err),
+		)
+		reason := "invalid_xml"
+		switch {
+		case errors.Is(err, errXMLDTD):
+			reason = "dtd"
+		case errors.Is(err, errXMLTooDeep):
+			reason = "too_deep"
+		}
+		s.reject(w, reason, "Invalid XML request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	s.dispatch(w, r, soapAction(r), root)
+}
+
+// dispatch proxies the request to the first operation matching the SOAP
+// action and root element
+func (s *soapRouter) dispatch(w http.ResponseWriter, r *http.Request, action, root string) {
+	for _, operation := range s.operations {
+		if operation.config.SOAPAction != "" && operation.config.SOAPAction != action {
+			continue
+		}
+		if operation.config.RootElement != "" && operation.config.RootElement != root {
+			continue
+		}
+		soapRequests.WithLabelValues(s.path, operation.name).Inc()
+		operation.handler.ServeHTTP(w, r)
+		return
+	}
+	soapRequests.WithLabelValues(s.path, "default").Inc()
+	s.fallback.ServeHTTP(w, r)
+}
+
+// reject answers a request failing the SOAP checks
+func (s *soapRouter) reject(w http.ResponseWriter, reason, message string, status int) {
+	soapRejections.WithLabelValues(s.path, reason).Inc()
+	http.Error(w, message, status)
+}
+
+// inspectXML checks that body is a well-formed XML document without a DTD
+// and within maxDepth, and returns the local name of its root element: the
+// first element in the Body of a SOAP envelope, else the document element
+func inspectXML(body []byte, maxDepth int) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = true
+
+	var root string
+	var envelope, inBody bool
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch t := token.(type) {
+		case xml.Directive:
+			// DTDs are where entity expansion attacks are declared
+			if bytes.HasPrefix(bytes.TrimSpace(bytes.ToUpper(t)), []byte("DOCTYPE")) {
+				return "", errXMLDTD
+			}
+		case xml.StartElement:
+			depth++
+			if depth > maxDepth {
+				return "", errXMLTooDeep
+			}
+			isSOAP := t.Name.Space == soap11Namespace || t.Name.Space == soap12Namespace
+			switch {
+			case depth == 1 && t.Name.Local == "Envelope" && isSOAP:
+				envelope = true
+			case depth == 1:
+				root = t.Name.Local
+			case depth == 2 && envelope && t.Name.Local == "Body" && isSOAP:
+				inBody = true
+			case depth == 3 && inBody && root == "":
+				root = t.Name.Local
+			}
+		case xml.EndElement:
+			if depth == 2 {
+				inBody = false
+			}
+			depth--
+		}
+	}
+
+	if root == "" && !envelope {
+		return "", errXMLNoRoot
+	}
+	return root, nil
+}
+
+// soapAction returns the request's SOAP action from the SOAPAction header of
+// SOAP 1.1 or the action parameter of a SOAP 1.2 Content-Type
+func soapAction(r *http.Request) string {
+	if action := r.Header.Get("SOAPAction"); action != "" {
+		return strings.Trim(action, `"`)
+	}
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return params["action"]
+}
+
+// isXMLContentType reports whether contentType is an XML media type such as
+// text/xml, application/xml, application/soap+xml or another +xml type
+func isXMLContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/xml" || mediaType == "application/xml" || strings.HasSuffix(mediaType, "+xml")
+}
+
+// hasBody reports whether a request carries a body
+func hasBody(r *http.Request) bool {
+	return r.ContentLength > 0 || (r.ContentLength < 0 && r.Body != nil && r.Body != http.NoBody)
+}
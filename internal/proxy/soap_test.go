@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const soapGetQuote = `<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Header><auth>token</auth></soap:Header>
+  <soap:Body><m:GetQuote xmlns:m="urn:quotes"><symbol>ACME</symbol></m:GetQuote></soap:Body>
+</soap:Envelope>`
+
+// newSOAPUpstream answers with its name and the request body it received
+func newSOAPUpstream(t *testing.T, name string) *httptest.Server {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Upstream", name)
+		w.Write(body)
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+func newSOAPProxy(t *testing.T, soap *config.SOAPConfig, upstream string) http.Handler {
+	if soap.MaxBodySize == 0 {
+		soap.MaxBodySize = 1 << 20
+	}
+	if soap.MaxDepth == 0 {
+		soap.MaxDepth = 64
+	}
+	route := config.Route{Path: "/soap", Upstream: upstream, SOAP: soap, Middlewares: &config.Middlewares{}}
+	p := NewHTTPProxy(&config.Config{}, &config.RouteConfig{Routes: []config.Route{route}}, &mockLogger{})
+	return p.ProxyRequest(route)
+}
+
+func soapRequest(body, contentType, action string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/soap", strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if action != "" {
+		req.Header.Set("SOAPAction", action)
+	}
+	return req
+}
+
+func TestSOAPRouting(t *testing.T) {
+	legacy := newSOAPUpstream(t, "legacy")
+	quotes := newSOAPUpstream(t, "quotes")
+	orders := newSOAPUpstream(t, "orders")
+	handler := newSOAPProxy(t, &config.SOAPConfig{
+		Enabled: true,
+		Operations: []config.SOAPOperation{
+			{Name: "orders", SOAPAction: "urn:orders#Place", Upstream: orders.URL},
+			{Name: "quotes", RootElement: "GetQuote", Upstream: quotes.URL},
+		},
+	}, legacy.URL)
+
+	tests := []struct {
+		name     string
+		req      *http.Request
+		upstream string
+	}{
+		{"root element in SOAP body", soapRequest(soapGetQuote, "text/xml; charset=utf-8", ""), "quotes"},
+		{"quoted SOAPAction header", soapRequest(soapGetQuote, "text/xml", `"urn:orders#Place"`), "orders"},
+		{"SOAP 1.2 action parameter", soapRequest(`<PlaceOrder/>`, `application/soap+xml; action="urn:orders#Place"`, ""), "orders"},
+		{"plain XML root element", soapRequest(`<GetQuote><symbol>ACME</symbol></GetQuote>`, "application/xml", ""), "quotes"},
+		{"unmatched operation", soapRequest(`<GetHistory/>`, "text/xml", "urn:quotes#History"), "legacy"},
+		{"request without body", httptest.NewRequest(http.MethodGet, "/soap?wsdl", nil), "legacy"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, tc.req)
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+			assert.Equal(t, tc.upstream, rec.Header().Get("X-Upstream"))
+		})
+	}
+
+	// The inspected body reaches the upstream unchanged
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, soapRequest(soapGetQuote, "text/xml", ""))
+	assert.Equal(t, soapGetQuote, rec.Body.String())
+}
+
+func TestSOAPProtections(t *testing.T) {
+	upstream := newSOAPUpstream(t, "service")
+	handler := newSOAPProxy(t, &config.SOAPConfig{Enabled: true, MaxBodySize: 512, MaxDepth: 4}, upstream.URL)
+
+	billionLaughs := `<?xml version="1.0"?>
+<!DOCTYPE lolz [<!ENTITY lol "lol"><!ENTITY lol2 "&lol;&lol;&lol;&lol;">]>
+<lolz>&lol2;</lolz>`
+
+	tests := []struct {
+		name   string
+		req    *http.Request
+		status int
+	}{
+		{"JSON body", soapRequest(`{"symbol":"ACME"}`, "application/json", ""), http.StatusUnsupportedMediaType},
+		{"missing content type", soapRequest(`<a/>`, "", ""), http.StatusUnsupportedMediaType},
+		{"entity expansion", soapRequest(billionLaughs, "text/xml", ""), http.StatusBadRequest},
+		{"undeclared entity", soapRequest(`<a>&ext;</a>`, "text/xml", ""), http.StatusBadRequest},
+		{"too deep", soapRequest(`<a><b><c><d><e/></d></c></b></a>`, "text/xml", ""), http.StatusBadRequest},
+		{"malformed", soapRequest(`<a><b></a>`, "text/xml", ""), http.StatusBadRequest},
+		{"too large", soapRequest("<a>"+strings.Repeat("x", 600)+"</a>", "text/xml", ""), http.StatusRequestEntityTooLarge},
+		{"within limits", soapRequest(`<a><b><c><d/></c></b></a>`, "text/xml", ""), http.StatusOK},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, tc.req)
+			assert.Equal(t, tc.status, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestSOAPPassThrough(t *testing.T) {
+	legacy := newSOAPUpstream(t, "legacy")
+	orders := newSOAPUpstream(t, "orders")
+	handler := newSOAPProxy(t, &config.SOAPConfig{
+		Enabled:     true,
+		PassThrough: true,
+		MaxBodySize: 64,
+		Operations:  []config.SOAPOperation{{SOAPAction: "urn:orders#Place", Upstream: orders.URL}},
+	}, legacy.URL)
+
+	// Bodies are forwarded without parsing, malformed or not
+	body := `<not-well-formed>`
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, soapRequest(body, "text/xml", "urn:orders#Place"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "orders", rec.Header().Get("X-Upstream"))
+	assert.Equal(t, body, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, soapRequest(body, "text/xml", ""))
+	assert.Equal(t, "legacy", rec.Header().Get("X-Upstream"))
+
+	// Content type and size are still checked
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, soapRequest(body, "application/json", ""))
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, soapRequest(strings.Repeat("x", 100), "text/xml", ""))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
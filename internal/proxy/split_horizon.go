@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// Network zones of split-horizon clients
+const (
+	zoneInternal = "internal"
+	zoneExternal = "external"
+)
+
+// internalListenerKey marks the context of requests received on the
+// internal listener
+type internalListenerKey struct{}
+
+// WithInternalListener returns a copy of ctx marking its requests as received
+// on the internal listener
+func WithInternalListener(ctx context.Context) context.Context {
+	return context.WithValue(ctx, internalListenerKey{}, true)
+}
+
+// fromInternalListener reports whether a request was received on the
+// internal listener
+func fromInternalListener(ctx context.Context) bool {
+	internal, _ := ctx.Value(internalListenerKey{}).(bool)
+	return internal
+}
+
+// splitHorizonRouter sends internal clients to the route's internal upstream
+// and the others to its upstream
+type splitHorizonRouter struct {
+	path     string
+	prefixes []netip.Prefix
+	internal http.Handler
+	external http.Handler
+}
+
+// proxySplitHorizon proxies a route with split-horizon upstreams. Reloads
+// only change the upstream of external clients.
+func (p *HTTPProxy) proxySplitHorizon(route config.Route) http.Handler {
+	prefixes, err := p.config.NetworkZones.Prefixes()
+	if err != nil {
+		// Only the internal listener is trusted without valid ranges
+		p.log.Error("Invalid network zones, sending clients outside the internal listener to the external upstream",
+			logger.String("path", route.Path),
+			logger.Error(err),
+		)
+	}
+
+	externalRoute := route
+	externalRoute.SplitHorizon = nil
+	internalRoute := externalRoute
+	internalRoute.Upstream = route.SplitHorizon.Upstream
+	internalRoute.LoadBalancing = route.SplitHorizon.LoadBalancing
+
+	p.log.Info("Created split-horizon upstreams for route",
+		logger.String("path", route.Path),
+		logger.String("internal_upstream", route.SplitHorizon.Upstream),
+		logger.Int("internal_cidrs", len(prefixes)),
+	)
+	return &splitHorizonRouter{
+		path:     route.Path,
+		prefixes: prefixes,
+		internal: p.proxyUpstream(internalRoute),
+		external: p.ProxyRequest(externalRoute),
+	}
+}
+
+// ServeHTTP proxies the request to the upstream of the client's zone
+func (s *splitHorizonRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	zone := s.zone(r)
+	splitHorizonRequests.WithLabelValues(s.path, zone).Inc()
+	if zone == zoneInternal {
+		s.internal.ServeHTTP(w, r)
+		return
+	}
+	s.external.ServeHTTP(w, r)
+}
+
+// zone classifies the client by the listener the request arrived on, then
+// the address of its connection
+func (s *splitHorizonRouter) zone(r *http.Request) string {
+	if fromInternalListener(r.Context()) {
+		return zoneInternal
+	}
+	if addr, err := netip.ParseAddr(peerIP(r)); err == nil {
+		addr = addr.Unmap()
+		for _, prefix := range s.prefixes {
+			if prefix.Contains(addr) {
+				return zoneInternal
+			}
+		}
+	}
+	return zoneExternal
+}
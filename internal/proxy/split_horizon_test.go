@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"api-gateway/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitHorizon(t *testing.T) {
+	public := newSOAPUpstream(t, "public")
+	private := newSOAPUpstream(t, "private")
+	route := config.Route{
+		Path:         "/horizon",
+		Upstream:     public.URL,
+		SplitHorizon: &config.SplitHorizon{Upstream: private.URL},
+		Middlewares:  &config.Middlewares{},
+	}
+	cfg := &config.Config{NetworkZones: config.NetworkZonesConfig{InternalCIDRs: []string{"10.0.0.0/8"}}}
+	handler := NewHTTPProxy(cfg, &config.RouteConfig{Routes: []config.Route{route}}, &mockLogger{}).ProxyRequest(route)
+
+	upstream := func(r *http.Request) string {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec.Header().Get("X-Upstream")
+	}
+	request := func(remoteAddr string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/horizon", nil)
+		req.RemoteAddr = remoteAddr
+		return req
+	}
+
+	internal := testutil.ToFloat64(splitHorizonRequests.WithLabelValues("/horizon", zoneInternal))
+	assert.Equal(t, "private", upstream(request("10.1.2.3:41000")))
+	assert.Equal(t, "private", upstream(request("[::ffff:10.1.2.3]:41000")))
+	assert.Equal(t, internal+2, testutil.ToFloat64(splitHorizonRequests.WithLabelValues("/horizon", zoneInternal)))
+
+	// Forwarding headers don't make a client internal
+	forwarded := request("203.0.113.9:41000")
+	forwarded.Header.Set("X-Forwarded-For", "10.1.2.3")
+	assert.Equal(t, "public", upstream(forwarded))
+
+	// Requests on the internal listener are internal wherever they come from
+	listener := request("203.0.113.9:41000")
+	listener = listener.WithContext(WithInternalListener(listener.Context()))
+	assert.Equal(t, "private", upstream(listener))
+}
+
+func TestSplitHorizonInvalidZones(t *testing.T) {
+	public := newSOAPUpstream(t, "public")
+	private := newSOAPUpstream(t, "private")
+	route := config.Route{
+		Path:         "/horizon-invalid",
+		Upstream:     public.URL,
+		SplitHorizon: &config.SplitHorizon{Upstream: private.URL},
+		Middlewares:  &config.Middlewares{},
+	}
+	cfg := &config.Config{NetworkZones: config.NetworkZonesConfig{InternalCIDRs: []string{"10.0.0.0/8", "not-a-cidr"}}}
+	handler := NewHTTPProxy(cfg, &config.RouteConfig{Routes: []config.Route{route}}, &mockLogger{}).ProxyRequest(route)
+
+	// Without valid ranges only the internal listener is internal
+	req := httptest.NewRequest(http.MethodGet, "/horizon-invalid", nil)
+	req.RemoteAddr = "10.1.2.3:41000"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, "public", rec.Header().Get("X-Upstream"))
+
+	req = httptest.NewRequest(http.MethodGet, "/horizon-invalid", nil)
+	req = req.WithContext(WithInternalListener(req.Context()))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, "private", rec.Header().Get("X-Upstream"))
+}
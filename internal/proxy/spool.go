@@ -0,0 +1,222 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync/atomic"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// Errors receiving spooled request bodies
+var (
+	errSpoolTooLarge = errors.New("request body exceeds the spool's max_body_size")
+	errSpoolFull     = errors.New("request spool reached its max_disk_usage")
+	errSpoolDisk     = errors.New("failed to write request spool")
+)
+
+// requestSpool receives request bodies in full before passing the requests
+// on, so the upstream isn't kept waiting on slow clients
+type requestSpool struct {
+	path   string
+	config *config.SpoolConfig
+	next   http.Handler
+	log    logger.Logger
+	usage  atomic.Int64 // Bytes of bodies on disk
+}
+
+// spooledBody is a received request body, in memory or in a spool file
+type spooledBody struct {
+	spool *requestSpool
+	data  []byte
+	file  *os.File
+	size  int64
+}
+
+// proxySpooled proxies a route after spooling request bodies
+func (p *HTTPProxy) proxySpooled(route config.Route) http.Handler {
+	if route.Spool.Directory != "" {
+		if err := os.MkdirAll(route.Spool.Directory, 0o700); err != nil {
+			p.log.Error("Failed to create request spool directory",
+				logger.String("path", route.Path),
+				logger.String("directory", route.Spool.Directory),
+				logger.Error(err),
+			)
+		}
+	}
+
+	spooledRoute := route
+	spooledRoute.Spool = nil
+	p.log.Info("Spooling request bodies for route",
+		logger.String("path", route.Path),
+		logger.String("directory", route.Spool.Directory),
+		logger.Int("max_body_size", int(route.Spool.MaxBodySize)),
+		logger.Int("max_disk_usage", int(route.Spool.MaxDiskUsage)),
+	)
+	return &requestSpool{
+		path:   route.Path,
+		config: route.Spool,
+		next:   p.ProxyRequest(spooledRoute),
+		log:    p.log,
+	}
+}
+
+// ServeHTTP receives the request body and proxies the request with it
+func (s *requestSpool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !hasBody(r) {
+		s.next.ServeHTTP(w, r)
+		return
+	}
+	if r.ContentLength > s.config.MaxBodySize {
+		s.reject(w, r, errSpoolTooLarge)
+		return
+	}
+
+	body, err := s.receive(r)
+	if err != nil {
+		s.reject(w, r, err)
+		return
+	}
+	defer body.release()
+
+	result := "memory"
+	if body.file != nil {
+		result = "disk"
+	}
+	spooledRequests.WithLabelValues(s.path, result).Inc()
+
+	// The body is sent whole, so retries can send it again
+	r.Body = body.reader()
+	r.GetBody = func() (io.ReadCloser, error) {
+		return body.reader(), nil
+	}
+	r.ContentLength = body.size
+	r.TransferEncoding = nil
+	r.Header.Del("Expect")
+	s.next.ServeHTTP(w, r)
+}
+
+// receive reads the request body into memory up to the memory threshold, and
+// into a spool file past it
+func (s *requestSpool) receive(r *http.Request) (*spooledBody, error) {
+	defer r.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, s.config.MemoryThreshold+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > s.config.MaxBodySize {
+		return nil, errSpoolTooLarge
+	}
+	if int64(len(data)) <= s.config.MemoryThreshold {
+		return &spooledBody{spool: s, data: data, size: int64(len(data))}, nil
+	}
+
+	file, err := os.CreateTemp(s.config.Directory, "request-*.spool")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errSpoolDisk, err)
+	}
+	body := &spooledBody{spool: s, file: file}
+	if _, err := body.Write(data); err != nil {
+		body.release()
+		return nil, err
+	}
+	_, err = io.Copy(body, io.LimitReader(r.Body, s.config.MaxBodySize-body.size+1))
+	if err == nil && body.size > s.config.MaxBodySize {
+		err = errSpoolTooLarge
+	}
+	if err != nil {
+		body.release()
+		return nil, err
+	}
+	return body, nil
+}
+
+// reject answers a request whose body couldn't be received
+func (s *requestSpool) reject(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, errSpoolTooLarge), errors.As(err, &maxBytesErr):
+		spooledRequests.WithLabelValues(s.path, "too_large").Inc()
+		http.Error(w, "Request entity too large", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, errSpoolFull):
+		spooledRequests.WithLabelValues(s.path, "disk_full").Inc()
+		s.log.Warn("Rejected request with the request spool full",
+			logger.String("path", s.path),
+			logger.Int("max_disk_usage", int(s.config.MaxDiskUsage)),
+		)
+		http.Error(w, "Insufficient storage", http.StatusInsufficientStorage)
+	case errors.Is(err, errSpoolDisk):
+		spooledRequests.WithLabelValues(s.path, "failed").Inc()
+		s.log.Error("Failed to spool request body",
+			logger.String("path", s.path),
+			logger.Error(err),
+		)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	default:
+		// The client went away or stalled
+		spooledRequests.WithLabelValues(s.path, "incomplete").Inc()
+		s.log.Debug("Failed to receive request body",
+			logger.String("path", s.path),
+			logger.String("remote_addr", r.RemoteAddr),
+			logger.Error(err),
+		)
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+	}
+}
+
+// reserve accounts for bytes written to or removed from disk, failing if
+// they would take the spool past its disk usage limit
+func (s *requestSpool) reserve(n int64) bool {
+	usage := s.usage.Add(n)
+	if n > 0 && s.config.MaxDiskUsage > 0 && usage > s.config.MaxDiskUsage {
+		s.usage.Add(-n)
+		return false
+	}
+	spoolDiskBytes.WithLabelValues(s.path).Add(float64(n))
+	return true
+}
+
+// Write appends to the spool file within the spool's disk usage limit
+func (b *spooledBody) Write(p []byte) (int, error) {
+	if !b.spool.reserve(int64(len(p))) {
+		return 0, errSpoolFull
+	}
+	n, err := b.file.Write(p)
+	b.size += int64(n)
+	if n < len(p) {
+		b.spool.reserve(int64(n - len(p)))
+	}
+	if err != nil {
+		return n, fmt.Errorf("%w: %v", errSpoolDisk, err)
+	}
+	return n, nil
+}
+
+// reader returns a reader of the whole body
+func (b *spooledBody) reader() io.ReadCloser {
+	if b.file == nil {
+		return io.NopCloser(bytes.NewReader(b.data))
+	}
+	return io.NopCloser(io.NewSectionReader(b.file, 0, b.size))
+}
+
+// release removes the spool file
+func (b *spooledBody) release() {
+	if b.file == nil {
+		return
+	}
+	b.file.Close()
+	if err := os.Remove(b.file.Name()); err != nil {
+		b.spool.log.Error("Failed to remove request spool file",
+			logger.String("file", b.file.Name()),
+			logger.Error(err),
+		)
+	}
+	b.spool.reserve(-b.size)
+}
@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSpoolProxy proxies a spooling route to an upstream echoing the body it
+// received with its Content-Length
+func newSpoolProxy(t *testing.T, spool *config.SpoolConfig) (http.Handler, *atomic.Int32) {
+	var requests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Content-Length", strconv.FormatInt(r.ContentLength, 10))
+		w.Write(body)
+	}))
+	t.Cleanup(upstream.Close)
+
+	spool.Enabled = true
+	spool.Directory = t.TempDir()
+	route := config.Route{Path: "/uploads", Upstream: upstream.URL, Spool: spool, Middlewares: &config.Middlewares{}}
+	p := NewHTTPProxy(&config.Config{}, &config.RouteConfig{Routes: []config.Route{route}}, &mockLogger{})
+	return p.ProxyRequest(route), &requests
+}
+
+// upload sends a body of unknown length
+func upload(handler http.Handler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/uploads", io.NopCloser(strings.NewReader(body)))
+	req.ContentLength = -1
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSpoolBodies(t *testing.T) {
+	spool := &config.SpoolConfig{MaxBodySize: 1 << 20, MemoryThreshold: 16}
+	handler, _ := newSpoolProxy(t, spool)
+
+	memory := testutil.ToFloat64(spooledRequests.WithLabelValues("/uploads", "memory"))
+	rec := upload(handler, "small")
+	assert.Equal(t, "small", rec.Body.String())
+	assert.Equal(t, "5", rec.Header().Get("X-Content-Length"))
+	assert.Equal(t, memory+1, testutil.ToFloat64(spooledRequests.WithLabelValues("/uploads", "memory")))
+
+	disk := testutil.ToFloat64(spooledRequests.WithLabelValues("/uploads", "disk"))
+	large := strings.Repeat("0123456789", 10000)
+	rec = upload(handler, large)
+	assert.Equal(t, large, rec.Body.String())
+	assert.Equal(t, "100000", rec.Header().Get("X-Content-Length"))
+	assert.Equal(t, disk+1, testutil.ToFloat64(spooledRequests.WithLabelValues("/uploads", "disk")))
+
+	// Spool files are removed once the request is done
+	files, err := os.ReadDir(spool.Directory)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+	assert.Equal(t, 0.0, testutil.ToFloat64(spoolDiskBytes.WithLabelValues("/uploads")))
+}
+
+func TestSpoolWaitsForWholeBody(t *testing.T) {
+	handler, requests := newSpoolProxy(t, &config.SpoolConfig{MaxBodySize: 1 << 20, MemoryThreshold: 4})
+
+	reader, writer := io.Pipe()
+	req := httptest.NewRequest(http.MethodPost, "/uploads", reader)
+	req.ContentLength = -1
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(rec, req)
+		close(done)
+	}()
+
+	writer.Write([]byte("first part, "))
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(0), requests.Load())
+
+	writer.Write([]byte("second part"))
+	writer.Close()
+	<-done
+	assert.Equal(t, int32(1), requests.Load())
+	assert.Equal(t, "first part, second part", rec.Body.String())
+}
+
+func TestSpoolLimits(t *testing.T) {
+	handler, _ := newSpoolProxy(t, &config.SpoolConfig{MaxBodySize: 64, MemoryThreshold: 8})
+
+	req := httptest.NewRequest(http.MethodPost, "/uploads", strings.NewReader(strings.Repeat("x", 65)))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, upload(handler, strings.Repeat("x", 65)).Code)
+
+	handler, requests := newSpoolProxy(t, &config.SpoolConfig{MaxBodySize: 64, MaxDiskUsage: 32, MemoryThreshold: 8})
+	full := testutil.ToFloat64(spooledRequests.WithLabelValues("/uploads", "disk_full"))
+	assert.Equal(t, http.StatusInsufficientStorage, upload(handler, strings.Repeat("x", 40)).Code)
+	assert.Equal(t, full+1, testutil.ToFloat64(spooledRequests.WithLabelValues("/uploads", "disk_full")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(spoolDiskBytes.WithLabelValues("/uploads")))
+
+	assert.Equal(t, http.StatusOK, upload(handler, strings.Repeat("x", 32)).Code)
+	assert.Equal(t, int32(1), requests.Load())
+}
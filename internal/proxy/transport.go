@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+
+	netproxy "golang.org/x/net/proxy"
+)
+
+// newTransport builds the upstream transport for a route
+func (p *HTTPProxy) newTransport(route config.Route) *http.Transport {
+	dialCfg := p.config.Dial.Merge(route.Dial)
+
+	// Start from the default transport for its TLS handshake timeout and
+	// HTTP/2 support
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ExpectContinueTimeout = 1 * time.Second
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 100
+	transport.IdleConnTimeout = 90 * time.Second
+	transport.Proxy = nil // Only upstream_proxy sends requests through a proxy
+
+	// Set timeouts
+	if route.Timeout > 0 {
+		transport.ResponseHeaderTimeout = time.Duration(route.Timeout) * time.Second
+	}
+
+	// Resolve upstream hosts through the caching resolver if configured
+	var lookup func(ctx context.Context, host string) ([]string, error)
+	if p.resolver != nil {
+		lookup = p.resolver.LookupHost
+	}
+
+	upstreamDialer, err := newUpstreamDialer(dialCfg, lookup)
+	if err != nil {
+		// Connecting without the configured source address or interface could
+		// reach upstreams from the wrong network, so requests are refused
+		p.log.Error("Invalid dial configuration, refusing requests",
+			logger.String("path", route.Path),
+			logger.Error(err),
+		)
+		dialErr := fmt.Errorf("invalid dial configuration: %w", err)
+		transport.DialContext = func(context.Context, string, string) (net.Conn, error) {
+			return nil, dialErr
+		}
+		return transport
+	}
+	upstreamDialer.failures = p.connectFailures
+	transport.DialContext = upstreamDialer.DialContext
+
+	// Authenticate with the gateway's SVID to upstreams in the service mesh
+	if route.UpstreamSPIFFEID != "" {
+		if p.spiffe != nil {
+			transport.TLSClientConfig = p.spiffe.ClientTLSConfig(route.UpstreamSPIFFEID)
+		} else {
+			p.log.Error("Route sets upstream_spiffe_id but SPIFFE is disabled",
+				logger.String("path", route.Path),
+			)
+		}
+	}
+
+	// Present the configured server name to upstreams behind shared ingresses
+	if serverName := route.UpstreamServerName(); serverName != "" {
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.ServerName = serverName
+	}
+
+	// Route traffic through a forward proxy if configured
+	if route.UpstreamProxy != "" {
+		if err := applyUpstreamProxy(transport, route.UpstreamProxy, upstreamDialer); err != nil {
+			// The upstream may only be reachable or allowed through the proxy,
+			// so requests are refused rather than sent directly
+			p.log.Error("Invalid upstream proxy, refusing requests",
+				logger.String("path", route.Path),
+				logger.Error(err),
+			)
+			proxyErr := fmt.Errorf("invalid upstream proxy: %w", err)
+			transport.DialContext = func(context.Context, string, string) (net.Conn, error) {
+				return nil, proxyErr
+			}
+		} else {
+			p.log.Info("Using upstream proxy for route",
+				logger.String("path", route.Path),
+				logger.String("proxy", redactProxyURL(route.UpstreamProxy)),
+			)
+		}
+	}
+
+	return transport
+}
+
+// applyUpstreamProxy configures the transport to reach upstreams through an
+// HTTP(S) or SOCKS5 forward proxy; credentials are taken from the URL userinfo
+func applyUpstreamProxy(transport *http.Transport, rawURL string, forward *upstreamDialer) error {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https":
+		// The transport sends Proxy-Authorization from the URL userinfo
+		transport.Proxy = http.ProxyURL(proxyURL)
+	case "socks5", "socks5h":
+		dialer, err := netproxy.FromURL(proxyURL, forward)
+		if err != nil {
+			return err
+		}
+		contextDialer, ok := dialer.(netproxy.ContextDialer)
+		if !ok {
+			return fmt.Errorf("SOCKS dialer does not support contexts")
+		}
+		transport.DialContext = contextDialer.DialContext
+	default:
+		return fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+
+	return nil
+}
+
+// redactProxyURL strips credentials from a proxy URL for logging
+func redactProxyURL(rawURL string) string {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return proxyURL.Redacted()
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+)
+
+// Reasons of upstream errors in the gateway_upstream_errors_total metric
+const (
+	upstreamErrorTimeout           = "timeout"
+	upstreamErrorConnectionRefused = "connection_refused"
+	upstreamErrorConnectionReset   = "connection_reset"
+	upstreamErrorDNS               = "dns"
+	upstreamErrorCanceled          = "canceled"
+	upstreamErrorBodyTooLarge      = "body_too_large"
+	upstreamErrorOther             = "other"
+	upstreamErrorCircuitOpen       = "circuit_open"
+	upstreamErrorConnectCached     = "connect_failure_cached"
+)
+
+// classifyUpstreamError returns the status and message answering a request
+// that failed with err, and the reason to count it under. Timeouts get 504,
+// so clients and dashboards can tell a slow upstream from one that is down,
+// which gets 502. 503 is left to the gateway refusing to try the upstream.
+func classifyUpstreamError(err error) (int, string, string) {
+	var dnsErr *net.DNSError
+	switch {
+	case errors.Is(err, errConnectFailureCached):
+		// The gateway didn't try an upstream that just failed to connect
+		return http.StatusServiceUnavailable, "Service unavailable", upstreamErrorConnectCached
+	case isTimeout(err):
+		return http.StatusGatewayTimeout, "Gateway timeout", upstreamErrorTimeout
+	case errors.Is(err, errCompatBodyTooLarge):
+		return http.StatusRequestEntityTooLarge, "Request entity too large", upstreamErrorBodyTooLarge
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return http.StatusBadGateway, "Bad gateway", upstreamErrorConnectionRefused
+	case errors.Is(err, syscall.ECONNRESET):
+		return http.StatusBadGateway, "Bad gateway", upstreamErrorConnectionReset
+	case errors.As(err, &dnsErr):
+		return http.StatusBadGateway, "Bad gateway", upstreamErrorDNS
+	case errors.Is(err, context.Canceled):
+		return http.StatusBadGateway, "Bad gateway", upstreamErrorCanceled
+	}
+	return http.StatusBadGateway, "Bad gateway", upstreamErrorOther
+}
+
+// countUpstreamError records a request the gateway answered with status
+// because of an upstream failure
+func countUpstreamError(route string, status int, reason string) {
+	upstreamErrors.WithLabelValues(route, strconv.Itoa(status), reason).Inc()
+}
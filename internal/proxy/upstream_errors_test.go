@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyUpstreamError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		reason string
+	}{
+		{"deadline", context.DeadlineExceeded, http.StatusGatewayTimeout, upstreamErrorTimeout},
+		{"body idle timeout", errBodyIdleTimeout, http.StatusGatewayTimeout, upstreamErrorTimeout},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, http.StatusBadGateway, upstreamErrorConnectionRefused},
+		{"connection reset", &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, http.StatusBadGateway, upstreamErrorConnectionReset},
+		{"unknown host", &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "orders", IsNotFound: true}}, http.StatusBadGateway, upstreamErrorDNS},
+		{"client gone", context.Canceled, http.StatusBadGateway, upstreamErrorCanceled},
+		{"buffer limit", errCompatBodyTooLarge, http.StatusRequestEntityTooLarge, upstreamErrorBodyTooLarge},
+		{"other", errors.New("unexpected EOF"), http.StatusBadGateway, upstreamErrorOther},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			status, _, reason := classifyUpstreamError(tc.err)
+			assert.Equal(t, tc.status, status)
+			assert.Equal(t, tc.reason, reason)
+		})
+	}
+}
+
+func TestUpstreamErrorResponses(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	down := "http://" + listener.Addr().String()
+	listener.Close()
+
+	routes := []config.Route{
+		{Path: "/errors/slow", Upstream: slow.URL, Middlewares: &config.Middlewares{}},
+		{Path: "/errors/down", Upstream: down, Middlewares: &config.Middlewares{CircuitBreaker: &config.CircuitBreakerSettings{
+			Enabled: true, Threshold: 1, Timeout: 30,
+		}}},
+	}
+	p := NewHTTPProxy(&config.Config{}, &config.RouteConfig{Routes: routes}, &mockLogger{})
+
+	// A timed out upstream gets 504
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	rec := httptest.NewRecorder()
+	p.ProxyRequest(routes[0]).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/errors/slow", nil).WithContext(ctx))
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	assert.Equal(t, 1.0, testutil.ToFloat64(upstreamErrors.WithLabelValues("/errors/slow", "504", upstreamErrorTimeout)))
+
+	// A refused connection gets 502 and opens the breaker
+	handler := p.ProxyRequest(routes[1])
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/errors/down", nil))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Equal(t, 1.0, testutil.ToFloat64(upstreamErrors.WithLabelValues("/errors/down", "502", upstreamErrorConnectionRefused)))
+
+	// The open breaker answers 503 with the time left until it probes again
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/errors/down", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+	require.NoError(t, err)
+	assert.InDelta(t, 30, retryAfter, 1)
+	assert.Equal(t, 1.0, testutil.ToFloat64(upstreamErrors.WithLabelValues("/errors/down", "503", upstreamErrorCircuitOpen)))
+}
@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// reloadableUpstream proxies a route to an upstream that can be replaced by a
+// config reload. After a change the new upstream's error rate is watched for
+// the bake window and the previous upstream is restored if it spikes.
+type reloadableUpstream struct {
+	path    string
+	alerter *rollbackAlerter
+	log     logger.Logger
+
+	mutex       sync.Mutex
+	route       config.Route
+	handler     http.Handler
+	previous    *config.Route
+	prevHandler http.Handler
+	generation  int
+	bake        bakeWindow
+	now         func() time.Time
+}
+
+// newReloadableUpstream wraps the proxy handler of a route
+func newReloadableUpstream(route config.Route, handler http.Handler, guard *config.RollbackGuard, alerter *rollbackAlerter, log logger.Logger) *reloadableUpstream {
+	return &reloadableUpstream{
+		path:    route.Path,
+		alerter: alerter,
+		log:     log,
+		route:   route,
+		handler: handler,
+		bake:    bakeWindow{guard: guard},
+		now:     time.Now,
+	}
+}
+
+// ServeHTTP proxies the request to the current upstream
+func (u *reloadableUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.mutex.Lock()
+	handler := u.handler
+	generation := u.generation
+	baking := u.bake.open(u.now())
+	u.mutex.Unlock()
+
+	if !baking {
+		handler.ServeHTTP(w, r)
+		return
+	}
+
+	crw := &customResponseWriter{ResponseWriter: w}
+	handler.ServeHTTP(crw, r)
+	u.record(generation, crw.statusCode >= http.StatusInternalServerError)
+}
+
+// current returns the route the upstream is currently built from
+func (u *reloadableUpstream) current() config.Route {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.route
+}
+
+// update replaces the upstream, keeping the current one to roll back to
+func (u *reloadableUpstream) update(route config.Route, handler http.Handler) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	previous := u.route
+	u.previous, u.prevHandler = &previous, u.handler
+	u.route, u.handler = route, handler
+	u.generation++
+	u.bake.start(u.now())
+
+	u.log.Info("Reloaded route upstream",
+		logger.String("path", u.path),
+		logger.String("upstream", describeUpstream(route)),
+		logger.String("previous", describeUpstream(previous)),
+	)
+}
+
+// record counts a response served while baking and restores the previous
+// upstream once the error rate exceeds the limit
+func (u *reloadableUpstream) record(generation int, failed bool) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	// Ignore responses from before a newer change
+	if generation != u.generation || !u.bake.open(u.now()) {
+		return
+	}
+	errorRate, exceeded := u.bake.record(failed)
+	if !exceeded {
+		return
+	}
+
+	from, to := describeUpstream(u.route), describeUpstream(*u.previous)
+	u.log.Error("Rolling back upstream change after error spike",
+		logger.String("path", u.path),
+		logger.String("from", from),
+		logger.String("to", to),
+		logger.Any("error_rate", errorRate),
+		logger.Int("requests", u.bake.total),
+	)
+	upstreamRollbacks.WithLabelValues(u.path).Inc()
+	u.alerter.send(rollbackAlert{
+		Event:     "upstream_rollback",
+		Path:      u.path,
+		From:      from,
+		To:        to,
+		ErrorRate: errorRate,
+		Requests:  u.bake.total,
+		Time:      u.now(),
+	})
+
+	u.route, u.handler = *u.previous, u.prevHandler
+	u.previous, u.prevHandler = nil, nil
+	u.generation++
+	u.bake.stop()
+}
+
+// describeUpstream names the upstream of a route for logs and alerts
+func describeUpstream(route config.Route) string {
+	if route.LoadBalancing != nil && len(route.LoadBalancing.Endpoints) > 0 {
+		return strings.Join(route.LoadBalancing.Endpoints, ",")
+	}
+	return route.Upstream
+}
@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateUpstreamsRollsBackOnErrors(t *testing.T) {
+	newUpstream := func(name string, status int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte(name))
+		}))
+	}
+	v1, v2, v3 := newUpstream("v1", http.StatusOK), newUpstream("v2", http.StatusOK), newUpstream("v3", http.StatusBadGateway)
+	defer v1.Close()
+	defer v2.Close()
+	defer v3.Close()
+
+	alerts := make(chan rollbackAlert, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert rollbackAlert
+		json.NewDecoder(r.Body).Decode(&alert)
+		alerts <- alert
+	}))
+	defer webhook.Close()
+
+	cfg := &config.Config{Reload: config.ReloadConfig{
+		Enabled: true,
+		Rollback: config.RollbackGuard{
+			Enabled:      true,
+			BakeWindow:   60,
+			MaxErrorRate: 50,
+			MinRequests:  4,
+		},
+		AlertWebhook:     webhook.URL,
+		WebhookTimeoutMs: 1000,
+	}}
+	route := config.Route{Path: "/orders", Upstream: v1.URL, Middlewares: &config.Middlewares{}}
+	p := NewHTTPProxy(cfg, &config.RouteConfig{Routes: []config.Route{route}}, &mockLogger{})
+	handler := p.ProxyRequest(route)
+
+	serve := func() string {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "http://example.com/orders", nil))
+		return rec.Body.String()
+	}
+	assert.Equal(t, "v1", serve())
+
+	// Unchanged and unknown routes are left alone
+	assert.Empty(t, p.UpdateUpstreams([]config.Route{route, {Path: "/other", Upstream: v2.URL}}))
+
+	// A healthy new upstream stays in place
+	route.Upstream = v2.URL
+	assert.Equal(t, []string{"/orders"}, p.UpdateUpstreams([]config.Route{route}))
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, "v2", serve())
+	}
+
+	// A failing one is rolled back once enough requests were seen
+	route.Upstream = v3.URL
+	assert.Equal(t, []string{"/orders"}, p.UpdateUpstreams([]config.Route{route}))
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, "v3", serve())
+	}
+	assert.Equal(t, "v2", serve())
+
+	select {
+	case alert := <-alerts:
+		assert.Equal(t, "upstream_rollback", alert.Event)
+		assert.Equal(t, "/orders", alert.Path)
+		assert.Equal(t, v3.URL, alert.From)
+		assert.Equal(t, v2.URL, alert.To)
+		assert.Equal(t, 4, alert.Requests)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no rollback alert sent")
+	}
+}
+
+func TestProxyRequestWithoutReload(t *testing.T) {
+	route := config.Route{Path: "/orders", Upstream: "http://localhost:1", Middlewares: &config.Middlewares{}}
+	p := NewHTTPProxy(&config.Config{}, &config.RouteConfig{Routes: []config.Route{route}}, &mockLogger{})
+	p.ProxyRequest(route)
+
+	require.Empty(t, p.upstreams)
+	assert.Empty(t, p.UpdateUpstreams([]config.Route{{Path: "/orders", Upstream: "http://localhost:2"}}))
+}
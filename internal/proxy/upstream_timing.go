@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// UpstreamTiming adds up the time spent waiting for upstream response
+// headers while serving one client request, over all of its attempts
+type UpstreamTiming struct {
+	mutex    sync.Mutex
+	duration time.Duration
+	calls    int
+}
+
+type upstreamTimingKey struct{}
+
+// WithUpstreamTiming returns a context that records how long upstreams take
+// to answer the request
+func WithUpstreamTiming(ctx context.Context) (context.Context, *UpstreamTiming) {
+	timing := &UpstreamTiming{}
+	return context.WithValue(ctx, upstreamTimingKey{}, timing), timing
+}
+
+// upstreamTimingFromContext returns the timing recorded for the request, if tracked
+func upstreamTimingFromContext(ctx context.Context) *UpstreamTiming {
+	timing, _ := ctx.Value(upstreamTimingKey{}).(*UpstreamTiming)
+	return timing
+}
+
+// Duration returns the total upstream time, and false if no upstream was called
+func (t *UpstreamTiming) Duration() (time.Duration, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.duration, t.calls > 0
+}
+
+// add records an upstream call taking d
+func (t *UpstreamTiming) add(d time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.duration += d
+	t.calls++
+}
+
+// timingTransport records the time until upstream response headers arrive
+// on requests whose context tracks upstream timing
+type timingTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip times the round trip of requests that track upstream timing
+func (t *timingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	timing := upstreamTimingFromContext(req.Context())
+	if timing == nil {
+		return t.base.RoundTrip(req)
+	}
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	timing.add(time.Since(start))
+	return resp, err
+}
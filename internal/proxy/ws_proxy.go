@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net/http"
@@ -117,8 +118,12 @@ func (p *WSProxy) ProxyWebSocket(route config.Route) http.Handler {
 			}
 		}
 
-		headers.Set("Host", upstreamURL.Host)
-		headers.Set("Origin", fmt.Sprintf("%s://%s", upstreamURL.Scheme, upstreamURL.Host))
+		host := upstreamURL.Host
+		if route.UpstreamHostHeader != "" {
+			host = route.UpstreamHostHeader
+		}
+		headers.Set("Host", host)
+		headers.Set("Origin", fmt.Sprintf("%s://%s", upstreamURL.Scheme, host))
 
 		// Extract the real client IP
 		clientIP := util.GetClientIP(r)
@@ -129,22 +134,9 @@ func (p *WSProxy) ProxyWebSocket(route config.Route) http.Handler {
 			logger.String("xrip_header", r.Header.Get("X-Real-IP")),
 		)
 
-		// Add custom headers to preserve client IP information
+		// Pass the client address, host, protocol and port upstream
+		newForwardedHeaders(&p.config.ForwardedHeaders).apply(headers, r)
 		if clientIP != "" {
-			// For X-Forwarded-For, handle existing chains properly
-			if xffHeader := r.Header.Get("X-Forwarded-For"); xffHeader != "" {
-				// Keep existing chain but only if clientIP is not already there
-				// to avoid duplicating the client IP
-				if !strings.HasPrefix(xffHeader, clientIP+",") && xffHeader != clientIP {
-					headers.Set("X-Forwarded-For", xffHeader)
-					p.log.Debug("Preserved X-Forwarded-For header", logger.String("value", xffHeader))
-				}
-			} else {
-				// No existing chain, just set the client IP
-				headers.Set("X-Forwarded-For", clientIP)
-				p.log.Debug("Set X-Forwarded-For header", logger.String("value", clientIP))
-			}
-
 			// Always set X-Real-IP to the original client IP
 			headers.Set("X-Real-IP", clientIP)
 			p.log.Debug("Set X-Real-IP header", logger.String("value", clientIP))
@@ -162,7 +154,6 @@ func (p *WSProxy) ProxyWebSocket(route config.Route) http.Handler {
 				logger.String("ip", clientIP))
 		}
 
-		headers.Set("X-Forwarded-Host", r.Host)
 		headers.Set("X-Gateway-Proxy", "true")
 
 		// Check for token in URL query parameters and add it to the headers if present
@@ -177,7 +168,13 @@ func (p *WSProxy) ProxyWebSocket(route config.Route) http.Handler {
 		p.log.Debug("Connecting to upstream WebSocket",
 			logger.String("url", wsURL.String()),
 		)
-		upstreamConn, _, err := websocket.DefaultDialer.Dial(wsURL.String(), headers)
+		dialer := websocket.DefaultDialer
+		if serverName := route.UpstreamServerName(); serverName != "" {
+			withSNI := *websocket.DefaultDialer
+			withSNI.TLSClientConfig = &tls.Config{ServerName: serverName}
+			dialer = &withSNI
+		}
+		upstreamConn, _, err := dialer.Dial(wsURL.String(), headers)
 		if err != nil {
 			p.log.Error("Failed to connect to upstream WebSocket", logger.Error(err))
 			clientConn.WriteMessage(websocket.CloseMessage,
@@ -0,0 +1,311 @@
+package server
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/notify"
+	"api-gateway/pkg/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// certificateExpiryDays is the days until the earliest certificate of
+	// each monitored file expires
+	certificateExpiryDays = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_certificate_expiry_days",
+			Help: "Days until the earliest certificate in a configured certificate file expires",
+		},
+		[]string{"name", "file"},
+	)
+)
+
+func init() {
+	// Register metrics with Prometheus
+	prometheus.MustRegister(certificateExpiryDays)
+}
+
+// monitoredFile is a configured certificate file
+type monitoredFile struct {
+	name string
+	path string
+}
+
+// certificateInfo describes a monitored certificate for /admin/certificates
+type certificateInfo struct {
+	Name          string     `json:"name"`
+	File          string     `json:"file"`
+	Subject       string     `json:"subject,omitempty"`
+	Issuer        string     `json:"issuer,omitempty"`
+	SerialNumber  string     `json:"serial_number,omitempty"`
+	SANs          []string   `json:"sans,omitempty"`
+	NotBefore     *time.Time `json:"not_before,omitempty"`
+	NotAfter      *time.Time `json:"not_after,omitempty"`
+	DaysRemaining int        `json:"days_remaining"`
+	Error         string     `json:"error,omitempty"`
+}
+
+// certMonitor checks the expiry of the configured certificates periodically.
+// It logs a warning, and sends a certificate_expiring notification, the first
+// time a certificate is checked within each warning threshold.
+type certMonitor struct {
+	config   *config.CertificatesConfig
+	files    []monitoredFile
+	notifier *notify.Notifier
+	log      logger.Logger
+
+	mutex        sync.Mutex
+	certificates []certificateInfo
+	warned       map[string]int // Lowest threshold warned at, by file and serial number
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// newCertMonitor creates a monitor of the server certificate and the etcd
+// client certificate and CA, or nil if none is configured
+func newCertMonitor(cfg *config.Config, notifier *notify.Notifier, log logger.Logger) *certMonitor {
+	var files []monitoredFile
+	if cfg.Security.TLS.Enabled && cfg.Security.TLS.CertFile != "" {
+		files = append(files, monitoredFile{name: "server", path: cfg.Security.TLS.CertFile})
+	}
+	if cfg.Etcd.TLS.Enabled && cfg.Etcd.TLS.CertFile != "" {
+		files = append(files, monitoredFile{name: "etcd_client", path: cfg.Etcd.TLS.CertFile})
+	}
+	if cfg.Etcd.TLS.Enabled && cfg.Etcd.TLS.CAFile != "" {
+		files = append(files, monitoredFile{name: "etcd_ca", path: cfg.Etcd.TLS.CAFile})
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	return &certMonitor{
+		config:   &cfg.Certificates,
+		files:    files,
+		notifier: notifier,
+		log:      log,
+		warned:   make(map[string]int),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start checks the certificates now and then every check interval
+func (m *certMonitor) Start() {
+	m.check(time.Now())
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(time.Duration(m.config.CheckInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				m.check(now)
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the periodic checks
+func (m *certMonitor) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.stop)
+		<-m.done
+	})
+}
+
+// check reads the certificate files, updating the gauges and the listing and
+// warning about certificates that passed a threshold
+func (m *certMonitor) check(now time.Time) {
+	var infos []certificateInfo
+	for _, file := range m.files {
+		certs, err := readCertificates(file.path)
+		if err != nil {
+			m.log.Error("Failed to read certificate",
+				logger.String("name", file.name),
+				logger.String("file", file.path),
+				logger.Error(err),
+			)
+			infos = append(infos, certificateInfo{Name: file.name, File: file.path, Error: err.Error()})
+			continue
+		}
+
+		earliest := certs[0].NotAfter
+		for _, cert := range certs {
+			if cert.NotAfter.Before(earliest) {
+				earliest = cert.NotAfter
+			}
+			info := describeCertificate(file, cert, now)
+			infos = append(infos, info)
+			m.warn(info, now)
+		}
+		certificateExpiryDays.WithLabelValues(file.name, file.path).Set(earliest.Sub(now).Hours() / 24)
+	}
+
+	m.mutex.Lock()
+	m.certificates = infos
+	m.mutex.Unlock()
+}
+
+// warn logs and notifies the first check of a certificate within each
+// threshold. Expired certificates are reported once as errors.
+func (m *certMonitor) warn(info certificateInfo, now time.Time) {
+	remaining := info.NotAfter.Sub(now)
+	threshold := -1
+	if remaining <= 0 {
+		threshold = 0
+	} else {
+		for _, days := range m.config.WarningDays {
+			if remaining <= time.Duration(days)*24*time.Hour && (threshold < 0 || days < threshold) {
+				threshold = days
+			}
+		}
+	}
+	if threshold < 0 {
+		return
+	}
+
+	key := info.File + "\x00" + info.SerialNumber
+	m.mutex.Lock()
+	warned, ok := m.warned[key]
+	if ok && warned <= threshold {
+		m.mutex.Unlock()
+		return
+	}
+	m.warned[key] = threshold
+	m.mutex.Unlock()
+
+	message := fmt.Sprintf("Certificate %s expires in %d days", info.Subject, info.DaysRemaining)
+	if threshold == 0 {
+		message = fmt.Sprintf("Certificate %s has expired", info.Subject)
+		m.log.Error("Certificate has expired",
+			logger.String("name", info.Name),
+			logger.String("file", info.File),
+			logger.String("subject", info.Subject),
+			logger.String("not_after", info.NotAfter.Format(time.RFC3339)),
+		)
+	} else {
+		m.log.Warn("Certificate expires soon",
+			logger.String("name", info.Name),
+			logger.String("file", info.File),
+			logger.String("subject", info.Subject),
+			logger.Int("days_remaining", info.DaysRemaining),
+			logger.String("not_after", info.NotAfter.Format(time.RFC3339)),
+		)
+	}
+	m.notifier.Notify(notify.Event{
+		Type:    config.EventCertificateExpiring,
+		Subject: fmt.Sprintf("%s (%s)", info.Subject, info.File),
+		Message: message,
+		Time:    now,
+		Details: map[string]string{
+			"name":           info.Name,
+			"file":           info.File,
+			"not_after":      info.NotAfter.Format(time.RFC3339),
+			"days_remaining": strconv.Itoa(info.DaysRemaining),
+		},
+	})
+}
+
+// list returns the certificates of the last check, soonest to expire first
+func (m *certMonitor) list() []certificateInfo {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	certificates := append([]certificateInfo(nil), m.certificates...)
+	sort.SliceStable(certificates, func(i, j int) bool {
+		if certificates[i].NotAfter == nil || certificates[j].NotAfter == nil {
+			return certificates[i].NotAfter == nil && certificates[j].NotAfter != nil
+		}
+		return certificates[i].NotAfter.Before(*certificates[j].NotAfter)
+	})
+	return certificates
+}
+
+// certificatesHandler lists the monitored certificates as JSON. Files that
+// could not be read are listed first with their error.
+func (s *Server) certificatesHandler(w http.ResponseWriter, r *http.Request) {
+	certificates := []certificateInfo{}
+	if s.certMonitor != nil {
+		certificates = append(certificates, s.certMonitor.list()...)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"certificates": certificates,
+	})
+}
+
+// describeCertificate returns the listing of a certificate
+func describeCertificate(file monitoredFile, cert *x509.Certificate, now time.Time) certificateInfo {
+	var sans []string
+	for _, name := range cert.DNSNames {
+		sans = append(sans, "DNS:"+name)
+	}
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, "IP:"+ip.String())
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, "URI:"+uri.String())
+	}
+	for _, email := range cert.EmailAddresses {
+		sans = append(sans, "email:"+email)
+	}
+
+	notBefore, notAfter := cert.NotBefore.UTC(), cert.NotAfter.UTC()
+	return certificateInfo{
+		Name:          file.name,
+		File:          file.path,
+		Subject:       cert.Subject.String(),
+		Issuer:        cert.Issuer.String(),
+		SerialNumber:  cert.SerialNumber.String(),
+		SANs:          sans,
+		NotBefore:     &notBefore,
+		NotAfter:      &notAfter,
+		DaysRemaining: int(math.Floor(cert.NotAfter.Sub(now).Hours() / 24)),
+	}
+}
+
+// readCertificates parses the certificates of a PEM file
+func readCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate found")
+	}
+	return certs, nil
+}
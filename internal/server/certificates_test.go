@@ -0,0 +1,129 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/notify"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCertificate writes a self-signed certificate expiring at notAfter
+func writeTestCertificate(t *testing.T, serial int64, notAfter time.Time) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	spiffe, _ := url.Parse("spiffe://example.org/gateway")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "gateway.example.com"},
+		DNSNames:     []string{"gateway.example.com"},
+		IPAddresses:  []net.IP{net.ParseIP("10.0.0.1")},
+		URIs:         []*url.URL{spiffe},
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "server.crt")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644))
+	return path
+}
+
+func TestCertMonitor(t *testing.T) {
+	var mutex sync.Mutex
+	var events []map[string]interface{}
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&event)
+		mutex.Lock()
+		events = append(events, event)
+		mutex.Unlock()
+	}))
+	defer webhook.Close()
+
+	now := time.Now()
+	cfg := &config.Config{
+		Notifications: config.NotificationsConfig{
+			Enabled:     true,
+			Webhooks:    []config.NotificationWebhook{{URL: webhook.URL}},
+			DedupWindow: 300,
+			TimeoutMs:   1000,
+		},
+		Certificates: config.CertificatesConfig{CheckInterval: 3600, WarningDays: []int{30, 14, 7}},
+	}
+	cfg.Security.TLS.Enabled = true
+	cfg.Security.TLS.CertFile = writeTestCertificate(t, 1, now.Add(20*24*time.Hour+time.Hour))
+	cfg.Etcd.TLS.Enabled = true
+	cfg.Etcd.TLS.CAFile = filepath.Join(t.TempDir(), "missing.crt")
+
+	notifier := notify.New(&cfg.Notifications, &mockLogger{})
+	notifier.Start()
+	monitor := newCertMonitor(cfg, notifier, &mockLogger{})
+	require.NotNil(t, monitor)
+
+	// Within 30 days the certificate is reported once
+	monitor.check(now)
+	monitor.check(now.Add(time.Hour))
+	assert.InDelta(t, 20, testutil.ToFloat64(certificateExpiryDays.WithLabelValues("server", cfg.Security.TLS.CertFile)), 0.1)
+
+	// Passing the next threshold reports it again
+	monitor.check(now.Add(7 * 24 * time.Hour))
+	notifier.Stop()
+
+	mutex.Lock()
+	require.Len(t, events, 2)
+	assert.Equal(t, config.EventCertificateExpiring, events[0]["event"])
+	assert.Equal(t, "Certificate CN=gateway.example.com expires in 20 days", events[0]["message"])
+	assert.Equal(t, "Certificate CN=gateway.example.com expires in 13 days", events[1]["message"])
+	mutex.Unlock()
+
+	// Unreadable files are listed first with their error
+	s := &Server{certMonitor: monitor}
+	rec := httptest.NewRecorder()
+	s.certificatesHandler(rec, httptest.NewRequest(http.MethodGet, "/admin/certificates", nil))
+	var body struct {
+		Certificates []certificateInfo `json:"certificates"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Len(t, body.Certificates, 2)
+	assert.Equal(t, "etcd_ca", body.Certificates[0].Name)
+	assert.NotEmpty(t, body.Certificates[0].Error)
+
+	server := body.Certificates[1]
+	assert.Equal(t, "server", server.Name)
+	assert.Equal(t, "CN=gateway.example.com", server.Subject)
+	assert.Equal(t, []string{"DNS:gateway.example.com", "IP:10.0.0.1", "URI:spiffe://example.org/gateway"}, server.SANs)
+	assert.Equal(t, 13, server.DaysRemaining)
+	assert.NotNil(t, server.NotAfter)
+}
+
+func TestNewCertMonitorWithoutCertificates(t *testing.T) {
+	assert.Nil(t, newCertMonitor(&config.Config{}, nil, &mockLogger{}))
+}
+
+func TestReadCertificatesRejectsFilesWithoutCertificates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.key")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("key")}), 0o644))
+	_, err := readCertificates(path)
+	assert.EqualError(t, err, "no certificate found")
+}
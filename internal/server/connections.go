@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// clientConnections counts open client connections by state
+	clientConnections = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_client_connections",
+			Help: "Open client connections by state",
+		},
+		[]string{"state"},
+	)
+
+	// clientConnectionAge tracks how long client connections stay open
+	clientConnectionAge = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "gateway_client_connection_age_seconds",
+			Help:    "Lifetime of closed client connections",
+			Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600},
+		},
+	)
+
+	// clientConnectionRequests tracks how many requests each connection served
+	clientConnectionRequests = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "gateway_client_connection_requests",
+			Help:    "Requests served per closed client connection",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+		},
+	)
+
+	// clientConnectionsRecycled counts connections closed by the keep-alive limits
+	clientConnectionsRecycled = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_client_connections_recycled_total",
+			Help: "Client connections closed by the keep-alive limits, by limit",
+		},
+		[]string{"reason"},
+	)
+)
+
+func init() {
+	// Register metrics with Prometheus
+	prometheus.MustRegister(clientConnections, clientConnectionAge, clientConnectionRequests, clientConnectionsRecycled)
+}
+
+// clientConnKey is the context key of a request's client connection
+type clientConnKey struct{}
+
+// clientConn is the state of one client connection
+type clientConn struct {
+	state    http.ConnState
+	opened   time.Time
+	requests atomic.Int64
+	recycled atomic.Bool
+}
+
+// connTracker counts client connections by state through http.Server.ConnState
+// and enforces the keep-alive limits
+type connTracker struct {
+	mutex    sync.Mutex
+	conns    map[net.Conn]*clientConn
+	accepted uint64
+
+	maxRequests int64
+	maxAge      time.Duration
+	now         func() time.Time
+}
+
+// newConnTracker creates an empty connection tracker
+func newConnTracker(cfg *config.KeepAliveConfig) *connTracker {
+	return &connTracker{
+		conns:       make(map[net.Conn]*clientConn),
+		maxRequests: int64(cfg.MaxRequests),
+		maxAge:      time.Duration(cfg.MaxAge) * time.Second,
+		now:         time.Now,
+	}
+}
+
+// connContext adds the connection's state to the context of its requests
+// through http.Server.ConnContext, which runs before the connection is new
+func (c *connTracker) connContext(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, clientConnKey{}, c.conn(conn))
+}
+
+// conn returns the state of a connection, tracking it if it is new
+func (c *connTracker) conn(conn net.Conn) *clientConn {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	state, ok := c.conns[conn]
+	if !ok {
+		state = &clientConn{state: http.StateNew, opened: c.now()}
+		c.conns[conn] = state
+	}
+	return state
+}
+
+// track records a connection state change
+func (c *connTracker) track(conn net.Conn, state http.ConnState) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	current, ok := c.conns[conn]
+	if !ok && state != http.StateNew {
+		return
+	}
+	if state == http.StateNew {
+		if !ok {
+			current = &clientConn{state: http.StateNew, opened: c.now()}
+			c.conns[conn] = current
+		}
+		c.accepted++
+		clientConnections.WithLabelValues(current.state.String()).Inc()
+		return
+	}
+
+	clientConnections.WithLabelValues(current.state.String()).Dec()
+	switch state {
+	case http.StateClosed, http.StateHijacked:
+		delete(c.conns, conn)
+		clientConnectionAge.Observe(c.now().Sub(current.opened).Seconds())
+		clientConnectionRequests.Observe(float64(current.requests.Load()))
+	default:
+		current.state = state
+		clientConnections.WithLabelValues(state.String()).Inc()
+	}
+}
+
+// snapshot returns the number of open connections per state
+func (c *connTracker) snapshot() map[string]uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	counts := map[string]uint64{
+		"open":     uint64(len(c.conns)),
+		"active":   0,
+		"idle":     0,
+		"accepted": c.accepted,
+	}
+	for _, conn := range c.conns {
+		switch conn.state {
+		case http.StateActive:
+			counts["active"]++
+		case http.StateIdle:
+			counts["idle"]++
+		}
+	}
+	return counts
+}
+
+// limitKeepAlive counts the requests of each connection and asks the server
+// to close connections past the keep-alive limits once the response is sent.
+// HTTP/2 connections are sent a GOAWAY instead.
+func (c *connTracker) limitKeepAlive(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, ok := r.Context().Value(clientConnKey{}).(*clientConn)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		requests := conn.requests.Add(1)
+		reason := ""
+		switch {
+		case c.maxRequests > 0 && requests >= c.maxRequests:
+			reason = "max_requests"
+		case c.maxAge > 0 && c.now().Sub(conn.opened) >= c.maxAge:
+			reason = "max_age"
+		}
+		if reason != "" {
+			w.Header().Set("Connection", "close")
+			if conn.recycled.CompareAndSwap(false, true) {
+				clientConnectionsRecycled.WithLabelValues(reason).Inc()
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
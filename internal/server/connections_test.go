@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnTracker(t *testing.T) {
+	tracker := newConnTracker(&config.KeepAliveConfig{})
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	tracker.track(a, http.StateNew)
+	tracker.track(b, http.StateNew)
+	tracker.track(a, http.StateActive)
+	tracker.track(b, http.StateActive)
+	tracker.track(b, http.StateIdle)
+	assert.Equal(t, map[string]uint64{"open": 2, "active": 1, "idle": 1, "accepted": 2}, tracker.snapshot())
+
+	tracker.track(a, http.StateClosed)
+	tracker.track(b, http.StateHijacked)
+	assert.Equal(t, map[string]uint64{"open": 0, "active": 0, "idle": 0, "accepted": 2}, tracker.snapshot())
+
+	// Closing an untracked connection is ignored
+	tracker.track(a, http.StateClosed)
+	assert.Equal(t, uint64(0), tracker.snapshot()["open"])
+}
+
+func TestLimitKeepAlive(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	serve := func(tracker *connTracker, ctx context.Context) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		tracker.limitKeepAlive(next).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+		return rec
+	}
+
+	t.Run("max requests", func(t *testing.T) {
+		tracker := newConnTracker(&config.KeepAliveConfig{MaxRequests: 3})
+		conn, _ := net.Pipe()
+		defer conn.Close()
+		ctx := tracker.connContext(context.Background(), conn)
+
+		assert.Empty(t, serve(tracker, ctx).Header().Get("Connection"))
+		assert.Empty(t, serve(tracker, ctx).Header().Get("Connection"))
+		assert.Equal(t, "close", serve(tracker, ctx).Header().Get("Connection"))
+	})
+
+	t.Run("max age", func(t *testing.T) {
+		tracker := newConnTracker(&config.KeepAliveConfig{MaxAge: 60})
+		now := time.Now()
+		tracker.now = func() time.Time { return now }
+		conn, _ := net.Pipe()
+		defer conn.Close()
+		ctx := tracker.connContext(context.Background(), conn)
+
+		assert.Empty(t, serve(tracker, ctx).Header().Get("Connection"))
+		now = now.Add(time.Minute)
+		assert.Equal(t, "close", serve(tracker, ctx).Header().Get("Connection"))
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		tracker := newConnTracker(&config.KeepAliveConfig{})
+		conn, _ := net.Pipe()
+		defer conn.Close()
+		ctx := tracker.connContext(context.Background(), conn)
+
+		for i := 0; i < 10; i++ {
+			assert.Empty(t, serve(tracker, ctx).Header().Get("Connection"))
+		}
+		tracker.track(conn, http.StateNew)
+		tracker.track(conn, http.StateClosed)
+		assert.Equal(t, uint64(1), tracker.snapshot()["accepted"])
+	})
+}
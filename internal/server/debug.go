@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"time"
+
+	"api-gateway/internal/auth"
+	"api-gateway/pkg/logger"
+)
+
+// registerDebugEndpoints registers the runtime stats and pprof endpoints behind
+// admin authentication
+func (s *Server) registerDebugEndpoints() {
+	if !s.config.Debug.Enabled {
+		return
+	}
+
+	s.router.Handle("/debug/runtime", s.requireAdmin(http.HandlerFunc(s.runtimeStatsHandler))).Methods("GET")
+
+	if s.config.Debug.Pprof {
+		s.router.Handle("/debug/pprof/cmdline", s.requireAdmin(http.HandlerFunc(pprof.Cmdline)))
+		s.router.Handle("/debug/pprof/profile", s.requireAdmin(http.HandlerFunc(pprof.Profile)))
+		s.router.Handle("/debug/pprof/symbol", s.requireAdmin(http.HandlerFunc(pprof.Symbol)))
+		s.router.Handle("/debug/pprof/trace", s.requireAdmin(http.HandlerFunc(pprof.Trace)))
+		s.router.PathPrefix("/debug/pprof/").Handler(s.requireAdmin(http.HandlerFunc(pprof.Index)))
+	}
+
+	s.log.Info("Registered debug endpoints",
+		logger.String("path", "/debug/"),
+		logger.Bool("pprof", s.config.Debug.Pprof),
+	)
+}
+
+// requireAdmin only lets requests authenticated with one of the debug allowed
+// roles through
+func (s *Server) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.authorizeAdmin(w, r) != nil {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// authorizeAdmin returns the identity of a caller with one of the debug
+// allowed roles, or writes the error response and returns nil
+func (s *Server) authorizeAdmin(w http.ResponseWriter, r *http.Request) *auth.Identity {
+	if s.authService == nil {
+		http.Error(w, "Authentication unavailable", http.StatusServiceUnavailable)
+		return nil
+	}
+
+	identity, err := s.authService.Authenticate(r, nil, nil)
+	if err != nil {
+		if errors.Is(err, auth.ErrNoToken) {
+			http.Error(w, "Authorization required", http.StatusUnauthorized)
+		} else {
+			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		}
+		return nil
+	}
+
+	for _, role := range s.config.Debug.AllowedRoles {
+		if identity.Role == role {
+			return identity
+		}
+	}
+
+	s.log.Warn("Rejected admin endpoint request",
+		logger.String("path", r.URL.Path),
+		logger.String("subject", identity.Subject),
+		logger.String("role", identity.Role),
+	)
+	http.Error(w, "Forbidden: Insufficient permissions", http.StatusForbidden)
+	return nil
+}
+
+// runtimeStatsHandler reports goroutine, memory, GC, file descriptor and
+// connection statistics
+func (s *Server) runtimeStatsHandler(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	// The most recent GC pauses, newest first
+	pauses := make([]float64, 0, 10)
+	for i := 0; i < 10 && uint32(i) < mem.NumGC; i++ {
+		pause := mem.PauseNs[(mem.NumGC-1-uint32(i))%uint32(len(mem.PauseNs))]
+		pauses = append(pauses, float64(pause)/float64(time.Millisecond))
+	}
+
+	stats := map[string]interface{}{
+		"time":       time.Now().Format(time.RFC3339),
+		"goroutines": runtime.NumGoroutine(),
+		"cpus":       runtime.NumCPU(),
+		"go_version": runtime.Version(),
+		"heap": map[string]uint64{
+			"alloc_bytes":    mem.HeapAlloc,
+			"inuse_bytes":    mem.HeapInuse,
+			"idle_bytes":     mem.HeapIdle,
+			"released_bytes": mem.HeapReleased,
+			"objects":        mem.HeapObjects,
+			"sys_bytes":      mem.Sys,
+		},
+		"gc": map[string]interface{}{
+			"count":              mem.NumGC,
+			"pause_total_ms":     float64(mem.PauseTotalNs) / float64(time.Millisecond),
+			"recent_pauses_ms":   pauses,
+			"last_gc":            time.Unix(0, int64(mem.LastGC)).Format(time.RFC3339),
+			"next_gc_heap_bytes": mem.NextGC,
+		},
+	}
+
+	if fds, err := openFileDescriptors(); err == nil {
+		stats["open_fds"] = fds
+	}
+	if s.connections != nil {
+		stats["connections"] = s.connections.snapshot()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// openFileDescriptors counts the process's open file descriptors where /proc is available
+func openFileDescriptors() (int, error) {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
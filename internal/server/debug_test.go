@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/config"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func debugToken(t *testing.T, role string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &auth.JWTClaims{
+		Role: role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "operator",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	signed, err := token.SignedString([]byte("debug-secret"))
+	require.NoError(t, err)
+	return "Bearer " + signed
+}
+
+func TestDebugEndpoints(t *testing.T) {
+	authCfg := &config.AuthConfig{JWTSecret: "debug-secret", JWTHeader: "Authorization", APIKeyHeader: "X-API-Key"}
+	s := &Server{
+		router:      mux.NewRouter(),
+		log:         &mockLogger{},
+		authService: auth.NewAuthService(authCfg, &mockLogger{}),
+		connections: newConnTracker(&config.KeepAliveConfig{}),
+		config: &config.Config{
+			Debug: config.DebugConfig{Enabled: true, Pprof: true, AllowedRoles: []string{"admin"}},
+		},
+	}
+	s.registerUtilityEndpoints()
+
+	get := func(path, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("requires authentication", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, get("/debug/runtime", "").Code)
+		assert.Equal(t, http.StatusUnauthorized, get("/debug/pprof/", "Bearer nope").Code)
+	})
+
+	t.Run("requires an allowed role", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, get("/debug/runtime", debugToken(t, "user")).Code)
+	})
+
+	t.Run("runtime stats", func(t *testing.T) {
+		rec := get("/debug/runtime", debugToken(t, "admin"))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var stats map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+		assert.Greater(t, stats["goroutines"], float64(0))
+		assert.Contains(t, stats, "heap")
+		assert.Contains(t, stats, "gc")
+		assert.Contains(t, stats, "connections")
+	})
+
+	t.Run("pprof", func(t *testing.T) {
+		rec := get("/debug/pprof/", debugToken(t, "admin"))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "goroutine")
+
+		rec = get("/debug/pprof/heap?debug=1", debugToken(t, "admin"))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
+
+func TestDebugEndpoints_Disabled(t *testing.T) {
+	s := &Server{router: mux.NewRouter(), log: &mockLogger{}, config: &config.Config{}}
+	s.registerDebugEndpoints()
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/runtime", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestRouteDiffHandler(t *testing.T) {
+	routes, err := config.ParseRoutes([]byte("routes:\n  - path: \"/users\"\n    upstream: \"http://users:8080\"\n"))
+	require.NoError(t, err)
+	s := &Server{log: &mockLogger{}, config: &config.Config{}, routes: routes}
+
+	post := func(body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		rec := httptest.NewRecorder()
+		s.routeDiffHandler(rec, httptest.NewRequest("POST", "/admin/routes/diff", strings.NewReader(body)))
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+		return rec, result
+	}
+
+	rec, result := post("routes:\n  - path: \"/users\"\n    upstream: \"http://users-v2:8080\"\n  - path: \"/orders\"\n    upstream: \"http://orders:8080\"\n")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, true, result["valid"])
+	assert.Equal(t, true, result["changed"])
+	diff := result["diff"].(map[string]interface{})
+	assert.Equal(t, []interface{}{"/orders"}, diff["added"])
+	assert.Len(t, diff["modified"], 1)
+	assert.Nil(t, result["deprecations"])
+
+	// Legacy settings are reported
+	rec, result = post("routes:\n  - path: \"/users\"\n    upstream: \"http://users:8080\"\n    require_auth: true\n")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []interface{}{"routes[0] (/users): require_auth outside middlewares is deprecated, run the migrate command to move it"}, result["deprecations"])
+
+	rec, result = post("routes:\n  - path: \"/users\"\n")
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, false, result["valid"])
+	assert.Contains(t, result["error"], "invalid route at index 0")
+}
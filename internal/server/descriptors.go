@@ -0,0 +1,20 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"api-gateway/internal/proxy"
+)
+
+// descriptorsHandler lists the services of the loaded gRPC descriptor sets
+func (s *Server) descriptorsHandler(w http.ResponseWriter, r *http.Request) {
+	services := []proxy.DescriptorService{}
+	services = append(services, s.descriptors.Services()...)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dir":       s.config.GRPC.Descriptors.Dir,
+		"loaded_at": s.descriptors.LoadedAt(),
+		"services":  services,
+	})
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/proxy"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestDescriptorsHandler(t *testing.T) {
+	dir := t.TempDir()
+	data, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("ping/v1/ping.proto"),
+		Package: proto.String("ping.v1"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Ping"),
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("PingService"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("Ping"),
+				InputType:  proto.String(".ping.v1.Ping"),
+				OutputType: proto.String(".ping.v1.Ping"),
+			}},
+		}},
+	}}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ping.desc"), data, 0o644))
+
+	cfg := &config.Config{GRPC: config.GRPCConfig{Descriptors: config.GRPCDescriptors{Dir: dir}}}
+	s := &Server{config: cfg, descriptors: proxy.NewDescriptorRegistry(&cfg.GRPC.Descriptors, &mockLogger{})}
+	rec := httptest.NewRecorder()
+	s.descriptorsHandler(rec, httptest.NewRequest(http.MethodGet, "/admin/grpc/descriptors", nil))
+
+	var body struct {
+		Dir      string                    `json:"dir"`
+		Services []proxy.DescriptorService `json:"services"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, dir, body.Dir)
+	assert.Equal(t, []proxy.DescriptorService{{
+		Name:    "ping.v1.PingService",
+		File:    "ping.desc",
+		Methods: []string{"ping.v1.PingService/Ping"},
+	}}, body.Services)
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"net/http"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/config"
+	"api-gateway/internal/util"
+	"api-gateway/pkg/logger"
+)
+
+// restrictMetrics only lets scrapers connecting from metrics.allowed_cidrs
+// through, or anyone if none are configured. Invalid ranges let no one through.
+func (s *Server) restrictMetrics(next http.Handler) http.Handler {
+	prefixes, err := s.config.Metrics.Prefixes()
+	if err != nil {
+		s.log.Error("Invalid metrics.allowed_cidrs, rejecting every metrics request",
+			logger.Error(err),
+		)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		})
+	}
+	if len(prefixes) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if addr, ok := util.ConnectionAddr(r); ok {
+			for _, prefix := range prefixes {
+				if prefix.Contains(addr) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+
+		s.log.Warn("Rejected metrics request",
+			logger.String("remote_addr", r.RemoteAddr),
+		)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	})
+}
+
+// protectPurge requires purge callers to authenticate with one of
+// cache.purge_auth.methods and records every call, allowed or not, in the
+// audit log
+func (s *Server) protectPurge(next http.Handler) http.Handler {
+	purgeAuth := &s.config.Cache.PurgeAuth
+	audit := logger.Component(s.log, "audit")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &auditRecorder{ResponseWriter: w, status: http.StatusOK}
+		method, caller, allowed := s.authorizePurge(recorder, r, purgeAuth)
+		if allowed {
+			next.ServeHTTP(recorder, r)
+		}
+
+		msg := "Cache purge"
+		if !allowed {
+			msg = "Cache purge denied"
+		}
+		audit.Info(msg,
+			logger.String("path", r.URL.Query().Get("path")),
+			logger.String("user", r.URL.Query().Get("user")),
+			logger.String("auth_method", method),
+			logger.String("caller", caller),
+			logger.String("client_ip", util.GetClientIP(r)),
+			logger.String("remote_addr", r.RemoteAddr),
+			logger.Int("status", recorder.status),
+		)
+	})
+}
+
+// authorizePurge checks a purge caller against the configured methods,
+// writing the error response if it is denied. A workload certificate is
+// preferred over credentials when both are allowed.
+func (s *Server) authorizePurge(w http.ResponseWriter, r *http.Request, purgeAuth *config.CachePurgeAuthConfig) (string, string, bool) {
+	if len(purgeAuth.Methods) == 0 {
+		return "", "", true
+	}
+
+	if purgeAuth.Allows(config.PurgeAuthMTLS) {
+		if id := peerSPIFFEID(r); id != "" {
+			if len(purgeAuth.AllowedIDs) == 0 || containsString(purgeAuth.AllowedIDs, id) {
+				return config.PurgeAuthMTLS, id, true
+			}
+			http.Error(w, "Forbidden: workload not allowed to purge", http.StatusForbidden)
+			return config.PurgeAuthMTLS, id, false
+		}
+	}
+
+	if purgeAuth.Allows(config.PurgeAuthAdmin) {
+		identity := s.authorizeAdmin(w, r)
+		if identity == nil {
+			return config.PurgeAuthAdmin, "", false
+		}
+		return config.PurgeAuthAdmin, identity.Subject, true
+	}
+
+	http.Error(w, "Client certificate required", http.StatusUnauthorized)
+	return "", "", false
+}
+
+// operatorAuthorizer returns a check of callers authenticated with one of
+// roles, returning their subject
+func operatorAuthorizer(authService *auth.AuthService, roles []string) func(r *http.Request) (string, bool) {
+	return func(r *http.Request) (string, bool) {
+		identity, err := authService.Authenticate(r, nil, nil)
+		if err != nil || !containsString(roles, identity.Role) {
+			return "", false
+		}
+		return identity.Subject, true
+	}
+}
+
+// peerSPIFFEID returns the SPIFFE ID of the workload certificate a request was
+// sent with over the internal mTLS listener, which verified it
+func peerSPIFFEID(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	for _, uri := range r.TLS.PeerCertificates[0].URIs {
+		if uri.Scheme == "spiffe" {
+			return uri.String()
+		}
+	}
+	return ""
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// auditRecorder captures the status of an audited response
+type auditRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status
+func (r *auditRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
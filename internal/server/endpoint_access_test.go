@@ -0,0 +1,173 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/config"
+	"api-gateway/internal/middleware"
+	"api-gateway/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// auditLogger records the info entries it receives
+type auditLogger struct {
+	mockLogger
+	mutex   sync.Mutex
+	entries []auditEntry
+}
+
+type auditEntry struct {
+	msg    string
+	fields map[string]interface{}
+}
+
+func (l *auditLogger) Info(msg string, fields ...logger.Field) {
+	entry := auditEntry{msg: msg, fields: make(map[string]interface{})}
+	for _, field := range fields {
+		entry.fields[field.Key] = field.Value
+	}
+	l.mutex.Lock()
+	l.entries = append(l.entries, entry)
+	l.mutex.Unlock()
+}
+
+func (l *auditLogger) last() auditEntry {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.entries[len(l.entries)-1]
+}
+
+func TestRestrictMetrics(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	serve := func(s *Server, remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Real-IP", "10.0.0.1")
+		rec := httptest.NewRecorder()
+		s.restrictMetrics(next).ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	s := &Server{log: &mockLogger{}, config: &config.Config{Metrics: config.MetricsConfig{AllowedCIDRs: []string{"10.0.0.0/8", "::1"}}}}
+	assert.Equal(t, http.StatusOK, serve(s, "10.1.2.3:41000"))
+	assert.Equal(t, http.StatusOK, serve(s, "[::1]:41000"))
+	assert.Equal(t, http.StatusOK, serve(s, "[::ffff:10.1.2.3]:41000"))
+
+	// Forwarding headers don't count
+	assert.Equal(t, http.StatusForbidden, serve(s, "192.168.1.1:41000"))
+
+	open := &Server{log: &mockLogger{}, config: &config.Config{}}
+	assert.Equal(t, http.StatusOK, serve(open, "192.168.1.1:41000"))
+
+	// Invalid ranges don't open the endpoint
+	invalid := &Server{log: &mockLogger{}, config: &config.Config{Metrics: config.MetricsConfig{AllowedCIDRs: []string{"10.0.0.0/8", "not-a-cidr"}}}}
+	assert.Equal(t, http.StatusForbidden, serve(invalid, "10.1.2.3:41000"))
+}
+
+func TestProtectPurge(t *testing.T) {
+	audit := &auditLogger{}
+	cfg := &config.Config{
+		Cache: config.CacheConfig{
+			Enabled: true,
+			PurgeAuth: config.CachePurgeAuthConfig{
+				Methods:    []string{config.PurgeAuthAdmin, config.PurgeAuthMTLS},
+				AllowedIDs: []string{"spiffe://example.org/ops"},
+			},
+		},
+		Debug: config.DebugConfig{AllowedRoles: []string{"admin"}},
+	}
+	authCfg := &config.AuthConfig{JWTSecret: "debug-secret", JWTHeader: "Authorization", APIKeyHeader: "X-API-Key"}
+	s := &Server{
+		log:         audit,
+		config:      cfg,
+		authService: auth.NewAuthService(authCfg, &mockLogger{}),
+	}
+	handler := s.protectPurge(http.HandlerFunc(middleware.NewCacheMiddleware(&cfg.Cache, &mockLogger{}).PurgeCache))
+
+	purge := func(authorization, spiffeID string) int {
+		req := httptest.NewRequest(http.MethodPost, "/admin/cache/purge?path=/users", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		if spiffeID != "" {
+			id, err := url.Parse(spiffeID)
+			require.NoError(t, err)
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{URIs: []*url.URL{id}}}}
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	t.Run("denied without credentials", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, purge("", ""))
+		entry := audit.last()
+		assert.Equal(t, "Cache purge denied", entry.msg)
+		assert.Equal(t, "/users", entry.fields["path"])
+		assert.Equal(t, http.StatusUnauthorized, entry.fields["status"])
+	})
+
+	t.Run("admin credentials", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, purge(debugToken(t, "user"), ""))
+		assert.Equal(t, "Cache purge denied", audit.last().msg)
+
+		assert.Equal(t, http.StatusOK, purge(debugToken(t, "admin"), ""))
+		entry := audit.last()
+		assert.Equal(t, "Cache purge", entry.msg)
+		assert.Equal(t, config.PurgeAuthAdmin, entry.fields["auth_method"])
+		assert.Equal(t, "operator", entry.fields["caller"])
+		assert.Equal(t, http.StatusOK, entry.fields["status"])
+	})
+
+	t.Run("workload certificate", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, purge("", "spiffe://example.org/ops"))
+		entry := audit.last()
+		assert.Equal(t, config.PurgeAuthMTLS, entry.fields["auth_method"])
+		assert.Equal(t, "spiffe://example.org/ops", entry.fields["caller"])
+
+		assert.Equal(t, http.StatusForbidden, purge("", "spiffe://example.org/billing"))
+		assert.Equal(t, "Cache purge denied", audit.last().msg)
+	})
+
+	t.Run("mtls only", func(t *testing.T) {
+		cfg.Cache.PurgeAuth.Methods = []string{config.PurgeAuthMTLS}
+		assert.Equal(t, http.StatusUnauthorized, purge(debugToken(t, "admin"), ""))
+		assert.Equal(t, http.StatusOK, purge("", "spiffe://example.org/ops"))
+	})
+
+	t.Run("open without methods", func(t *testing.T) {
+		cfg.Cache.PurgeAuth.Methods = nil
+		assert.Equal(t, http.StatusOK, purge("", ""))
+		assert.Equal(t, "Cache purge", audit.last().msg)
+	})
+}
+
+func TestOperatorAuthorizer(t *testing.T) {
+	authCfg := &config.AuthConfig{JWTSecret: "debug-secret", JWTHeader: "Authorization", APIKeyHeader: "X-API-Key"}
+	authorize := operatorAuthorizer(auth.NewAuthService(authCfg, &mockLogger{}), []string{"admin"})
+	request := func(authorization string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		return req
+	}
+
+	operator, ok := authorize(request(debugToken(t, "admin")))
+	assert.True(t, ok)
+	assert.Equal(t, "operator", operator)
+
+	_, ok = authorize(request(debugToken(t, "user")))
+	assert.False(t, ok)
+	_, ok = authorize(request(""))
+	assert.False(t, ok)
+}
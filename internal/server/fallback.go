@@ -0,0 +1,123 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"api-gateway/internal/handlers"
+	"api-gateway/pkg/logger"
+
+	"github.com/gorilla/mux"
+)
+
+// standardMethods are checked, besides the methods of configured routes, when
+// building the Allow header of a 405 response
+var standardMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
+// registerFallbackHandlers sets the handlers for requests whose path matches a
+// route but whose method doesn't, and for requests no route matches. The
+// catch-all route handler serves unmatched requests if set.
+func (s *Server) registerFallbackHandlers(catchAll http.Handler) {
+	s.router.MethodNotAllowedHandler = http.HandlerFunc(s.methodNotAllowedHandler)
+
+	var unmatched http.Handler
+	notFound := s.config.Server.NotFound
+	switch {
+	case catchAll != nil:
+		unmatched = catchAll
+	case notFound.Body != "":
+		unmatched = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if notFound.ContentType != "" {
+				w.Header().Set("Content-Type", notFound.ContentType)
+			}
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(notFound.Body))
+		})
+	default:
+		unmatched = http.HandlerFunc(handlers.NotFoundHandler)
+	}
+	s.router.NotFoundHandler = s.methodNotAllowedOr(unmatched)
+}
+
+// methodNotAllowedOr answers 405 for requests whose path a route matches
+// with other methods, and passes the rest to unmatched. gorilla/mux reports
+// such requests as not found when a route registered later partly matches
+// them.
+func (s *Server) methodNotAllowedOr(unmatched http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if allowed := s.allowedMethods(r); len(allowed) > 0 {
+			s.methodNotAllowed(w, r, allowed)
+			return
+		}
+		unmatched.ServeHTTP(w, r)
+	})
+}
+
+// catchAllHandler serves unmatched requests with the catch-all route, limited
+// to the route's methods if any are configured
+func catchAllHandler(next http.Handler, methods []string) http.Handler {
+	if len(methods) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, method := range methods {
+			if strings.EqualFold(method, r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		handlers.MethodNotAllowedHandler(w, r)
+	})
+}
+
+// methodNotAllowedHandler responds 405 with the methods the path accepts
+func (s *Server) methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	s.methodNotAllowed(w, r, s.allowedMethods(r))
+}
+
+// methodNotAllowed responds 405 with the allowed methods
+func (s *Server) methodNotAllowed(w http.ResponseWriter, r *http.Request, allowed []string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+
+	s.log.Debug("Method not allowed",
+		logger.String("method", r.Method),
+		logger.String("path", r.URL.Path),
+		logger.Any("allowed", allowed),
+	)
+	handlers.MethodNotAllowedHandler(w, r)
+}
+
+// allowedMethods returns the methods for which a route matches the request path
+func (s *Server) allowedMethods(r *http.Request) []string {
+	candidates := append([]string(nil), standardMethods...)
+	if s.routes != nil {
+		for _, route := range s.routes.Routes {
+			for _, method := range route.Methods {
+				candidates = appendMissing(candidates, strings.ToUpper(method))
+			}
+		}
+	}
+
+	var allowed []string
+	for _, method := range candidates {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+
+		var match mux.RouteMatch
+		if s.router.Match(probe, &match) && match.MatchErr == nil {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
+
+// appendMissing appends value unless values already contains it
+func appendMissing(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"api-gateway/internal/config"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFallbackTestServer(notFound config.NotFoundConfig) *Server {
+	router := mux.NewRouter()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// Mirror how registerRoute lays out prefix and exact routes
+	api := router.PathPrefix("/api").Subrouter()
+	for _, method := range []string{"GET", "POST"} {
+		api.PathPrefix("/").Handler(ok).Methods(method)
+	}
+	router.PathPrefix("/").Path("/project").Handler(ok).Methods("PURGE")
+
+	return &Server{
+		router: router,
+		log:    &mockLogger{},
+		config: &config.Config{Server: config.ServerConfig{NotFound: notFound}},
+		routes: &config.RouteConfig{Routes: []config.Route{
+			{Path: "/api/*", Methods: []string{"GET", "POST"}},
+			{Path: "/project", Methods: []string{"PURGE"}},
+		}},
+	}
+}
+
+func TestRegisterFallbackHandlers(t *testing.T) {
+	t.Run("method not allowed lists allowed methods", func(t *testing.T) {
+		s := newFallbackTestServer(config.NotFoundConfig{})
+		s.registerFallbackHandlers(nil)
+
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest("DELETE", "/api/items", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+		assert.Equal(t, "GET, POST", rec.Header().Get("Allow"))
+		assert.Contains(t, rec.Body.String(), "method_not_allowed")
+
+		rec = httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest("GET", "/project", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+		assert.Equal(t, "PURGE", rec.Header().Get("Allow"))
+
+		rec = httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest("POST", "/api/items", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("default not found", func(t *testing.T) {
+		s := newFallbackTestServer(config.NotFoundConfig{})
+		s.registerFallbackHandlers(nil)
+
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest("GET", "/missing", nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		assert.Contains(t, rec.Body.String(), "not_found")
+	})
+
+	t.Run("custom not found body", func(t *testing.T) {
+		s := newFallbackTestServer(config.NotFoundConfig{ContentType: "text/html", Body: "<h1>Gone fishing</h1>"})
+		s.registerFallbackHandlers(nil)
+
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest("GET", "/missing", nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Equal(t, "text/html", rec.Header().Get("Content-Type"))
+		assert.Equal(t, "<h1>Gone fishing</h1>", rec.Body.String())
+	})
+
+	t.Run("catch-all route", func(t *testing.T) {
+		s := newFallbackTestServer(config.NotFoundConfig{Body: "unused"})
+		s.registerFallbackHandlers(catchAllHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}), []string{"GET"}))
+
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest("GET", "/missing", nil))
+		assert.Equal(t, http.StatusTeapot, rec.Code)
+
+		rec = httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest("POST", "/missing", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+		assert.Equal(t, "GET", rec.Header().Get("Allow"))
+
+		// Known paths with the wrong method still get 405
+		rec = httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest("DELETE", "/api/items", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	})
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -17,8 +19,11 @@ import (
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
 
+	"api-gateway/internal/auth"
 	"api-gateway/internal/config"
 	"api-gateway/internal/handlers"
+	"api-gateway/internal/middleware"
+	"api-gateway/internal/proxy"
 	"api-gateway/pkg/logger"
 )
 
@@ -32,6 +37,8 @@ type GRPCServer struct {
 	mu            sync.RWMutex
 	serviceRoutes map[string]*config.Route // map of full service names to route configs
 	addr          string
+	authService   *auth.AuthService
+	descriptors   *proxy.DescriptorRegistry
 }
 
 // NewGRPCServer creates a new gRPC server
@@ -78,6 +85,18 @@ func NewGRPCServer(cfg *config.Config, routes *config.RouteConfig, log logger.Lo
 	}
 }
 
+// SetAuthService authenticates calls on routes requiring auth with the
+// gateway's credentials. Without it, calls only need authorization metadata.
+func (s *GRPCServer) SetAuthService(authService *auth.AuthService) {
+	s.authService = authService
+}
+
+// SetDescriptors looks up methods not compiled into the gateway in the
+// descriptor registry
+func (s *GRPCServer) SetDescriptors(descriptors *proxy.DescriptorRegistry) {
+	s.descriptors = descriptors
+}
+
 // RegisterRoutes sets up the gRPC service handlers based on the route configuration
 func (s *GRPCServer) RegisterRoutes() error {
 	// Register UnknownServiceHandler to capture all incoming requests
@@ -108,6 +127,9 @@ func (s *GRPCServer) RegisterRoutes() error {
 			if err != nil {
 				return fmt.Errorf("failed to create handler for %s: %w", serviceName, err)
 			}
+			if s.descriptors != nil {
+				handler.SetDescriptors(s.descriptors)
+			}
 
 			// Store the handler
 			s.handlers[serviceName] = handler
@@ -189,6 +211,7 @@ func (s *GRPCServer) UnaryHandler(ctx context.Context, req interface{}) (interfa
 	}
 
 	// Apply authentication middleware if required
+	var identity *auth.Identity
 	if route.Middlewares != nil && route.Middlewares.RequireAuth {
 		// Get metadata from context
 		md, ok := metadata.FromIncomingContext(ctx)
@@ -196,36 +219,74 @@ func (s *GRPCServer) UnaryHandler(ctx context.Context, req interface{}) (interfa
 			return nil, status.Error(codes.Unauthenticated, "metadata required for authentication")
 		}
 
-		// Implement authentication logic here
-		// This is a placeholder - actual implementation would vary
-		authToken := ""
-		if tokens := md.Get("authorization"); len(tokens) > 0 {
-			authToken = tokens[0]
-		}
-
-		if authToken == "" {
+		if s.authService != nil {
+			var err error
+			if identity, err = s.authenticate(ctx, md, route); err != nil {
+				s.log.Debug("Authentication failed",
+					logger.String("method", fullMethod),
+					logger.Error(err),
+				)
+				return nil, status.Error(codes.Unauthenticated, "authentication required")
+			}
+			ctx = auth.WithIdentity(ctx, identity)
+		} else if tokens := md.Get("authorization"); len(tokens) == 0 || tokens[0] == "" {
 			return nil, status.Error(codes.Unauthenticated, "authentication required")
 		}
-
-		// Validate token logic would go here
-		// ...
 	}
 
+	// Transform the metadata sent upstream
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = metadata.NewIncomingContext(ctx, middleware.GRPCRequestMetadata(md, route.GRPCMetadata, identity))
+
+	// Bound calls sent without a deadline so abandoned ones don't hold the
+	// upstream forever
+	ctx, cancel := callContext(ctx, route)
+	defer cancel()
+
 	// Forward the request to the backend service
-	responseMsg, respMD, err := handler.ForwardUnary(ctx, fullServiceMethod, requestMsg)
+	var trailer metadata.MD
+	responseMsg, respMD, err := handler.ForwardUnary(ctx, fullServiceMethod, requestMsg, grpc.Trailer(&trailer))
 	if err != nil {
 		// Pass through the error code from the backend
 		return nil, err
 	}
 
 	// Send back response metadata
+	respMD, trailer = middleware.GRPCResponseMetadata(respMD, trailer, route.GRPCMetadata)
 	if err := grpc.SendHeader(ctx, respMD); err != nil {
 		s.log.Error("Failed to send response headers", logger.Error(err))
 	}
+	if err := grpc.SetTrailer(ctx, trailer); err != nil {
+		s.log.Error("Failed to set response trailers", logger.Error(err))
+	}
 
 	return responseMsg, nil
 }
 
+// authenticate checks the credentials in the call's metadata as the HTTP
+// auth middleware checks request headers
+func (s *GRPCServer) authenticate(ctx context.Context, md metadata.MD, route *config.Route) (*auth.Identity, error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, "/", nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range md {
+		for _, value := range values {
+			r.Header.Add(key, value)
+		}
+	}
+	return s.authService.Authenticate(r, nil, route.Middlewares.JWT)
+}
+
+// callContext applies the route's default deadline to calls that arrive
+// without one. A deadline set by the client is kept.
+func callContext(ctx context.Context, route *config.Route) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || route.GRPCDeadline <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(route.GRPCDeadline)*time.Second)
+}
+
 // StreamHandler handles all streaming RPC methods (not implemented yet)
 func (s *GRPCServer) StreamHandler(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
 	// This is a placeholder for streaming support
@@ -15,6 +15,7 @@ import (
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 
+	"api-gateway/internal/auth"
 	"api-gateway/internal/config"
 	"api-gateway/internal/handlers"
 	"api-gateway/pkg/logger"
@@ -307,3 +308,50 @@ func TestStartAndStop(t *testing.T) {
 		grpcServer.Stop()
 	})
 }
+
+func TestCallContext(t *testing.T) {
+	route := &config.Route{GRPCDeadline: 5}
+
+	// Calls without a deadline get the route's
+	ctx, cancel := callContext(context.Background(), route)
+	deadline, ok := ctx.Deadline()
+	cancel()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(5*time.Second), deadline, time.Second)
+
+	// The client's deadline is kept, even if later
+	clientCtx, clientCancel := context.WithTimeout(context.Background(), time.Minute)
+	defer clientCancel()
+	ctx, cancel = callContext(clientCtx, route)
+	deadline, _ = ctx.Deadline()
+	cancel()
+	clientDeadline, _ := clientCtx.Deadline()
+	assert.Equal(t, clientDeadline, deadline)
+
+	// Routes without a default deadline leave calls unbounded, but cancelable
+	ctx, cancel = callContext(context.Background(), &config.Route{})
+	_, ok = ctx.Deadline()
+	assert.False(t, ok)
+	cancel()
+	assert.Error(t, ctx.Err())
+}
+
+func TestGRPCServerAuthenticate(t *testing.T) {
+	authService := auth.NewAuthService(&config.AuthConfig{APIKeyHeader: "X-API-Key"}, &testLogger{})
+	authService.SetAPIKeyLookup(func(token string) (*auth.Identity, error) {
+		if token == "issued" {
+			return &auth.Identity{Type: auth.IdentityAPIKey, Subject: "key_1"}, nil
+		}
+		return nil, nil
+	})
+	grpcServer := &GRPCServer{log: &testLogger{}}
+	grpcServer.SetAuthService(authService)
+	route := &config.Route{Middlewares: &config.Middlewares{RequireAuth: true}}
+
+	identity, err := grpcServer.authenticate(context.Background(), metadata.Pairs("x-api-key", "issued"), route)
+	require.NoError(t, err)
+	assert.Equal(t, "key_1", identity.Subject)
+
+	_, err = grpcServer.authenticate(context.Background(), metadata.Pairs("user-agent", "grpc-go"), route)
+	assert.ErrorIs(t, err, auth.ErrNoToken)
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"fmt"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/proxy"
+)
+
+// Health levels of the gateway and its subsystems, from best to worst
+const (
+	healthUp       = "up"
+	healthDegraded = "degraded"
+	healthDown     = "down"
+)
+
+// healthRank orders the health levels
+var healthRank = map[string]int{healthUp: 0, healthDegraded: 1, healthDown: 2}
+
+// subsystemHealth is a subsystem's section of the health response
+type subsystemHealth struct {
+	Status   string                  `json:"status"`
+	Detail   string                  `json:"detail,omitempty"`
+	Services []proxy.DiscoveryStatus `json:"services,omitempty"`
+	Redis    *auth.RedisStatus       `json:"redis,omitempty"`
+
+	// Soft dependencies the gateway keeps serving without only degrade it
+	soft bool
+}
+
+// subsystemsHealth returns the health of the subsystems in use
+func (s *Server) subsystemsHealth() map[string]subsystemHealth {
+	subsystems := map[string]subsystemHealth{}
+	if s.httpProxy != nil {
+		if statuses := s.httpProxy.DiscoveryStatus(); len(statuses) > 0 {
+			subsystems["discovery"] = discoveryHealth(statuses)
+		}
+	}
+	if s.authService != nil {
+		if status := s.authService.RedisStatus(); status != nil {
+			subsystems["validation_cache"] = validationCacheHealth(status)
+		}
+	}
+	if s.reloadStatus != nil {
+		subsystems["config"] = configHealth(s.reloadStatus.status())
+	}
+	return subsystems
+}
+
+// overallHealth is the worst health of the subsystems. Soft dependencies
+// being down only degrade the gateway.
+func overallHealth(subsystems map[string]subsystemHealth) string {
+	overall := healthUp
+	for _, subsystem := range subsystems {
+		status := subsystem.Status
+		if subsystem.soft && status == healthDown {
+			status = healthDegraded
+		}
+		if healthRank[status] > healthRank[overall] {
+			overall = status
+		}
+	}
+	return overall
+}
+
+// discoveryHealth is degraded while etcd can't be listed and the routes are
+// served from their last known instances, and down once no route has any
+func discoveryHealth(statuses []proxy.DiscoveryStatus) subsystemHealth {
+	failing, empty := 0, 0
+	for _, status := range statuses {
+		if status.Error == "" {
+			continue
+		}
+		failing++
+		if status.Instances == 0 {
+			empty++
+		}
+	}
+
+	health := subsystemHealth{Status: healthUp, Services: statuses}
+	switch {
+	case failing == 0:
+	case empty == len(statuses):
+		health.Status = healthDown
+		health.Detail = "etcd unreachable and no service has cached endpoints"
+	case empty == 0:
+		health.Status = healthDegraded
+		health.Detail = "etcd unreachable, serving cached endpoints"
+	default:
+		health.Status = healthDegraded
+		health.Detail = fmt.Sprintf("etcd unreachable, %d of %d services have no cached endpoints", empty, len(statuses))
+	}
+	return health
+}
+
+// validationCacheHealth is down while Redis fails, leaving API key
+// validations cached by each gateway alone
+func validationCacheHealth(status *auth.RedisStatus) subsystemHealth {
+	health := subsystemHealth{Status: healthUp, Redis: status, soft: true}
+	if status.Error != "" {
+		health.Status = healthDown
+		health.Detail = "Redis unreachable, API key validations are cached in memory only"
+	}
+	return health
+}
+
+// configHealth is degraded after a failed reload left the previous
+// configuration running
+func configHealth(status configStatus) subsystemHealth {
+	health := subsystemHealth{Status: healthUp, soft: true}
+	if !status.ReloadOK {
+		health.Status = healthDegraded
+		health.Detail = "last reload failed, serving the previous configuration"
+	}
+	return health
+}
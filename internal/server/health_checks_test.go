@@ -0,0 +1,52 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/proxy"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthChecksHandler(t *testing.T) {
+	routes, err := config.ParseRoutes([]byte(`
+routes:
+  - path: "/orders"
+    upstream: "http://orders:8080"
+    load_balancing:
+      method: "round_robin"
+      health_check: true
+      endpoints: ["http://orders-1:8080", "http://orders-2:8080"]
+      health_check_config:
+        interval: 60
+`))
+	require.NoError(t, err)
+	cfg := &config.Config{}
+	httpProxy := proxy.NewHTTPProxy(cfg, routes, &mockLogger{})
+	defer httpProxy.Close()
+	httpProxy.ProxyRequest(routes.Routes[0])
+	s := &Server{log: &mockLogger{}, config: cfg, routes: routes, httpProxy: httpProxy}
+
+	var result struct {
+		Routes []proxy.HealthCheckState `json:"routes"`
+	}
+	rec := httptest.NewRecorder()
+	s.healthChecksHandler(rec, httptest.NewRequest("POST", "/admin/routes/health-checks", strings.NewReader(`{"path": "/orders", "enabled": false}`)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Equal(t, []proxy.HealthCheckState{{Path: "/orders", Enabled: false, Endpoints: 2, Healthy: 2}}, result.Routes)
+
+	rec = httptest.NewRecorder()
+	s.healthChecksHandler(rec, httptest.NewRequest("POST", "/admin/routes/health-checks", strings.NewReader(`{"path": "/users", "enabled": true}`)))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	s.healthChecksHandler(rec, httptest.NewRequest("POST", "/admin/routes/health-checks", strings.NewReader(`{"path": "/orders"}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
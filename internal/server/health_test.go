@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"api-gateway/internal/auth"
+	"api-gateway/internal/config"
+	"api-gateway/internal/proxy"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoveryHealth(t *testing.T) {
+	healthy := proxy.DiscoveryStatus{Service: "users", Instances: 2}
+	cached := proxy.DiscoveryStatus{Service: "orders", Instances: 1, Error: "etcd unavailable"}
+	empty := proxy.DiscoveryStatus{Service: "billing", Error: "etcd unavailable"}
+
+	assert.Equal(t, healthUp, discoveryHealth([]proxy.DiscoveryStatus{healthy}).Status)
+
+	health := discoveryHealth([]proxy.DiscoveryStatus{healthy, cached})
+	assert.Equal(t, healthDegraded, health.Status)
+	assert.Equal(t, "etcd unreachable, serving cached endpoints", health.Detail)
+
+	health = discoveryHealth([]proxy.DiscoveryStatus{cached, empty})
+	assert.Equal(t, healthDegraded, health.Status)
+	assert.Equal(t, "etcd unreachable, 1 of 2 services have no cached endpoints", health.Detail)
+
+	assert.Equal(t, healthDown, discoveryHealth([]proxy.DiscoveryStatus{empty}).Status)
+}
+
+func TestOverallHealth(t *testing.T) {
+	assert.Equal(t, healthUp, overallHealth(nil))
+
+	// Soft dependencies being down only degrade the gateway
+	redis := validationCacheHealth(&auth.RedisStatus{Address: "redis:6379", Error: "connection refused"})
+	assert.Equal(t, healthDown, redis.Status)
+	assert.Equal(t, healthDegraded, overallHealth(map[string]subsystemHealth{
+		"validation_cache": redis,
+		"config":           configHealth(configStatus{ReloadOK: true}),
+	}))
+
+	assert.Equal(t, healthDown, overallHealth(map[string]subsystemHealth{
+		"validation_cache": redis,
+		"discovery":        discoveryHealth([]proxy.DiscoveryStatus{{Service: "users", Error: "etcd unavailable"}}),
+	}))
+}
+
+func TestHealthReportsDegradedConfig(t *testing.T) {
+	cfg, routes := &config.Config{}, &config.RouteConfig{}
+	s := &Server{router: mux.NewRouter(), log: &mockLogger{}, config: cfg, reloadStatus: newReloadStatus(cfg, routes)}
+	s.registerUtilityEndpoints()
+
+	health := func() map[string]interface{} {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest("GET", "/health", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+		return result
+	}
+
+	result := health()
+	assert.Equal(t, "up", result["status"])
+	assert.Equal(t, map[string]interface{}{"config": map[string]interface{}{"status": "up"}}, result["subsystems"])
+
+	s.reloadStatus.failed(errors.New("invalid route at index 0"))
+	result = health()
+	assert.Equal(t, "degraded", result["status"])
+	assert.Equal(t, map[string]interface{}{"config": map[string]interface{}{
+		"status": "degraded",
+		"detail": "last reload failed, serving the previous configuration",
+	}}, result["subsystems"])
+}
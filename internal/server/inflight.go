@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// drainLogInterval is how often shutdown logs the requests left to drain
+const drainLogInterval = time.Second
+
+var (
+	// requestsInFlight counts the requests being served
+	requestsInFlight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "gateway_requests_in_flight",
+			Help: "Requests being served",
+		},
+	)
+
+	// routeRequestsInFlight counts the requests being served by route
+	routeRequestsInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_route_requests_in_flight",
+			Help: "Requests being served by route",
+		},
+		[]string{"route"},
+	)
+)
+
+func init() {
+	// Register metrics with Prometheus
+	prometheus.MustRegister(requestsInFlight, routeRequestsInFlight)
+}
+
+// inflightTracker counts the requests being served, in total and by route,
+// so shutdown can report how the drain progresses
+type inflightTracker struct {
+	mutex  sync.Mutex
+	total  int
+	routes map[string]int // By route path, only routes with requests in flight
+}
+
+// inflightSnapshot is the listing of the requests in flight
+type inflightSnapshot struct {
+	Total  int            `json:"total"`
+	Routes map[string]int `json:"routes"`
+}
+
+// newInflightTracker creates a tracker with no request in flight
+func newInflightTracker() *inflightTracker {
+	return &inflightTracker{routes: make(map[string]int)}
+}
+
+// track counts every request passing through next
+func (t *inflightTracker) track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.add("", 1)
+		defer t.add("", -1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// trackRoute counts the requests of a route passing through next
+func (t *inflightTracker) trackRoute(next http.Handler, route config.Route) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.add(route.Path, 1)
+		defer t.add(route.Path, -1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// add changes the requests in flight of a route, or the total without one
+func (t *inflightTracker) add(route string, delta int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if route == "" {
+		t.total += delta
+		requestsInFlight.Add(float64(delta))
+		return
+	}
+	if count := t.routes[route] + delta; count > 0 {
+		t.routes[route] = count
+	} else {
+		delete(t.routes, route)
+	}
+	routeRequestsInFlight.WithLabelValues(route).Add(float64(delta))
+}
+
+// snapshot returns the requests in flight
+func (t *inflightTracker) snapshot() inflightSnapshot {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	snapshot := inflightSnapshot{Total: t.total, Routes: make(map[string]int, len(t.routes))}
+	for route, count := range t.routes {
+		snapshot.Routes[route] = count
+	}
+	return snapshot
+}
+
+// inflightHandler lists the requests in flight, in total and by route
+func (s *Server) inflightHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.inflight.snapshot())
+}
+
+// shutdownHTTP shuts the HTTP server down, logging the requests left to
+// drain until they complete or ctx ends
+func (s *Server) shutdownHTTP(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- s.httpServer.Shutdown(ctx)
+	}()
+
+	s.logDrain("Draining in-flight requests")
+	ticker := time.NewTicker(drainLogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				snapshot := s.inflight.snapshot()
+				s.log.Warn("Shut down before in-flight requests drained",
+					logger.Int("in_flight", snapshot.Total),
+					logger.Any("routes", snapshot.Routes),
+				)
+				return err
+			}
+			s.log.Info("Drained in-flight requests")
+			return nil
+		case <-ticker.C:
+			s.logDrain("Draining in-flight requests")
+		}
+	}
+}
+
+// logDrain logs the requests in flight
+func (s *Server) logDrain(msg string) {
+	snapshot := s.inflight.snapshot()
+	s.log.Info(msg,
+		logger.Int("in_flight", snapshot.Total),
+		logger.Any("routes", snapshot.Routes),
+	)
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/middleware"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInflightTracker(t *testing.T) {
+	tracker := newInflightTracker()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	blocking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	})
+	handler := tracker.track(tracker.trackRoute(blocking, config.Route{Path: "/inflight-orders"}))
+
+	total := testutil.ToFloat64(requestsInFlight)
+	done := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		go func() {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/inflight-orders", nil))
+			done <- struct{}{}
+		}()
+		<-started
+	}
+
+	assert.Equal(t, inflightSnapshot{Total: 2, Routes: map[string]int{"/inflight-orders": 2}}, tracker.snapshot())
+	assert.Equal(t, total+2, testutil.ToFloat64(requestsInFlight))
+	assert.Equal(t, 2.0, testutil.ToFloat64(routeRequestsInFlight.WithLabelValues("/inflight-orders")))
+
+	close(release)
+	<-done
+	<-done
+	assert.Equal(t, inflightSnapshot{Total: 0, Routes: map[string]int{}}, tracker.snapshot())
+	assert.Equal(t, total, testutil.ToFloat64(requestsInFlight))
+	assert.Equal(t, 0.0, testutil.ToFloat64(routeRequestsInFlight.WithLabelValues("/inflight-orders")))
+}
+
+func TestInflightHandler(t *testing.T) {
+	s := &Server{inflight: newInflightTracker()}
+	s.inflight.add("", 1)
+	s.inflight.add("/users", 1)
+
+	rec := httptest.NewRecorder()
+	s.inflightHandler(rec, httptest.NewRequest(http.MethodGet, "/admin/requests/in-flight", nil))
+	var body inflightSnapshot
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, inflightSnapshot{Total: 1, Routes: map[string]int{"/users": 1}}, body)
+}
+
+func TestShutdownHTTPDrains(t *testing.T) {
+	tracker := newInflightTracker()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	server := httptest.NewUnstartedServer(tracker.track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})))
+	server.Start()
+	defer server.Close()
+
+	s := &Server{log: &mockLogger{}, httpServer: server.Config, inflight: tracker}
+	go http.Get(server.URL)
+	<-started
+
+	// Shutdown waits for the request in flight, and gives up once ctx ends
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.shutdownHTTP(ctx), context.DeadlineExceeded)
+	assert.Equal(t, 1, tracker.snapshot().Total)
+
+	close(release)
+	assert.NoError(t, s.shutdownHTTP(context.Background()))
+	assert.Equal(t, 0, tracker.snapshot().Total)
+}
+
+func TestStopPersistsCacheAfterDrain(t *testing.T) {
+	cacheConfig := &config.CacheConfig{
+		Enabled: true,
+		MaxSize: 100,
+		Persistence: config.CachePersistenceConfig{
+			Enabled:          true,
+			Path:             filepath.Join(t.TempDir(), "cache.snapshot"),
+			SnapshotInterval: 3600,
+		},
+	}
+	cache := middleware.NewCacheMiddleware(cacheConfig, &mockLogger{})
+	route := config.Route{Path: "/products", Middlewares: &config.Middlewares{Cache: &config.RouteCacheConfig{Enabled: true, TTL: 60}}}
+
+	tracker := newInflightTracker()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	server := httptest.NewUnstartedServer(tracker.track(cache.Cache(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("products"))
+	}), route)))
+	server.Start()
+	defer server.Close()
+
+	s := &Server{log: &mockLogger{}, httpServer: server.Config, inflight: tracker, cacheMiddleware: cache}
+	go http.Get(server.URL + "/products")
+	<-started
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- s.Stop(context.Background()) }()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	require.NoError(t, <-stopped)
+
+	// The response cached while draining is in the snapshot
+	restored := middleware.NewCacheMiddleware(cacheConfig, &mockLogger{})
+	defer restored.Close()
+	loaded, err := restored.LoadSnapshot()
+	require.NoError(t, err)
+	assert.Equal(t, 1, loaded)
+}
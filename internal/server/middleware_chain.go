@@ -0,0 +1,251 @@
+package server
+
+import (
+	"net/http"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// applyMiddlewares wraps handler with the route's middleware following the
+// global or per-route middleware_order, outermost first
+func (s *Server) applyMiddlewares(handler http.Handler, route config.Route) http.Handler {
+	order := config.ResolveMiddlewareOrder(s.config.MiddlewareOrder, route.MiddlewareOrder)
+
+	// Wrap from the innermost middleware outwards
+	for i := len(order) - 1; i >= 0; i-- {
+		handler = s.applyMiddleware(order[i], handler, route)
+	}
+
+	return handler
+}
+
+// routeMiddlewares returns the middleware a route's requests pass through,
+// outermost first
+func (s *Server) routeMiddlewares(route config.Route) []string {
+	var chain []string
+	for _, name := range config.ResolveMiddlewareOrder(s.config.MiddlewareOrder, route.MiddlewareOrder) {
+		if s.middlewareEnabled(name, route) {
+			chain = append(chain, name)
+		}
+	}
+	return chain
+}
+
+// middlewareEnabled reports whether a route enables a named middleware
+func (s *Server) middlewareEnabled(name string, route config.Route) bool {
+	switch name {
+	case config.MiddlewareURLRewrite:
+		return route.Middlewares.URLRewrite != nil && len(route.Middlewares.URLRewrite.Patterns) > 0
+	case config.MiddlewareBodyRewrite:
+		return route.Middlewares.BodyRewrite != nil && route.Middlewares.BodyRewrite.Enabled
+	case config.MiddlewareHeaderTransform:
+		return route.Middlewares.HeaderTransform != nil
+	case config.MiddlewareRateLimit:
+		return route.Middlewares.RateLimit != nil && route.Middlewares.RateLimit.Requests > 0
+	case config.MiddlewareRetry:
+		return route.Middlewares.RetryPolicy != nil && route.Middlewares.RetryPolicy.Enabled
+	case config.MiddlewareCache:
+		return s.config.Cache.Enabled && route.Middlewares.Cache != nil && route.Middlewares.Cache.Enabled
+	case config.MiddlewareCollapse:
+		return route.Middlewares.Collapse != nil && route.Middlewares.Collapse.Enabled
+	case config.MiddlewareRequestDecompression:
+		return route.Middlewares.RequestDecompression != nil && route.Middlewares.RequestDecompression.Enabled
+	case config.MiddlewareCompression:
+		return route.Middlewares.Compression != nil && route.Middlewares.Compression.Enabled
+	case config.MiddlewareFeatureFlags:
+		return s.featureFlags != nil && route.Middlewares.FeatureFlags != nil && route.Middlewares.FeatureFlags.Enabled
+	case config.MiddlewareOPA:
+		return route.Middlewares.OPA != nil && route.Middlewares.OPA.Enabled
+	case config.MiddlewareExtAuthz:
+		return route.Middlewares.ExtAuthz != nil && route.Middlewares.ExtAuthz.Enabled
+	case config.MiddlewareRequestValidation:
+		return route.Middlewares.RequestValidation != nil && route.Middlewares.RequestValidation.Enabled
+	case config.MiddlewareRedaction:
+		return route.Middlewares.Redaction != nil && route.Middlewares.Redaction.Enabled
+	case config.MiddlewareFieldEncryption:
+		return route.Middlewares.FieldEncryption != nil && route.Middlewares.FieldEncryption.Enabled
+	case config.MiddlewareResponseValidation:
+		return route.Middlewares.ResponseValidation != nil && route.Middlewares.ResponseValidation.Enabled
+	case config.MiddlewareMQTT:
+		return route.Middlewares.MQTT != nil && route.Middlewares.MQTT.Enabled
+	case config.MiddlewarePriority:
+		return route.Middlewares.Priority != nil && route.Middlewares.Priority.Enabled
+	case config.MiddlewareAuth:
+		return route.Middlewares.RequireAuth
+	}
+	return false
+}
+
+// applyMiddleware wraps handler with a single named middleware if the route enables it
+func (s *Server) applyMiddleware(name string, handler http.Handler, route config.Route) http.Handler {
+	if !s.middlewareEnabled(name, route) {
+		return handler
+	}
+
+	switch name {
+	case config.MiddlewareURLRewrite:
+		// Apply URL rewriting if configured
+		handler = s.urlRewriter.Rewrite(handler, route.Middlewares.URLRewrite)
+		s.log.Info("Applied URL rewriting to route",
+			logger.String("path", route.Path),
+			logger.Int("patterns", len(route.Middlewares.URLRewrite.Patterns)),
+		)
+
+	case config.MiddlewareBodyRewrite:
+		// Translate upstream absolute URLs in responses if configured
+		handler = s.bodyRewriter.Rewrite(handler, route)
+		s.log.Info("Applied response body rewriting to route",
+			logger.String("path", route.Path),
+			logger.Int("rules", len(route.Middlewares.BodyRewrite.Rules)),
+		)
+
+	case config.MiddlewareHeaderTransform:
+		// Apply header transformations if configured
+		handler = s.headerTransformer.TransformRoute(handler, route)
+		s.log.Info("Applied header transformation to route",
+			logger.String("path", route.Path),
+		)
+
+	case config.MiddlewareRateLimit:
+		// Apply rate limiting if enabled
+		handler = s.rateLimiter.RateLimit(handler, route)
+		s.log.Info("Applied rate limiting to route",
+			logger.String("path", route.Path),
+			logger.Int("requests", route.Middlewares.RateLimit.Requests),
+			logger.String("period", route.Middlewares.RateLimit.Period),
+			logger.String("ref", route.Middlewares.RateLimitRef),
+		)
+
+	case config.MiddlewareRetry:
+		// Apply retry policy if enabled
+		handler = s.retryMiddleware.Retry(handler, route.Middlewares.RetryPolicy)
+		s.log.Info("Applied retry policy to route",
+			logger.String("path", route.Path),
+			logger.Int("attempts", route.Middlewares.RetryPolicy.Attempts),
+			logger.Int("per_try_timeout", route.Middlewares.RetryPolicy.PerTryTimeout),
+		)
+
+	case config.MiddlewareCache:
+		// Apply cache middleware if enabled for this route
+		handler = s.cacheMiddleware.Cache(handler, route)
+		s.log.Info("Applied cache middleware to route",
+			logger.String("path", route.Path),
+			logger.Int("ttl", route.Middlewares.Cache.TTL),
+			logger.String("namespace", route.Middlewares.Cache.Namespace),
+			logger.Int("max_size", route.Middlewares.Cache.MaxSize),
+			logger.Bool("cache_authenticated", route.Middlewares.Cache.CacheAuthenticated),
+		)
+
+	case config.MiddlewareCollapse:
+		// Share upstream calls between identical in-flight requests
+		handler = s.requestCollapser.Collapse(handler, route)
+		s.log.Info("Applied request collapsing to route",
+			logger.String("path", route.Path),
+			logger.Any("vary_headers", route.Middlewares.Collapse.VaryHeaders),
+		)
+
+	case config.MiddlewareRequestDecompression:
+		// Apply request decompression so inner middleware and the upstream see plain bodies
+		handler = s.decompressor.Decompress(handler, route.Middlewares.RequestDecompression)
+		s.log.Info("Applied request decompression to route",
+			logger.String("path", route.Path),
+			logger.Any("encodings", route.Middlewares.RequestDecompression.Encodings),
+		)
+
+	case config.MiddlewareCompression:
+		// Compress responses, coordinating with upstreams that already do
+		handler = s.compressor.Compress(handler, route.Middlewares.Compression)
+		s.log.Info("Applied response compression to route",
+			logger.String("path", route.Path),
+			logger.Any("encodings", route.Middlewares.Compression.Encodings),
+			logger.String("upstream_accept_encoding", route.Middlewares.Compression.UpstreamAcceptEncoding),
+		)
+
+	case config.MiddlewareFeatureFlags:
+		// Send feature flag results for the caller upstream
+		handler = s.featureFlags.Inject(handler, route.Middlewares.FeatureFlags)
+		s.log.Info("Applied feature flags to route",
+			logger.String("path", route.Path),
+			logger.Any("flags", route.Middlewares.FeatureFlags.Flags),
+		)
+
+	case config.MiddlewareOPA:
+		// Enforce OPA policies if configured
+		handler = s.opaMiddleware.Enforce(handler, route.Middlewares.OPA)
+		s.log.Info("Applied OPA policy to route",
+			logger.String("path", route.Path),
+			logger.String("policy", route.Middlewares.OPA.Policy),
+		)
+
+	case config.MiddlewareExtAuthz:
+		// Delegate authorization to an external service if configured
+		handler = s.extAuthz.Authorize(handler, route.Middlewares.ExtAuthz)
+		s.log.Info("Applied external authorization to route",
+			logger.String("path", route.Path),
+			logger.String("mode", route.Middlewares.ExtAuthz.Mode),
+			logger.String("url", route.Middlewares.ExtAuthz.URL),
+			logger.Bool("fail_open", route.Middlewares.ExtAuthz.FailOpen),
+		)
+
+	case config.MiddlewareRequestValidation:
+		// Reject requests with a disallowed content type, method or missing headers
+		handler = s.requestValidator.Validate(handler, route)
+		s.log.Info("Applied request validation to route",
+			logger.String("path", route.Path),
+			logger.Any("allowed_content_types", route.Middlewares.RequestValidation.AllowedContentTypes),
+			logger.Bool("strict_methods", route.Middlewares.RequestValidation.StrictMethods),
+		)
+
+	case config.MiddlewareRedaction:
+		// Strip response fields the caller's role or scopes don't allow
+		handler = s.redactor.Redact(handler, route)
+		s.log.Info("Applied response redaction to route",
+			logger.String("path", route.Path),
+			logger.Int("rules", len(route.Middlewares.Redaction.Rules)),
+		)
+
+	case config.MiddlewareFieldEncryption:
+		// Decrypt request fields for the upstream and encrypt response fields
+		handler = s.fieldEncryptor.Protect(handler, route)
+		s.log.Info("Applied field encryption to route",
+			logger.String("path", route.Path),
+			logger.String("key", route.Middlewares.FieldEncryption.Key),
+			logger.Any("encrypt_response", route.Middlewares.FieldEncryption.EncryptResponse),
+			logger.Any("decrypt_request", route.Middlewares.FieldEncryption.DecryptRequest),
+		)
+
+	case config.MiddlewareResponseValidation:
+		// Check sampled upstream responses against the route's OpenAPI document
+		handler = s.responseValidator.Validate(handler, route)
+		s.log.Info("Applied response validation to route",
+			logger.String("path", route.Path),
+			logger.String("spec", route.Middlewares.ResponseValidation.Spec),
+			logger.Any("sample_percent", route.Middlewares.ResponseValidation.SamplePercent),
+		)
+
+	case config.MiddlewareMQTT:
+		// Authorize MQTT-over-WebSocket connections at the upgrade
+		handler = s.mqttAuthorizer.Authorize(handler, route)
+		s.log.Info("Applied MQTT connection authorization to route",
+			logger.String("path", route.Path),
+			logger.Any("subprotocols", route.Middlewares.MQTT.Subprotocols),
+			logger.Int("max_connections_per_device", route.Middlewares.MQTT.MaxConnectionsPerDevice),
+		)
+
+	case config.MiddlewarePriority:
+		// Admit requests by their Priority header when the route is busy
+		handler = s.priorityScheduler.Schedule(handler, route)
+		s.log.Info("Applied request priority to route",
+			logger.String("path", route.Path),
+			logger.Int("max_concurrent", route.Middlewares.Priority.MaxConcurrent),
+			logger.String("default", route.Middlewares.Priority.Default),
+		)
+
+	case config.MiddlewareAuth:
+		// Apply authentication middleware if required
+		handler = s.authMiddleware.Authenticate(handler, route)
+	}
+
+	return handler
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/middleware"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyMiddlewaresOrder(t *testing.T) {
+	newRoute := func(order []string) config.Route {
+		return config.Route{
+			Path:            "/ordered",
+			MiddlewareOrder: order,
+			Middlewares: &config.Middlewares{
+				RateLimit: &config.RateLimitConfig{Requests: 1, Period: "1m"},
+				HeaderTransform: &config.HeaderTransform{
+					Response: map[string]string{"X-Transformed": "true"},
+				},
+			},
+		}
+	}
+
+	newServer := func(globalOrder []string, route config.Route) *Server {
+		log := &mockLogger{}
+		rateLimiter := middleware.NewRateLimiter(log)
+		rateLimiter.AddLimit(route.Path, *route.Middlewares.RateLimit)
+		return &Server{
+			config:            &config.Config{MiddlewareOrder: globalOrder},
+			log:               log,
+			rateLimiter:       rateLimiter,
+			headerTransformer: middleware.NewHeaderTransformer(log),
+		}
+	}
+
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// Sends two requests and returns the rate limited response
+	limitedResponse := func(handler http.Handler) *httptest.ResponseRecorder {
+		for i := 0; i < 2; i++ {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/ordered", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			handler.ServeHTTP(rec, req)
+			if i == 1 {
+				return rec
+			}
+		}
+		return nil
+	}
+
+	t.Run("default order rate limits before transforming", func(t *testing.T) {
+		route := newRoute(nil)
+		s := newServer(nil, route)
+
+		rec := limitedResponse(s.applyMiddlewares(upstream, route))
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Empty(t, rec.Header().Get("X-Transformed"))
+	})
+
+	t.Run("global order transforms rate limited responses", func(t *testing.T) {
+		route := newRoute(nil)
+		s := newServer([]string{"header_transform", "rate_limit"}, route)
+
+		rec := limitedResponse(s.applyMiddlewares(upstream, route))
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "true", rec.Header().Get("X-Transformed"))
+	})
+
+	t.Run("route order overrides global order", func(t *testing.T) {
+		route := newRoute([]string{"rate_limit", "header_transform"})
+		s := newServer([]string{"header_transform", "rate_limit"}, route)
+
+		rec := limitedResponse(s.applyMiddlewares(upstream, route))
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Empty(t, rec.Header().Get("X-Transformed"))
+	})
+}
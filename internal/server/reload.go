@@ -0,0 +1,202 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/notify"
+	"api-gateway/pkg/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// configReloadSuccess is 1 if the last reload succeeded
+	configReloadSuccess = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "gateway_config_reload_success",
+			Help: "Whether the last configuration reload succeeded (1) or failed (0)",
+		},
+	)
+
+	// configReloadTimestamp is the time of the last reload attempt
+	configReloadTimestamp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "gateway_config_reload_timestamp_seconds",
+			Help: "Unix time of the last configuration reload attempt",
+		},
+	)
+
+	// configInfo is 1 for the hash of the active configuration
+	configInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_config_info",
+			Help: "Hash of the active configuration and routes",
+		},
+		[]string{"hash"},
+	)
+)
+
+func init() {
+	// Register metrics with Prometheus
+	prometheus.MustRegister(configReloadSuccess, configReloadTimestamp, configInfo)
+}
+
+// reloadStatus tracks the active configuration and the outcome of the last
+// reload for the health endpoint
+type reloadStatus struct {
+	mutex      sync.Mutex
+	hash       string
+	lastReload time.Time
+	lastError  string
+}
+
+// configStatus is the configuration section of the health response
+type configStatus struct {
+	Hash        string     `json:"hash"`
+	LastReload  *time.Time `json:"last_reload,omitempty"`
+	ReloadOK    bool       `json:"last_reload_succeeded"`
+	ReloadError string     `json:"last_reload_error,omitempty"`
+}
+
+// newReloadStatus starts tracking from the configuration loaded at startup
+func newReloadStatus(cfg *config.Config, routes *config.RouteConfig) *reloadStatus {
+	status := &reloadStatus{hash: configHash(cfg, routes)}
+	configReloadSuccess.Set(1)
+	configInfo.Reset()
+	configInfo.WithLabelValues(status.hash).Set(1)
+	return status
+}
+
+// succeeded records a reload that made the configuration active
+func (r *reloadStatus) succeeded(hash string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.lastReload = time.Now()
+	r.lastError = ""
+	if hash != r.hash {
+		configInfo.Reset()
+		configInfo.WithLabelValues(hash).Set(1)
+		r.hash = hash
+	}
+	configReloadSuccess.Set(1)
+	configReloadTimestamp.Set(float64(r.lastReload.Unix()))
+}
+
+// failed records a reload that left the active configuration in place
+func (r *reloadStatus) failed(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.lastReload = time.Now()
+	r.lastError = err.Error()
+	configReloadSuccess.Set(0)
+	configReloadTimestamp.Set(float64(r.lastReload.Unix()))
+}
+
+// status returns the state reported by the health endpoint
+func (r *reloadStatus) status() configStatus {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	status := configStatus{
+		Hash:        r.hash,
+		ReloadOK:    r.lastError == "",
+		ReloadError: r.lastError,
+	}
+	if !r.lastReload.IsZero() {
+		lastReload := r.lastReload
+		status.LastReload = &lastReload
+	}
+	return status
+}
+
+// Reload re-reads the config and routes files. Invalid files are rejected and
+// the running configuration kept. With reload enabled, upstream changes of
+// existing routes are applied; other changes take effect on restart.
+func (s *Server) Reload(configPath, routesPath string) error {
+	cfg, routes, err := LoadConfigFiles(configPath, routesPath)
+	if err != nil {
+		s.reloadStatus.failed(err)
+		s.log.Error("Failed to reload configuration, keeping the running configuration",
+			logger.String("config_file", configPath),
+			logger.String("routes_file", routesPath),
+			logger.Error(err),
+		)
+		return err
+	}
+
+	for file, deprecations := range map[string][]string{configPath: cfg.Deprecations, routesPath: routes.Deprecations} {
+		for _, deprecation := range deprecations {
+			s.log.Warn("Deprecated configuration",
+				logger.String("config_file", file),
+				logger.String("setting", deprecation),
+			)
+		}
+	}
+	s.applyReload(cfg, routes)
+	return nil
+}
+
+// LoadConfigFiles loads and validates the config and routes files
+func LoadConfigFiles(configPath, routesPath string) (*config.Config, *config.RouteConfig, error) {
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	routes, err := config.LoadRoutes(routesPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := routes.ResolveRateLimitRefs(cfg.RateLimits); err != nil {
+		return nil, nil, err
+	}
+	if err := routes.ResolveFieldEncryptionKeys(&cfg.FieldEncryption); err != nil {
+		return nil, nil, err
+	}
+	return cfg, routes, nil
+}
+
+// applyReload applies a validated configuration
+func (s *Server) applyReload(cfg *config.Config, routes *config.RouteConfig) {
+	var changed []string
+	if s.config.Reload.Enabled {
+		changed = s.httpProxy.UpdateUpstreams(routes.Routes)
+	}
+
+	hash := configHash(cfg, routes)
+	s.reloadStatus.succeeded(hash)
+	s.log.Info("Reloaded configuration",
+		logger.String("hash", hash),
+		logger.Int("changed_upstreams", len(changed)),
+		logger.Any("paths", changed),
+	)
+	s.notifier.Notify(notify.Event{
+		Type:     config.EventConfigReloaded,
+		Severity: notify.SeverityInfo,
+		Subject:  hash,
+		Message:  fmt.Sprintf("Configuration reloaded, %d upstreams changed", len(changed)),
+		Details:  map[string]string{"hash": hash, "changed_upstreams": strings.Join(changed, ",")},
+	})
+}
+
+// configHash identifies a configuration by the SHA-256 of its parsed form, so
+// formatting and comment changes don't alter it
+func configHash(cfg *config.Config, routes *config.RouteConfig) string {
+	h := sha256.New()
+	for _, v := range []interface{}{cfg, routes} {
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
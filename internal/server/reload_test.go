@@ -0,0 +1,59 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/proxy"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	routesPath := filepath.Join(dir, "routes.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("auth:\n  jwt_secret: test-secret\n"), 0o644))
+	require.NoError(t, os.WriteFile(routesPath, []byte("routes:\n  - path: \"/users\"\n    upstream: \"http://users:8080\"\n"), 0o644))
+
+	cfg, err := config.LoadConfig(configPath)
+	require.NoError(t, err)
+	routes, err := config.LoadRoutes(routesPath)
+	require.NoError(t, err)
+	s := &Server{
+		config:       cfg,
+		routes:       routes,
+		log:          &mockLogger{},
+		httpProxy:    proxy.NewHTTPProxy(cfg, routes, &mockLogger{}),
+		reloadStatus: newReloadStatus(cfg, routes),
+	}
+	initial := s.reloadStatus.status()
+	assert.NotEmpty(t, initial.Hash)
+	assert.Nil(t, initial.LastReload)
+
+	// Unchanged files keep the hash
+	require.NoError(t, s.Reload(configPath, routesPath))
+	status := s.reloadStatus.status()
+	assert.Equal(t, initial.Hash, status.Hash)
+	assert.True(t, status.ReloadOK)
+	assert.NotNil(t, status.LastReload)
+
+	// Invalid routes are rejected and the running configuration kept
+	require.NoError(t, os.WriteFile(routesPath, []byte("routes:\n  - path: \"/users\"\n"), 0o644))
+	assert.Error(t, s.Reload(configPath, routesPath))
+	status = s.reloadStatus.status()
+	assert.Equal(t, initial.Hash, status.Hash)
+	assert.False(t, status.ReloadOK)
+	assert.Contains(t, status.ReloadError, "invalid route")
+
+	// A valid change becomes active
+	require.NoError(t, os.WriteFile(routesPath, []byte("routes:\n  - path: \"/users\"\n    upstream: \"http://users-v2:8080\"\n"), 0o644))
+	require.NoError(t, s.Reload(configPath, routesPath))
+	status = s.reloadStatus.status()
+	assert.NotEqual(t, initial.Hash, status.Hash)
+	assert.True(t, status.ReloadOK)
+	assert.Empty(t, status.ReloadError)
+}
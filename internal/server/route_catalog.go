@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// routeInfo describes a route for developer portals
+type routeInfo struct {
+	Path        string            `json:"path"`
+	Methods     []string          `json:"methods"`
+	Protocol    string            `json:"protocol,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Owner       string            `json:"owner,omitempty"`
+	DocsURL     string            `json:"docs_url,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Timeout     int               `json:"timeout"`
+	Middlewares []string          `json:"middlewares"`
+}
+
+// routeCatalog describes the running routes with their effective middleware
+// chains. Upstreams are left out as they are internal addresses.
+func (s *Server) routeCatalog() []routeInfo {
+	routes := make([]routeInfo, 0, len(s.routes.Routes))
+	for _, route := range s.routes.Routes {
+		middlewares := s.routeMiddlewares(route)
+		if middlewares == nil {
+			middlewares = []string{}
+		}
+		routes = append(routes, routeInfo{
+			Path:        route.Path,
+			Methods:     route.Methods,
+			Protocol:    route.Protocol,
+			Description: route.Description,
+			Owner:       route.Owner,
+			DocsURL:     route.DocsURL,
+			Tags:        route.Tags,
+			Labels:      route.Labels,
+			Timeout:     route.Timeout,
+			Middlewares: middlewares,
+		})
+	}
+	return routes
+}
+
+// routeCatalogHandler lists the running routes as JSON
+func (s *Server) routeCatalogHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"routes": s.routeCatalog(),
+	})
+}
+
+// portalDocsHandler serves the aggregated API docs of the developer portal:
+// the routes and the generated OpenAPI document
+func (s *Server) portalDocsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"routes":  s.routeCatalog(),
+		"openapi": "/docs/swagger/swagger.yaml",
+	})
+}
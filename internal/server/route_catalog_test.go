@@ -0,0 +1,52 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouteCatalogHandler(t *testing.T) {
+	routes, err := config.ParseRoutes([]byte(`
+routes:
+  - path: "/users"
+    upstream: "http://users:8080"
+    methods: ["GET"]
+    description: "User profiles"
+    owner: "identity-team"
+    docs_url: "https://docs.example.com/users"
+    middlewares:
+      require_auth: true
+      rate_limit:
+        requests: 10
+        period: "1m"
+  - path: "/health-check"
+    upstream: "http://health:8080"
+`))
+	require.NoError(t, err)
+	s := &Server{log: &mockLogger{}, config: &config.Config{}, routes: routes}
+
+	rec := httptest.NewRecorder()
+	s.routeCatalogHandler(rec, httptest.NewRequest("GET", "/admin/routes", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var result struct {
+		Routes []routeInfo `json:"routes"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	require.Len(t, result.Routes, 2)
+
+	users := result.Routes[0]
+	assert.Equal(t, "User profiles", users.Description)
+	assert.Equal(t, "identity-team", users.Owner)
+	assert.Equal(t, "https://docs.example.com/users", users.DocsURL)
+	assert.Equal(t, []string{config.MiddlewareAuth, config.MiddlewareRateLimit}, users.Middlewares)
+	assert.Equal(t, []string{}, result.Routes[1].Middlewares)
+	assert.NotContains(t, rec.Body.String(), "users:8080")
+}
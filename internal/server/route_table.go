@@ -0,0 +1,265 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// routeMatchDuration tracks how long finding the route of a request takes
+	routeMatchDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "gateway_route_match_duration_seconds",
+			Help:    "Time spent matching requests to configured routes",
+			Buckets: prometheus.ExponentialBuckets(0.000001, 4, 8), // 1µs to 16ms
+		},
+	)
+
+	// routeTableSize is the number of route entries in the route table
+	routeTableSize = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_route_table_entries",
+			Help: "Configured routes in the route table, by how their path is matched",
+		},
+		[]string{"match"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(routeMatchDuration, routeTableSize)
+}
+
+// routeTable matches requests to the configured routes through a radix tree
+// of their paths, so matching doesn't slow down with the number of routes as
+// gorilla/mux's scan of every route does. Paths keep their mux semantics:
+// "/prefix/*" matches paths starting with "/prefix/", other paths match
+// exactly, and of several matching routes the first registered wins. Paths
+// with {variables} are matched by mux, in registration order.
+type routeTable struct {
+	root     radixNode
+	patterns []*tableRoute
+	count    int
+	// Entries by how their path is matched, for the table size metric
+	entries map[string]int
+}
+
+// tableRoute is a route registered in the table
+type tableRoute struct {
+	order   int
+	methods []string
+	handler http.Handler
+	// The mux route matching a path with variables (nil for plain paths)
+	pattern *mux.Route
+}
+
+// radixNode is a node of the path tree. A node's path is the segments of
+// the nodes from the root down to it.
+type radixNode struct {
+	segment  string
+	children []*radixNode
+	// Routes whose path is the node's path
+	exact []*tableRoute
+	// Routes matching every path starting with the node's path
+	prefixed []*tableRoute
+}
+
+// newRouteTable creates an empty route table
+func newRouteTable() *routeTable {
+	return &routeTable{entries: make(map[string]int)}
+}
+
+// add registers handler for requests to path with one of methods, or any
+// method if none are given. A path ending in "/*" matches every path under
+// it.
+func (t *routeTable) add(path string, methods []string, handler http.Handler) error {
+	route := &tableRoute{order: t.count, handler: handler}
+	for _, method := range methods {
+		route.methods = append(route.methods, strings.ToUpper(method))
+	}
+
+	prefix := strings.HasSuffix(path, "/*")
+	key := path
+	if prefix {
+		key = strings.TrimRight(path, "/*") + "/"
+	}
+
+	if strings.Contains(path, "{") {
+		// Lay the route out as mux would have, for its template matching
+		scratch := mux.NewRouter()
+		if prefix {
+			route.pattern = scratch.PathPrefix(strings.TrimRight(path, "/*")).Subrouter().PathPrefix("/")
+		} else {
+			route.pattern = scratch.PathPrefix("/").Path(path)
+		}
+		if err := route.pattern.GetError(); err != nil {
+			return err
+		}
+		t.patterns = append(t.patterns, route)
+		t.count++
+		t.entries["pattern"]++
+		routeTableSize.WithLabelValues("pattern").Set(float64(t.entries["pattern"]))
+		return nil
+	}
+
+	t.root.insert(key, route, prefix)
+	kind := "exact"
+	if prefix {
+		kind = "prefix"
+	}
+	t.count++
+	t.entries[kind]++
+	routeTableSize.WithLabelValues(kind).Set(float64(t.entries[kind]))
+	return nil
+}
+
+// match is a mux matcher selecting the table's handler for req. A path
+// matched only by routes for other methods fails with ErrMethodMismatch, so
+// mux answers 405.
+func (t *routeTable) match(req *http.Request, match *mux.RouteMatch) bool {
+	start := time.Now()
+	route, vars, pathMatched := t.find(req)
+	routeMatchDuration.Observe(time.Since(start).Seconds())
+
+	if route == nil {
+		if pathMatched {
+			match.MatchErr = mux.ErrMethodMismatch
+		}
+		return false
+	}
+
+	// An earlier route for another method doesn't stop this one
+	if match.MatchErr == mux.ErrMethodMismatch {
+		match.MatchErr = nil
+	}
+	match.Handler = route.handler
+	if len(vars) > 0 {
+		if match.Vars == nil {
+			match.Vars = make(map[string]string, len(vars))
+		}
+		for name, value := range vars {
+			match.Vars[name] = value
+		}
+	}
+	return true
+}
+
+// find returns the first registered route matching req with the path
+// variables of pattern routes, and whether any route matched the path
+func (t *routeTable) find(req *http.Request) (*tableRoute, map[string]string, bool) {
+	var best *tableRoute
+	pathMatched := false
+	consider := func(routes []*tableRoute) {
+		for _, route := range routes {
+			pathMatched = true
+			if (best == nil || route.order < best.order) && route.allows(req.Method) {
+				best = route
+			}
+		}
+	}
+
+	path := req.URL.Path
+	node := &t.root
+	for {
+		consider(node.prefixed)
+		if path == "" {
+			consider(node.exact)
+			break
+		}
+		child := node.child(path[0])
+		if child == nil || !strings.HasPrefix(path, child.segment) {
+			break
+		}
+		path = path[len(child.segment):]
+		node = child
+	}
+
+	// Routes with variables only win if registered before the tree's match
+	for _, route := range t.patterns {
+		if best != nil && route.order > best.order {
+			break
+		}
+		var probe mux.RouteMatch
+		if !route.pattern.Match(req, &probe) {
+			continue
+		}
+		pathMatched = true
+		if route.allows(req.Method) {
+			return route, probe.Vars, true
+		}
+	}
+	return best, nil, pathMatched
+}
+
+// allows reports whether the route serves method
+func (r *tableRoute) allows(method string) bool {
+	if len(r.methods) == 0 {
+		return true
+	}
+	for _, m := range r.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// insert adds route to the tree under key, splitting nodes where key
+// diverges from their segment
+func (n *radixNode) insert(key string, route *tableRoute, prefix bool) {
+	node := n
+	for key != "" {
+		child := node.child(key[0])
+		if child == nil {
+			child = &radixNode{segment: key}
+			node.children = append(node.children, child)
+			node = child
+			break
+		}
+
+		common := commonPrefixLength(key, child.segment)
+		if common < len(child.segment) {
+			split := &radixNode{
+				segment:  child.segment[common:],
+				children: child.children,
+				exact:    child.exact,
+				prefixed: child.prefixed,
+			}
+			child.segment = child.segment[:common]
+			child.children = []*radixNode{split}
+			child.exact = nil
+			child.prefixed = nil
+		}
+		node = child
+		key = key[common:]
+	}
+
+	if prefix {
+		node.prefixed = append(node.prefixed, route)
+	} else {
+		node.exact = append(node.exact, route)
+	}
+}
+
+// child returns the child whose segment starts with b. Siblings never share
+// a first byte.
+func (n *radixNode) child(b byte) *radixNode {
+	for _, child := range n.children {
+		if child.segment[0] == b {
+			return child
+		}
+	}
+	return nil
+}
+
+// commonPrefixLength returns the length of the longest common prefix of a and b
+func commonPrefixLength(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"api-gateway/internal/config"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// namedHandler answers with its name and the path variables
+func namedHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name))
+		if vars := mux.Vars(r); len(vars) > 0 {
+			fmt.Fprint(w, vars)
+		}
+	})
+}
+
+// registerMuxRoute lays a route out on router the way routes were registered
+// with gorilla/mux before the route table
+func registerMuxRoute(router *mux.Router, path string, methods []string, handler http.Handler) {
+	var routeRouter *mux.Router
+	if strings.HasSuffix(path, "/*") {
+		path = strings.TrimRight(path, "/*")
+		routeRouter = router.PathPrefix(path).Subrouter()
+	}
+	if len(methods) == 0 {
+		methods = []string{""}
+	}
+	for _, method := range methods {
+		var route *mux.Route
+		if routeRouter == nil {
+			route = router.PathPrefix("/").Path(path).Handler(handler)
+		} else {
+			route = routeRouter.PathPrefix("/").Handler(handler)
+		}
+		if method != "" {
+			route.Methods(method)
+		}
+	}
+}
+
+func TestRouteTableMatchesMux(t *testing.T) {
+	routes := []struct {
+		path    string
+		methods []string
+	}{
+		{"/api/v1/users/*", []string{"GET", "POST"}},
+		{"/api/v1/users/me", nil},
+		{"/api/v1/*", nil},
+		{"/api/v1/orders", []string{"DELETE"}},
+		{"/user", nil},
+		{"/users", []string{"get"}},
+		{"/usage/*", nil},
+		{"/items/{id:[0-9]+}", []string{"GET"}},
+		{"/tenants/{tenant}/*", nil},
+		{"/health", nil},
+		{"/", nil},
+	}
+
+	table := newRouteTable()
+	tableRouter := mux.NewRouter()
+	tableRouter.MatcherFunc(table.match)
+	muxRouter := mux.NewRouter()
+	for i, route := range routes {
+		handler := namedHandler(fmt.Sprintf("route%d", i))
+		require.NoError(t, table.add(route.path, route.methods, handler))
+		registerMuxRoute(muxRouter, route.path, route.methods, handler)
+	}
+
+	// Paths routed only for other methods answer 405 from the table. mux
+	// v1.8.1 answers these 404 once a later route partly matches them, which
+	// the server's not-found handler corrects.
+	methodNotAllowed := map[string]bool{"POST /users": true, "POST /items/12": true}
+
+	requests := []struct{ method, path string }{
+		{"GET", "/api/v1/users/42"},
+		{"DELETE", "/api/v1/users/42"},
+		{"GET", "/api/v1/users/me"},
+		{"GET", "/api/v1/users"},
+		{"GET", "/api/v1/"},
+		{"GET", "/api/v1"},
+		{"DELETE", "/api/v1/orders"},
+		{"GET", "/api/v1/orders"},
+		{"GET", "/user"},
+		{"GET", "/users"},
+		{"POST", "/users"},
+		{"GET", "/usage"},
+		{"GET", "/usage/daily"},
+		{"GET", "/items/12"},
+		{"POST", "/items/12"},
+		{"GET", "/items/abc"},
+		{"PUT", "/tenants/acme/settings"},
+		{"GET", "/tenants/acme"},
+		{"GET", "/health"},
+		{"GET", "/"},
+		{"GET", "/missing"},
+	}
+	for _, req := range requests {
+		t.Run(req.method+" "+req.path, func(t *testing.T) {
+			got := httptest.NewRecorder()
+			tableRouter.ServeHTTP(got, httptest.NewRequest(req.method, req.path, nil))
+			if methodNotAllowed[req.method+" "+req.path] {
+				assert.Equal(t, http.StatusMethodNotAllowed, got.Code)
+				return
+			}
+
+			want := httptest.NewRecorder()
+			muxRouter.ServeHTTP(want, httptest.NewRequest(req.method, req.path, nil))
+
+			assert.Equal(t, want.Code, got.Code)
+			assert.Equal(t, want.Body.String(), got.Body.String())
+		})
+	}
+}
+
+func TestRouteTableOrder(t *testing.T) {
+	table := newRouteTable()
+	require.NoError(t, table.add("/api/*", nil, namedHandler("prefix")))
+	require.NoError(t, table.add("/api/users", nil, namedHandler("exact")))
+	require.NoError(t, table.add("/api/items", []string{"POST"}, namedHandler("items")))
+	router := mux.NewRouter()
+	router.MatcherFunc(table.match)
+
+	// The first registered route wins over a longer match
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/users", nil))
+	assert.Equal(t, "prefix", rec.Body.String())
+
+	// Paths matched only for other methods answer 405
+	table = newRouteTable()
+	require.NoError(t, table.add("/api/items", []string{"POST"}, namedHandler("items")))
+	router = mux.NewRouter()
+	router.MatcherFunc(table.match)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/items", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestAddRouteToTable(t *testing.T) {
+	s := newFallbackTestServer(config.NotFoundConfig{})
+	s.router = mux.NewRouter()
+	s.routeTable = newRouteTable()
+	s.router.MatcherFunc(s.routeTable.match)
+	s.addRouteToTable("/orders/*", []string{"GET"}, namedHandler("orders"))
+	s.addRouteToTable("/items/{id:[}", nil, namedHandler("broken"))
+	s.registerFallbackHandlers(nil)
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest("GET", "/orders/1", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest("DELETE", "/orders/1", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "GET", rec.Header().Get("Allow"))
+
+	// Invalid paths are left out rather than failing the other routes
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest("GET", "/items/1", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+// benchmarkRoutes registers n routes and returns a request for the last one,
+// the worst case for a scan in registration order
+func benchmarkRoutes(n int, add func(path string, methods []string, handler http.Handler)) *http.Request {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for i := 0; i < n; i++ {
+		add(fmt.Sprintf("/api/v1/service%d/*", i), []string{"GET", "POST"}, ok)
+		add(fmt.Sprintf("/api/v1/service%d/status", i), nil, ok)
+	}
+	return httptest.NewRequest("GET", fmt.Sprintf("/api/v1/service%d/items/42", n-1), nil)
+}
+
+func BenchmarkRouteMatchMux(b *testing.B) {
+	router := mux.NewRouter()
+	req := benchmarkRoutes(250, func(path string, methods []string, handler http.Handler) {
+		registerMuxRoute(router, path, methods, handler)
+	})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var match mux.RouteMatch
+		if !router.Match(req, &match) {
+			b.Fatal("no route matched")
+		}
+	}
+}
+
+func BenchmarkRouteMatchTable(b *testing.B) {
+	table := newRouteTable()
+	router := mux.NewRouter()
+	router.MatcherFunc(table.match)
+	req := benchmarkRoutes(250, func(path string, methods []string, handler http.Handler) {
+		table.add(path, methods, handler)
+	})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var match mux.RouteMatch
+		if !router.Match(req, &match) {
+			b.Fatal("no route matched")
+		}
+	}
+}
@@ -4,20 +4,27 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"strings"
 	"time"
 
 	"api-gateway/internal/auth"
+	"api-gateway/internal/cluster"
 	"api-gateway/internal/config"
-	"api-gateway/internal/handlers"
 	"api-gateway/internal/middleware"
+	"api-gateway/internal/notify"
+	"api-gateway/internal/portal"
 	"api-gateway/internal/proxy"
+	"api-gateway/internal/spiffe"
+	"api-gateway/internal/statsd"
 	"api-gateway/internal/swagger"
 	"api-gateway/internal/util"
 	"api-gateway/pkg/logger"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
@@ -29,75 +36,305 @@ type Server struct {
 	httpServer        *http.Server
 	grpcServer        *GRPCServer
 	router            *mux.Router
+	routeTable        *routeTable
 	authService       *auth.AuthService
 	httpProxy         *proxy.HTTPProxy
 	wsProxy           *proxy.WSProxy
+	grpcBridge        *proxy.GRPCBridge
 	authMiddleware    *middleware.AuthMiddleware
 	cacheMiddleware   *middleware.CacheMiddleware
+	requestCollapser  *middleware.RequestCollapser
 	rateLimiter       *middleware.RateLimiter
 	headerTransformer *middleware.HeaderTransformer
 	urlRewriter       *middleware.URLRewriter
 	retryMiddleware   *middleware.RetryMiddleware
 	metricsMiddleware *middleware.MetricsMiddleware
+	tracingMiddleware *middleware.TracingMiddleware
+	sloTracker        *middleware.SLOTracker
+	statsdExporter    *statsd.Exporter
+	connections       *connTracker
+	inflight          *inflightTracker
 	corsMiddleware    *middleware.CORSMiddleware
+	decompressor      *middleware.RequestDecompressor
+	compressor        *middleware.ResponseCompressor
+	requestValidator  *middleware.RequestValidator
+	responseValidator *middleware.ResponseValidator
+	fieldEncryptor    *middleware.FieldEncryptor
+	redactor          *middleware.Redactor
+	priorityScheduler *middleware.PriorityScheduler
+	mqttAuthorizer    *middleware.MQTTAuthorizer
+	l4Proxy           *proxy.L4Proxy
+	featureFlags      *middleware.FeatureFlags
+	extAuthz          *middleware.ExtAuthz
+	opaMiddleware     *middleware.OPAMiddleware
+	bodyRewriter      *middleware.BodyRewriter
+	accessLogger      *middleware.AccessLogger
+	usageRecorder     *middleware.UsageRecorder
+	testTraffic       *middleware.TestTraffic
+	logLevels         *logger.Levels
+	reloadStatus      *reloadStatus
+	cluster           *cluster.Cluster
+	portal            *portal.Portal
+	notifier          *notify.Notifier
+	certMonitor       *certMonitor
+	spiffe            *spiffe.Source
+	descriptors       *proxy.DescriptorRegistry
+	// Serves mesh workloads presenting an SVID (nil if off)
+	internalServer *http.Server
+	// Closed once the routes' service discoveries have synced
+	ready <-chan struct{}
 }
 
 // NewServer creates a new server instance
 func NewServer(cfg *config.Config, routes *config.RouteConfig, log logger.Logger) *Server {
 	router := mux.NewRouter()
 
-	// Initialize services
-	authService := auth.NewAuthService(&cfg.Auth, log)
-	httpProxy := proxy.NewHTTPProxy(cfg, routes, log)
-	wsProxy := proxy.NewWSProxy(cfg, routes, log)
+	// Initialize services. Each component logs through its own logger so its
+	// level can be changed at runtime.
+	authService := auth.NewAuthService(&cfg.Auth, logger.Component(log, "auth"))
+	httpProxy := proxy.NewHTTPProxy(cfg, routes, logger.Component(log, "proxy"))
+	wsProxy := proxy.NewWSProxy(cfg, routes, logger.Component(log, "proxy.websocket"))
+	grpcBridge := proxy.NewGRPCBridge(logger.Component(log, "proxy.grpc_bridge"))
+
+	// Load the descriptors of gRPC services not compiled into the gateway
+	var descriptors *proxy.DescriptorRegistry
+	if cfg.GRPC.Descriptors.Dir != "" {
+		descriptors = proxy.NewDescriptorRegistry(&cfg.GRPC.Descriptors, logger.Component(log, "proxy.grpc_descriptors"))
+		grpcBridge.SetDescriptors(descriptors)
+	}
 
 	// Initialize middleware
-	authMiddleware := middleware.NewAuthMiddleware(authService, &cfg.Auth, log)
-	cacheMiddleware := middleware.NewCacheMiddleware(&cfg.Cache, log)
-	rateLimiter := middleware.NewRateLimiter(log)
-	headerTransformer := middleware.NewHeaderTransformer(log)
-	urlRewriter := middleware.NewURLRewriter(log)
-	retryMiddleware := middleware.NewRetryMiddleware(log)
-	metricsMiddleware := middleware.NewMetricsMiddleware(&cfg.Metrics, log)
+	authMiddleware := middleware.NewAuthMiddleware(authService, &cfg.Auth, logger.Component(log, "middleware.auth"))
+	cacheMiddleware := middleware.NewCacheMiddleware(&cfg.Cache, logger.Component(log, "middleware.cache"))
+	if cfg.Cache.Directives.Enabled {
+		cacheMiddleware.SetDirectiveAuthorizer(operatorAuthorizer(authService, cfg.Cache.Directives.AllowedRoles), cfg.Auth.JWTHeader, cfg.Auth.APIKeyHeader)
+	}
+	requestCollapser := middleware.NewRequestCollapser(logger.Component(log, "middleware.collapse"))
+	rateLimiter := middleware.NewRateLimiter(logger.Component(log, "middleware.rate_limit"))
+	if cfg.Auth.APIKeyHeader != "" {
+		rateLimiter.SetAPIKeyHeader(cfg.Auth.APIKeyHeader)
+	}
+	headerTransformer := middleware.NewHeaderTransformer(logger.Component(log, "middleware.header_transform"))
+	urlRewriter := middleware.NewURLRewriter(logger.Component(log, "middleware.url_rewrite"))
+	retryMiddleware := middleware.NewRetryMiddleware(logger.Component(log, "middleware.retry"))
+	metricsMiddleware := middleware.NewMetricsMiddleware(&cfg.Metrics, logger.Component(log, "middleware.metrics"))
+	decompressor := middleware.NewRequestDecompressor(logger.Component(log, "middleware.request_decompression"))
+	compressor := middleware.NewResponseCompressor(logger.Component(log, "middleware.compression"))
+	requestValidator := middleware.NewRequestValidator(logger.Component(log, "middleware.request_validation"))
+	extAuthz := middleware.NewExtAuthz(logger.Component(log, "middleware.ext_authz"))
+	opaMiddleware := middleware.NewOPAMiddleware(&cfg.OPA, logger.Component(log, "middleware.opa"))
+	bodyRewriter := middleware.NewBodyRewriter(logger.Component(log, "middleware.body_rewrite"))
+	tracingMiddleware := middleware.NewTracingMiddleware(&cfg.Tracing, logger.Component(log, "tracing"))
+	sloTracker := middleware.NewSLOTracker(&cfg.SLO, logger.Component(log, "slo"))
+
+	// Per-route metrics are labeled with every label name declared by a route
+	metricsMiddleware.RegisterRouteLabels(routes.Routes)
+
+	// Push metrics to a StatsD agent if enabled
+	var statsdExporter *statsd.Exporter
+	if cfg.Metrics.Enabled && cfg.Metrics.StatsD.Enabled {
+		var err error
+		statsdExporter, err = statsd.New(&cfg.Metrics.StatsD, prometheus.DefaultGatherer, logger.Component(log, "statsd"))
+		if err != nil {
+			log.Error("Failed to initialize StatsD exporter", logger.Error(err))
+		} else {
+			metricsMiddleware.SetTimingSink(statsdExporter)
+		}
+	}
+
+	var featureFlags *middleware.FeatureFlags
+	if cfg.FeatureFlags.Enabled {
+		featureFlags = middleware.NewFeatureFlags(&cfg.FeatureFlags, logger.Component(log, "feature_flags"))
+	}
+
+	// Issue API keys through the developer portal
+	var developerPortal *portal.Portal
+	if cfg.Portal.Enabled {
+		var err error
+		developerPortal, err = portal.New(&cfg.Portal, cfg.Auth.APIKeyHeader, logger.Component(log, "portal"))
+		if err != nil {
+			log.Error("Failed to initialize developer portal", logger.Error(err))
+		} else {
+			authService.SetAPIKeyLookup(developerPortal.LookupKey)
+		}
+	}
+
+	var usageRecorder *middleware.UsageRecorder
+	if cfg.Usage.Enabled {
+		usageRecorder = middleware.NewUsageRecorder(&cfg.Usage, cfg.Auth.APIKeyHeader, logger.Component(log, "usage"))
+	}
+
+	// Recognize signed end-to-end test requests
+	var testTraffic *middleware.TestTraffic
+	if cfg.TestTraffic.Enabled {
+		testTraffic = middleware.NewTestTraffic(&cfg.TestTraffic, logger.Component(log, "middleware.test_traffic"))
+	}
+
+	// Post operational events to webhooks
+	var notifier *notify.Notifier
+	if cfg.Notifications.Enabled {
+		notifier = notify.New(&cfg.Notifications, logger.Component(log, "notify"))
+		httpProxy.SetNotifier(notifier)
+	}
+	mqttAuthorizer := middleware.NewMQTTAuthorizer(authService, notifier, logger.Component(log, "middleware.mqtt"))
+
+	// Obtain the gateway's workload identity from the SPIRE agent
+	var spiffeSource *spiffe.Source
+	if cfg.SPIFFE.Enabled {
+		spiffeSource = spiffe.New(&cfg.SPIFFE, logger.Component(log, "spiffe"))
+		httpProxy.SetSPIFFE(spiffeSource)
+	}
+
+	// Forward raw TCP and UDP traffic from the L4 listeners
+	var l4Proxy *proxy.L4Proxy
+	if cfg.L4Proxy.Enabled {
+		var err error
+		l4Proxy, err = proxy.NewL4Proxy(&cfg.L4Proxy, httpProxy.HealthChecks(), logger.Component(log, "l4proxy"))
+		if err != nil {
+			log.Error("Failed to initialize L4 proxy", logger.Error(err))
+		}
+	}
+
+	var accessLogger *middleware.AccessLogger
+	if cfg.Logging.EnableAccess {
+		accessLogger = middleware.NewAccessLogger(&cfg.Logging.AccessLog, logger.Component(log, "access"))
+	}
 
 	// Initialize gRPC server
-	grpcServer := NewGRPCServer(cfg, routes, log)
+	grpcServer := NewGRPCServer(cfg, routes, logger.Component(log, "grpc"))
+	grpcServer.SetAuthService(authService)
+	if descriptors != nil {
+		grpcServer.SetDescriptors(descriptors)
+	}
+
+	// Initialize cluster membership if enabled
+	var gatewayCluster *cluster.Cluster
+	if cfg.Cluster.Enabled {
+		var err error
+		gatewayCluster, err = cluster.New(&cfg.Cluster, logger.Component(log, "cluster"))
+		if err != nil {
+			log.Error("Failed to initialize cluster mode, running standalone", logger.Error(err))
+		}
+	}
 
 	// Convert CorsConfig to CORSConfig
 	corsConfig := &config.CORSConfig{
-		Enabled:          cfg.Cors.Enabled,
-		AllowAllOrigins:  cfg.Cors.AllowAllOrigins,
-		AllowedOrigins:   cfg.Cors.AllowedOrigins,
-		AllowedMethods:   cfg.Cors.AllowedMethods,
-		AllowedHeaders:   cfg.Cors.AllowedHeaders,
-		ExposedHeaders:   cfg.Cors.ExposedHeaders,
-		AllowCredentials: cfg.Cors.AllowCredentials,
-		MaxAge:           cfg.Cors.MaxAge,
+		Enabled:               cfg.Cors.Enabled,
+		AllowAllOrigins:       cfg.Cors.AllowAllOrigins,
+		AllowedOrigins:        cfg.Cors.AllowedOrigins,
+		AllowedOriginPatterns: cfg.Cors.AllowedOriginPatterns,
+		ReflectOrigin:         cfg.Cors.ReflectOrigin,
+		OriginCacheSize:       cfg.Cors.OriginCacheSize,
+		AllowedMethods:        cfg.Cors.AllowedMethods,
+		AllowedHeaders:        cfg.Cors.AllowedHeaders,
+		ExposedHeaders:        cfg.Cors.ExposedHeaders,
+		AllowCredentials:      cfg.Cors.AllowCredentials,
+		MaxAge:                cfg.Cors.MaxAge,
 	}
-	corsMiddleware := middleware.NewCORSMiddleware(corsConfig, log)
+	corsMiddleware := middleware.NewCORSMiddleware(corsConfig, logger.Component(log, "middleware.cors"))
 
 	// Setup rate limiters for routes with rate limiting enabled
 	for _, route := range routes.Routes {
 		if route.Middlewares.RateLimit != nil && route.Middlewares.RateLimit.Requests > 0 {
-			rateLimiter.AddLimit(route.Path, *route.Middlewares.RateLimit)
+			rateLimiter.AddLimit(middleware.RateLimitKey(route), *route.Middlewares.RateLimit)
 		}
 	}
 
-	// Create HTTP server
+	// Create HTTP server, tracking client connections for metrics, the debug
+	// endpoints and the keep-alive limits
+	connections := newConnTracker(&cfg.Server.KeepAlive)
+	idleTimeout := 120 * time.Second
+	if cfg.Server.IdleTimeout > 0 {
+		idleTimeout = time.Duration(cfg.Server.IdleTimeout) * time.Second
+	}
 	httpServer := &http.Server{
 		Addr:         cfg.Server.Address,
 		Handler:      router,
 		ReadTimeout:  time.Duration(cfg.Server.ReadTimeout) * time.Second,
 		WriteTimeout: time.Duration(cfg.Server.WriteTimeout) * time.Second,
-		IdleTimeout:  120 * time.Second,
+		IdleTimeout:  idleTimeout,
+		ConnState:    connections.track,
+		ConnContext:  connections.connContext,
+	}
+
+	// Strip internal headers before any middleware can trust them. Wrapping
+	// the router also covers the catch-all route, which router middleware
+	// doesn't see.
+	if cfg.Security.StripHeaders.Enabled {
+		headerStripper := middleware.NewHeaderStripper(&cfg.Security.StripHeaders, logger.Component(log, "middleware.strip_headers"))
+		httpServer.Handler = headerStripper.Strip(router)
+		log.Info("Applied internal header stripping globally",
+			logger.Any("headers", cfg.Security.StripHeaders.Headers),
+			logger.Any("prefixes", cfg.Security.StripHeaders.Prefixes),
+		)
+	}
+
+	// Reject clients that keep failing before they reach auth or upstreams
+	if cfg.Security.ClientBreaker.Enabled {
+		clientBreaker := middleware.NewClientBreaker(&cfg.Security.ClientBreaker, logger.Component(log, "middleware.client_breaker"))
+		httpServer.Handler = clientBreaker.Protect(httpServer.Handler)
+		log.Info("Applied per-client breaker globally",
+			logger.Any("statuses", cfg.Security.ClientBreaker.Statuses),
+			logger.Int("threshold", cfg.Security.ClientBreaker.Threshold),
+			logger.Int("window", cfg.Security.ClientBreaker.Window),
+		)
 	}
 
+	// Add timing and identity headers, timing everything but the keep-alive
+	// bookkeeping
+	if cfg.Server.ResponseHeaders.Enabled {
+		responseMetadata := middleware.NewResponseMetadata(&cfg.Server.ResponseHeaders, logger.Component(log, "middleware.response_headers"))
+		httpServer.Handler = responseMetadata.Inject(httpServer.Handler)
+		log.Info("Applied response metadata headers globally",
+			logger.Bool("upstream_latency", cfg.Server.ResponseHeaders.UpstreamLatency),
+			logger.Bool("gateway_latency", cfg.Server.ResponseHeaders.GatewayLatency),
+			logger.Bool("served_by", cfg.Server.ResponseHeaders.ServedBy),
+		)
+	}
+
+	// Count requests per client connection and close connections past the
+	// keep-alive limits
+	httpServer.Handler = connections.limitKeepAlive(httpServer.Handler)
+
+	// Count the requests in flight so shutdown can report the drain
+	inflight := newInflightTracker()
+	httpServer.Handler = inflight.track(httpServer.Handler)
+
 	// Apply global middleware
 	// CORS middleware should be first in the chain
 	if cfg.Cors.Enabled {
 		router.Use(corsMiddleware.CORS)
 		log.Info("Applied CORS middleware globally")
 	}
+	if cfg.Tracing.Enabled {
+		router.Use(tracingMiddleware.Tracing)
+		log.Info("Applied tracing middleware globally")
+	}
+	if cfg.Server.SlowClient.Enabled {
+		slowClientGuard := middleware.NewSlowClientGuard(&cfg.Server, logger.Component(log, "middleware.slow_client"))
+		router.Use(slowClientGuard.Guard)
+		log.Info("Applied slow client protection globally",
+			logger.Int("min_read_rate", cfg.Server.SlowClient.MinReadRate),
+			logger.Int("min_write_rate", cfg.Server.SlowClient.MinWriteRate),
+		)
+	}
+
+	// Serve mesh workloads over mTLS, requiring an SVID from each
+	var internalServer *http.Server
+	if spiffeSource != nil && cfg.SPIFFE.InternalAddress != "" {
+		internalServer = &http.Server{
+			Addr:         cfg.SPIFFE.InternalAddress,
+			Handler:      httpServer.Handler,
+			TLSConfig:    spiffeSource.ServerTLSConfig(cfg.SPIFFE.AllowedIDs),
+			ReadTimeout:  httpServer.ReadTimeout,
+			WriteTimeout: httpServer.WriteTimeout,
+			IdleTimeout:  httpServer.IdleTimeout,
+			// Split-horizon routes send these requests to internal upstreams
+			BaseContext: func(net.Listener) context.Context {
+				return proxy.WithInternalListener(context.Background())
+			},
+		}
+	}
 
 	return &Server{
 		config:            cfg,
@@ -109,19 +346,53 @@ func NewServer(cfg *config.Config, routes *config.RouteConfig, log logger.Logger
 		authService:       authService,
 		httpProxy:         httpProxy,
 		wsProxy:           wsProxy,
+		grpcBridge:        grpcBridge,
 		authMiddleware:    authMiddleware,
 		cacheMiddleware:   cacheMiddleware,
+		requestCollapser:  requestCollapser,
 		rateLimiter:       rateLimiter,
 		headerTransformer: headerTransformer,
 		urlRewriter:       urlRewriter,
 		retryMiddleware:   retryMiddleware,
 		metricsMiddleware: metricsMiddleware,
+		tracingMiddleware: tracingMiddleware,
+		sloTracker:        sloTracker,
+		statsdExporter:    statsdExporter,
+		connections:       connections,
+		inflight:          inflight,
 		corsMiddleware:    corsMiddleware,
+		decompressor:      decompressor,
+		compressor:        compressor,
+		requestValidator:  requestValidator,
+		responseValidator: middleware.NewResponseValidator(logger.Component(log, "middleware.response_validation")),
+		fieldEncryptor:    middleware.NewFieldEncryptor(&cfg.FieldEncryption, logger.Component(log, "middleware.field_encryption")),
+		redactor:          middleware.NewRedactor(logger.Component(log, "middleware.redaction")),
+		priorityScheduler: middleware.NewPriorityScheduler(logger.Component(log, "middleware.priority")),
+		mqttAuthorizer:    mqttAuthorizer,
+		l4Proxy:           l4Proxy,
+		featureFlags:      featureFlags,
+		portal:            developerPortal,
+		extAuthz:          extAuthz,
+		opaMiddleware:     opaMiddleware,
+		bodyRewriter:      bodyRewriter,
+		accessLogger:      accessLogger,
+		usageRecorder:     usageRecorder,
+		testTraffic:       testTraffic,
+		notifier:          notifier,
+		certMonitor:       newCertMonitor(cfg, notifier, logger.Component(log, "certificates")),
+		spiffe:            spiffeSource,
+		descriptors:       descriptors,
+		internalServer:    internalServer,
+		logLevels:         logger.LevelsOf(log),
+		reloadStatus:      newReloadStatus(cfg, routes),
+		cluster:           gatewayCluster,
 	}
 }
 
 // Start initializes and starts the server
 func (s *Server) Start() error {
+	start := time.Now()
+
 	// Generate Swagger documentation
 	if err := swagger.WriteSwaggerFile(s.routes, "docs/swagger/swagger.yaml"); err != nil {
 		s.log.Error("Failed to generate Swagger documentation", logger.Error(err))
@@ -130,18 +401,90 @@ func (s *Server) Start() error {
 		s.log.Info("Generated Swagger documentation", logger.String("path", "docs/swagger/swagger.yaml"))
 	}
 
+	// Deliver notifications
+	if s.notifier != nil {
+		s.notifier.Start()
+	}
+
+	// Watch the configured certificates for expiry
+	if s.certMonitor != nil {
+		s.certMonitor.Start()
+	}
+
+	// Watch the Workload API for the gateway's SVID
+	if s.spiffe != nil {
+		s.spiffe.Start()
+	}
+
+	// Reload gRPC descriptors when the directory changes
+	if s.descriptors != nil {
+		s.descriptors.Start()
+	}
+
 	// Register routes
-	for _, route := range s.routes.Routes {
-		// Skip gRPC routes for HTTP server - they'll be handled by gRPC server
-		if route.Protocol == config.ProtocolGRPC {
-			continue
+	s.registerRoutes()
+
+	// Discovered routes answer 503 until their initial sync
+	s.ready = s.httpProxy.Ready()
+	go func() {
+		<-s.ready
+		s.log.Info("API Gateway ready",
+			logger.Int("time_to_ready_ms", int(time.Since(start).Milliseconds())),
+		)
+	}()
+
+	// Load the policy bundles routes evaluate
+	if s.opaMiddleware != nil {
+		s.opaMiddleware.Start()
+	}
+
+	// Join the gateway cluster
+	if s.cluster != nil {
+		if err := s.cluster.Start(); err != nil {
+			s.log.Error("Failed to start cluster node, running standalone", logger.Error(err))
+			s.cluster = nil
 		}
-		s.registerRoute(route)
+	}
+	if s.cluster != nil && s.cacheMiddleware != nil {
+		s.propagateCachePurges()
+	}
+	if s.cluster != nil && s.config.Cluster.ShareCircuitBreakers {
+		s.propagateBreakerStates()
+	}
+
+	// Evaluate route SLO burn rates
+	if s.sloTracker != nil {
+		s.sloTracker.Start()
+	}
+
+	// Reload feature flags when the flags file changes
+	if s.featureFlags != nil {
+		s.featureFlags.Start()
+	}
+
+	// Push metrics to StatsD
+	if s.statsdExporter != nil {
+		s.statsdExporter.Start()
+	}
+
+	// Save portal key usage periodically
+	if s.portal != nil {
+		s.portal.Start()
+	}
+
+	// Export usage for billing
+	if s.usageRecorder != nil {
+		s.usageRecorder.Start()
 	}
 
 	// Register additional utility endpoints
 	s.registerUtilityEndpoints()
 
+	// Prefetch configured paths into the cache once routes are in place
+	if s.config.Cache.Enabled && s.config.Cache.Warm.OnStartup && len(s.config.Cache.Warm.Paths) > 0 {
+		go s.cacheMiddleware.Warm(context.Background(), s.router, s.config.Cache.Warm.Paths, s.config.Cache.Warm.Host, nil)
+	}
+
 	// Start the HTTP server
 	s.log.Info("Starting API Gateway HTTP server",
 		logger.String("address", s.config.Server.Address),
@@ -164,26 +507,374 @@ func (s *Server) Start() error {
 		}()
 	}
 
+	// Start the internal mTLS listener; certificates come from the SVID
+	if s.internalServer != nil {
+		s.log.Info("Starting internal mTLS listener",
+			logger.String("address", s.internalServer.Addr),
+		)
+		go func() {
+			if err := s.internalServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+				s.log.Error("Internal mTLS listener error", logger.Error(err))
+			}
+		}()
+	}
+
+	// Open the L4 listeners
+	if s.l4Proxy != nil {
+		if err := s.l4Proxy.Start(); err != nil {
+			return err
+		}
+	}
+
 	return s.httpServer.ListenAndServe()
 }
 
+// cachePurgeEvent is the cluster event payload for a cache purge
+type cachePurgeEvent struct {
+	Namespace string `json:"namespace,omitempty"` // Limits a path purge to one namespace
+	Path      string `json:"path"`
+	User      string `json:"user,omitempty"` // Subject whose entries are purged, instead of a path
+}
+
+// propagateCachePurges broadcasts purges made on this gateway to the cluster and
+// applies purges broadcast by other gateways to the local cache
+func (s *Server) propagateCachePurges() {
+	s.cacheMiddleware.SetPurgeBroadcaster(func(namespace, pathPattern, subject string) error {
+		return s.cluster.Broadcast(cluster.EventCachePurge, cachePurgeEvent{Namespace: namespace, Path: pathPattern, User: subject})
+	})
+
+	s.cluster.Subscribe(cluster.EventCachePurge, func(event cluster.Event) {
+		var purge cachePurgeEvent
+		if err := json.Unmarshal(event.Payload, &purge); err != nil {
+			s.log.Warn("Ignoring malformed cache purge event",
+				logger.String("origin", event.Origin),
+				logger.String("reason", err.Error()),
+			)
+			return
+		}
+		if purge.User != "" {
+			s.cacheMiddleware.PurgeSubject(purge.User)
+			return
+		}
+		s.cacheMiddleware.PurgeNamespace(purge.Namespace, purge.Path)
+	})
+}
+
+// breakerStateEvent is the cluster event payload for a circuit breaker state
+// change
+type breakerStateEvent struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+// propagateBreakerStates broadcasts circuit breaker state changes made on this
+// gateway to the cluster and applies those of other gateways locally
+func (s *Server) propagateBreakerStates() {
+	s.httpProxy.ShareCircuitBreakers(func(name string, state proxy.CircuitBreakerState) {
+		if err := s.cluster.Broadcast(cluster.EventBreakerState, breakerStateEvent{Name: name, State: state.String()}); err != nil {
+			s.log.Warn("Failed to broadcast circuit breaker state",
+				logger.String("circuit", name),
+				logger.String("reason", err.Error()),
+			)
+		}
+	})
+
+	ttl := time.Duration(s.config.Cluster.BreakerStateTTL) * time.Second
+	s.cluster.Subscribe(cluster.EventBreakerState, func(event cluster.Event) {
+		var change breakerStateEvent
+		if err := json.Unmarshal(event.Payload, &change); err != nil {
+			s.log.Warn("Ignoring malformed circuit breaker state event",
+				logger.String("origin", event.Origin),
+				logger.String("reason", err.Error()),
+			)
+			return
+		}
+		state, ok := proxy.ParseCircuitBreakerState(change.State)
+		cb := s.httpProxy.CircuitBreaker(change.Name)
+		if !ok || cb == nil {
+			return
+		}
+		cb.ApplyRemoteState(state, ttl)
+	})
+}
+
+// logLevelRequest changes the global level, or a component level if Component is
+// set. An empty level resets the component to the global level.
+type logLevelRequest struct {
+	Component string `json:"component"`
+	Level     string `json:"level"`
+}
+
+// logLevelHandler reports and changes log levels until the gateway restarts
+func (s *Server) logLevelHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		var req logLevelRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if req.Level == "" && req.Component != "" {
+			s.logLevels.ResetLevel(req.Component)
+		} else if err := s.logLevels.SetLevel(req.Component, req.Level); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.log.Info("Changed log level",
+			logger.String("component", req.Component),
+			logger.String("level", req.Level),
+		)
+	}
+
+	global, components := s.logLevels.Snapshot()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"level":      global,
+		"components": components,
+	})
+}
+
+// blueGreenRequest switches the active upstream group of a route
+type blueGreenRequest struct {
+	Path   string `json:"path"`
+	Active string `json:"active"`
+}
+
+// clusterMembersHandler reports the gateways in the cluster
+func (s *Server) clusterMembersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"node":    s.cluster.Name(),
+		"members": s.cluster.Members(),
+	})
+}
+
+// blueGreenHandler reports blue/green switches and flips a route's active group
+func (s *Server) blueGreenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		var req blueGreenRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		blueGreen := s.httpProxy.BlueGreen(req.Path)
+		if blueGreen == nil {
+			http.Error(w, "No blue/green route with this path", http.StatusNotFound)
+			return
+		}
+		if err := blueGreen.Switch(req.Active); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(blueGreen.State())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"routes": s.httpProxy.BlueGreenStates(),
+	})
+}
+
+// healthCheckRequest pauses or resumes the health checks of a route
+type healthCheckRequest struct {
+	Path    string `json:"path"`
+	Enabled *bool  `json:"enabled"`
+}
+
+// healthChecksHandler reports the routes' health checks and pauses or
+// resumes those of a route
+func (s *Server) healthChecksHandler(w http.ResponseWriter, r *http.Request) {
+	healthChecks := s.httpProxy.HealthChecks()
+	if r.Method == http.MethodPost {
+		var req healthCheckRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil || req.Enabled == nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := healthChecks.SetEnabled(req.Path, *req.Enabled); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"routes": healthChecks.States(),
+	})
+}
+
+// routeDiffHandler validates a candidate routes file from the request body and
+// reports how it differs from the running routes without applying it
+func (s *Server) routeDiffHandler(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	candidate, err := config.ParseRoutes(data)
+	if err == nil {
+		err = candidate.ResolveRateLimitRefs(s.config.RateLimits)
+	}
+	if err == nil {
+		err = candidate.ResolveFieldEncryptionKeys(&s.config.FieldEncryption)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"valid": false,
+			"error": err.Error(),
+		})
+		return
+	}
+
+	diff := config.DiffRoutes(s.routes.Routes, candidate.Routes)
+	response := map[string]interface{}{
+		"valid":   true,
+		"changed": !diff.Empty(),
+		"diff":    diff,
+	}
+	if len(candidate.Deprecations) > 0 {
+		response["deprecations"] = candidate.Deprecations
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
 // registerUtilityEndpoints registers endpoints for health check, metrics, etc.
 func (s *Server) registerUtilityEndpoints() {
 	// Register health check endpoint
+	// The status is up, degraded while a dependency fails but requests are
+	// still served, or down with a 503 when they can't be
 	s.router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{
-			"status": "up",
+		subsystems := s.subsystemsHealth()
+		status := overallHealth(subsystems)
+		health := map[string]interface{}{
+			"status": status,
 			"time":   time.Now().Format(time.RFC3339),
-		})
+		}
+		if len(subsystems) > 0 {
+			health["subsystems"] = subsystems
+		}
+		if s.reloadStatus != nil {
+			health["config"] = s.reloadStatus.status()
+		}
+		if s.ready != nil {
+			select {
+			case <-s.ready:
+				health["ready"] = true
+			default:
+				health["ready"] = false
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if status == healthDown {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+		json.NewEncoder(w).Encode(health)
 	}).Methods("GET")
 
 	// Register metrics endpoint if enabled
 	if s.config.Metrics.Enabled {
-		s.router.Handle(s.config.Metrics.Endpoint, promhttp.Handler())
+		s.router.Handle(s.config.Metrics.Endpoint, s.restrictMetrics(promhttp.Handler()))
 	}
 
+	// Register cache purge endpoint if caching is enabled
+	if s.config.Cache.Enabled && s.cacheMiddleware != nil && s.config.Cache.PurgeEndpoint != "" {
+		s.router.Handle(s.config.Cache.PurgeEndpoint, s.protectPurge(http.HandlerFunc(s.cacheMiddleware.PurgeCache))).Methods("GET", "POST")
+		s.log.Info("Registered cache purge endpoint",
+			logger.String("endpoint", s.config.Cache.PurgeEndpoint),
+			logger.Any("auth_methods", s.config.Cache.PurgeAuth.Methods),
+		)
+	}
+
+	// Register cache warm endpoint if caching is enabled
+	if s.config.Cache.Enabled && s.cacheMiddleware != nil && s.config.Cache.Warm.Endpoint != "" {
+		s.router.Handle(s.config.Cache.Warm.Endpoint, s.requireAdmin(s.cacheMiddleware.WarmHandler(s.router))).Methods("POST")
+		s.log.Info("Registered cache warm endpoint",
+			logger.String("endpoint", s.config.Cache.Warm.Endpoint),
+		)
+	}
+
+	// Register cluster membership endpoint if clustering is enabled
+	if s.cluster != nil {
+		s.router.Handle("/admin/cluster/members", s.requireAdmin(http.HandlerFunc(s.clusterMembersHandler))).Methods("GET")
+	}
+
+	// Register blue/green switch endpoint if any route deploys that way
+	if s.httpProxy != nil && len(s.httpProxy.BlueGreenStates()) > 0 {
+		s.router.Handle("/admin/routes/blue-green", s.requireAdmin(http.HandlerFunc(s.blueGreenHandler))).Methods("GET", "POST")
+		s.log.Info("Registered blue/green switch endpoint",
+			logger.String("endpoint", "/admin/routes/blue-green"),
+		)
+	}
+
+	// Register health check control endpoint if any route is health checked
+	if s.httpProxy != nil && len(s.httpProxy.HealthChecks().States()) > 0 {
+		s.router.Handle("/admin/routes/health-checks", s.requireAdmin(http.HandlerFunc(s.healthChecksHandler))).Methods("GET", "POST")
+		s.log.Info("Registered health check control endpoint",
+			logger.String("endpoint", "/admin/routes/health-checks"),
+		)
+	}
+
+	// Register route listing endpoint
+	s.router.Handle("/admin/routes", s.requireAdmin(http.HandlerFunc(s.routeCatalogHandler))).Methods("GET")
+	s.log.Info("Registered route listing endpoint",
+		logger.String("endpoint", "/admin/routes"),
+	)
+
+	// Register in-flight request listing endpoint
+	if s.inflight != nil {
+		s.router.Handle("/admin/requests/in-flight", s.requireAdmin(http.HandlerFunc(s.inflightHandler))).Methods("GET")
+		s.log.Info("Registered in-flight request listing endpoint",
+			logger.String("endpoint", "/admin/requests/in-flight"),
+		)
+	}
+
+	// Register certificate listing endpoint
+	s.router.Handle("/admin/certificates", s.requireAdmin(http.HandlerFunc(s.certificatesHandler))).Methods("GET")
+	s.log.Info("Registered certificate listing endpoint",
+		logger.String("endpoint", "/admin/certificates"),
+	)
+
+	// Register gRPC descriptor listing endpoint
+	if s.descriptors != nil {
+		s.router.Handle("/admin/grpc/descriptors", s.requireAdmin(http.HandlerFunc(s.descriptorsHandler))).Methods("GET")
+		s.log.Info("Registered gRPC descriptor listing endpoint",
+			logger.String("endpoint", "/admin/grpc/descriptors"),
+		)
+	}
+
+	// Register developer portal endpoints
+	if s.portal != nil {
+		s.portal.Register(s.router, http.HandlerFunc(s.portalDocsHandler))
+		s.log.Info("Registered developer portal endpoints",
+			logger.String("prefix", s.config.Portal.PathPrefix),
+		)
+	}
+
+	// Register route change dry-run endpoint
+	s.router.Handle("/admin/routes/diff", s.requireAdmin(http.HandlerFunc(s.routeDiffHandler))).Methods("POST")
+	s.log.Info("Registered route diff endpoint",
+		logger.String("endpoint", "/admin/routes/diff"),
+	)
+
+	// Register runtime log level endpoint
+	if s.logLevels != nil && s.config.Logging.LevelEndpoint != "" {
+		s.router.Handle(s.config.Logging.LevelEndpoint, s.requireAdmin(http.HandlerFunc(s.logLevelHandler))).Methods("GET", "PUT", "POST")
+		s.log.Info("Registered log level endpoint",
+			logger.String("endpoint", s.config.Logging.LevelEndpoint),
+		)
+	}
+
+	// Register admin-only debug endpoints
+	s.registerDebugEndpoints()
+
 	// Register Swagger documentation
 	s.router.PathPrefix("/docs/swagger/").Handler(http.StripPrefix("/docs/swagger/", http.FileServer(http.Dir("./docs/swagger"))))
 	s.log.Info("Registered Swagger documentation endpoint",
@@ -251,30 +942,203 @@ func (s *Server) Stop(ctx context.Context) error {
 		s.grpcServer.Stop()
 	}
 
-	return s.httpServer.Shutdown(ctx)
+	// Close the L4 listeners and their connections
+	if s.l4Proxy != nil {
+		s.l4Proxy.Stop()
+	}
+
+	// Stop the internal mTLS listener
+	if s.internalServer != nil {
+		if err := s.internalServer.Shutdown(ctx); err != nil {
+			s.log.Error("Failed to shut down internal listener", logger.Error(err))
+		}
+	}
+
+	// Leave the cluster so peers stop sending events
+	if s.cluster != nil {
+		if err := s.cluster.Stop(ctx); err != nil {
+			s.log.Error("Failed to leave cluster", logger.Error(err))
+		}
+	}
+
+	// Stop service discovery watches
+	if s.httpProxy != nil {
+		s.httpProxy.Close()
+	}
+
+	// Close the WebSocket bridge's gRPC connections
+	if s.grpcBridge != nil {
+		s.grpcBridge.Close()
+	}
+
+	// Stop polling policy bundle servers
+	if s.opaMiddleware != nil {
+		s.opaMiddleware.Stop()
+	}
+
+	// Stop SLO evaluation
+	if s.sloTracker != nil {
+		s.sloTracker.Stop()
+	}
+
+	// Stop watching the feature flags file
+	if s.featureFlags != nil {
+		s.featureFlags.Stop()
+	}
+
+	// Send the last metrics to StatsD
+	if s.statsdExporter != nil {
+		s.statsdExporter.Stop()
+	}
+
+	// Save portal keys and usage
+	if s.portal != nil {
+		s.portal.Stop()
+	}
+
+	// Flush the usage counted since the last export
+	if s.usageRecorder != nil {
+		s.usageRecorder.Stop()
+	}
+
+	// Stop watching the Workload API
+	if s.spiffe != nil {
+		s.spiffe.Stop()
+	}
+
+	// Stop checking certificate expiry
+	if s.certMonitor != nil {
+		s.certMonitor.Stop()
+	}
+
+	// Stop watching the gRPC descriptors directory
+	if s.descriptors != nil {
+		s.descriptors.Stop()
+	}
+
+	// Send the notifications still queued
+	if s.notifier != nil {
+		s.notifier.Stop()
+	}
+
+	// Close the connections to gRPC authorization services
+	if s.extAuthz != nil {
+		s.extAuthz.Close()
+	}
+
+	// Close the validation cache's Redis connections
+	if s.authService != nil {
+		s.authService.Close()
+	}
+
+	// Flush buffered trace spans
+	if s.tracingMiddleware != nil {
+		if err := s.tracingMiddleware.Shutdown(ctx); err != nil {
+			s.log.Error("Failed to shut down tracing", logger.Error(err))
+		}
+	}
+
+	// Let the requests in flight finish, reporting the drain's progress
+	var err error
+	if s.inflight != nil {
+		err = s.shutdownHTTP(ctx)
+	} else {
+		err = s.httpServer.Shutdown(ctx)
+	}
+
+	// Persist the cache so the next start is warm, once the drain is over so
+	// the snapshot holds what the last requests cached
+	if s.cacheMiddleware != nil {
+		if err := s.cacheMiddleware.Close(); err != nil {
+			s.log.Error("Failed to persist cache on shutdown", logger.Error(err))
+		}
+	}
+
+	return err
 }
 
-// registerRoutes configures all the route handlers
+// registerRoutes configures all the route handlers and the handlers for
+// requests no route matches
 func (s *Server) registerRoutes() {
-	// Add health check endpoint
-	s.router.HandleFunc("/health", handlers.HealthCheckHandler).Methods("GET")
-
-	// Register all routes from configuration
+	var catchAll http.Handler
 	for _, route := range s.routes.Routes {
+		// Skip gRPC routes for HTTP server - they'll be handled by gRPC server
+		if route.Protocol == config.ProtocolGRPC {
+			continue
+		}
+		if route.CatchAll {
+			catchAll = catchAllHandler(s.httpRouteHandler(route), route.Methods)
+			s.log.Info("Registered catch-all route",
+				logger.String("path", route.Path),
+				logger.String("upstream", route.Upstream),
+			)
+			continue
+		}
 		s.registerRoute(route)
 	}
 
-	// Add catch-all route for 404 responses
-	s.router.NotFoundHandler = http.HandlerFunc(handlers.NotFoundHandler)
+	s.registerFallbackHandlers(catchAll)
+}
+
+// httpRouteHandler builds the proxy handler of an HTTP route, the file
+// handler of a static route or the bridge of a GRPC_WEBSOCKET route, with its
+// middleware
+func (s *Server) httpRouteHandler(route config.Route) http.Handler {
+	var httpHandler http.Handler
+	switch route.Protocol {
+	case config.ProtocolStatic:
+		httpHandler = newStaticHandler(route, logger.Component(s.log, "static"))
+	case config.ProtocolGRPCWebSocket:
+		httpHandler = s.grpcBridge.Handler(route)
+	default:
+		httpHandler = s.httpProxy.ProxyRequest(route)
+		if route.SandboxUpstream != "" {
+			httpHandler = middleware.Sandbox(httpHandler, s.httpProxy.ProxySandbox(route))
+		}
+	}
+
+	// Wrap the proxy with route middleware in the configured order
+	httpHandler = s.applyMiddlewares(httpHandler, route)
+
+	// Attach route labels for metrics, logs and traces. Access logging and
+	// metrics wrap the whole chain so they see the final status.
+	httpHandler = middleware.RouteLabels(httpHandler, route)
+	if s.sloTracker != nil {
+		httpHandler = s.sloTracker.Track(httpHandler, route)
+	}
+	if s.metricsMiddleware != nil {
+		httpHandler = s.metricsMiddleware.RouteMetrics(httpHandler, route)
+	}
+	if s.usageRecorder != nil {
+		httpHandler = s.usageRecorder.Record(httpHandler, route)
+	}
+	if s.accessLogger != nil {
+		httpHandler = s.accessLogger.Log(httpHandler, route)
+	}
+	if s.testTraffic != nil {
+		httpHandler = s.testTraffic.Detect(httpHandler, route)
+	}
+
+	if s.inflight != nil {
+		httpHandler = s.inflight.trackRoute(httpHandler, route)
+	}
+
+	// Give the whole chain the route and request ID through the context
+	return middleware.RouteContext(httpHandler, route)
 }
 
 // registerRoute configures an individual route
 func (s *Server) registerRoute(route config.Route) {
-	// Create a new router for this route
-	var routeRouter *mux.Router
+	if s.routeTable == nil {
+		s.routeTable = newRouteTable()
+		s.router.MatcherFunc(s.routeTable.match)
+	}
+
+	// The table matches wildcard routes by the path they were configured
+	// with, while their handlers see it without the wildcard
+	path := route.Path
 	if strings.HasSuffix(route.Path, "/*") {
 		route.Path = strings.TrimRight(route.Path, "/*")
-		routeRouter = s.router.PathPrefix(route.Path).Subrouter()
 	}
 
 	// Register the appropriate handlers based on whether it's a WebSocket route or not
@@ -291,113 +1155,50 @@ func (s *Server) registerRoute(route config.Route) {
 		if route.Middlewares.RequireAuth {
 			wsHandler = s.authMiddleware.Authenticate(wsHandler, route)
 		}
+		wsHandler = middleware.RouteContext(wsHandler, route)
 
 		// Register the handler for the WebSocket-specific path or the general route path
 		wsPath := route.WebSocket.Path
 		if wsPath == "" {
-			if routeRouter == nil {
-				routeRouter = s.router
-				routeRouter.PathPrefix("/").Path(route.Path).Handler(wsHandler)
-			} else {
-				// If no specific path is provided, use the general path
-				routeRouter.PathPrefix("/").Handler(wsHandler)
-			}
+			s.addRouteToTable(path, nil, wsHandler)
 			s.log.Info("Registered WebSocket route",
 				logger.String("path", fmt.Sprintf("%s/*", route.Path)),
 				logger.String("upstream", route.Upstream),
 			)
 		} else {
 			// Register handler for the specific WebSocket path
-			s.router.Path(wsPath).Handler(wsHandler)
+			s.addRouteToTable(wsPath, nil, wsHandler)
 			s.log.Info("Registered WebSocket route",
 				logger.String("path", wsPath),
 				logger.String("upstream", route.Upstream),
 			)
 		}
-	case "HTTP":
-		// HTTP handler
-		httpHandler := s.httpProxy.ProxyRequest(route)
-
-		// Apply URL rewriting if configured
-		if route.Middlewares.URLRewrite != nil && len(route.Middlewares.URLRewrite.Patterns) > 0 {
-			httpHandler = s.urlRewriter.Rewrite(httpHandler, route.Middlewares.URLRewrite)
-			s.log.Info("Applied URL rewriting to route",
-				logger.String("path", route.Path),
-				logger.Int("patterns", len(route.Middlewares.URLRewrite.Patterns)),
-			)
-		}
-
-		// Apply header transformations if configured
-		if route.Middlewares.HeaderTransform != nil {
-			httpHandler = s.headerTransformer.Transform(httpHandler, route.Middlewares.HeaderTransform)
-			s.log.Info("Applied header transformation to route",
-				logger.String("path", route.Path),
-			)
-		}
-
-		// Apply rate limiting if enabled
-		if route.Middlewares.RateLimit != nil && route.Middlewares.RateLimit.Requests > 0 {
-			httpHandler = s.rateLimiter.RateLimit(httpHandler, route)
-			s.log.Info("Applied rate limiting to route",
-				logger.String("path", route.Path),
-				logger.Int("requests", route.Middlewares.RateLimit.Requests),
-				logger.String("period", route.Middlewares.RateLimit.Period),
-			)
-		}
-
-		// Apply retry policy if enabled
-		if route.Middlewares.RetryPolicy != nil && route.Middlewares.RetryPolicy.Enabled {
-			httpHandler = s.retryMiddleware.Retry(httpHandler, route.Middlewares.RetryPolicy)
-			s.log.Info("Applied retry policy to route",
-				logger.String("path", route.Path),
-				logger.Int("attempts", route.Middlewares.RetryPolicy.Attempts),
-				logger.Int("per_try_timeout", route.Middlewares.RetryPolicy.PerTryTimeout),
-			)
-		}
+	case "HTTP", config.ProtocolStatic, config.ProtocolGRPCWebSocket:
+		// HTTP handler, for the route's methods or all methods
+		httpHandler := s.httpRouteHandler(route)
+		s.addRouteToTable(path, route.Methods, httpHandler)
 
-		// Apply cache middleware if enabled for this route
-		if s.config.Cache.Enabled && route.Middlewares.Cache != nil && route.Middlewares.Cache.Enabled {
-			httpHandler = s.cacheMiddleware.Cache(httpHandler, route)
-			s.log.Info("Applied cache middleware to route",
-				logger.String("path", route.Path),
-				logger.Int("ttl", route.Middlewares.Cache.TTL),
-				logger.Bool("cache_authenticated", route.Middlewares.Cache.CacheAuthenticated),
-			)
+		methods := route.Methods
+		if len(methods) == 0 {
+			methods = []string{"ALL"}
 		}
-
-		// Apply authentication middleware if required
-		if route.Middlewares.RequireAuth {
-			httpHandler = s.authMiddleware.Authenticate(httpHandler, route)
-		}
-
-		// If methods are specified, register the handler for each method
-		if len(route.Methods) > 0 {
-			for _, method := range route.Methods {
-				if routeRouter == nil {
-					routeRouter = s.router
-					routeRouter.PathPrefix("/").Path(route.Path).Handler(httpHandler).Methods(method)
-				} else {
-					routeRouter.PathPrefix("/").Handler(httpHandler).Methods(method)
-				}
-				s.log.Info("Registered route",
-					logger.String("path", fmt.Sprintf("%s/*", route.Path)),
-					logger.String("method", method),
-					logger.String("upstream", route.Upstream),
-				)
-			}
-		} else {
-			if routeRouter == nil {
-				routeRouter = s.router
-				routeRouter.PathPrefix("/").Path(route.Path).Handler(httpHandler)
-			} else {
-				// Otherwise, register for all methods
-				routeRouter.PathPrefix("/").Handler(httpHandler)
-			}
+		for _, method := range methods {
 			s.log.Info("Registered route",
 				logger.String("path", fmt.Sprintf("%s/*", route.Path)),
-				logger.String("method", "ALL"),
+				logger.String("method", method),
 				logger.String("upstream", route.Upstream),
 			)
 		}
 	}
 }
+
+// addRouteToTable adds a route's handler to the route table, logging paths
+// the table can't match
+func (s *Server) addRouteToTable(path string, methods []string, handler http.Handler) {
+	if err := s.routeTable.add(path, methods, handler); err != nil {
+		s.log.Error("Invalid route path, route is not served",
+			logger.String("path", path),
+			logger.Error(err),
+		)
+	}
+}
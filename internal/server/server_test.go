@@ -1,13 +1,17 @@
 package server
 
 import (
+	"api-gateway/internal/auth"
+	"api-gateway/internal/cluster"
 	"api-gateway/internal/config"
+	"api-gateway/internal/middleware"
 	"api-gateway/pkg/logger"
 	"context"
 	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -204,6 +208,25 @@ func TestRegisterUtilityEndpoints(t *testing.T) {
 	assert.NotEmpty(t, result["time"])
 }
 
+func TestHealthReportsReadiness(t *testing.T) {
+	ready := make(chan struct{})
+	s := &Server{router: mux.NewRouter(), log: &mockLogger{}, config: &config.Config{}, ready: ready}
+	s.registerUtilityEndpoints()
+
+	health := func() map[string]interface{} {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest("GET", "/health", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+		return result
+	}
+
+	assert.Equal(t, false, health()["ready"])
+	close(ready)
+	assert.Equal(t, true, health()["ready"])
+}
+
 func TestRegisterRoute(t *testing.T) {
 	// Skip this test as it requires many dependencies that are hard to mock
 	t.Skip("Skipping TestRegisterRoute as it requires many real components")
@@ -384,3 +407,179 @@ func TestBasicServerFunctionality(t *testing.T) {
 		assert.NotEmpty(t, result["time"])
 	})
 }
+
+func TestPropagateCachePurges(t *testing.T) {
+	cacheCfg := &config.CacheConfig{Enabled: true, DefaultTTL: 60, MaxTTL: 300}
+	route := config.Route{
+		Path: "/articles",
+		Middlewares: &config.Middlewares{
+			Cache: &config.RouteCacheConfig{Enabled: true, TTL: 60},
+		},
+	}
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("article"))
+	})
+
+	newNode := func(name string, seeds ...string) *Server {
+		node, err := cluster.New(&config.ClusterConfig{
+			NodeName:    name,
+			BindAddress: "127.0.0.1:0",
+			Seeds:       seeds,
+			SecretKey:   "shared-secret",
+		}, &mockLogger{})
+		require.NoError(t, err)
+		require.NoError(t, node.Start())
+		t.Cleanup(func() { node.Stop(context.Background()) })
+
+		s := &Server{
+			cacheMiddleware: middleware.NewCacheMiddleware(cacheCfg, &mockLogger{}),
+			cluster:         node,
+			log:             &mockLogger{},
+		}
+		s.propagateCachePurges()
+		return s
+	}
+
+	a := newNode("node-a")
+	b := newNode("node-b", a.cluster.Members()[0].Address)
+	require.Eventually(t, func() bool {
+		return len(a.cluster.Members()) == 2
+	}, 5*time.Second, 50*time.Millisecond)
+
+	cached := b.cacheMiddleware.Cache(upstream, route)
+	get := func() string {
+		rec := httptest.NewRecorder()
+		cached.ServeHTTP(rec, httptest.NewRequest("GET", "http://example.com/articles", nil))
+		return rec.Header().Get("X-Cache")
+	}
+	assert.Equal(t, "MISS", get())
+	assert.Equal(t, "HIT", get())
+
+	// Purging on node A invalidates the entry cached by node B
+	rec := httptest.NewRecorder()
+	a.cacheMiddleware.PurgeCache(rec, httptest.NewRequest("POST", "http://example.com/admin/cache/purge?path=/articles", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"propagated":true`)
+	assert.Equal(t, "MISS", get())
+
+	// Purging a user's entries leaves the entries of others on node B
+	rec = httptest.NewRecorder()
+	a.cacheMiddleware.PurgeCache(rec, httptest.NewRequest("POST", "http://example.com/admin/cache/purge?user=ada", nil))
+	assert.Contains(t, rec.Body.String(), `"propagated":true`)
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, "HIT", get())
+}
+
+func TestLogLevelHandler(t *testing.T) {
+	log := logger.NewLogger(logger.Config{Level: "info", Format: "json", Output: "stdout"})
+	authCfg := &config.AuthConfig{JWTSecret: "debug-secret", JWTHeader: "Authorization", APIKeyHeader: "X-API-Key"}
+	s := &Server{
+		router:      mux.NewRouter(),
+		log:         &mockLogger{},
+		logLevels:   logger.LevelsOf(log),
+		authService: auth.NewAuthService(authCfg, &mockLogger{}),
+		config: &config.Config{
+			Logging: config.LoggingConfig{LevelEndpoint: "/admin/log/level"},
+			Debug:   config.DebugConfig{AllowedRoles: []string{"admin"}},
+		},
+	}
+	s.registerUtilityEndpoints()
+
+	authorization := debugToken(t, "admin")
+	call := func(method, body string) (int, map[string]interface{}) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/admin/log/level", strings.NewReader(body))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		s.router.ServeHTTP(rec, req)
+		var result map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		return rec.Code, result
+	}
+
+	code, result := call("GET", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "info", result["level"])
+
+	code, result = call("PUT", `{"component":"middleware.cache","level":"debug"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]interface{}{"middleware.cache": "debug"}, result["components"])
+
+	code, result = call("PUT", `{"level":"warn"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "warn", result["level"])
+
+	code, result = call("PUT", `{"component":"middleware.cache"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, result["components"])
+
+	code, _ = call("PUT", `{"level":"loud"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// Only admins may read or change levels
+	authorization = ""
+	code, _ = call("PUT", `{"level":"debug"}`)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	authorization = debugToken(t, "user")
+	code, _ = call("GET", "")
+	assert.Equal(t, http.StatusForbidden, code)
+}
+
+func TestClusterMembersEndpointRequiresAdmin(t *testing.T) {
+	node, err := cluster.New(&config.ClusterConfig{NodeName: "node-a", SecretKey: "shared-secret"}, &mockLogger{})
+	require.NoError(t, err)
+	s := &Server{
+		router:      mux.NewRouter(),
+		log:         &mockLogger{},
+		cluster:     node,
+		authService: auth.NewAuthService(&config.AuthConfig{JWTSecret: "debug-secret", JWTHeader: "Authorization", APIKeyHeader: "X-API-Key"}, &mockLogger{}),
+		config:      &config.Config{Debug: config.DebugConfig{AllowedRoles: []string{"admin"}}},
+	}
+	s.registerUtilityEndpoints()
+
+	members := func(authorization string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/admin/cluster/members", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, members("").Code)
+	assert.Equal(t, http.StatusForbidden, members(debugToken(t, "user")).Code)
+	rec := members(debugToken(t, "admin"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"node":"node-a"`)
+}
+
+func TestCacheWarmEndpointRequiresAdmin(t *testing.T) {
+	cacheCfg := &config.CacheConfig{Enabled: true, MaxSize: 100, Warm: config.CacheWarmConfig{Endpoint: "/admin/cache/warm", MaxPaths: 10}}
+	s := &Server{
+		router:          mux.NewRouter(),
+		log:             &mockLogger{},
+		cacheMiddleware: middleware.NewCacheMiddleware(cacheCfg, &mockLogger{}),
+		authService:     auth.NewAuthService(&config.AuthConfig{JWTSecret: "debug-secret", JWTHeader: "Authorization", APIKeyHeader: "X-API-Key"}, &mockLogger{}),
+		config: &config.Config{
+			Cache: *cacheCfg,
+			Debug: config.DebugConfig{AllowedRoles: []string{"admin"}},
+		},
+	}
+	s.registerUtilityEndpoints()
+
+	warm := func(authorization string) int {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/admin/cache/warm", strings.NewReader(`{"paths":["/health"]}`))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		s.router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, warm(""))
+	assert.Equal(t, http.StatusForbidden, warm(debugToken(t, "user")))
+	assert.Equal(t, http.StatusOK, warm(debugToken(t, "admin")))
+}
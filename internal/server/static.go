@@ -0,0 +1,184 @@
+package server
+
+import (
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/middleware"
+	"api-gateway/pkg/logger"
+)
+
+// precompressedEncodings are the encodings served from sibling files, in order
+// of preference
+var precompressedEncodings = []struct {
+	name      string
+	extension string
+}{
+	{name: "br", extension: ".br"},
+	{name: "gzip", extension: ".gz"},
+}
+
+// staticHandler serves the files of a STATIC route
+type staticHandler struct {
+	prefix string
+	config *config.StaticConfig
+	log    logger.Logger
+}
+
+// newStaticHandler creates the file handler of a STATIC route
+func newStaticHandler(route config.Route, log logger.Logger) *staticHandler {
+	return &staticHandler{
+		prefix: strings.TrimRight(route.Path, "/*"),
+		config: route.Static,
+		log:    log,
+	}
+}
+
+// ServeHTTP serves the file the request path names below the root
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := path.Clean("/" + strings.TrimPrefix(r.URL.Path, h.prefix))
+	for _, segment := range strings.Split(name, "/") {
+		// Hidden files such as .env or .git are never served
+		if strings.HasPrefix(segment, ".") {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	info, err := os.Stat(h.filePath(name))
+	if err != nil {
+		if h.config.SPAFallback && path.Ext(name) == "" {
+			// Client-side routes are handled by the application's index
+			h.serveFile(w, r, "/"+h.config.Index, true)
+			return
+		}
+		http.NotFound(w, r)
+		return
+	}
+
+	if !info.IsDir() {
+		h.serveFile(w, r, name, name == "/"+h.config.Index)
+		return
+	}
+
+	// Relative links in directories only work with a trailing slash
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		target := url.URL{Path: r.URL.Path + "/", RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+		return
+	}
+	index := path.Join(name, h.config.Index)
+	if _, err := os.Stat(h.filePath(index)); err == nil {
+		h.serveFile(w, r, index, true)
+		return
+	}
+	if h.config.DirectoryListing {
+		h.listDirectory(w, name)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// filePath maps a cleaned request path to a path below the root
+func (h *staticHandler) filePath(name string) string {
+	return filepath.Join(h.config.Root, filepath.FromSlash(name))
+}
+
+// serveFile sends a file, or a precompressed sibling of it, with caching
+// headers. Index files are always revalidated so new deployments show up.
+func (h *staticHandler) serveFile(w http.ResponseWriter, r *http.Request, name string, isIndex bool) {
+	filePath := h.filePath(name)
+	encoding := ""
+	if h.config.Precompressed {
+		w.Header().Add("Vary", "Accept-Encoding")
+		for _, candidate := range precompressedEncodings {
+			if !middleware.AcceptsEncoding(r.Header.Get("Accept-Encoding"), candidate.name) {
+				continue
+			}
+			if info, err := os.Stat(filePath + candidate.extension); err == nil && !info.IsDir() {
+				filePath += candidate.extension
+				encoding = candidate.name
+				break
+			}
+		}
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	// The content type comes from the original name, not the compressed sibling
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	w.Header().Set("ETag", fileETag(info, encoding))
+	if isIndex || h.config.MaxAge <= 0 {
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(h.config.MaxAge))
+	}
+
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
+
+// listDirectory writes an HTML listing of a directory, leaving out hidden files
+func (h *staticHandler) listDirectory(w http.ResponseWriter, name string) {
+	entries, err := os.ReadDir(h.filePath(name))
+	if err != nil {
+		h.log.Warn("Failed to list static directory",
+			logger.String("directory", name),
+			logger.Error(err),
+		)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprintf(w, "<!doctype html>\n<title>%s</title>\n<pre>\n", html.EscapeString(name))
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if strings.HasPrefix(entryName, ".") {
+			continue
+		}
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		link := url.URL{Path: entryName}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", link.String(), html.EscapeString(entryName))
+	}
+	fmt.Fprint(w, "</pre>\n")
+}
+
+// fileETag derives a strong ETag from a file's size and modification time.
+// Precompressed variants get their own tag since their bytes differ.
+func fileETag(info os.FileInfo, encoding string) string {
+	tag := strconv.FormatInt(info.ModTime().UnixNano(), 36) + "-" + strconv.FormatInt(info.Size(), 36)
+	if encoding != "" {
+		tag += "-" + encoding
+	}
+	return `"` + tag + `"`
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"api-gateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticHandler(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"index.html":         "<html>app</html>",
+		"assets/app.js":      "console.log('app')",
+		"assets/app.js.br":   "brotli bytes",
+		"assets/app.js.gz":   "gzip bytes",
+		"docs/guide.txt":     "guide",
+		".env":               "SECRET=1",
+		"assets/.hidden.txt": "hidden",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	newHandler := func(static config.StaticConfig) http.Handler {
+		static.Root = root
+		if static.Index == "" {
+			static.Index = "index.html"
+		}
+		route := config.Route{Path: "/app/*", Protocol: config.ProtocolStatic, Static: &static}
+		return newStaticHandler(route, &mockLogger{})
+	}
+	serve := func(handler http.Handler, target string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("serves files with cache headers and an ETag", func(t *testing.T) {
+		handler := newHandler(config.StaticConfig{MaxAge: 3600})
+		rec := serve(handler, "/app/assets/app.js", nil)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "console.log('app')", rec.Body.String())
+		assert.Contains(t, rec.Header().Get("Content-Type"), "javascript")
+		assert.Equal(t, "public, max-age=3600", rec.Header().Get("Cache-Control"))
+		require.NotEmpty(t, rec.Header().Get("ETag"))
+
+		revalidated := serve(handler, "/app/assets/app.js", map[string]string{"If-None-Match": rec.Header().Get("ETag")})
+		assert.Equal(t, http.StatusNotModified, revalidated.Code)
+	})
+
+	t.Run("directories serve their index without caching", func(t *testing.T) {
+		rec := serve(newHandler(config.StaticConfig{MaxAge: 3600}), "/app/", nil)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "<html>app</html>", rec.Body.String())
+		assert.Equal(t, "no-cache", rec.Header().Get("Cache-Control"))
+	})
+
+	t.Run("directories without a trailing slash are redirected", func(t *testing.T) {
+		rec := serve(newHandler(config.StaticConfig{}), "/app/docs?page=1", nil)
+
+		assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+		assert.Equal(t, "/app/docs/?page=1", rec.Header().Get("Location"))
+	})
+
+	t.Run("spa fallback serves the index for client routes", func(t *testing.T) {
+		handler := newHandler(config.StaticConfig{SPAFallback: true})
+
+		rec := serve(handler, "/app/users/42", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "<html>app</html>", rec.Body.String())
+
+		// Missing assets are still reported as missing
+		assert.Equal(t, http.StatusNotFound, serve(handler, "/app/assets/missing.js", nil).Code)
+		assert.Equal(t, http.StatusNotFound, serve(newHandler(config.StaticConfig{}), "/app/users/42", nil).Code)
+	})
+
+	t.Run("precompressed files are preferred", func(t *testing.T) {
+		handler := newHandler(config.StaticConfig{Precompressed: true})
+
+		rec := serve(handler, "/app/assets/app.js", map[string]string{"Accept-Encoding": "gzip, br"})
+		assert.Equal(t, "brotli bytes", rec.Body.String())
+		assert.Equal(t, "br", rec.Header().Get("Content-Encoding"))
+		assert.Contains(t, rec.Header().Get("Content-Type"), "javascript")
+		assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+
+		rec = serve(handler, "/app/assets/app.js", map[string]string{"Accept-Encoding": "gzip, br;q=0"})
+		assert.Equal(t, "gzip bytes", rec.Body.String())
+		assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+
+		rec = serve(handler, "/app/assets/app.js", nil)
+		assert.Equal(t, "console.log('app')", rec.Body.String())
+		assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	})
+
+	t.Run("directory listing", func(t *testing.T) {
+		rec := serve(newHandler(config.StaticConfig{DirectoryListing: true}), "/app/assets/", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `<a href="app.js">app.js</a>`)
+		assert.NotContains(t, rec.Body.String(), ".hidden.txt")
+
+		assert.Equal(t, http.StatusNotFound, serve(newHandler(config.StaticConfig{}), "/app/assets/", nil).Code)
+	})
+
+	t.Run("hidden files and traversal are refused", func(t *testing.T) {
+		handler := newHandler(config.StaticConfig{})
+		assert.Equal(t, http.StatusNotFound, serve(handler, "/app/.env", nil).Code)
+		assert.Equal(t, http.StatusNotFound, serve(handler, "/app/assets/.hidden.txt", nil).Code)
+
+		req := httptest.NewRequest("GET", "/app/", nil)
+		req.URL.Path = "/app/../../etc/passwd"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
@@ -0,0 +1,261 @@
+package spiffe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+)
+
+// Backoff between reconnects to the Workload API
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+var errNoSVID = errors.New("no SVID received from the workload API yet")
+
+// Source keeps the gateway's X.509 SVID and trust bundle current by watching
+// the SPIRE agent's Workload API. TLS configs built from it pick up rotated
+// SVIDs and bundles on their next handshake.
+type Source struct {
+	config *config.SPIFFEConfig
+	log    logger.Logger
+
+	mutex sync.RWMutex
+	svid  *x509SVID
+	cert  *tls.Certificate
+	roots *x509.CertPool
+
+	ready     chan struct{}
+	readyOnce sync.Once
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// New creates a source; Start begins watching the Workload API
+func New(cfg *config.SPIFFEConfig, log logger.Logger) *Source {
+	return &Source{
+		config: cfg,
+		log:    log,
+		ready:  make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Start watches the Workload API in the background, reconnecting with
+// backoff when the agent is unavailable
+func (s *Source) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go func() {
+		defer close(s.done)
+		delay := minReconnectDelay
+		for {
+			err := s.watch(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			s.log.Warn("Workload API watch failed, reconnecting",
+				logger.String("socket", s.config.SocketPath),
+				logger.Int("retry_ms", int(delay.Milliseconds())),
+				logger.Error(err),
+			)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+			if delay *= 2; delay > maxReconnectDelay {
+				delay = maxReconnectDelay
+			}
+		}
+	}()
+}
+
+// watch streams SVID updates over one connection
+func (s *Source) watch(ctx context.Context) error {
+	conn, err := dialWorkloadAPI(s.config.SocketPath)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return watchX509SVIDs(ctx, conn, s.setSVID)
+}
+
+// Stop ends watching the Workload API
+func (s *Source) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+		<-s.done
+	}
+}
+
+// Ready is closed once the first SVID is received
+func (s *Source) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// ID returns the gateway's SPIFFE ID, or "" before the first SVID
+func (s *Source) ID() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.svid == nil {
+		return ""
+	}
+	return s.svid.id
+}
+
+// setSVID replaces the current SVID and trust bundle
+func (s *Source) setSVID(svid *x509SVID) {
+	cert := &tls.Certificate{PrivateKey: svid.key, Leaf: svid.chain[0]}
+	for _, c := range svid.chain {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+	roots := x509.NewCertPool()
+	for _, c := range svid.bundle {
+		roots.AddCert(c)
+	}
+
+	s.mutex.Lock()
+	s.svid, s.cert, s.roots = svid, cert, roots
+	s.mutex.Unlock()
+
+	s.log.Info("Received X.509 SVID",
+		logger.String("spiffe_id", svid.id),
+		logger.String("expires", svid.chain[0].NotAfter.UTC().Format(time.RFC3339)),
+		logger.Int("bundle_certificates", len(svid.bundle)),
+	)
+	s.readyOnce.Do(func() { close(s.ready) })
+}
+
+// current returns the SVID certificate, its SPIFFE ID and the trust bundle
+func (s *Source) current() (*tls.Certificate, string, *x509.CertPool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.svid == nil {
+		return nil, "", nil, errNoSVID
+	}
+	return s.cert, s.svid.id, s.roots, nil
+}
+
+// ClientTLSConfig returns the TLS config of connections to an upstream that
+// must present serverID. The gateway presents its own SVID.
+func (s *Source) ClientTLSConfig(serverID string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _, _, err := s.current()
+			return cert, err
+		},
+		// SVIDs name workloads by URI, not by host, so the standard
+		// verification is replaced with SPIFFE's
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			_, _, roots, err := s.current()
+			if err != nil {
+				return err
+			}
+			id, err := verifySVID(rawCerts, roots, x509.ExtKeyUsageServerAuth)
+			if err != nil {
+				return err
+			}
+			if id != serverID {
+				return fmt.Errorf("upstream presented SPIFFE ID %s, expected %s", id, serverID)
+			}
+			return nil
+		},
+	}
+}
+
+// ServerTLSConfig returns the TLS config of the internal listener. Clients
+// must present an SVID with one of allowedIDs, or from the gateway's trust
+// domain if allowedIDs is empty.
+func (s *Source) ServerTLSConfig(allowedIDs []string) *tls.Config {
+	allowed := make(map[string]bool, len(allowedIDs))
+	for _, id := range allowedIDs {
+		allowed[id] = true
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: tls.RequireAnyClientCert,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, _, _, err := s.current()
+			return cert, err
+		},
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			_, ownID, roots, err := s.current()
+			if err != nil {
+				return err
+			}
+			id, err := verifySVID(rawCerts, roots, x509.ExtKeyUsageClientAuth)
+			if err != nil {
+				return err
+			}
+			if len(allowed) > 0 {
+				if !allowed[id] {
+					return fmt.Errorf("SPIFFE ID %s is not allowed", id)
+				}
+				return nil
+			}
+			if trustDomain(id) != trustDomain(ownID) {
+				return fmt.Errorf("SPIFFE ID %s is outside the trust domain %s", id, trustDomain(ownID))
+			}
+			return nil
+		},
+	}
+}
+
+// verifySVID verifies a peer's certificate chain against the trust bundle
+// and returns its SPIFFE ID
+func verifySVID(rawCerts [][]byte, roots *x509.CertPool, usage x509.ExtKeyUsage) (string, error) {
+	if len(rawCerts) == 0 {
+		return "", errors.New("peer presented no certificate")
+	}
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return "", fmt.Errorf("invalid peer certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	}); err != nil {
+		return "", fmt.Errorf("peer SVID not trusted: %w", err)
+	}
+	return spiffeID(certs[0])
+}
+
+// spiffeID returns the SPIFFE ID of an SVID, its only URI SAN
+func spiffeID(cert *x509.Certificate) (string, error) {
+	if len(cert.URIs) != 1 || !config.ValidSPIFFEID(cert.URIs[0].String()) {
+		return "", errors.New("certificate is not an SVID: it must carry exactly one spiffe:// URI")
+	}
+	return cert.URIs[0].String(), nil
+}
+
+// trustDomain returns the trust domain of a SPIFFE ID
+func trustDomain(id string) string {
+	u, err := url.Parse(id)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
@@ -0,0 +1,249 @@
+package spiffe
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// mockLogger implements the logger.Logger interface for testing
+type mockLogger struct{}
+
+func (m *mockLogger) Debug(msg string, fields ...logger.Field)  {}
+func (m *mockLogger) Info(msg string, fields ...logger.Field)   {}
+func (m *mockLogger) Warn(msg string, fields ...logger.Field)   {}
+func (m *mockLogger) Error(msg string, fields ...logger.Field)  {}
+func (m *mockLogger) Fatal(msg string, fields ...logger.Field)  {}
+func (m *mockLogger) With(fields ...logger.Field) logger.Logger { return m }
+
+// testCA issues SVIDs of a trust domain
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, trustDomain string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	id, _ := url.Parse("spiffe://" + trustDomain)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{trustDomain}},
+		URIs:                  []*url.URL{id},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key}
+}
+
+// issue returns an X509SVID message for id
+func (ca *testCA) issue(t *testing.T, id string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	uri, _ := url.Parse(id)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		URIs:         []*url.URL{uri},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	var svid []byte
+	svid = protowire.AppendTag(svid, 1, protowire.BytesType)
+	svid = protowire.AppendString(svid, id)
+	svid = protowire.AppendTag(svid, 2, protowire.BytesType)
+	svid = protowire.AppendBytes(svid, der)
+	svid = protowire.AppendTag(svid, 3, protowire.BytesType)
+	svid = protowire.AppendBytes(svid, keyDER)
+	svid = protowire.AppendTag(svid, 4, protowire.BytesType)
+	svid = protowire.AppendBytes(svid, ca.cert.Raw)
+	return svid
+}
+
+// svidResponse wraps SVIDs in an X509SVIDResponse
+func svidResponse(svids ...[]byte) []byte {
+	var response []byte
+	for _, svid := range svids {
+		response = protowire.AppendTag(response, 1, protowire.BytesType)
+		response = protowire.AppendBytes(response, svid)
+	}
+	return response
+}
+
+// startWorkloadAPI serves FetchX509SVID on a unix socket, streaming the
+// responses sent on the channel
+func startWorkloadAPI(t *testing.T, responses <-chan []byte) string {
+	dir, err := os.MkdirTemp("", "spire")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "agent.sock")
+	lis, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	server := grpc.NewServer(
+		grpc.ForceServerCodec(rawCodec{}),
+		grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+			method, _ := grpc.MethodFromServerStream(stream)
+			md, _ := metadata.FromIncomingContext(stream.Context())
+			if method != fetchX509SVIDMethod || len(md.Get(workloadAPIHeader)) == 0 {
+				return io.ErrUnexpectedEOF
+			}
+			var request []byte
+			if err := stream.RecvMsg(&request); err != nil {
+				return err
+			}
+			for {
+				select {
+				case response := <-responses:
+					if err := stream.SendMsg(&response); err != nil {
+						return err
+					}
+				case <-stream.Context().Done():
+					return nil
+				}
+			}
+		}),
+	)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	return "unix://" + socket
+}
+
+func newTestSource(t *testing.T, responses <-chan []byte) *Source {
+	source := New(&config.SPIFFEConfig{Enabled: true, SocketPath: startWorkloadAPI(t, responses)}, &mockLogger{})
+	source.Start()
+	t.Cleanup(source.Stop)
+	return source
+}
+
+func waitReady(t *testing.T, source *Source) {
+	select {
+	case <-source.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("no SVID received")
+	}
+}
+
+func TestSourceReceivesAndRotatesSVIDs(t *testing.T) {
+	ca := newTestCA(t, "example.org")
+	responses := make(chan []byte, 2)
+	responses <- svidResponse(ca.issue(t, "spiffe://example.org/gateway"), ca.issue(t, "spiffe://example.org/other"))
+	source := newTestSource(t, responses)
+
+	waitReady(t, source)
+	assert.Equal(t, "spiffe://example.org/gateway", source.ID())
+	first, _, _, err := source.current()
+	require.NoError(t, err)
+
+	responses <- svidResponse(ca.issue(t, "spiffe://example.org/gateway"))
+	require.Eventually(t, func() bool {
+		cert, _, _, _ := source.current()
+		return cert != first
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSourceMutualTLS(t *testing.T) {
+	ca := newTestCA(t, "example.org")
+	gatewayResponses, upstreamResponses := make(chan []byte, 1), make(chan []byte, 1)
+	gatewayResponses <- svidResponse(ca.issue(t, "spiffe://example.org/gateway"))
+	upstreamResponses <- svidResponse(ca.issue(t, "spiffe://example.org/users"))
+	gateway, upstream := newTestSource(t, gatewayResponses), newTestSource(t, upstreamResponses)
+	waitReady(t, gateway)
+	waitReady(t, upstream)
+
+	serve := func(allowed []string) string {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		server := &http.Server{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("ok"))
+			}),
+			TLSConfig: upstream.ServerTLSConfig(allowed),
+			ErrorLog:  log.New(io.Discard, "", 0),
+		}
+		go server.ServeTLS(lis, "", "")
+		t.Cleanup(func() { server.Close() })
+		return "https://" + lis.Addr().String()
+	}
+	get := func(serverURL string, serverID string) error {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: gateway.ClientTLSConfig(serverID)}}
+		resp, err := client.Get(serverURL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// The trust domain is accepted by default
+	assert.NoError(t, get(serve(nil), "spiffe://example.org/users"))
+
+	// The upstream must present the expected ID
+	err := get(serve(nil), "spiffe://example.org/payments")
+	assert.ErrorContains(t, err, "expected spiffe://example.org/payments")
+
+	// Only allowed IDs reach the internal listener
+	assert.NoError(t, get(serve([]string{"spiffe://example.org/gateway"}), "spiffe://example.org/users"))
+	assert.Error(t, get(serve([]string{"spiffe://example.org/billing"}), "spiffe://example.org/users"))
+}
+
+func TestVerifySVIDRejectsOtherTrustDomains(t *testing.T) {
+	ca, other := newTestCA(t, "example.org"), newTestCA(t, "evil.org")
+	svid, err := parseX509SVID(other.issue(t, "spiffe://evil.org/gateway"))
+	require.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	_, err = verifySVID([][]byte{svid.chain[0].Raw}, roots, x509.ExtKeyUsageClientAuth)
+	assert.ErrorContains(t, err, "peer SVID not trusted")
+}
+
+func TestParseX509SVIDResponse(t *testing.T) {
+	_, err := parseX509SVIDResponse(nil)
+	assert.EqualError(t, err, "workload API response has no SVID")
+
+	// The certificate must carry the SVID's ID
+	ca := newTestCA(t, "example.org")
+	svid := ca.issue(t, "spiffe://example.org/gateway")
+	var mismatched []byte
+	mismatched = protowire.AppendTag(mismatched, 1, protowire.BytesType)
+	mismatched = protowire.AppendString(mismatched, "spiffe://example.org/admin")
+	_, err = parseX509SVIDResponse(svidResponse(append(svid, mismatched...)))
+	assert.EqualError(t, err, "SVID certificate does not carry SPIFFE ID spiffe://example.org/admin")
+
+	_, _, _, err = (&Source{}).current()
+	assert.ErrorIs(t, err, errNoSVID)
+}
@@ -0,0 +1,178 @@
+package spiffe
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// fetchX509SVIDMethod streams the workload's X.509 SVIDs and trust bundle
+const fetchX509SVIDMethod = "/SpiffeWorkloadAPI/FetchX509SVID"
+
+// workloadAPIHeader must be sent with every Workload API call, so the agent
+// can tell workloads from proxied requests
+const workloadAPIHeader = "workload.spiffe.io"
+
+// x509SVID is an X.509 SVID with the trust bundle of its trust domain
+type x509SVID struct {
+	id     string
+	chain  []*x509.Certificate
+	key    crypto.Signer
+	bundle []*x509.Certificate
+}
+
+// rawCodec passes Workload API messages through as bytes. The few fields the
+// gateway needs are decoded with protowire rather than generated code.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	return *v.(*[]byte), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*[]byte) = append([]byte(nil), data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+// dialWorkloadAPI connects to the agent's Workload API. Unix socket addresses
+// are passed to gRPC as is; tcp:// addresses are dialed as host:port.
+func dialWorkloadAPI(address string) (*grpc.ClientConn, error) {
+	target := address
+	if strings.HasPrefix(address, "tcp://") {
+		target = strings.TrimPrefix(address, "tcp://")
+	}
+	return grpc.Dial(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+}
+
+// watchX509SVIDs calls update with the default SVID of every response the
+// agent streams, until the stream fails or ctx is canceled
+func watchX509SVIDs(ctx context.Context, conn *grpc.ClientConn, update func(*x509SVID)) error {
+	ctx = metadata.AppendToOutgoingContext(ctx, workloadAPIHeader, "true")
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, fetchX509SVIDMethod, grpc.ForceCodec(rawCodec{}))
+	if err != nil {
+		return err
+	}
+	request := []byte{}
+	if err := stream.SendMsg(&request); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+
+	for {
+		var response []byte
+		if err := stream.RecvMsg(&response); err != nil {
+			if err == io.EOF {
+				return errors.New("workload API closed the stream")
+			}
+			return err
+		}
+		svid, err := parseX509SVIDResponse(response)
+		if err != nil {
+			return err
+		}
+		update(svid)
+	}
+}
+
+// parseX509SVIDResponse decodes the first, default SVID of an
+// X509SVIDResponse. Federated bundles are ignored: only the gateway's own
+// trust domain is trusted.
+func parseX509SVIDResponse(data []byte) (*x509SVID, error) {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+		if num == 1 && typ == protowire.BytesType {
+			svid, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			return parseX509SVID(svid)
+		}
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+	return nil, errors.New("workload API response has no SVID")
+}
+
+// parseX509SVID decodes an X509SVID message: the SPIFFE ID, the DER
+// certificate chain, the PKCS#8 key and the DER trust bundle
+func parseX509SVID(data []byte) (*x509SVID, error) {
+	var id string
+	var chain, key, bundle []byte
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		} else {
+			var value []byte
+			value, n = protowire.ConsumeBytes(data)
+			switch num {
+			case 1:
+				id = string(value)
+			case 2:
+				chain = value
+			case 3:
+				key = value
+			case 4:
+				bundle = value
+			}
+		}
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+
+	svid := &x509SVID{id: id}
+	var err error
+	if svid.chain, err = x509.ParseCertificates(chain); err != nil {
+		return nil, fmt.Errorf("invalid SVID certificates: %w", err)
+	}
+	if len(svid.chain) == 0 {
+		return nil, errors.New("SVID has no certificates")
+	}
+	parsedKey, err := x509.ParsePKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SVID key: %w", err)
+	}
+	signer, ok := parsedKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("invalid SVID key: not a signing key")
+	}
+	svid.key = signer
+	if svid.bundle, err = x509.ParseCertificates(bundle); err != nil {
+		return nil, fmt.Errorf("invalid trust bundle: %w", err)
+	}
+	if len(svid.bundle) == 0 {
+		return nil, errors.New("SVID has no trust bundle")
+	}
+	if leafID, err := spiffeID(svid.chain[0]); err != nil || leafID != id {
+		return nil, fmt.Errorf("SVID certificate does not carry SPIFFE ID %s", id)
+	}
+	return svid, nil
+}
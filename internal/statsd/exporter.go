@@ -0,0 +1,270 @@
+package statsd
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// metricPrefix selects the gateway's own metrics from the registry
+const metricPrefix = "gateway_"
+
+// Exporter pushes the gateway's Prometheus metrics to a StatsD or DogStatsD
+// agent. Counters are sent as deltas since the previous flush, gauges as their
+// current value and histograms as count and sum deltas. Request latencies
+// reported through Timing are sent individually so the agent can compute
+// percentiles.
+type Exporter struct {
+	config   *config.StatsDConfig
+	gatherer prometheus.Gatherer
+	conn     net.Conn
+	tags     []string
+	log      logger.Logger
+
+	mutex    sync.Mutex
+	buffer   []byte
+	previous map[string]float64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New creates an exporter sending to the configured agent address
+func New(cfg *config.StatsDConfig, gatherer prometheus.Gatherer, log logger.Logger) (*Exporter, error) {
+	switch cfg.Flavor {
+	case config.StatsDFlavorStatsD, config.StatsDFlavorDogStatsD:
+	default:
+		return nil, fmt.Errorf("unsupported statsd flavor %q", cfg.Flavor)
+	}
+
+	conn, err := net.Dial("udp", cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to statsd agent: %w", err)
+	}
+
+	tags := make([]string, 0, len(cfg.Tags))
+	for _, tag := range cfg.Tags {
+		tags = append(tags, sanitize(tag))
+	}
+
+	return &Exporter{
+		config:   cfg,
+		gatherer: gatherer,
+		conn:     conn,
+		tags:     tags,
+		log:      log,
+		previous: make(map[string]float64),
+	}, nil
+}
+
+// Start flushes metrics every flush interval until Stop is called
+func (e *Exporter) Start() {
+	interval := time.Duration(e.config.FlushInterval) * time.Second
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	e.stop = make(chan struct{})
+	e.done = make(chan struct{})
+	go func() {
+		defer close(e.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				e.Flush()
+			case <-e.stop:
+				return
+			}
+		}
+	}()
+
+	e.log.Info("Started StatsD exporter",
+		logger.String("address", e.config.Address),
+		logger.String("flavor", e.config.Flavor),
+	)
+}
+
+// Stop sends a final flush and closes the connection
+func (e *Exporter) Stop() {
+	if e.stop != nil {
+		close(e.stop)
+		<-e.done
+		e.stop = nil
+	}
+	e.Flush()
+	e.conn.Close()
+}
+
+// Timing records a single duration, sent as a StatsD timer
+func (e *Exporter) Timing(name string, d time.Duration, tags map[string]string) {
+	value := strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64)
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.write(e.line(e.config.Prefix+"."+name, value, "ms", tags))
+}
+
+// Flush sends the current registry values and any buffered timings
+func (e *Exporter) Flush() {
+	families, err := e.gatherer.Gather()
+	if err != nil {
+		e.log.Warn("Failed to gather metrics for StatsD", logger.Error(err))
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), metricPrefix) {
+			continue
+		}
+		name := e.metricName(family.GetName())
+
+		for _, metric := range family.GetMetric() {
+			tags := labelTags(metric.GetLabel())
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				e.writeDelta(name, metric.GetCounter().GetValue(), tags)
+			case dto.MetricType_GAUGE:
+				e.write(e.line(name, formatValue(metric.GetGauge().GetValue()), "g", tags))
+			case dto.MetricType_UNTYPED:
+				e.write(e.line(name, formatValue(metric.GetUntyped().GetValue()), "g", tags))
+			case dto.MetricType_HISTOGRAM:
+				histogram := metric.GetHistogram()
+				e.writeDelta(name+".count", float64(histogram.GetSampleCount()), tags)
+				e.writeDelta(name+".sum", histogram.GetSampleSum(), tags)
+			}
+		}
+	}
+
+	e.send()
+}
+
+// metricName converts a Prometheus metric name to a prefixed StatsD name
+func (e *Exporter) metricName(name string) string {
+	name = strings.TrimSuffix(strings.TrimPrefix(name, metricPrefix), "_total")
+	return e.config.Prefix + "." + name
+}
+
+// writeDelta writes the increase of a cumulative value since the last flush
+func (e *Exporter) writeDelta(name string, value float64, tags map[string]string) {
+	key := seriesKey(name, tags)
+	delta := value - e.previous[key]
+	if delta < 0 {
+		// The counter was reset
+		delta = value
+	}
+	e.previous[key] = value
+
+	if delta > 0 {
+		e.write(e.line(name, formatValue(delta), "c", tags))
+	}
+}
+
+// line formats one metric in the configured flavor
+func (e *Exporter) line(name, value, kind string, tags map[string]string) string {
+	line := sanitizeName(name) + ":" + value + "|" + kind
+	if e.config.Flavor != config.StatsDFlavorDogStatsD {
+		return line
+	}
+
+	all := append([]string(nil), e.tags...)
+	for key, val := range tags {
+		if val != "" {
+			all = append(all, sanitize(key)+":"+sanitize(val))
+		}
+	}
+	if len(all) == 0 {
+		return line
+	}
+	sort.Strings(all)
+	return line + "|#" + strings.Join(all, ",")
+}
+
+// write appends a line to the packet buffer, sending the buffer first if the
+// line would not fit
+func (e *Exporter) write(line string) {
+	if len(e.buffer) > 0 && len(e.buffer)+1+len(line) > e.config.MaxPacketSize {
+		e.send()
+	}
+	if len(e.buffer) > 0 {
+		e.buffer = append(e.buffer, '\n')
+	}
+	e.buffer = append(e.buffer, line...)
+}
+
+// send writes the buffered packet to the agent
+func (e *Exporter) send() {
+	if len(e.buffer) == 0 {
+		return
+	}
+	if _, err := e.conn.Write(e.buffer); err != nil {
+		e.log.Debug("Failed to send StatsD packet", logger.Error(err))
+	}
+	e.buffer = e.buffer[:0]
+}
+
+// labelTags converts Prometheus labels to tags
+func labelTags(labels []*dto.LabelPair) map[string]string {
+	tags := make(map[string]string, len(labels))
+	for _, label := range labels {
+		tags[label.GetName()] = label.GetValue()
+	}
+	return tags
+}
+
+// seriesKey identifies a metric series across flushes
+func seriesKey(name string, tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(name)
+	for _, key := range keys {
+		b.WriteString("\x00" + key + "=" + tags[key])
+	}
+	return b.String()
+}
+
+// formatValue formats a metric value without exponent notation
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// sanitizeName replaces characters that delimit the StatsD line format
+func sanitizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', '@', '#', ',', '\n', ' ':
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// sanitize replaces characters that delimit DogStatsD tags
+func sanitize(tag string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '|', '#', ',', '\n', ' ':
+			return '_'
+		}
+		return r
+	}, tag)
+}
@@ -0,0 +1,129 @@
+package statsd
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/pkg/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockLogger implements the logger.Logger interface for testing
+type mockLogger struct{}
+
+func (m *mockLogger) Debug(msg string, fields ...logger.Field)  {}
+func (m *mockLogger) Info(msg string, fields ...logger.Field)   {}
+func (m *mockLogger) Warn(msg string, fields ...logger.Field)   {}
+func (m *mockLogger) Error(msg string, fields ...logger.Field)  {}
+func (m *mockLogger) Fatal(msg string, fields ...logger.Field)  {}
+func (m *mockLogger) With(fields ...logger.Field) logger.Logger { return m }
+
+// newAgent starts a UDP listener standing in for the StatsD agent
+func newAgent(t *testing.T) (*net.UDPConn, func() []string) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	receive := func() []string {
+		var lines []string
+		buf := make([]byte, 65536)
+		for {
+			conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			n, err := conn.Read(buf)
+			if err != nil {
+				return lines
+			}
+			lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+		}
+	}
+	return conn, receive
+}
+
+func newTestRegistry() (*prometheus.Registry, *prometheus.CounterVec, prometheus.Gauge, prometheus.Histogram) {
+	registry := prometheus.NewRegistry()
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "gateway_requests_total", Help: "h"}, []string{"route"})
+	open := prometheus.NewGauge(prometheus.GaugeOpts{Name: "gateway_open_connections", Help: "h"})
+	latency := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "gateway_latency_seconds", Help: "h"})
+	other := prometheus.NewCounter(prometheus.CounterOpts{Name: "go_other_total", Help: "h"})
+	registry.MustRegister(requests, open, latency, other)
+	other.Inc()
+	return registry, requests, open, latency
+}
+
+func TestExporter_Flush(t *testing.T) {
+	agent, receive := newAgent(t)
+	registry, requests, open, latency := newTestRegistry()
+
+	exporter, err := New(&config.StatsDConfig{
+		Address:       agent.LocalAddr().String(),
+		Flavor:        config.StatsDFlavorDogStatsD,
+		Prefix:        "gw",
+		Tags:          []string{"env:test"},
+		MaxPacketSize: 1432,
+	}, registry, &mockLogger{})
+	require.NoError(t, err)
+	defer exporter.Stop()
+
+	requests.WithLabelValues("/orders").Add(3)
+	open.Set(7)
+	latency.Observe(0.5)
+	exporter.Flush()
+
+	lines := receive()
+	assert.ElementsMatch(t, []string{
+		"gw.requests:3|c|#env:test,route:/orders",
+		"gw.open_connections:7|g|#env:test",
+		"gw.latency_seconds.count:1|c|#env:test",
+		"gw.latency_seconds.sum:0.5|c|#env:test",
+	}, lines)
+
+	t.Run("counters are sent as deltas", func(t *testing.T) {
+		requests.WithLabelValues("/orders").Add(2)
+		exporter.Flush()
+		assert.ElementsMatch(t, []string{
+			"gw.requests:2|c|#env:test,route:/orders",
+			"gw.open_connections:7|g|#env:test",
+		}, receive())
+	})
+
+	t.Run("timings", func(t *testing.T) {
+		exporter.Timing("route.request.duration", 1500*time.Microsecond, map[string]string{"route": "/orders", "team": ""})
+		exporter.Flush()
+		assert.Contains(t, receive(), "gw.route.request.duration:1.5|ms|#env:test,route:/orders")
+	})
+}
+
+func TestExporter_PlainStatsD(t *testing.T) {
+	agent, receive := newAgent(t)
+	registry, requests, _, _ := newTestRegistry()
+
+	exporter, err := New(&config.StatsDConfig{
+		Address:       agent.LocalAddr().String(),
+		Flavor:        config.StatsDFlavorStatsD,
+		Prefix:        "gw",
+		Tags:          []string{"env:test"},
+		MaxPacketSize: 40,
+	}, registry, &mockLogger{})
+	require.NoError(t, err)
+	defer exporter.Stop()
+
+	requests.WithLabelValues("/a").Inc()
+	exporter.Flush()
+
+	lines := receive()
+	assert.Contains(t, lines, "gw.requests:1|c")
+	for _, line := range lines {
+		assert.NotContains(t, line, "#")
+	}
+}
+
+func TestNew_InvalidFlavor(t *testing.T) {
+	_, err := New(&config.StatsDConfig{Address: "127.0.0.1:8125", Flavor: "graphite"}, prometheus.NewRegistry(), &mockLogger{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,21 @@
+package util
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+)
+
+// ConnectionAddr returns the address of the client's connection, ignoring
+// forwarding headers, which clients can forge
+func ConnectionAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
@@ -2,6 +2,7 @@ package etcd_discovery
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"log"
 	"strings"
@@ -28,14 +29,43 @@ type ServiceDiscovery struct {
 	watchCancel  context.CancelFunc
 	prefix       string
 	isRegistered bool
+
+	requestTimeout time.Duration
+	requireLease   bool
+	revision       int64 // store revision of the last full listing
+	updates        chan struct{}
+}
+
+// Config contains etcd connection settings for service discovery
+type Config struct {
+	Endpoints      []string
+	DialTimeout    time.Duration
+	RequestTimeout time.Duration
+	Username       string
+	Password       string
+	TLS            *tls.Config
+	// RequireLease ignores keys not bound to a lease, so only instances that
+	// keep their registration alive are discovered
+	RequireLease bool
 }
 
 // NewServiceDiscovery create a service discovery client
 func NewServiceDiscovery(endpoints []string, dialTimeout time.Duration) (*ServiceDiscovery, error) {
-	client, err := clientv3.New(clientv3.Config{
+	return NewServiceDiscoveryWithConfig(Config{
 		Endpoints:   endpoints,
 		DialTimeout: dialTimeout,
 	})
+}
+
+// NewServiceDiscoveryWithConfig create a service discovery client with TLS and authentication
+func NewServiceDiscoveryWithConfig(cfg Config) (*ServiceDiscovery, error) {
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   cfg.Endpoints,
+		DialTimeout: cfg.DialTimeout,
+		Username:    cfg.Username,
+		Password:    cfg.Password,
+		TLS:         cfg.TLS,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -43,14 +73,42 @@ func NewServiceDiscovery(endpoints []string, dialTimeout time.Duration) (*Servic
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &ServiceDiscovery{
-		client:       client,
-		ctx:          ctx,
-		cancel:       cancel,
-		services:     make(map[string][]string),
-		isRegistered: false,
+		client:         client,
+		ctx:            ctx,
+		cancel:         cancel,
+		services:       make(map[string][]string),
+		lastIndex:      make(map[string]int),
+		isRegistered:   false,
+		requestTimeout: cfg.RequestTimeout,
+		requireLease:   cfg.RequireLease,
+		updates:        make(chan struct{}, 1),
 	}, nil
 }
 
+// Updates returns a channel that is signalled whenever discovered instances may have changed
+func (s *ServiceDiscovery) Updates() <-chan struct{} {
+	return s.updates
+}
+
+// notifyUpdate signals a change without blocking if a signal is already pending
+func (s *ServiceDiscovery) notifyUpdate() {
+	if s.updates == nil {
+		return
+	}
+	select {
+	case s.updates <- struct{}{}:
+	default:
+	}
+}
+
+// requestContext returns a context bounded by the request timeout if configured
+func (s *ServiceDiscovery) requestContext() (context.Context, context.CancelFunc) {
+	if s.requestTimeout > 0 {
+		return context.WithTimeout(s.ctx, s.requestTimeout)
+	}
+	return context.WithCancel(s.ctx)
+}
+
 // RegisterService registration service
 func (s *ServiceDiscovery) RegisterService(prefix, serviceName, serviceAddr string, ttl int64) error {
 	if s.isRegistered {
@@ -109,8 +167,12 @@ func (s *ServiceDiscovery) listenLeaseRespChan() {
 // DiscoverServices discovery Service
 func (s *ServiceDiscovery) DiscoverServices(prefix, serviceName string) ([]string, error) {
 	s.prefix = prefix
-	key := "/" + s.prefix + "/" + serviceName + "/"
-	resp, err := s.client.Get(s.ctx, key, clientv3.WithPrefix())
+	key := s.serviceKey(serviceName)
+
+	ctx, cancel := s.requestContext()
+	defer cancel()
+
+	resp, err := s.client.Get(ctx, key, clientv3.WithPrefix())
 	if err != nil {
 		return nil, err
 	}
@@ -118,35 +180,76 @@ func (s *ServiceDiscovery) DiscoverServices(prefix, serviceName string) ([]strin
 	addrs := s.extractAddrs(resp)
 	s.lock.Lock()
 	s.services[serviceName] = addrs
+	s.revision = resp.Header.Revision
 	s.lock.Unlock()
+	s.notifyUpdate()
 
 	// todo Store the addrs result in the memory cache, and if addrs is equal to nil, retrieve it from the cache
 
 	return addrs, nil
 }
 
-// WatchServices monitor service change
+// WatchServices monitor service change. Instances registered with a lease are
+// removed when the lease expires; if the watch is interrupted or compacted the
+// service is listed again and watched from the new revision.
 func (s *ServiceDiscovery) WatchServices(serviceName string) {
-	key := s.prefix + "/" + serviceName + "/"
+	key := s.serviceKey(serviceName)
 	ctx, cancel := context.WithCancel(s.ctx)
 	s.watchCancel = cancel
-	s.watchChan = s.client.Watch(ctx, key, clientv3.WithPrefix())
 
 	go func() {
-		for resp := range s.watchChan {
-			for _, ev := range resp.Events {
-				switch ev.Type {
-				case mvccpb.PUT: // add or modify
-					s.handlePutEvent(serviceName, ev.Kv)
-				case mvccpb.DELETE: // delete
-					s.handleDeleteEvent(serviceName, ev.Kv)
+		for ctx.Err() == nil {
+			s.lock.RLock()
+			rev := s.revision
+			s.lock.RUnlock()
+
+			opts := []clientv3.OpOption{clientv3.WithPrefix()}
+			if rev > 0 {
+				opts = append(opts, clientv3.WithRev(rev+1))
+			}
+			s.watchChan = s.client.Watch(clientv3.WithRequireLeader(ctx), key, opts...)
+
+			for resp := range s.watchChan {
+				if err := resp.Err(); err != nil {
+					log.Printf("Watch error for service %s: %v\n", serviceName, err)
+					break
 				}
+				for _, ev := range resp.Events {
+					switch ev.Type {
+					case mvccpb.PUT: // add or modify
+						s.handlePutEvent(serviceName, ev.Kv)
+					case mvccpb.DELETE: // delete or lease expired
+						s.handleDeleteEvent(serviceName, ev.Kv)
+					}
+				}
+				s.lock.Lock()
+				s.revision = resp.Header.Revision
+				s.lock.Unlock()
+			}
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			// Resynchronise before watching again so no events are missed
+			time.Sleep(time.Second)
+			if _, err := s.DiscoverServices(s.prefix, serviceName); err != nil {
+				log.Printf("Failed to resync service %s: %v\n", serviceName, err)
 			}
 		}
 	}()
 }
 
+// serviceKey returns the key prefix for a service, format: /prefix/serviceName/
+func (s *ServiceDiscovery) serviceKey(serviceName string) string {
+	return "/" + s.prefix + "/" + serviceName + "/"
+}
+
 func (s *ServiceDiscovery) handlePutEvent(serviceName string, kv *mvccpb.KeyValue) {
+	if s.requireLease && kv.Lease == 0 {
+		return
+	}
+
 	addr := string(kv.Value)
 	s.lock.Lock()
 	defer s.lock.Unlock()
@@ -159,6 +262,7 @@ func (s *ServiceDiscovery) handlePutEvent(serviceName string, kv *mvccpb.KeyValu
 	}
 
 	s.services[serviceName] = append(addrs, addr)
+	s.notifyUpdate()
 	log.Printf("Service added: %s, addr: %s\n", serviceName, addr)
 }
 
@@ -177,6 +281,7 @@ func (s *ServiceDiscovery) handleDeleteEvent(serviceName string, kv *mvccpb.KeyV
 	for i, a := range addrs {
 		if a == addr {
 			s.services[serviceName] = append(addrs[:i], addrs[i+1:]...)
+			s.notifyUpdate()
 			log.Printf("Service removed: %s, addr: %s\n", serviceName, addr)
 			break
 		}
@@ -187,7 +292,13 @@ func (s *ServiceDiscovery) handleDeleteEvent(serviceName string, kv *mvccpb.KeyV
 func (s *ServiceDiscovery) GetService(serviceName string) []string {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
-	return s.services[serviceName]
+
+	// Return a copy so callers never observe concurrent watch updates
+	addrs := s.services[serviceName]
+	if addrs == nil {
+		return nil
+	}
+	return append([]string(nil), addrs...)
 }
 
 // Close service discovery
@@ -215,6 +326,9 @@ func (s *ServiceDiscovery) Close() error {
 func (s *ServiceDiscovery) extractAddrs(resp *clientv3.GetResponse) []string {
 	addrs := make([]string, 0)
 	for _, kv := range resp.Kvs {
+		if s.requireLease && kv.Lease == 0 {
+			continue
+		}
 		key := string(kv.Key)
 		parts := strings.Split(key, "/")
 		if len(parts) < 2 {
@@ -189,6 +189,73 @@ func TestHandlePutAndDeleteEvents(t *testing.T) {
 	assert.Contains(t, addrs, "localhost:8080")
 }
 
+func TestRequireLease(t *testing.T) {
+	sd := &ServiceDiscovery{
+		services:     map[string][]string{},
+		requireLease: true,
+	}
+
+	resp := &clientv3.GetResponse{
+		Kvs: []*mvccpb.KeyValue{
+			{Key: []byte("/services/test-service/localhost:8080"), Value: []byte("localhost:8080"), Lease: 42},
+			{Key: []byte("/services/test-service/localhost:8081"), Value: []byte("localhost:8081")},
+		},
+	}
+	assert.Equal(t, []string{"localhost:8080"}, sd.extractAddrs(resp))
+
+	// Keys without a lease never become live instances
+	sd.handlePutEvent("test-service", &mvccpb.KeyValue{
+		Key:   []byte("/services/test-service/localhost:8082"),
+		Value: []byte("localhost:8082"),
+	})
+	assert.Empty(t, sd.GetService("test-service"))
+
+	sd.handlePutEvent("test-service", &mvccpb.KeyValue{
+		Key:   []byte("/services/test-service/localhost:8082"),
+		Value: []byte("localhost:8082"),
+		Lease: 7,
+	})
+	assert.Equal(t, []string{"localhost:8082"}, sd.GetService("test-service"))
+}
+
+func TestUpdatesNotification(t *testing.T) {
+	sd := &ServiceDiscovery{
+		services: map[string][]string{},
+		updates:  make(chan struct{}, 1),
+	}
+
+	sd.handlePutEvent("test-service", &mvccpb.KeyValue{
+		Key:   []byte("/services/test-service/localhost:8080"),
+		Value: []byte("localhost:8080"),
+	})
+	sd.handlePutEvent("test-service", &mvccpb.KeyValue{
+		Key:   []byte("/services/test-service/localhost:8081"),
+		Value: []byte("localhost:8081"),
+	})
+
+	// Pending notifications are coalesced
+	select {
+	case <-sd.Updates():
+	default:
+		t.Fatal("expected an update notification")
+	}
+	select {
+	case <-sd.Updates():
+		t.Fatal("notifications should be coalesced")
+	default:
+	}
+
+	// Returned slices are copies
+	addrs := sd.GetService("test-service")
+	addrs[0] = "changed"
+	assert.Equal(t, "localhost:8080", sd.GetService("test-service")[0])
+}
+
+func TestServiceKey(t *testing.T) {
+	sd := &ServiceDiscovery{prefix: "services"}
+	assert.Equal(t, "/services/test-service/", sd.serviceKey("test-service"))
+}
+
 func TestGetNextAddr(t *testing.T) {
 	// Create a service discovery instance with test addresses
 	sd := &ServiceDiscovery{
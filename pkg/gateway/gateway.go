@@ -0,0 +1,64 @@
+// Package gateway runs the API gateway inside a Go program, for programs that
+// extend it with hooks. Register the hooks with package hooks, then create
+// the gateway with New and Start it.
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"api-gateway/internal/server"
+	"api-gateway/pkg/logger"
+)
+
+// Gateway is an API gateway serving the routes of its configuration files
+type Gateway struct {
+	server     *server.Server
+	configPath string
+	routesPath string
+}
+
+// New loads the config and routes files and creates a gateway. The hooks
+// registered by then run on its routes.
+func New(configPath, routesPath string, log logger.Logger) (*Gateway, error) {
+	cfg, routes, err := server.LoadConfigFiles(configPath, routesPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, deprecation := range cfg.Deprecations {
+		log.Warn("Deprecated configuration",
+			logger.String("config_file", configPath),
+			logger.String("setting", deprecation))
+	}
+	for _, deprecation := range routes.Deprecations {
+		log.Warn("Deprecated configuration",
+			logger.String("config_file", routesPath),
+			logger.String("setting", deprecation))
+	}
+
+	return &Gateway{
+		server:     server.NewServer(cfg, routes, log),
+		configPath: configPath,
+		routesPath: routesPath,
+	}, nil
+}
+
+// Start serves requests until the gateway is stopped
+func (g *Gateway) Start() error {
+	if err := g.server.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Reload re-reads the configuration files, keeping the running
+// configuration if they are invalid
+func (g *Gateway) Reload() error {
+	return g.server.Reload(g.configPath, g.routesPath)
+}
+
+// Stop drains in-flight requests and stops the gateway
+func (g *Gateway) Stop(ctx context.Context) error {
+	return g.server.Stop(ctx)
+}
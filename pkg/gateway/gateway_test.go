@@ -0,0 +1,51 @@
+package gateway
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"api-gateway/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockLogger implements the logger.Logger interface for testing
+type mockLogger struct{}
+
+func (m *mockLogger) Debug(msg string, args ...logger.Field) {}
+func (m *mockLogger) Info(msg string, args ...logger.Field)  {}
+func (m *mockLogger) Warn(msg string, args ...logger.Field)  {}
+func (m *mockLogger) Error(msg string, args ...logger.Field) {}
+func (m *mockLogger) Fatal(msg string, args ...logger.Field) {}
+func (m *mockLogger) With(fields ...logger.Field) logger.Logger {
+	return m
+}
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	routesPath := filepath.Join(dir, "routes.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("server:\n  address: 127.0.0.1:0\n"), 0o600))
+	require.NoError(t, os.WriteFile(routesPath, []byte("routes:\n  - path: /api\n    upstream: http://127.0.0.1:9\n"), 0o600))
+
+	gateway, err := New(configPath, routesPath, &mockLogger{})
+	require.NoError(t, err)
+	started := make(chan error, 1)
+	go func() { started <- gateway.Start() }()
+	assert.NoError(t, gateway.Reload())
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, gateway.Stop(context.Background()))
+	select {
+	case err := <-started:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("gateway didn't stop")
+	}
+
+	_, err = New(filepath.Join(dir, "missing.yaml"), routesPath, &mockLogger{})
+	assert.Error(t, err)
+}
@@ -54,6 +54,7 @@ var (
 // ClientConn represents a gRPC client connection interface
 type ClientConn interface {
 	Invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error
+	NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error)
 }
 
 type ClientPool struct {
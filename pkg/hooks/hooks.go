@@ -0,0 +1,117 @@
+// Package hooks lets Go programs embedding the gateway observe and act on
+// proxied requests without changing its internal packages. Hooks are
+// registered by name before the gateway is created with package gateway, and
+// run in registration order for every request an HTTP route proxies
+// upstream, sandbox and split-horizon upstreams included. They don't run for
+// STATIC, GRPC and GRPC_WEBSOCKET routes or WebSocket connections, which have
+// no upstream HTTP response to act on.
+package hooks
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// Hook receives the lifecycle events of proxied requests. Embed Base to
+// implement only some of them. Hooks are called concurrently.
+type Hook interface {
+	// OnRequest is called before the upstream is selected. Returning an
+	// error rejects the request, with the status of a *Rejection or 500.
+	OnRequest(r *http.Request, route Route) error
+
+	// OnUpstreamSelected is called with the endpoint the request is sent to
+	OnUpstreamSelected(r *http.Request, route Route, upstream *url.URL)
+
+	// OnResponse is called with the upstream response before it is copied
+	// to the client, and may change its status and headers. Returning an
+	// error answers the client with a 502 instead.
+	OnResponse(resp *http.Response, route Route) error
+
+	// OnError is called when the upstream could not be reached or its
+	// response was rejected
+	OnError(r *http.Request, route Route, err error)
+}
+
+// Route describes the route of a request
+type Route struct {
+	Path     string
+	Upstream string
+	Tags     []string
+	Labels   map[string]string
+}
+
+// Rejection is an OnRequest error answered with its status and message
+type Rejection struct {
+	Status  int
+	Message string
+}
+
+// Error returns the rejection message
+func (r *Rejection) Error() string {
+	return r.Message
+}
+
+// Base implements Hook doing nothing
+type Base struct{}
+
+// OnRequest accepts the request
+func (Base) OnRequest(*http.Request, Route) error { return nil }
+
+// OnUpstreamSelected does nothing
+func (Base) OnUpstreamSelected(*http.Request, Route, *url.URL) {}
+
+// OnResponse accepts the response
+func (Base) OnResponse(*http.Response, Route) error { return nil }
+
+// OnError does nothing
+func (Base) OnError(*http.Request, Route, error) {}
+
+var (
+	mu    sync.RWMutex
+	names []string
+	hooks = map[string]Hook{}
+)
+
+// Register adds a hook under a name. It panics if the name is already
+// registered or hook is nil, as registration errors are programming errors.
+func Register(name string, hook Hook) {
+	mu.Lock()
+	defer mu.Unlock()
+	if hook == nil {
+		panic("hooks: Register hook is nil")
+	}
+	if _, dup := hooks[name]; dup {
+		panic(fmt.Sprintf("hooks: Register called twice for hook %s", name))
+	}
+	names = append(names, name)
+	hooks[name] = hook
+}
+
+// Unregister removes a hook. Routes built while it was registered keep it.
+func Unregister(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := hooks[name]; !ok {
+		return
+	}
+	delete(hooks, name)
+	for i, registered := range names {
+		if registered == name {
+			names = append(names[:i:i], names[i+1:]...)
+			break
+		}
+	}
+}
+
+// Registered returns the registered hooks in registration order
+func Registered() []Hook {
+	mu.RLock()
+	defer mu.RUnlock()
+	registered := make([]Hook, 0, len(names))
+	for _, name := range names {
+		registered = append(registered, hooks[name])
+	}
+	return registered
+}
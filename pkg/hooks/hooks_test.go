@@ -0,0 +1,27 @@
+package hooks
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type namedHook struct {
+	Base
+	name string
+}
+
+func TestRegister(t *testing.T) {
+	first, second := &namedHook{name: "first"}, &namedHook{name: "second"}
+	Register("first", first)
+	Register("second", second)
+	defer Unregister("second")
+
+	assert.Equal(t, []Hook{first, second}, Registered())
+	assert.Panics(t, func() { Register("first", second) })
+	assert.Panics(t, func() { Register("nil", nil) })
+
+	Unregister("first")
+	Unregister("unknown")
+	assert.Equal(t, []Hook{second}, Registered())
+}
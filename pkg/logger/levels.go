@@ -0,0 +1,165 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Levels controls the global and per-component log levels of a logger and all
+// loggers derived from it. Changes take effect immediately and last until restart.
+type Levels struct {
+	global zap.AtomicLevel
+
+	mutex     sync.Mutex
+	overrides atomic.Pointer[map[string]zapcore.Level]
+}
+
+// newLevels creates level controls starting at the given global level
+func newLevels(level zapcore.Level) *Levels {
+	l := &Levels{global: zap.NewAtomicLevelAt(level)}
+	l.overrides.Store(&map[string]zapcore.Level{})
+	return l
+}
+
+// SetLevel changes the level of a component, or the global level if component
+// is empty. A component level also applies to its dotted sub-components.
+func (l *Levels) SetLevel(component, level string) error {
+	parsed, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+	if component == "" {
+		l.global.SetLevel(parsed)
+		return nil
+	}
+
+	l.update(func(overrides map[string]zapcore.Level) {
+		overrides[component] = parsed
+	})
+	return nil
+}
+
+// ResetLevel makes a component follow the global level again
+func (l *Levels) ResetLevel(component string) {
+	l.update(func(overrides map[string]zapcore.Level) {
+		delete(overrides, component)
+	})
+}
+
+// Snapshot returns the global level and the component overrides
+func (l *Levels) Snapshot() (string, map[string]string) {
+	overrides := *l.overrides.Load()
+	components := make(map[string]string, len(overrides))
+	for name, level := range overrides {
+		components[name] = level.String()
+	}
+	return l.global.Level().String(), components
+}
+
+// update replaces the overrides with a modified copy so readers never lock
+func (l *Levels) update(modify func(map[string]zapcore.Level)) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	current := *l.overrides.Load()
+	next := make(map[string]zapcore.Level, len(current)+1)
+	for name, level := range current {
+		next[name] = level
+	}
+	modify(next)
+	l.overrides.Store(&next)
+}
+
+// enabled reports whether a component logs at level, using the most specific
+// override and falling back to the global level
+func (l *Levels) enabled(component string, level zapcore.Level) bool {
+	if component != "" {
+		overrides := *l.overrides.Load()
+		for name := component; name != ""; name = parentComponent(name) {
+			if min, ok := overrides[name]; ok {
+				return level >= min
+			}
+		}
+	}
+	return l.global.Enabled(level)
+}
+
+// parentComponent strips the last dotted segment of a component name
+func parentComponent(name string) string {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+// componentEnabler adapts Levels to a zapcore.LevelEnabler for one component
+type componentEnabler struct {
+	levels    *Levels
+	component string
+}
+
+// Enabled implements zapcore.LevelEnabler
+func (e componentEnabler) Enabled(level zapcore.Level) bool {
+	return e.levels.enabled(e.component, level)
+}
+
+// levelCore filters entries by a dynamic level before the wrapped core sees them
+type levelCore struct {
+	zapcore.Core
+	enabler zapcore.LevelEnabler
+}
+
+// Enabled implements zapcore.Core
+func (c *levelCore) Enabled(level zapcore.Level) bool {
+	return c.enabler.Enabled(level)
+}
+
+// With implements zapcore.Core
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), enabler: c.enabler}
+}
+
+// Check implements zapcore.Core
+func (c *levelCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.enabler.Enabled(entry.Level) {
+		return checked
+	}
+	return c.Core.Check(entry, checked)
+}
+
+// filtered wraps an unfiltered zap logger with the component's level check
+func filtered(base *zap.Logger, levels *Levels, component string) *zap.Logger {
+	return base.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &levelCore{Core: core, enabler: componentEnabler{levels: levels, component: component}}
+	}))
+}
+
+// Component returns a logger for a named component whose level can be changed
+// independently, e.g. "proxy" or "middleware.cache". Loggers that don't support
+// levels are returned unchanged.
+func Component(log Logger, name string) Logger {
+	l, ok := log.(*zapLogger)
+	if !ok {
+		return log
+	}
+	return &zapLogger{
+		logger:    filtered(l.base.With(zap.String("component", name)), l.levels, name),
+		base:      l.base,
+		levels:    l.levels,
+		component: name,
+		redact:    l.redact,
+	}
+}
+
+// LevelsOf returns the level controls of a logger, or nil if it has none
+func LevelsOf(log Logger) *Levels {
+	if l, ok := log.(*zapLogger); ok {
+		return l.levels
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package logger
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFileLogger(t *testing.T, level string) (Logger, func() string) {
+	tmpfile, err := os.CreateTemp("", "log")
+	require.NoError(t, err)
+	tmpfile.Close()
+	t.Cleanup(func() { os.Remove(tmpfile.Name()) })
+
+	log := NewLogger(Config{Level: level, Format: "json", Output: tmpfile.Name()})
+	return log, func() string {
+		content, err := os.ReadFile(tmpfile.Name())
+		require.NoError(t, err)
+		return string(content)
+	}
+}
+
+func TestLevels_Global(t *testing.T) {
+	log, read := newFileLogger(t, "info")
+	levels := LevelsOf(log)
+	require.NotNil(t, levels)
+
+	log.Debug("hidden debug")
+	require.NoError(t, levels.SetLevel("", "debug"))
+	log.Debug("visible debug")
+
+	output := read()
+	assert.NotContains(t, output, "hidden debug")
+	assert.Contains(t, output, "visible debug")
+
+	global, _ := levels.Snapshot()
+	assert.Equal(t, "debug", global)
+}
+
+func TestLevels_Components(t *testing.T) {
+	log, read := newFileLogger(t, "info")
+	levels := LevelsOf(log)
+	proxyLog := Component(log, "proxy")
+	cacheLog := Component(log.With(String("service", "test")), "middleware.cache")
+
+	require.NoError(t, levels.SetLevel("proxy", "debug"))
+	require.NoError(t, levels.SetLevel("middleware", "error"))
+
+	log.Debug("root debug")
+	proxyLog.Debug("proxy debug")
+	cacheLog.Warn("cache warning")
+	cacheLog.Error("cache error")
+
+	output := read()
+	assert.NotContains(t, output, "root debug")
+	assert.Contains(t, output, "proxy debug")
+	assert.NotContains(t, output, "cache warning")
+	assert.Contains(t, output, "cache error")
+	assert.Equal(t, 1, strings.Count(output, `"component":"middleware.cache"`))
+
+	t.Run("more specific override wins", func(t *testing.T) {
+		require.NoError(t, levels.SetLevel("middleware.cache", "debug"))
+		cacheLog.Debug("cache debug")
+		assert.Contains(t, read(), "cache debug")
+	})
+
+	t.Run("reset follows global level", func(t *testing.T) {
+		levels.ResetLevel("proxy")
+		proxyLog.Debug("proxy debug after reset")
+		assert.NotContains(t, read(), "proxy debug after reset")
+
+		_, components := levels.Snapshot()
+		assert.Equal(t, map[string]string{"middleware": "error", "middleware.cache": "debug"}, components)
+	})
+
+	t.Run("invalid level", func(t *testing.T) {
+		assert.Error(t, levels.SetLevel("proxy", "verbose"))
+	})
+}
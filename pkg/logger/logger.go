@@ -1,7 +1,7 @@
 package logger
 
 import (
-	"time"
+	"strings"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -47,17 +47,30 @@ type Field struct {
 // zapLogger implements the Logger interface using zap
 type zapLogger struct {
 	logger *zap.Logger
+	// base carries the same fields as logger without the component field and
+	// level filter, so component loggers can be derived from it
+	base      *zap.Logger
+	levels    *Levels
+	component string
+	// redact holds the lowercased keys of fields whose values are masked
+	redact map[string]bool
 }
 
+// redacted replaces the values of fields listed in Config.Redact
+const redacted = "[REDACTED]"
+
 // NewLogger creates a new logger instance with configuration
 func NewLogger(cfg Config) Logger {
 	config := zap.NewProductionConfig()
 
-	// Configure log level
+	// Configure log level. The built core accepts every level and filtering is
+	// done by the adjustable global and component levels.
 	level, err := zapcore.ParseLevel(cfg.Level)
-	if err == nil {
-		config.Level = zap.NewAtomicLevelAt(level)
+	if err != nil {
+		level = zapcore.InfoLevel
 	}
+	config.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
+	levels := newLevels(level)
 
 	// Configure encoding
 	if cfg.Format == "console" {
@@ -103,27 +116,34 @@ func NewLogger(cfg Config) Logger {
 		opts = append(opts, zap.Fields(fields...))
 	}
 
-	// Configure field redaction
-	if len(cfg.Redact) > 0 {
-		opts = append(opts, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
-			return zapcore.NewSamplerWithOptions(core, time.Second, cfg.Sampling.Initial, cfg.Sampling.Thereafter)
-		}))
-	}
-
 	logger, err := config.Build(opts...)
 	if err != nil {
 		panic("failed to initialize logger: " + err.Error())
 	}
 
+	// Configure field redaction
+	redact := make(map[string]bool, len(cfg.Redact))
+	for _, key := range cfg.Redact {
+		redact[strings.ToLower(key)] = true
+	}
+
 	return &zapLogger{
-		logger: logger,
+		logger: filtered(logger, levels, ""),
+		base:   logger,
+		levels: levels,
+		redact: redact,
 	}
 }
 
 // With creates a child logger with the given fields
 func (l *zapLogger) With(fields ...Field) Logger {
+	zapFields := l.convertFields(fields...)
 	return &zapLogger{
-		logger: l.logger.With(l.convertFields(fields...)...),
+		logger:    l.logger.With(zapFields...),
+		base:      l.base.With(zapFields...),
+		levels:    l.levels,
+		component: l.component,
+		redact:    l.redact,
 	}
 }
 
@@ -152,10 +172,14 @@ func (l *zapLogger) Fatal(msg string, fields ...Field) {
 	l.logger.Fatal(msg, l.convertFields(fields...)...)
 }
 
-// convertFields converts logger.Field to zap.Field
+// convertFields converts logger.Field to zap.Field, masking redacted fields
 func (l *zapLogger) convertFields(fields ...Field) []zap.Field {
 	zapFields := make([]zap.Field, 0, len(fields))
 	for _, field := range fields {
+		if l.redact[strings.ToLower(field.Key)] {
+			zapFields = append(zapFields, zap.String(field.Key, redacted))
+			continue
+		}
 		zapFields = append(zapFields, zap.Any(field.Key, field.Value))
 	}
 	return zapFields
@@ -100,6 +100,29 @@ func TestLogLevels(t *testing.T) {
 	}
 }
 
+func TestLoggerRedactsFields(t *testing.T) {
+	tmpfile, err := os.CreateTemp("", "log")
+	require.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	logger := NewLogger(Config{
+		Level:  "info",
+		Format: "json",
+		Output: tmpfile.Name(),
+		Redact: []string{"password", "Authorization"},
+	})
+	logger.With(String("authorization", "Bearer abc")).Info("login", String("Password", "hunter2"), String("user", "ada"))
+	tmpfile.Close()
+
+	content, err := os.ReadFile(tmpfile.Name())
+	require.NoError(t, err)
+	var logEntry map[string]interface{}
+	require.NoError(t, json.Unmarshal(bytes.TrimSpace(content), &logEntry))
+	assert.Equal(t, "[REDACTED]", logEntry["Password"])
+	assert.Equal(t, "[REDACTED]", logEntry["authorization"])
+	assert.Equal(t, "ada", logEntry["user"])
+}
+
 func TestConvenienceFunctions(t *testing.T) {
 	// Test String field
 	field := String("key", "value")
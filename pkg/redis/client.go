@@ -0,0 +1,228 @@
+// Package redis is a minimal Redis client speaking RESP2, enough for the
+// gateway's shared caches: GET, SET with expiry and DEL over pooled
+// connections.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// maxIdleConns is how many idle connections are kept for reuse
+const maxIdleConns = 8
+
+// Options configures a client
+type Options struct {
+	Address  string
+	Password string
+	DB       int
+	Timeout  time.Duration // Dial and per-command timeout
+}
+
+// Client sends commands to one Redis server
+type Client struct {
+	options Options
+	idle    chan *conn
+}
+
+// conn is a connection with its reader
+type conn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// Error is an error reply from the server
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// New creates a client. Connections are opened on first use.
+func New(options Options) *Client {
+	if options.Timeout <= 0 {
+		options.Timeout = time.Second
+	}
+	return &Client{options: options, idle: make(chan *conn, maxIdleConns)}
+}
+
+// Get returns the value of key and whether it exists
+func (c *Client) Get(ctx context.Context, key string) (string, bool, error) {
+	reply, err := c.do(ctx, "GET", key)
+	if err != nil {
+		return "", false, err
+	}
+	if reply == nil {
+		return "", false, nil
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return "", false, fmt.Errorf("unexpected GET reply %v", reply)
+	}
+	return value, true, nil
+}
+
+// Set stores value at key, expiring after ttl if it is positive
+func (c *Client) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	args := []string{"SET", key, value}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := c.do(ctx, args...)
+	return err
+}
+
+// Del removes keys
+func (c *Client) Del(ctx context.Context, keys ...string) error {
+	_, err := c.do(ctx, append([]string{"DEL"}, keys...)...)
+	return err
+}
+
+// Close closes the idle connections
+func (c *Client) Close() error {
+	for {
+		select {
+		case cn := <-c.idle:
+			cn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do sends a command and reads its reply. Connections are returned to the
+// pool unless the exchange failed, which leaves them in an unknown state.
+func (c *Client) do(ctx context.Context, args ...string) (interface{}, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(c.options.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	cn.SetDeadline(deadline)
+
+	reply, err := cn.command(args...)
+	var replyErr Error
+	if err != nil && !errors.As(err, &replyErr) {
+		cn.Close()
+		return nil, err
+	}
+	c.put(cn)
+	return reply, err
+}
+
+// get returns an idle connection or dials a new one
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	default:
+	}
+
+	dialer := net.Dialer{Timeout: c.options.Timeout}
+	nc, err := dialer.DialContext(ctx, "tcp", c.options.Address)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{Conn: nc, reader: bufio.NewReader(nc)}
+	nc.SetDeadline(time.Now().Add(c.options.Timeout))
+	if c.options.Password != "" {
+		if _, err := cn.command("AUTH", c.options.Password); err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("redis AUTH failed: %w", err)
+		}
+	}
+	if c.options.DB != 0 {
+		if _, err := cn.command("SELECT", strconv.Itoa(c.options.DB)); err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("redis SELECT failed: %w", err)
+		}
+	}
+	return cn, nil
+}
+
+// put returns a connection to the pool, closing it if the pool is full
+func (c *Client) put(cn *conn) {
+	select {
+	case c.idle <- cn:
+	default:
+		cn.Close()
+	}
+}
+
+// command writes a command as a RESP array and reads the reply
+func (cn *conn) command(args ...string) (interface{}, error) {
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, "\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	if _, err := cn.Write(buf); err != nil {
+		return nil, err
+	}
+	return readReply(cn.reader)
+}
+
+// readReply reads a RESP2 reply. Bulk and simple strings are returned as
+// strings, integers as int64, arrays as []interface{} and nil replies as nil.
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed redis reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, Error(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unknown redis reply type %q", kind)
+	}
+}
@@ -0,0 +1,75 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"api-gateway/pkg/redis/redistest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientGetSetDel(t *testing.T) {
+	server, err := redistest.NewServer()
+	require.NoError(t, err)
+	defer server.Close()
+	server.SetPassword("secret")
+
+	client := New(Options{Address: server.Addr, Password: "secret", DB: 2})
+	defer client.Close()
+	ctx := context.Background()
+
+	_, ok, err := client.Get(ctx, "missing")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, client.Set(ctx, "key", "value\r\nwith newline", time.Minute))
+	value, ok, err := client.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "value\r\nwith newline", value)
+	assert.InDelta(t, time.Minute.Seconds(), server.TTL("key").Seconds(), 1)
+
+	require.NoError(t, client.Del(ctx, "key"))
+	_, ok, _ = client.Get(ctx, "key")
+	assert.False(t, ok)
+}
+
+func TestClientReusesConnections(t *testing.T) {
+	server, err := redistest.NewServer()
+	require.NoError(t, err)
+	defer server.Close()
+	server.SetPassword("secret")
+
+	client := New(Options{Address: server.Addr, Password: "secret"})
+	defer client.Close()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, client.Set(context.Background(), "key", "value", 0))
+	}
+	// One AUTH for the single connection, then the commands
+	assert.Equal(t, 6, server.Commands())
+}
+
+func TestClientAuthFailure(t *testing.T) {
+	server, err := redistest.NewServer()
+	require.NoError(t, err)
+	defer server.Close()
+	server.SetPassword("secret")
+
+	client := New(Options{Address: server.Addr, Password: "wrong"})
+	_, _, err = client.Get(context.Background(), "key")
+	assert.ErrorContains(t, err, "redis AUTH failed: WRONGPASS")
+}
+
+func TestReadReply(t *testing.T) {
+	reply, err := readReply(bufio.NewReader(strings.NewReader("*3\r\n:1\r\n$-1\r\n+OK\r\n")))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(1), nil, "OK"}, reply)
+
+	_, err = readReply(bufio.NewReader(strings.NewReader("-ERR wrong type\r\n")))
+	assert.Equal(t, Error("ERR wrong type"), err)
+}
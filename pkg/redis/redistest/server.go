@@ -0,0 +1,189 @@
+// Package redistest provides an in-memory Redis server for tests, speaking
+// the subset of RESP2 the redis client uses
+package redistest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is an in-memory Redis server supporting AUTH, SELECT, GET, SET with
+// PX and DEL
+type Server struct {
+	Addr string
+
+	listener net.Listener
+	mutex    sync.Mutex
+	password string
+	data     map[string]entry
+	commands int
+}
+
+type entry struct {
+	value   string
+	expires time.Time
+}
+
+// NewServer starts a server on a local port
+func NewServer() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{Addr: listener.Addr().String(), listener: listener, data: make(map[string]entry)}
+	go s.serve()
+	return s, nil
+}
+
+// Close stops the server
+func (s *Server) Close() error {
+	return s.listener.Close()
+}
+
+// SetPassword requires clients to AUTH with password, none if empty
+func (s *Server) SetPassword(password string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.password = password
+}
+
+// Get returns a stored value, for assertions
+func (s *Server) Get(key string) (string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e, ok := s.data[key]
+	if !ok || (!e.expires.IsZero() && time.Now().After(e.expires)) {
+		return "", false
+	}
+	return e.value, true
+}
+
+// TTL returns the remaining time to live of a key, 0 if it doesn't expire
+func (s *Server) TTL(key string) time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e, ok := s.data[key]
+	if !ok || e.expires.IsZero() {
+		return 0
+	}
+	return time.Until(e.expires)
+}
+
+// Commands returns how many commands were served
+func (s *Server) Commands() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.commands
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	s.mutex.Lock()
+	password := s.password
+	s.mutex.Unlock()
+	authenticated := password == ""
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		s.commands++
+		s.mutex.Unlock()
+
+		name := strings.ToUpper(args[0])
+		if !authenticated && name != "AUTH" {
+			fmt.Fprint(conn, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+		switch name {
+		case "AUTH":
+			if len(args) == 2 && args[1] == password {
+				authenticated = true
+				fmt.Fprint(conn, "+OK\r\n")
+			} else {
+				fmt.Fprint(conn, "-WRONGPASS invalid password\r\n")
+			}
+		case "SELECT":
+			fmt.Fprint(conn, "+OK\r\n")
+		case "GET":
+			if value, ok := s.Get(args[1]); ok {
+				fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(value), value)
+			} else {
+				fmt.Fprint(conn, "$-1\r\n")
+			}
+		case "SET":
+			e := entry{value: args[2]}
+			if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+				ms, _ := strconv.Atoi(args[4])
+				e.expires = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			}
+			s.mutex.Lock()
+			s.data[args[1]] = e
+			s.mutex.Unlock()
+			fmt.Fprint(conn, "+OK\r\n")
+		case "DEL":
+			s.mutex.Lock()
+			deleted := 0
+			for _, key := range args[1:] {
+				if _, ok := s.data[key]; ok {
+					delete(s.data, key)
+					deleted++
+				}
+			}
+			s.mutex.Unlock()
+			fmt.Fprintf(conn, ":%d\r\n", deleted)
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+	}
+}
+
+// readCommand reads a command sent as a RESP array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("expected array, got %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid array length %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}